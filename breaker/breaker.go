@@ -0,0 +1,88 @@
+// Package breaker implements circuit breakers that stop calling a failing dependency
+// for a cooldown period, so that its failures don't slow down every caller.
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// States of a circuit breaker
+const (
+	// Closed lets all calls through
+	Closed = "closed"
+	// Open rejects all calls until the cooldown elapses
+	Open = "open"
+	// HalfOpen lets a single trial call through after the cooldown
+	HalfOpen = "half_open"
+)
+
+// Breaker opens after a number of consecutive failures, and lets a trial call through
+// once the cooldown elapses. The circuit closes again when the trial call succeeds.
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     string
+	failures  int
+	openedAt  time.Time
+	now       func() time.Time
+}
+
+// New returns a closed breaker opening after the threshold of consecutive failures
+func New(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     Closed,
+		now:       time.Now,
+	}
+}
+
+// Allow says whether a call can be made. A call allowed on an open circuit
+// after its cooldown is the trial, and the circuit is half-open until its result.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Open:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = HalfOpen
+		return true
+	case HalfOpen:
+		return false
+	}
+	return true
+}
+
+// Success records a successful call, which closes the circuit
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = Closed
+	b.failures = 0
+}
+
+// Failure records a failed call, which opens the circuit on the threshold
+// of consecutive failures or when the trial call fails
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.state = Open
+		b.openedAt = b.now()
+	}
+}
+
+// State returns the current state of the circuit
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.cooldown {
+		return HalfOpen
+	}
+	return b.state
+}
@@ -0,0 +1,44 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := New(3, 30*time.Second)
+	b.now = func() time.Time { return now }
+
+	// Failures below the threshold keep the circuit closed
+	b.Failure()
+	b.Failure()
+	assert.Equal(t, Closed, b.State(), "Circuit should be closed below the threshold")
+	b.Success()
+	b.Failure()
+	b.Failure()
+	assert.True(t, b.Allow(), "Success should reset the consecutive failures")
+
+	// The threshold opens the circuit until the cooldown
+	b.Failure()
+	assert.Equal(t, Open, b.State(), "Circuit should open on the threshold")
+	assert.False(t, b.Allow(), "Open circuit should reject calls")
+
+	// A single trial call is allowed after the cooldown, and its failure opens the circuit again
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, HalfOpen, b.State(), "Circuit should be half-open after the cooldown")
+	assert.True(t, b.Allow(), "Trial call should be allowed")
+	assert.False(t, b.Allow(), "Only one trial call should be allowed")
+	b.Failure()
+	assert.Equal(t, Open, b.State(), "Failed trial should open the circuit")
+	assert.False(t, b.Allow(), "Circuit should be open for another cooldown")
+
+	// A successful trial closes the circuit
+	now = now.Add(30 * time.Second)
+	assert.True(t, b.Allow(), "Trial call should be allowed")
+	b.Success()
+	assert.Equal(t, Closed, b.State(), "Successful trial should close the circuit")
+	assert.True(t, b.Allow(), "Closed circuit should allow calls")
+}
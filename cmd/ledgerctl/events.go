@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/RealImage/QLedger/models"
+	"github.com/RealImage/QLedger/verifier"
+)
+
+// ledgerClient gets the balances of the accounts from the API of the ledger
+type ledgerClient struct {
+	url    string
+	token  string
+	tenant string
+	client *http.Client
+}
+
+// balances returns the balances of the account, which are zero if the account doesn't exist
+func (l *ledgerClient) balances(account string) (verifier.Balances, error) {
+	req, err := http.NewRequest(http.MethodGet, l.url+"/v1/accounts/"+url.PathEscape(account), nil)
+	if err != nil {
+		return nil, err
+	}
+	if l.token != "" {
+		req.Header.Set("Authorization", l.token)
+	}
+	if l.tenant != "" {
+		req.Header.Set("X-Ledger-Tenant", l.tenant)
+	}
+	req.Header.Set("X-Response-Envelope", "false")
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return verifier.Balances{}, nil
+	default:
+		return nil, fmt.Errorf("Unexpected status: %v", resp.Status)
+	}
+	result := &models.Account{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, err
+	}
+	return verifier.LedgerBalances(result), nil
+}
+
+// validSignature says whether the signature header is the HMAC-SHA256 of the payload with the secret
+func validSignature(secret string, payload []byte, signature string) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// eventReceiver serves the webhook of the ledger, adding the delivered events to the checker
+type eventReceiver struct {
+	checker *verifier.EventChecker
+	secret  string
+	// record writes the received events, so that they can be checked again from a file
+	record *json.Encoder
+
+	mu       sync.Mutex
+	received time.Time
+}
+
+func (e *eventReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if e.secret != "" && !validSignature(e.secret, payload, r.Header.Get("X-Ledger-Signature")) {
+		log.Println("Invalid signature of delivery:", r.Header.Get("X-Ledger-Delivery"))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	delivery, _ := strconv.ParseInt(r.Header.Get("X-Ledger-Delivery"), 10, 64)
+	if err := e.checker.AddEvent(payload, delivery); err != nil {
+		log.Println("Error adding event:", delivery, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	e.mu.Lock()
+	e.received = time.Now()
+	if e.record != nil {
+		if err := e.record.Encode(&verifier.RecordedEvent{Delivery: delivery, Payload: payload}); err != nil {
+			log.Println("Error recording event:", delivery, err)
+		}
+	}
+	e.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+// lastReceived returns when the latest event was received
+func (e *eventReceiver) lastReceived() time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.received
+}
+
+// compareBalances compares the recomputed balances against the ledger and logs the outcome.
+// It returns the number of the mismatched accounts.
+func compareBalances(checker *verifier.EventChecker, client *ledgerClient) (int, error) {
+	compared, mismatched, err := checker.Compare(client.balances)
+	if err != nil {
+		return 0, err
+	}
+	s := checker.Summary()
+	log.Printf("Checked events: %d events, %d transactions, %d redelivered, %d conflicting, %d out of order; "+
+		"%d accounts compared, %d mismatched", s.Events, s.Transactions, s.Redelivered, s.Conflicting, s.OutOfOrder,
+		compared, mismatched)
+	return mismatched, nil
+}
+
+// inconsistent says whether the checker found any inconsistencies along with the mismatched accounts
+func inconsistent(checker *verifier.EventChecker, mismatched int) bool {
+	s := checker.Summary()
+	return mismatched > 0 || s.Conflicting > 0 || s.OutOfOrder > 0
+}
+
+// checkEventsCommand recomputes the balances of the accounts from the events of the ledger, either read from
+// a file or received as a webhook, and compares them against the balances reported by the API. It writes the
+// inconsistencies to stdout as JSON Lines, and returns the exit code.
+func checkEventsCommand(args []string) int {
+	flags := flag.NewFlagSet("check-events", flag.ContinueOnError)
+	file := flags.String("file", "", "JSON Lines of the webhook payloads or recorded events, or - for stdin")
+	addr := flags.String("addr", "", "address to receive the webhook deliveries on, instead of reading a file")
+	secret := flags.String("secret", "", "secret of the webhook, whose signatures are verified if given")
+	record := flags.String("record", "", "file the received events are appended to, which can be checked again using --file")
+	settle := flags.Duration("settle", 30*time.Second, "quiet period of the webhook after which the balances are compared")
+	ledgerURL := flags.String("url", "http://localhost:7000", "URL of the ledger API, including the host prefix")
+	token := flags.String("token", os.Getenv("LEDGER_AUTH_TOKEN"), "token or API key of the Authorization header")
+	tenant := flags.String("tenant", "", "tenant of the ledger, when the tenants are isolated")
+	if err := flags.Parse(args); err != nil {
+		return verifyFailed
+	}
+	if (*file == "") == (*addr == "") || *settle <= 0 {
+		flags.Usage()
+		return verifyFailed
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	encoder := json.NewEncoder(out)
+	var outMu sync.Mutex
+	checker := verifier.NewEventChecker(func(diff *verifier.Diff) error {
+		outMu.Lock()
+		defer outMu.Unlock()
+		if err := encoder.Encode(diff); err != nil {
+			return err
+		}
+		return out.Flush()
+	})
+	client := &ledgerClient{
+		url:    strings.TrimSuffix(*ledgerURL, "/"),
+		token:  *token,
+		tenant: *tenant,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+
+	if *file != "" {
+		var r io.Reader = os.Stdin
+		if *file != "-" {
+			f, err := os.Open(*file)
+			if err != nil {
+				log.Println("Error opening events:", err)
+				return verifyFailed
+			}
+			defer f.Close()
+			r = f
+		}
+		if err := checker.ReadEvents(bufio.NewReader(r)); err != nil {
+			log.Println("Error reading events:", err)
+			return verifyFailed
+		}
+		mismatched, err := compareBalances(checker, client)
+		if err != nil {
+			log.Println("Error comparing balances:", err)
+			return verifyFailed
+		}
+		if inconsistent(checker, mismatched) {
+			return verifyDifferences
+		}
+		return verifyMatched
+	}
+
+	receiver := &eventReceiver{checker: checker, secret: *secret}
+	if *record != "" {
+		f, err := os.OpenFile(*record, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Println("Error opening record file:", err)
+			return verifyFailed
+		}
+		defer f.Close()
+		receiver.record = json.NewEncoder(f)
+	}
+	go func() {
+		log.Println("Receiving events on", *addr)
+		log.Fatal(http.ListenAndServe(*addr, receiver))
+	}()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	// The balances are compared whenever the webhook has been quiet for the settle period,
+	// as the ledger is then expected to have delivered all its events
+	var compared time.Time
+	mismatched := 0
+	for {
+		select {
+		case <-stop:
+			if checker.Summary().Events > 0 {
+				var err error
+				if mismatched, err = compareBalances(checker, client); err != nil {
+					log.Println("Error comparing balances:", err)
+					return verifyFailed
+				}
+			}
+			if inconsistent(checker, mismatched) {
+				return verifyDifferences
+			}
+			return verifyMatched
+		case <-ticker.C:
+			received := receiver.lastReceived()
+			if received.IsZero() || !received.After(compared) || time.Since(received) < *settle {
+				continue
+			}
+			var err error
+			mismatched, err = compareBalances(checker, client)
+			switch {
+			case err == verifier.ErrStreamChanged:
+				log.Println("Events were received while comparing balances, which are compared again once settled")
+			case err != nil:
+				log.Println("Error comparing balances:", err)
+			default:
+				compared = received
+			}
+		}
+	}
+}
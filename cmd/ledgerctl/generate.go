@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RealImage/QLedger/generator"
+	"github.com/RealImage/QLedger/ledger"
+	"github.com/RealImage/QLedger/models"
+)
+
+// parseCount parses a count with an optional `k` or `m` suffix, such as `10k`
+func parseCount(value string) (int, error) {
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(value, "k"):
+		multiplier = 1000
+	case strings.HasSuffix(value, "m"):
+		multiplier = 1000000
+	}
+	count, err := strconv.Atoi(strings.TrimRight(value, "km"))
+	if err != nil || count <= 0 {
+		return 0, fmt.Errorf("Invalid count: %v", value)
+	}
+	return count * multiplier, nil
+}
+
+func profileNames() string {
+	var names []string
+	for name := range generator.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// generateCommand populates the ledger of `DATABASE_URL` with synthetic data, or writes
+// the transactions as NDJSON for the bulk API with `--ndjson`, and returns the exit code
+func generateCommand(args []string) int {
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	accountsFlag := flags.String("accounts", "1k", "number of accounts, such as 10k")
+	profileFlag := flags.String("tps-profile", "ecommerce", "profile of the transactions: "+profileNames())
+	days := flags.Int("days", 30, "number of days of transactions")
+	end := flags.String("end", time.Now().UTC().Format("2006-01-02"), "day the transactions end before")
+	seed := flags.Int64("seed", 1, "seed of the generated data")
+	batchSize := flags.Int("batch", 500, "number of transactions posted at a time")
+	ndjson := flags.Bool("ndjson", false, "write the transactions to stdout instead of posting them")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	accounts, err := parseCount(*accountsFlag)
+	if err != nil {
+		log.Println(err)
+		return 2
+	}
+	profile, ok := generator.Profiles[*profileFlag]
+	if !ok {
+		log.Println("Invalid profile:", *profileFlag)
+		return 2
+	}
+	endDate, err := time.Parse("2006-01-02", *end)
+	if err != nil {
+		log.Println("Invalid end:", *end)
+		return 2
+	}
+	g, err := generator.New(generator.Options{Accounts: accounts, Profile: profile, Days: *days, End: endDate, Seed: *seed})
+	if err != nil {
+		log.Println(err)
+		return 2
+	}
+
+	if *ndjson {
+		encoder := json.NewEncoder(os.Stdout)
+		if err := g.Transactions(func(txn *models.Transaction) error { return encoder.Encode(txn) }); err != nil {
+			log.Println("Error writing transactions:", err)
+			return 1
+		}
+		return 0
+	}
+
+	l, err := ledger.Open(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println("Unable to connect to Database:", err)
+		return 1
+	}
+	defer l.Close()
+	if err := populate(l, g, *batchSize); err != nil {
+		log.Println("Error generating data:", err)
+		return 1
+	}
+	return 0
+}
+
+// populate creates the accounts and posts the transactions of the generator in batches.
+// The transactions which already exist are skipped, so an interrupted run can be resumed.
+func populate(l *ledger.Ledger, g *generator.Generator, batchSize int) error {
+	accountDB := models.NewAccountDB(l.DB())
+	for _, account := range g.Accounts() {
+		if _, aerr := accountDB.UpsertAccount(account); aerr != nil {
+			return aerr
+		}
+	}
+	log.Println("Created accounts:", len(g.Accounts()))
+
+	transactionDB := models.NewTransactionDB(l.DB())
+	counts := make(map[string]int)
+	var batch []*models.Transaction
+	batches := 0
+	post := func() error {
+		results, aerr := transactionDB.TransactBatch(batch)
+		if aerr != nil {
+			return aerr
+		}
+		for _, result := range results {
+			counts[result.Status]++
+			if result.Status == models.BulkStatusFailed {
+				log.Println("Failed transaction:", result.ID, result.Reason)
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	err := g.Transactions(func(txn *models.Transaction) error {
+		batch = append(batch, txn)
+		if len(batch) < batchSize {
+			return nil
+		}
+		if err := post(); err != nil {
+			return err
+		}
+		if batches++; batches%20 == 0 {
+			log.Println("Posted transactions:", batches*batchSize)
+		}
+		return nil
+	})
+	if err == nil && len(batch) > 0 {
+		err = post()
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Posted transactions: %d created, %d duplicate, %d failed",
+		counts[models.BulkStatusCreated], counts[models.BulkStatusDuplicate], counts[models.BulkStatusFailed])
+	if counts[models.BulkStatusFailed] > 0 {
+		return errors.New("Some transactions failed")
+	}
+	return nil
+}
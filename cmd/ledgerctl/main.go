@@ -0,0 +1,38 @@
+// Command ledgerctl runs the maintenance tasks of a ledger, such as generating synthetic data,
+// verifying the transactions against an external system and checking its event stream.
+//
+//	ledgerctl generate --accounts 10k --tps-profile ecommerce --days 90 --seed 1
+//	ledgerctl verify --file processor.csv --account processor --from 2017-06-01
+//	ledgerctl check-events --addr :9000 --secret s3cr3t --url http://localhost:7000
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: ledgerctl <command> [options]
+
+Commands:
+  generate    populates a ledger with synthetic accounts and transactions
+  verify      compares the transactions of a ledger against the export of an external system
+  check-events  compares the balances recomputed from the events of a ledger against its balances
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "generate":
+		os.Exit(generateCommand(os.Args[2:]))
+	case "verify":
+		os.Exit(verifyCommand(os.Args[2:]))
+	case "check-events":
+		os.Exit(checkEventsCommand(os.Args[2:]))
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/RealImage/QLedger/ledger"
+	"github.com/RealImage/QLedger/models"
+	"github.com/RealImage/QLedger/verifier"
+)
+
+// Exit codes of the verify command, following `diff`
+const (
+	verifyMatched     = 0
+	verifyDifferences = 1
+	verifyFailed      = 2
+)
+
+// parseVerifyTime parses a bound of the transaction timestamps, either as a timestamp or a date
+func parseVerifyTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(models.LedgerTimestampLayout, value)
+	if err != nil {
+		t, err = time.Parse("2006-01-02", value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// readExternal reads the external entries of the file, or of stdin if it is `-`, in the format
+// given or else the format of the file extension
+func readExternal(path string, format string, columns verifier.Columns) (map[string]*verifier.Entry, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+	if format == "" && strings.HasSuffix(strings.ToLower(path), ".csv") {
+		format = "csv"
+	}
+	if format == "csv" {
+		return verifier.ReadCSV(bufio.NewReader(r), columns)
+	}
+	return verifier.ReadJSONL(bufio.NewReader(r), columns)
+}
+
+// verifyCommand compares the transactions of the ledger of `DATABASE_URL` against the export of
+// an external system, writes the differences to stdout as JSON Lines, and returns the exit code
+func verifyCommand(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	file := flags.String("file", "", "export of the external system, or - for stdin")
+	format := flags.String("format", "", "format of the export: csv or jsonl (default from the file extension, else jsonl)")
+	account := flags.String("account", "", "account whose lines are compared, instead of the whole transactions")
+	from := flags.String("from", "", "earliest transaction timestamp or date compared")
+	to := flags.String("to", "", "latest transaction timestamp or date compared")
+	idColumn := flags.String("id-column", verifier.DefaultColumns.ID, "field of the transaction ID in the export")
+	amountColumn := flags.String("amount-column", verifier.DefaultColumns.Amount, "field of the amount in the export")
+	currencyColumn := flags.String("currency-column", verifier.DefaultColumns.Currency, "field of the optional currency in the export")
+	if err := flags.Parse(args); err != nil {
+		return verifyFailed
+	}
+	if *file == "" || (*format != "" && *format != "csv" && *format != "jsonl") {
+		flags.Usage()
+		return verifyFailed
+	}
+	filter := &models.LineExportFilter{AccountID: *account}
+	var err error
+	if filter.From, err = parseVerifyTime(*from); err != nil {
+		log.Println("Invalid from:", *from)
+		return verifyFailed
+	}
+	if filter.To, err = parseVerifyTime(*to); err != nil {
+		log.Println("Invalid to:", *to)
+		return verifyFailed
+	}
+
+	columns := verifier.Columns{ID: *idColumn, Amount: *amountColumn, Currency: *currencyColumn}
+	external, err := readExternal(*file, *format, columns)
+	if err != nil {
+		log.Println("Error reading export:", err)
+		return verifyFailed
+	}
+	log.Println("Read external entries:", len(external))
+
+	l, err := ledger.Open(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println("Unable to connect to Database:", err)
+		return verifyFailed
+	}
+	defer l.Close()
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	encoder := json.NewEncoder(out)
+	v := verifier.New(external, *account, func(diff *verifier.Diff) error { return encoder.Encode(diff) })
+
+	// The lines are read from a single snapshot, so that the transactions posted meanwhile are left out
+	tx, aerr := models.BeginRead(l.DB(), "")
+	if aerr != nil {
+		log.Println("Error beginning read:", aerr)
+		return verifyFailed
+	}
+	defer tx.Rollback()
+	lineDB := models.NewLineDB(l.DB())
+	if aerr := lineDB.Export(tx, filter, v.AddLine); aerr != nil {
+		log.Println("Error reading transactions:", aerr)
+		return verifyFailed
+	}
+	if err := v.Finish(); err != nil {
+		log.Println("Error writing differences:", err)
+		return verifyFailed
+	}
+
+	log.Printf("Verified transactions: %d matched, %d missing in external, %d missing in ledger, %d mismatched",
+		v.Summary.Matched, v.Summary.MissingInExternal, v.Summary.MissingInLedger, v.Summary.Mismatched)
+	if v.Summary.Differences() > 0 {
+		return verifyDifferences
+	}
+	return verifyMatched
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	mu         sync.Mutex
+	reloadable = make(map[string]bool)
+	hooks      []func()
+)
+
+// Reloadable marks the settings which can be changed without restarting the server
+func Reloadable(keys ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range keys {
+		reloadable[key] = true
+	}
+}
+
+// OnReload registers a function to apply the reloaded settings
+func OnReload(fn func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = append(hooks, fn)
+}
+
+// ReadFile parses settings in the format of `example.env`:
+// `KEY=VALUE` lines, optionally prefixed with `export`, with `#` comments
+func ReadFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	settings := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid setting in %v line %v", path, n)
+		}
+		settings[strings.TrimSpace(parts[0])] = strings.Trim(strings.TrimSpace(parts[1]), `"'`)
+	}
+	return settings, scanner.Err()
+}
+
+// Load sets all the settings of the `CONFIG_FILE` in the environment
+func Load() error {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return nil
+	}
+	settings, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for key, value := range settings {
+		os.Setenv(key, value)
+	}
+	return nil
+}
+
+// Reload re-reads the `CONFIG_FILE` and applies the changes of the reloadable settings.
+// Changes to the other settings are ignored until the server restarts.
+// It returns the keys of the changed settings.
+func Reload() ([]string, error) {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return nil, fmt.Errorf("CONFIG_FILE is not set")
+	}
+	settings, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var changed []string
+	for key, value := range settings {
+		if os.Getenv(key) == value {
+			continue
+		}
+		if !reloadable[key] {
+			log.Println("Ignoring change of setting which requires restart:", key)
+			continue
+		}
+		os.Setenv(key, value)
+		changed = append(changed, key)
+	}
+	if len(changed) > 0 {
+		for _, fn := range hooks {
+			fn()
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "qledger_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+func TestReadFile(t *testing.T) {
+	path := writeConfigFile(t, `
+# comment
+export PORT=7000
+DATABASE_URL="postgres://localhost/ledgerdb?sslmode=disable"
+LEDGER_AUTH_TOKEN=
+`)
+	defer os.Remove(path)
+
+	settings, err := ReadFile(path)
+	assert.Equal(t, nil, err, "Error reading config file")
+	assert.Equal(t, map[string]string{
+		"PORT":              "7000",
+		"DATABASE_URL":      "postgres://localhost/ledgerdb?sslmode=disable",
+		"LEDGER_AUTH_TOKEN": "",
+	}, settings, "Invalid settings")
+
+	invalid := writeConfigFile(t, "INVALID LINE\n")
+	defer os.Remove(invalid)
+	_, err = ReadFile(invalid)
+	assert.NotEqual(t, nil, err, "Invalid line should fail")
+}
+
+func TestReload(t *testing.T) {
+	path := writeConfigFile(t, "TEST_RELOADABLE=one\nTEST_STRUCTURAL=one\n")
+	defer os.Remove(path)
+	os.Setenv("CONFIG_FILE", path)
+	defer os.Unsetenv("CONFIG_FILE")
+
+	assert.Equal(t, nil, Load(), "Error loading config")
+	assert.Equal(t, "one", os.Getenv("TEST_RELOADABLE"), "Setting not loaded")
+
+	reloads := 0
+	Reloadable("TEST_RELOADABLE")
+	OnReload(func() { reloads++ })
+
+	err := ioutil.WriteFile(path, []byte("TEST_RELOADABLE=two\nTEST_STRUCTURAL=two\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := Reload()
+	assert.Equal(t, nil, err, "Error reloading config")
+	assert.Equal(t, []string{"TEST_RELOADABLE"}, changed, "Invalid changed settings")
+	assert.Equal(t, "two", os.Getenv("TEST_RELOADABLE"), "Reloadable setting not changed")
+	assert.Equal(t, "one", os.Getenv("TEST_STRUCTURAL"), "Structural setting should not change")
+	assert.Equal(t, 1, reloads, "Reload hooks not called")
+
+	// No changes
+	changed, err = Reload()
+	assert.Equal(t, nil, err, "Error reloading config")
+	assert.Equal(t, 0, len(changed), "Invalid changed settings")
+	assert.Equal(t, 1, reloads, "Reload hooks should not be called")
+}
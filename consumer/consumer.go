@@ -0,0 +1,20 @@
+// Package consumer receives transaction commands from message queues, so that the producers of
+// event-driven architectures can post transactions by publishing messages instead of calling the API.
+package consumer
+
+// Message is a message received from a queue, whose body is a transaction in the same JSON as `POST /v1/transactions`
+type Message struct {
+	ID   string
+	Body []byte
+	// Receipt identifies the delivery of the message to acknowledge it
+	Receipt string
+}
+
+// Source is a queue of messages. A received message is delivered again after a while unless it is
+// acknowledged, so every message is processed at least once.
+type Source interface {
+	// Receive waits for the next messages, and returns no messages when none arrive in a while
+	Receive() ([]*Message, error)
+	// Ack acknowledges a processed message, so that it isn't delivered again
+	Ack(message *Message) error
+}
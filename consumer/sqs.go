@@ -0,0 +1,201 @@
+package consumer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Credentials are the AWS credentials signing the requests
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is the optional token of temporary credentials
+	SessionToken string
+}
+
+// SQS receives the messages of an Amazon SQS queue with long polling, using the JSON protocol of the SQS API.
+// The messages are deleted from the queue once they are acknowledged.
+type SQS struct {
+	QueueURL    string
+	Region      string
+	Credentials Credentials
+	// WaitTime is the long polling time of receiving messages, of up to 20 seconds
+	WaitTime time.Duration
+	// MaxMessages is the maximum number of messages received at a time, of up to 10
+	MaxMessages int
+	Client      *http.Client
+	endpoint    string
+	now         func() time.Time
+}
+
+// NewSQS returns a source of the queue. The region is read from the queue URL when it is empty.
+func NewSQS(queueURL, region string, credentials Credentials) (*SQS, error) {
+	u, err := url.Parse(queueURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("Invalid SQS queue URL: %v", queueURL)
+	}
+	if region == "" {
+		// The queue URLs are like `https://sqs.us-east-1.amazonaws.com/123456789012/ledger`
+		parts := strings.Split(u.Host, ".")
+		if len(parts) < 3 || parts[0] != "sqs" {
+			return nil, fmt.Errorf("Missing region of SQS queue: %v", queueURL)
+		}
+		region = parts[1]
+	}
+	if credentials.AccessKeyID == "" || credentials.SecretAccessKey == "" {
+		return nil, errors.New("Missing AWS credentials of SQS queue")
+	}
+	return &SQS{
+		QueueURL:    queueURL,
+		Region:      region,
+		Credentials: credentials,
+		WaitTime:    20 * time.Second,
+		MaxMessages: 10,
+		Client:      &http.Client{Timeout: 30 * time.Second},
+		endpoint:    u.Scheme + "://" + u.Host + "/",
+		now:         time.Now,
+	}, nil
+}
+
+type sqsMessage struct {
+	MessageID     string `json:"MessageId"`
+	ReceiptHandle string `json:"ReceiptHandle"`
+	Body          string `json:"Body"`
+}
+
+// Receive waits for the next messages of the queue
+func (s *SQS) Receive() ([]*Message, error) {
+	request := map[string]interface{}{
+		"QueueUrl":            s.QueueURL,
+		"MaxNumberOfMessages": s.MaxMessages,
+		"WaitTimeSeconds":     int(s.WaitTime / time.Second),
+	}
+	var response struct {
+		Messages []*sqsMessage `json:"Messages"`
+	}
+	if err := s.call("ReceiveMessage", request, &response); err != nil {
+		return nil, err
+	}
+	messages := make([]*Message, 0, len(response.Messages))
+	for _, m := range response.Messages {
+		messages = append(messages, &Message{ID: m.MessageID, Body: []byte(m.Body), Receipt: m.ReceiptHandle})
+	}
+	return messages, nil
+}
+
+// Ack deletes the message from the queue
+func (s *SQS) Ack(message *Message) error {
+	request := map[string]interface{}{
+		"QueueUrl":      s.QueueURL,
+		"ReceiptHandle": message.Receipt,
+	}
+	return s.call("DeleteMessage", request, nil)
+}
+
+// call calls an action of the SQS API, and decodes its response when it is given
+func (s *SQS) call(action string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	signV4(req, body, s.Region, "sqs", s.Credentials, s.now())
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiError struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &apiError)
+		return fmt.Errorf("SQS %v failed with status %v: %v %v", action, resp.StatusCode, apiError.Type, apiError.Message)
+	}
+	if response == nil {
+		return nil
+	}
+	return json.Unmarshal(data, response)
+}
+
+// signV4 signs the request with the AWS Signature Version 4 of its headers and body
+func signV4(req *http.Request, body []byte, region, service string, credentials Credentials, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	key := hmacSHA256([]byte("AWS4"+credentials.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+credentials.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func sha256Hex(data []byte) string {
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,84 @@
+package consumer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testCredentials = Credentials{
+	AccessKeyID:     "AKIDEXAMPLE",
+	SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+}
+
+func TestSignV4(t *testing.T) {
+	// The `get-vanilla` case of the AWS Signature Version 4 test suite
+	req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signV4(req, nil, "us-east-1", "service", testCredentials, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"), "Invalid signature")
+}
+
+func TestNewSQS(t *testing.T) {
+	source, err := NewSQS("https://sqs.eu-west-1.amazonaws.com/123456789012/ledger", "", testCredentials)
+	if assert.Nil(t, err, "Error creating SQS source") {
+		assert.Equal(t, "eu-west-1", source.Region, "Region should be read from the queue URL")
+	}
+	_, err = NewSQS("https://queue.example.com/ledger", "", testCredentials)
+	assert.NotNil(t, err, "Queue URL without region should fail")
+	_, err = NewSQS("https://sqs.eu-west-1.amazonaws.com/123456789012/ledger", "", Credentials{})
+	assert.NotNil(t, err, "Missing credentials should fail")
+}
+
+func TestSQS(t *testing.T) {
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/"),
+			"Request should be signed")
+		body, _ := ioutil.ReadAll(r.Body)
+		var request map[string]interface{}
+		json.Unmarshal(body, &request)
+		assert.Equal(t, "http://sqs.test/queue", request["QueueUrl"], "Invalid queue URL")
+		switch r.Header.Get("X-Amz-Target") {
+		case "AmazonSQS.ReceiveMessage":
+			w.Write([]byte(`{"Messages": [{"MessageId": "m1", "ReceiptHandle": "r1", "Body": "{\"id\": \"t001\"}"}]}`))
+		case "AmazonSQS.DeleteMessage":
+			deleted = append(deleted, request["ReceiptHandle"].(string))
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type": "com.amazonaws.sqs#InvalidAction", "message": "Invalid action"}`))
+		}
+	}))
+	defer server.Close()
+
+	source, err := NewSQS("http://sqs.test/queue", "us-east-1", testCredentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.endpoint = server.URL + "/"
+
+	messages, err := source.Receive()
+	assert.Nil(t, err, "Error receiving messages")
+	if assert.Equal(t, 1, len(messages), "Invalid count of messages") {
+		assert.Equal(t, "m1", messages[0].ID, "Invalid message ID")
+		assert.Equal(t, `{"id": "t001"}`, string(messages[0].Body), "Invalid message body")
+		assert.Nil(t, source.Ack(messages[0]), "Error acknowledging message")
+	}
+	assert.Equal(t, []string{"r1"}, deleted, "Acknowledged message should be deleted")
+
+	err = source.call("PurgeQueue", map[string]interface{}{"QueueUrl": source.QueueURL}, nil)
+	if assert.NotNil(t, err, "Failed call should return error") {
+		assert.Contains(t, err.Error(), "Invalid action", "Error should have the API message")
+	}
+}
@@ -2,9 +2,57 @@ package context
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/RealImage/QLedger/models"
 )
 
 // AppContext provides the context to the app components such as controllers, jobs, etc.,
 type AppContext struct {
 	DB *sql.DB
+	// Tenant returns the context of a tenant, when the ledger of every tenant is isolated
+	Tenant func(tenant string) (*AppContext, error)
+	// LedgerID is the tenant whose ledger the context is of, or empty when the tenants aren't isolated
+	LedgerID string
+	// APIKey returns an API key along with the tenant it is scoped to and its metadata scope,
+	// or nil for an unknown or revoked key
+	APIKey func(key string) (*models.APIKey, error)
+	// RequestID identifies the request being handled with the context, if any
+	RequestID string
+	// Metadata restricts the data keys of the request, when its API key has a metadata scope
+	Metadata *models.MetadataScope
+}
+
+// logger writes the structured logs as JSON lines, which carry their own time
+var logger = log.New(os.Stderr, "", 0)
+
+// LogEntry writes the fields as a structured log entry, along with the current time
+func LogEntry(fields map[string]interface{}) {
+	fields["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	data, err := json.Marshal(fields)
+	if err != nil {
+		log.Println("Error while writing log entry:", err)
+		return
+	}
+	logger.Println(string(data))
+}
+
+// Log writes a structured log entry of the message with the request ID, so that the errors
+// of a request can be correlated with it. It can be called on a nil context.
+func (c *AppContext) Log(v ...interface{}) {
+	fields := map[string]interface{}{"message": strings.TrimSuffix(fmt.Sprintln(v...), "\n")}
+	if c != nil && c.RequestID != "" {
+		fields["request_id"] = c.RequestID
+	}
+	LogEntry(fields)
+}
+
+// Logf is like `Log` with the message formatted as per the format
+func (c *AppContext) Logf(format string, v ...interface{}) {
+	c.Log(fmt.Sprintf(format, v...))
 }
@@ -1,14 +1,21 @@
 package controllers
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"regexp"
+	"strings"
+	"time"
 
 	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/middlewares"
 	"github.com/RealImage/QLedger/models"
 )
 
@@ -16,7 +23,7 @@ import (
 func GetAccounts(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Println("Error reading payload:", err)
+		context.Log("Error reading payload:", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -25,35 +32,120 @@ func GetAccounts(w http.ResponseWriter, r *http.Request, context *ledgerContext.
 
 	engine, aerr := models.NewSearchEngine(context.DB, models.SearchNamespaceAccounts)
 	if aerr != nil {
-		log.Println("Error while creating Search Engine:", aerr)
+		context.Log("Error while creating Search Engine:", aerr)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	engine.UseMetadataScope(context.Metadata)
+	// Paginated searches can be consistent by querying the same pinned read snapshot
+	if r.Header.Get(ReadSnapshotHeader) != "" {
+		tx, aerr := beginRead(r, context)
+		if aerr != nil {
+			writeReadError(w, aerr)
+			return
+		}
+		defer tx.Rollback()
+		engine.UseTx(tx)
+	}
 	results, aerr := engine.Query(query)
 	if aerr != nil {
-		log.Println("Error while querying:", aerr)
+		context.Log("Error while querying:", aerr)
 		switch aerr.ErrorCode() {
 		case "search.query.invalid":
 			w.WriteHeader(http.StatusBadRequest)
 			return
+		case "metadata.read_forbidden":
+			writeErrorResponse(w, http.StatusForbidden, aerr)
+			return
 		default:
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 	}
+	if aerr := computeAccountFields(context, results); aerr != nil {
+		context.Log("Error while computing account fields:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-	data, err := json.Marshal(results)
-	if err != nil {
-		log.Println("Error while parsing results:", err)
+	writeData(w, r, context, http.StatusOK, results, nil, searchMeta(r, query, results))
+	return
+}
+
+// GetAccountAction handles the `GET /v1/accounts/{id}` requests
+func GetAccountAction(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	id := r.URL.Path[strings.LastIndex(r.URL.Path, "/v1/accounts/")+len("/v1/accounts/"):]
+	if id == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	GetAccountInfo(w, r, context, id)
+	return
+}
+
+// GetAccountInfo returns the account with its balances,
+// which are as of the point in time of the `as_of` parameter if given
+func GetAccountInfo(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext, id string) {
+	var asOf time.Time
+	if value := r.URL.Query().Get("as_of"); value != "" {
+		var err error
+		asOf, err = parseAsOf(value)
+		if err != nil {
+			context.Log("Invalid as_of:", value)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	accountsDB := models.NewAccountDB(context.DB)
+	isExists, aerr := accountsDB.IsExists(id)
+	if aerr != nil {
+		context.Log("Error while checking for existing account:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !isExists {
+		context.Log("Account doesn't exist:", id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	account, aerr := accountsDB.GetByID(id)
+	if aerr != nil {
+		context.Log("Error while getting account:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !asOf.IsZero() {
+		snapshotDB := models.NewBalanceSnapshotDB(context.DB)
+		account.Balance, account.Balances, aerr = snapshotDB.GetBalances(id, asOf)
+		if aerr != nil {
+			context.Log("Error while getting point-in-time balances:", aerr)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		account.AsOf = asOf.Format(models.LedgerTimestampLayout)
+	}
+	account.Data = context.Metadata.FilterData(account.Data)
+	if aerr := computeAccountFields(context, account); aerr != nil {
+		context.Log("Error while computing account fields:", aerr)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.Write(data)
+	setCacheHeaders(w, context, id)
+	writeData(w, r, context, http.StatusOK, account, accountLinks(r, id), nil)
 	return
 }
 
+// parseAsOf parses a point in time in the ledger timestamp layout, or a date for its start
+func parseAsOf(value string) (time.Time, error) {
+	asOf, err := time.Parse(models.LedgerTimestampLayout, value)
+	if err != nil {
+		return time.Parse("2006-01-02", value)
+	}
+	return asOf, nil
+}
+
 func unmarshalToAccount(r *http.Request, account *models.Account) error {
 	defer r.Body.Close()
 	body, err := ioutil.ReadAll(r.Body)
@@ -78,30 +170,42 @@ func AddAccount(w http.ResponseWriter, r *http.Request, context *ledgerContext.A
 	account := &models.Account{}
 	err := unmarshalToAccount(r, account)
 	if err != nil {
-		log.Println("Error loading payload:", err)
+		context.Log("Error loading payload:", err)
 		w.WriteHeader(http.StatusBadRequest)
 		//TODO Should we return any error message?
 		return
 	}
+	if !checkMetadataWrite(w, context, account.Data) {
+		return
+	}
 
 	accountsDB := models.NewAccountDB(context.DB)
 	// Check if an account with same ID already exists
 	isExists, err := accountsDB.IsExists(account.ID)
 	if err != nil {
-		log.Println("Error while checking for existing account:", err)
+		context.Log("Error while checking for existing account:", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	if isExists {
-		log.Println("Account is conflicting:", account.ID)
+		context.Log("Account is conflicting:", account.ID)
 		w.WriteHeader(http.StatusConflict)
 		return
 	}
 
+	// The account is counted against the quota of the client
+	client := middlewares.ClientKey(r)
+	if qerr, reset := quotas.reserve(client, 1, 0); qerr != nil {
+		context.Log("Account exceeds quota:", account.ID, qerr)
+		writeQuotaError(w, qerr, reset)
+		return
+	}
+
 	// Otherwise, add account
 	aerr := accountsDB.CreateAccount(account)
 	if aerr != nil {
-		log.Printf("Error while adding account: %v (%v)", account.ID, aerr)
+		quotas.release(client, 1, 0)
+		context.Logf("Error while adding account: %v (%v)", account.ID, aerr)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -114,7 +218,7 @@ func UpdateAccount(w http.ResponseWriter, r *http.Request, context *ledgerContex
 	account := &models.Account{}
 	err := unmarshalToAccount(r, account)
 	if err != nil {
-		log.Println("Error loading payload:", err)
+		context.Log("Error loading payload:", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -123,23 +227,218 @@ func UpdateAccount(w http.ResponseWriter, r *http.Request, context *ledgerContex
 	// Check if an account with same ID already exists
 	isExists, err := accountsDB.IsExists(account.ID)
 	if err != nil {
-		log.Println("Error while checking for existing account:", err)
+		context.Log("Error while checking for existing account:", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	if !isExists {
-		log.Println("Account doesn't exist:", account.ID)
+		context.Log("Account doesn't exist:", account.ID)
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
+	if context.Metadata.IsRestricted() {
+		existing, aerr := accountsDB.GetByID(account.ID)
+		if aerr != nil {
+			context.Log("Error while getting account:", aerr)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var ok bool
+		if account.Data, ok = checkMetadataUpdate(w, context, existing.Data, account.Data); !ok {
+			return
+		}
+	}
 
 	// Otherwise, update account
 	aerr := accountsDB.UpdateAccount(account)
 	if aerr != nil {
-		log.Printf("Error while updating account: %v (%v)", account.ID, aerr)
+		context.Logf("Error while updating account: %v (%v)", account.ID, aerr)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	return
 }
+
+const (
+	// AccountImportCreated is the import status of a newly created account
+	AccountImportCreated = "created"
+	// AccountImportUpdated is the import status of an existing account whose data is replaced
+	AccountImportUpdated = "updated"
+	// AccountImportFailed is the import status of a row which couldn't be imported
+	AccountImportFailed = "failed"
+)
+
+// AccountImportResult represents the import status of a single row in the import payload
+type AccountImportResult struct {
+	Row    int    `json:"row"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// accountImportRow holds a parsed account or the reason it couldn't be parsed
+type accountImportRow struct {
+	row     int
+	account *models.Account
+	err     error
+}
+
+func validateAccountImportRow(account *models.Account) error {
+	if account.ID == "" {
+		return errors.New("Missing account id")
+	}
+	var validKey = regexp.MustCompile(`^[a-z_A-Z]+$`)
+	for key := range account.Data {
+		if !validKey.MatchString(key) {
+			return fmt.Errorf("Invalid key in data json: %v", key)
+		}
+	}
+	return nil
+}
+
+// parseAccountsCSV reads accounts from CSV with a header row.
+// The `id` column is mandatory and every other column is stored as a key in account data.
+func parseAccountsCSV(body []byte) ([]*accountImportRow, error) {
+	rdr := csv.NewReader(bytes.NewReader(body))
+	header, err := rdr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CSV header: %v", err)
+	}
+	idColumn := -1
+	for i, column := range header {
+		header[i] = strings.TrimSpace(column)
+		if header[i] == "id" {
+			idColumn = i
+		}
+	}
+	if idColumn == -1 {
+		return nil, errors.New("Missing id column in CSV header")
+	}
+
+	var rows []*accountImportRow
+	for row := 1; ; row++ {
+		record, err := rdr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, err
+			}
+			rows = append(rows, &accountImportRow{row: row, err: err})
+			continue
+		}
+		account := &models.Account{
+			ID:   strings.TrimSpace(record[idColumn]),
+			Data: map[string]interface{}{},
+		}
+		for i, value := range record {
+			if i != idColumn && header[i] != "" {
+				account.Data[header[i]] = value
+			}
+		}
+		rows = append(rows, &accountImportRow{row: row, account: account})
+	}
+	return rows, nil
+}
+
+// parseAccountsJSONL reads accounts from newline delimited JSON, one account per line
+func parseAccountsJSONL(body []byte) ([]*accountImportRow, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), len(body)+1)
+	var rows []*accountImportRow
+	for row := 1; scanner.Scan(); row++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		account := &models.Account{}
+		err := json.Unmarshal(line, account)
+		if err != nil {
+			rows = append(rows, &accountImportRow{row: row, err: err})
+			continue
+		}
+		rows = append(rows, &accountImportRow{row: row, account: account})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ImportAccounts creates or updates the accounts in the CSV or JSONL payload
+// and responds with the import status of each row
+func ImportAccounts(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		context.Log("Error reading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	var rows []*accountImportRow
+	if strings.Contains(r.Header.Get("Content-Type"), "csv") || r.URL.Query().Get("format") == "csv" {
+		rows, err = parseAccountsCSV(body)
+	} else {
+		rows, err = parseAccountsJSONL(body)
+	}
+	if err != nil {
+		context.Log("Error loading import payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	accountsDB := models.NewAccountDB(context.DB)
+	client := middlewares.ClientKey(r)
+	results := make([]*AccountImportResult, 0, len(rows))
+	for _, row := range rows {
+		result := &AccountImportResult{Row: row.row, Status: AccountImportFailed}
+		results = append(results, result)
+		if row.err != nil {
+			result.Error = row.err.Error()
+			continue
+		}
+		result.ID = row.account.ID
+		if err := validateAccountImportRow(row.account); err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		if key := context.Metadata.UnwritableKey(row.account.Data); key != "" {
+			result.Error = models.MetadataKeyForbiddenError("write", key).ErrorMessage()
+			continue
+		}
+		// The account is counted against the quota of the client, unless it is only updated
+		if qerr, _ := quotas.reserve(client, 1, 0); qerr != nil {
+			result.Error = qerr.ErrorMessage()
+			continue
+		}
+		created, aerr := accountsDB.UpsertAccount(row.account)
+		if aerr != nil {
+			quotas.release(client, 1, 0)
+			context.Logf("Error while importing account: %v (%v)", row.account.ID, aerr)
+			result.Error = aerr.ErrorMessage()
+			continue
+		}
+		if !created {
+			quotas.release(client, 1, 0)
+		}
+		if created {
+			result.Status = AccountImportCreated
+		} else {
+			result.Status = AccountImportUpdated
+		}
+	}
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		context.Log("Error while parsing results:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/RealImage/QLedger/models"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	AccountImportAPI = "/v1/accounts/_import"
+)
+
+type AccountsImportSuite struct {
+	suite.Suite
+	context *ledgerContext.AppContext
+}
+
+func (as *AccountsImportSuite) SetupSuite() {
+	t := as.T()
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(t, databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	}
+	log.Println("Successfully established connection to database.")
+	as.context = &ledgerContext.AppContext{DB: db}
+
+	accDB := models.NewAccountDB(db)
+	err = accDB.CreateAccount(&models.Account{ID: "imp_existing"})
+	assert.Equal(t, nil, err, "Error creating test account")
+}
+
+func (as *AccountsImportSuite) TestImportCSV() {
+	t := as.T()
+
+	payload := "id,customer_id,status\n" +
+		"imp_new,C1,active\n" +
+		"imp_existing,C2,inactive\n" +
+		",C3,active\n"
+	handler := middlewares.ContextMiddleware(ImportAccounts, as.context)
+	req, err := http.NewRequest("POST", AccountImportAPI, bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "text/csv")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+
+	var results []AccountImportResult
+	err = json.Unmarshal(rr.Body.Bytes(), &results)
+	if err != nil {
+		t.Errorf("Invalid json response: %v", rr.Body.String())
+	}
+	assert.Equal(t, 3, len(results), "Results count doesn't match")
+	assert.Equal(t, AccountImportCreated, results[0].Status, "Invalid import status")
+	assert.Equal(t, AccountImportUpdated, results[1].Status, "Invalid import status")
+	assert.Equal(t, AccountImportFailed, results[2].Status, "Invalid import status")
+	assert.Equal(t, 3, results[2].Row, "Invalid failed row")
+}
+
+func (as *AccountsImportSuite) TestImportJSONL() {
+	t := as.T()
+
+	payload := `{"id": "imp_jsonl", "data": {"product": "qw"}}
+{"id": "imp_invalid_key", "data": {"invalid-key": "qw"}}
+INVALID LINE`
+	handler := middlewares.ContextMiddleware(ImportAccounts, as.context)
+	req, err := http.NewRequest("POST", AccountImportAPI, bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+
+	var results []AccountImportResult
+	err = json.Unmarshal(rr.Body.Bytes(), &results)
+	if err != nil {
+		t.Errorf("Invalid json response: %v", rr.Body.String())
+	}
+	assert.Equal(t, 3, len(results), "Results count doesn't match")
+	assert.Equal(t, AccountImportCreated, results[0].Status, "Invalid import status")
+	assert.Equal(t, AccountImportFailed, results[1].Status, "Invalid import status")
+	assert.Equal(t, AccountImportFailed, results[2].Status, "Invalid import status")
+}
+
+func (as *AccountsImportSuite) TestImportInvalidCSVHeader() {
+	t := as.T()
+
+	payload := "customer_id,status\nC1,active\n"
+	handler := middlewares.ContextMiddleware(ImportAccounts, as.context)
+	req, err := http.NewRequest("POST", AccountImportAPI+"?format=csv", bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Invalid response code")
+}
+
+func (as *AccountsImportSuite) TearDownSuite() {
+	log.Println("Cleaning up the test database")
+
+	t := as.T()
+	_, err := as.context.DB.Exec(`DELETE FROM accounts`)
+	if err != nil {
+		t.Fatal("Error deleting accounts:", err)
+	}
+}
+
+func TestAccountsImportSuite(t *testing.T) {
+	suite.Run(t, new(AccountsImportSuite))
+}
@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+// MakeAllocation creates a new transaction from the allocation shorthand in the request data
+func MakeAllocation(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		context.Log("Error reading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	allocation := &models.Allocation{}
+	err = json.Unmarshal(body, allocation)
+	if err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := allocation.Validate(); err != nil {
+		context.Log("Allocation is invalid:", allocation.ID, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	transaction := allocation.ToTransaction()
+	if err := transaction.ValidateData(); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	postTransaction(w, r, context, transaction)
+}
@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	AllocationsAPI = "/v1/allocations"
+)
+
+func TestInvalidAllocation(t *testing.T) {
+	payloads := []string{
+		`{INVALID PAYLOAD}`,
+		`{"id": "al001", "from": "revenue", "amount": 100, "to": []}`,
+		`{"id": "al001", "from": "revenue", "amount": 100, "to": [{"account": "revenue", "weight": 1}]}`,
+		`{"id": "al001", "from": "revenue", "amount": 100, "to": [{"account": "alice", "weight": -1}]}`,
+		`{"id": "al001", "from": "revenue", "amount": 100, "to": [{"account": "alice", "weight": 1}], "data": {"invalid-key": 1}}`,
+	}
+	handler := middlewares.ContextMiddleware(MakeAllocation, nil)
+	for _, payload := range payloads {
+		req, err := http.NewRequest("POST", AllocationsAPI, bytes.NewBufferString(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "Invalid response code for payload: %v", payload)
+	}
+}
@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+// RollupBalances snapshots the balances of all accounts as of the start of the current day (UTC),
+// unless they are already rolled up
+func RollupBalances(context *ledgerContext.AppContext) {
+	asOf := time.Now().UTC().Truncate(24 * time.Hour)
+	snapshotDB := models.NewBalanceSnapshotDB(context.DB)
+	done, aerr := snapshotDB.Rollup(asOf)
+	if aerr != nil {
+		context.Log("Error while rolling up balances:", aerr)
+		return
+	}
+	if done {
+		context.Log("Rolled up balances as of:", asOf.Format(models.LedgerTimestampLayout))
+	}
+}
+
+// ScheduleBalanceRollups checks for a due rollup of balances at every interval
+func ScheduleBalanceRollups(context *ledgerContext.AppContext, interval time.Duration) {
+	RollupBalances(context)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		RollupBalances(context)
+	}
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/RealImage/QLedger/models"
+)
+
+const (
+	// bulkTransactionsLimit is the maximum number of transactions of a bulk request
+	bulkTransactionsLimit = 1000
+	// bulkBatchSize is the number of transactions written in a single DB transaction
+	bulkBatchSize = 100
+)
+
+// MakeBulkTransactions creates the array of transactions from the request data,
+// and returns the status of each transaction in the same order
+func MakeBulkTransactions(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	var transactions []*models.Transaction
+	err := json.NewDecoder(r.Body).Decode(&transactions)
+	if err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(transactions) == 0 || len(transactions) > bulkTransactionsLimit {
+		context.Log("Invalid number of bulk transactions:", len(transactions))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Invalid transactions are failed upfront, and the rest are written in batches
+	results := make([]*models.BulkResult, len(transactions))
+	var batch []*models.Transaction
+	var batchIndexes []int
+	var batchAccounts []int
+	client := middlewares.ClientKey(r)
+	quotaAccounts := make(map[string]bool)
+	for i, transaction := range transactions {
+		if transaction == nil {
+			results[i] = &models.BulkResult{Status: models.BulkStatusFailed, Reason: "missing transaction"}
+			continue
+		}
+		reason, err := validateBulkTransaction(context, transaction)
+		if err != nil {
+			context.Log("Error while validating bulk transaction:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if key := context.Metadata.UnwritableKey(transaction.Data); key != "" && reason == "" {
+			reason = models.MetadataKeyForbiddenError("write", key).ErrorMessage()
+		}
+		if reason != "" {
+			results[i] = &models.BulkResult{ID: transaction.ID, Status: models.BulkStatusFailed, Reason: reason}
+			continue
+		}
+		// The accounts of the earlier transactions of the request are counted against the quota only once
+		var accountIDs []string
+		for _, id := range transaction.AccountIDs() {
+			if !quotaAccounts[id] {
+				accountIDs = append(accountIDs, id)
+			}
+		}
+		newAccounts, qerr, _, aerr := reserveTransactionQuota(context, client, accountIDs)
+		if aerr != nil {
+			context.Log("Error while checking quotas:", aerr)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if qerr != nil {
+			results[i] = &models.BulkResult{ID: transaction.ID, Status: models.BulkStatusFailed, Reason: qerr.ErrorMessage()}
+			continue
+		}
+		for _, id := range accountIDs {
+			quotaAccounts[id] = true
+		}
+		batch = append(batch, transaction)
+		batchIndexes = append(batchIndexes, i)
+		batchAccounts = append(batchAccounts, newAccounts)
+	}
+
+	transactionsDB := models.NewTransactionDB(context.DB)
+	for start := 0; start < len(batch); start += bulkBatchSize {
+		end := start + bulkBatchSize
+		if end > len(batch) {
+			end = len(batch)
+		}
+		batchResults, aerr := transactionsDB.TransactBatch(batch[start:end])
+		for j := start; j < end; j++ {
+			i := batchIndexes[j]
+			if aerr != nil {
+				quotas.release(client, batchAccounts[j], 1)
+				results[i] = &models.BulkResult{ID: batch[j].ID, Status: models.BulkStatusFailed, Reason: "batch transaction failed"}
+				continue
+			}
+			result := batchResults[j-start]
+			results[i] = result
+			if result.Status != models.BulkStatusCreated {
+				quotas.release(client, batchAccounts[j], 1)
+			}
+			if result.Status == models.BulkStatusCreated {
+				notifyWebhooks(context, WebhookEventTransactionCreated, batch[j])
+			}
+			if result.Replay != nil {
+				duplicates.track(client, result.ID, result.Replay)
+			}
+		}
+		if aerr != nil {
+			context.Log("Error while writing bulk transactions:", aerr)
+		}
+	}
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		context.Log("Error while parsing bulk results:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// validateBulkTransaction returns the reason why a transaction of a bulk request
+// is invalid, or an empty reason if it is valid
+func validateBulkTransaction(context *ledgerContext.AppContext, transaction *models.Transaction) (string, error) {
+	if transaction.ID == "" {
+		return "missing transaction ID", nil
+	}
+	if err := transaction.ValidateData(); err != nil {
+		return err.Error(), nil
+	}
+	if aerr := resolveAccountRefs(context, transaction); aerr != nil {
+		if aerr.ErrorCode() == "db.error" {
+			return "", aerr
+		}
+		return aerr.ErrorMessage(), nil
+	}
+	if !transaction.IsValid() {
+		return "transaction lines don't balance", nil
+	}
+	if transaction.PostAt != "" {
+		return "scheduled transactions can't be posted in bulk", nil
+	}
+	if transaction.Signature != nil {
+		valid, err := verifyTransactionSignature(context, transaction)
+		if err != nil {
+			return "", err
+		}
+		if !valid {
+			return "invalid signature", nil
+		}
+	}
+	if aerr := checkPostingHooks(context, transaction); aerr != nil {
+		switch aerr.ErrorCode() {
+		case "posting_hook.rejected", "posting_hook.unavailable":
+			return aerr.ErrorMessage(), nil
+		}
+		return "", aerr
+	}
+	return "", nil
+}
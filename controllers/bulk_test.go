@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMakeBulkTransactionsInvalid(t *testing.T) {
+	payload := `[
+	  {"id": "", "lines": [{"account": "alice", "delta": 100}, {"account": "bob", "delta": -100}]},
+	  {"id": "t001", "lines": [{"account": "alice", "delta": 100}, {"account": "bob", "delta": -50}]},
+	  {"id": "t002", "data": {"invalid-key": 1}, "lines": [{"account": "alice", "delta": 100}, {"account": "bob", "delta": -100}]},
+	  null
+	]`
+	req, err := http.NewRequest("POST", "/v1/transactions/_bulk", bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	middlewares.ContextMiddleware(PostTransactionAction, &ledgerContext.AppContext{}).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+
+	var results []models.BulkResult
+	err = json.Unmarshal(rr.Body.Bytes(), &results)
+	assert.Equal(t, nil, err, "Invalid response body")
+	assert.Equal(t, 4, len(results), "Results count doesn't match")
+	for _, result := range results {
+		assert.Equal(t, models.BulkStatusFailed, result.Status, "Invalid transaction should fail")
+		assert.NotEqual(t, "", result.Reason, "Failed transaction should have a reason")
+	}
+	assert.Equal(t, "t001", results[1].ID, "Results should be in the order of transactions")
+	assert.Equal(t, "transaction lines don't balance", results[1].Reason, "Invalid failure reason")
+}
+
+func TestMakeBulkTransactionsBadRequest(t *testing.T) {
+	for _, payload := range []string{`{"id": "t001"}`, `[]`} {
+		req, err := http.NewRequest("POST", "/v1/transactions/_bulk", bytes.NewBufferString(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		middlewares.ContextMiddleware(PostTransactionAction, &ledgerContext.AppContext{}).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "Invalid response code for payload: "+payload)
+	}
+}
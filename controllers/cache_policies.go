@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/RealImage/QLedger/models"
+)
+
+// setCacheHeaders sets the cache headers of the account response as per the cache policy matching the account.
+// The response is left without them if no policy matches, or the policy can't be loaded.
+func setCacheHeaders(w http.ResponseWriter, context *ledgerContext.AppContext, id string) {
+	policyDB := models.NewCachePolicyDB(context.DB)
+	policy, aerr := policyDB.Match(id)
+	if aerr != nil {
+		context.Log("Error while matching cache policy:", aerr)
+		return
+	}
+	if policy == nil {
+		return
+	}
+	w.Header().Set("Cache-Control", policy.CacheControl())
+	// The caches shouldn't serve the response to the requests of other tokens and tenants,
+	// or to the requests of the other response format
+	w.Header().Set("Vary", strings.Join([]string{"Authorization", middlewares.TenantHeader, EnvelopeHeader}, ", "))
+}
+
+// GetCachePolicies returns all the cache policies of the accounts
+func GetCachePolicies(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	policyDB := models.NewCachePolicyDB(context.DB)
+	policies, aerr := policyDB.List()
+	if aerr != nil {
+		context.Log("Error while listing cache policies:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(policies)
+	if err != nil {
+		context.Log("Error while parsing cache policies:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// AddCachePolicy creates a cache policy with the `id`, `prefix`, `max_age_seconds` and `shared` from the request data.
+// It applies to the accounts whose IDs start with the prefix, unless a policy with a longer prefix matches them.
+func AddCachePolicy(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	policy := &models.CachePolicy{}
+	if err := json.NewDecoder(r.Body).Decode(policy); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := policy.Validate(); err != nil {
+		context.Log("Invalid cache policy:", policy.ID, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	policyDB := models.NewCachePolicyDB(context.DB)
+	if aerr := policyDB.Create(policy); aerr != nil {
+		context.Log("Error while creating cache policy:", aerr)
+		switch aerr.ErrorCode() {
+		case "cache_policy.exists":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	return
+}
+
+// DeleteCachePolicy removes the cache policy with the `id` query parameter
+func DeleteCachePolicy(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	id := r.URL.Query().Get("id")
+	policyDB := models.NewCachePolicyDB(context.DB)
+	deleted, aerr := policyDB.Delete(id)
+	if aerr != nil {
+		context.Log("Error while deleting cache policy:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		context.Log("Cache policy doesn't exist:", id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	return
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+// BackfillRequest represents the options of categorizing the existing transactions
+type BackfillRequest struct {
+	All bool `json:"all"`
+}
+
+// GetCategorizationRules returns all the categorization rules in the order they are matched
+func GetCategorizationRules(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	ruleDB := models.NewCategorizationRuleDB(context.DB)
+	rules, aerr := ruleDB.List()
+	if aerr != nil {
+		context.Log("Error while listing categorization rules:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(rules)
+	if err != nil {
+		context.Log("Error while parsing categorization rules:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// AddCategorizationRule creates a categorization rule with the `id`, `category`, `priority`,
+// `data` and `accounts` from the request data. It applies to the transactions posted from then on.
+func AddCategorizationRule(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	rule := &models.CategorizationRule{}
+	if err := json.NewDecoder(r.Body).Decode(rule); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := rule.Validate(); err != nil {
+		context.Log("Invalid categorization rule:", rule.ID, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ruleDB := models.NewCategorizationRuleDB(context.DB)
+	if aerr := ruleDB.Create(rule); aerr != nil {
+		context.Log("Error while creating categorization rule:", aerr)
+		switch aerr.ErrorCode() {
+		case "categorization_rule.exists":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	return
+}
+
+// DeleteCategorizationRule removes the categorization rule with the `id` query parameter
+func DeleteCategorizationRule(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	id := r.URL.Query().Get("id")
+	ruleDB := models.NewCategorizationRuleDB(context.DB)
+	deleted, aerr := ruleDB.Delete(id)
+	if aerr != nil {
+		context.Log("Error while deleting categorization rule:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		context.Log("Categorization rule doesn't exist:", id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	return
+}
+
+// BackfillCategories applies the categorization rules to the uncategorized transactions,
+// or to all the transactions with `all` in the request data
+func BackfillCategories(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	request := &BackfillRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ruleDB := models.NewCategorizationRuleDB(context.DB)
+	result, aerr := ruleDB.Backfill(request.All)
+	if aerr != nil {
+		context.Log("Error while backfilling categories:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	context.Log("Categorized transactions:", result.Categorized, "of", result.Transactions)
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		context.Log("Error while parsing backfill result:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// GetCategoryReport returns the debits and credits of the lines by category and currency,
+// filtered by the `account`, `from` and `to` query parameters
+func GetCategoryReport(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	params := r.URL.Query()
+	filter := &models.CategoryReportFilter{AccountID: params.Get("account")}
+	if value := params.Get("from"); value != "" {
+		from, err := parseAsOf(value)
+		if err != nil {
+			context.Log("Invalid from in category report query:", value)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		filter.From = &from
+	}
+	if value := params.Get("to"); value != "" {
+		to, err := parseAsOf(value)
+		if err != nil {
+			context.Log("Invalid to in category report query:", value)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		filter.To = &to
+	}
+
+	reportDB := models.NewReportDB(context.DB)
+	report, aerr := reportDB.GetCategoryReport(filter)
+	if aerr != nil {
+		context.Log("Error while getting category report:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		context.Log("Error while parsing category report:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+	"github.com/RealImage/QLedger/tenants"
+)
+
+// CloneRequest represents the tenant to clone the ledger into, along with the options of the clone
+type CloneRequest struct {
+	Target            string   `json:"target"`
+	Since             string   `json:"since"`
+	IDPrefix          string   `json:"id_prefix"`
+	HashIDs           bool     `json:"hash_ids"`
+	Redact            []string `json:"redact"`
+	ReportDefinitions bool     `json:"report_definitions"`
+}
+
+// CloneLedger clones the ledger of the tenant of the request into the empty ledger of the target tenant,
+// as of the pinned read snapshot of the request if any
+func CloneLedger(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	request := &CloneRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	options := &models.CloneOptions{
+		IDPrefix:          request.IDPrefix,
+		HashIDs:           request.HashIDs,
+		RedactKeys:        request.Redact,
+		ReportDefinitions: request.ReportDefinitions,
+	}
+	if request.Since != "" {
+		since, err := parseAsOf(request.Since)
+		if err != nil {
+			context.Log("Invalid since in clone request:", request.Since)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		options.Since = &since
+	}
+
+	// The ledgers are cloned between tenants, which exist only when they are isolated
+	if context.Tenant == nil {
+		context.Log("Ledger can't be cloned without tenant isolation")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	target, err := context.Tenant(request.Target)
+	if err != nil {
+		context.Log("Error while opening clone target:", request.Target, err)
+		switch err {
+		case tenants.ErrInvalidTenant:
+			w.WriteHeader(http.StatusBadRequest)
+		case tenants.ErrUnknownTenant:
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		return
+	}
+	if target.DB == context.DB {
+		context.Log("Ledger can't be cloned into itself:", request.Target)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	tx, aerr := beginRead(r, context)
+	if aerr != nil {
+		writeReadError(w, aerr)
+		return
+	}
+	defer tx.Rollback()
+
+	result, aerr := models.Clone(tx, target.DB, options)
+	if aerr != nil {
+		context.Log("Error while cloning ledger:", aerr)
+		switch aerr.ErrorCode() {
+		case "clone.target_not_empty":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	context.Log("Cloned ledger into tenant:", request.Target)
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		context.Log("Error while parsing clone result:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(data)
+	return
+}
@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/tenants"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloneLedgerInvalid(t *testing.T) {
+	source := &ledgerContext.AppContext{}
+	source.Tenant = func(tenant string) (*ledgerContext.AppContext, error) {
+		if tenant == "self" {
+			return source, nil
+		}
+		return nil, tenants.ErrInvalidTenant
+	}
+
+	for _, c := range []struct {
+		context *ledgerContext.AppContext
+		payload string
+	}{
+		{source, `not json`},
+		{source, `{"target": "staging", "since": "last year"}`},
+		{&ledgerContext.AppContext{}, `{"target": "staging"}`},
+		{source, `{"target": "Staging!"}`},
+		{source, `{"target": "self"}`},
+	} {
+		req, _ := http.NewRequest("POST", "/v1/admin/clone", bytes.NewBufferString(c.payload))
+		rr := httptest.NewRecorder()
+		CloneLedger(rr, req, c.context)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "Clone should be invalid: "+c.payload)
+	}
+}
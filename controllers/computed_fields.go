@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/RealImage/QLedger/models"
+)
+
+// computeAccountFields sets the computed fields of the ledger on the accounts, which are
+// either an account or the account search results
+func computeAccountFields(context *ledgerContext.AppContext, accounts interface{}) ledgerError.ApplicationError {
+	computedFieldDB := models.NewComputedFieldDB(context.DB)
+	fields, aerr := computedFieldDB.List()
+	if aerr != nil || len(fields) == 0 {
+		return aerr
+	}
+
+	var ids []string
+	var set func(values map[string]map[string]interface{})
+	switch accounts := accounts.(type) {
+	case *models.Account:
+		ids = []string{accounts.ID}
+		set = func(values map[string]map[string]interface{}) {
+			accounts.Computed = values[accounts.ID]
+		}
+	case *models.SearchPage:
+		return computeAccountFields(context, accounts.Items)
+	case []*models.AccountResult:
+		for _, account := range accounts {
+			ids = append(ids, account.ID)
+		}
+		set = func(values map[string]map[string]interface{}) {
+			for _, account := range accounts {
+				account.Computed = values[account.ID]
+			}
+		}
+	default:
+		return nil
+	}
+
+	values, aerr := computedFieldDB.Compute(fields, ids)
+	if aerr != nil {
+		return aerr
+	}
+	set(values)
+	return nil
+}
+
+// GetComputedFields returns all the computed fields of the accounts
+func GetComputedFields(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	computedFieldDB := models.NewComputedFieldDB(context.DB)
+	fields, aerr := computedFieldDB.List()
+	if aerr != nil {
+		context.Log("Error while listing computed fields:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		context.Log("Error while parsing computed fields:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// AddComputedField creates a computed field with the `name`, `function` and `currency` from the request data
+func AddComputedField(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	field := &models.ComputedField{}
+	if err := json.NewDecoder(r.Body).Decode(field); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := field.Validate(); err != nil {
+		context.Log("Invalid computed field:", field.Name, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	computedFieldDB := models.NewComputedFieldDB(context.DB)
+	if aerr := computedFieldDB.Create(field); aerr != nil {
+		context.Log("Error while creating computed field:", aerr)
+		switch aerr.ErrorCode() {
+		case "computed_field.exists":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	return
+}
+
+// DeleteComputedField removes the computed field with the `name` query parameter
+func DeleteComputedField(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	name := r.URL.Query().Get("name")
+	computedFieldDB := models.NewComputedFieldDB(context.DB)
+	deleted, aerr := computedFieldDB.Delete(name)
+	if aerr != nil {
+		context.Log("Error while deleting computed field:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		context.Log("Computed field doesn't exist:", name)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	return
+}
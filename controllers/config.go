@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/RealImage/QLedger/config"
+	ledgerContext "github.com/RealImage/QLedger/context"
+)
+
+// ReloadConfig re-reads the config file and applies the changed settings which don't require restart
+func ReloadConfig(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	changed, err := config.Reload()
+	if err != nil {
+		context.Log("Error reloading config:", err)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	if changed == nil {
+		changed = []string{}
+	}
+
+	data, err := json.Marshal(map[string][]string{"changed": changed})
+	if err != nil {
+		context.Log("Error while parsing reloaded settings:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/RealImage/QLedger/consumer"
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/metrics"
+	"github.com/RealImage/QLedger/models"
+)
+
+// Statuses of the consumed messages
+const (
+	// ConsumedPosted is a message whose transaction is posted or was already posted
+	ConsumedPosted = "posted"
+	// ConsumedRejected is a message which can't be posted, such as an invalid or conflicting transaction
+	ConsumedRejected = "rejected"
+	// ConsumedRetried is a message which is left on the queue to be delivered again, such as on DB errors
+	ConsumedRetried = "retried"
+)
+
+// consumerRetryDelay is the delay before receiving messages again after the queue fails
+const consumerRetryDelay = 5 * time.Second
+
+var consumedMessages = metrics.NewCounterVec("qledger_consumed_messages_total",
+	"Messages consumed from the queue by status.", "status")
+
+// consumeMessage posts the transaction of a message, and returns the status of the message.
+// The transactions are posted idempotently by their IDs, so redelivered messages are just acknowledged.
+func consumeMessage(context *ledgerContext.AppContext, message *consumer.Message) string {
+	transaction := &models.Transaction{}
+	if err := json.Unmarshal(message.Body, transaction); err != nil {
+		context.Log("Error loading message:", message.ID, err)
+		return ConsumedRejected
+	}
+	if err := transaction.ValidateData(); err != nil {
+		context.Log("Invalid transaction of message:", message.ID, err)
+		return ConsumedRejected
+	}
+	if !transaction.IsValid() {
+		context.Log("Transaction of message is invalid:", message.ID, transaction.ID)
+		return ConsumedRejected
+	}
+	if transaction.Signature != nil {
+		valid, err := verifyTransactionSignature(context, transaction)
+		if err != nil {
+			context.Log("Error while verifying transaction signature:", message.ID, err)
+			return ConsumedRetried
+		}
+		if !valid {
+			return ConsumedRejected
+		}
+	}
+
+	aerr := postBackgroundTransaction(context, transaction)
+	switch {
+	case aerr == nil:
+		return ConsumedPosted
+	case aerr.ErrorCode() == "db.error" || aerr.ErrorCode() == "posting_hook.unavailable":
+		context.Log("Error while posting transaction of message, will retry:", message.ID, transaction.ID, aerr)
+		return ConsumedRetried
+	default:
+		context.Log("Transaction of message failed:", message.ID, transaction.ID, aerr)
+		return ConsumedRejected
+	}
+}
+
+// ConsumeTransactions posts the transactions of the messages received from the source. The posted messages
+// are acknowledged, and the others are left to be delivered again. The rejected messages are moved to
+// a dead-letter queue by the redrive policy of the queue once they are delivered too many times.
+func ConsumeTransactions(context *ledgerContext.AppContext, source consumer.Source) {
+	for {
+		if IsReadOnly() {
+			time.Sleep(consumerRetryDelay)
+			continue
+		}
+		messages, err := source.Receive()
+		if err != nil {
+			context.Log("Error while receiving messages:", err)
+			time.Sleep(consumerRetryDelay)
+			continue
+		}
+		consumeMessages(context, source, messages)
+	}
+}
+
+// consumeMessages consumes the received messages, and acknowledges the posted messages
+func consumeMessages(context *ledgerContext.AppContext, source consumer.Source, messages []*consumer.Message) {
+	for _, message := range messages {
+		status := consumeMessage(context, message)
+		consumedMessages.Inc(status)
+		if status != ConsumedPosted {
+			continue
+		}
+		if err := source.Ack(message); err != nil {
+			context.Log("Error while acknowledging message:", message.ID, err)
+		}
+	}
+}
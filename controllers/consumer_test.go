@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/RealImage/QLedger/consumer"
+	ledgerContext "github.com/RealImage/QLedger/context"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestConsumeInvalidMessages(t *testing.T) {
+	for _, body := range []string{
+		`not json`,
+		`{"id": "t001", "data": {"bad-key": 1}, "lines": [{"account": "alice", "delta": -100}, {"account": "bob", "delta": 100}]}`,
+		`{"id": "t001", "timestamp": "today", "lines": [{"account": "alice", "delta": -100}, {"account": "bob", "delta": 100}]}`,
+		`{"id": "t001", "lines": [{"account": "alice", "delta": -100}, {"account": "bob", "delta": 99}]}`,
+	} {
+		status := consumeMessage(nil, &consumer.Message{ID: "m1", Body: []byte(body)})
+		assert.Equal(t, ConsumedRejected, status, "Invalid status of message: %v", body)
+	}
+}
+
+type ackSource struct {
+	acked []string
+}
+
+func (s *ackSource) Receive() ([]*consumer.Message, error) {
+	return nil, nil
+}
+
+func (s *ackSource) Ack(message *consumer.Message) error {
+	s.acked = append(s.acked, message.ID)
+	return nil
+}
+
+func TestConsumeRejectedMessagesUnacked(t *testing.T) {
+	source := &ackSource{}
+	consumeMessages(nil, source, []*consumer.Message{{ID: "m1", Body: []byte(`not json`)}})
+	assert.Empty(t, source.acked, "Rejected message should be left on the queue")
+}
+
+type ConsumerSuite struct {
+	suite.Suite
+	context *ledgerContext.AppContext
+}
+
+func (cs *ConsumerSuite) SetupSuite() {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(cs.T(), databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	}
+	log.Println("Successfully established connection to database.")
+	cs.context = &ledgerContext.AppContext{DB: db}
+}
+
+func (cs *ConsumerSuite) TestConsumeMessage() {
+	t := cs.T()
+	message := &consumer.Message{ID: "m1", Body: []byte(`{
+		"id": "consumed1",
+		"lines": [{"account": "consumed_alice", "delta": -100}, {"account": "consumed_bob", "delta": 100}]
+	}`)}
+	assert.Equal(t, ConsumedPosted, consumeMessage(cs.context, message), "Message should be posted")
+	// A redelivered message is posted just once
+	assert.Equal(t, ConsumedPosted, consumeMessage(cs.context, message), "Redelivered message should be posted")
+	var count int
+	err := cs.context.DB.QueryRow("SELECT COUNT(*) FROM lines WHERE transaction_id = 'consumed1'").Scan(&count)
+	assert.Nil(t, err, "Error while counting lines")
+	assert.Equal(t, 2, count, "Redelivered message should not post the lines again")
+
+	conflicting := &consumer.Message{ID: "m2", Body: []byte(`{
+		"id": "consumed1",
+		"lines": [{"account": "consumed_alice", "delta": -200}, {"account": "consumed_bob", "delta": 200}]
+	}`)}
+	assert.Equal(t, ConsumedRejected, consumeMessage(cs.context, conflicting), "Conflicting message should be rejected")
+}
+
+func (cs *ConsumerSuite) TearDownSuite() {
+	t := cs.T()
+	for _, q := range []string{
+		"DELETE FROM lines WHERE transaction_id LIKE 'consumed%'",
+		"DELETE FROM transactions WHERE id LIKE 'consumed%'",
+		"DELETE FROM accounts WHERE id LIKE 'consumed%'",
+	} {
+		if _, err := cs.context.DB.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConsumerSuite(t *testing.T) {
+	suite.Run(t, new(ConsumerSuite))
+}
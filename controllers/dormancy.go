@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/metrics"
+	"github.com/RealImage/QLedger/models"
+)
+
+// Events of the account lifecycle
+const (
+	// WebhookEventAccountDormant is sent when an account is marked dormant
+	WebhookEventAccountDormant = "account.dormant"
+	// WebhookEventAccountReactivated is sent when a dormant account has a transaction again
+	WebhookEventAccountReactivated = "account.reactivated"
+)
+
+var (
+	// DormancyPeriod is the period without transactions after which an account is dormant,
+	// and the accounts are never dormant if it is zero
+	DormancyPeriod time.Duration
+	// DormancyCheckInterval is the interval of checking the dormancy of the accounts
+	DormancyCheckInterval = time.Hour
+)
+
+var dormancyChanges = metrics.NewCounterVec("qledger_account_dormancy_changes_total",
+	"Accounts marked dormant or reactivated by the dormancy checks.", "event")
+
+// checkDormancy reactivates the dormant accounts with recent transactions, and marks the accounts without them
+// as dormant, notifying the webhooks of every change
+func checkDormancy(context *ledgerContext.AppContext, now time.Time) error {
+	dormancyDB := models.NewDormancyDB(context.DB)
+	cutoff := now.Add(-DormancyPeriod)
+	reactivated, aerr := dormancyDB.Reactivate(cutoff)
+	if aerr != nil {
+		return aerr
+	}
+	for _, account := range reactivated {
+		dormancyChanges.Inc(WebhookEventAccountReactivated)
+		notifyWebhooks(context, WebhookEventAccountReactivated, account)
+	}
+	dormant, aerr := dormancyDB.MarkDormant(cutoff, now)
+	if aerr != nil {
+		return aerr
+	}
+	for _, account := range dormant {
+		dormancyChanges.Inc(WebhookEventAccountDormant)
+		notifyWebhooks(context, WebhookEventAccountDormant, account)
+	}
+	if len(reactivated) > 0 || len(dormant) > 0 {
+		context.Log("Accounts marked dormant:", len(dormant), "reactivated:", len(reactivated))
+	}
+	return nil
+}
+
+// ScheduleDormancyChecks checks the dormancy of the accounts at every interval
+func ScheduleDormancyChecks(context *ledgerContext.AppContext, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		// The accounts of a read-only region are checked by the primary
+		if IsReadOnly() {
+			continue
+		}
+		if err := checkDormancy(context, time.Now().UTC()); err != nil {
+			context.Log("Error while checking dormancy of accounts:", err)
+		}
+	}
+}
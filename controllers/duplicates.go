@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/metrics"
+	"github.com/RealImage/QLedger/models"
+)
+
+var (
+	transactionReplays = metrics.NewCounterVec(
+		"qledger_transaction_replays_total",
+		"Number of transactions submitted with an existing transaction ID.",
+		"client", "kind",
+	)
+	transactionReplayAges = metrics.NewHistogramVec(
+		"qledger_transaction_replay_age_seconds",
+		"Time since the existing transaction was created when its ID is submitted again.",
+		[]float64{1, 10, 60, 600, 3600, 21600, 86400, 604800, 2592000},
+		"kind",
+	)
+)
+
+// DuplicateStats represents the repeated transaction submissions of a client, which is the credential
+// of the requests, such as `key:9f86d081884c7d65` for an API key
+type DuplicateStats struct {
+	Client            string `json:"client"`
+	Duplicates        int64  `json:"duplicates"`
+	Conflicts         int64  `json:"conflicts"`
+	Mismatches        int64  `json:"mismatches"`
+	Expired           int64  `json:"expired"`
+	LastTransactionID string `json:"last_transaction_id"`
+	LastSeen          string `json:"last_seen"`
+}
+
+// duplicateTracker counts the repeated transaction submissions per client
+// since the start of the server
+type duplicateTracker struct {
+	mu      sync.Mutex
+	clients map[string]*DuplicateStats
+}
+
+var duplicates = &duplicateTracker{clients: make(map[string]*DuplicateStats)}
+
+func (d *duplicateTracker) track(client string, transactionID string, replay *models.TransactionReplay) {
+	transactionReplays.Inc(client, replay.Kind)
+	transactionReplayAges.Observe(replay.Age.Seconds(), replay.Kind)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats, ok := d.clients[client]
+	if !ok {
+		stats = &DuplicateStats{Client: client}
+		d.clients[client] = stats
+	}
+	switch replay.Kind {
+	case models.ReplayConflict:
+		stats.Conflicts++
+	case models.ReplayMismatch:
+		stats.Mismatches++
+	case models.ReplayExpired:
+		stats.Expired++
+	default:
+		stats.Duplicates++
+	}
+	stats.LastTransactionID = transactionID
+	stats.LastSeen = time.Now().UTC().Format(models.LedgerTimestampLayout)
+}
+
+// total returns the count of all the repeated submissions
+func (s *DuplicateStats) total() int64 {
+	return s.Duplicates + s.Conflicts + s.Mismatches + s.Expired
+}
+
+// list returns the stats of all clients ordered by the most repeated submissions first
+func (d *duplicateTracker) list() []DuplicateStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := make([]DuplicateStats, 0, len(d.clients))
+	for _, stats := range d.clients {
+		list = append(list, *stats)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		ti, tj := list[i].total(), list[j].total()
+		if ti == tj {
+			return list[i].Client < list[j].Client
+		}
+		return ti > tj
+	})
+	return list
+}
+
+// GetDuplicates returns the repeated transaction submissions of all clients
+func GetDuplicates(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	data, err := json.Marshal(duplicates.list())
+	if err != nil {
+		context.Log("Error while parsing duplicates:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuplicateTracker(t *testing.T) {
+	tracker := &duplicateTracker{clients: make(map[string]*DuplicateStats)}
+	tracker.track("billing", "t001", &models.TransactionReplay{Kind: models.ReplayDuplicate})
+	tracker.track("billing", "t002", &models.TransactionReplay{Kind: models.ReplayConflict})
+	tracker.track("invoicing", "t003", &models.TransactionReplay{Kind: models.ReplayDuplicate})
+	tracker.track("billing", "t001", &models.TransactionReplay{Kind: models.ReplayDuplicate, Age: time.Minute})
+	tracker.track("invoicing", "t004", &models.TransactionReplay{Kind: models.ReplayMismatch})
+	tracker.track("invoicing", "t005", &models.TransactionReplay{Kind: models.ReplayExpired, Age: 48 * time.Hour})
+	tracker.track("invoicing", "t006", &models.TransactionReplay{Kind: models.ReplayExpired, Age: 72 * time.Hour})
+
+	list := tracker.list()
+	assert.Equal(t, 2, len(list), "Clients count doesn't match")
+	assert.Equal(t, "invoicing", list[0].Client, "Clients should be ordered by repeated submissions")
+	assert.Equal(t, int64(1), list[0].Mismatches, "Invalid mismatches count")
+	assert.Equal(t, int64(2), list[0].Expired, "Invalid expired count")
+	assert.Equal(t, "billing", list[1].Client, "Invalid client")
+	assert.Equal(t, int64(2), list[1].Duplicates, "Invalid duplicates count")
+	assert.Equal(t, int64(1), list[1].Conflicts, "Invalid conflicts count")
+	assert.Equal(t, "t001", list[1].LastTransactionID, "Invalid last transaction ID")
+	assert.Equal(t, float64(2), transactionReplays.Value("billing", "duplicate"), "Invalid replays metric")
+	assert.Equal(t, float64(2), transactionReplays.Value("invoicing", "expired"), "Invalid replays metric")
+}
+
+func TestGetDuplicates(t *testing.T) {
+	duplicates.track("reporting", "t001", &models.TransactionReplay{Kind: models.ReplayDuplicate})
+
+	req, err := http.NewRequest("GET", "/v1/admin/duplicates", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	middlewares.ContextMiddleware(GetDuplicates, nil).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+
+	var list []DuplicateStats
+	err = json.Unmarshal(rr.Body.Bytes(), &list)
+	if err != nil {
+		t.Errorf("Invalid json response: %v", rr.Body.String())
+	}
+	var stats *DuplicateStats
+	for i := range list {
+		if list[i].Client == "reporting" {
+			stats = &list[i]
+		}
+	}
+	if assert.NotNil(t, stats, "Client stats not found") {
+		assert.Equal(t, int64(1), stats.Duplicates, "Invalid duplicates count")
+		assert.Equal(t, "t001", stats.LastTransactionID, "Invalid last transaction ID")
+	}
+}
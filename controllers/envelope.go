@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+// EnvelopeHeader is the request header which opts the request in or out of the response envelope
+const EnvelopeHeader = "X-Response-Envelope"
+
+// ResponseEnvelope says whether the responses are wrapped in the envelope,
+// unless the request says otherwise by the envelope header
+var ResponseEnvelope bool
+
+// Links are the paths of the resources related to a response, such as `self`.
+// A link is a path, or a list of paths when there are several related resources.
+type Links map[string]interface{}
+
+// PaginationMeta represents the page of the search results in a response
+type PaginationMeta struct {
+	From       int    `json:"from,omitempty"`
+	Size       int    `json:"size,omitempty"`
+	Limit      int    `json:"limit,omitempty"`
+	Count      int    `json:"count"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Truncated  bool   `json:"truncated,omitempty"`
+}
+
+// EnvelopeMeta represents the pagination and the read snapshot of a response
+type EnvelopeMeta struct {
+	Pagination *PaginationMeta `json:"pagination,omitempty"`
+	Snapshot   string          `json:"snapshot,omitempty"`
+}
+
+// Envelope wraps the data of a response along with its links and meta
+type Envelope struct {
+	Data  interface{}   `json:"data"`
+	Links Links         `json:"links,omitempty"`
+	Meta  *EnvelopeMeta `json:"meta,omitempty"`
+}
+
+// useEnvelope says whether the response of the request is wrapped in the envelope
+func useEnvelope(r *http.Request) bool {
+	if value := r.Header.Get(EnvelopeHeader); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err == nil {
+			return enabled
+		}
+	}
+	return ResponseEnvelope
+}
+
+// linkPrefix returns the host prefix of the request, which the links start with
+func linkPrefix(r *http.Request) string {
+	if i := strings.Index(r.URL.Path, "/v1/"); i > 0 {
+		return r.URL.Path[:i]
+	}
+	return ""
+}
+
+// accountLinks returns the links of an account
+func accountLinks(r *http.Request, id string) Links {
+	prefix := linkPrefix(r)
+	return Links{
+		"self":  prefix + "/v1/accounts/" + url.PathEscape(id),
+		"lines": prefix + "/v1/lines?account=" + url.QueryEscape(id),
+	}
+}
+
+// transactionLinks returns the links of a transaction along with its accounts, the transaction
+// it reverses if any, and its reversal if it is reversed. The reversed transaction is the one
+// recorded by the ledger, not the `reverses` key of the data. There's no `group` link, as the
+// transactions aren't grouped.
+func transactionLinks(r *http.Request, transaction *models.Transaction, reversed bool) Links {
+	prefix := linkPrefix(r)
+	links := Links{"self": prefix + "/v1/transactions/" + url.PathEscape(transaction.ID)}
+	var accounts []string
+	seen := make(map[string]bool)
+	for _, line := range transaction.Lines {
+		if !seen[line.AccountID] {
+			seen[line.AccountID] = true
+			accounts = append(accounts, prefix+"/v1/accounts/"+url.PathEscape(line.AccountID))
+		}
+	}
+	if len(accounts) > 0 {
+		links["accounts"] = accounts
+	}
+	if transaction.Reverses != "" {
+		links["reverses"] = prefix + "/v1/transactions/" + url.PathEscape(transaction.Reverses)
+	}
+	if reversed {
+		links["reversal"] = prefix + "/v1/transactions/" + url.PathEscape(models.ReversalID(transaction.ID))
+	}
+	return links
+}
+
+// searchMeta returns the meta of the search results of the query,
+// along with the read snapshot the search queried if any
+func searchMeta(r *http.Request, query string, results interface{}) *EnvelopeMeta {
+	meta := &EnvelopeMeta{Snapshot: r.Header.Get(ReadSnapshotHeader)}
+	rawQuery, aerr := models.NewSearchRawQuery(query)
+	if aerr != nil {
+		return meta
+	}
+	pagination := &PaginationMeta{From: rawQuery.Offset, Size: rawQuery.Limit, Limit: rawQuery.PageSize}
+	items := results
+	if page, ok := results.(*models.SearchPage); ok {
+		items = page.Items
+		pagination.NextCursor = page.NextCursor
+		pagination.Truncated = page.Truncated
+	}
+	if value := reflect.ValueOf(items); value.Kind() == reflect.Slice {
+		pagination.Count = value.Len()
+	}
+	meta.Pagination = pagination
+	return meta
+}
+
+// writeData writes the data as the JSON response, wrapped in the envelope with the links and meta
+// when the request uses the envelope
+func writeData(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext, status int,
+	data interface{}, links Links, meta *EnvelopeMeta) {
+	if useEnvelope(r) {
+		data = &Envelope{Data: data, Links: links, Meta: meta}
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		context.Log("Error while parsing response:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUseEnvelope(t *testing.T) {
+	defer func(enabled bool) { ResponseEnvelope = enabled }(ResponseEnvelope)
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/accounts/alice", nil)
+	ResponseEnvelope = false
+	assert.False(t, useEnvelope(r), "Envelope should not be used by default")
+	r.Header.Set(EnvelopeHeader, "true")
+	assert.True(t, useEnvelope(r), "Request should opt in the envelope")
+
+	ResponseEnvelope = true
+	r.Header.Set(EnvelopeHeader, "false")
+	assert.False(t, useEnvelope(r), "Request should opt out of the envelope")
+	r.Header.Set(EnvelopeHeader, "maybe")
+	assert.True(t, useEnvelope(r), "Invalid header should be ignored")
+}
+
+func TestTransactionLinks(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/qledger/api/v1/transactions/t1.reversal", nil)
+	reversal := &models.Transaction{
+		ID:       "t1.reversal",
+		Data:     map[string]interface{}{"reverses": "t1"},
+		Reverses: "t1",
+		Lines: []*models.TransactionLine{
+			{AccountID: "alice", Delta: 100},
+			{AccountID: "bob", Delta: -50},
+			{AccountID: "bob", Delta: -50},
+		},
+	}
+	assert.Equal(t, Links{
+		"self":     "/qledger/api/v1/transactions/t1.reversal",
+		"accounts": []string{"/qledger/api/v1/accounts/alice", "/qledger/api/v1/accounts/bob"},
+		"reverses": "/qledger/api/v1/transactions/t1",
+	}, transactionLinks(r, reversal, false), "Invalid reversal links")
+
+	links := transactionLinks(r, &models.Transaction{ID: "t/2", Data: map[string]interface{}{"reverses": "t1"}}, true)
+	assert.Equal(t, Links{
+		"self":     "/qledger/api/v1/transactions/t%2F2",
+		"reversal": "/qledger/api/v1/transactions/t%2F2.reversal",
+	}, links, "Invalid transaction links")
+}
+
+func TestSearchMeta(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/v1/transactions/_search", nil)
+	r.Header.Set(ReadSnapshotHeader, "snap1")
+	meta := searchMeta(r, `{"from": 10, "size": 2}`, []*models.TransactionResult{{}, {}})
+	assert.Equal(t, &EnvelopeMeta{
+		Pagination: &PaginationMeta{From: 10, Size: 2, Count: 2},
+		Snapshot:   "snap1",
+	}, meta, "Invalid offset meta")
+
+	r = httptest.NewRequest(http.MethodPost, "/v1/accounts/_search", nil)
+	page := &models.SearchPage{Items: []*models.AccountResult{{}}, NextCursor: "c2", Truncated: true}
+	meta = searchMeta(r, `{"limit": 5, "after": ""}`, page)
+	assert.Equal(t, &EnvelopeMeta{
+		Pagination: &PaginationMeta{Limit: 5, Count: 1, NextCursor: "c2", Truncated: true},
+	}, meta, "Invalid cursor meta")
+}
+
+func TestWriteData(t *testing.T) {
+	defer func(enabled bool) { ResponseEnvelope = enabled }(ResponseEnvelope)
+	ResponseEnvelope = false
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/accounts/alice", nil)
+	rr := httptest.NewRecorder()
+	writeData(rr, r, nil, http.StatusOK, map[string]string{"id": "alice"}, accountLinks(r, "alice"), nil)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+	assert.JSONEq(t, `{"id": "alice"}`, rr.Body.String(), "Response should not be wrapped")
+
+	r.Header.Set(EnvelopeHeader, "true")
+	rr = httptest.NewRecorder()
+	writeData(rr, r, nil, http.StatusOK, map[string]string{"id": "alice"}, accountLinks(r, "alice"), nil)
+	assert.Equal(t, "application/json; charset=utf-8", rr.Header().Get("Content-Type"), "Invalid content type")
+	assert.JSONEq(t, `{
+		"data": {"id": "alice"},
+		"links": {"self": "/v1/accounts/alice", "lines": "/v1/lines?account=alice"}
+	}`, rr.Body.String(), "Response should be wrapped")
+}
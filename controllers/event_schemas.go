@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+)
+
+// WebhookEventVersionHeader carries the schema version of the event of the payload
+const WebhookEventVersionHeader = "X-Ledger-Event-Version"
+
+// EventSchema represents the JSON Schema of the `data` of an event in a version.
+// Within a version, fields are only ever added, so consumers should ignore the fields they don't know.
+// Any other change is released as a new version of the event.
+type EventSchema struct {
+	Event   string          `json:"event"`
+	Version int             `json:"version"`
+	Schema  json.RawMessage `json:"schema"`
+}
+
+// transactionSchema is the schema of a transaction in the events
+const transactionSchema = `{
+  "type": "object",
+  "required": ["id", "data", "timestamp", "lines"],
+  "properties": {
+    "id": {"type": "string"},
+    "data": {"type": "object"},
+    "timestamp": {"type": "string"},
+    "lines": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["account", "delta"],
+        "properties": {
+          "account": {"type": "string"},
+          "delta": {"type": "integer"},
+          "currency": {"type": "string"},
+          "rounding": {"type": "string"}
+        }
+      }
+    },
+    "signature": {
+      "type": "object",
+      "required": ["key_id", "value"],
+      "properties": {
+        "key_id": {"type": "string"},
+        "value": {"type": "string"}
+      }
+    },
+    "post_at": {"type": "string"},
+    "content_hash": {"type": "string"}
+  }
+}`
+
+// invariantViolationSchema is the schema of a violation found by the invariant checker
+const invariantViolationSchema = `{
+  "type": "object",
+  "required": ["invariant", "currency", "expected", "actual"],
+  "properties": {
+    "invariant": {"type": "string", "enum": ["transaction_balanced", "rollup_balance"]},
+    "transaction": {"type": "string"},
+    "account": {"type": "string"},
+    "currency": {"type": "string"},
+    "expected": {"type": "integer"},
+    "actual": {"type": "integer"}
+  }
+}`
+
+// accountDormancySchema is the schema of a change in the dormancy of an account
+const accountDormancySchema = `{
+  "type": "object",
+  "required": ["account", "last_activity_at"],
+  "properties": {
+    "account": {"type": "string"},
+    "dormant_since": {"type": "string"},
+    "last_activity_at": {"type": "string"}
+  }
+}`
+
+// eventSchemas are the schemas of all the versions of the events, in the order of the events and versions.
+// The schemas of the released versions must not change, except for adding optional fields.
+var eventSchemas = []*EventSchema{
+	{Event: WebhookEventAccountDormant, Version: 1, Schema: json.RawMessage(accountDormancySchema)},
+	{Event: WebhookEventAccountReactivated, Version: 1, Schema: json.RawMessage(accountDormancySchema)},
+	{Event: WebhookEventInvariantViolated, Version: 1, Schema: json.RawMessage(invariantViolationSchema)},
+	{Event: WebhookEventTransactionCreated, Version: 1, Schema: json.RawMessage(transactionSchema)},
+	{Event: WebhookEventTransactionPosting, Version: 1, Schema: json.RawMessage(transactionSchema)},
+}
+
+// eventVersion returns the current version of an event, which is the version of the payloads sent
+func eventVersion(event string) int {
+	version := 0
+	for _, schema := range eventSchemas {
+		if schema.Event == event && schema.Version > version {
+			version = schema.Version
+		}
+	}
+	return version
+}
+
+// GetEventSchemas returns the schemas of the events, filtered by the optional `event` and `version` query parameters
+func GetEventSchemas(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	params := r.URL.Query()
+	event := params.Get("event")
+	version := 0
+	if value := params.Get("version"); value != "" {
+		v, err := strconv.Atoi(value)
+		if err != nil || v <= 0 {
+			context.Log("Invalid version in event schemas query:", value)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		version = v
+	}
+
+	schemas := []*EventSchema{}
+	for _, schema := range eventSchemas {
+		if (event == "" || schema.Event == event) && (version == 0 || schema.Version == version) {
+			schemas = append(schemas, schema)
+		}
+	}
+	if event != "" && len(schemas) == 0 {
+		context.Log("Event schema doesn't exist:", event, version)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	data, err := json.Marshal(schemas)
+	if err != nil {
+		context.Log("Error while parsing event schemas:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// schemaErrors returns how the value doesn't conform to the schema. Unlike the consumers, the fields
+// missing in the schema are errors, so that every field sent is documented.
+func schemaErrors(path string, schema map[string]interface{}, value interface{}) []string {
+	var errors []string
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{path + " should be an object"}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, key := range required {
+				if _, ok := object[key.(string)]; !ok {
+					errors = append(errors, path+"."+key.(string)+" is required")
+				}
+			}
+		}
+		if properties == nil {
+			return errors
+		}
+		for key, v := range object {
+			property, ok := properties[key].(map[string]interface{})
+			if !ok {
+				errors = append(errors, path+"."+key+" is not in the schema")
+				continue
+			}
+			errors = append(errors, schemaErrors(path+"."+key, property, v)...)
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return []string{path + " should be an array"}
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range array {
+			errors = append(errors, schemaErrors(fmt.Sprintf("%s[%d]", path, i), items, item)...)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return []string{path + " should be a string"}
+		}
+		if enum, ok := schema["enum"].([]interface{}); ok {
+			found := false
+			for _, e := range enum {
+				found = found || e == s
+			}
+			if !found {
+				errors = append(errors, path+" should be one of the enum")
+			}
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != float64(int64(n)) {
+			return []string{path + " should be an integer"}
+		}
+	}
+	return errors
+}
+
+func TestEventSchemas(t *testing.T) {
+	versions := map[string]int{}
+	for _, schema := range eventSchemas {
+		versions[schema.Event]++
+		assert.Equal(t, versions[schema.Event], schema.Version, "Versions of %v should start from 1 in order", schema.Event)
+		assert.True(t, json.Valid(schema.Schema), "Schema of %v should be JSON", schema.Event)
+	}
+	assert.Equal(t, 1, eventVersion(WebhookEventTransactionCreated), "Invalid version of event")
+	assert.Equal(t, 0, eventVersion("unknown"), "Unknown event should have no version")
+}
+
+// TestEventPayloadsMatchSchemas guards the compatibility of the events, as the fields sent
+// by the ledger must be in the schemas of their current versions
+func TestEventPayloadsMatchSchemas(t *testing.T) {
+	transaction := &models.Transaction{
+		ID:        "t001",
+		Timestamp: "2017-01-01 13:01:05.000",
+		Data:      map[string]interface{}{"note": "rent"},
+		Lines: []*models.TransactionLine{
+			{AccountID: "alice", Delta: -100, Currency: "USD", Rounding: "half_even"},
+			{AccountID: "bob", Delta: 100, Currency: "USD"},
+		},
+		Signature:   &models.TransactionSignature{KeyID: "billing-2017", Value: "MEUCIQD"},
+		PostAt:      "2017-01-01 13:01:05.000",
+		ContentHash: "9f86d081",
+	}
+	violation := &models.InvariantViolation{
+		Invariant:     models.InvariantTransactionBalanced,
+		TransactionID: "t001",
+		AccountID:     "alice",
+		Currency:      "USD",
+		Expected:      0,
+		Actual:        100,
+	}
+	dormancy := &models.AccountDormancy{
+		AccountID:      "alice",
+		DormantSince:   "2017-07-01 00:00:00.000",
+		LastActivityAt: "2017-01-01 13:01:05.000",
+	}
+	samples := map[string]interface{}{
+		WebhookEventAccountDormant:     dormancy,
+		WebhookEventAccountReactivated: dormancy,
+		WebhookEventTransactionCreated: transaction,
+		WebhookEventTransactionPosting: transaction,
+		WebhookEventInvariantViolated:  violation,
+	}
+	for _, schema := range eventSchemas {
+		if schema.Version != eventVersion(schema.Event) {
+			continue
+		}
+		sample, ok := samples[schema.Event]
+		if !assert.True(t, ok, "Missing sample of event: %v", schema.Event) {
+			continue
+		}
+		var decodedSchema map[string]interface{}
+		var decodedSample interface{}
+		assert.Nil(t, json.Unmarshal(schema.Schema, &decodedSchema), "Error decoding schema")
+		data, err := json.Marshal(sample)
+		assert.Nil(t, err, "Error encoding sample")
+		assert.Nil(t, json.Unmarshal(data, &decodedSample), "Error decoding sample")
+		assert.Empty(t, schemaErrors(schema.Event, decodedSchema, decodedSample), "Sample should match the schema")
+	}
+}
+
+func TestGetEventSchemas(t *testing.T) {
+	handler := middlewares.ContextMiddleware(GetEventSchemas, nil)
+	get := func(query string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/v1/events/schemas"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("")
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+	var schemas []*EventSchema
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &schemas), "Error decoding schemas")
+	assert.Equal(t, len(eventSchemas), len(schemas), "All schemas should be listed")
+
+	rr = get("?event=transaction.created&version=1")
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &schemas), "Error decoding schemas")
+	if assert.Equal(t, 1, len(schemas), "Invalid count of schemas") {
+		assert.Equal(t, WebhookEventTransactionCreated, schemas[0].Event, "Invalid event of schema")
+	}
+
+	assert.Equal(t, http.StatusNotFound, get("?event=transaction.created&version=9").Code, "Invalid response code")
+	assert.Equal(t, http.StatusNotFound, get("?event=unknown").Code, "Invalid response code")
+	assert.Equal(t, http.StatusBadRequest, get("?version=x").Code, "Invalid response code")
+}
@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+// Roles of a region
+const (
+	// RegionPrimary accepts writes
+	RegionPrimary = "primary"
+	// RegionStandby is a warm standby whose DB replicates from the primary, which serves reads only
+	RegionStandby = "standby"
+	// RegionFenced was the primary until another region was promoted, and serves reads only
+	RegionFenced = "fenced"
+)
+
+var (
+	// Region is the name of the region of the server, which enables the failover of the regions if set
+	Region string
+	// PeerRegionURL is the base URL of the ledger in the other region, which is fenced on promotion
+	PeerRegionURL string
+	// PeerRegionToken is the auth token of the ledger in the other region
+	PeerRegionToken string
+)
+
+var peerRegionClient = &http.Client{Timeout: 10 * time.Second}
+
+// RegionStatus represents the failover status of the region of the server
+type RegionStatus struct {
+	Region                string  `json:"region"`
+	Role                  string  `json:"role"`
+	Epoch                 int64   `json:"epoch"`
+	PrimaryRegion         string  `json:"primary_region,omitempty"`
+	ReplicationLagSeconds float64 `json:"replication_lag_seconds"`
+}
+
+// regionState holds the role of the region of the server, which is refreshed from its DB
+type regionState struct {
+	mu   sync.RWMutex
+	role string
+}
+
+var region = &regionState{role: RegionPrimary}
+
+func (s *regionState) get() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.role
+}
+
+func (s *regionState) set(role string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.role = role
+}
+
+// IsReadOnly says whether the region of the server is a standby or fenced, so that it rejects writes
+func IsReadOnly() bool {
+	return region.get() != RegionPrimary
+}
+
+// regionStatus returns the status of the region of the server by its DB. The region is a standby while
+// its DB replicates, and fenced when another region was promoted after it.
+func regionStatus(context *ledgerContext.AppContext) (*RegionStatus, error) {
+	failoverDB := models.NewFailoverDB(context.DB)
+	status := &RegionStatus{Region: Region, Role: RegionPrimary}
+	standby, aerr := failoverDB.IsStandby()
+	if aerr != nil {
+		return nil, aerr
+	}
+	epoch, aerr := failoverDB.CurrentEpoch()
+	if aerr != nil {
+		return nil, aerr
+	}
+	if epoch != nil {
+		status.Epoch = epoch.Epoch
+		status.PrimaryRegion = epoch.PrimaryRegion
+	}
+	switch {
+	case standby:
+		status.Role = RegionStandby
+		lag, aerr := models.ReplicationLag(context.DB)
+		if aerr != nil {
+			return nil, aerr
+		}
+		status.ReplicationLagSeconds = lag.Seconds()
+	case epoch != nil && epoch.PrimaryRegion != Region:
+		status.Role = RegionFenced
+	}
+	return status, nil
+}
+
+// refreshRegion refreshes the role of the region of the server
+func refreshRegion(context *ledgerContext.AppContext) (*RegionStatus, error) {
+	status, err := regionStatus(context)
+	if err != nil {
+		return nil, err
+	}
+	if previous := region.get(); previous != status.Role {
+		context.Log("Region role changed:", Region, previous, "->", status.Role)
+		region.set(status.Role)
+	}
+	return status, nil
+}
+
+// WatchRegion refreshes the role of the region of the server at every interval, and calls `onPrimary`
+// once when the region is the primary, such as to start the background jobs writing to the DB
+func WatchRegion(context *ledgerContext.AppContext, interval time.Duration, onPrimary func()) {
+	// The server is read-only until its role is known
+	region.set(RegionStandby)
+	started := false
+	for {
+		if _, err := refreshRegion(context); err != nil {
+			context.Log("Error while refreshing region:", err)
+		}
+		if !started && !IsReadOnly() {
+			started = true
+			onPrimary()
+		}
+		time.Sleep(interval)
+	}
+}
+
+// GetRegionStatus returns the failover status of the region of the server
+func GetRegionStatus(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	status, err := regionStatus(context)
+	if err != nil {
+		context.Log("Error while getting region status:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeRegionStatus(w, context, status)
+}
+
+func writeRegionStatus(w http.ResponseWriter, context *ledgerContext.AppContext, status *RegionStatus) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		context.Log("Error while parsing region status:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
+
+// FenceRegion records the epoch of the region promoted by the other region, so that this region
+// no longer accepts writes. A stale epoch, which isn't newer than the latest epoch, is rejected.
+func FenceRegion(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	epoch := &models.FailoverEpoch{}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(epoch); err != nil || epoch.Epoch <= 0 || epoch.PrimaryRegion == "" {
+		context.Log("Invalid failover epoch:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if epoch.PrimaryRegion == Region {
+		context.Log("Region can't be fenced by its own epoch:", epoch.PrimaryRegion)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	failoverDB := models.NewFailoverDB(context.DB)
+	recorded, aerr := failoverDB.RecordEpoch(epoch)
+	if aerr != nil {
+		context.Log("Error while recording failover epoch:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !recorded {
+		context.Log("Failover epoch is stale:", epoch.Epoch)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	status, err := refreshRegion(context)
+	if err != nil {
+		context.Log("Error while refreshing region:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	context.Log("Region fenced by promoted region:", epoch.PrimaryRegion, "epoch:", epoch.Epoch)
+	writeRegionStatus(w, context, status)
+}
+
+// fencePeerRegion fences the ledger in the other region with the epoch
+func fencePeerRegion(epoch *models.FailoverEpoch) error {
+	if PeerRegionURL == "" {
+		return fmt.Errorf("Peer region isn't configured")
+	}
+	payload, err := json.Marshal(epoch)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(PeerRegionURL, "/")+"/v1/admin/region/_fence",
+		bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", PeerRegionToken)
+	resp, err := peerRegionClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Peer region responded with status: %v %s", resp.Status, body)
+	}
+	return nil
+}
+
+// PromoteRequest represents the options of promoting a region
+type PromoteRequest struct {
+	// Force promotes the region even when the other region can't be fenced, such as when it is down
+	Force bool `json:"force"`
+}
+
+// PromoteRegion promotes the region of the server to the primary. The other region is fenced first,
+// then the standby DB is promoted and the new epoch is recorded, which makes this region writable.
+func PromoteRegion(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	request := &PromoteRequest{}
+	defer r.Body.Close()
+	if body, err := ioutil.ReadAll(r.Body); err != nil || (len(body) > 0 && json.Unmarshal(body, request) != nil) {
+		context.Log("Invalid promote request:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	status, err := regionStatus(context)
+	if err != nil {
+		context.Log("Error while getting region status:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// Only a standby is promoted, as the primary already is and a fenced region lost its writes to the new primary
+	if status.Role != RegionStandby {
+		context.Log("Region can't be promoted from its role:", Region, status.Role)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	epoch := &models.FailoverEpoch{Epoch: status.Epoch + 1, PrimaryRegion: Region}
+	if err := fencePeerRegion(epoch); err != nil {
+		if !request.Force {
+			context.Log("Error while fencing peer region:", err)
+			writeErrorResponse(w, http.StatusBadGateway, models.RegionFenceFailedError(err))
+			return
+		}
+		context.Log("Promoting region without fencing peer region:", err)
+	}
+
+	failoverDB := models.NewFailoverDB(context.DB)
+	if aerr := failoverDB.PromoteStandby(); aerr != nil {
+		context.Log("Error while promoting standby DB:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	recorded, aerr := failoverDB.RecordEpoch(epoch)
+	if aerr != nil {
+		context.Log("Error while recording failover epoch:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !recorded {
+		// A concurrent promotion recorded the epoch, or a newer one, first
+		context.Log("Failover epoch is already recorded:", epoch.Epoch)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	status, err = refreshRegion(context)
+	if err != nil {
+		context.Log("Error while refreshing region:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	context.Log("Region promoted to primary:", Region, "epoch:", epoch.Epoch)
+	writeRegionStatus(w, context, status)
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFencePeerRegion(t *testing.T) {
+	defer func(url, token string) { PeerRegionURL, PeerRegionToken = url, token }(PeerRegionURL, PeerRegionToken)
+
+	var received *models.FailoverEpoch
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/ledger/v1/admin/region/_fence", r.URL.Path, "Invalid fence path")
+		assert.Equal(t, "peer-token", r.Header.Get("Authorization"), "Invalid peer token")
+		received = &models.FailoverEpoch{}
+		json.NewDecoder(r.Body).Decode(received)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	PeerRegionURL, PeerRegionToken = "", "peer-token"
+	assert.NotNil(t, fencePeerRegion(&models.FailoverEpoch{Epoch: 2, PrimaryRegion: "eu-west-1"}),
+		"Fencing without a peer region should fail")
+
+	PeerRegionURL = server.URL + "/ledger/"
+	assert.Nil(t, fencePeerRegion(&models.FailoverEpoch{Epoch: 2, PrimaryRegion: "eu-west-1"}), "Error fencing peer region")
+	if assert.NotNil(t, received, "Peer region should be fenced") {
+		assert.Equal(t, int64(2), received.Epoch, "Invalid fenced epoch")
+		assert.Equal(t, "eu-west-1", received.PrimaryRegion, "Invalid fenced primary region")
+	}
+
+	stale := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer stale.Close()
+	PeerRegionURL = stale.URL
+	assert.NotNil(t, fencePeerRegion(&models.FailoverEpoch{Epoch: 2, PrimaryRegion: "eu-west-1"}),
+		"Rejected fencing should fail")
+}
+
+func TestInvalidFenceRegionRequests(t *testing.T) {
+	defer func(name string) { Region = name }(Region)
+	Region = "us-east-1"
+
+	handler := middlewares.ContextMiddleware(FenceRegion, nil)
+	for _, payload := range []string{
+		`not json`,
+		`{"epoch": 0, "primary_region": "eu-west-1"}`,
+		`{"epoch": 2}`,
+		`{"epoch": 2, "primary_region": "us-east-1"}`,
+	} {
+		req, err := http.NewRequest("POST", "/v1/admin/region/_fence", bytes.NewBufferString(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "Invalid response code for payload: %v", payload)
+	}
+}
+
+func TestIsReadOnly(t *testing.T) {
+	defer region.set(region.get())
+	assert.False(t, IsReadOnly(), "Server should accept writes by default")
+	region.set(RegionFenced)
+	assert.True(t, IsReadOnly(), "Fenced region should be read-only")
+	region.set(RegionStandby)
+	assert.True(t, IsReadOnly(), "Standby region should be read-only")
+}
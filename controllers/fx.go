@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+// SetFXRate creates or replaces the conversion rate of a rate source
+func SetFXRate(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		context.Log("Error reading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rate := &models.FXRate{}
+	err = json.Unmarshal(body, rate)
+	if err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if rate.Source == "" || rate.Rate <= 0 ||
+		!models.IsValidCurrency(rate.FromCurrency) || !models.IsValidCurrency(rate.ToCurrency) {
+		context.Log("FX rate is invalid:", rate.Source, rate.FromCurrency, rate.ToCurrency)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	fxRateDB := models.NewFXRateDB(context.DB)
+	aerr := fxRateDB.SetRate(rate)
+	if aerr != nil {
+		context.Logf("Error while setting FX rate: %v (%v)", rate.Source, aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(rate)
+	if err != nil {
+		context.Log("Error while parsing FX rate:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
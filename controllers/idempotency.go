@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+// GetIdempotencySettings returns the idempotency settings of the ledger
+func GetIdempotencySettings(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	idempotencyDB := models.NewIdempotencyDB(context.DB)
+	settings, aerr := idempotencyDB.Get()
+	if aerr != nil {
+		context.Log("Error while reading idempotency settings:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		context.Log("Error while parsing idempotency settings:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// SetIdempotencySettings replaces the idempotency settings of the ledger
+func SetIdempotencySettings(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		context.Log("Error reading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	settings := models.DefaultIdempotencySettings
+	err = json.Unmarshal(body, &settings)
+	if err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := settings.Validate(); err != nil {
+		context.Log("Idempotency settings are invalid:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	idempotencyDB := models.NewIdempotencyDB(context.DB)
+	if aerr := idempotencyDB.Set(&settings); aerr != nil {
+		context.Log("Error while setting idempotency settings:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		context.Log("Error while parsing idempotency settings:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
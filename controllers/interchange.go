@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+// ledgerImportSizeLimit is the maximum size of the export of a ledger import
+const ledgerImportSizeLimit = 1 << 30
+
+// LedgerImportResult represents the outcome of a ledger import
+type LedgerImportResult struct {
+	Accounts             int      `json:"accounts"`
+	TransactionsCreated  int      `json:"transactions_created"`
+	TransactionsExisting int      `json:"transactions_existing"`
+	Conflicts            []string `json:"conflicts"`
+}
+
+// GetExportSchema returns the JSON schema of the records of a ledger export
+func GetExportSchema(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	w.Header().Set("Content-Type", "application/schema+json; charset=utf-8")
+	io.WriteString(w, models.InterchangeSchema)
+	return
+}
+
+// ExportLedger streams all the accounts and transactions in the canonical export format,
+// as of the pinned read snapshot of the request if any. The data keys which the API key
+// of the request can't read are left out.
+func ExportLedger(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	tx, aerr := beginRead(r, context)
+	if aerr != nil {
+		writeReadError(w, aerr)
+		return
+	}
+	defer tx.Rollback()
+
+	w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	writer, err := models.NewExportWriter(w, time.Now())
+	if err != nil {
+		context.Log("Error while writing export:", err)
+		return
+	}
+	writer.Metadata = context.Metadata
+
+	// The status is already sent, so a failed export is only detectable by its missing manifest
+	exportDB := models.NewExportDB(context.DB)
+	if aerr := exportDB.Export(writer, tx); aerr != nil {
+		context.Log("Error while exporting ledger:", aerr)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		context.Log("Error while writing export manifest:", err)
+	}
+	return
+}
+
+// validateExportRecord validates the account or transaction of an export record
+func validateExportRecord(record *models.ExportRecord) error {
+	if record.Type == models.ExportRecordAccount {
+		return validateAccountImportRow(&models.Account{ID: record.ID, Data: record.Data})
+	}
+	transaction := &models.Transaction{ID: record.ID, Timestamp: record.Timestamp, Data: record.Data, Lines: record.Lines, Reverses: record.Reverses}
+	if err := transaction.ValidateData(); err != nil {
+		return err
+	}
+	if transaction.ID == "" || transaction.Timestamp == "" || !transaction.IsValid() {
+		return fmt.Errorf("Transaction is invalid: %v", transaction.ID)
+	}
+	return nil
+}
+
+// importRecord creates the account or transaction of a validated export record
+func importRecord(context *ledgerContext.AppContext, record *models.ExportRecord, result *LedgerImportResult) error {
+	if record.Type == models.ExportRecordAccount {
+		account := &models.Account{ID: record.ID, Data: record.Data}
+		accountDB := models.NewAccountDB(context.DB)
+		if _, aerr := accountDB.UpsertAccount(account); aerr != nil {
+			return aerr
+		}
+		result.Accounts++
+		return nil
+	}
+
+	transaction := &models.Transaction{
+		ID:        record.ID,
+		Timestamp: record.Timestamp,
+		Data:      record.Data,
+		Lines:     record.Lines,
+		Reverses:  record.Reverses,
+	}
+	transactionDB := models.NewTransactionDB(context.DB)
+	isExists, aerr := transactionDB.IsExists(transaction.ID)
+	if aerr != nil {
+		return aerr
+	}
+	if isExists {
+		isConflict, aerr := transactionDB.IsConflict(transaction)
+		if aerr != nil {
+			return aerr
+		}
+		if isConflict {
+			result.Conflicts = append(result.Conflicts, transaction.ID)
+		} else {
+			result.TransactionsExisting++
+		}
+		return nil
+	}
+	if !transactionDB.Transact(transaction) {
+		return errors.New("Transaction failed: " + transaction.ID)
+	}
+	result.TransactionsCreated++
+	return nil
+}
+
+// ImportLedger verifies a ledger export against its manifest and then imports its accounts and transactions.
+// Accounts are created or their data is replaced, while transactions conflicting with existing ones are reported.
+// Existing transactions are skipped, so a failed import can be retried.
+// The imported transactions are restored as they were exported, so they aren't checked by the posting hooks,
+// counted against the quotas or notified to the webhooks.
+func ImportLedger(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	defer r.Body.Close()
+	body := http.MaxBytesReader(w, r.Body, ledgerImportSizeLimit)
+
+	// The export is spooled to a file, as it is verified before any record is imported
+	file, err := ioutil.TempFile("", "qledger-import")
+	if err != nil {
+		context.Log("Error creating import file:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	if _, err := io.Copy(file, body); err != nil {
+		context.Log("Error reading payload:", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// The API keys with a metadata scope can only import the data keys they can write
+	var forbiddenKey string
+	file.Seek(0, io.SeekStart)
+	err = models.ReadExport(file, func(record *models.ExportRecord) error {
+		if err := validateExportRecord(record); err != nil {
+			return err
+		}
+		if key := context.Metadata.UnwritableKey(record.Data); key != "" {
+			forbiddenKey = key
+			return models.MetadataKeyForbiddenError("write", key)
+		}
+		return nil
+	})
+	if forbiddenKey != "" {
+		context.Log("Data key can't be written by API key:", forbiddenKey)
+		writeErrorResponse(w, http.StatusForbidden, models.MetadataKeyForbiddenError("write", forbiddenKey))
+		return
+	}
+	if err != nil {
+		context.Log("Invalid ledger export:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	result := &LedgerImportResult{Conflicts: make([]string, 0)}
+	file.Seek(0, io.SeekStart)
+	err = models.ReadExport(file, func(record *models.ExportRecord) error {
+		return importRecord(context, record, result)
+	})
+	if err != nil {
+		context.Log("Error while importing ledger:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		context.Log("Error while parsing import result:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
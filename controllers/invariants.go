@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"math/rand"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/metrics"
+	"github.com/RealImage/QLedger/models"
+)
+
+// WebhookEventInvariantViolated is sent when the invariant checker finds a violation
+const WebhookEventInvariantViolated = "ledger.invariant_violated"
+
+// invariantCheckBatch is the number of transactions checked at a time, which is also the number of
+// the latest transactions checked on startup
+const invariantCheckBatch = 1000
+
+var (
+	// InvariantCheckInterval is the interval of checking the invariants, which are not checked if it is zero
+	InvariantCheckInterval time.Duration
+	// InvariantCheckSampleRate is the share of the transactions which are checked
+	InvariantCheckSampleRate = 0.1
+)
+
+var (
+	invariantChecks = metrics.NewCounterVec("qledger_invariant_checked_transactions_total",
+		"Transactions checked by the invariant checker.")
+	invariantViolations = metrics.NewCounterVec("qledger_invariant_violations_total",
+		"Invariant violations found by the invariant checker.", "invariant")
+)
+
+// sampleIDs returns the share of the IDs chosen at random
+func sampleIDs(ids []string, rate float64, random *rand.Rand) []string {
+	var sampled []string
+	for _, id := range ids {
+		if random.Float64() < rate {
+			sampled = append(sampled, id)
+		}
+	}
+	return sampled
+}
+
+// invariantChecker checks a sample of the transactions as they are posted
+type invariantChecker struct {
+	sequence int64
+	random   *rand.Rand
+}
+
+// check checks a sample of the transactions posted since the last check, and the rolled up balances
+// of their accounts. It returns the violations found, which are alerted on by the caller.
+func (c *invariantChecker) check(context *ledgerContext.AppContext) ([]*models.InvariantViolation, error) {
+	invariantDB := models.NewInvariantDB(context.DB)
+	var violations []*models.InvariantViolation
+	for {
+		ids, sequence, aerr := invariantDB.TransactionsAfter(c.sequence, invariantCheckBatch)
+		if aerr != nil {
+			return violations, aerr
+		}
+		c.sequence = sequence
+		sampled := sampleIDs(ids, InvariantCheckSampleRate, c.random)
+		if len(sampled) > 0 {
+			found, accounts, aerr := invariantDB.CheckTransactions(sampled)
+			if aerr != nil {
+				return violations, aerr
+			}
+			violations = append(violations, found...)
+			found, aerr = invariantDB.CheckRollupBalances(accounts)
+			if aerr != nil {
+				return violations, aerr
+			}
+			violations = append(violations, found...)
+			invariantChecks.Add(float64(len(sampled)))
+		}
+		if len(ids) < invariantCheckBatch {
+			return violations, nil
+		}
+	}
+}
+
+// alertInvariantViolation logs the violation, counts it in the metrics and notifies the webhooks
+func alertInvariantViolation(context *ledgerContext.AppContext, violation *models.InvariantViolation) {
+	context.Log("Invariant violated:", violation.Invariant, "transaction:", violation.TransactionID,
+		"account:", violation.AccountID, "currency:", violation.Currency,
+		"expected:", violation.Expected, "actual:", violation.Actual)
+	invariantViolations.Inc(violation.Invariant)
+	notifyWebhooks(context, WebhookEventInvariantViolated, violation)
+}
+
+// ScheduleInvariantChecks checks a sample of the recently posted transactions at every interval,
+// starting from the latest transactions, and alerts on the violations as soon as they are found
+func ScheduleInvariantChecks(context *ledgerContext.AppContext, interval time.Duration) {
+	checker := &invariantChecker{random: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	invariantDB := models.NewInvariantDB(context.DB)
+	if sequence, aerr := invariantDB.LatestSequence(); aerr != nil {
+		context.Log("Error while getting latest transaction sequence:", aerr)
+	} else if sequence > invariantCheckBatch {
+		checker.sequence = sequence - invariantCheckBatch
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		violations, err := checker.check(context)
+		for _, violation := range violations {
+			alertInvariantViolation(context, violation)
+		}
+		if err != nil {
+			context.Log("Error while checking invariants:", err)
+		}
+	}
+}
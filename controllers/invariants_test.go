@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleIDs(t *testing.T) {
+	var ids []string
+	for i := 0; i < 1000; i++ {
+		ids = append(ids, fmt.Sprintf("txn%d", i))
+	}
+	random := rand.New(rand.NewSource(1))
+
+	assert.Equal(t, ids, sampleIDs(ids, 1, random), "All the IDs should be sampled at rate 1")
+	assert.Empty(t, sampleIDs(ids, 0, random), "No IDs should be sampled at rate 0")
+
+	sampled := sampleIDs(ids, 0.1, random)
+	assert.InDelta(t, 100, len(sampled), 40, "Invalid count of sampled IDs")
+	seen := map[string]bool{}
+	for _, id := range ids {
+		seen[id] = true
+	}
+	for _, id := range sampled {
+		assert.True(t, seen[id], "Sampled ID should be one of the IDs: %s", id)
+	}
+}
@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+	"github.com/RealImage/QLedger/tenants"
+)
+
+// GetLedgers returns all the ledgers of the tenants
+func GetLedgers(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	ledgerDB := models.NewLedgerDB(context.DB)
+	ledgers, aerr := ledgerDB.List()
+	if aerr != nil {
+		context.Log("Error while listing ledgers:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(ledgers)
+	if err != nil {
+		context.Log("Error while parsing ledgers:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// LedgerTemplates are the templates of the default accounts of the new ledgers, by their names
+var LedgerTemplates map[string]*models.LedgerTemplate
+
+// OpenLedger returns the context of the created ledger of a tenant, creating and migrating its schema or database if needed
+var OpenLedger func(tenant string) (*ledgerContext.AppContext, error)
+
+// ledgerRequest is the request data of a new ledger, along with its default accounts
+type ledgerRequest struct {
+	models.Ledger
+	// Template names the template of the default accounts, if any
+	Template string `json:"template"`
+	// Accounts are created along with the accounts of the template
+	Accounts []*models.Account `json:"accounts"`
+}
+
+// ProvisionedLedger is a new ledger along with everything needed to start posting to it
+type ProvisionedLedger struct {
+	*models.Ledger
+	Accounts []string       `json:"accounts"`
+	APIKey   *models.APIKey `json:"api_key"`
+}
+
+// AddLedger creates a ledger with the `id` and `data` from the request data, and provisions it:
+// its schema or database is set up, the accounts of the `template` and the `accounts` are created,
+// and an API key scoped to it is issued. The key is only returned in this response.
+func AddLedger(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	request := &ledgerRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ledger := &request.Ledger
+	if !tenants.IsValid(ledger.ID) {
+		context.Log("Invalid ledger:", ledger.ID)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	template := &models.LedgerTemplate{}
+	if request.Template != "" {
+		t, ok := LedgerTemplates[request.Template]
+		if !ok {
+			context.Log("Ledger template doesn't exist:", request.Template)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		template.Accounts = append(template.Accounts, t.Accounts...)
+	}
+	template.Accounts = append(template.Accounts, request.Accounts...)
+	if err := template.Validate(); err != nil {
+		context.Log("Invalid accounts of ledger:", ledger.ID, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ledgerDB := models.NewLedgerDB(context.DB)
+	if aerr := ledgerDB.Create(ledger); aerr != nil {
+		context.Log("Error while creating ledger:", aerr)
+		switch aerr.ErrorCode() {
+		case "ledger.exists":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	provisioned, status := provisionLedger(context, ledger, template)
+	if status != 0 {
+		// The ledger is removed, so that the request can be retried.
+		// Its schema or database is kept, and the accounts which were created are reused.
+		if aerr := ledgerDB.Delete(ledger.ID); aerr != nil {
+			context.Log("Error while removing ledger:", ledger.ID, aerr)
+		}
+		w.WriteHeader(status)
+		return
+	}
+	context.Log("Provisioned ledger:", ledger.ID, provisioned.APIKey.ID)
+
+	data, err := json.Marshal(provisioned)
+	if err != nil {
+		context.Log("Error while parsing ledger:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(data)
+	return
+}
+
+// provisionLedger sets up the created ledger with the accounts of the template and issues its API key,
+// or returns the status of the error
+func provisionLedger(context *ledgerContext.AppContext, ledger *models.Ledger, template *models.LedgerTemplate) (*ProvisionedLedger, int) {
+	provisioned := &ProvisionedLedger{Ledger: ledger, Accounts: make([]string, 0, len(template.Accounts))}
+	if OpenLedger == nil {
+		context.Log("Ledgers can't be opened without tenant isolation")
+		return nil, http.StatusInternalServerError
+	}
+	tenantContext, err := OpenLedger(ledger.ID)
+	if err != nil {
+		context.Log("Error while opening ledger:", ledger.ID, err)
+		return nil, http.StatusServiceUnavailable
+	}
+
+	accountsDB := models.NewAccountDB(tenantContext.DB)
+	for _, account := range template.Accounts {
+		isExists, aerr := accountsDB.IsExists(account.ID)
+		if aerr != nil {
+			context.Log("Error while checking for existing account:", aerr)
+			return nil, http.StatusInternalServerError
+		}
+		if !isExists {
+			if aerr := accountsDB.CreateAccount(account); aerr != nil {
+				context.Logf("Error while adding account: %v (%v)", account.ID, aerr)
+				return nil, http.StatusInternalServerError
+			}
+		}
+		provisioned.Accounts = append(provisioned.Accounts, account.ID)
+	}
+
+	ledgerDB := models.NewLedgerDB(context.DB)
+	key, aerr := ledgerDB.CreateKey(ledger.ID, nil)
+	if aerr != nil {
+		context.Log("Error while creating API key:", aerr)
+		return nil, http.StatusInternalServerError
+	}
+	provisioned.APIKey = key
+	return provisioned, 0
+}
+
+// GetAPIKeys returns the API keys of the ledger with the `ledger` query parameter, without the keys themselves
+func GetAPIKeys(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	ledgerDB := models.NewLedgerDB(context.DB)
+	keys, aerr := ledgerDB.ListKeys(r.URL.Query().Get("ledger"))
+	if aerr != nil {
+		context.Log("Error while listing API keys:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(keys)
+	if err != nil {
+		context.Log("Error while parsing API keys:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// AddAPIKey generates an API key scoped to the `ledger` from the request data.
+// The key is only returned in this response.
+func AddAPIKey(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	request := &models.APIKey{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if request.Metadata != nil {
+		if err := request.Metadata.Validate(); err != nil {
+			context.Log("Invalid metadata scope:", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	ledgerDB := models.NewLedgerDB(context.DB)
+	key, aerr := ledgerDB.CreateKey(request.LedgerID, request.Metadata)
+	if aerr != nil {
+		context.Log("Error while creating API key:", aerr)
+		switch aerr.ErrorCode() {
+		case "ledger.notfound":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	context.Log("Created API key:", key.ID, key.LedgerID)
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		context.Log("Error while parsing API key:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(data)
+	return
+}
+
+// RevokeAPIKey revokes the API key with the `id` query parameter
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	id := r.URL.Query().Get("id")
+	ledgerDB := models.NewLedgerDB(context.DB)
+	revoked, aerr := ledgerDB.RevokeKey(id)
+	if aerr != nil {
+		context.Log("Error while revoking API key:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		context.Log("Active API key doesn't exist:", id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	return
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+// ReconcileRequest represents the lines to be reconciled against an external statement
+type ReconcileRequest struct {
+	StatementRef string  `json:"statement_ref"`
+	Lines        []int64 `json:"lines"`
+}
+
+// GetLines returns the lines of an account, optionally filtered by their reconciliation status
+func GetLines(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	params := r.URL.Query()
+	accountID := params.Get("account")
+	if accountID == "" {
+		context.Log("Missing account in lines query")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var reconciled *bool
+	if value := params.Get("reconciled"); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			context.Log("Invalid reconciled in lines query:", value)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reconciled = &b
+	}
+
+	linesDB := models.NewLineDB(context.DB)
+	lines, aerr := linesDB.GetLines(accountID, reconciled)
+	if aerr != nil {
+		context.Log("Error while getting lines:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(lines)
+	if err != nil {
+		context.Log("Error while parsing lines:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// ReconcileLines marks the lines as reconciled against an external statement
+func ReconcileLines(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		context.Log("Error reading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	request := &ReconcileRequest{}
+	err = json.Unmarshal(body, request)
+	if err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if request.StatementRef == "" || len(request.Lines) == 0 {
+		context.Log("Reconciliation is invalid:", request.StatementRef)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	linesDB := models.NewLineDB(context.DB)
+	aerr := linesDB.Reconcile(request.StatementRef, request.Lines)
+	if aerr != nil {
+		context.Log("Error while reconciling lines:", aerr)
+		switch aerr.ErrorCode() {
+		case "lines.notfound":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case "lines.reconciled":
+			w.WriteHeader(http.StatusConflict)
+			return
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	return
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/RealImage/QLedger/models"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	LinesAPI          = "/v1/lines"
+	ReconcileLinesAPI = "/v1/lines/_reconcile"
+)
+
+type LinesSuite struct {
+	suite.Suite
+	context *ledgerContext.AppContext
+}
+
+func (ls *LinesSuite) SetupSuite() {
+	t := ls.T()
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(t, databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	}
+	log.Println("Successfully established connection to database.")
+	ls.context = &ledgerContext.AppContext{DB: db}
+
+	txnDB := models.NewTransactionDB(db)
+	for _, id := range []string{"rec1", "rec2"} {
+		done := txnDB.Transact(&models.Transaction{
+			ID: id,
+			Lines: []*models.TransactionLine{
+				{AccountID: "rec_bank", Delta: 100},
+				{AccountID: "rec_sales", Delta: -100},
+			},
+		})
+		assert.Equal(t, true, done, "Error creating test transaction")
+	}
+}
+
+func (ls *LinesSuite) getLines(query string) []models.Line {
+	t := ls.T()
+	handler := middlewares.ContextMiddleware(GetLines, ls.context)
+	req, err := http.NewRequest("GET", LinesAPI+"?"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+
+	var lines []models.Line
+	err = json.Unmarshal(rr.Body.Bytes(), &lines)
+	if err != nil {
+		t.Errorf("Invalid json response: %v", rr.Body.String())
+	}
+	return lines
+}
+
+func (ls *LinesSuite) reconcile(payload string) int {
+	handler := middlewares.ContextMiddleware(ReconcileLines, ls.context)
+	req, err := http.NewRequest("POST", ReconcileLinesAPI, bytes.NewBufferString(payload))
+	if err != nil {
+		ls.T().Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+func (ls *LinesSuite) TestReconcileLines() {
+	t := ls.T()
+
+	lines := ls.getLines("account=rec_bank&reconciled=false")
+	assert.Equal(t, 2, len(lines), "Unreconciled lines count doesn't match")
+	lineID := lines[0].ID
+	transactionID := lines[0].TransactionID
+
+	// Reconcile a line
+	payload := fmt.Sprintf(`{"statement_ref": "BANK-2017-01", "lines": [%d]}`, lineID)
+	assert.Equal(t, http.StatusOK, ls.reconcile(payload), "Invalid response code")
+
+	lines = ls.getLines("account=rec_bank&reconciled=false")
+	assert.Equal(t, 1, len(lines), "Unreconciled lines count doesn't match")
+	lines = ls.getLines("account=rec_bank&reconciled=true")
+	assert.Equal(t, 1, len(lines), "Reconciled lines count doesn't match")
+	assert.Equal(t, "BANK-2017-01", lines[0].StatementRef, "Invalid statement reference")
+	assert.NotEmpty(t, lines[0].ReconciledAt, "Missing reconciliation time")
+
+	// Lines can't be reconciled twice
+	payload = fmt.Sprintf(`{"statement_ref": "BANK-2017-02", "lines": [%d]}`, lineID)
+	assert.Equal(t, http.StatusConflict, ls.reconcile(payload), "Invalid response code")
+
+	// Missing lines
+	payload = `{"statement_ref": "BANK-2017-02", "lines": [-1]}`
+	assert.Equal(t, http.StatusNotFound, ls.reconcile(payload), "Invalid response code")
+
+	// Data of reconciled transactions is locked
+	handler := middlewares.ContextMiddleware(UpdateTransaction, ls.context)
+	payload = fmt.Sprintf(`{"id": "%s", "data": {"status": "edited"}}`, transactionID)
+	req, err := http.NewRequest("PUT", TransactionsAPI, bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code, "Invalid response code")
+}
+
+func (ls *LinesSuite) TestInvalidLinesQuery() {
+	t := ls.T()
+	handler := middlewares.ContextMiddleware(GetLines, ls.context)
+	for _, query := range []string{"", "account=rec_bank&reconciled=maybe"} {
+		req, err := http.NewRequest("GET", LinesAPI+"?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "Invalid response code")
+	}
+	assert.Equal(t, http.StatusBadRequest, ls.reconcile(`{"lines": [1]}`), "Invalid response code")
+}
+
+func (ls *LinesSuite) TestExportTransactions() {
+	t := ls.T()
+	handler := middlewares.ContextMiddleware(GetTransactionAction, ls.context)
+	req, err := http.NewRequest("GET", "/v1/transactions/_export?account=rec_bank&format=csv", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+	rows := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	assert.Equal(t, 3, len(rows), "Exported lines count doesn't match")
+	assert.Equal(t, "id,transaction_id,account,delta,currency,timestamp,data", rows[0], "Invalid CSV header")
+
+	req, err = http.NewRequest("GET", "/v1/transactions/_export?account=rec_sales&to=2000-01-01", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/x-ndjson")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+	assert.Equal(t, "", rr.Body.String(), "Lines before the range should not be exported")
+}
+
+func (ls *LinesSuite) TearDownSuite() {
+	log.Println("Cleaning up the test database")
+
+	t := ls.T()
+	_, err := ls.context.DB.Exec(`DELETE FROM lines`)
+	if err != nil {
+		t.Fatal("Error deleting lines:", err)
+	}
+	_, err = ls.context.DB.Exec(`DELETE FROM transactions`)
+	if err != nil {
+		t.Fatal("Error deleting transactions:", err)
+	}
+	_, err = ls.context.DB.Exec(`DELETE FROM accounts`)
+	if err != nil {
+		t.Fatal("Error deleting accounts:", err)
+	}
+}
+
+func TestLinesSuite(t *testing.T) {
+	suite.Run(t, new(LinesSuite))
+}
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+// merkleTreeLimit is the maximum number of transactions in a Merkle tree
+const merkleTreeLimit = 10000
+
+// MerkleAnchorURL is the URL of the external timestamping service the roots of the Merkle trees
+// are posted to. The roots are not anchored when it is empty.
+var MerkleAnchorURL string
+
+var merkleAnchorClient = &http.Client{Timeout: 30 * time.Second}
+
+// anchorMerkleTree posts the root of the tree to the timestamping service
+// and returns the receipt in its response
+func anchorMerkleTree(tree *models.MerkleTree) (string, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"tree_id":    tree.ID,
+		"root":       tree.Root,
+		"size":       tree.Size,
+		"created_at": tree.CreatedAt,
+	})
+	if err != nil {
+		return "", err
+	}
+	resp, err := merkleAnchorClient.Post(MerkleAnchorURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("Anchoring failed with status: %v", resp.Status)
+	}
+	receipt, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if len(bytes.TrimSpace(receipt)) == 0 {
+		return "", fmt.Errorf("Anchoring returned an empty receipt")
+	}
+	return strings.TrimSpace(string(receipt)), nil
+}
+
+// anchorMerkleTrees anchors the roots of the trees which are not anchored yet
+func anchorMerkleTrees(context *ledgerContext.AppContext) {
+	if MerkleAnchorURL == "" {
+		return
+	}
+	merkleDB := models.NewMerkleDB(context.DB)
+	trees, aerr := merkleDB.Unanchored()
+	if aerr != nil {
+		context.Log("Error while getting unanchored merkle trees:", aerr)
+		return
+	}
+	for _, tree := range trees {
+		receipt, err := anchorMerkleTree(tree)
+		if err != nil {
+			context.Log("Error while anchoring merkle tree:", tree.ID, err)
+			return
+		}
+		if aerr := merkleDB.SetAnchor(tree.ID, receipt); aerr != nil {
+			context.Log("Error while saving merkle tree anchor:", tree.ID, aerr)
+			return
+		}
+	}
+}
+
+// BuildMerkleTrees builds the trees over all the committed transactions which are not in any tree yet
+// and anchors their roots
+func BuildMerkleTrees(context *ledgerContext.AppContext) {
+	merkleDB := models.NewMerkleDB(context.DB)
+	for {
+		tree, aerr := merkleDB.Build(merkleTreeLimit)
+		if aerr != nil {
+			context.Log("Error while building merkle tree:", aerr)
+			break
+		}
+		if tree == nil || tree.Size < merkleTreeLimit {
+			break
+		}
+	}
+	anchorMerkleTrees(context)
+}
+
+// ScheduleMerkleTrees builds the trees of the transactions committed at every interval
+func ScheduleMerkleTrees(context *ledgerContext.AppContext, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		BuildMerkleTrees(context)
+	}
+}
+
+// GetMerkleTrees returns the Merkle trees, latest first
+func GetMerkleTrees(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	merkleDB := models.NewMerkleDB(context.DB)
+	trees, aerr := merkleDB.List()
+	if aerr != nil {
+		context.Log("Error while getting merkle trees:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(trees)
+	if err != nil {
+		context.Log("Error while parsing merkle trees:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// CreateMerkleTree builds a tree over the committed transactions which are not in any tree yet,
+// without waiting for the next scheduled build
+func CreateMerkleTree(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	merkleDB := models.NewMerkleDB(context.DB)
+	tree, aerr := merkleDB.Build(merkleTreeLimit)
+	if aerr != nil {
+		context.Log("Error while building merkle tree:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if tree == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	anchorMerkleTrees(context)
+	if anchored, aerr := merkleDB.GetTree(tree.ID); aerr == nil && anchored != nil {
+		tree = anchored
+	}
+
+	data, err := json.Marshal(tree)
+	if err != nil {
+		context.Log("Error while parsing merkle tree:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(data)
+	return
+}
+
+// GetTransactionProof returns the inclusion proof of a transaction in its Merkle tree
+func GetTransactionProof(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext, id string) {
+	merkleDB := models.NewMerkleDB(context.DB)
+	proof, aerr := merkleDB.GetProof(id)
+	if aerr != nil {
+		context.Log("Error while getting merkle proof:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if proof == nil {
+		context.Log("Transaction is not in a merkle tree:", id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	data, err := json.Marshal(proof)
+	if err != nil {
+		context.Log("Error while parsing merkle proof:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnchorMerkleTree(t *testing.T) {
+	var anchored map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&anchored)
+		w.Write([]byte("receipt-1\n"))
+	}))
+	defer server.Close()
+	MerkleAnchorURL = server.URL
+	defer func() { MerkleAnchorURL = "" }()
+
+	tree := &models.MerkleTree{ID: 1, Root: "abcd", Size: 2, CreatedAt: "2017-01-01 00:00:00.000"}
+	receipt, err := anchorMerkleTree(tree)
+	assert.Equal(t, nil, err, "Error while anchoring merkle tree")
+	assert.Equal(t, "receipt-1", receipt, "Invalid anchor receipt")
+	assert.Equal(t, "abcd", anchored["root"], "Root should be posted to the timestamping service")
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	MerkleAnchorURL = failing.URL
+	_, err = anchorMerkleTree(tree)
+	assert.NotEqual(t, nil, err, "Failed anchoring should return an error")
+}
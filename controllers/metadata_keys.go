@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+// GetMetadataKeys returns the estimated usage of the data keys of the accounts or transactions,
+// so that the operators can see which keys are stored before indexing them
+func GetMetadataKeys(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	entity := r.URL.Query().Get("entity")
+	if entity == "" {
+		entity = "transactions"
+	}
+	if _, ok := models.MetadataTables[entity]; !ok {
+		context.Log("Invalid entity of metadata keys:", entity)
+		writeErrorResponse(w, http.StatusBadRequest, models.MetadataEntityInvalidError(entity))
+		return
+	}
+
+	metadataKeysDB := models.NewMetadataKeysDB(context.DB)
+	usage, aerr := metadataKeysDB.Usage(entity)
+	if aerr != nil {
+		context.Log("Error while estimating metadata keys:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(usage)
+	if err != nil {
+		context.Log("Error while parsing metadata keys:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
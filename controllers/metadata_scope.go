@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"net/http"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+// checkMetadataWrite says whether the API key of the request can write all the keys of the data,
+// and otherwise responds with `403 Forbidden`
+func checkMetadataWrite(w http.ResponseWriter, context *ledgerContext.AppContext, data map[string]interface{}) bool {
+	if key := context.Metadata.UnwritableKey(data); key != "" {
+		context.Log("Data key can't be written by API key:", key)
+		writeErrorResponse(w, http.StatusForbidden, models.MetadataKeyForbiddenError("write", key))
+		return false
+	}
+	return true
+}
+
+// checkMetadataUpdate is like `checkMetadataWrite` for an update of the existing data, which leaves out
+// the keys the API key can't write. It returns the updated data along with those keys, as the API key
+// may not even read them.
+func checkMetadataUpdate(w http.ResponseWriter, context *ledgerContext.AppContext, existing, updated map[string]interface{}) (map[string]interface{}, bool) {
+	if !checkMetadataWrite(w, context, updated) {
+		return nil, false
+	}
+	return context.Metadata.KeepUnwritable(existing, updated), true
+}
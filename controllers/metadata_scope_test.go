@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckMetadataWrite(t *testing.T) {
+	context := &ledgerContext.AppContext{Metadata: &models.MetadataScope{Write: []string{"status"}}}
+	rr := httptest.NewRecorder()
+	assert.True(t, checkMetadataWrite(rr, context, map[string]interface{}{"status": "open"}), "Data should be writable")
+
+	assert.False(t, checkMetadataWrite(rr, context, map[string]interface{}{"card_last_four": "4242"}),
+		"Data should not be writable")
+	assert.Equal(t, http.StatusForbidden, rr.Code, "Invalid response code")
+	assert.JSONEq(t, `{"code": "metadata.write_forbidden", "message": "API key can't write the data key: card_last_four"}`,
+		rr.Body.String(), "Invalid response body")
+
+	assert.True(t, checkMetadataWrite(httptest.NewRecorder(), &ledgerContext.AppContext{},
+		map[string]interface{}{"card_last_four": "4242"}), "Requests without metadata scope should write all keys")
+}
+
+func TestCheckMetadataUpdate(t *testing.T) {
+	context := &ledgerContext.AppContext{Metadata: &models.MetadataScope{Read: []string{"status"}, Write: []string{"status"}}}
+	existing := map[string]interface{}{"status": "open", "card_last_four": "4242"}
+
+	data, ok := checkMetadataUpdate(httptest.NewRecorder(), context, existing, map[string]interface{}{"status": "closed"})
+	assert.True(t, ok, "Update should be allowed")
+	assert.Equal(t, map[string]interface{}{"status": "closed", "card_last_four": "4242"}, data,
+		"Unwritable keys should be kept")
+
+	rr := httptest.NewRecorder()
+	_, ok = checkMetadataUpdate(rr, context, existing, map[string]interface{}{"card_last_four": "1111"})
+	assert.False(t, ok, "Update should not be allowed")
+	assert.Equal(t, http.StatusForbidden, rr.Code, "Invalid response code")
+
+	// The unwritable keys can't be sent even unchanged, as it would reveal their values
+	rr = httptest.NewRecorder()
+	_, ok = checkMetadataUpdate(rr, context, existing, map[string]interface{}{"status": "closed", "card_last_four": "4242"})
+	assert.False(t, ok, "Update with unchanged unwritable key should not be allowed")
+	assert.Equal(t, http.StatusForbidden, rr.Code, "Invalid response code")
+}
+
+func TestScheduledTransactionMetadataScope(t *testing.T) {
+	context := &ledgerContext.AppContext{Metadata: &models.MetadataScope{Write: []string{"status"}}}
+	payload := `{
+		"id": "t001",
+		"post_at": "2099-01-01 00:00:00.000",
+		"lines": [{"account": "alice", "delta": 100}, {"account": "bob", "delta": -100}],
+		"data": {"card_last_four": "4242"}
+	}`
+	req := httptest.NewRequest("POST", "/v1/transactions", bytes.NewBufferString(payload))
+	rr := httptest.NewRecorder()
+	MakeTransaction(rr, req, context)
+	assert.Equal(t, http.StatusForbidden, rr.Code, "Scheduled transaction should be checked for unwritable keys")
+}
+
+func TestAddWebhookMetadataScope(t *testing.T) {
+	context := &ledgerContext.AppContext{Metadata: &models.MetadataScope{Read: []string{"status"}}}
+	payload := `{"id": "billing", "url": "https://example.com/hooks", "secret": "s3cret"}`
+	req := httptest.NewRequest("POST", "/v1/webhooks", bytes.NewBufferString(payload))
+	rr := httptest.NewRecorder()
+	AddWebhook(rr, req, context)
+	assert.Equal(t, http.StatusForbidden, rr.Code, "API key with metadata scope should not add webhooks")
+	assert.JSONEq(t, `{"code": "metadata.scope_forbidden", "message": "API key with metadata scope can't add webhooks"}`,
+		rr.Body.String(), "Invalid response body")
+}
+
+func TestImportLedgerMetadataScope(t *testing.T) {
+	var export bytes.Buffer
+	writer, err := models.NewExportWriter(&export, time.Date(2017, 6, 30, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err, "Error writing export header")
+	assert.Nil(t, writer.WriteAccount(&models.Account{ID: "alice", Data: map[string]interface{}{"status": "open"}}))
+	assert.Nil(t, writer.WriteAccount(&models.Account{ID: "bob", Data: map[string]interface{}{"card_last_four": "4242"}}))
+	assert.Nil(t, writer.Close(), "Error writing export manifest")
+
+	// The records are checked before any of them is imported
+	context := &ledgerContext.AppContext{Metadata: &models.MetadataScope{Write: []string{"status"}}}
+	req := httptest.NewRequest("POST", "/v1/admin/import", bytes.NewReader(export.Bytes()))
+	rr := httptest.NewRecorder()
+	ImportLedger(rr, req, context)
+	assert.Equal(t, http.StatusForbidden, rr.Code, "Export with unwritable keys should not be imported")
+	assert.JSONEq(t, `{"code": "metadata.write_forbidden", "message": "API key can't write the data key: card_last_four"}`,
+		rr.Body.String(), "Invalid response body")
+}
@@ -1,9 +1,42 @@
 package controllers
 
 import (
+	"encoding/json"
 	"net/http"
+	"sync/atomic"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+var (
+	// DrainDelay is the time the drain endpoint waits for the load balancers to stop sending requests to the server
+	DrainDelay = 5 * time.Second
+	// MaxReplicationLag is the replication lag of the DB beyond which the server isn't ready, if set
+	MaxReplicationLag time.Duration
 )
 
+// draining is set when the server is about to stop
+var draining int32
+
+// Drain marks the server as draining, so that it isn't ready for new requests
+func Drain() {
+	atomic.StoreInt32(&draining, 1)
+}
+
+// IsDraining says whether the server is draining
+func IsDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// ReadyResponse represents the readiness of the server, along with the reason it isn't ready
+type ReadyResponse struct {
+	Ready                 bool    `json:"ready"`
+	Reason                string  `json:"reason,omitempty"`
+	ReplicationLagSeconds float64 `json:"replication_lag_seconds"`
+}
+
 // Ping responds 200 OK when the server is up and healthy
 func Ping(w http.ResponseWriter, r *http.Request) {
 	// TODO: Should DB connection check be made while ping ?
@@ -12,3 +45,51 @@ func Ping(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(response))
 	return
 }
+
+// Ready responds 200 OK when the server can serve requests, or `503 Service Unavailable` when it is draining,
+// the DB is unavailable, or the replication lag of the DB is beyond the `MaxReplicationLag`
+func Ready(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	response := &ReadyResponse{Ready: true}
+	if IsDraining() {
+		response.Ready = false
+		response.Reason = "draining"
+	} else {
+		lag, aerr := models.ReplicationLag(context.DB)
+		switch {
+		case aerr != nil:
+			context.Log("Error while checking readiness:", aerr)
+			response.Ready = false
+			response.Reason = "database unavailable"
+		case MaxReplicationLag > 0 && lag > MaxReplicationLag:
+			response.Ready = false
+			response.Reason = "replication lag"
+		}
+		response.ReplicationLagSeconds = lag.Seconds()
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		context.Log("Error while parsing readiness:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if !response.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(data)
+	return
+}
+
+// DrainServer marks the server as draining, and responds after the `DrainDelay` so that a pre-stop hook
+// holds off the termination of the server until the load balancers stop sending requests to it
+func DrainServer(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	if !IsDraining() {
+		context.Log("Draining the server")
+		Drain()
+	}
+	time.Sleep(DrainDelay)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write([]byte(`{"draining": true}`))
+	return
+}
@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainServer(t *testing.T) {
+	defer atomic.StoreInt32(&draining, 0)
+	defer func(delay time.Duration) { DrainDelay = delay }(DrainDelay)
+	DrainDelay = 10 * time.Millisecond
+
+	handler := middlewares.ContextMiddleware(DrainServer, nil)
+	req, err := http.NewRequest("POST", "/v1/admin/drain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+	assert.True(t, time.Since(start) >= DrainDelay, "Drain should wait for the drain delay")
+	assert.True(t, IsDraining(), "Server should be draining")
+
+	// A draining server isn't ready, without checking the DB
+	handler = middlewares.ContextMiddleware(Ready, nil)
+	req, err = http.NewRequest("GET", "/ready", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "Invalid response code")
+	assert.JSONEq(t, `{"ready": false, "reason": "draining", "replication_lag_seconds": 0}`, rr.Body.String(), "Invalid response")
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/RealImage/QLedger/models"
+)
+
+// msearchQueriesLimit is the maximum number of searches of a multi search request
+const msearchQueriesLimit = 20
+
+// MultiSearchQuery is a single search of a multi search request
+type MultiSearchQuery struct {
+	// Namespace is either `accounts` or `transactions`
+	Namespace string `json:"namespace"`
+	// Search is the payload of the search, as sent to the search endpoint of the namespace
+	Search json.RawMessage `json:"search"`
+}
+
+// MultiSearchResult is the outcome of a single search of a multi search request, with either the results
+// or the error, along with the status which the search endpoint of the namespace would respond with
+type MultiSearchResult struct {
+	Status  int            `json:"status"`
+	Results interface{}    `json:"results,omitempty"`
+	Error   *ErrorResponse `json:"error,omitempty"`
+}
+
+// MultiSearch runs several searches of the accounts and transactions in a single request, and returns
+// the outcome of each search in the same order. A failed search doesn't affect the others.
+func MultiSearch(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	var queries []*MultiSearchQuery
+	err := json.NewDecoder(r.Body).Decode(&queries)
+	if err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(queries) == 0 || len(queries) > msearchQueriesLimit {
+		context.Log("Invalid number of searches:", len(queries))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// The searches are consistent with each other when they query the same pinned read snapshot
+	var tx *sql.Tx
+	if r.Header.Get(ReadSnapshotHeader) != "" {
+		var aerr ledgerError.ApplicationError
+		tx, aerr = beginRead(r, context)
+		if aerr != nil {
+			writeReadError(w, aerr)
+			return
+		}
+		defer tx.Rollback()
+	}
+
+	results := make([]*MultiSearchResult, len(queries))
+	for i, query := range queries {
+		if tx == nil {
+			results[i] = multiSearchQuery(context, nil, query)
+			continue
+		}
+		// A failed search, or one cancelled after its max execution time, aborts the DB transaction,
+		// so each search is isolated by a savepoint to keep the following searches on the snapshot.
+		// The searches only read, so the savepoint is always rolled back.
+		if _, err := tx.Exec("SAVEPOINT msearch"); err != nil {
+			context.Log("Error creating savepoint:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		results[i] = multiSearchQuery(context, tx, query)
+		if _, err := tx.Exec("ROLLBACK TO SAVEPOINT msearch"); err != nil {
+			context.Log("Error ending savepoint:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		context.Log("Error while parsing results:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// multiSearchQuery runs a single search of a multi search request, within the DB transaction if any
+func multiSearchQuery(context *ledgerContext.AppContext, tx *sql.Tx, query *MultiSearchQuery) *MultiSearchResult {
+	if query == nil {
+		return msearchError(http.StatusBadRequest, models.SearchNamespaceInvalidError(""))
+	}
+	engine, aerr := models.NewSearchEngine(context.DB, query.Namespace)
+	if aerr != nil {
+		return msearchError(http.StatusBadRequest, aerr)
+	}
+	engine.UseMetadataScope(context.Metadata)
+	if tx != nil {
+		engine.UseTx(tx)
+	}
+
+	found, aerr := engine.Query(string(query.Search))
+	if aerr != nil {
+		context.Log("Error while querying:", aerr)
+		switch aerr.ErrorCode() {
+		case "search.query.invalid":
+			return msearchError(http.StatusBadRequest, aerr)
+		case "metadata.read_forbidden":
+			return msearchError(http.StatusForbidden, aerr)
+		}
+		return &MultiSearchResult{Status: http.StatusInternalServerError}
+	}
+	if query.Namespace == models.SearchNamespaceAccounts {
+		if aerr := computeAccountFields(context, found); aerr != nil {
+			context.Log("Error while computing account fields:", aerr)
+			return &MultiSearchResult{Status: http.StatusInternalServerError}
+		}
+	}
+	return &MultiSearchResult{Status: http.StatusOK, Results: found}
+}
+
+// msearchError returns the outcome of a failed search with the error code, as the search endpoint
+// of the namespace would respond with
+func msearchError(status int, aerr ledgerError.ApplicationError) *MultiSearchResult {
+	return &MultiSearchResult{
+		Status: status,
+		Error:  &ErrorResponse{Code: aerr.ErrorCode(), Message: aerr.ErrorMessage()},
+	}
+}
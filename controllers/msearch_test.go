@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/RealImage/QLedger/models"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func multiSearch(t *testing.T, context *ledgerContext.AppContext, payload string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("POST", "/v1/_msearch", bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	middlewares.ContextMiddleware(MultiSearch, context).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestMultiSearchInvalid(t *testing.T) {
+	tooMany := "[" + strings.TrimSuffix(strings.Repeat(`{"namespace": "accounts", "search": {}},`, msearchQueriesLimit+1), ",") + "]"
+	for _, payload := range []string{`{}`, `[]`, tooMany} {
+		rr := multiSearch(t, nil, payload)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "Invalid response code")
+	}
+
+	// The searches of an invalid namespace fail on their own
+	rr := multiSearch(t, &ledgerContext.AppContext{}, `[{"namespace": "lines", "search": {}}, null]`)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+	var results []MultiSearchResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+		t.Fatalf("Invalid json response: %v", rr.Body.String())
+	}
+	if assert.Equal(t, 2, len(results), "Invalid count of results") {
+		for _, result := range results {
+			assert.Equal(t, http.StatusBadRequest, result.Status, "Invalid status")
+			assert.Equal(t, "search.namespace.invalid", result.Error.Code, "Invalid error code")
+		}
+	}
+}
+
+type MultiSearchSuite struct {
+	suite.Suite
+	context *ledgerContext.AppContext
+}
+
+func (ms *MultiSearchSuite) SetupSuite() {
+	t := ms.T()
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(t, databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	}
+	log.Println("Successfully established connection to database.")
+	ms.context = &ledgerContext.AppContext{DB: db}
+
+	transactionDB := models.NewTransactionDB(db)
+	transaction := &models.Transaction{
+		ID:   "msearch1",
+		Data: map[string]interface{}{"page": "dashboard"},
+		Lines: []*models.TransactionLine{
+			{AccountID: "msearch_alice", Delta: -100},
+			{AccountID: "msearch_bob", Delta: 100},
+		},
+	}
+	assert.True(t, transactionDB.Transact(transaction), "Error while posting transaction")
+}
+
+func (ms *MultiSearchSuite) TestMultiSearch() {
+	t := ms.T()
+	rr := multiSearch(t, ms.context, `[
+		{"namespace": "accounts", "search": {"query": {"must": {"fields": [{"id": {"like": "msearch_%"}}]}}}},
+		{"namespace": "transactions", "search": {"query": {"must": {"terms": [{"page": "dashboard"}]}}}},
+		{"namespace": "transactions", "search": {"query": {"must": {"unknown": []}}}}
+	]`)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+
+	var results []struct {
+		Status  int             `json:"status"`
+		Results json.RawMessage `json:"results"`
+		Error   *ErrorResponse  `json:"error"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+		t.Fatalf("Invalid json response: %v", rr.Body.String())
+	}
+	if !assert.Equal(t, 3, len(results), "Invalid count of results") {
+		return
+	}
+
+	var accounts []models.AccountResult
+	assert.Equal(t, http.StatusOK, results[0].Status, "Invalid status of accounts search")
+	assert.Nil(t, json.Unmarshal(results[0].Results, &accounts), "Invalid accounts results")
+	assert.Equal(t, 2, len(accounts), "Accounts count doesn't match")
+
+	var transactions []models.TransactionResult
+	assert.Equal(t, http.StatusOK, results[1].Status, "Invalid status of transactions search")
+	assert.Nil(t, json.Unmarshal(results[1].Results, &transactions), "Invalid transactions results")
+	if assert.Equal(t, 1, len(transactions), "Transactions count doesn't match") {
+		assert.Equal(t, "msearch1", transactions[0].ID, "Transaction ID doesn't match")
+	}
+
+	assert.Equal(t, http.StatusBadRequest, results[2].Status, "Invalid search should fail on its own")
+	if assert.NotNil(t, results[2].Error, "Missing error of invalid search") {
+		assert.Equal(t, "search.query.invalid", results[2].Error.Code, "Invalid error code")
+	}
+}
+
+func (ms *MultiSearchSuite) TestMultiSearchOnReadSnapshot() {
+	t := ms.T()
+	req, err := http.NewRequest("POST", "/v1/read_snapshots", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	middlewares.ContextMiddleware(PinReadSnapshot, ms.context).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code, "Invalid response code")
+	snapshot := &ReadSnapshot{}
+	if err := json.Unmarshal(rr.Body.Bytes(), snapshot); err != nil {
+		t.Fatalf("Invalid json response: %v", rr.Body.String())
+	}
+	defer readSnapshots.release(ms.context.LedgerID, snapshot.ID)
+
+	// The failing search doesn't abort the snapshot for the following search
+	req, err = http.NewRequest("POST", "/v1/_msearch", bytes.NewBufferString(`[
+		{"namespace": "accounts", "search": {"query": {"must": {"fields": [{"balance": {"gt": "many"}}]}}}},
+		{"namespace": "transactions", "search": {"query": {"must": {"terms": [{"page": "dashboard"}]}}}}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(ReadSnapshotHeader, snapshot.ID)
+	rr = httptest.NewRecorder()
+	middlewares.ContextMiddleware(MultiSearch, ms.context).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+
+	var results []MultiSearchResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+		t.Fatalf("Invalid json response: %v", rr.Body.String())
+	}
+	if assert.Equal(t, 2, len(results), "Invalid count of results") {
+		assert.Equal(t, http.StatusInternalServerError, results[0].Status, "Invalid status of failing search")
+		assert.Equal(t, http.StatusOK, results[1].Status, "Search after a failing search should succeed")
+	}
+}
+
+func (ms *MultiSearchSuite) TestMultiSearchTimeoutOnReadSnapshot() {
+	t := ms.T()
+	req, err := http.NewRequest("POST", "/v1/read_snapshots", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	middlewares.ContextMiddleware(PinReadSnapshot, ms.context).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code, "Invalid response code")
+	snapshot := &ReadSnapshot{}
+	if err := json.Unmarshal(rr.Body.Bytes(), snapshot); err != nil {
+		t.Fatalf("Invalid json response: %v", rr.Body.String())
+	}
+	defer readSnapshots.release(ms.context.LedgerID, snapshot.ID)
+
+	// The lines are locked, so that the search is cancelled after its max execution time
+	lock, err := ms.context.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Rollback()
+	if _, err := lock.Exec("LOCK TABLE lines IN ACCESS EXCLUSIVE MODE"); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err = http.NewRequest("POST", "/v1/_msearch", bytes.NewBufferString(`[
+		{"namespace": "transactions", "search": {"limit": 10, "max_execution_ms": 100, "query": {"must": {"terms": [{"page": "dashboard"}]}}}}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(ReadSnapshotHeader, snapshot.ID)
+	rr = httptest.NewRecorder()
+	middlewares.ContextMiddleware(MultiSearch, ms.context).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Timed out search should not fail the request")
+
+	var results []struct {
+		Status  int                `json:"status"`
+		Results *models.SearchPage `json:"results"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+		t.Fatalf("Invalid json response: %v", rr.Body.String())
+	}
+	if assert.Equal(t, 1, len(results), "Invalid count of results") {
+		assert.Equal(t, http.StatusOK, results[0].Status, "Invalid status of timed out search")
+		if assert.NotNil(t, results[0].Results, "Missing page of timed out search") {
+			assert.True(t, results[0].Results.Truncated, "Timed out search should be truncated")
+		}
+	}
+}
+
+func (ms *MultiSearchSuite) TearDownSuite() {
+	t := ms.T()
+	for _, q := range []string{
+		"DELETE FROM lines WHERE transaction_id LIKE 'msearch%'",
+		"DELETE FROM transactions WHERE id LIKE 'msearch%'",
+		"DELETE FROM accounts WHERE id LIKE 'msearch%'",
+	} {
+		if _, err := ms.context.DB.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMultiSearchSuite(t *testing.T) {
+	suite.Run(t, new(MultiSearchSuite))
+}
@@ -0,0 +1,308 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RealImage/QLedger/breaker"
+	ledgerContext "github.com/RealImage/QLedger/context"
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/RealImage/QLedger/metrics"
+	"github.com/RealImage/QLedger/models"
+)
+
+const (
+	// WebhookEventTransactionPosting is sent to the posting hooks before a transaction is posted
+	WebhookEventTransactionPosting = "transaction.posting"
+
+	// defaultPostingHookTimeout is the timeout of the hooks created without one
+	defaultPostingHookTimeout = time.Second
+	// maxPostingHookTimeout limits the time a hook can hold up the posting of a transaction
+	maxPostingHookTimeout = 10 * time.Second
+	// postingHooksTTL is the time the list of hooks is cached for, before it is read again from the DB
+	postingHooksTTL = 10 * time.Second
+
+	postingHookBreakerThreshold = 5
+	postingHookBreakerCooldown  = 30 * time.Second
+)
+
+// Results of the posting hook calls
+const (
+	postingHookApproved    = "approved"
+	postingHookRejected    = "rejected"
+	postingHookError       = "error"
+	postingHookCircuitOpen = "circuit_open"
+)
+
+var (
+	postingHookLatency = metrics.NewHistogramVec("qledger_posting_hook_latency_seconds",
+		"Latency of the posting hook calls.", nil, "tenant", "hook")
+	postingHookResults = metrics.NewCounterVec("qledger_posting_hook_results_total",
+		"Posting hook calls by result.", "tenant", "hook", "result")
+	_ = metrics.NewGaugeFunc("qledger_posting_hook_circuit_open",
+		"Whether the circuit breaker of the posting hook is open.", func(g *metrics.GaugeVec) {
+			for key, state := range postingHookBreakers.states() {
+				value := 0.0
+				if state == breaker.Open {
+					value = 1
+				}
+				g.Set(value, key.ledger, key.hook)
+			}
+		}, "tenant", "hook")
+)
+
+// postingHookKey identifies a posting hook of the ledger of a tenant, as the tenants can have hooks with the same ID
+type postingHookKey struct {
+	ledger string
+	hook   string
+}
+
+// postingHookBreakerRegistry holds the circuit breakers of the posting hooks on this server
+type postingHookBreakerRegistry struct {
+	mu       sync.Mutex
+	breakers map[postingHookKey]*breaker.Breaker
+}
+
+var postingHookBreakers = &postingHookBreakerRegistry{breakers: make(map[postingHookKey]*breaker.Breaker)}
+
+func (pb *postingHookBreakerRegistry) get(ledger string, id string) *breaker.Breaker {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	key := postingHookKey{ledger: ledger, hook: id}
+	b, ok := pb.breakers[key]
+	if !ok {
+		b = breaker.New(postingHookBreakerThreshold, postingHookBreakerCooldown)
+		pb.breakers[key] = b
+	}
+	return b
+}
+
+func (pb *postingHookBreakerRegistry) remove(ledger string, id string) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	delete(pb.breakers, postingHookKey{ledger: ledger, hook: id})
+}
+
+func (pb *postingHookBreakerRegistry) states() map[postingHookKey]string {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	states := make(map[postingHookKey]string, len(pb.breakers))
+	for key, b := range pb.breakers {
+		states[key] = b.State()
+	}
+	return states
+}
+
+// postingHookCache caches the lists of posting hooks of every DB, so that posting doesn't read them
+// on every transaction
+type postingHookCache struct {
+	mu      sync.Mutex
+	entries map[*sql.DB]*postingHookCacheEntry
+}
+
+type postingHookCacheEntry struct {
+	hooks    []*models.PostingHook
+	loadedAt time.Time
+}
+
+var postingHooks = &postingHookCache{entries: make(map[*sql.DB]*postingHookCacheEntry)}
+
+func (pc *postingHookCache) get(db *sql.DB) ([]*models.PostingHook, ledgerError.ApplicationError) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if entry, ok := pc.entries[db]; ok && time.Since(entry.loadedAt) < postingHooksTTL {
+		return entry.hooks, nil
+	}
+	postingHookDB := models.NewPostingHookDB(db)
+	hooks, aerr := postingHookDB.List()
+	if aerr != nil {
+		return nil, aerr
+	}
+	pc.entries[db] = &postingHookCacheEntry{hooks: hooks, loadedAt: time.Now()}
+	return hooks, nil
+}
+
+// invalidate makes the next posting on the DB read the hooks again
+func (pc *postingHookCache) invalidate(db *sql.DB) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	delete(pc.entries, db)
+}
+
+// postingHookResponse represents the optional JSON body of a hook rejecting a transaction
+type postingHookResponse struct {
+	Reason string `json:"reason"`
+}
+
+// callPostingHook posts the signed payload to the hook within its timeout, and says whether
+// the hook approved the transaction. A `2xx` response approves it, and a `4xx` response rejects it
+// with the optional reason in its body. Any other outcome is an error.
+func callPostingHook(hook *models.PostingHook, payload []byte) (bool, string, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, signWebhookPayload(hook.Secret, payload))
+	req.Header.Set(WebhookEventHeader, WebhookEventTransactionPosting)
+	req.Header.Set(WebhookEventVersionHeader, strconv.Itoa(eventVersion(WebhookEventTransactionPosting)))
+	client := &http.Client{Timeout: time.Duration(hook.TimeoutMS) * time.Millisecond}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return true, "", nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		response := &postingHookResponse{}
+		body, _ := ioutil.ReadAll(resp.Body)
+		json.Unmarshal(body, response)
+		return false, response.Reason, nil
+	}
+	return false, "", fmt.Errorf("Posting hook responded with status: %v", resp.Status)
+}
+
+// checkPostingHooks calls all the posting hooks in order, and returns an error if any of them rejects
+// the transaction. A hook which fails, times out or has an open circuit fails the transaction,
+// unless the hook fails open.
+func checkPostingHooks(context *ledgerContext.AppContext, transaction *models.Transaction) ledgerError.ApplicationError {
+	hooks, aerr := postingHooks.get(context.DB)
+	if aerr != nil {
+		context.Log("Error while getting posting hooks:", aerr)
+		return aerr
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(&WebhookPayload{
+		Event:     WebhookEventTransactionPosting,
+		Version:   eventVersion(WebhookEventTransactionPosting),
+		CreatedAt: time.Now().UTC().Format(models.LedgerTimestampLayout),
+		Data:      transaction,
+	})
+	if err != nil {
+		return models.JSONError(err)
+	}
+
+	for _, hook := range hooks {
+		b := postingHookBreakers.get(context.LedgerID, hook.ID)
+		if !b.Allow() {
+			postingHookResults.Inc(context.LedgerID, hook.ID, postingHookCircuitOpen)
+			if hook.FailOpen {
+				continue
+			}
+			return models.PostingHookUnavailableError(hook.ID)
+		}
+
+		start := time.Now()
+		approved, reason, err := callPostingHook(hook, payload)
+		postingHookLatency.Observe(time.Since(start).Seconds(), context.LedgerID, hook.ID)
+		if err != nil {
+			context.Log("Error while calling posting hook:", hook.ID, err)
+			b.Failure()
+			postingHookResults.Inc(context.LedgerID, hook.ID, postingHookError)
+			if hook.FailOpen {
+				continue
+			}
+			return models.PostingHookUnavailableError(hook.ID)
+		}
+		b.Success()
+		if !approved {
+			postingHookResults.Inc(context.LedgerID, hook.ID, postingHookRejected)
+			return models.PostingHookRejectedError(hook.ID, reason)
+		}
+		postingHookResults.Inc(context.LedgerID, hook.ID, postingHookApproved)
+	}
+	return nil
+}
+
+// GetPostingHooks returns all the posting hooks without their secrets, along with their circuit states
+func GetPostingHooks(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	postingHookDB := models.NewPostingHookDB(context.DB)
+	hooks, aerr := postingHookDB.List()
+	if aerr != nil {
+		context.Log("Error while listing posting hooks:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	for _, hook := range hooks {
+		hook.Secret = ""
+		hook.Circuit = postingHookBreakers.get(context.LedgerID, hook.ID).State()
+	}
+
+	data, err := json.Marshal(hooks)
+	if err != nil {
+		context.Log("Error while parsing posting hooks:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// AddPostingHook creates a posting hook with the `id`, `url`, `secret`, `timeout_ms` and `fail_open` from the request data
+func AddPostingHook(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	hook := &models.PostingHook{}
+	if err := json.NewDecoder(r.Body).Decode(hook); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if hook.TimeoutMS == 0 {
+		hook.TimeoutMS = int(defaultPostingHookTimeout / time.Millisecond)
+	}
+	u, err := url.Parse(hook.URL)
+	if !validWebhookID.MatchString(hook.ID) || err != nil || (u.Scheme != "http" && u.Scheme != "https") || hook.Secret == "" ||
+		hook.TimeoutMS < 0 || time.Duration(hook.TimeoutMS)*time.Millisecond > maxPostingHookTimeout {
+		context.Log("Invalid posting hook:", hook.ID)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	postingHookDB := models.NewPostingHookDB(context.DB)
+	if aerr := postingHookDB.Create(hook); aerr != nil {
+		context.Log("Error while creating posting hook:", aerr)
+		switch aerr.ErrorCode() {
+		case "posting_hook.exists":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	postingHooks.invalidate(context.DB)
+	w.WriteHeader(http.StatusCreated)
+	return
+}
+
+// DeletePostingHook removes the posting hook with the `id` query parameter
+func DeletePostingHook(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	id := r.URL.Query().Get("id")
+	postingHookDB := models.NewPostingHookDB(context.DB)
+	deleted, aerr := postingHookDB.Delete(id)
+	if aerr != nil {
+		context.Log("Error while deleting posting hook:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		context.Log("Posting hook doesn't exist:", id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	postingHooks.invalidate(context.DB)
+	postingHookBreakers.remove(context.LedgerID, id)
+	w.WriteHeader(http.StatusOK)
+	return
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RealImage/QLedger/breaker"
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallPostingHook(t *testing.T) {
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		if r.URL.Path == "/reject" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"reason": "sanctioned party"}`))
+			return
+		}
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	payload := []byte(`{"event":"transaction.posting"}`)
+	hook := &models.PostingHook{ID: "aml", URL: server.URL + "/approve", Secret: "secret", TimeoutMS: 100}
+	approved, _, err := callPostingHook(hook, payload)
+	assert.Equal(t, nil, err, "Error while calling posting hook")
+	assert.True(t, approved, "Transaction should be approved")
+	assert.Equal(t, signWebhookPayload("secret", payload), received.Header.Get(WebhookSignatureHeader), "Invalid signature")
+	assert.Equal(t, WebhookEventTransactionPosting, received.Header.Get(WebhookEventHeader), "Invalid event")
+
+	hook.URL = server.URL + "/reject"
+	approved, reason, err := callPostingHook(hook, payload)
+	assert.Equal(t, nil, err, "Rejection should not be an error")
+	assert.False(t, approved, "Transaction should be rejected")
+	assert.Equal(t, "sanctioned party", reason, "Invalid rejection reason")
+
+	hook.URL = server.URL + "/slow"
+	_, _, err = callPostingHook(hook, payload)
+	assert.NotEqual(t, nil, err, "Slow hook should time out")
+}
+
+func TestCheckPostingHooks(t *testing.T) {
+	calls := 0
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	context := &ledgerContext.AppContext{LedgerID: "acme"}
+	transaction := &models.Transaction{ID: "t1"}
+	hook := &models.PostingHook{ID: "check-hooks", URL: failing.URL, Secret: "secret", TimeoutMS: 100}
+	postingHooks.entries[context.DB] = &postingHookCacheEntry{hooks: []*models.PostingHook{hook}, loadedAt: time.Now()}
+	defer postingHooks.invalidate(context.DB)
+	defer postingHookBreakers.remove(context.LedgerID, hook.ID)
+
+	// A failing hook fails closed until its circuit opens, and is then not called
+	for i := 0; i < postingHookBreakerThreshold; i++ {
+		aerr := checkPostingHooks(context, transaction)
+		assert.Equal(t, "posting_hook.unavailable", aerr.ErrorCode(), "Failing hook should fail closed")
+	}
+	aerr := checkPostingHooks(context, transaction)
+	assert.Equal(t, "posting_hook.unavailable", aerr.ErrorCode(), "Open circuit should fail closed")
+	assert.Equal(t, postingHookBreakerThreshold, calls, "Hook should not be called while the circuit is open")
+	assert.Equal(t, float64(1), postingHookResults.Value(context.LedgerID, hook.ID, postingHookCircuitOpen), "Invalid circuit open count")
+	// The hook of another tenant with the same ID has its own circuit
+	assert.Equal(t, breaker.Closed, postingHookBreakers.get("globex", hook.ID).State(), "Circuit of another tenant should be closed")
+	postingHookBreakers.remove("globex", hook.ID)
+
+	// A hook failing open lets the transactions through
+	hook.FailOpen = true
+	assert.Equal(t, nil, checkPostingHooks(context, transaction), "Hook should fail open")
+}
@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+)
+
+// postmanSchema is the schema of the generated Postman collections, which are also imported by Insomnia
+const postmanSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// APIRoute represents an endpoint served by the ledger
+type APIRoute struct {
+	Method string
+	Path   string
+}
+
+// routeRegistry holds the routes of the server, which are listed in the Postman collection
+type routeRegistry struct {
+	mu     sync.Mutex
+	routes []APIRoute
+}
+
+var apiRoutes = &routeRegistry{}
+
+// RegisterRoute adds a route of the server to the Postman collection, by its path without the host prefix
+func RegisterRoute(method, path string) {
+	apiRoutes.mu.Lock()
+	defer apiRoutes.mu.Unlock()
+	for _, route := range apiRoutes.routes {
+		if route.Method == method && route.Path == path {
+			return
+		}
+	}
+	apiRoutes.routes = append(apiRoutes.routes, APIRoute{Method: method, Path: path})
+}
+
+func (rr *routeRegistry) list() []APIRoute {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	routes := make([]APIRoute, len(rr.routes))
+	copy(routes, rr.routes)
+	return routes
+}
+
+// postmanExample is an example request of a route. The path is given for the routes with a wildcard
+// to request one of their actions.
+type postmanExample struct {
+	Name  string
+	Path  string
+	Query string
+	Body  string
+}
+
+// postmanExamples are the example requests of the routes, by their method and path without the host prefix.
+// The routes without examples are requested without a query or body.
+var postmanExamples = map[string][]postmanExample{
+	"POST /v1/accounts": {{Body: `{"id": "alice", "data": {"product": "qw", "date": "2017-01-01"}}`}},
+	"PUT /v1/accounts":  {{Body: `{"id": "alice", "data": {"product": "qw", "date": "2017-01-01"}}`}},
+	"GET /v1/accounts":  {{Body: `{"query": {"must": {"fields": [{"product": {"eq": "qw"}}]}}}`}},
+	"POST /v1/accounts/_search": {
+		{Body: `{"query": {"must": {"fields": [{"product": {"eq": "qw"}}]}}}`},
+	},
+	"POST /v1/accounts/_import": {{Body: `{"id": "alice", "data": {"product": "qw"}}
+{"id": "bob", "data": {"product": "qw"}}`}},
+	"GET /v1/accounts/*action": {{Name: "Account", Path: "/v1/accounts/alice"}},
+	"POST /v1/transactions": {{Body: `{
+  "id": "abcd1234",
+  "data": {"tag_one": "val1"},
+  "lines": [
+    {"account": "alice", "delta": -100},
+    {"account": "bob", "delta": 100}
+  ]
+}`}},
+	"PUT /v1/transactions": {{Body: `{"id": "abcd1234", "data": {"tag_one": "val1"}}`}},
+	"GET /v1/transactions": {{Body: `{"query": {"must": {"terms": [{"tag_one": "val1"}]}}}`}},
+	"GET /v1/transactions/*action": {
+		{Name: "Export transactions", Path: "/v1/transactions/_export", Query: "format=csv"},
+		{Name: "Transaction signature", Path: "/v1/transactions/abcd1234/signature"},
+		{Name: "Transaction proof", Path: "/v1/transactions/abcd1234/proof"},
+		{Name: "Transaction", Path: "/v1/transactions/abcd1234"},
+	},
+	"POST /v1/transactions/*action": {
+		{Name: "Search transactions", Path: "/v1/transactions/_search",
+			Body: `{"query": {"must": {"terms": [{"tag_one": "val1"}]}}}`},
+		{Name: "Bulk transactions", Path: "/v1/transactions/_bulk",
+			Body: `[{"id": "abcd1235", "lines": [{"account": "alice", "delta": -100}, {"account": "bob", "delta": 100}]}]`},
+		{Name: "Reverse transaction", Path: "/v1/transactions/abcd1234/reverse"},
+	},
+	"POST /v1/_msearch": {{Body: `[
+  {"namespace": "accounts", "search": {"query": {"must": {"fields": [{"product": {"eq": "qw"}}]}}}},
+  {"namespace": "transactions", "search": {"query": {"must": {"terms": [{"tag_one": "val1"}]}}, "limit": 10}}
+]`}},
+	"POST /v1/transfers": {{Body: `{"id": "xfer1234", "from": "alice", "to": "bob", "amount": 100}`}},
+	"POST /v1/allocations": {{Body: `{
+  "id": "alloc1234",
+  "from": "revenue",
+  "amount": 100,
+  "to": [{"account": "alice", "weight": 1}, {"account": "bob", "weight": 2}]
+}`}},
+	"GET /v1/scheduled_transactions":          {{Query: "status=pending"}},
+	"DELETE /v1/scheduled_transactions":       {{Query: "id=abcd1234"}},
+	"GET /v1/lines":                           {{Query: "account=alice&reconciled=false"}},
+	"POST /v1/lines/_reconcile":               {{Body: `{"statement_ref": "BANK-2017-01", "lines": [42, 43]}`}},
+	"GET /v1/events/schemas":                  {{Query: "event=transaction.created"}},
+	"GET /v1/webhooks/deliveries":             {{Query: "status=failed"}},
+	"POST /v1/webhooks":                       {{Body: `{"id": "billing", "url": "https://example.com/ledger", "secret": "secret"}`}},
+	"DELETE /v1/webhooks":                     {{Query: "id=billing"}},
+	"POST /v1/webhooks/_replay":               {{Body: `{"deliveries": []}`}},
+	"POST /v1/webhooks/_discard":              {{Body: `{"deliveries": []}`}},
+	"POST /v1/categorization_rules":           {{Body: `{"id": "groceries", "category": "groceries", "data": {"merchant_type": "grocery"}}`}},
+	"DELETE /v1/categorization_rules":         {{Query: "id=groceries"}},
+	"POST /v1/categorization_rules/_backfill": {{Body: `{"all": false}`}},
+	"POST /v1/routing_rules": {
+		{Body: `{"id": "merchant_payable", "pattern": "merchant:{merchant_id}:payable", "lookup": {"merchant_id": "{merchant_id}", "kind": "payable"}}`},
+	},
+	"DELETE /v1/routing_rules":   {{Query: "id=merchant_payable"}},
+	"POST /v1/cache_policies":    {{Body: `{"id": "system", "prefix": "system:", "max_age_seconds": 60}`}},
+	"DELETE /v1/cache_policies":  {{Query: "id=system"}},
+	"GET /v1/reports/categories": {{Query: "account=alice&from=2017-01-01&to=2017-01-31"}},
+	"POST /v1/computed_fields":   {{Body: `{"name": "days_idle", "function": "days_since_last_activity"}`}},
+	"DELETE /v1/computed_fields": {{Query: "name=days_idle"}},
+	"POST /v1/posting_hooks": {
+		{Body: `{"id": "risk", "url": "https://example.com/approve", "secret": "secret", "timeout_ms": 500}`},
+	},
+	"DELETE /v1/posting_hooks":       {{Query: "id=risk"}},
+	"PUT /v1/idempotency":            {{Body: `{"window_seconds": 86400, "on_mismatch": "reject"}`}},
+	"PUT /v1/retention":              {{Body: `{"webhook_deliveries_days": 30, "scheduled_transactions_days": 90}`}},
+	"DELETE /v1/keys":                {{Query: "id=billing-2017"}},
+	"POST /v1/snapshots":             {{Body: `{"name": "close_2017_06_30"}`}},
+	"DELETE /v1/read_snapshots":      {{Query: "id=00000003-0000001B-1"}},
+	"POST /v1/admin/ledgers":         {{Body: `{"id": "acme", "data": {"plan": "standard"}, "template": "marketplace"}`}},
+	"GET /v1/admin/api_keys":         {{Query: "ledger=acme"}},
+	"POST /v1/admin/api_keys":        {{Body: `{"ledger": "acme", "metadata": {"read": ["order_id"], "write": []}}`}},
+	"DELETE /v1/admin/api_keys":      {{Query: "id=key1"}},
+	"POST /v1/admin/clone":           {{Body: `{"target": "staging"}`}},
+	"GET /v1/admin/metadata-keys":    {{Query: "entity=transactions"}},
+	"POST /v1/admin/region/_promote": {{Body: `{"force": false}`}},
+	"POST /v1/admin/region/_fence":   {{Body: `{"epoch": 2, "primary_region": "eu-west-1"}`}},
+}
+
+// PostmanCollection represents a Postman collection of the v2.1 schema
+type PostmanCollection struct {
+	Info     map[string]string  `json:"info"`
+	Auth     *PostmanAuth       `json:"auth"`
+	Variable []*PostmanVariable `json:"variable"`
+	Item     []*PostmanItem     `json:"item"`
+}
+
+// PostmanAuth represents the authentication of the requests of a collection
+type PostmanAuth struct {
+	Type   string             `json:"type"`
+	APIKey []*PostmanVariable `json:"apikey"`
+}
+
+// PostmanVariable represents a key and value, such as a collection variable or a query parameter
+type PostmanVariable struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Type  string `json:"type,omitempty"`
+}
+
+// PostmanItem represents a folder of requests, or a request
+type PostmanItem struct {
+	Name    string          `json:"name"`
+	Item    []*PostmanItem  `json:"item,omitempty"`
+	Request *PostmanRequest `json:"request,omitempty"`
+}
+
+// PostmanRequest represents the request of an item
+type PostmanRequest struct {
+	Method string             `json:"method"`
+	Header []*PostmanVariable `json:"header"`
+	URL    *PostmanURL        `json:"url"`
+	Body   *PostmanBody       `json:"body,omitempty"`
+}
+
+// PostmanURL represents the URL of a request
+type PostmanURL struct {
+	Raw   string             `json:"raw"`
+	Host  []string           `json:"host"`
+	Path  []string           `json:"path"`
+	Query []*PostmanVariable `json:"query,omitempty"`
+}
+
+// PostmanBody represents the raw body of a request
+type PostmanBody struct {
+	Mode string `json:"mode"`
+	Raw  string `json:"raw"`
+}
+
+// postmanRequest returns the request of the example, with the path relative to the `baseUrl` variable
+func postmanRequest(method, path string, example postmanExample) *PostmanRequest {
+	request := &PostmanRequest{
+		Method: method,
+		Header: []*PostmanVariable{},
+		URL: &PostmanURL{
+			Raw:  "{{baseUrl}}" + path,
+			Host: []string{"{{baseUrl}}"},
+			Path: strings.Split(strings.Trim(path, "/"), "/"),
+		},
+	}
+	if example.Query != "" {
+		request.URL.Raw += "?" + example.Query
+		query, _ := url.ParseQuery(example.Query)
+		keys := make([]string, 0, len(query))
+		for key := range query {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			request.URL.Query = append(request.URL.Query, &PostmanVariable{Key: key, Value: query.Get(key)})
+		}
+	}
+	if example.Body != "" {
+		request.Header = append(request.Header, &PostmanVariable{Key: "Content-Type", Value: "application/json"})
+		request.Body = &PostmanBody{Mode: "raw", Raw: example.Body}
+	}
+	return request
+}
+
+// NewPostmanCollection returns the collection of the routes, with the requests grouped in folders
+// by the resource of their path, and authenticated by the `token` variable
+func NewPostmanCollection(routes []APIRoute, baseURL string) *PostmanCollection {
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	var folders []*PostmanItem
+	folderIndex := make(map[string]*PostmanItem)
+	for _, route := range routes {
+		path := route.Path
+		if strings.HasPrefix(path, "/debug/") {
+			continue
+		}
+		// Requests are grouped by the resource following the version, such as `transactions` or `admin`
+		segments := strings.Split(strings.Trim(path, "/"), "/")
+		resource := segments[0]
+		if resource == "v1" && len(segments) > 1 {
+			resource = segments[1]
+		}
+		folder, ok := folderIndex[resource]
+		if !ok {
+			folder = &PostmanItem{Name: resource}
+			folderIndex[resource] = folder
+			folders = append(folders, folder)
+		}
+
+		examples, ok := postmanExamples[route.Method+" "+path]
+		if !ok {
+			if strings.Contains(path, "*") {
+				continue
+			}
+			examples = []postmanExample{{}}
+		}
+		for _, example := range examples {
+			examplePath := path
+			if example.Path != "" {
+				examplePath = example.Path
+			}
+			name := example.Name
+			if name == "" {
+				name = route.Method + " " + examplePath
+			}
+			folder.Item = append(folder.Item, &PostmanItem{
+				Name:    name,
+				Request: postmanRequest(route.Method, examplePath, example),
+			})
+		}
+	}
+	sort.SliceStable(folders, func(i, j int) bool { return folders[i].Name < folders[j].Name })
+
+	return &PostmanCollection{
+		Info: map[string]string{"name": "QLedger", "schema": postmanSchema},
+		Auth: &PostmanAuth{
+			Type: "apikey",
+			APIKey: []*PostmanVariable{
+				{Key: "key", Value: "Authorization", Type: "string"},
+				{Key: "value", Value: "{{token}}", Type: "string"},
+				{Key: "in", Value: "header", Type: "string"},
+			},
+		},
+		Variable: []*PostmanVariable{
+			{Key: "baseUrl", Value: baseURL},
+			{Key: "token", Value: ""},
+		},
+		Item: folders,
+	}
+}
+
+// GetPostmanCollection returns the Postman collection of the API served by the server,
+// with the `baseUrl` of the request host and host prefix
+func GetPostmanCollection(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	hostPrefix := strings.TrimSuffix(r.URL.Path, "/v1/admin/postman")
+	collection := NewPostmanCollection(apiRoutes.list(), scheme+"://"+r.Host+hostPrefix)
+	data, err := json.MarshalIndent(collection, "", "  ")
+	if err != nil {
+		context.Log("Error while parsing Postman collection:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="qledger.postman_collection.json"`)
+	w.Write(data)
+	return
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPostmanCollection(t *testing.T) {
+	routes := []APIRoute{
+		{Method: "POST", Path: "/v1/transactions"},
+		{Method: "GET", Path: "/v1/transactions/*action"},
+		{Method: "GET", Path: "/v1/unknown/*action"},
+		{Method: "GET", Path: "/debug/pprof/*profile"},
+		{Method: "GET", Path: "/ping"},
+	}
+	collection := NewPostmanCollection(routes, "http://localhost:7000/ledger")
+	assert.Equal(t, postmanSchema, collection.Info["schema"], "Invalid collection schema")
+	assert.Equal(t, "http://localhost:7000/ledger", collection.Variable[0].Value, "Invalid base URL")
+	assert.Equal(t, "{{token}}", collection.Auth.APIKey[1].Value, "Invalid auth")
+
+	if !assert.Equal(t, 3, len(collection.Item), "Invalid folders") {
+		return
+	}
+	assert.Equal(t, "ping", collection.Item[0].Name, "Invalid folder")
+	assert.Equal(t, "transactions", collection.Item[1].Name, "Invalid folder")
+	assert.Equal(t, "unknown", collection.Item[2].Name, "Invalid folder")
+	assert.Equal(t, 0, len(collection.Item[2].Item), "Wildcard route without examples should be skipped")
+
+	// The wildcard route is requested for every action
+	items := collection.Item[1].Item
+	if !assert.Equal(t, 5, len(items), "Invalid transaction requests") {
+		return
+	}
+	export := items[1].Request
+	assert.Equal(t, "GET", export.Method, "Invalid method")
+	assert.Equal(t, "{{baseUrl}}/v1/transactions/_export?format=csv", export.URL.Raw, "Invalid URL")
+	assert.Equal(t, []string{"v1", "transactions", "_export"}, export.URL.Path, "Invalid URL path")
+	assert.Equal(t, "csv", export.URL.Query[0].Value, "Invalid URL query")
+
+	post := items[0].Request
+	assert.Equal(t, "POST", post.Method, "Invalid method")
+	if assert.NotNil(t, post.Body, "Missing example body") {
+		assert.True(t, json.Valid([]byte(post.Body.Raw)), "Example body should be JSON")
+	}
+}
+
+func TestPostmanExamples(t *testing.T) {
+	for route, examples := range postmanExamples {
+		for _, example := range examples {
+			if example.Body == "" || route == "POST /v1/accounts/_import" {
+				continue
+			}
+			assert.True(t, json.Valid([]byte(example.Body)), "Example body should be JSON: %v", route)
+		}
+	}
+}
+
+func TestGetPostmanCollection(t *testing.T) {
+	RegisterRoute("GET", "/ping")
+	handler := middlewares.ContextMiddleware(GetPostmanCollection, nil)
+	req, err := http.NewRequest("GET", "/ledger/v1/admin/postman", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "ledger.example.com"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+
+	collection := &PostmanCollection{}
+	if err := json.Unmarshal(rr.Body.Bytes(), collection); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "http://ledger.example.com/ledger", collection.Variable[0].Value, "Invalid base URL")
+}
@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/RealImage/QLedger/metrics"
+	"github.com/RealImage/QLedger/models"
+)
+
+// Quotas of the clients
+const (
+	QuotaAccounts     = "accounts"
+	QuotaTransactions = "transactions"
+)
+
+var quotaRejections = metrics.NewCounterVec("qledger_quota_rejections_total",
+	"Requests rejected for exceeding the quota of their client.", "client", "quota")
+
+// Quota is the number of accounts and transactions a client can create per period,
+// where zero is unlimited
+type Quota struct {
+	Accounts     int `json:"accounts"`
+	Transactions int `json:"transactions"`
+}
+
+// QuotaSettings are the default quota of the clients, along with the quotas of specific clients
+type QuotaSettings struct {
+	Default Quota
+	Clients map[string]Quota
+	Period  time.Duration
+}
+
+// ParseClientQuotas returns the quotas by client from a list in the format `token:100:10000,key:9f86d081:0:500000`,
+// where the clients are the credentials, and the numbers are the accounts and the transactions
+func ParseClientQuotas(value string) (map[string]Quota, error) {
+	clients := make(map[string]Quota)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		// The client may contain colons itself, such as the `key:` credentials
+		parts := strings.Split(item, ":")
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("Invalid client quota: %v", item)
+		}
+		client := strings.TrimSpace(strings.Join(parts[:len(parts)-2], ":"))
+		parts = parts[len(parts)-2:]
+		if client == "" {
+			return nil, fmt.Errorf("Invalid client quota: %v", item)
+		}
+		accounts, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil || accounts < 0 {
+			return nil, fmt.Errorf("Invalid client quota: %v", item)
+		}
+		transactions, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || transactions < 0 {
+			return nil, fmt.Errorf("Invalid client quota: %v", item)
+		}
+		clients[client] = Quota{Accounts: accounts, Transactions: transactions}
+	}
+	return clients, nil
+}
+
+// QuotaUsage represents the accounts and transactions created by a client in the current period
+type QuotaUsage struct {
+	Client       string `json:"client"`
+	Accounts     int    `json:"accounts"`
+	Transactions int    `json:"transactions"`
+	Quota        Quota  `json:"quota"`
+	Reset        string `json:"reset"`
+}
+
+// quotaPeriod counts the accounts and transactions of a client in the current period
+type quotaPeriod struct {
+	start        time.Time
+	accounts     int
+	transactions int
+}
+
+// quotaTracker enforces the quotas of the clients in fixed periods since the start of the server
+type quotaTracker struct {
+	mu       sync.Mutex
+	settings QuotaSettings
+	clients  map[string]*quotaPeriod
+	now      func() time.Time
+}
+
+var quotas = &quotaTracker{settings: QuotaSettings{Period: 24 * time.Hour}, clients: make(map[string]*quotaPeriod), now: time.Now}
+
+// SetQuotas replaces the quotas of the clients. The usage counted so far is kept, unless the period changes.
+func SetQuotas(settings QuotaSettings) {
+	quotas.mu.Lock()
+	defer quotas.mu.Unlock()
+	if settings.Period != quotas.settings.Period {
+		quotas.clients = make(map[string]*quotaPeriod)
+	}
+	quotas.settings = settings
+}
+
+// quotaOf returns the quota of the client
+func (q *quotaTracker) quotaOf(client string) Quota {
+	if quota, ok := q.settings.Clients[client]; ok {
+		return quota
+	}
+	return q.settings.Default
+}
+
+// enabled says whether any client has a quota, so that the new accounts are counted only when needed
+func (q *quotaTracker) enabled() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.settings.Default != (Quota{}) {
+		return true
+	}
+	for _, quota := range q.settings.Clients {
+		if quota != (Quota{}) {
+			return true
+		}
+	}
+	return false
+}
+
+// period returns the current period of the client
+func (q *quotaTracker) period(client string) *quotaPeriod {
+	now := q.now()
+	p, ok := q.clients[client]
+	if !ok || now.Sub(p.start) >= q.settings.Period {
+		p = &quotaPeriod{start: now}
+		q.clients[client] = p
+	}
+	return p
+}
+
+// reserve counts the accounts and transactions to be created by the client, unless they exceed its quota.
+// It returns the quota exceeded, along with the time until the period resets.
+func (q *quotaTracker) reserve(client string, accounts, transactions int) (ledgerError.ApplicationError, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	quota := q.quotaOf(client)
+	if quota == (Quota{}) {
+		return nil, 0
+	}
+	p := q.period(client)
+	reset := p.start.Add(q.settings.Period).Sub(q.now())
+	if quota.Accounts > 0 && accounts > 0 && p.accounts+accounts > quota.Accounts {
+		quotaRejections.Inc(client, QuotaAccounts)
+		return models.QuotaExceededError(client, QuotaAccounts, quota.Accounts, q.settings.Period), reset
+	}
+	if quota.Transactions > 0 && transactions > 0 && p.transactions+transactions > quota.Transactions {
+		quotaRejections.Inc(client, QuotaTransactions)
+		return models.QuotaExceededError(client, QuotaTransactions, quota.Transactions, q.settings.Period), reset
+	}
+	p.accounts += accounts
+	p.transactions += transactions
+	return nil, 0
+}
+
+// release uncounts the reserved accounts and transactions which weren't created
+func (q *quotaTracker) release(client string, accounts, transactions int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	p, ok := q.clients[client]
+	if !ok {
+		return
+	}
+	p.accounts -= accounts
+	if p.accounts < 0 {
+		p.accounts = 0
+	}
+	p.transactions -= transactions
+	if p.transactions < 0 {
+		p.transactions = 0
+	}
+}
+
+// list returns the usage of the clients in their current periods, ordered by client
+func (q *quotaTracker) list() []QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := q.now()
+	list := make([]QuotaUsage, 0, len(q.clients))
+	for client, p := range q.clients {
+		if now.Sub(p.start) >= q.settings.Period {
+			continue
+		}
+		list = append(list, QuotaUsage{
+			Client:       client,
+			Accounts:     p.accounts,
+			Transactions: p.transactions,
+			Quota:        q.quotaOf(client),
+			Reset:        p.start.Add(q.settings.Period).UTC().Format(models.LedgerTimestampLayout),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Client < list[j].Client })
+	return list
+}
+
+// writeQuotaError writes the `429 Too Many Requests` response of an exceeded quota,
+// with the seconds until the period resets in the `Retry-After` header
+func writeQuotaError(w http.ResponseWriter, aerr ledgerError.ApplicationError, reset time.Duration) {
+	// Round up, so that clients don't retry before the reset
+	w.Header().Set("Retry-After", strconv.Itoa(int((reset+time.Second-1)/time.Second)))
+	writeErrorResponse(w, http.StatusTooManyRequests, aerr)
+}
+
+// reserveTransactionQuota counts a transaction and the accounts which it would create against the quotas
+// of the client. It returns the number of new accounts reserved, which are released if the transaction
+// isn't created.
+func reserveTransactionQuota(context *ledgerContext.AppContext, client string, accountIDs []string) (int, ledgerError.ApplicationError, time.Duration, ledgerError.ApplicationError) {
+	if !quotas.enabled() {
+		return 0, nil, 0, nil
+	}
+	accountsDB := models.NewAccountDB(context.DB)
+	accounts, aerr := accountsDB.CountMissing(accountIDs)
+	if aerr != nil {
+		return 0, nil, 0, aerr
+	}
+	qerr, reset := quotas.reserve(client, accounts, 1)
+	return accounts, qerr, reset, nil
+}
+
+// GetQuotas returns the usage of the quotas by the clients in their current periods
+func GetQuotas(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	data, err := json.Marshal(quotas.list())
+	if err != nil {
+		context.Log("Error while parsing quotas:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseClientQuotas(t *testing.T) {
+	clients, err := ParseClientQuotas(" token:0:0, key:9f86d081884c7d65:5000:1000000 ")
+	assert.Nil(t, err, "Error while parsing client quotas")
+	assert.Equal(t, map[string]Quota{
+		"token":                {},
+		"key:9f86d081884c7d65": {Accounts: 5000, Transactions: 1000000},
+	}, clients, "Invalid client quotas")
+
+	for _, value := range []string{"billing:5000", "billing:-1:10", ":1:1", "billing:many:10"} {
+		_, err := ParseClientQuotas(value)
+		assert.NotNil(t, err, "Client quotas should be invalid: %v", value)
+	}
+}
+
+func TestQuotaTracker(t *testing.T) {
+	now := time.Date(2017, 1, 1, 13, 0, 0, 0, time.UTC)
+	tracker := &quotaTracker{
+		settings: QuotaSettings{
+			Default: Quota{Accounts: 2, Transactions: 3},
+			Clients: map[string]Quota{"importer": {}},
+			Period:  time.Hour,
+		},
+		clients: make(map[string]*quotaPeriod),
+		now:     func() time.Time { return now },
+	}
+
+	aerr, _ := tracker.reserve("billing", 2, 1)
+	assert.Nil(t, aerr, "Accounts within quota should be reserved")
+	aerr, reset := tracker.reserve("billing", 1, 1)
+	if assert.NotNil(t, aerr, "Accounts over quota should be rejected") {
+		assert.Equal(t, "quota.accounts_exceeded", aerr.ErrorCode(), "Invalid error code")
+		assert.Equal(t, time.Hour, reset, "Invalid reset")
+	}
+	assert.Equal(t, float64(1), quotaRejections.Value("billing", QuotaAccounts), "Invalid rejections metric")
+
+	// Existing accounts don't count against the quota of accounts
+	aerr, _ = tracker.reserve("billing", 0, 1)
+	assert.Nil(t, aerr, "Transaction within quota should be reserved")
+	tracker.release("billing", 0, 1)
+	aerr, _ = tracker.reserve("billing", 0, 2)
+	assert.Nil(t, aerr, "Released transactions should be reserved again")
+	aerr, _ = tracker.reserve("billing", 0, 1)
+	if assert.NotNil(t, aerr, "Transactions over quota should be rejected") {
+		assert.Equal(t, "quota.transactions_exceeded", aerr.ErrorCode(), "Invalid error code")
+	}
+
+	// The clients without a quota are unlimited
+	aerr, _ = tracker.reserve("importer", 100, 100)
+	assert.Nil(t, aerr, "Client without quota should not be limited")
+
+	list := tracker.list()
+	if assert.Equal(t, 1, len(list), "Invalid count of clients") {
+		assert.Equal(t, QuotaUsage{
+			Client:       "billing",
+			Accounts:     2,
+			Transactions: 3,
+			Quota:        Quota{Accounts: 2, Transactions: 3},
+			Reset:        "2017-01-01 14:00:00.000",
+		}, list[0], "Invalid usage")
+	}
+
+	// The usage is reset in the next period
+	now = now.Add(time.Hour)
+	aerr, _ = tracker.reserve("billing", 2, 3)
+	assert.Nil(t, aerr, "Quota should be reset in the next period")
+}
+
+func TestWriteQuotaError(t *testing.T) {
+	rr := httptest.NewRecorder()
+	aerr, _ := (&quotaTracker{
+		settings: QuotaSettings{Default: Quota{Accounts: 1}, Period: time.Minute},
+		clients:  make(map[string]*quotaPeriod),
+		now:      time.Now,
+	}).reserve("anonymous", 2, 0)
+	writeQuotaError(rr, aerr, 1500*time.Millisecond)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code, "Invalid response code")
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"), "Retry-After should round up")
+	assert.JSONEq(t, `{"code": "quota.accounts_exceeded", "message": "Quota of 1 accounts per 1m0s exceeded by client: anonymous"}`,
+		rr.Body.String(), "Invalid response body")
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/RealImage/QLedger/models"
+)
+
+// ReadSnapshotHeader is the request header with the ID of the pinned read snapshot to query
+const ReadSnapshotHeader = "X-Ledger-Snapshot"
+
+const (
+	// defaultReadSnapshotTTL is the time a read snapshot is pinned for, unless the request sets it
+	defaultReadSnapshotTTL = 5 * time.Minute
+	// maxReadSnapshotTTL limits the time a read snapshot holds back the cleanup of old row versions
+	maxReadSnapshotTTL = time.Hour
+	// maxReadSnapshots limits the read snapshots pinned by each tenant on a server, as each holds a DB connection
+	maxReadSnapshots = 10
+)
+
+// ReadSnapshot represents a pinned read snapshot of the ledger
+type ReadSnapshot struct {
+	ID        string `json:"id"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at"`
+	tx        *sql.Tx
+	timer     *time.Timer
+}
+
+// readSnapshotRegistry keeps the DB transactions of the read snapshots pinned by this server open,
+// by the ledger of the tenant which pinned them
+type readSnapshotRegistry struct {
+	mu        sync.Mutex
+	snapshots map[string]map[string]*ReadSnapshot
+}
+
+var readSnapshots = &readSnapshotRegistry{snapshots: make(map[string]map[string]*ReadSnapshot)}
+
+// add pins the read snapshot of the ledger, or returns nil when the ledger has pinned the most snapshots already
+func (rs *readSnapshotRegistry) add(ledger string, id string, tx *sql.Tx, ttl time.Duration) *ReadSnapshot {
+	now := time.Now().UTC()
+	snapshot := &ReadSnapshot{
+		ID:        id,
+		CreatedAt: now.Format(models.LedgerTimestampLayout),
+		ExpiresAt: now.Add(ttl).Format(models.LedgerTimestampLayout),
+		tx:        tx,
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if len(rs.snapshots[ledger]) >= maxReadSnapshots {
+		return nil
+	}
+	if rs.snapshots[ledger] == nil {
+		rs.snapshots[ledger] = make(map[string]*ReadSnapshot)
+	}
+	rs.snapshots[ledger][id] = snapshot
+	snapshot.timer = time.AfterFunc(ttl, func() {
+		if rs.release(ledger, id) {
+			log.Println("Read snapshot expired:", id)
+		}
+	})
+	return snapshot
+}
+
+// release ends the DB transaction of the read snapshot of the ledger, and says whether it was pinned
+func (rs *readSnapshotRegistry) release(ledger string, id string) bool {
+	rs.mu.Lock()
+	snapshot, ok := rs.snapshots[ledger][id]
+	delete(rs.snapshots[ledger], id)
+	if len(rs.snapshots[ledger]) == 0 {
+		delete(rs.snapshots, ledger)
+	}
+	rs.mu.Unlock()
+	if !ok {
+		return false
+	}
+	snapshot.timer.Stop()
+	if err := snapshot.tx.Rollback(); err != nil {
+		log.Println("Error ending read snapshot:", id, err)
+	}
+	return true
+}
+
+func (rs *readSnapshotRegistry) list(ledger string) []*ReadSnapshot {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	list := make([]*ReadSnapshot, 0, len(rs.snapshots[ledger]))
+	for _, snapshot := range rs.snapshots[ledger] {
+		list = append(list, snapshot)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt < list[j].CreatedAt
+	})
+	return list
+}
+
+// beginRead begins a read-only DB transaction, on the read snapshot of the request if any
+func beginRead(r *http.Request, context *ledgerContext.AppContext) (*sql.Tx, ledgerError.ApplicationError) {
+	return models.BeginRead(context.DB, r.Header.Get(ReadSnapshotHeader))
+}
+
+// writeReadError writes the response status of an error while beginning a read
+func writeReadError(w http.ResponseWriter, aerr ledgerError.ApplicationError) {
+	log.Println("Error while beginning read:", aerr)
+	switch aerr.ErrorCode() {
+	case "read_snapshot.invalid":
+		w.WriteHeader(http.StatusBadRequest)
+	case "read_snapshot.expired":
+		w.WriteHeader(http.StatusGone)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// PinReadSnapshot pins a read snapshot of the ledger for the `ttl` seconds of the request
+func PinReadSnapshot(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	ttl := defaultReadSnapshotTTL
+	if value := r.URL.Query().Get("ttl"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 || time.Duration(seconds)*time.Second > maxReadSnapshotTTL {
+			context.Log("Invalid read snapshot TTL:", value)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+
+	tx, id, aerr := models.PinReadSnapshot(context.DB)
+	if aerr != nil {
+		context.Log("Error while pinning read snapshot:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	snapshot := readSnapshots.add(context.LedgerID, id, tx, ttl)
+	if snapshot == nil {
+		tx.Rollback()
+		context.Log("Too many read snapshots are pinned:", context.LedgerID)
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		context.Log("Error while parsing read snapshot:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(data)
+	return
+}
+
+// GetReadSnapshots returns the read snapshots of the ledger pinned by this server
+func GetReadSnapshots(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	data, err := json.Marshal(readSnapshots.list(context.LedgerID))
+	if err != nil {
+		context.Log("Error while parsing read snapshots:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// ReleaseReadSnapshot releases the read snapshot with the input ID before it expires
+func ReleaseReadSnapshot(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	id := r.URL.Query().Get("id")
+	if !readSnapshots.release(context.LedgerID, id) {
+		context.Log("Read snapshot is not pinned:", id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadSnapshotRequests(t *testing.T) {
+	context := &ledgerContext.AppContext{}
+	for _, tc := range []struct {
+		method  string
+		url     string
+		handler middlewares.Handler
+		status  int
+	}{
+		{"POST", "/v1/read_snapshots?ttl=0", PinReadSnapshot, http.StatusBadRequest},
+		{"POST", "/v1/read_snapshots?ttl=86400", PinReadSnapshot, http.StatusBadRequest},
+		{"DELETE", "/v1/read_snapshots?id=00000003-0000001B-1", ReleaseReadSnapshot, http.StatusNotFound},
+		{"GET", "/v1/export", ExportLedger, http.StatusBadRequest},
+	} {
+		req, err := http.NewRequest(tc.method, tc.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(ReadSnapshotHeader, "invalid")
+		rr := httptest.NewRecorder()
+		middlewares.ContextMiddleware(tc.handler, context).ServeHTTP(rr, req)
+		assert.Equal(t, tc.status, rr.Code, "Invalid response code of: "+tc.method+" "+tc.url)
+	}
+}
+
+func TestReadSnapshotLimit(t *testing.T) {
+	registry := &readSnapshotRegistry{snapshots: make(map[string]map[string]*ReadSnapshot)}
+	for i := 0; i < maxReadSnapshots; i++ {
+		assert.NotNil(t, registry.add("t1", strconv.Itoa(i), nil, time.Hour), "Read snapshot should be pinned")
+	}
+	assert.Nil(t, registry.add("t1", "full", nil, time.Hour), "Read snapshot should be over the limit")
+	// The snapshots of each tenant are limited and listed separately
+	assert.NotNil(t, registry.add("t2", "0", nil, time.Hour), "Read snapshot should be pinned")
+	assert.Equal(t, maxReadSnapshots, len(registry.list("t1")), "Invalid read snapshots")
+	assert.Equal(t, 1, len(registry.list("t2")), "Invalid read snapshots")
+
+	for _, snapshots := range registry.snapshots {
+		for _, snapshot := range snapshots {
+			snapshot.timer.Stop()
+		}
+	}
+}
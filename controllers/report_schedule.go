@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/RealImage/QLedger/models"
+)
+
+var reportDeliveryClient = &http.Client{Timeout: 30 * time.Second}
+
+func reportContentType(format string) string {
+	if format == "csv" {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/json; charset=utf-8"
+}
+
+// encodeReport encodes the report rows as JSON, or as CSV with a header of the columns
+func encodeReport(result *models.ReportResult, format string) ([]byte, error) {
+	if format != "csv" {
+		return json.Marshal(result)
+	}
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(result.Columns)
+	for _, row := range result.Rows {
+		record := make([]string, len(result.Columns))
+		for i, column := range result.Columns {
+			if row[column] != nil {
+				record[i] = fmt.Sprint(row[column])
+			}
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// deliverReport posts the report rows to the delivery URL of the definition
+func deliverReport(definition *models.ReportDefinition, result *models.ReportResult) error {
+	data, err := encodeReport(result, definition.Delivery.Format)
+	if err != nil {
+		return err
+	}
+	resp, err := reportDeliveryClient.Post(definition.Delivery.URL, reportContentType(definition.Delivery.Format), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Report delivery failed with status: %v", resp.Status)
+	}
+	return nil
+}
+
+// RunScheduledReports runs or materializes the due scheduled reports and delivers their results
+func RunScheduledReports(context *ledgerContext.AppContext) {
+	definitionDB := models.NewReportDefinitionDB(context.DB)
+	due, aerr := definitionDB.ClaimDue(time.Now().UTC())
+	if aerr != nil {
+		context.Log("Error while claiming scheduled reports:", aerr)
+		return
+	}
+	for _, definition := range due {
+		var result *models.ReportResult
+		var aerr ledgerError.ApplicationError
+		if definition.Materialize {
+			result, aerr = definitionDB.Materialize(definition)
+		} else {
+			result, aerr = definitionDB.Run(definition)
+		}
+		if aerr != nil {
+			context.Log("Error while running scheduled report:", definition.ID, aerr)
+			continue
+		}
+		if definition.Delivery == nil {
+			continue
+		}
+		if err := deliverReport(definition, result); err != nil {
+			context.Log("Error while delivering scheduled report:", definition.ID, err)
+		}
+	}
+}
+
+// ScheduleReports checks for due scheduled reports at every interval
+func ScheduleReports(context *ledgerContext.AppContext, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		RunScheduledReports(context)
+	}
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/RealImage/QLedger/models"
+)
+
+// GetAgingReport returns the aging of the outstanding balances of the accounts with the ID prefix
+func GetAgingReport(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	params := r.URL.Query()
+	prefix := params.Get("prefix")
+	if prefix == "" {
+		context.Log("Missing account prefix in aging report query")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	asOf := time.Now().UTC()
+	if value := params.Get("as_of"); value != "" {
+		t, err := time.Parse(models.LedgerTimestampLayout, value)
+		if err != nil {
+			context.Log("Invalid as_of in aging report query:", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		asOf = t
+	}
+
+	reportDB := models.NewReportDB(context.DB)
+	report, aerr := reportDB.GetAgingReport(prefix, asOf)
+	if aerr != nil {
+		context.Log("Error while getting aging report:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		context.Log("Error while parsing aging report:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// GetReportDefinitions returns all the custom report definitions
+func GetReportDefinitions(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	definitionDB := models.NewReportDefinitionDB(context.DB)
+	definitions, aerr := definitionDB.List()
+	if aerr != nil {
+		context.Log("Error while getting report definitions:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(definitions)
+	if err != nil {
+		context.Log("Error while parsing report definitions:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// SaveReportDefinition creates or replaces a custom report definition
+func SaveReportDefinition(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	definition := &models.ReportDefinition{}
+	if err := json.NewDecoder(r.Body).Decode(definition); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := definition.Validate(); err != nil {
+		context.Log("Invalid report definition:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	definitionDB := models.NewReportDefinitionDB(context.DB)
+	if aerr := definitionDB.Save(definition); aerr != nil {
+		context.Log("Error while saving report definition:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	return
+}
+
+// RunReport runs the stored report definition with the `id` query parameter,
+// or the definition in the payload, and returns the rows as JSON or CSV.
+// The stored result of a materialized report is returned with its staleness, unless `refresh=true`.
+func RunReport(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	params := r.URL.Query()
+	definitionDB := models.NewReportDefinitionDB(context.DB)
+
+	var definition *models.ReportDefinition
+	if id := params.Get("id"); id != "" {
+		var aerr ledgerError.ApplicationError
+		definition, aerr = definitionDB.GetByID(id)
+		if aerr != nil {
+			context.Log("Error while getting report definition:", aerr)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if definition == nil {
+			context.Log("Report definition doesn't exist:", id)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	} else {
+		definition = &models.ReportDefinition{}
+		if err := json.NewDecoder(r.Body).Decode(definition); err != nil {
+			context.Log("Error loading payload:", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, _, err := definition.ToSQL(); err != nil {
+			context.Log("Invalid report definition:", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	format := params.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		context.Log("Invalid report format:", format)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var result *models.ReportResult
+	var aerr ledgerError.ApplicationError
+	if definition.Materialize && params.Get("id") != "" {
+		// Materialized reports are recomputed only when missing or on refresh
+		if params.Get("refresh") != "true" {
+			result, aerr = definitionDB.GetMaterialized(definition)
+		}
+		if result == nil && aerr == nil {
+			result, aerr = definitionDB.Materialize(definition)
+		}
+	} else {
+		result, aerr = definitionDB.Run(definition)
+	}
+	if aerr != nil {
+		context.Log("Error while running report:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := encodeReport(result, format)
+	if err != nil {
+		context.Log("Error while parsing report:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", reportContentType(format))
+	w.Write(data)
+	return
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/metrics"
+	"github.com/RealImage/QLedger/models"
+)
+
+var retentionPurgedRows = metrics.NewCounterVec("qledger_retention_purged_rows_total",
+	"Rows of the history tables deleted by the retention purges.", "table")
+
+// purgeRetention purges the history tables of the ledger beyond their retention periods
+func purgeRetention(context *ledgerContext.AppContext, now time.Time) (*models.RetentionPurge, error) {
+	retentionDB := models.NewRetentionDB(context.DB)
+	purge, aerr := retentionDB.Purge(now)
+	if aerr != nil {
+		return nil, aerr
+	}
+	for table, rows := range purge.Purged {
+		retentionPurgedRows.Add(float64(rows), table)
+		if rows > 0 {
+			context.Log("Rows purged from", table, "beyond retention:", rows)
+		}
+	}
+	return purge, nil
+}
+
+// ScheduleRetentionPurges purges the history tables beyond their retention periods at every interval
+func ScheduleRetentionPurges(context *ledgerContext.AppContext, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		// The history of a read-only region is purged by the primary, and replicated
+		if IsReadOnly() {
+			continue
+		}
+		if _, err := purgeRetention(context, time.Now().UTC()); err != nil {
+			context.Log("Error while purging history beyond retention:", err)
+		}
+	}
+}
+
+// GetRetention returns the retention settings of the ledger along with the rows of its history tables
+// due to be purged, and the last purge
+func GetRetention(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	retentionDB := models.NewRetentionDB(context.DB)
+	report, aerr := retentionDB.Report(time.Now().UTC())
+	if aerr != nil {
+		context.Log("Error while reading retention report:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		context.Log("Error while parsing retention report:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// SetRetention replaces the retention settings of the ledger
+func SetRetention(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		context.Log("Error reading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	settings := models.RetentionSettings{}
+	err = json.Unmarshal(body, &settings)
+	if err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	retentionDB := models.NewRetentionDB(context.DB)
+	if aerr := retentionDB.Set(&settings); aerr != nil {
+		context.Log("Error while setting retention settings:", aerr)
+		if aerr.ErrorCode() == "db.error" {
+			w.WriteHeader(http.StatusInternalServerError)
+		} else {
+			writeErrorResponse(w, http.StatusBadRequest, aerr)
+		}
+		return
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		context.Log("Error while parsing retention settings:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// PurgeRetention purges the history tables of the ledger beyond their retention periods right away,
+// and returns the rows deleted
+func PurgeRetention(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	purge, err := purgeRetention(context, time.Now().UTC())
+	if err != nil {
+		context.Log("Error while purging history beyond retention:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(purge)
+	if err != nil {
+		context.Log("Error while parsing retention purge:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
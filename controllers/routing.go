@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/RealImage/QLedger/models"
+)
+
+// resolveAccountRefs resolves the account references of the transaction lines to their accounts
+// as per the routing rules
+func resolveAccountRefs(context *ledgerContext.AppContext, transaction *models.Transaction) ledgerError.ApplicationError {
+	ruleDB := models.NewRoutingRuleDB(context.DB)
+	return ruleDB.ResolveLines(transaction.Lines)
+}
+
+// GetRoutingRules returns all the routing rules in the order they are matched
+func GetRoutingRules(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	ruleDB := models.NewRoutingRuleDB(context.DB)
+	rules, aerr := ruleDB.List()
+	if aerr != nil {
+		context.Log("Error while listing routing rules:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(rules)
+	if err != nil {
+		context.Log("Error while parsing routing rules:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// AddRoutingRule creates a routing rule with the `id`, `pattern`, `priority`, and either the `account`
+// or the `lookup` from the request data. It applies to the transactions posted from then on.
+func AddRoutingRule(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	rule := &models.RoutingRule{}
+	if err := json.NewDecoder(r.Body).Decode(rule); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := rule.Validate(); err != nil {
+		context.Log("Invalid routing rule:", rule.ID, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ruleDB := models.NewRoutingRuleDB(context.DB)
+	if aerr := ruleDB.Create(rule); aerr != nil {
+		context.Log("Error while creating routing rule:", aerr)
+		switch aerr.ErrorCode() {
+		case "routing_rule.exists":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	return
+}
+
+// DeleteRoutingRule removes the routing rule with the `id` query parameter
+func DeleteRoutingRule(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	id := r.URL.Query().Get("id")
+	ruleDB := models.NewRoutingRuleDB(context.DB)
+	deleted, aerr := ruleDB.Delete(id)
+	if aerr != nil {
+		context.Log("Error while deleting routing rule:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		context.Log("Routing rule doesn't exist:", id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	return
+}
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/RealImage/QLedger/models"
+)
+
+const (
+	scheduledTransactionsBatchSize = 100
+	// scheduledTransactionLease is the time a claimed transaction is held by a server while it is posted,
+	// after which it is retried if it is still pending
+	scheduledTransactionLease = time.Minute
+)
+
+// scheduleTransaction holds the transaction until its future `post_at` time
+func scheduleTransaction(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext, transaction *models.Transaction, postAt time.Time) {
+	if !transaction.IsValid() {
+		context.Log("Transaction is invalid:", transaction.ID)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// The data is checked when the transaction is scheduled, as it is posted later without the API key
+	if !checkMetadataWrite(w, context, transaction.Data) {
+		return
+	}
+
+	// A transaction which already exists is handled as a duplicate or conflicting transaction
+	transactionsDB := models.NewTransactionDB(context.DB)
+	isExists, aerr := transactionsDB.IsExists(transaction.ID)
+	if aerr != nil {
+		context.Log("Error while checking for existing transaction:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if isExists {
+		postTransaction(w, r, context, transaction)
+		return
+	}
+
+	// The transaction is timestamped at the time it is scheduled to be posted, unless it has a timestamp
+	if transaction.Timestamp == "" {
+		transaction.Timestamp = transaction.PostAt
+	}
+	if transaction.Signature != nil {
+		valid, err := verifyTransactionSignature(context, transaction)
+		if err != nil {
+			context.Log("Error while verifying transaction signature:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !valid {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	scheduledDB := models.NewScheduledTransactionDB(context.DB)
+	if aerr := scheduledDB.Schedule(transaction, postAt); aerr != nil {
+		context.Log("Error while scheduling transaction:", transaction.ID, aerr)
+		switch aerr.ErrorCode() {
+		case "scheduled_transaction.exists":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	return
+}
+
+// postBackgroundTransaction posts a transaction which isn't posted by a request, such as a due scheduled
+// transaction or a consumed message, the same way as a transaction posted by a client
+func postBackgroundTransaction(context *ledgerContext.AppContext, transaction *models.Transaction) ledgerError.ApplicationError {
+	if aerr := resolveAccountRefs(context, transaction); aerr != nil {
+		return aerr
+	}
+	transactionsDB := models.NewTransactionDB(context.DB)
+	isExists, aerr := transactionsDB.IsExists(transaction.ID)
+	if aerr != nil {
+		return aerr
+	}
+	if isExists {
+		replay, aerr := transactionsDB.Replay(transaction)
+		if aerr != nil {
+			return aerr
+		}
+		switch replay.Kind {
+		case models.ReplayConflict:
+			return models.TransactionConflictError(transaction.ID)
+		case models.ReplayExpired:
+			return models.TransactionReplayExpiredError(transaction.ID, replay.Window)
+		}
+		return nil
+	}
+	if aerr := checkPostingHooks(context, transaction); aerr != nil {
+		return aerr
+	}
+	created, aerr := transactionsDB.Post(transaction)
+	if aerr != nil {
+		return aerr
+	}
+	if created {
+		notifyWebhooks(context, WebhookEventTransactionCreated, transaction)
+	}
+	return nil
+}
+
+// PostDueTransactions posts the scheduled transactions which are due. The transactions rejected by
+// the ledger or a posting hook are failed, and the others which can't be posted are retried later.
+func PostDueTransactions(context *ledgerContext.AppContext) {
+	scheduledDB := models.NewScheduledTransactionDB(context.DB)
+	for {
+		due, aerr := scheduledDB.ClaimDue(scheduledTransactionsBatchSize, scheduledTransactionLease)
+		if aerr != nil {
+			context.Log("Error while claiming scheduled transactions:", aerr)
+			return
+		}
+		for _, scheduled := range due {
+			aerr := postBackgroundTransaction(context, scheduled.Transaction)
+			switch {
+			case aerr == nil:
+				aerr = scheduledDB.MarkPosted(scheduled.ID)
+			case aerr.ErrorCode() == "db.error" || aerr.ErrorCode() == "posting_hook.unavailable":
+				context.Log("Error while posting scheduled transaction, will retry:", scheduled.ID, aerr)
+				continue
+			default:
+				context.Log("Scheduled transaction failed:", scheduled.ID, aerr)
+				aerr = scheduledDB.MarkFailed(scheduled.ID, aerr.ErrorMessage())
+			}
+			if aerr != nil {
+				context.Log("Error while recording scheduled transaction:", scheduled.ID, aerr)
+			}
+		}
+		if len(due) < scheduledTransactionsBatchSize {
+			return
+		}
+	}
+}
+
+// ScheduleDueTransactions posts the due scheduled transactions at every interval
+func ScheduleDueTransactions(context *ledgerContext.AppContext, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		// A fenced region no longer posts, as the promoted region posts the due transactions
+		if IsReadOnly() {
+			continue
+		}
+		PostDueTransactions(context)
+	}
+}
+
+// GetScheduledTransactions returns the scheduled transactions in the order of their `post_at` time,
+// filtered by the optional `status` query parameter
+func GetScheduledTransactions(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	params := r.URL.Query()
+	status := params.Get("status")
+	switch status {
+	case "", models.ScheduledTransactionPending, models.ScheduledTransactionPosted, models.ScheduledTransactionFailed,
+		models.ScheduledTransactionCancelled:
+	default:
+		context.Log("Invalid status in scheduled transactions query:", status)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			context.Log("Invalid limit in scheduled transactions query:", value)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	scheduledDB := models.NewScheduledTransactionDB(context.DB)
+	scheduled, aerr := scheduledDB.List(status, limit)
+	if aerr != nil {
+		context.Log("Error while getting scheduled transactions:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(scheduled)
+	if err != nil {
+		context.Log("Error while parsing scheduled transactions:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// CancelScheduledTransaction cancels the pending transaction with the `id` query parameter
+func CancelScheduledTransaction(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	id := r.URL.Query().Get("id")
+	scheduledDB := models.NewScheduledTransactionDB(context.DB)
+	cancelled, aerr := scheduledDB.Cancel(id)
+	if aerr != nil {
+		context.Log("Error while cancelling scheduled transaction:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if cancelled {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// The transaction can't be cancelled when it doesn't exist, or is no longer pending or is being posted
+	scheduled, aerr := scheduledDB.Get(id)
+	if aerr != nil {
+		context.Log("Error while getting scheduled transaction:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if scheduled == nil {
+		context.Log("Scheduled transaction doesn't exist:", id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	context.Log("Scheduled transaction can't be cancelled:", id, scheduled.Status)
+	w.WriteHeader(http.StatusConflict)
+	return
+}
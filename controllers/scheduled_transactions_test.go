@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvalidScheduledTransaction(t *testing.T) {
+	handler := middlewares.ContextMiddleware(MakeTransaction, nil)
+	payload := `{
+		"id": "t001",
+		"post_at": "tomorrow",
+		"lines": [{"account": "alice", "delta": 100}, {"account": "bob", "delta": -100}]
+	}`
+	req, err := http.NewRequest("POST", "/v1/transactions", bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Invalid response code")
+}
+
+func TestInvalidScheduledTransactionsRequests(t *testing.T) {
+	handler := middlewares.ContextMiddleware(GetScheduledTransactions, nil)
+	for _, query := range []string{"?status=due", "?limit=0", "?status=pending&limit=x"} {
+		req, err := http.NewRequest("GET", "/v1/scheduled_transactions"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "Invalid response code for query: %v", query)
+	}
+}
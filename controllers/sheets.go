@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/metrics"
+	"github.com/RealImage/QLedger/models"
+	"github.com/RealImage/QLedger/sheets"
+)
+
+// Statuses of the rows of a synced sheet, which are written back to its `status` column
+const (
+	// SheetRowPosted is a row whose transaction is posted or was already posted
+	SheetRowPosted = "posted"
+	// SheetRowRejected is a row whose transaction can't be posted, which is retried once its status is cleared
+	SheetRowRejected = "rejected"
+	// SheetRowRetried is a row whose transaction is retried on the next sync, such as on DB errors
+	SheetRowRetried = "retried"
+)
+
+// sheetDataPrefix is the prefix of the columns of the data of the transactions, such as `data.memo`
+const sheetDataPrefix = "data."
+
+var sheetTransactions = metrics.NewCounterVec("qledger_sheet_transactions_total",
+	"Transactions of the synced sheet by status.", "status")
+
+// sheetColumns are the indexes of the columns of a journal sheet by their headers
+type sheetColumns struct {
+	id, timestamp, account, delta, currency, status, message int
+	data                                                     map[string]int
+}
+
+// sheetEntry represents the rows of a transaction in a journal sheet, along with their current status
+type sheetEntry struct {
+	transaction *models.Transaction
+	// rows are the numbers of the rows of the transaction in the sheet
+	rows     []int
+	statuses []string
+	messages []string
+	// err is why the rows can't be read as a transaction
+	err error
+}
+
+// parseSheetColumns finds the columns of the header row, where the transaction ID, account, delta,
+// status and message columns are required
+func parseSheetColumns(header []string) (*sheetColumns, error) {
+	columns := &sheetColumns{id: -1, timestamp: -1, account: -1, delta: -1, currency: -1, status: -1, message: -1,
+		data: make(map[string]int)}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch {
+		case name == "transaction_id":
+			columns.id = i
+		case name == "timestamp":
+			columns.timestamp = i
+		case name == "account":
+			columns.account = i
+		case name == "delta":
+			columns.delta = i
+		case name == "currency":
+			columns.currency = i
+		case name == "status":
+			columns.status = i
+		case name == "message":
+			columns.message = i
+		case strings.HasPrefix(name, sheetDataPrefix):
+			columns.data[strings.TrimPrefix(name, sheetDataPrefix)] = i
+		}
+	}
+	for name, index := range map[string]int{"transaction_id": columns.id, "account": columns.account,
+		"delta": columns.delta, "status": columns.status, "message": columns.message} {
+		if index < 0 {
+			return nil, fmt.Errorf("Missing %v column in sheet", name)
+		}
+	}
+	return columns, nil
+}
+
+// cell returns the trimmed value of the column of the row, which is empty beyond the cells of the row
+func cell(row []string, column int) string {
+	if column < 0 || column >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[column])
+}
+
+// parseSheetJournal groups the rows of a journal sheet by their transaction IDs, with a line of the transaction
+// in every row. The timestamp and data of a transaction are taken from its first row having them.
+func parseSheetJournal(rows [][]string) ([]*sheetEntry, *sheetColumns, error) {
+	if len(rows) == 0 {
+		return nil, nil, errors.New("Missing header row in sheet")
+	}
+	columns, err := parseSheetColumns(rows[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []*sheetEntry
+	byID := make(map[string]*sheetEntry)
+	for i, row := range rows[1:] {
+		id, account := cell(row, columns.id), cell(row, columns.account)
+		if id == "" && account == "" {
+			continue
+		}
+		entry, ok := byID[id]
+		if !ok || id == "" {
+			entry = &sheetEntry{transaction: &models.Transaction{ID: id}}
+			entries = append(entries, entry)
+			if id != "" {
+				byID[id] = entry
+			}
+		}
+		// The row numbers start from 1 for the header row
+		entry.rows = append(entry.rows, i+2)
+		entry.statuses = append(entry.statuses, cell(row, columns.status))
+		entry.messages = append(entry.messages, cell(row, columns.message))
+		if entry.err != nil {
+			continue
+		}
+		if id == "" || account == "" {
+			entry.err = fmt.Errorf("Missing transaction_id or account in row %v", i+2)
+			continue
+		}
+
+		transaction := entry.transaction
+		if timestamp := cell(row, columns.timestamp); timestamp != "" && transaction.Timestamp == "" {
+			// A date is the start of the day
+			if len(timestamp) == len("2006-01-02") {
+				timestamp += " 00:00:00.000"
+			}
+			transaction.Timestamp = timestamp
+		}
+		for key, column := range columns.data {
+			if value := cell(row, column); value != "" {
+				if transaction.Data == nil {
+					transaction.Data = make(map[string]interface{})
+				}
+				if _, ok := transaction.Data[key]; !ok {
+					transaction.Data[key] = value
+				}
+			}
+		}
+		delta, err := strconv.Atoi(strings.Replace(cell(row, columns.delta), ",", "", -1))
+		if err != nil {
+			entry.err = fmt.Errorf("Invalid delta in row %v: %v", i+2, cell(row, columns.delta))
+			continue
+		}
+		transaction.Lines = append(transaction.Lines, &models.TransactionLine{
+			AccountID: account,
+			Delta:     delta,
+			Currency:  cell(row, columns.currency),
+		})
+	}
+	return entries, columns, nil
+}
+
+// isPending says whether the entry is posted on sync, while any of its rows has no status or is retried
+func (e *sheetEntry) isPending() bool {
+	for _, status := range e.statuses {
+		if status != SheetRowPosted && status != SheetRowRejected {
+			return true
+		}
+	}
+	return false
+}
+
+// postSheetEntry posts the transaction of the entry, and returns the status of its rows along with the reason
+// of a rejected or retried transaction
+func postSheetEntry(context *ledgerContext.AppContext, entry *sheetEntry) (string, string) {
+	if entry.err != nil {
+		return SheetRowRejected, entry.err.Error()
+	}
+	transaction := entry.transaction
+	if err := transaction.ValidateData(); err != nil {
+		return SheetRowRejected, err.Error()
+	}
+	if !transaction.IsValid() {
+		return SheetRowRejected, "Transaction is invalid: the deltas of its lines should sum to zero per currency"
+	}
+	aerr := postBackgroundTransaction(context, transaction)
+	switch {
+	case aerr == nil:
+		return SheetRowPosted, ""
+	case aerr.ErrorCode() == "db.error" || aerr.ErrorCode() == "posting_hook.unavailable":
+		context.Log("Error while posting transaction of sheet, will retry:", transaction.ID, aerr)
+		return SheetRowRetried, aerr.ErrorMessage()
+	default:
+		return SheetRowRejected, aerr.ErrorMessage()
+	}
+}
+
+// syncSheet posts the pending transactions of the sheet, and writes the status of their rows back to it
+func syncSheet(context *ledgerContext.AppContext, sheet sheets.Sheet) error {
+	rows, err := sheet.Rows()
+	if err != nil {
+		return err
+	}
+	entries, columns, err := parseSheetJournal(rows)
+	if err != nil {
+		return err
+	}
+	var updates []sheets.Update
+	for _, entry := range entries {
+		if !entry.isPending() {
+			continue
+		}
+		status, message := postSheetEntry(context, entry)
+		sheetTransactions.Inc(status)
+		if status != SheetRowPosted {
+			context.Log("Transaction of sheet not posted:", entry.transaction.ID, status, message)
+		}
+		// Only the changed cells are written
+		for i, row := range entry.rows {
+			if entry.statuses[i] != status {
+				updates = append(updates, sheets.Update{Row: row, Column: columns.status, Values: []string{status}})
+			}
+			if entry.messages[i] != message {
+				updates = append(updates, sheets.Update{Row: row, Column: columns.message, Values: []string{message}})
+			}
+		}
+	}
+	return sheet.Update(updates)
+}
+
+// SyncSheet posts the pending transactions of the sheet at every interval
+func SyncSheet(context *ledgerContext.AppContext, sheet sheets.Sheet, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		// The transactions of a read-only region are posted by the primary
+		if IsReadOnly() {
+			continue
+		}
+		if err := syncSheet(context, sheet); err != nil {
+			context.Log("Error while syncing sheet:", err)
+		}
+	}
+}
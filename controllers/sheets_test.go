@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"testing"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+	"github.com/RealImage/QLedger/sheets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSheetJournal(t *testing.T) {
+	entries, columns, err := parseSheetJournal([][]string{
+		{"Transaction_ID", "Timestamp", "Account", "Delta", "Currency", "data.memo", "Status", "Message"},
+		{"j1", "2017-01-01", "cash", "-1,000", "USD", "Rent", "", ""},
+		{"j2", "", "cash", "x", "", "", "", ""},
+		{},
+		{"j1", "", "rent", "1000", "USD", "", "", ""},
+		{"", "", "cash", "5"},
+	})
+	if !assert.Nil(t, err, "Error parsing journal") {
+		return
+	}
+	assert.Equal(t, 6, columns.status, "Invalid status column")
+	if !assert.Equal(t, 3, len(entries), "Invalid entries") {
+		return
+	}
+	assert.Equal(t, []int{2, 5}, entries[0].rows, "Invalid rows")
+	assert.Nil(t, entries[0].err, "Entry should be valid")
+	assert.Equal(t, &models.Transaction{
+		ID:        "j1",
+		Timestamp: "2017-01-01 00:00:00.000",
+		Data:      map[string]interface{}{"memo": "Rent"},
+		Lines: []*models.TransactionLine{
+			{AccountID: "cash", Delta: -1000, Currency: "USD"},
+			{AccountID: "rent", Delta: 1000, Currency: "USD"},
+		},
+	}, entries[0].transaction, "Invalid transaction")
+	assert.EqualError(t, entries[1].err, "Invalid delta in row 3: x", "Invalid error")
+	assert.EqualError(t, entries[2].err, "Missing transaction_id or account in row 6", "Invalid error")
+
+	_, _, err = parseSheetJournal([][]string{{"transaction_id", "account", "delta", "status"}})
+	assert.EqualError(t, err, "Missing message column in sheet", "Invalid error")
+}
+
+type fakeSheet struct {
+	rows    [][]string
+	updates []sheets.Update
+}
+
+func (f *fakeSheet) Rows() ([][]string, error) {
+	return f.rows, nil
+}
+
+func (f *fakeSheet) Update(updates []sheets.Update) error {
+	f.updates = updates
+	return nil
+}
+
+func TestSyncSheet(t *testing.T) {
+	sheet := &fakeSheet{rows: [][]string{
+		{"transaction_id", "account", "delta", "status", "message"},
+		{"j1", "cash", "-100", "posted", ""},
+		{"j1", "rent", "100", "posted", ""},
+		{"j2", "cash", "-100", "", ""},
+		{"j2", "rent", "50", "rejected", "Transaction is invalid: the deltas of its lines should sum to zero per currency"},
+		{"j3", "cash", "-100", "rejected", "Old reason"},
+	}}
+	err := syncSheet(&ledgerContext.AppContext{}, sheet)
+	assert.Nil(t, err, "Error syncing sheet")
+	// Only the pending transaction is posted, and only its changed cells are written
+	assert.Equal(t, []sheets.Update{
+		{Row: 4, Column: 3, Values: []string{"rejected"}},
+		{Row: 4, Column: 4, Values: []string{"Transaction is invalid: the deltas of its lines should sum to zero per currency"}},
+	}, sheet.updates, "Invalid updates")
+	assert.Equal(t, float64(1), sheetTransactions.Value(SheetRowRejected), "Invalid rejections metric")
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+// GetClientKeys returns all the registered client keys
+func GetClientKeys(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	signatureDB := models.NewSignatureDB(context.DB)
+	keys, aerr := signatureDB.ListKeys()
+	if aerr != nil {
+		context.Log("Error while getting client keys:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(keys)
+	if err != nil {
+		context.Log("Error while parsing client keys:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// AddClientKey registers a PEM encoded public key of a client
+func AddClientKey(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	key := &models.ClientKey{}
+	if err := json.NewDecoder(r.Body).Decode(key); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if key.ID == "" || key.Client == "" {
+		context.Log("Missing id or client of client key")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if _, err := models.ParsePublicKey(key.PublicKey); err != nil {
+		context.Log("Invalid public key:", key.ID, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	signatureDB := models.NewSignatureDB(context.DB)
+	if aerr := signatureDB.AddKey(key); aerr != nil {
+		context.Log("Error while adding client key:", aerr)
+		switch aerr.ErrorCode() {
+		case "client_key.exists":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	return
+}
+
+// RevokeClientKey revokes the client key with the `id` query parameter.
+// The key is kept to report the status of the signatures made with it.
+func RevokeClientKey(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	id := r.URL.Query().Get("id")
+	signatureDB := models.NewSignatureDB(context.DB)
+	revoked, aerr := signatureDB.RevokeKey(id)
+	if aerr != nil {
+		context.Log("Error while revoking client key:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		context.Log("Active client key doesn't exist:", id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	return
+}
+
+// verifyTransactionSignature says whether the client signature of a transaction
+// is valid for the registered key. The reason of an invalid signature is logged.
+func verifyTransactionSignature(context *ledgerContext.AppContext, transaction *models.Transaction) (bool, error) {
+	signatureDB := models.NewSignatureDB(context.DB)
+	valid, aerr := signatureDB.Verify(transaction)
+	if aerr != nil {
+		return false, aerr
+	}
+	return valid, nil
+}
+
+// GetTransactionSignature returns the client signature of a transaction along with its verification status
+func GetTransactionSignature(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext, id string) {
+	transactionDB := models.NewTransactionDB(context.DB)
+	transaction, aerr := transactionDB.GetByID(id)
+	if aerr != nil {
+		context.Log("Error while getting transaction:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if transaction == nil {
+		context.Log("Transaction doesn't exist:", id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	signatureDB := models.NewSignatureDB(context.DB)
+	status, aerr := signatureDB.GetSignatureStatus(transaction)
+	if aerr != nil {
+		context.Log("Error while getting transaction signature:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if status == nil {
+		context.Log("Transaction isn't signed:", id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		context.Log("Error while parsing transaction signature:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
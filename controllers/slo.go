@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/slo"
+)
+
+// GetSLOs returns the error budget consumption of all the tracked SLOs
+func GetSLOs(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	data, err := json.Marshal(slo.Summaries())
+	if err != nil {
+		context.Log("Error while parsing SLO summaries:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/RealImage/QLedger/models"
+)
+
+var validSnapshotName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.-]*$`)
+
+// SnapshotRequest represents the snapshot to be created
+type SnapshotRequest struct {
+	Name string `json:"name"`
+}
+
+// CreateSnapshot records a named snapshot at the latest transaction line
+func CreateSnapshot(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	request := &SnapshotRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// Names can't be numeric as they would be ambiguous with the sequence points
+	if !validSnapshotName.MatchString(request.Name) {
+		context.Log("Invalid snapshot name:", request.Name)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	snapshotDB := models.NewSnapshotDB(context.DB)
+	snapshot, aerr := snapshotDB.Create(request.Name)
+	if aerr != nil {
+		context.Log("Error while creating snapshot:", aerr)
+		switch aerr.ErrorCode() {
+		case "snapshot.exists":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		context.Log("Error while parsing snapshot:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(data)
+	return
+}
+
+// GetSnapshots returns all the snapshots
+func GetSnapshots(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	snapshotDB := models.NewSnapshotDB(context.DB)
+	snapshots, aerr := snapshotDB.List()
+	if aerr != nil {
+		context.Log("Error while getting snapshots:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(snapshots)
+	if err != nil {
+		context.Log("Error while parsing snapshots:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// resolveSequence returns the sequence point of a snapshot name or a numeric sequence point,
+// or -1 if the snapshot doesn't exist
+func resolveSequence(snapshotDB *models.SnapshotDB, point string) (int64, ledgerError.ApplicationError) {
+	if sequence, err := strconv.ParseInt(point, 10, 64); err == nil && sequence >= 0 {
+		return sequence, nil
+	}
+	return snapshotDB.GetSequence(point)
+}
+
+// DiffSnapshots returns the account balance changes between the `from` and `to` snapshots
+// along with the responsible transactions. The `to` snapshot defaults to the latest line.
+func DiffSnapshots(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	params := r.URL.Query()
+	if params.Get("from") == "" {
+		context.Log("Missing from in snapshot diff query")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	snapshotDB := models.NewSnapshotDB(context.DB)
+	from, aerr := resolveSequence(&snapshotDB, params.Get("from"))
+	if aerr == nil && from < 0 {
+		context.Log("Snapshot doesn't exist:", params.Get("from"))
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var to int64
+	if aerr == nil {
+		if point := params.Get("to"); point != "" {
+			to, aerr = resolveSequence(&snapshotDB, point)
+			if aerr == nil && to < 0 {
+				context.Log("Snapshot doesn't exist:", point)
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+		} else {
+			to, aerr = snapshotDB.CurrentSequence()
+		}
+	}
+	if aerr != nil {
+		context.Log("Error while resolving snapshots:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if from > to {
+		context.Log("Snapshot diff from is after to:", from, to)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	diff, aerr := snapshotDB.Diff(from, to)
+	if aerr != nil {
+		context.Log("Error while diffing snapshots:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(diff)
+	if err != nil {
+		context.Log("Error while parsing snapshot diff:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
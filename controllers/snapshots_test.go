@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/RealImage/QLedger/models"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+var (
+	SnapshotsAPI     = "/v1/snapshots"
+	SnapshotsDiffAPI = "/v1/snapshots/_diff"
+)
+
+type SnapshotsSuite struct {
+	suite.Suite
+	context *ledgerContext.AppContext
+}
+
+func (ss *SnapshotsSuite) SetupSuite() {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(ss.T(), databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	}
+	log.Println("Successfully established connection to database.")
+	ss.context = &ledgerContext.AppContext{DB: db}
+}
+
+func (ss *SnapshotsSuite) transact(id string, delta int) {
+	txnDB := models.NewTransactionDB(ss.context.DB)
+	done := txnDB.Transact(&models.Transaction{
+		ID: id,
+		Lines: []*models.TransactionLine{
+			{AccountID: "snap_bank", Delta: delta},
+			{AccountID: "snap_sales", Delta: -delta},
+		},
+	})
+	assert.Equal(ss.T(), true, done, "Error creating test transaction")
+}
+
+func (ss *SnapshotsSuite) createSnapshot(name string) int {
+	handler := middlewares.ContextMiddleware(CreateSnapshot, ss.context)
+	req, err := http.NewRequest("POST", SnapshotsAPI, bytes.NewBufferString(`{"name": "`+name+`"}`))
+	if err != nil {
+		ss.T().Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+func (ss *SnapshotsSuite) TestDiffSnapshots() {
+	t := ss.T()
+
+	ss.transact("snap1", 100)
+	assert.Equal(t, http.StatusCreated, ss.createSnapshot("close_day1"), "Invalid response code")
+	assert.Equal(t, http.StatusConflict, ss.createSnapshot("close_day1"), "Invalid response code")
+	assert.Equal(t, http.StatusBadRequest, ss.createSnapshot("42"), "Invalid response code")
+	ss.transact("snap2", 50)
+	ss.transact("snap3", 25)
+
+	handler := middlewares.ContextMiddleware(DiffSnapshots, ss.context)
+	req, err := http.NewRequest("GET", SnapshotsDiffAPI+"?from=close_day1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+
+	diff := &models.SnapshotDiff{}
+	err = json.Unmarshal(rr.Body.Bytes(), diff)
+	assert.Equal(t, nil, err, "Invalid response body")
+	assert.Equal(t, 2, len(diff.Accounts), "Invalid number of changed accounts")
+	bank := diff.Accounts[0]
+	assert.Equal(t, "snap_bank", bank.AccountID, "Invalid account")
+	assert.Equal(t, 100, bank.FromBalance, "Invalid from balance")
+	assert.Equal(t, 175, bank.ToBalance, "Invalid to balance")
+	assert.Equal(t, 75, bank.Change, "Invalid change")
+	sort.Strings(bank.Transactions)
+	assert.Equal(t, []string{"snap2", "snap3"}, bank.Transactions, "Invalid transactions")
+
+	// Missing snapshot
+	req, err = http.NewRequest("GET", SnapshotsDiffAPI+"?from=missing", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Invalid response code")
+}
+
+func (ss *SnapshotsSuite) TearDownSuite() {
+	log.Println("Cleaning up the test database")
+
+	t := ss.T()
+	for _, table := range []string{"snapshots", "lines", "transactions", "accounts"} {
+		_, err := ss.context.DB.Exec("DELETE FROM " + table)
+		if err != nil {
+			t.Fatal("Error deleting "+table+":", err)
+		}
+	}
+}
+
+func TestSnapshotsSuite(t *testing.T) {
+	suite.Run(t, new(SnapshotsSuite))
+}
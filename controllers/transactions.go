@@ -2,17 +2,21 @@ package controllers
 
 import (
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
-	"regexp"
+	"strings"
 	"time"
 
 	ledgerContext "github.com/RealImage/QLedger/context"
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/RealImage/QLedger/middlewares"
 	"github.com/RealImage/QLedger/models"
 )
 
+// ContentHashHeader is the response header of the canonical hash of a created transaction
+const ContentHashHeader = "X-Ledger-Content-Hash"
+
 func unmarshalToTransaction(r *http.Request, txn *models.Transaction) error {
 	defer r.Body.Close()
 	body, err := ioutil.ReadAll(r.Body)
@@ -23,21 +27,7 @@ func unmarshalToTransaction(r *http.Request, txn *models.Transaction) error {
 	if err != nil {
 		return err
 	}
-	var validKey = regexp.MustCompile(`^[a-z_A-Z]+$`)
-	for key := range txn.Data {
-		if !validKey.MatchString(key) {
-			return fmt.Errorf("Invalid key in data json: %v", key)
-		}
-	}
-	// Validate timestamp format if present
-	if txn.Timestamp != "" {
-		_, err := time.Parse(models.LedgerTimestampLayout, txn.Timestamp)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return txn.ValidateData()
 }
 
 // MakeTransaction creates a new transaction from the request data
@@ -45,65 +35,175 @@ func MakeTransaction(w http.ResponseWriter, r *http.Request, context *ledgerCont
 	transaction := &models.Transaction{}
 	err := unmarshalToTransaction(r, transaction)
 	if err != nil {
-		log.Println("Error loading payload:", err)
+		context.Log("Error loading payload:", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	// Transactions with a future `post_at` are held until the time arrives
+	if transaction.PostAt != "" {
+		postAt, _ := time.Parse(models.LedgerTimestampLayout, transaction.PostAt)
+		if postAt.After(time.Now()) {
+			scheduleTransaction(w, r, context, transaction, postAt)
+			return
+		}
+	}
+	postTransaction(w, r, context, transaction)
+}
 
+// postTransaction creates the transaction unless it is invalid or already exists
+func postTransaction(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext, transaction *models.Transaction) {
+	// The account references are resolved before the transaction is compared with an existing one
+	if aerr := resolveAccountRefs(context, transaction); aerr != nil {
+		context.Log("Transaction accounts can't be resolved:", transaction.ID, aerr)
+		writePostError(w, aerr)
+		return
+	}
 	// Skip if the transaction is invalid
 	// by validating the delta values
 	if !transaction.IsValid() {
-		log.Println("Transaction is invalid:", transaction.ID)
+		context.Log("Transaction is invalid:", transaction.ID)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	if !checkMetadataWrite(w, context, transaction.Data) {
+		return
+	}
 
 	transactionsDB := models.NewTransactionDB(context.DB)
 	// Check if a transaction with same ID already exists
 	isExists, err := transactionsDB.IsExists(transaction.ID)
 	if err != nil {
-		log.Println("Error while checking for existing transaction:", err)
+		context.Log("Error while checking for existing transaction:", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	if isExists {
-		// Check if the transaction lines are different
-		// and conflicts with the existing lines
-		isConflict, err := transactionsDB.IsConflict(transaction)
+		// Check if the transaction lines are different and conflict with the existing lines,
+		// or if the transaction is repeated beyond the idempotency window of the ledger
+		replay, err := transactionsDB.Replay(transaction)
 		if err != nil {
-			log.Println("Error while checking for conflicting transaction:", err)
+			context.Log("Error while checking for conflicting transaction:", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		if isConflict {
+		duplicates.track(middlewares.CredentialID(r), transaction.ID, replay)
+		switch replay.Kind {
+		case models.ReplayConflict:
 			// The conflicting transactions are denied
-			log.Println("Transaction is conflicting:", transaction.ID)
+			context.Log("Transaction is conflicting:", transaction.ID)
 			w.WriteHeader(http.StatusConflict)
 			return
+		case models.ReplayExpired:
+			context.Log("Transaction is repeated beyond idempotency window:", transaction.ID)
+			writeErrorResponse(w, http.StatusConflict, models.TransactionReplayExpiredError(transaction.ID, replay.Window))
+			return
 		}
-		// Otherwise the transaction is just a duplicate
+		// Otherwise the transaction is just a duplicate, or its lines are ignored as per the settings
 		// The exactly duplicate transactions are ignored
-		// log.Println("Transaction is duplicate:", transaction.ID)
+		// context.Log("Transaction is duplicate:", transaction.ID)
 		w.WriteHeader(http.StatusAccepted)
 		return
 	}
 
-	// Otherwise, do transaction
-	done := transactionsDB.Transact(transaction)
-	if !done {
-		log.Println("Transaction failed:", transaction.ID)
+	// Signed transactions are accepted only with a valid signature
+	if transaction.Signature != nil {
+		valid, err := verifyTransactionSignature(context, transaction)
+		if err != nil {
+			context.Log("Error while verifying transaction signature:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !valid {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The posting hooks can reject the transaction
+	if aerr := checkPostingHooks(context, transaction); aerr != nil {
+		context.Log("Transaction failed posting hooks:", transaction.ID, aerr)
+		writePostError(w, aerr)
+		return
+	}
+
+	// The transaction and its new accounts are counted against the quotas of the client
+	client := middlewares.ClientKey(r)
+	newAccounts, qerr, reset, aerr := reserveTransactionQuota(context, client, transaction.AccountIDs())
+	if aerr != nil {
+		context.Log("Error while checking quotas:", aerr)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if qerr != nil {
+		context.Log("Transaction exceeds quota:", transaction.ID, qerr)
+		writeQuotaError(w, qerr, reset)
+		return
+	}
+
+	// Otherwise, do transaction
+	created, aerr := transactionsDB.Post(transaction)
+	if aerr != nil {
+		quotas.release(client, newAccounts, 1)
+		context.Log("Transaction failed:", transaction.ID, aerr)
+		writePostError(w, aerr)
+		return
+	}
+	if !created {
+		// The transaction was created meanwhile by a concurrent request, which notifies and counts it
+		quotas.release(client, newAccounts, 1)
+		context.Log("Transaction is duplicate:", transaction.ID)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	notifyWebhooks(context, WebhookEventTransactionCreated, transaction)
+	w.Header().Set(ContentHashHeader, transaction.ContentHash)
 	w.WriteHeader(http.StatusCreated)
 	return
 }
 
+// ErrorResponse represents the response body of the errors with a code
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writePostError writes the response of a failed transaction with the error code, which is a
+// `422 Unprocessable Entity` when the transaction violates the constraints of its accounts, has account
+// references which can't be resolved or is rejected by a posting hook, and a `503 Service Unavailable`
+// when a posting hook is unavailable
+func writePostError(w http.ResponseWriter, aerr ledgerError.ApplicationError) {
+	var status int
+	switch aerr.ErrorCode() {
+	case "account.frozen", "account.min_balance", "posting_hook.rejected",
+		"account_ref.unmatched", "account_ref.unresolved", "account_ref.ambiguous":
+		status = http.StatusUnprocessableEntity
+	case "posting_hook.unavailable":
+		status = http.StatusServiceUnavailable
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeErrorResponse(w, status, aerr)
+}
+
+// writeErrorResponse writes the response of the error with its code and the status
+func writeErrorResponse(w http.ResponseWriter, status int, aerr ledgerError.ApplicationError) {
+	data, err := json.Marshal(&ErrorResponse{Code: aerr.ErrorCode(), Message: aerr.ErrorMessage()})
+	if err != nil {
+		log.Println("Error while parsing error response:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
 // GetTransactions returns the list of transactions that matches the search query
 func GetTransactions(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Println("Error reading payload:", err)
+		context.Log("Error reading payload:", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -114,30 +214,36 @@ func GetTransactions(w http.ResponseWriter, r *http.Request, context *ledgerCont
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	engine.UseMetadataScope(context.Metadata)
 	query := string(body)
 
+	// Paginated searches can be consistent by querying the same pinned read snapshot
+	if r.Header.Get(ReadSnapshotHeader) != "" {
+		tx, aerr := beginRead(r, context)
+		if aerr != nil {
+			writeReadError(w, aerr)
+			return
+		}
+		defer tx.Rollback()
+		engine.UseTx(tx)
+	}
 	results, aerr := engine.Query(query)
 	if aerr != nil {
-		log.Println("Error while querying:", aerr)
+		context.Log("Error while querying:", aerr)
 		switch aerr.ErrorCode() {
 		case "search.query.invalid":
 			w.WriteHeader(http.StatusBadRequest)
 			return
+		case "metadata.read_forbidden":
+			writeErrorResponse(w, http.StatusForbidden, aerr)
+			return
 		default:
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 	}
 
-	data, err := json.Marshal(results)
-	if err != nil {
-		log.Println("Error while parsing results:", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.Write(data)
+	writeData(w, r, context, http.StatusOK, results, nil, searchMeta(r, query, results))
 	return
 }
 
@@ -146,7 +252,7 @@ func UpdateTransaction(w http.ResponseWriter, r *http.Request, context *ledgerCo
 	transaction := &models.Transaction{}
 	err := unmarshalToTransaction(r, transaction)
 	if err != nil {
-		log.Println("Error loading payload:", err)
+		context.Log("Error loading payload:", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -155,23 +261,195 @@ func UpdateTransaction(w http.ResponseWriter, r *http.Request, context *ledgerCo
 	// Check if a transaction with same ID already exists
 	isExists, err := transactionDB.IsExists(transaction.ID)
 	if err != nil {
-		log.Println("Error while checking for existing transaction:", err)
+		context.Log("Error while checking for existing transaction:", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	if !isExists {
-		log.Println("Transaction doesn't exist:", transaction.ID)
+		context.Log("Transaction doesn't exist:", transaction.ID)
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
+	if context.Metadata.IsRestricted() {
+		existing, aerr := transactionDB.GetByID(transaction.ID)
+		if aerr != nil {
+			context.Log("Error while getting transaction:", aerr)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var ok bool
+		if transaction.Data, ok = checkMetadataUpdate(w, context, existing.Data, transaction.Data); !ok {
+			return
+		}
+	}
+
+	// Data of reconciled transactions is locked
+	linesDB := models.NewLineDB(context.DB)
+	isReconciled, err := linesDB.IsTransactionReconciled(transaction.ID)
+	if err != nil {
+		context.Log("Error while checking for reconciled transaction:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if isReconciled {
+		context.Log("Transaction is reconciled:", transaction.ID)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	// Data of signed transactions is locked, as their signature covers the data
+	signatureDB := models.NewSignatureDB(context.DB)
+	isSigned, err := signatureDB.IsSigned(transaction.ID)
+	if err != nil {
+		context.Log("Error while checking for signed transaction:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if isSigned {
+		context.Log("Transaction is signed:", transaction.ID)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
 	// Otherwise, update transaction
 	terr := transactionDB.UpdateTransaction(transaction)
 	if terr != nil {
-		log.Printf("Error while updating transaction: %v (%v)", transaction.ID, terr)
+		context.Logf("Error while updating transaction: %v (%v)", transaction.ID, terr)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	return
 }
+
+// PostTransactionAction handles the `POST /v1/transactions/_search`, `POST /v1/transactions/_bulk`
+// and `POST /v1/transactions/{id}/reverse` requests, which share a catch-all route as the router doesn't allow both
+func PostTransactionAction(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	action := r.URL.Path[strings.LastIndex(r.URL.Path, "/v1/transactions/")+len("/v1/transactions/"):]
+	if action == "_search" {
+		GetTransactions(w, r, context)
+		return
+	}
+	if action == "_bulk" {
+		MakeBulkTransactions(w, r, context)
+		return
+	}
+	if id := strings.TrimSuffix(action, "/reverse"); id != action && id != "" {
+		ReverseTransaction(w, r, context, id)
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+	return
+}
+
+// GetTransactionAction handles the `GET /v1/transactions/_export`, `GET /v1/transactions/{id}/signature`,
+// `GET /v1/transactions/{id}/proof` and `GET /v1/transactions/{id}` requests
+func GetTransactionAction(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	action := r.URL.Path[strings.LastIndex(r.URL.Path, "/v1/transactions/")+len("/v1/transactions/"):]
+	if action == "_export" {
+		ExportTransactions(w, r, context)
+		return
+	}
+	if id := strings.TrimSuffix(action, "/signature"); id != action && id != "" {
+		GetTransactionSignature(w, r, context, id)
+		return
+	}
+	if id := strings.TrimSuffix(action, "/proof"); id != action && id != "" {
+		GetTransactionProof(w, r, context, id)
+		return
+	}
+	if action != "" && !strings.Contains(action, "/") {
+		GetTransactionInfo(w, r, context, action)
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+	return
+}
+
+// ReverseTransaction creates a transaction negating the lines of the transaction with the input ID
+func ReverseTransaction(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext, id string) {
+	transactionDB := models.NewTransactionDB(context.DB)
+	transaction, err := transactionDB.GetByID(id)
+	if err != nil {
+		context.Log("Error while getting transaction:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if transaction == nil {
+		context.Log("Transaction doesn't exist:", id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// A transaction can be reversed only once
+	isReversed, err := transactionDB.IsReversed(id)
+	if err != nil {
+		context.Log("Error while checking for reversed transaction:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if isReversed {
+		context.Log("Transaction is already reversed:", id)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	reversal := transaction.Reversal()
+	if aerr := checkPostingHooks(context, reversal); aerr != nil {
+		context.Log("Transaction reversal failed posting hooks:", id, aerr)
+		writePostError(w, aerr)
+		return
+	}
+	created, aerr := transactionDB.Post(reversal)
+	if aerr != nil {
+		context.Log("Transaction reversal failed:", id, aerr)
+		writePostError(w, aerr)
+		return
+	}
+	if !created {
+		// The transaction was reversed meanwhile by a concurrent request
+		context.Log("Transaction is already reversed:", id)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	notifyWebhooks(context, WebhookEventTransactionCreated, reversal)
+
+	writeData(w, r, context, http.StatusCreated, reversal, transactionLinks(r, reversal, false), nil)
+	return
+}
+
+// GetTransactionInfo returns the transaction with its lines
+func GetTransactionInfo(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext, id string) {
+	transactionDB := models.NewTransactionDB(context.DB)
+	transaction, aerr := transactionDB.GetByID(id)
+	if aerr != nil {
+		context.Log("Error while getting transaction:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if transaction == nil {
+		context.Log("Transaction doesn't exist:", id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	data := context.Metadata.FilterData(transaction.Data)
+	if len(data) != len(transaction.Data) {
+		// The content hash covers the data keys which can't be read
+		transaction.ContentHash = ""
+	}
+	transaction.Data = data
+	var links Links
+	if useEnvelope(r) {
+		reversed, aerr := transactionDB.IsReversed(id)
+		if aerr != nil {
+			context.Log("Error while checking for reversed transaction:", aerr)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		links = transactionLinks(r, transaction, reversed)
+	}
+
+	writeData(w, r, context, http.StatusOK, transaction, links, nil)
+	return
+}
@@ -0,0 +1,25 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePostError(t *testing.T) {
+	rr := httptest.NewRecorder()
+	writePostError(rr, models.AccountMinBalanceError("alice", "USD"))
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "Invalid response code")
+	var response ErrorResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.Equal(t, nil, err, "Invalid response body")
+	assert.Equal(t, "account.min_balance", response.Code, "Invalid error code")
+
+	rr = httptest.NewRecorder()
+	writePostError(rr, models.DBError(assert.AnError))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code, "Invalid response code")
+}
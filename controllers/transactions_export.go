@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+// Formats of the transactions export
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+)
+
+// exportFlushInterval is the number of exported lines after which the response is flushed
+const exportFlushInterval = 1000
+
+var validDataKey = regexp.MustCompile(`^[a-z_A-Z]+$`)
+
+// exportLineColumns are the columns of the CSV export
+var exportLineColumns = []string{"id", "transaction_id", "account", "delta", "currency", "timestamp", "data"}
+
+// exportFormat returns the format of the transactions export from the `format` query parameter,
+// or else from the `Accept` header. NDJSON is the default.
+func exportFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case ExportFormatCSV, ExportFormatNDJSON:
+		return format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("Invalid export format: %v", format)
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		switch strings.TrimSpace(strings.Split(accept, ";")[0]) {
+		case "text/csv":
+			return ExportFormatCSV, nil
+		case "application/x-ndjson":
+			return ExportFormatNDJSON, nil
+		}
+	}
+	return ExportFormatNDJSON, nil
+}
+
+// exportFilter returns the filter of the exported lines from the `account`, `from`, `to`
+// and `data.{key}` query parameters
+func exportFilter(params url.Values) (*models.LineExportFilter, error) {
+	filter := &models.LineExportFilter{AccountID: params.Get("account"), Data: make(map[string]string)}
+	if value := params.Get("from"); value != "" {
+		from, err := parseAsOf(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid from: %v", value)
+		}
+		filter.From = &from
+	}
+	if value := params.Get("to"); value != "" {
+		to, err := parseAsOf(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid to: %v", value)
+		}
+		filter.To = &to
+	}
+	for param := range params {
+		if !strings.HasPrefix(param, "data.") {
+			continue
+		}
+		key := strings.TrimPrefix(param, "data.")
+		if !validDataKey.MatchString(key) {
+			return nil, fmt.Errorf("Invalid data key: %v", key)
+		}
+		filter.Data[key] = params.Get(param)
+	}
+	return filter, nil
+}
+
+// ExportTransactions streams the transaction lines matching the filters of the query as CSV or NDJSON,
+// as of the pinned read snapshot of the request if any
+func ExportTransactions(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	format, err := exportFormat(r)
+	if err != nil {
+		context.Log("Error in transactions export query:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	filter, err := exportFilter(r.URL.Query())
+	if err != nil {
+		context.Log("Error in transactions export query:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for key := range filter.Data {
+		if !context.Metadata.CanRead(key) {
+			writeErrorResponse(w, http.StatusForbidden, models.MetadataKeyForbiddenError("read", key))
+			return
+		}
+	}
+
+	tx, aerr := beginRead(r, context)
+	if aerr != nil {
+		writeReadError(w, aerr)
+		return
+	}
+	defer tx.Rollback()
+
+	var csvWriter *csv.Writer
+	var encoder *json.Encoder
+	if format == ExportFormatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		csvWriter = csv.NewWriter(w)
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+		encoder = json.NewEncoder(w)
+	}
+	flusher, _ := w.(http.Flusher)
+
+	count := 0
+	writeLine := func(line *models.Line) error {
+		if count == 0 && csvWriter != nil {
+			if err := csvWriter.Write(exportLineColumns); err != nil {
+				return err
+			}
+		}
+		count++
+		line.Data = context.Metadata.FilterData(line.Data)
+		if encoder != nil {
+			if err := encoder.Encode(line); err != nil {
+				return err
+			}
+		} else {
+			data, err := json.Marshal(line.Data)
+			if err != nil {
+				return err
+			}
+			err = csvWriter.Write([]string{strconv.FormatInt(line.ID, 10), line.TransactionID, line.AccountID,
+				strconv.Itoa(line.Delta), line.Currency, line.Timestamp, string(data)})
+			if err != nil {
+				return err
+			}
+		}
+		if count%exportFlushInterval == 0 {
+			if csvWriter != nil {
+				csvWriter.Flush()
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	}
+
+	lineDB := models.NewLineDB(context.DB)
+	if aerr := lineDB.Export(tx, filter, writeLine); aerr != nil {
+		context.Log("Error while exporting transactions:", aerr)
+		// The status is already sent after the first line, so a failed export is only detectable by the log
+		if count == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	if csvWriter != nil {
+		if count == 0 {
+			csvWriter.Write(exportLineColumns)
+		}
+		csvWriter.Flush()
+	}
+	return
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportFormat(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/v1/transactions/_export", nil)
+	format, err := exportFormat(req)
+	assert.Equal(t, nil, err, "Error in export format")
+	assert.Equal(t, ExportFormatNDJSON, format, "NDJSON should be the default format")
+
+	req.Header.Set("Accept", "application/json, text/csv;q=0.9")
+	format, _ = exportFormat(req)
+	assert.Equal(t, ExportFormatCSV, format, "Format should be negotiated from the Accept header")
+
+	req, _ = http.NewRequest("GET", "/v1/transactions/_export?format=ndjson", nil)
+	req.Header.Set("Accept", "text/csv")
+	format, _ = exportFormat(req)
+	assert.Equal(t, ExportFormatNDJSON, format, "Format parameter should take precedence")
+
+	req, _ = http.NewRequest("GET", "/v1/transactions/_export?format=xml", nil)
+	_, err = exportFormat(req)
+	assert.NotEqual(t, nil, err, "Invalid format should fail")
+}
+
+func TestExportFilter(t *testing.T) {
+	params, _ := url.ParseQuery("account=alice&from=2017-01-01&to=2017-01-31 23:59:59.999&data.invoice=INV-1")
+	filter, err := exportFilter(params)
+	assert.Equal(t, nil, err, "Error in export filter")
+	assert.Equal(t, "alice", filter.AccountID, "Invalid account")
+	assert.Equal(t, "2017-01-01 00:00:00.000", filter.From.Format("2006-01-02 15:04:05.000"), "Invalid from")
+	assert.Equal(t, "2017-01-31 23:59:59.999", filter.To.Format("2006-01-02 15:04:05.000"), "Invalid to")
+	assert.Equal(t, map[string]string{"invoice": "INV-1"}, filter.Data, "Invalid data filter")
+
+	for _, query := range []string{"from=yesterday", "to=2017-13-01", "data.in-voice=1"} {
+		params, _ := url.ParseQuery(query)
+		_, err := exportFilter(params)
+		assert.NotEqual(t, nil, err, "Filter should be invalid: "+query)
+	}
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"bytes"
 	"database/sql"
+	"encoding/json"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -11,6 +12,7 @@ import (
 
 	ledgerContext "github.com/RealImage/QLedger/context"
 	"github.com/RealImage/QLedger/middlewares"
+	"github.com/RealImage/QLedger/models"
 
 	_ "github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
@@ -251,6 +253,111 @@ func (ts *TransactionsSuite) TestCreateTransactionWithBoundaryValues() {
 	assert.Equal(t, http.StatusBadRequest, rr1.Code, "Invalid response code")
 }
 
+func (ts *TransactionsSuite) TestReverseTransaction() {
+	t := ts.T()
+
+	payload := `{
+	  "id": "t010",
+	  "lines": [
+	    {
+	      "account": "alice",
+	      "delta": 100
+	    },
+	    {
+	      "account": "bob",
+	      "delta": -100
+	    }
+	  ]
+	}`
+	handler := middlewares.ContextMiddleware(MakeTransaction, ts.context)
+	req, err := http.NewRequest("POST", TransactionsAPI, bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code, "Invalid response code")
+
+	// A transaction claiming to reverse it doesn't block its reversal
+	payload = `{
+	  "id": "t011",
+	  "lines": [
+	    {
+	      "account": "alice",
+	      "delta": -1
+	    },
+	    {
+	      "account": "bob",
+	      "delta": 1
+	    }
+	  ],
+	  "data": {"reverses": "t010"}
+	}`
+	req, err = http.NewRequest("POST", TransactionsAPI, bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code, "Invalid response code")
+
+	// A transaction can't take the ID of its reversal
+	payload = `{
+	  "id": "t010.reversal",
+	  "lines": [
+	    {
+	      "account": "alice",
+	      "delta": -1
+	    },
+	    {
+	      "account": "bob",
+	      "delta": 1
+	    }
+	  ]
+	}`
+	req, err = http.NewRequest("POST", TransactionsAPI, bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Invalid response code")
+
+	// Reversal
+	handler = middlewares.ContextMiddleware(PostTransactionAction, ts.context)
+	req, err = http.NewRequest("POST", TransactionsAPI+"/t010/reverse", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code, "Invalid response code")
+	reversal := &models.Transaction{}
+	err = json.Unmarshal(rr.Body.Bytes(), reversal)
+	assert.Equal(t, nil, err, "Invalid response body")
+	assert.Equal(t, "t010.reversal", reversal.ID, "Invalid reversal ID")
+	assert.Equal(t, "t010", reversal.Data["reverses"], "Invalid reversal link")
+	assert.Equal(t, -100, reversal.Lines[0].Delta, "Invalid reversal delta")
+
+	// Double reversal
+	req, err = http.NewRequest("POST", TransactionsAPI+"/t010/reverse", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code, "Invalid response code")
+
+	// Missing transaction
+	req, err = http.NewRequest("POST", TransactionsAPI+"/t404/reverse", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Invalid response code")
+}
+
 func (ts *TransactionsSuite) TearDownSuite() {
 	log.Println("Cleaning up the test database")
 
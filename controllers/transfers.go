@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+// MakeTransfer creates a new transaction from the transfer shorthand in the request data
+func MakeTransfer(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		context.Log("Error reading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	transfer := &models.Transfer{}
+	err = json.Unmarshal(body, transfer)
+	if err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// Use the latest rate of the source unless the rate is given
+	if transfer.IsFX() && transfer.Rate == 0 && transfer.RateSource != "" {
+		fxRateDB := models.NewFXRateDB(context.DB)
+		rate, aerr := fxRateDB.GetRate(transfer.RateSource, transfer.FromCurrency, transfer.ToCurrency)
+		if aerr != nil {
+			context.Log("Error while getting FX rate:", aerr)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if rate == nil {
+			context.Logf("FX rate not found: %v %v/%v", transfer.RateSource, transfer.FromCurrency, transfer.ToCurrency)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		transfer.Rate = rate.Rate
+	}
+	if err := transfer.Validate(); err != nil {
+		context.Log("Transfer is invalid:", transfer.ID, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	transaction := transfer.ToTransaction()
+	if err := transaction.ValidateData(); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	postTransaction(w, r, context, transaction)
+}
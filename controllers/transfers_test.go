@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	TransfersAPI = "/v1/transfers"
+)
+
+func TestInvalidTransfer(t *testing.T) {
+	payloads := []string{
+		`{INVALID PAYLOAD}`,
+		`{"id": "tr001", "from": "alice", "to": "alice", "amount": 100}`,
+		`{"id": "tr001", "from": "alice", "to": "bob", "amount": -100}`,
+		`{"id": "tr001", "from": "alice", "to": "bob", "amount": 100, "data": {"invalid-key": 1}}`,
+		`{"id": "tr001", "from": "alice", "to": "bob", "amount": 100, "timestamp": "2017-01-01"}`,
+	}
+	handler := middlewares.ContextMiddleware(MakeTransfer, nil)
+	for _, payload := range payloads {
+		req, err := http.NewRequest("POST", TransfersAPI, bytes.NewBufferString(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "Invalid response code for payload: %v", payload)
+	}
+}
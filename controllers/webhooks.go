@@ -0,0 +1,343 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+)
+
+const (
+	// WebhookSignatureHeader carries the HMAC-SHA256 signature of the payload with the webhook secret
+	WebhookSignatureHeader = "X-Ledger-Signature"
+	// WebhookEventHeader carries the event of the payload
+	WebhookEventHeader = "X-Ledger-Event"
+	// WebhookDeliveryHeader carries the ID of the delivery, which is the same on retries
+	WebhookDeliveryHeader = "X-Ledger-Delivery"
+
+	// WebhookEventTransactionCreated is sent after a transaction is committed
+	WebhookEventTransactionCreated = "transaction.created"
+
+	maxWebhookAttempts = 10
+	webhookBatchSize   = 50
+	webhookLease       = time.Minute
+)
+
+var validWebhookID = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// webhookWakeup triggers the dispatcher as soon as deliveries are enqueued
+var webhookWakeup = make(chan struct{}, 1)
+
+// WebhookPayload represents the signed JSON body posted to the webhooks
+type WebhookPayload struct {
+	Event string `json:"event"`
+	// Version is the version of the schema of the data of the event
+	Version   int         `json:"version"`
+	CreatedAt string      `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// signWebhookPayload returns the hex HMAC-SHA256 of the payload with the secret
+func signWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff returns the delay before the next attempt after the given number of failed attempts,
+// doubling from 10 seconds up to an hour
+func webhookBackoff(attempts int) time.Duration {
+	delay := 10 * time.Second
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
+
+// notifyWebhooks enqueues the deliveries of an event to all the webhooks.
+// Failures are only logged, as the event has already happened.
+func notifyWebhooks(context *ledgerContext.AppContext, event string, data interface{}) {
+	payload := &WebhookPayload{
+		Event:     event,
+		Version:   eventVersion(event),
+		CreatedAt: time.Now().UTC().Format(models.LedgerTimestampLayout),
+		Data:      data,
+	}
+	webhookDB := models.NewWebhookDB(context.DB)
+	if aerr := webhookDB.Enqueue(event, payload); aerr != nil {
+		context.Log("Error while enqueuing webhook deliveries:", event, aerr)
+		return
+	}
+	select {
+	case webhookWakeup <- struct{}{}:
+	default:
+	}
+}
+
+// deliverWebhook posts the signed payload of the delivery to its webhook
+func deliverWebhook(delivery *models.WebhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set(WebhookSignatureHeader, signWebhookPayload(delivery.Secret, delivery.Payload))
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookEventVersionHeader, strconv.Itoa(eventVersion(delivery.Event)))
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Webhook responded with status: %v", resp.Status)
+	}
+	return nil
+}
+
+// DeliverDueWebhooks attempts the due deliveries and records their outcome
+func DeliverDueWebhooks(context *ledgerContext.AppContext) {
+	webhookDB := models.NewWebhookDB(context.DB)
+	for {
+		deliveries, aerr := webhookDB.ClaimDue(webhookBatchSize, webhookLease)
+		if aerr != nil {
+			context.Log("Error while claiming webhook deliveries:", aerr)
+			return
+		}
+		for _, delivery := range deliveries {
+			err := deliverWebhook(delivery)
+			if err == nil {
+				aerr = webhookDB.MarkDelivered(delivery.ID)
+			} else {
+				context.Log("Error while delivering webhook:", delivery.WebhookID, delivery.ID, err)
+				var next time.Time
+				if attempts := delivery.Attempts + 1; attempts < maxWebhookAttempts {
+					next = time.Now().Add(webhookBackoff(attempts))
+				}
+				aerr = webhookDB.MarkAttemptFailed(delivery.ID, err.Error(), next)
+			}
+			if aerr != nil {
+				context.Log("Error while recording webhook delivery:", delivery.ID, aerr)
+			}
+		}
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// DispatchWebhooks delivers the pending webhook deliveries when they are enqueued and at every interval
+func DispatchWebhooks(context *ledgerContext.AppContext, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-webhookWakeup:
+		}
+		if IsReadOnly() {
+			continue
+		}
+		DeliverDueWebhooks(context)
+	}
+}
+
+// GetWebhooks returns all the webhooks
+func GetWebhooks(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	webhookDB := models.NewWebhookDB(context.DB)
+	webhooks, aerr := webhookDB.List()
+	if aerr != nil {
+		context.Log("Error while getting webhooks:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(webhooks)
+	if err != nil {
+		context.Log("Error while parsing webhooks:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// AddWebhook creates a webhook with a subscriber URL and a signing secret
+func AddWebhook(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	// The events carry all the data of the transactions, which the API keys with a metadata scope may not read
+	if context.Metadata.IsRestricted() {
+		context.Log("Webhooks can't be added by API key with metadata scope")
+		writeErrorResponse(w, http.StatusForbidden, models.MetadataScopeForbiddenError("add webhooks"))
+		return
+	}
+	webhook := &models.Webhook{}
+	if err := json.NewDecoder(r.Body).Decode(webhook); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	u, err := url.Parse(webhook.URL)
+	if !validWebhookID.MatchString(webhook.ID) || err != nil || (u.Scheme != "http" && u.Scheme != "https") || webhook.Secret == "" {
+		context.Log("Invalid webhook:", webhook.ID)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	webhookDB := models.NewWebhookDB(context.DB)
+	if aerr := webhookDB.Create(webhook); aerr != nil {
+		context.Log("Error while creating webhook:", aerr)
+		switch aerr.ErrorCode() {
+		case "webhook.exists":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	return
+}
+
+// DeleteWebhook removes the webhook with the `id` query parameter along with its deliveries
+func DeleteWebhook(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	id := r.URL.Query().Get("id")
+	webhookDB := models.NewWebhookDB(context.DB)
+	deleted, aerr := webhookDB.Delete(id)
+	if aerr != nil {
+		context.Log("Error while deleting webhook:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		context.Log("Webhook doesn't exist:", id)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	return
+}
+
+// GetWebhookDeliveries returns the latest webhook deliveries along with their last errors,
+// optionally filtered by `webhook` and `status`
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	params := r.URL.Query()
+	status := params.Get("status")
+	switch status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliveryDelivered, models.WebhookDeliveryFailed,
+		models.WebhookDeliveryDiscarded:
+	default:
+		context.Log("Invalid status in webhook deliveries query:", status)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			context.Log("Invalid limit in webhook deliveries query:", value)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	webhookDB := models.NewWebhookDB(context.DB)
+	deliveries, aerr := webhookDB.GetDeliveries(params.Get("webhook"), status, limit)
+	if aerr != nil {
+		context.Log("Error while getting webhook deliveries:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(deliveries)
+	if err != nil {
+		context.Log("Error while parsing webhook deliveries:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// ReplayRequest represents the webhook deliveries to be replayed or discarded
+type ReplayRequest struct {
+	Deliveries []int64 `json:"deliveries"`
+}
+
+// ReplayWebhookDeliveries resets the given deliveries, or all the failed deliveries, to be delivered again
+func ReplayWebhookDeliveries(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	request := &ReplayRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	webhookDB := models.NewWebhookDB(context.DB)
+	count, aerr := webhookDB.Replay(request.Deliveries)
+	if aerr != nil {
+		context.Log("Error while replaying webhook deliveries:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	select {
+	case webhookWakeup <- struct{}{}:
+	default:
+	}
+
+	data, err := json.Marshal(map[string]int64{"replayed": count})
+	if err != nil {
+		context.Log("Error while parsing replay result:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
+
+// DiscardWebhookDeliveries gives up on the given pending or failed deliveries, or all the failed deliveries
+func DiscardWebhookDeliveries(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+	request := &ReplayRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		context.Log("Error loading payload:", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	webhookDB := models.NewWebhookDB(context.DB)
+	count, aerr := webhookDB.Discard(request.Deliveries)
+	if aerr != nil {
+		context.Log("Error while discarding webhook deliveries:", aerr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(map[string]int64{"discarded": count})
+	if err != nil {
+		context.Log("Error while parsing discard result:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+	return
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RealImage/QLedger/middlewares"
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	payload := []byte(`{"event":"transaction.created"}`)
+	signature := signWebhookPayload("secret", payload)
+	assert.Equal(t, "sha256=", signature[:7], "Invalid signature scheme")
+	assert.Equal(t, 7+64, len(signature), "Invalid signature length")
+	assert.True(t, hmac.Equal([]byte(signature), []byte(signWebhookPayload("secret", payload))), "Signature should be deterministic")
+	assert.NotEqual(t, signature, signWebhookPayload("other", payload), "Signature should depend on the secret")
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, webhookBackoff(1), "Invalid first backoff")
+	assert.Equal(t, 20*time.Second, webhookBackoff(2), "Invalid second backoff")
+	assert.Equal(t, 80*time.Second, webhookBackoff(4), "Invalid fourth backoff")
+	assert.Equal(t, time.Hour, webhookBackoff(20), "Backoff should be capped")
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	delivery := &models.WebhookDelivery{
+		ID:      42,
+		Event:   WebhookEventTransactionCreated,
+		Payload: []byte(`{"event":"transaction.created"}`),
+		URL:     server.URL,
+		Secret:  "secret",
+	}
+	assert.Nil(t, deliverWebhook(delivery), "Error delivering webhook")
+	assert.Equal(t, signWebhookPayload("secret", delivery.Payload), received.Header.Get(WebhookSignatureHeader), "Invalid signature")
+	assert.Equal(t, "42", received.Header.Get(WebhookDeliveryHeader), "Invalid delivery ID")
+	assert.Equal(t, "1", received.Header.Get(WebhookEventVersionHeader), "Invalid event version")
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	delivery.URL = failing.URL
+	assert.NotNil(t, deliverWebhook(delivery), "Failed delivery should return error")
+}
+
+func TestInvalidWebhookDeliveriesRequests(t *testing.T) {
+	handler := middlewares.ContextMiddleware(GetWebhookDeliveries, nil)
+	for _, query := range []string{"?status=lost", "?limit=0", "?status=discarded&limit=x"} {
+		req, err := http.NewRequest("GET", "/v1/webhooks/deliveries"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "Invalid response code for query: %v", query)
+	}
+
+	handler = middlewares.ContextMiddleware(DiscardWebhookDeliveries, nil)
+	req, err := http.NewRequest("POST", "/v1/webhooks/_discard", bytes.NewBufferString(`{"deliveries": ["42"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Invalid response code")
+}
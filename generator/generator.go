@@ -0,0 +1,261 @@
+// Package generator generates realistic synthetic accounts and transactions, such as for demos,
+// benchmarks and UI development. The data is deterministic: the same options always generate
+// the same accounts and transactions.
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/RealImage/QLedger/models"
+)
+
+// Accounts other than the customers and merchants
+const (
+	FeesAccount = "fees"
+	BankAccount = "bank"
+)
+
+// customersPerMerchant is the number of customers per merchant
+const customersPerMerchant = 20
+
+// maxRefundable is the number of the latest purchases which can be refunded
+const maxRefundable = 1000
+
+var customerSegments = []string{"retail", "retail", "retail", "premium", "business"}
+
+// Options are the options of the generated data
+type Options struct {
+	// Accounts is the number of customer and merchant accounts
+	Accounts int
+	Profile  *Profile
+	// Days is the number of days of transactions, which end before the `End` day
+	Days int
+	End  time.Time
+	Seed int64
+}
+
+// Validate checks whether the data can be generated with the options
+func (o *Options) Validate() error {
+	switch {
+	case o.Accounts < 2:
+		return errors.New("At least 2 accounts are needed")
+	case o.Profile == nil:
+		return errors.New("Missing profile")
+	case o.Days <= 0:
+		return errors.New("Days should be positive")
+	}
+	return nil
+}
+
+// Generator generates the accounts and transactions of the options
+type Generator struct {
+	options   Options
+	customers int
+	merchants int
+	start     time.Time
+}
+
+// New returns a generator of the options
+func New(options Options) (*Generator, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	merchants := options.Accounts / (customersPerMerchant + 1)
+	if merchants == 0 {
+		merchants = 1
+	}
+	end := options.End.UTC().Truncate(24 * time.Hour)
+	return &Generator{
+		options:   options,
+		customers: options.Accounts - merchants,
+		merchants: merchants,
+		start:     end.AddDate(0, 0, -options.Days),
+	}, nil
+}
+
+func customerID(i int) string {
+	return fmt.Sprintf("customer-%06d", i+1)
+}
+
+func merchantID(i int) string {
+	return fmt.Sprintf("merchant-%04d", i+1)
+}
+
+// merchantType returns the type of a merchant, which is fixed by its position
+func (g *Generator) merchantType(i int) string {
+	types := g.options.Profile.MerchantTypes
+	return types[i%len(types)]
+}
+
+// Accounts returns the customer, merchant, fees and bank accounts with their data
+func (g *Generator) Accounts() []*models.Account {
+	random := rand.New(rand.NewSource(g.options.Seed))
+	accounts := make([]*models.Account, 0, g.options.Accounts+2)
+	for i := 0; i < g.customers; i++ {
+		accounts = append(accounts, &models.Account{
+			ID: customerID(i),
+			Data: map[string]interface{}{
+				"type":    "customer",
+				"segment": customerSegments[random.Intn(len(customerSegments))],
+			},
+		})
+	}
+	for i := 0; i < g.merchants; i++ {
+		accounts = append(accounts, &models.Account{
+			ID:   merchantID(i),
+			Data: map[string]interface{}{"type": "merchant", "merchant_type": g.merchantType(i)},
+		})
+	}
+	accounts = append(accounts,
+		&models.Account{ID: FeesAccount, Data: map[string]interface{}{"type": "fees"}},
+		&models.Account{ID: BankAccount, Data: map[string]interface{}{"type": "bank"}},
+	)
+	return accounts
+}
+
+// purchase is a refundable purchase
+type purchase struct {
+	id       string
+	customer string
+	merchant string
+	amount   int
+	fee      int
+	currency string
+}
+
+// Transactions generates the transactions in the order of their timestamps, and stops at the first error of emit
+func (g *Generator) Transactions(emit func(*models.Transaction) error) error {
+	profile := g.options.Profile
+	// The transactions are generated from a different source than the accounts,
+	// so that the accounts don't change the transactions
+	random := rand.New(rand.NewSource(g.options.Seed + 1))
+	// Some customers and merchants are much busier than others
+	customers := rand.NewZipf(random, 1.1, 1, uint64(g.customers-1))
+	merchants := rand.NewZipf(random, 1.2, 1, uint64(g.merchants-1))
+
+	hourlyTotal := 0.0
+	for _, weight := range profile.Hourly {
+		hourlyTotal += weight
+	}
+	if hourlyTotal == 0 {
+		return errors.New("Profile has no hourly volume")
+	}
+
+	var purchases []*purchase
+	count := 0
+	for day := 0; day < g.options.Days; day++ {
+		date := g.start.AddDate(0, 0, day)
+		expected := profile.Rate * float64(g.customers)
+		if weekday := date.Weekday(); weekday == time.Saturday || weekday == time.Sunday {
+			expected *= profile.Weekend
+		}
+		volume := int(math.Round(expected + random.NormFloat64()*math.Sqrt(expected)))
+		if volume < 0 {
+			volume = 0
+		}
+
+		// The timestamps of the day are drawn first, so that the transactions are in order
+		offsets := make([]time.Duration, 0, volume)
+		for i := 0; i < volume; i++ {
+			offsets = append(offsets, hourOf(random, profile.Hourly, hourlyTotal)+
+				time.Duration(random.Int63n(int64(time.Hour/time.Millisecond)))*time.Millisecond)
+		}
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+		for _, offset := range offsets {
+			count++
+			id := fmt.Sprintf("gen-%d-%08d", g.options.Seed, count)
+			timestamp := date.Add(offset).Format(models.LedgerTimestampLayout)
+			currency := profile.Currencies[random.Intn(len(profile.Currencies))]
+			customer := customerID(int(customers.Uint64()))
+
+			var txn *models.Transaction
+			switch kind := random.Float64(); {
+			case kind < profile.RefundRate && len(purchases) > 0:
+				i := random.Intn(len(purchases))
+				refunded := purchases[i]
+				purchases = append(purchases[:i], purchases[i+1:]...)
+				txn = &models.Transaction{
+					ID:   id,
+					Data: map[string]interface{}{"type": "refund", "refunds": refunded.id, "generated": true},
+					Lines: []*models.TransactionLine{
+						{AccountID: refunded.merchant, Delta: -(refunded.amount - refunded.fee), Currency: refunded.currency},
+						{AccountID: FeesAccount, Delta: -refunded.fee, Currency: refunded.currency},
+						{AccountID: refunded.customer, Delta: refunded.amount, Currency: refunded.currency},
+					},
+				}
+			case kind < profile.RefundRate+profile.TopupRate:
+				amount := g.amount(random) * 4
+				txn = &models.Transaction{
+					ID:   id,
+					Data: map[string]interface{}{"type": "topup", "generated": true},
+					Lines: []*models.TransactionLine{
+						{AccountID: BankAccount, Delta: -amount, Currency: currency},
+						{AccountID: customer, Delta: amount, Currency: currency},
+					},
+				}
+			default:
+				m := int(merchants.Uint64())
+				p := &purchase{id: id, customer: customer, merchant: merchantID(m), amount: g.amount(random), currency: currency}
+				p.fee = int(math.Round(float64(p.amount) * profile.FeeRate))
+				txn = &models.Transaction{
+					ID:   id,
+					Data: map[string]interface{}{"type": "purchase", "merchant_type": g.merchantType(m), "generated": true},
+					Lines: []*models.TransactionLine{
+						{AccountID: p.customer, Delta: -p.amount, Currency: currency},
+						{AccountID: p.merchant, Delta: p.amount - p.fee, Currency: currency},
+						{AccountID: FeesAccount, Delta: p.fee, Currency: currency},
+					},
+				}
+				purchases = append(purchases, p)
+				if len(purchases) > maxRefundable {
+					purchases = purchases[1:]
+				}
+			}
+			txn.Timestamp = timestamp
+			txn.Lines = nonZeroLines(txn.Lines)
+			if err := emit(txn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// amount returns a log-normal amount around the median of the profile, of at least a minor unit
+func (g *Generator) amount(random *rand.Rand) int {
+	profile := g.options.Profile
+	amount := int(math.Round(profile.MedianAmount * math.Exp(random.NormFloat64()*profile.AmountSpread)))
+	if amount < 1 {
+		return 1
+	}
+	return amount
+}
+
+// hourOf returns the start of an hour of the day drawn by the hourly weights
+func hourOf(random *rand.Rand, hourly [24]float64, total float64) time.Duration {
+	target := random.Float64() * total
+	for hour, weight := range hourly {
+		if target < weight {
+			return time.Duration(hour) * time.Hour
+		}
+		target -= weight
+	}
+	return 23 * time.Hour
+}
+
+// nonZeroLines removes the lines without a delta, such as the fees rounded to zero
+func nonZeroLines(lines []*models.TransactionLine) []*models.TransactionLine {
+	result := lines[:0]
+	for _, line := range lines {
+		if line.Delta != 0 {
+			result = append(result, line)
+		}
+	}
+	return result
+}
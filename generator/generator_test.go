@@ -0,0 +1,60 @@
+package generator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func generate(t *testing.T, options Options) []*models.Transaction {
+	g, err := New(options)
+	if !assert.Nil(t, err, "Error creating generator") {
+		return nil
+	}
+	var txns []*models.Transaction
+	err = g.Transactions(func(txn *models.Transaction) error {
+		txns = append(txns, txn)
+		return nil
+	})
+	assert.Nil(t, err, "Error generating transactions")
+	return txns
+}
+
+func TestGenerateDeterministic(t *testing.T) {
+	options := Options{Accounts: 210, Profile: Profiles["ecommerce"], Days: 7, End: time.Date(2017, 2, 1, 0, 0, 0, 0, time.UTC), Seed: 42}
+	txns := generate(t, options)
+	assert.NotEmpty(t, txns, "Transactions should be generated")
+	assert.Equal(t, txns, generate(t, options), "Same options should generate the same transactions")
+
+	options.Seed = 43
+	assert.NotEqual(t, txns, generate(t, options), "Different seeds should generate different transactions")
+}
+
+func TestGenerateValidTransactions(t *testing.T) {
+	for name, profile := range Profiles {
+		options := Options{Accounts: 100, Profile: profile, Days: 3, End: time.Date(2017, 2, 1, 0, 0, 0, 0, time.UTC), Seed: 1}
+		ids := make(map[string]bool)
+		last := ""
+		for _, txn := range generate(t, options) {
+			assert.True(t, txn.IsValid(), "Transaction should be balanced: %v %v", name, txn.ID)
+			assert.False(t, ids[txn.ID], "Transaction IDs should be unique: %v", txn.ID)
+			ids[txn.ID] = true
+			assert.True(t, txn.Timestamp >= "2017-01-29" && txn.Timestamp < "2017-02-01", "Timestamp out of range: %v", txn.Timestamp)
+			assert.True(t, txn.Timestamp >= last, "Transactions should be in order: %v", txn.ID)
+			last = txn.Timestamp
+		}
+	}
+}
+
+func TestGenerateAccounts(t *testing.T) {
+	g, _ := New(Options{Accounts: 42, Profile: Profiles["flat"], Days: 1, Seed: 1})
+	accounts := g.Accounts()
+	assert.Equal(t, 44, len(accounts), "Accounts should include the fees and bank accounts")
+	assert.Equal(t, "customer-000001", accounts[0].ID, "Invalid customer account")
+	assert.Equal(t, "merchant-0001", accounts[40].ID, "Invalid merchant account")
+
+	_, err := New(Options{Accounts: 1, Profile: Profiles["flat"], Days: 1})
+	assert.NotNil(t, err, "Generator should need at least 2 accounts")
+}
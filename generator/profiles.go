@@ -0,0 +1,72 @@
+package generator
+
+// Profile shapes the synthetic transactions of a ledger, by their volume over the days and hours,
+// their amounts, and the mix of purchases, refunds and top-ups
+type Profile struct {
+	Name string
+	// Rate is the mean number of transactions per customer per day
+	Rate float64
+	// Hourly are the relative volumes of the hours of a day (UTC)
+	Hourly [24]float64
+	// Weekend scales the volume of Saturdays and Sundays
+	Weekend float64
+	// MedianAmount and AmountSpread are the median and the log-normal spread of the amounts,
+	// in the minor units of the currencies
+	MedianAmount float64
+	AmountSpread float64
+	// FeeRate is the share of the purchases taken as fees
+	FeeRate float64
+	// RefundRate and TopupRate are the shares of the transactions which refund an earlier purchase,
+	// and which top up the balance of a customer
+	RefundRate float64
+	TopupRate  float64
+	Currencies []string
+	// MerchantTypes are the types of the merchants, which are recorded in the purchase data
+	MerchantTypes []string
+}
+
+// Profiles are the available profiles by name
+var Profiles = map[string]*Profile{
+	// Shoppers peak in the evenings and on weekends, with frequent small purchases and some refunds
+	"ecommerce": {
+		Name:          "ecommerce",
+		Rate:          0.05,
+		Hourly:        [24]float64{2, 1, 1, 1, 1, 1, 2, 3, 4, 5, 5, 6, 7, 6, 6, 6, 7, 8, 10, 12, 12, 10, 6, 3},
+		Weekend:       1.4,
+		MedianAmount:  2500,
+		AmountSpread:  0.9,
+		FeeRate:       0.029,
+		RefundRate:    0.03,
+		TopupRate:     0.1,
+		Currencies:    []string{"USD"},
+		MerchantTypes: []string{"grocery", "electronics", "fashion", "books", "travel"},
+	},
+	// Payments happen in business hours on weekdays, with larger amounts in several currencies
+	"banking": {
+		Name:          "banking",
+		Rate:          0.2,
+		Hourly:        [24]float64{0, 0, 0, 0, 0, 0, 1, 3, 8, 10, 10, 10, 8, 9, 10, 10, 9, 6, 3, 2, 1, 1, 0, 0},
+		Weekend:       0.2,
+		MedianAmount:  15000,
+		AmountSpread:  1.3,
+		FeeRate:       0.001,
+		RefundRate:    0.005,
+		TopupRate:     0.25,
+		Currencies:    []string{"USD", "EUR", "GBP"},
+		MerchantTypes: []string{"utilities", "rent", "payroll", "insurance", "tax"},
+	},
+	// A constant load around the clock, such as for benchmarks
+	"flat": {
+		Name:          "flat",
+		Rate:          1,
+		Hourly:        [24]float64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+		Weekend:       1,
+		MedianAmount:  1000,
+		AmountSpread:  0.5,
+		FeeRate:       0.01,
+		RefundRate:    0.01,
+		TopupRate:     0.1,
+		Currencies:    []string{"USD"},
+		MerchantTypes: []string{"general"},
+	},
+}
@@ -0,0 +1,188 @@
+// Package ledger embeds the ledger in a Go service, posting transactions and reading balances
+// in-process without the HTTP API. It reads and writes the same DB schema as the ledger server,
+// so a service and the server can share a ledger.
+package ledger
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/RealImage/QLedger/models"
+	_ "github.com/lib/pq"
+	"github.com/mattes/migrate"
+	"github.com/mattes/migrate/database"
+	"github.com/mattes/migrate/database/postgres"
+	_ "github.com/mattes/migrate/source/file"
+)
+
+// Ledger is a ledger embedded in-process on its DB
+type Ledger struct {
+	db *sql.DB
+}
+
+// Open connects to the ledger DB of the data source name, such as `postgres://localhost/ledger`
+func Open(dsn string) (*Ledger, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return New(db), nil
+}
+
+// New returns the ledger on an open DB
+func New(db *sql.DB) *Ledger {
+	return &Ledger{db: db}
+}
+
+// DB returns the DB of the ledger
+func (l *Ledger) DB() *sql.DB {
+	return l.db
+}
+
+// Close closes the DB of the ledger
+func (l *Ledger) Close() error {
+	return l.db.Close()
+}
+
+// PostTransaction posts the transaction unless it is invalid or violates the constraints of its accounts.
+// As with the HTTP API, the data and the signature of the transaction are validated, posting the same
+// transaction again within the idempotency window is ignored, and a different transaction with the same ID fails.
+func (l *Ledger) PostTransaction(txn *models.Transaction) error {
+	if txn.ID == "" {
+		return errors.New("Missing transaction ID")
+	}
+	if err := txn.ValidateData(); err != nil {
+		return err
+	}
+	ruleDB := models.NewRoutingRuleDB(l.db)
+	if aerr := ruleDB.ResolveLines(txn.Lines); aerr != nil {
+		return aerr
+	}
+	if !txn.IsValid() {
+		return fmt.Errorf("Transaction is invalid: %v", txn.ID)
+	}
+	transactionDB := models.NewTransactionDB(l.db)
+	isExists, aerr := transactionDB.IsExists(txn.ID)
+	if aerr != nil {
+		return aerr
+	}
+	if isExists {
+		replay, aerr := transactionDB.Replay(txn)
+		if aerr != nil {
+			return aerr
+		}
+		switch replay.Kind {
+		case models.ReplayConflict:
+			return models.TransactionConflictError(txn.ID)
+		case models.ReplayExpired:
+			return models.TransactionReplayExpiredError(txn.ID, replay.Window)
+		}
+		return nil
+	}
+	if txn.Signature != nil {
+		signatureDB := models.NewSignatureDB(l.db)
+		valid, aerr := signatureDB.Verify(txn)
+		if aerr != nil {
+			return aerr
+		}
+		if !valid {
+			return fmt.Errorf("Transaction signature is invalid: %v", txn.ID)
+		}
+	}
+	_, aerr = transactionDB.Post(txn)
+	return asError(aerr)
+}
+
+// Transaction returns the transaction with the given ID, or nil if it doesn't exist
+func (l *Ledger) Transaction(id string) (*models.Transaction, error) {
+	transactionDB := models.NewTransactionDB(l.db)
+	transaction, aerr := transactionDB.GetByID(id)
+	if aerr != nil {
+		return nil, aerr
+	}
+	return transaction, nil
+}
+
+// Account returns the account with its balances in every currency
+func (l *Ledger) Account(id string) (*models.Account, error) {
+	accountDB := models.NewAccountDB(l.db)
+	account, aerr := accountDB.GetByID(id)
+	if aerr != nil {
+		return nil, aerr
+	}
+	return account, nil
+}
+
+// Balance returns the balance of the account, which sums up the lines without a currency
+func (l *Ledger) Balance(accountID string) (int, error) {
+	account, err := l.Account(accountID)
+	if err != nil {
+		return 0, err
+	}
+	return account.Balance, nil
+}
+
+// Balances returns the balance of each currency of the account
+func (l *Ledger) Balances(accountID string) (map[string]int, error) {
+	account, err := l.Account(accountID)
+	if err != nil {
+		return nil, err
+	}
+	return account.Balances, nil
+}
+
+// Migrate migrates the DB schema to the latest version of the migration files at the path,
+// such as `file://migrations/postgres`. It returns `migrate.ErrLocked` or `database.ErrLocked`
+// when another instance holds the migration lock.
+func Migrate(db *sql.DB, migrationFilesPath string) error {
+	log.Println("Starting db schema migration...")
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		return fmt.Errorf("Unable to create database instance for migration: %v", err)
+	}
+
+	m, err := migrate.NewWithDatabaseInstance(
+		migrationFilesPath,
+		"postgres", driver)
+	if err != nil {
+		return fmt.Errorf("Unable to create Migrate instance for database: %v", err)
+	}
+
+	version, dirty, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return fmt.Errorf("Unable to get existing migration version for database: %v %v", dirty, err)
+	}
+	log.Println("Current schema version:", version)
+	err = m.Up()
+	if err != nil {
+		switch err {
+		case migrate.ErrNoChange:
+			log.Println("No changes to migrate")
+		case migrate.ErrLocked, database.ErrLocked:
+			return err
+		default:
+			return fmt.Errorf("Error while migration: %v", err)
+		}
+	}
+	version, dirty, err = m.Version()
+	if err != nil {
+		return fmt.Errorf("Unable to get new migration version for database: %v %v", dirty, err)
+	}
+	log.Println("Migrated schema version:", version)
+	return nil
+}
+
+// asError returns the application error as an `error`, which is nil when there is no error
+func asError(aerr ledgerError.ApplicationError) error {
+	if aerr == nil {
+		return nil
+	}
+	return aerr
+}
@@ -0,0 +1,88 @@
+package ledger
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestPostInvalidTransaction(t *testing.T) {
+	l := New(nil)
+	invalid := []*models.Transaction{
+		{Lines: []*models.TransactionLine{{AccountID: "alice", Delta: 100}, {AccountID: "bob", Delta: -100}}},
+		{ID: "t001", Lines: []*models.TransactionLine{{AccountID: "alice", Delta: 100}, {AccountID: "bob", Delta: -50}}},
+		{ID: "t002", Data: map[string]interface{}{"tag-1": "x"}, Lines: []*models.TransactionLine{{AccountID: "alice", Delta: 100}, {AccountID: "bob", Delta: -100}}},
+		{ID: "t003", Lines: []*models.TransactionLine{{AccountID: "alice", Delta: 100, Currency: "usd"}, {AccountID: "bob", Delta: -100, Currency: "usd"}}},
+		{ID: "t004", Timestamp: "2017-01-01", Lines: []*models.TransactionLine{{AccountID: "alice", Delta: 100}, {AccountID: "bob", Delta: -100}}},
+	}
+	for _, txn := range invalid {
+		assert.NotNil(t, l.PostTransaction(txn), "Transaction should not be posted: %v", txn.ID)
+	}
+}
+
+type LedgerSuite struct {
+	suite.Suite
+	ledger *Ledger
+}
+
+func (ls *LedgerSuite) SetupTest() {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(ls.T(), databaseURL)
+	l, err := Open(databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	}
+	ls.ledger = l
+}
+
+func (ls *LedgerSuite) TestPostTransaction() {
+	t := ls.T()
+	before, err := ls.ledger.Balance("embedded_alice")
+	assert.Nil(t, err, "Error while getting balance")
+
+	txn := &models.Transaction{
+		ID: "embedded_t001",
+		Lines: []*models.TransactionLine{
+			{AccountID: "embedded_alice", Delta: 100},
+			{AccountID: "embedded_bob", Delta: -100},
+		},
+	}
+	assert.Nil(t, ls.ledger.PostTransaction(txn), "Error while posting transaction")
+	assert.Nil(t, ls.ledger.PostTransaction(txn), "Duplicate transaction should be ignored")
+	balance, err := ls.ledger.Balance("embedded_alice")
+	assert.Nil(t, err, "Error while getting balance")
+	assert.Equal(t, before+100, balance, "Invalid balance")
+
+	conflicting := &models.Transaction{
+		ID: "embedded_t001",
+		Lines: []*models.TransactionLine{
+			{AccountID: "embedded_alice", Delta: 50},
+			{AccountID: "embedded_bob", Delta: -50},
+		},
+	}
+	assert.NotNil(t, ls.ledger.PostTransaction(conflicting), "Conflicting transaction should fail")
+
+	transaction, err := ls.ledger.Transaction("embedded_t001")
+	assert.Nil(t, err, "Error while getting transaction")
+	assert.Equal(t, 2, len(transaction.Lines), "Invalid transaction lines")
+}
+
+func (ls *LedgerSuite) TearDownSuite() {
+	t := ls.T()
+	db := ls.ledger.DB()
+	if _, err := db.Exec("DELETE FROM lines WHERE transaction_id = $1", "embedded_t001"); err != nil {
+		t.Fatal("Error deleting lines:", err)
+	}
+	if _, err := db.Exec("DELETE FROM transactions WHERE id = $1", "embedded_t001"); err != nil {
+		t.Fatal("Error deleting transactions:", err)
+	}
+	ls.ledger.Close()
+}
+
+func TestLedgerSuite(t *testing.T) {
+	suite.Run(t, new(LedgerSuite))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemd passes the activated sockets starting from this file descriptor
+const systemdListenFDsStart = 3
+
+// systemdListeners returns the sockets passed by systemd socket activation keyed by their names.
+// Sockets without a name (`FileDescriptorName=`) are keyed by their position.
+func systemdListeners() (map[string]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count == 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	listeners := make(map[string]net.Listener)
+	for i := 0; i < count; i++ {
+		name := strconv.Itoa(i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(systemdListenFDsStart+i), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid systemd socket %v: %v", name, err)
+		}
+		listeners[name] = listener
+	}
+	return listeners, nil
+}
+
+// listenUnix listens on the Unix domain socket path, removing any stale socket left by a previous run
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// listen returns the listener for the given address.
+// Addresses prefixed with `unix:` are Unix domain socket paths, others are TCP addresses.
+func listen(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, "unix:") {
+		return listenUnix(strings.TrimPrefix(addr, "unix:"))
+	}
+	return net.Listen("tcp", addr)
+}
@@ -1,22 +1,68 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"net/http/pprof"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/RealImage/QLedger/config"
+	"github.com/RealImage/QLedger/consumer"
 	ledgerContext "github.com/RealImage/QLedger/context"
 	"github.com/RealImage/QLedger/controllers"
+	"github.com/RealImage/QLedger/ledger"
+	"github.com/RealImage/QLedger/metrics"
 	"github.com/RealImage/QLedger/middlewares"
+	"github.com/RealImage/QLedger/models"
+	"github.com/RealImage/QLedger/rounding"
+	"github.com/RealImage/QLedger/sheets"
+	"github.com/RealImage/QLedger/slo"
+	"github.com/RealImage/QLedger/tenants"
 	"github.com/julienschmidt/httprouter"
 	"github.com/mattes/migrate"
 	"github.com/mattes/migrate/database"
-	"github.com/mattes/migrate/database/postgres"
-	_ "github.com/mattes/migrate/source/file"
 )
 
+// shutdownTimeout is the maximum time to wait for the in-flight requests on termination
+const shutdownTimeout = 30 * time.Second
+
+// regionCheckInterval is the interval of refreshing the role of the region of the server
+const regionCheckInterval = 5 * time.Second
+
+// tenantMigrationAttempts is the number of seconds to wait for the migration lock of a tenant
+const tenantMigrationAttempts = 30
+
 func main() {
+	// Load settings of the config file, if any, over the environment
+	if err := config.Load(); err != nil {
+		log.Fatal("Unable to load config file:", err)
+	}
+	// `QLedger migrate` only migrates the DB schema, such as in an init container
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(migrateCommand(os.Args[2:]))
+	}
+	// `QLedger observability export` only writes the dashboard and alert rules of the metrics
+	if len(os.Args) > 1 && os.Args[1] == "observability" {
+		os.Exit(observabilityCommand(os.Args[2:]))
+	}
+	// `QLedger mock` serves the core API from memory, without a DB
+	if len(os.Args) > 1 && os.Args[1] == "mock" {
+		os.Exit(mockCommand(os.Args[2:]))
+	}
+
+	// The token is read on every request, so it can be rotated by a reload
+	config.Reloadable("LEDGER_AUTH_TOKEN")
+
 	// Assert authentication
 	authToken, ok := os.LookupEnv("LEDGER_AUTH_TOKEN")
 	if !ok || authToken == "" {
@@ -29,15 +75,138 @@ func main() {
 	}
 	log.Println("Successfully established connection to database.")
 
-	// Migrate DB changes
-	migrateDB(db)
+	if prefix := os.Getenv("FX_ACCOUNT_PREFIX"); prefix != "" {
+		models.FXAccountPrefix = prefix
+	}
+	setRoundingPolicies()
+	setQuotas()
 
-	appContext := &ledgerContext.AppContext{DB: db}
-	router := httprouter.New()
+	if value := os.Getenv("RESPONSE_ENVELOPE"); value != "" {
+		controllers.ResponseEnvelope, err = strconv.ParseBool(value)
+		if err != nil {
+			log.Fatal("Invalid RESPONSE_ENVELOPE:", value)
+		}
+	}
+	controllers.MerkleAnchorURL = os.Getenv("MERKLE_ANCHOR_URL")
+	merkleInterval, err := merkleTreeInterval()
+	if err != nil {
+		log.Fatal(err)
+	}
+	controllers.DrainDelay, controllers.MaxReplicationLag, err = readinessSettings()
+	if err != nil {
+		log.Fatal(err)
+	}
+	controllers.InvariantCheckInterval, controllers.InvariantCheckSampleRate, err = invariantCheckSettings()
+	if err != nil {
+		log.Fatal(err)
+	}
+	controllers.DormancyPeriod, controllers.DormancyCheckInterval, err = dormancySettings()
+	if err != nil {
+		log.Fatal(err)
+	}
+	source, err := consumerSource()
+	if err != nil {
+		log.Fatal(err)
+	}
+	sheet, sheetInterval, err := sheetSettings()
+	if err != nil {
+		log.Fatal(err)
+	}
+	controllers.Region, controllers.PeerRegionURL, controllers.PeerRegionToken = regionSettings()
 
+	// Without tenant isolation the server has a single ledger in the database.
+	// Otherwise, the ledger of every tenant is migrated and its jobs are started on its first request.
+	appContext := &ledgerContext.AppContext{DB: db}
+	middlewares.RegisterDBStats("default", db)
+	tenantIsolation := os.Getenv("TENANT_ISOLATION")
+	if tenantIsolation == "" {
+		// Migrate DB changes
+		migrateDB(db)
+	} else {
+		if source != nil {
+			log.Fatal("Consuming transactions from a queue is not supported with TENANT_ISOLATION")
+		}
+		if sheet != nil {
+			log.Fatal("Syncing transactions from a sheet is not supported with TENANT_ISOLATION")
+		}
+		if controllers.Region != "" {
+			log.Fatal("Failover of the regions is not supported with TENANT_ISOLATION")
+		}
+		// The shared database holds the ledgers of the tenants and their API keys
+		migrateDB(db)
+		ledgerDB := models.NewLedgerDB(db)
+		appContext.APIKey = ledgerDB.ResolveKey
+		registry, err := tenants.NewRegistry(tenantIsolation, os.Getenv("DATABASE_URL"), db,
+			func(tenant string, tenantContext *ledgerContext.AppContext) error {
+				if err := migrateTenantDB(tenantContext.DB); err != nil {
+					return err
+				}
+				middlewares.RegisterDBStats(tenant, tenantContext.DB)
+				startJobs(tenantContext, merkleInterval)
+				return nil
+			})
+		if err != nil {
+			log.Fatal(err)
+		}
+		appContext.Tenant = registry.Context
+		controllers.OpenLedger = registry.Context
+		controllers.LedgerTemplates, err = ledgerTemplates()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Isolating tenants by:", tenantIsolation)
+		// The listed tenants are opened upfront, so that their jobs run before their first requests
+		for _, tenant := range strings.Split(os.Getenv("TENANTS"), ",") {
+			if tenant = strings.TrimSpace(tenant); tenant == "" {
+				continue
+			}
+			if _, err := registry.Context(tenant); err != nil {
+				log.Println("Unable to open tenant:", tenant, err)
+			}
+		}
+	}
 	hostPrefix := os.Getenv("HOST_PREFIX")
+	router := newRouter(hostPrefix)
+
+	// Sockets passed by systemd socket activation take precedence over the configured addresses
+	activatedListeners, err := systemdListeners()
+	if err != nil {
+		log.Fatal("Unable to use systemd sockets:", err)
+	}
+
+	// Transfers are posted as transactions, so they share the same SLO
+	transactionsSLO := newTransactionsSLO()
+
 	// Monitors
 	router.HandlerFunc(http.MethodGet, hostPrefix+"/ping", controllers.Ping)
+	// Readiness is of the shared database, as the tenant ledgers are in the same database or server
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/ready",
+		middlewares.ContextMiddleware(controllers.Ready, &ledgerContext.AppContext{DB: db}))
+
+	// Admin endpoints are served from a separate listener when `ADMIN_ADDR` is set
+	// or an `admin` socket is activated by systemd
+	adminAddr := os.Getenv("ADMIN_ADDR")
+	adminListener, ok := activatedListeners["admin"]
+	if !ok && adminAddr != "" {
+		adminListener, err = listen(adminAddr)
+		if err != nil {
+			log.Fatal("Unable to listen on admin address:", err)
+		}
+	}
+	if adminListener == nil {
+		addAdminRoutes(router, appContext, hostPrefix)
+	} else {
+		adminRouter := newRouter(hostPrefix)
+		adminRouter.HandlerFunc(http.MethodGet, hostPrefix+"/ping", controllers.Ping)
+		addAdminRoutes(adminRouter, appContext, hostPrefix)
+		// Profiling is never exposed on the public listener
+		adminRouter.HandlerFunc(http.MethodGet, "/debug/pprof/*profile", profiling)
+		adminRouter.HandlerFunc(http.MethodPost, "/debug/pprof/*profile", profiling)
+		go func() {
+			log.Println("Running admin server on:", adminListener.Addr())
+			log.Fatal(http.Serve(adminListener, middlewares.RequestLogMiddleware(adminRouter.ServeHTTP)))
+		}()
+	}
 
 	// Create accounts and transactions
 	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/accounts",
@@ -45,7 +214,20 @@ func main() {
 			middlewares.ContextMiddleware(controllers.AddAccount, appContext)))
 	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/transactions",
 		middlewares.TokenAuthMiddleware(
-			middlewares.ContextMiddleware(controllers.MakeTransaction, appContext)))
+			middlewares.SLOMiddleware(
+				middlewares.ContextMiddleware(controllers.MakeTransaction, appContext),
+				transactionsSLO)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/transfers",
+		middlewares.TokenAuthMiddleware(
+			middlewares.SLOMiddleware(
+				middlewares.ContextMiddleware(controllers.MakeTransfer, appContext),
+				transactionsSLO)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/allocations",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.MakeAllocation, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/accounts/_import",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.ImportAccounts, appContext)))
 
 	// Read or search accounts and transactions
 	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/accounts",
@@ -54,12 +236,214 @@ func main() {
 	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/accounts/_search",
 		middlewares.TokenAuthMiddleware(
 			middlewares.ContextMiddleware(controllers.GetAccounts, appContext)))
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/accounts/*action",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetAccountAction, appContext)))
 	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/transactions",
 		middlewares.TokenAuthMiddleware(
 			middlewares.ContextMiddleware(controllers.GetTransactions, appContext)))
-	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/transactions/_search",
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/transactions/*action",
 		middlewares.TokenAuthMiddleware(
-			middlewares.ContextMiddleware(controllers.GetTransactions, appContext)))
+			middlewares.ContextMiddleware(controllers.GetTransactionAction, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/_msearch",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.MultiSearch, appContext)))
+	// Search and reversal of transactions
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/transactions/*action",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.PostTransactionAction, appContext)))
+
+	// Transactions scheduled to be posted in the future
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/scheduled_transactions",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetScheduledTransactions, appContext)))
+	router.HandlerFunc(http.MethodDelete, hostPrefix+"/v1/scheduled_transactions",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.CancelScheduledTransaction, appContext)))
+
+	// Reconciliation of transaction lines
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/lines",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetLines, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/lines/_reconcile",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.ReconcileLines, appContext)))
+
+	// Reports
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/reports/aging",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetAgingReport, appContext)))
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/reports/categories",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetCategoryReport, appContext)))
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/reports/definitions",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetReportDefinitions, appContext)))
+	router.HandlerFunc(http.MethodPut, hostPrefix+"/v1/reports/definitions",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.SaveReportDefinition, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/reports/_run",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.RunReport, appContext)))
+
+	// Snapshots of the lines and their diffs
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/snapshots",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetSnapshots, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/snapshots",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.CreateSnapshot, appContext)))
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/snapshots/_diff",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.DiffSnapshots, appContext)))
+
+	// Public keys of the clients signing transactions
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/keys",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetClientKeys, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/keys",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.AddClientKey, appContext)))
+	router.HandlerFunc(http.MethodDelete, hostPrefix+"/v1/keys",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.RevokeClientKey, appContext)))
+
+	// Merkle trees of the committed transactions for audits
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/merkle/trees",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetMerkleTrees, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/merkle/trees",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.CreateMerkleTree, appContext)))
+
+	// Webhooks notified of the posted transactions
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/webhooks",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetWebhooks, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/webhooks",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.AddWebhook, appContext)))
+	router.HandlerFunc(http.MethodDelete, hostPrefix+"/v1/webhooks",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.DeleteWebhook, appContext)))
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/webhooks/deliveries",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetWebhookDeliveries, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/webhooks/_replay",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.ReplayWebhookDeliveries, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/webhooks/_discard",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.DiscardWebhookDeliveries, appContext)))
+
+	// Schemas of the events sent to the webhooks and posting hooks
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/events/schemas",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetEventSchemas, appContext)))
+
+	// Posting hooks approving the transactions before they are posted
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/posting_hooks",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetPostingHooks, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/posting_hooks",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.AddPostingHook, appContext)))
+	router.HandlerFunc(http.MethodDelete, hostPrefix+"/v1/posting_hooks",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.DeletePostingHook, appContext)))
+
+	// Categorization rules of the transactions
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/categorization_rules",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetCategorizationRules, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/categorization_rules",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.AddCategorizationRule, appContext)))
+	router.HandlerFunc(http.MethodDelete, hostPrefix+"/v1/categorization_rules",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.DeleteCategorizationRule, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/categorization_rules/_backfill",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.BackfillCategories, appContext)))
+
+	// Routing rules resolving the account references of the transaction lines
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/routing_rules",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetRoutingRules, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/routing_rules",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.AddRoutingRule, appContext)))
+	router.HandlerFunc(http.MethodDelete, hostPrefix+"/v1/routing_rules",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.DeleteRoutingRule, appContext)))
+
+	// Cache policies of the account responses by account prefix
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/cache_policies",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetCachePolicies, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/cache_policies",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.AddCachePolicy, appContext)))
+	router.HandlerFunc(http.MethodDelete, hostPrefix+"/v1/cache_policies",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.DeleteCachePolicy, appContext)))
+
+	// Computed fields of the accounts
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/computed_fields",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetComputedFields, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/computed_fields",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.AddComputedField, appContext)))
+	router.HandlerFunc(http.MethodDelete, hostPrefix+"/v1/computed_fields",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.DeleteComputedField, appContext)))
+
+	// Read snapshots pinned for consistent paginated searches and exports
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/read_snapshots",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetReadSnapshots, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/read_snapshots",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.PinReadSnapshot, appContext)))
+	router.HandlerFunc(http.MethodDelete, hostPrefix+"/v1/read_snapshots",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.ReleaseReadSnapshot, appContext)))
+
+	// Export and import of the ledger in the canonical format
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/export",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.ExportLedger, appContext)))
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/export/schema",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetExportSchema, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/import",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.ImportLedger, appContext)))
+
+	// Idempotency settings of the transactions repeated with an existing transaction ID
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/idempotency",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetIdempotencySettings, appContext)))
+	router.HandlerFunc(http.MethodPut, hostPrefix+"/v1/idempotency",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.SetIdempotencySettings, appContext)))
+
+	// Retention of the history of webhook deliveries and scheduled transactions
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/retention",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetRetention, appContext)))
+	router.HandlerFunc(http.MethodPut, hostPrefix+"/v1/retention",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.SetRetention, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/retention/_purge",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.PurgeRetention, appContext)))
+
+	// Conversion rates of FX transfers
+	router.HandlerFunc(http.MethodPut, hostPrefix+"/v1/fx_rates",
+		middlewares.TokenAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.SetFXRate, appContext)))
 
 	// Update data of accounts and transactions
 	router.HandlerFunc(http.MethodPut, hostPrefix+"/v1/accounts",
@@ -69,12 +453,84 @@ func main() {
 		middlewares.TokenAuthMiddleware(
 			middlewares.ContextMiddleware(controllers.UpdateTransaction, appContext)))
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "7000"
+	listener, ok := activatedListeners["api"]
+	if !ok {
+		listener, ok = activatedListeners["0"]
+	}
+	if !ok {
+		addr := ":" + os.Getenv("PORT")
+		if socket := os.Getenv("UNIX_SOCKET"); socket != "" {
+			addr = "unix:" + socket
+		} else if addr == ":" {
+			addr = ":7000"
+		}
+		listener, err = listen(addr)
+		if err != nil {
+			log.Fatal("Unable to listen:", err)
+		}
+	}
+	rateLimiter := newRateLimiter()
+	loadShedder := newLoadShedder()
+	node := os.Getenv("LEDGER_NODE_ID")
+	if node == "" {
+		node, _ = os.Hostname()
+	}
+	server := &http.Server{
+		Handler: middlewares.RequestLogMiddleware(
+			middlewares.NodeMiddleware(
+				middlewares.CredentialMiddleware(
+					middlewares.RateLimitMiddleware(
+						middlewares.LoadSheddingMiddleware(
+							middlewares.ReadOnlyMiddleware(router.ServeHTTP, controllers.IsReadOnly, hostPrefix),
+							loadShedder, hostPrefix),
+						rateLimiter), appContext.APIKey), node)),
+	}
+	go func() {
+		log.Println("Running server on:", listener.Addr())
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	if appContext.Tenant == nil {
+		start := func() { startJobs(appContext, merkleInterval) }
+		if controllers.Region != "" {
+			// A standby region starts its jobs once it is promoted
+			go controllers.WatchRegion(appContext, regionCheckInterval, start)
+		} else {
+			start()
+		}
+	}
+	if source != nil {
+		go controllers.ConsumeTransactions(appContext, source)
+	}
+	if sheet != nil {
+		go controllers.SyncSheet(appContext, sheet, sheetInterval)
+	}
+	sdNotify("READY=1")
+	sdWatchdog()
+
+	// Reload the settings on SIGHUP and drain the in-flight requests on termination
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGTERM, os.Interrupt)
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		changed, err := config.Reload()
+		if err != nil {
+			log.Println("Error reloading config:", err)
+			continue
+		}
+		log.Println("Reloaded settings:", changed)
+	}
+	log.Println("Shutting down the server...")
+	sdNotify("STOPPING=1")
+	controllers.Drain()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("Error shutting down the server:", err)
 	}
-	log.Println("Running server on port:", port)
-	log.Fatal(http.ListenAndServe(":"+port, router))
 
 	defer func() {
 		if r := recover(); r != nil {
@@ -83,43 +539,546 @@ func main() {
 	}()
 }
 
-func migrateDB(db *sql.DB) {
-	log.Println("Starting db schema migration...")
-	driver, err := postgres.WithInstance(db, &postgres.Config{})
+// startJobs starts the background jobs of the ledger
+func startJobs(appContext *ledgerContext.AppContext, merkleInterval time.Duration) {
+	go controllers.ScheduleReports(appContext, time.Minute)
+	go controllers.DispatchWebhooks(appContext, 5*time.Second)
+	go controllers.ScheduleMerkleTrees(appContext, merkleInterval)
+	go controllers.ScheduleBalanceRollups(appContext, time.Hour)
+	go controllers.ScheduleDueTransactions(appContext, time.Second)
+	go controllers.ScheduleRetentionPurges(appContext, time.Hour)
+	if controllers.InvariantCheckInterval > 0 {
+		go controllers.ScheduleInvariantChecks(appContext, controllers.InvariantCheckInterval)
+	}
+	if controllers.DormancyPeriod > 0 {
+		go controllers.ScheduleDormancyChecks(appContext, controllers.DormancyCheckInterval)
+	}
+}
+
+// instrumentedRouter records the request metrics of every route by its pattern
+type instrumentedRouter struct {
+	*httprouter.Router
+	hostPrefix string
+}
+
+func newRouter(hostPrefix string) *instrumentedRouter {
+	return &instrumentedRouter{Router: httprouter.New(), hostPrefix: hostPrefix}
+}
+
+// HandlerFunc registers the handler of the route along with its request metrics,
+// and lists the route in the Postman collection
+func (r *instrumentedRouter) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	endpoint := strings.TrimPrefix(path, r.hostPrefix)
+	controllers.RegisterRoute(method, endpoint)
+	r.Router.HandlerFunc(method, path, middlewares.MetricsMiddleware(handler, method, endpoint))
+}
+
+// addAdminRoutes adds the admin and operational endpoints to the router
+func addAdminRoutes(router *instrumentedRouter, appContext *ledgerContext.AppContext, hostPrefix string) {
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/metrics",
+		middlewares.AdminAuthMiddleware(metrics.Handler))
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/admin/duplicates",
+		middlewares.AdminAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetDuplicates, appContext)))
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/admin/quotas",
+		middlewares.AdminAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetQuotas, appContext)))
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/admin/slos",
+		middlewares.AdminAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetSLOs, appContext)))
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/admin/metadata-keys",
+		middlewares.AdminAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetMetadataKeys, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/admin/reload",
+		middlewares.AdminAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.ReloadConfig, appContext)))
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/admin/clone",
+		middlewares.AdminAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.CloneLedger, appContext)))
+	// The drain endpoint is also served for GET, as Kubernetes pre-stop hooks can only send GET requests
+	router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/admin/drain",
+		middlewares.AdminAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.DrainServer, appContext)))
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/admin/drain",
+		middlewares.AdminAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.DrainServer, appContext)))
+	// Failover of the regions, which are promoted by the operators
+	if controllers.Region != "" {
+		router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/admin/region",
+			middlewares.AdminAuthMiddleware(
+				middlewares.ContextMiddleware(controllers.GetRegionStatus, appContext)))
+		router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/admin/region/_promote",
+			middlewares.AdminAuthMiddleware(
+				middlewares.ContextMiddleware(controllers.PromoteRegion, appContext)))
+		router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/admin/region/_fence",
+			middlewares.AdminAuthMiddleware(
+				middlewares.ContextMiddleware(controllers.FenceRegion, appContext)))
+	}
+	router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/admin/postman",
+		middlewares.AdminAuthMiddleware(
+			middlewares.ContextMiddleware(controllers.GetPostmanCollection, appContext)))
+
+	// Ledgers of the tenants, which are kept in the shared database
+	if appContext.Tenant != nil {
+		sharedContext := &ledgerContext.AppContext{DB: appContext.DB}
+		router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/admin/ledgers",
+			middlewares.AdminAuthMiddleware(
+				middlewares.ContextMiddleware(controllers.GetLedgers, sharedContext)))
+		router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/admin/ledgers",
+			middlewares.AdminAuthMiddleware(
+				middlewares.ContextMiddleware(controllers.AddLedger, sharedContext)))
+		router.HandlerFunc(http.MethodGet, hostPrefix+"/v1/admin/api_keys",
+			middlewares.AdminAuthMiddleware(
+				middlewares.ContextMiddleware(controllers.GetAPIKeys, sharedContext)))
+		router.HandlerFunc(http.MethodPost, hostPrefix+"/v1/admin/api_keys",
+			middlewares.AdminAuthMiddleware(
+				middlewares.ContextMiddleware(controllers.AddAPIKey, sharedContext)))
+		router.HandlerFunc(http.MethodDelete, hostPrefix+"/v1/admin/api_keys",
+			middlewares.AdminAuthMiddleware(
+				middlewares.ContextMiddleware(controllers.RevokeAPIKey, sharedContext)))
+	}
+}
+
+// profiling serves the runtime profiling data of `net/http/pprof`
+func profiling(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, "/debug/pprof/") {
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Index(w, r)
+	}
+}
+
+// transactionsSLOTargets returns the latency target and objective of the transaction posting endpoint
+func transactionsSLOTargets() (time.Duration, float64, error) {
+	latencyTarget := 500 * time.Millisecond
+	if value := os.Getenv("SLO_TRANSACTIONS_LATENCY_MS"); value != "" {
+		ms, err := strconv.Atoi(value)
+		if err != nil || ms <= 0 {
+			return 0, 0, fmt.Errorf("Invalid SLO_TRANSACTIONS_LATENCY_MS: %v", value)
+		}
+		latencyTarget = time.Duration(ms) * time.Millisecond
+	}
+	objective := 0.999
+	if value := os.Getenv("SLO_TRANSACTIONS_OBJECTIVE"); value != "" {
+		o, err := strconv.ParseFloat(value, 64)
+		if err != nil || o <= 0 || o >= 1 {
+			return 0, 0, fmt.Errorf("Invalid SLO_TRANSACTIONS_OBJECTIVE: %v", value)
+		}
+		objective = o
+	}
+	return latencyTarget, objective, nil
+}
+
+// newTransactionsSLO returns the SLO tracker of the transaction posting endpoints
+func newTransactionsSLO() *slo.Tracker {
+	latencyTarget, objective, err := transactionsSLOTargets()
 	if err != nil {
-		log.Panic("Unable to create database instance for migration:", err)
+		log.Fatal(err)
 	}
+	tracker := slo.NewTracker("transactions_post", latencyTarget, objective)
 
-	migrationFilesPath := os.Getenv("MIGRATION_FILES_PATH")
-	if migrationFilesPath == "" {
-		migrationFilesPath = "file://migrations/postgres"
+	config.Reloadable("SLO_TRANSACTIONS_LATENCY_MS", "SLO_TRANSACTIONS_OBJECTIVE")
+	config.OnReload(func() {
+		latencyTarget, objective, err := transactionsSLOTargets()
+		if err != nil {
+			log.Println("Ignoring reloaded SLO targets:", err)
+			return
+		}
+		tracker.SetTargets(latencyTarget, objective)
+	})
+	return tracker
+}
+
+// merkleTreeInterval returns the interval of building the Merkle trees of the committed transactions
+func merkleTreeInterval() (time.Duration, error) {
+	interval := 10 * time.Minute
+	if value := os.Getenv("MERKLE_TREE_INTERVAL_SECONDS"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return 0, fmt.Errorf("Invalid MERKLE_TREE_INTERVAL_SECONDS: %v", value)
+		}
+		interval = time.Duration(seconds) * time.Second
+	}
+	return interval, nil
+}
+
+// invariantCheckSettings returns the interval of the invariant checks, which are disabled by default,
+// and the share of the transactions they check
+func invariantCheckSettings() (time.Duration, float64, error) {
+	var interval time.Duration
+	if value := os.Getenv("INVARIANT_CHECK_INTERVAL_SECONDS"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return 0, 0, fmt.Errorf("Invalid INVARIANT_CHECK_INTERVAL_SECONDS: %v", value)
+		}
+		interval = time.Duration(seconds) * time.Second
+	}
+	rate := 0.1
+	if value := os.Getenv("INVARIANT_CHECK_SAMPLE_RATE"); value != "" {
+		r, err := strconv.ParseFloat(value, 64)
+		if err != nil || r <= 0 || r > 1 {
+			return 0, 0, fmt.Errorf("Invalid INVARIANT_CHECK_SAMPLE_RATE: %v", value)
+		}
+		rate = r
+	}
+	return interval, rate, nil
+}
+
+// dormancySettings returns the period without transactions after which the accounts are dormant,
+// which are never dormant by default, and the interval of checking the dormancy
+func dormancySettings() (time.Duration, time.Duration, error) {
+	var period time.Duration
+	if value := os.Getenv("DORMANCY_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			return 0, 0, fmt.Errorf("Invalid DORMANCY_DAYS: %v", value)
+		}
+		period = time.Duration(days) * 24 * time.Hour
+	}
+	interval := time.Hour
+	if value := os.Getenv("DORMANCY_CHECK_INTERVAL_SECONDS"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return 0, 0, fmt.Errorf("Invalid DORMANCY_CHECK_INTERVAL_SECONDS: %v", value)
+		}
+		interval = time.Duration(seconds) * time.Second
+	}
+	return period, interval, nil
+}
+
+// ledgerTemplates returns the templates of the default accounts of the new ledgers, if any
+func ledgerTemplates() (map[string]*models.LedgerTemplate, error) {
+	path := os.Getenv("LEDGER_TEMPLATES_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read LEDGER_TEMPLATES_FILE: %v", err)
+	}
+	templates, err := models.ParseLedgerTemplates(data)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid LEDGER_TEMPLATES_FILE: %v", err)
+	}
+	return templates, nil
+}
+
+// consumerSource returns the queue of the transactions to consume, if any
+func consumerSource() (consumer.Source, error) {
+	queueURL := os.Getenv("CONSUMER_SQS_QUEUE_URL")
+	if queueURL == "" {
+		return nil, nil
+	}
+	source, err := consumer.NewSQS(queueURL, os.Getenv("AWS_REGION"), consumer.Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Consuming transactions from SQS queue:", queueURL)
+	return source, nil
+}
+
+// sheetSettings returns the Google sheet whose transactions are synced if any, along with the interval of syncing it
+func sheetSettings() (sheets.Sheet, time.Duration, error) {
+	spreadsheetID := os.Getenv("SHEETS_SPREADSHEET_ID")
+	if spreadsheetID == "" {
+		return nil, 0, nil
+	}
+	name := os.Getenv("SHEETS_SHEET_NAME")
+	if name == "" {
+		name = "Journal"
+	}
+	key, err := ioutil.ReadFile(os.Getenv("SHEETS_CREDENTIALS_FILE"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("Unable to read SHEETS_CREDENTIALS_FILE: %v", err)
+	}
+	sheet, err := sheets.NewGoogleSheet(spreadsheetID, name, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	interval := time.Minute
+	if value := os.Getenv("SHEETS_SYNC_INTERVAL_SECONDS"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return nil, 0, fmt.Errorf("Invalid SHEETS_SYNC_INTERVAL_SECONDS: %v", value)
+		}
+		interval = time.Duration(seconds) * time.Second
+	}
+	log.Println("Syncing transactions from sheet:", name)
+	return sheet, interval, nil
+}
+
+// regionSettings returns the region of the server along with the URL and token of the ledger in the other region
+func regionSettings() (string, string, string) {
+	region := os.Getenv("REGION")
+	if region == "" {
+		return "", "", ""
+	}
+	token := os.Getenv("PEER_REGION_TOKEN")
+	if token == "" {
+		token = os.Getenv("LEDGER_AUTH_TOKEN")
+	}
+	log.Println("Running in region:", region)
+	return region, os.Getenv("PEER_REGION_URL"), token
+}
+
+// readinessSettings returns the delay of draining the server, and the replication lag beyond which
+// the server isn't ready
+func readinessSettings() (time.Duration, time.Duration, error) {
+	drainDelay := 5 * time.Second
+	if value := os.Getenv("DRAIN_DELAY_SECONDS"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return 0, 0, fmt.Errorf("Invalid DRAIN_DELAY_SECONDS: %v", value)
+		}
+		drainDelay = time.Duration(seconds) * time.Second
+	}
+	var maxLag time.Duration
+	if value := os.Getenv("READY_MAX_REPLICATION_LAG_SECONDS"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return 0, 0, fmt.Errorf("Invalid READY_MAX_REPLICATION_LAG_SECONDS: %v", value)
+		}
+		maxLag = time.Duration(seconds) * time.Second
+	}
+	return drainDelay, maxLag, nil
+}
+
+// rateLimitSettings returns the number of requests allowed per client in the rate limit window
+func rateLimitSettings() (int, time.Duration, error) {
+	limit := 0
+	if value := os.Getenv("RATE_LIMIT"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l < 0 {
+			return 0, 0, fmt.Errorf("Invalid RATE_LIMIT: %v", value)
+		}
+		limit = l
+	}
+	window := time.Minute
+	if value := os.Getenv("RATE_LIMIT_WINDOW_SECONDS"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return 0, 0, fmt.Errorf("Invalid RATE_LIMIT_WINDOW_SECONDS: %v", value)
+		}
+		window = time.Duration(seconds) * time.Second
 	}
-	m, err := migrate.NewWithDatabaseInstance(
-		migrationFilesPath,
-		"postgres", driver)
+	return limit, window, nil
+}
+
+// newRateLimiter returns the rate limiter of the API requests
+func newRateLimiter() *middlewares.RateLimiter {
+	limit, window, err := rateLimitSettings()
 	if err != nil {
-		log.Panic("Unable to create Migrate instance for database:", err)
+		log.Fatal(err)
 	}
+	limiter := middlewares.NewRateLimiter(limit, window)
+
+	config.Reloadable("RATE_LIMIT", "RATE_LIMIT_WINDOW_SECONDS")
+	config.OnReload(func() {
+		limit, window, err := rateLimitSettings()
+		if err != nil {
+			log.Println("Ignoring reloaded rate limit:", err)
+			return
+		}
+		limiter.SetLimit(limit, window)
+	})
+	return limiter
+}
 
-	version, dirty, err := m.Version()
-	if err != nil && err != migrate.ErrNilVersion {
-		log.Panic("Unable to get existing migration version for database:", dirty, err)
+// loadSheddingLimit returns the limit of the concurrent API requests, beyond which the requests are shed
+func loadSheddingLimit() (int, error) {
+	limit := 0
+	if value := os.Getenv("LOAD_SHEDDING_MAX_CONCURRENCY"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l < 0 {
+			return 0, fmt.Errorf("Invalid LOAD_SHEDDING_MAX_CONCURRENCY: %v", value)
+		}
+		limit = l
 	}
-	log.Println("Current schema version:", version)
-	err = m.Up()
+	return limit, nil
+}
+
+// newLoadShedder returns the load shedder of the API requests
+func newLoadShedder() *middlewares.LoadShedder {
+	limit, err := loadSheddingLimit()
 	if err != nil {
-		switch err {
-		case migrate.ErrNoChange:
-			log.Println("No changes to migrate")
-		case migrate.ErrLocked, database.ErrLocked:
-			log.Println("Database locked. Skipping migration assuming another instance working on it")
-		default:
-			log.Panic("Error while migration:", err)
+		log.Fatal(err)
+	}
+	shedder := middlewares.NewLoadShedder(limit)
+
+	config.Reloadable("LOAD_SHEDDING_MAX_CONCURRENCY")
+	config.OnReload(func() {
+		limit, err := loadSheddingLimit()
+		if err != nil {
+			log.Println("Ignoring reloaded load shedding limit:", err)
+			return
 		}
+		shedder.SetLimit(limit)
+	})
+	return shedder
+}
+
+// roundingPolicies returns the rounding policies of the amounts computed by the ledger
+func roundingPolicies() (*rounding.Policies, error) {
+	policies := &rounding.Policies{Default: rounding.HalfUp}
+	if value := os.Getenv("ROUNDING_POLICY"); value != "" {
+		if !rounding.IsValid(value) {
+			return nil, fmt.Errorf("Invalid ROUNDING_POLICY: %v", value)
+		}
+		policies.Default = value
 	}
-	version, dirty, err = m.Version()
+	currencies, err := rounding.Parse(os.Getenv("ROUNDING_POLICIES"))
 	if err != nil {
-		log.Panic("Unable to get new migration version for database:", dirty, err)
+		return nil, fmt.Errorf("Invalid ROUNDING_POLICIES: %v", err)
+	}
+	policies.Currencies = currencies
+	return policies, nil
+}
+
+// setRoundingPolicies sets the rounding policies of the server
+func setRoundingPolicies() {
+	policies, err := roundingPolicies()
+	if err != nil {
+		log.Fatal(err)
+	}
+	rounding.Set(policies)
+
+	config.Reloadable("ROUNDING_POLICY", "ROUNDING_POLICIES")
+	config.OnReload(func() {
+		policies, err := roundingPolicies()
+		if err != nil {
+			log.Println("Ignoring reloaded rounding policies:", err)
+			return
+		}
+		rounding.Set(policies)
+	})
+}
+
+// quotaSettings returns the quotas of the accounts and transactions created by the clients per period
+func quotaSettings() (controllers.QuotaSettings, error) {
+	settings := controllers.QuotaSettings{Period: 24 * time.Hour}
+	if value := os.Getenv("QUOTA_ACCOUNTS"); value != "" {
+		accounts, err := strconv.Atoi(value)
+		if err != nil || accounts < 0 {
+			return settings, fmt.Errorf("Invalid QUOTA_ACCOUNTS: %v", value)
+		}
+		settings.Default.Accounts = accounts
+	}
+	if value := os.Getenv("QUOTA_TRANSACTIONS"); value != "" {
+		transactions, err := strconv.Atoi(value)
+		if err != nil || transactions < 0 {
+			return settings, fmt.Errorf("Invalid QUOTA_TRANSACTIONS: %v", value)
+		}
+		settings.Default.Transactions = transactions
+	}
+	if value := os.Getenv("QUOTA_PERIOD_SECONDS"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return settings, fmt.Errorf("Invalid QUOTA_PERIOD_SECONDS: %v", value)
+		}
+		settings.Period = time.Duration(seconds) * time.Second
+	}
+	clients, err := controllers.ParseClientQuotas(os.Getenv("QUOTA_CLIENTS"))
+	if err != nil {
+		return settings, fmt.Errorf("Invalid QUOTA_CLIENTS: %v", err)
+	}
+	settings.Clients = clients
+	return settings, nil
+}
+
+// setQuotas sets the quotas of the clients
+func setQuotas() {
+	settings, err := quotaSettings()
+	if err != nil {
+		log.Fatal(err)
+	}
+	controllers.SetQuotas(settings)
+
+	config.Reloadable("QUOTA_ACCOUNTS", "QUOTA_TRANSACTIONS", "QUOTA_PERIOD_SECONDS", "QUOTA_CLIENTS")
+	config.OnReload(func() {
+		settings, err := quotaSettings()
+		if err != nil {
+			log.Println("Ignoring reloaded quotas:", err)
+			return
+		}
+		controllers.SetQuotas(settings)
+	})
+}
+
+// migrateDB migrates the DB schema, unless another instance holds the migration lock
+func migrateDB(db *sql.DB) {
+	switch err := runMigrations(db); err {
+	case nil:
+	case migrate.ErrLocked, database.ErrLocked:
+		log.Println("Database locked. Skipping migration assuming another instance working on it")
+	default:
+		log.Panic(err)
+	}
+}
+
+// migrateTenantDB migrates the DB schema of a tenant, waiting for the migration lock as the
+// lock is shared by all tenants of the database
+func migrateTenantDB(db *sql.DB) error {
+	for attempt := 1; ; attempt++ {
+		err := runMigrations(db)
+		if (err != migrate.ErrLocked && err != database.ErrLocked) || attempt == tenantMigrationAttempts {
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// migrateCommand migrates the DB schema and returns the exit code. With `--wait`, it waits up to the
+// `--timeout` for the database to be reachable and for the migration lock held by another instance.
+func migrateCommand(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	wait := flags.Bool("wait", false, "wait for the database and the migration lock")
+	timeout := flags.Duration("timeout", 5*time.Minute, "maximum time to wait")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	db, err := sql.Open("postgres", os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Println("Unable to connect to Database:", err)
+		return 1
+	}
+	defer db.Close()
+	deadline := time.Now().Add(*timeout)
+	for {
+		err := db.Ping()
+		retry := err != nil
+		if err == nil {
+			err = runMigrations(db)
+			retry = err == migrate.ErrLocked || err == database.ErrLocked
+		}
+		if err == nil {
+			return 0
+		}
+		if !*wait || !retry || time.Now().After(deadline) {
+			log.Println("Unable to migrate database:", err)
+			return 1
+		}
+		log.Println("Waiting to migrate database:", err)
+		time.Sleep(time.Second)
+	}
+}
+
+// runMigrations migrates the DB schema to the latest version
+func runMigrations(db *sql.DB) error {
+	migrationFilesPath := os.Getenv("MIGRATION_FILES_PATH")
+	if migrationFilesPath == "" {
+		migrationFilesPath = "file://migrations/postgres"
 	}
-	log.Println("Migrated schema version:", version)
+	return ledger.Migrate(db, migrationFilesPath)
 }
@@ -0,0 +1,374 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Collector is implemented by all metrics that can be exposed by a `Registry`
+type Collector interface {
+	// Name returns the unique metric name
+	Name() string
+	// Write writes the metric in Prometheus text exposition format
+	Write(w io.Writer)
+}
+
+// Registry holds the collectors exposed from the metrics endpoint
+type Registry struct {
+	mu         sync.RWMutex
+	collectors map[string]Collector
+}
+
+// NewRegistry returns a new instance of `Registry`
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// DefaultRegistry is the registry used by the package level constructors
+var DefaultRegistry = NewRegistry()
+
+// Register adds the collector to the registry, replacing any collector of the same name
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors[c.Name()] = c
+}
+
+// Write writes all the registered metrics ordered by their names
+func (r *Registry) Write(w io.Writer) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+	for _, name := range names {
+		r.mu.RLock()
+		c := r.collectors[name]
+		r.mu.RUnlock()
+		c.Write(w)
+	}
+}
+
+// Description describes a metric by its name, type and labels
+type Description struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels []string
+}
+
+// Describer is implemented by the collectors which can describe their metric
+type Describer interface {
+	Describe() Description
+}
+
+// Describe returns the descriptions of all the registered metrics ordered by their names
+func (r *Registry) Describe() []Description {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var descriptions []Description
+	for _, c := range r.collectors {
+		if d, ok := c.(Describer); ok {
+			descriptions = append(descriptions, d.Describe())
+		}
+	}
+	sort.Slice(descriptions, func(i, j int) bool {
+		return descriptions[i].Name < descriptions[j].Name
+	})
+	return descriptions
+}
+
+// Handler serves the metrics of the default registry
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	DefaultRegistry.Write(w)
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatLabels(names, values []string, extra ...string) string {
+	var pairs []string
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, labelValueEscaper.Replace(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return fmt.Sprintf("%g", v)
+}
+
+// vec holds the per label values series of a metric
+type vec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.RWMutex
+	series map[string][]string
+}
+
+func newVec(name, help string, labels []string) vec {
+	return vec{name: name, help: help, labels: labels, series: make(map[string][]string)}
+}
+
+// Name returns the metric name
+func (v *vec) Name() string {
+	return v.name
+}
+
+func (v *vec) describe(kind string) Description {
+	return Description{Name: v.name, Help: v.help, Type: kind, Labels: v.labels}
+}
+
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// keys returns the series keys ordered to keep the output stable
+func (v *vec) keys() []string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec is a counter partitioned by label values
+type CounterVec struct {
+	vec
+	values map[string]float64
+}
+
+// NewCounterVec creates and registers a new counter in the default registry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: newVec(name, help, labels), values: make(map[string]float64)}
+	DefaultRegistry.Register(c)
+	return c
+}
+
+// Add adds the given value to the counter of the label values
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.series[key] = labelValues
+	c.values[key] += value
+}
+
+// Inc increments the counter of the label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the current count of the label values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.values[key]
+}
+
+// Describe describes the counter
+func (c *CounterVec) Describe() Description {
+	return c.describe("counter")
+}
+
+// Write writes the counter in Prometheus text exposition format
+func (c *CounterVec) Write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range c.keys() {
+		c.mu.RLock()
+		labels, value := c.series[key], c.values[key]
+		c.mu.RUnlock()
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, labels), formatFloat(value))
+	}
+}
+
+// GaugeVec is a gauge partitioned by label values
+type GaugeVec struct {
+	vec
+	values map[string]float64
+}
+
+// NewGaugeVec creates and registers a new gauge in the default registry
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec: newVec(name, help, labels), values: make(map[string]float64)}
+	DefaultRegistry.Register(g)
+	return g
+}
+
+// Set sets the gauge of the label values
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.series[key] = labelValues
+	g.values[key] = value
+}
+
+// Add adds the given value to the gauge of the label values
+func (g *GaugeVec) Add(value float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.series[key] = labelValues
+	g.values[key] += value
+}
+
+// Value returns the current value of the label values
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+	key := g.key(labelValues)
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.values[key]
+}
+
+// Describe describes the gauge
+func (g *GaugeVec) Describe() Description {
+	return g.describe("gauge")
+}
+
+// Write writes the gauge in Prometheus text exposition format
+func (g *GaugeVec) Write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	for _, key := range g.keys() {
+		g.mu.RLock()
+		labels, value := g.series[key], g.values[key]
+		g.mu.RUnlock()
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, labels), formatFloat(value))
+	}
+}
+
+// DefaultBuckets are the latency buckets in seconds used when no buckets are given
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// HistogramVec is a histogram partitioned by label values
+type HistogramVec struct {
+	vec
+	buckets []float64
+	counts  map[string][]uint64
+	sums    map[string]float64
+	totals  map[string]uint64
+}
+
+// NewHistogramVec creates and registers a new histogram in the default registry
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	h := &HistogramVec{
+		vec:     newVec(name, help, labels),
+		buckets: buckets,
+		counts:  make(map[string][]uint64),
+		sums:    make(map[string]float64),
+		totals:  make(map[string]uint64),
+	}
+	DefaultRegistry.Register(h)
+	return h
+}
+
+// Observe adds an observation to the histogram of the label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.series[key] = labelValues
+	counts, ok := h.counts[key]
+	if !ok {
+		counts = make([]uint64, len(h.buckets))
+		h.counts[key] = counts
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			counts[i]++
+		}
+	}
+	h.sums[key] += value
+	h.totals[key]++
+}
+
+// Describe describes the histogram
+func (h *HistogramVec) Describe() Description {
+	return h.describe("histogram")
+}
+
+// Write writes the histogram in Prometheus text exposition format
+func (h *HistogramVec) Write(w io.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, key := range h.keys() {
+		h.mu.RLock()
+		labels := h.series[key]
+		counts := append([]uint64(nil), h.counts[key]...)
+		sum, total := h.sums[key], h.totals[key]
+		h.mu.RUnlock()
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, labels, "le", formatFloat(bound)), counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, labels, "le", "+Inf"), total)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, labels), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, labels), total)
+	}
+}
+
+// GaugeFunc is a gauge whose values are computed while the metrics are collected
+type GaugeFunc struct {
+	name   string
+	help   string
+	labels []string
+	fn     func(g *GaugeVec)
+}
+
+// NewGaugeFunc creates and registers a new computed gauge in the default registry.
+// The function sets the current values of the gauge on every collection.
+func NewGaugeFunc(name, help string, fn func(g *GaugeVec), labels ...string) *GaugeFunc {
+	f := &GaugeFunc{name: name, help: help, labels: labels, fn: fn}
+	DefaultRegistry.Register(f)
+	return f
+}
+
+// Name returns the metric name
+func (f *GaugeFunc) Name() string {
+	return f.name
+}
+
+// Describe describes the computed gauge
+func (f *GaugeFunc) Describe() Description {
+	return Description{Name: f.name, Help: f.help, Type: "gauge", Labels: f.labels}
+}
+
+// Write computes the gauge and writes it in Prometheus text exposition format
+func (f *GaugeFunc) Write(w io.Writer) {
+	g := &GaugeVec{vec: newVec(f.name, f.help, f.labels), values: make(map[string]float64)}
+	f.fn(g)
+	g.Write(w)
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec(t *testing.T) {
+	registry := NewRegistry()
+	c := NewCounterVec("test_requests_total", "Test requests", "code")
+	registry.Register(c)
+	c.Inc("200")
+	c.Inc("200")
+	c.Add(3, "500")
+
+	assert.Equal(t, float64(2), c.Value("200"), "Invalid counter value")
+	assert.Equal(t, float64(0), c.Value("404"), "Invalid counter value")
+
+	var buf bytes.Buffer
+	registry.Write(&buf)
+	expected := "# HELP test_requests_total Test requests\n" +
+		"# TYPE test_requests_total counter\n" +
+		"test_requests_total{code=\"200\"} 2\n" +
+		"test_requests_total{code=\"500\"} 3\n"
+	assert.Equal(t, expected, buf.String(), "Invalid exposition format")
+}
+
+func TestGaugeVecLabelEscaping(t *testing.T) {
+	registry := NewRegistry()
+	g := NewGaugeVec("test_gauge", "Test gauge", "name")
+	registry.Register(g)
+	g.Set(1.5, `a"b`)
+
+	var buf bytes.Buffer
+	registry.Write(&buf)
+	assert.Contains(t, buf.String(), `test_gauge{name="a\"b"} 1.5`, "Invalid label escaping")
+}
+
+func TestHistogramVec(t *testing.T) {
+	registry := NewRegistry()
+	h := NewHistogramVec("test_latency_seconds", "Test latency", []float64{0.1, 1}, "route")
+	registry.Register(h)
+	h.Observe(0.05, "/v1")
+	h.Observe(0.5, "/v1")
+	h.Observe(5, "/v1")
+
+	var buf bytes.Buffer
+	registry.Write(&buf)
+	output := buf.String()
+	assert.Contains(t, output, `test_latency_seconds_bucket{route="/v1",le="0.1"} 1`, "Invalid bucket count")
+	assert.Contains(t, output, `test_latency_seconds_bucket{route="/v1",le="1"} 2`, "Invalid bucket count")
+	assert.Contains(t, output, `test_latency_seconds_bucket{route="/v1",le="+Inf"} 3`, "Invalid bucket count")
+	assert.Contains(t, output, `test_latency_seconds_count{route="/v1"} 3`, "Invalid total count")
+}
+
+func TestGaugeFunc(t *testing.T) {
+	registry := NewRegistry()
+	f := NewGaugeFunc("test_computed", "Test computed gauge", func(g *GaugeVec) {
+		g.Set(42, "a")
+	}, "name")
+	registry.Register(f)
+
+	var buf bytes.Buffer
+	registry.Write(&buf)
+	assert.Contains(t, buf.String(), `test_computed{name="a"} 42`, "Invalid computed value")
+}
+
+func TestRegistryDescribe(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(NewHistogramVec("test_describe_seconds", "Test latency", nil, "route"))
+	registry.Register(NewCounterVec("test_describe_total", "Test requests", "code"))
+	registry.Register(NewGaugeFunc("test_describe_computed", "Test computed gauge", func(g *GaugeVec) {}))
+
+	assert.Equal(t, []Description{
+		{Name: "test_describe_computed", Help: "Test computed gauge", Type: "gauge"},
+		{Name: "test_describe_seconds", Help: "Test latency", Type: "histogram", Labels: []string{"route"}},
+		{Name: "test_describe_total", Help: "Test requests", Type: "counter", Labels: []string{"code"}},
+	}, registry.Describe(), "Invalid descriptions")
+}
@@ -4,14 +4,27 @@ import (
 	"net/http"
 	"os"
 	"strings"
+
+	"github.com/RealImage/QLedger/models"
 )
 
-// TokenAuthMiddleware is a middleware that provides authentication functionality
+// apiKey returns the API key of the request, if any
+func apiKey(r *http.Request) string {
+	token := strings.TrimSpace(r.Header.Get("Authorization"))
+	if !strings.HasPrefix(token, models.APIKeyPrefix) {
+		return ""
+	}
+	return token
+}
+
+// TokenAuthMiddleware is a middleware that provides authentication functionality.
+// Requests with an API key are passed on, to be authenticated and scoped to the ledger
+// of the key by the `ContextMiddleware`.
 func TokenAuthMiddleware(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Check whether token authentication enabled
 		envToken := strings.TrimSpace(os.Getenv("LEDGER_AUTH_TOKEN"))
-		if envToken != "" {
+		if envToken != "" && apiKey(r) == "" {
 			// Get the token in the header
 			requestToken := strings.TrimSpace(r.Header.Get("Authorization"))
 			// Validate token
@@ -23,3 +36,16 @@ func TokenAuthMiddleware(handler http.HandlerFunc) http.HandlerFunc {
 		handler.ServeHTTP(w, r)
 	}
 }
+
+// AdminAuthMiddleware is a middleware that authenticates the admin requests,
+// which are not allowed with the API keys of the ledgers
+func AdminAuthMiddleware(handler http.HandlerFunc) http.HandlerFunc {
+	authenticated := TokenAuthMiddleware(handler)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if apiKey(r) != "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		authenticated(w, r)
+	}
+}
@@ -63,6 +63,32 @@ func (as *AuthSuite) TestInvalidAuth() {
 	assert.Equal(t, http.StatusUnauthorized, rr1.Code, "Invalid response code")
 }
 
+func (as *AuthSuite) TestAPIKeyAuth() {
+	t := as.T()
+	os.Setenv("LEDGER_AUTH_TOKEN", "XXX")
+
+	req, err := http.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "qlk_0123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr1 := httptest.NewRecorder()
+	as.handler.ServeHTTP(rr1, req)
+	assert.Equal(t, http.StatusOK, rr1.Code, "API key should be passed on")
+
+	admin := AdminAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	rr2 := httptest.NewRecorder()
+	admin.ServeHTTP(rr2, req)
+	assert.Equal(t, http.StatusForbidden, rr2.Code, "API key should not be allowed in admin requests")
+
+	req.Header.Set("Authorization", "XXX")
+	rr3 := httptest.NewRecorder()
+	admin.ServeHTTP(rr3, req)
+	assert.Equal(t, http.StatusOK, rr3.Code, "Invalid response code")
+}
+
 func TestAuthSuite(t *testing.T) {
 	suite.Run(t, new(AuthSuite))
 }
@@ -0,0 +1,22 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	// ClientIDHeader is the request header identifying the client of the ledger
+	ClientIDHeader = "X-Client-ID"
+	// AnonymousClient is the client ID of requests without the client header
+	AnonymousClient = "anonymous"
+)
+
+// ClientID returns the client ID of the request
+func ClientID(r *http.Request) string {
+	client := strings.TrimSpace(r.Header.Get(ClientIDHeader))
+	if client == "" {
+		return AnonymousClient
+	}
+	return client
+}
@@ -0,0 +1,15 @@
+package middlewares
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientID(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/v1/transactions", nil)
+	assert.Equal(t, AnonymousClient, ClientID(req), "Invalid client")
+	req.Header.Set(ClientIDHeader, " billing ")
+	assert.Equal(t, "billing", ClientID(req), "Invalid client")
+}
@@ -1,17 +1,91 @@
 package middlewares
 
 import (
+	"log"
 	"net/http"
+	"strings"
 
 	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+	"github.com/RealImage/QLedger/tenants"
 )
 
+// TenantHeader is the request header with the tenant whose ledger is used, when the tenants are isolated
+const TenantHeader = "X-Ledger-Tenant"
+
 // Handler is a custom HTTP handler that has an additional application context
 type Handler func(http.ResponseWriter, *http.Request, *ledgerContext.AppContext)
 
-// ContextMiddleware is a middleware that provides application context to the `Handler`
+// requestTenant returns the tenant of the request and the metadata scope of its API key,
+// along with the status of its error, if any. The tenant of a request with an API key is the one
+// the key is scoped to, otherwise it is the one in the `X-Ledger-Tenant` header.
+func requestTenant(r *http.Request, context *ledgerContext.AppContext) (string, *models.MetadataScope, int) {
+	tenant := strings.TrimSpace(r.Header.Get(TenantHeader))
+	key := apiKey(r)
+	if key == "" {
+		return tenant, nil, 0
+	}
+	if context.APIKey == nil {
+		log.Println("API key is used without tenant isolation")
+		return "", nil, http.StatusUnauthorized
+	}
+	// The key is resolved once, when the credential of the request is authenticated
+	var resolved *models.APIKey
+	if credential := RequestCredential(r); credential != nil && credential.Key != nil {
+		resolved = credential.Key
+	} else {
+		var err error
+		resolved, err = context.APIKey(key)
+		if err != nil {
+			log.Println("Error while resolving API key:", err)
+			return "", nil, http.StatusServiceUnavailable
+		}
+	}
+	switch {
+	case resolved == nil:
+		log.Println("Unknown or revoked API key")
+		return "", nil, http.StatusUnauthorized
+	case tenant != "" && tenant != resolved.LedgerID:
+		// A key never reaches the ledger of another tenant
+		log.Println("API key is not scoped to tenant:", tenant)
+		return "", nil, http.StatusForbidden
+	}
+	return resolved.LedgerID, resolved.Metadata, 0
+}
+
+// ContextMiddleware is a middleware that provides application context to the `Handler`.
+// When the tenants are isolated, the context is the one of the tenant of the request.
+// The context of every request carries its request ID.
 func ContextMiddleware(handler Handler, context *ledgerContext.AppContext) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		handler(w, r, context)
+		if context == nil {
+			handler(w, r, context)
+			return
+		}
+		tenant, metadata, status := requestTenant(r, context)
+		if status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+		requestContext := *context
+		if context.Tenant != nil {
+			tenantContext, err := context.Tenant(tenant)
+			if err != nil {
+				log.Println("Error while opening tenant:", tenant, err)
+				switch err {
+				case tenants.ErrInvalidTenant:
+					w.WriteHeader(http.StatusBadRequest)
+				case tenants.ErrUnknownTenant:
+					w.WriteHeader(http.StatusNotFound)
+				default:
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+				return
+			}
+			requestContext = *tenantContext
+		}
+		requestContext.RequestID = RequestID(r)
+		requestContext.Metadata = metadata
+		handler(w, r, &requestContext)
 	}
 }
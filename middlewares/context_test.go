@@ -0,0 +1,135 @@
+package middlewares
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+	"github.com/RealImage/QLedger/tenants"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextMiddlewareTenant(t *testing.T) {
+	acme := &ledgerContext.AppContext{DB: &sql.DB{}}
+	context := &ledgerContext.AppContext{
+		Tenant: func(tenant string) (*ledgerContext.AppContext, error) {
+			switch tenant {
+			case "acme":
+				return acme, nil
+			case "down":
+				return nil, errors.New("connection refused")
+			case "unknown":
+				return nil, tenants.ErrUnknownTenant
+			}
+			return nil, tenants.ErrInvalidTenant
+		},
+	}
+	var used *ledgerContext.AppContext
+	handler := ContextMiddleware(func(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+		used = context
+	}, context)
+
+	req, _ := http.NewRequest("GET", "/v1/accounts", nil)
+	req.Header.Set(TenantHeader, "acme")
+	req.Header.Set(RequestIDHeader, "trace-1234")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+	assert.True(t, used.DB == acme.DB, "Request should use the context of its tenant")
+	assert.Equal(t, "trace-1234", used.RequestID, "Request ID should be in the context")
+	assert.Empty(t, acme.RequestID, "Context of the tenant should not be modified")
+
+	req.Header.Del(TenantHeader)
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Request without tenant should be rejected")
+
+	req.Header.Set(TenantHeader, "down")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "Unavailable tenant should be reported")
+
+	req.Header.Set(TenantHeader, "unknown")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Unknown tenant should not be found")
+}
+
+func TestContextMiddlewareAPIKey(t *testing.T) {
+	acme := &ledgerContext.AppContext{DB: &sql.DB{}}
+	context := &ledgerContext.AppContext{
+		Tenant: func(tenant string) (*ledgerContext.AppContext, error) {
+			if tenant == "acme" {
+				return acme, nil
+			}
+			return &ledgerContext.AppContext{DB: &sql.DB{}}, nil
+		},
+		APIKey: func(key string) (*models.APIKey, error) {
+			switch key {
+			case "qlk_acme":
+				return &models.APIKey{ID: "1", LedgerID: "acme"}, nil
+			case "qlk_support":
+				return &models.APIKey{ID: "2", LedgerID: "acme", Metadata: &models.MetadataScope{Read: []string{"order_id"}}}, nil
+			case "qlk_down":
+				return nil, errors.New("connection refused")
+			}
+			return nil, nil
+		},
+	}
+	var used *ledgerContext.AppContext
+	handler := ContextMiddleware(func(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+		used = context
+	}, context)
+
+	req, _ := http.NewRequest("GET", "/v1/accounts", nil)
+	req.Header.Set("Authorization", "qlk_acme")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+	assert.True(t, used.DB == acme.DB, "Request should use the ledger of its API key")
+	assert.Nil(t, used.Metadata, "API key without metadata scope should not be restricted")
+
+	req.Header.Set("Authorization", "qlk_support")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid response code")
+	if assert.NotNil(t, used.Metadata, "Request should carry the metadata scope of its API key") {
+		assert.Equal(t, []string{"order_id"}, used.Metadata.Read, "Invalid metadata scope")
+	}
+	assert.Nil(t, acme.Metadata, "Metadata scope should not leak into the context of the tenant")
+	req.Header.Set("Authorization", "qlk_acme")
+
+	req.Header.Set(TenantHeader, "acme")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Tenant of the API key should be allowed")
+
+	req.Header.Set(TenantHeader, "other")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code, "API key should not reach other tenants")
+
+	req.Header.Del(TenantHeader)
+	req.Header.Set("Authorization", "qlk_revoked")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code, "Unknown API key should be rejected")
+
+	req.Header.Set("Authorization", "qlk_down")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "Unavailable API keys should be reported")
+
+	// API keys are only scoped to the ledgers of isolated tenants
+	handler = ContextMiddleware(func(w http.ResponseWriter, r *http.Request, context *ledgerContext.AppContext) {
+		used = context
+	}, &ledgerContext.AppContext{})
+	req.Header.Set("Authorization", "qlk_acme")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code, "API key without tenants should be rejected")
+}
@@ -0,0 +1,92 @@
+package middlewares
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/RealImage/QLedger/models"
+)
+
+// TokenCredential is the credential ID of the requests authenticated by the `LEDGER_AUTH_TOKEN`
+const TokenCredential = "token"
+
+// Credential is the credential which authenticated a request
+type Credential struct {
+	// ID identifies the credential, which is `token` for the auth token, or `key:` followed by the ID of an API key
+	ID string
+	// Key is the API key of the request along with its tenant and metadata scope, if any
+	Key *models.APIKey
+}
+
+type credentialContextKey struct{}
+
+// authenticate returns the credential of the request, or nil if it isn't authenticated by one,
+// such as when the credential is invalid or the token authentication is disabled
+func authenticate(r *http.Request, resolveKey func(key string) (*models.APIKey, error)) *Credential {
+	if key := apiKey(r); key != "" {
+		if resolveKey == nil {
+			return nil
+		}
+		resolved, err := resolveKey(key)
+		if err != nil {
+			log.Println("Error while resolving API key:", err)
+			return nil
+		}
+		if resolved == nil {
+			return nil
+		}
+		return &Credential{ID: "key:" + resolved.ID, Key: resolved}
+	}
+	envToken := strings.TrimSpace(os.Getenv("LEDGER_AUTH_TOKEN"))
+	if envToken != "" && strings.TrimSpace(r.Header.Get("Authorization")) == envToken {
+		return &Credential{ID: TokenCredential}
+	}
+	return nil
+}
+
+// CredentialMiddleware authenticates the credential of the request, so that the request is attributed to it,
+// such as by the rate limits, quotas and repeated transactions. The requests which aren't authenticated are
+// passed on without a credential, to be rejected by the authentication of their routes.
+func CredentialMiddleware(handler http.HandlerFunc, resolveKey func(key string) (*models.APIKey, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if credential := authenticate(r, resolveKey); credential != nil {
+			r = r.WithContext(context.WithValue(r.Context(), credentialContextKey{}, credential))
+			if entry := requestLogOf(r); entry != nil {
+				entry.credential = credential.ID
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// RequestCredential returns the authenticated credential of the request, or nil if there is none
+func RequestCredential(r *http.Request) *Credential {
+	credential, _ := r.Context().Value(credentialContextKey{}).(*Credential)
+	return credential
+}
+
+// CredentialID returns the ID of the authenticated credential of the request,
+// or `anonymous` if there is none, such as when the token authentication is disabled
+func CredentialID(r *http.Request) string {
+	if credential := RequestCredential(r); credential != nil {
+		return credential.ID
+	}
+	return AnonymousClient
+}
+
+// ClientKey returns the key the usage of the request is counted by, which is its credential,
+// or its remote IP if it isn't authenticated
+func ClientKey(r *http.Request) string {
+	if credential := RequestCredential(r); credential != nil {
+		return credential.ID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialMiddleware(t *testing.T) {
+	defer os.Setenv("LEDGER_AUTH_TOKEN", os.Getenv("LEDGER_AUTH_TOKEN"))
+	os.Setenv("LEDGER_AUTH_TOKEN", "secret")
+	resolveKey := func(key string) (*models.APIKey, error) {
+		switch key {
+		case "qlk_acme":
+			return &models.APIKey{ID: "9f86d081884c7d65", LedgerID: "acme"}, nil
+		case "qlk_down":
+			return nil, errors.New("connection refused")
+		}
+		return nil, nil
+	}
+	var credential, client, key string
+	handler := CredentialMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		credential, client = CredentialID(r), ClientKey(r)
+		key = ""
+		if c := RequestCredential(r); c != nil && c.Key != nil {
+			key = c.Key.LedgerID
+		}
+	}, resolveKey)
+
+	for _, test := range []struct {
+		authorization, credential, client, key string
+	}{
+		{"secret", TokenCredential, TokenCredential, ""},
+		{"qlk_acme", "key:9f86d081884c7d65", "key:9f86d081884c7d65", "acme"},
+		{"wrong", AnonymousClient, "192.0.2.1", ""},
+		{"qlk_revoked", AnonymousClient, "192.0.2.1", ""},
+		{"qlk_down", AnonymousClient, "192.0.2.1", ""},
+		{"", AnonymousClient, "192.0.2.1", ""},
+	} {
+		req := httptest.NewRequest("GET", "/v1/accounts", nil)
+		req.Header.Set("Authorization", test.authorization)
+		// The client header doesn't identify the credential
+		req.Header.Set(ClientIDHeader, "billing")
+		handler(httptest.NewRecorder(), req)
+		assert.Equal(t, test.credential, credential, "Invalid credential of %v", test.authorization)
+		assert.Equal(t, test.client, client, "Invalid client of %v", test.authorization)
+		assert.Equal(t, test.key, key, "Invalid API key of %v", test.authorization)
+	}
+}
@@ -0,0 +1,72 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"time"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+)
+
+// RequestIDHeader is the request and response header with the ID of the request.
+// A valid ID of an inbound request is kept, so that it can be traced across services.
+const RequestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[a-zA-Z0-9_.:-]{1,128}$`)
+
+// RequestID returns the ID of the request, which is set by the `RequestLogMiddleware`
+func RequestID(r *http.Request) string {
+	return r.Header.Get(RequestIDHeader)
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+type requestLogContextKey struct{}
+
+// requestLog holds the fields of the log entry of a request which are only known while it is handled,
+// such as its credential, which is authenticated by the `CredentialMiddleware`
+type requestLog struct {
+	credential string
+}
+
+// requestLogOf returns the log entry of the request, or nil if it isn't logged
+func requestLogOf(r *http.Request) *requestLog {
+	entry, _ := r.Context().Value(requestLogContextKey{}).(*requestLog)
+	return entry
+}
+
+// RequestLogMiddleware is a middleware that assigns an ID to every request, and writes a structured
+// log entry of the request once it is handled. The client of the entry is the credential of the request,
+// while the `X-Client-ID` header, which is set by the clients themselves, is logged as `client_id_header`.
+func RequestLogMiddleware(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := RequestID(r)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+			r.Header.Set(RequestIDHeader, id)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		entry := &requestLog{credential: AnonymousClient}
+		r = r.WithContext(context.WithValue(r.Context(), requestLogContextKey{}, entry))
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		handler.ServeHTTP(recorder, r)
+		ledgerContext.LogEntry(map[string]interface{}{
+			"request_id":       id,
+			"method":           r.Method,
+			"path":             r.URL.Path,
+			"status":           recorder.status,
+			"duration_ms":      float64(time.Since(start).Nanoseconds()) / 1e6,
+			"client":           entry.credential,
+			"client_id_header": ClientID(r),
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestLogMiddleware(t *testing.T) {
+	var seen string
+	handler := RequestLogMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r)
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	// Request without an ID
+	req, err := http.NewRequest("GET", "/v1/accounts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr1 := httptest.NewRecorder()
+	handler.ServeHTTP(rr1, req)
+	assert.Equal(t, http.StatusAccepted, rr1.Code, "Invalid response code")
+	assert.Len(t, seen, 32, "Request ID should be generated")
+	assert.Equal(t, seen, rr1.Header().Get(RequestIDHeader), "Request ID should be returned")
+
+	// Request with a valid ID
+	req, err = http.NewRequest("GET", "/v1/accounts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(RequestIDHeader, "trace-1234")
+	rr2 := httptest.NewRecorder()
+	handler.ServeHTTP(rr2, req)
+	assert.Equal(t, "trace-1234", seen, "Valid request ID should be kept")
+	assert.Equal(t, "trace-1234", rr2.Header().Get(RequestIDHeader), "Request ID should be returned")
+
+	// Request with an invalid ID
+	req, err = http.NewRequest("GET", "/v1/accounts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(RequestIDHeader, "bad id\n")
+	rr3 := httptest.NewRecorder()
+	handler.ServeHTTP(rr3, req)
+	assert.NotEqual(t, "bad id\n", seen, "Invalid request ID should be replaced")
+	assert.Len(t, seen, 32, "Request ID should be generated")
+}
+
+func TestRequestLogCredential(t *testing.T) {
+	resolveKey := func(key string) (*models.APIKey, error) {
+		return &models.APIKey{ID: "9f86d081884c7d65", LedgerID: "acme"}, nil
+	}
+	var entry *requestLog
+	handler := RequestLogMiddleware(CredentialMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		entry = requestLogOf(r)
+	}, resolveKey))
+
+	// The request is logged with its credential rather than the client ID header
+	req, err := http.NewRequest("GET", "/v1/accounts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(ClientIDHeader, "billing")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, AnonymousClient, entry.credential, "Unauthenticated request should be anonymous")
+
+	req.Header.Set("Authorization", "qlk_acme")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "key:9f86d081884c7d65", entry.credential, "Request should be logged with its credential")
+}
@@ -0,0 +1,90 @@
+package middlewares
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RealImage/QLedger/metrics"
+)
+
+var (
+	requests = metrics.NewCounterVec(
+		"qledger_http_requests_total",
+		"Number of HTTP requests by endpoint and status.",
+		"method", "endpoint", "status",
+	)
+	requestDurations = metrics.NewHistogramVec(
+		"qledger_http_request_duration_seconds",
+		"Latency of the HTTP requests by endpoint.",
+		nil, "method", "endpoint",
+	)
+)
+
+// MetricsMiddleware is a middleware that records the count and latency of the requests of the endpoint,
+// which is the route pattern rather than the path so that the metrics have a bounded number of series
+func MetricsMiddleware(handler http.HandlerFunc, method, endpoint string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		handler.ServeHTTP(recorder, r)
+		requestDurations.Observe(time.Since(start).Seconds(), method, endpoint)
+		requests.Inc(method, endpoint, strconv.Itoa(recorder.status))
+	}
+}
+
+// dbPools holds the DB connection pools exposed in the metrics by their names
+var dbPools = struct {
+	sync.Mutex
+	dbs map[string]*sql.DB
+}{dbs: make(map[string]*sql.DB)}
+
+var (
+	_ = metrics.NewGaugeFunc(
+		"qledger_db_connections",
+		"Number of DB connections of the pool by state.",
+		func(g *metrics.GaugeVec) {
+			dbPools.Lock()
+			defer dbPools.Unlock()
+			for name, db := range dbPools.dbs {
+				stats := db.Stats()
+				g.Set(float64(stats.InUse), name, "in_use")
+				g.Set(float64(stats.Idle), name, "idle")
+			}
+		},
+		"db", "state",
+	)
+	_ = metrics.NewGaugeFunc(
+		"qledger_db_wait_count",
+		"Total number of waits for a DB connection of the pool.",
+		func(g *metrics.GaugeVec) {
+			dbPools.Lock()
+			defer dbPools.Unlock()
+			for name, db := range dbPools.dbs {
+				g.Set(float64(db.Stats().WaitCount), name)
+			}
+		},
+		"db",
+	)
+	_ = metrics.NewGaugeFunc(
+		"qledger_db_wait_duration_seconds",
+		"Total time waited for a DB connection of the pool.",
+		func(g *metrics.GaugeVec) {
+			dbPools.Lock()
+			defer dbPools.Unlock()
+			for name, db := range dbPools.dbs {
+				g.Set(db.Stats().WaitDuration.Seconds(), name)
+			}
+		},
+		"db",
+	)
+)
+
+// RegisterDBStats exposes the stats of the DB connection pool in the metrics, labelled by the name
+func RegisterDBStats(name string, db *sql.DB) {
+	dbPools.Lock()
+	defer dbPools.Unlock()
+	dbPools.dbs[name] = db
+}
@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	status := http.StatusOK
+	handler := MetricsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}, "GET", "/v1/metrics_test")
+
+	req, err := http.NewRequest("GET", "/v1/metrics_test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	status = http.StatusNotFound
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Invalid response code")
+
+	assert.Equal(t, float64(2), requests.Value("GET", "/v1/metrics_test", "200"), "Invalid count of OK requests")
+	assert.Equal(t, float64(1), requests.Value("GET", "/v1/metrics_test", "404"), "Invalid count of not found requests")
+}
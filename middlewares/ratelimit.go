@@ -0,0 +1,109 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateWindow counts the requests of a client in the current window
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// RateLimiter limits the number of requests of each client in a fixed time window.
+// A limit of zero disables rate limiting.
+type RateLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	clients   map[string]*rateWindow
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewRateLimiter returns a new instance of `RateLimiter`
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:   limit,
+		window:  window,
+		clients: make(map[string]*rateWindow),
+		now:     time.Now,
+	}
+}
+
+// SetLimit changes the limit and window, resetting the requests counted so far
+func (l *RateLimiter) SetLimit(limit int, window time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.window = window
+	l.clients = make(map[string]*rateWindow)
+}
+
+// Allow counts a request of the client and says whether it is within the limit.
+// It also returns the limit, the remaining requests and the time until the window resets.
+func (l *RateLimiter) Allow(client string) (allowed bool, limit int, remaining int, reset time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit <= 0 {
+		return true, 0, 0, 0
+	}
+
+	now := l.now()
+	// Forget the clients of the expired windows
+	if now.Sub(l.lastSweep) >= l.window {
+		for key, w := range l.clients {
+			if now.Sub(w.start) >= l.window {
+				delete(l.clients, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	w, ok := l.clients[client]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &rateWindow{start: now}
+		l.clients[client] = w
+	}
+	w.count++
+	remaining = l.limit - w.count
+	if remaining < 0 {
+		remaining = 0
+	}
+	return w.count <= l.limit, l.limit, remaining, w.start.Add(l.window).Sub(now)
+}
+
+// RateLimitMiddleware is a middleware that rejects the requests of clients exceeding the rate limit.
+// The clients are the credentials authenticated by the `CredentialMiddleware`, which runs before it,
+// and the requests without a valid credential are limited by their remote IP. The limit status is returned in the `RateLimit-Limit`, `RateLimit-Remaining` and `RateLimit-Reset` headers.
+func RateLimitMiddleware(handler http.HandlerFunc, limiter *RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		allowed, limit, remaining, reset := limiter.Allow(ClientKey(r))
+		if limit > 0 {
+			// Round up, so that clients don't retry before the reset
+			resetSeconds := strconv.Itoa(int((reset + time.Second - 1) / time.Second))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("RateLimit-Reset", resetSeconds)
+			if !allowed {
+				w.Header().Set("Retry-After", resetSeconds)
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// NodeMiddleware is a middleware that identifies the server node in the `X-Ledger-Node` response header
+func NodeMiddleware(handler http.HandlerFunc, node string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if node != "" {
+			w.Header().Set("X-Ledger-Node", node)
+		}
+		handler.ServeHTTP(w, r)
+	}
+}
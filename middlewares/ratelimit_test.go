@@ -0,0 +1,87 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(2, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	allowed, limit, remaining, reset := limiter.Allow("billing")
+	assert.Equal(t, true, allowed, "Request should be allowed")
+	assert.Equal(t, 2, limit, "Invalid limit")
+	assert.Equal(t, 1, remaining, "Invalid remaining")
+	assert.Equal(t, time.Minute, reset, "Invalid reset")
+
+	now = now.Add(10 * time.Second)
+	allowed, _, remaining, reset = limiter.Allow("billing")
+	assert.Equal(t, true, allowed, "Request should be allowed")
+	assert.Equal(t, 0, remaining, "Invalid remaining")
+	assert.Equal(t, 50*time.Second, reset, "Invalid reset")
+
+	allowed, _, _, _ = limiter.Allow("billing")
+	assert.Equal(t, false, allowed, "Request should be limited")
+	allowed, _, _, _ = limiter.Allow("invoicing")
+	assert.Equal(t, true, allowed, "Other clients should be allowed")
+
+	// New window
+	now = now.Add(time.Minute)
+	allowed, _, remaining, _ = limiter.Allow("billing")
+	assert.Equal(t, true, allowed, "Request should be allowed")
+	assert.Equal(t, 1, remaining, "Invalid remaining")
+
+	// Disabled
+	limiter.SetLimit(0, time.Minute)
+	allowed, limit, _, _ = limiter.Allow("billing")
+	assert.Equal(t, true, allowed, "Request should be allowed")
+	assert.Equal(t, 0, limit, "Invalid limit")
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	defer os.Setenv("LEDGER_AUTH_TOKEN", os.Getenv("LEDGER_AUTH_TOKEN"))
+	os.Setenv("LEDGER_AUTH_TOKEN", "secret")
+	handler := NodeMiddleware(CredentialMiddleware(RateLimitMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, NewRateLimiter(1, time.Minute)), nil), "node-1")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "secret")
+	req.Header.Set(ClientIDHeader, "billing")
+	rr1 := httptest.NewRecorder()
+	handler.ServeHTTP(rr1, req)
+	assert.Equal(t, http.StatusOK, rr1.Code, "Invalid response code")
+	assert.Equal(t, "1", rr1.Header().Get("RateLimit-Limit"), "Invalid limit header")
+	assert.Equal(t, "0", rr1.Header().Get("RateLimit-Remaining"), "Invalid remaining header")
+	assert.Equal(t, "60", rr1.Header().Get("RateLimit-Reset"), "Invalid reset header")
+	assert.Equal(t, "node-1", rr1.Header().Get("X-Ledger-Node"), "Invalid node header")
+
+	rr2 := httptest.NewRecorder()
+	handler.ServeHTTP(rr2, req)
+	assert.Equal(t, http.StatusTooManyRequests, rr2.Code, "Invalid response code")
+	assert.NotEmpty(t, rr2.Header().Get("Retry-After"), "Missing retry header")
+	assert.Equal(t, "node-1", rr2.Header().Get("X-Ledger-Node"), "Invalid node header")
+
+	// Another client header doesn't reset the limit of the credential
+	req.Header.Set(ClientIDHeader, "invoicing")
+	rr3 := httptest.NewRecorder()
+	handler.ServeHTTP(rr3, req)
+	assert.Equal(t, http.StatusTooManyRequests, rr3.Code, "Client header should not bypass the limit")
+
+	// An unauthenticated request claiming the client doesn't use up the limit of the credential,
+	// as it is limited by its IP
+	other := httptest.NewRequest("GET", "/", nil)
+	other.RemoteAddr = "198.51.100.7:4321"
+	other.Header.Set("Authorization", "wrong")
+	other.Header.Set(ClientIDHeader, "billing")
+	rr4 := httptest.NewRecorder()
+	handler.ServeHTTP(rr4, other)
+	assert.Equal(t, http.StatusOK, rr4.Code, "Unauthenticated request should be limited by its IP")
+}
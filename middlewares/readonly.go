@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+)
+
+// readOnlyResponse is the response of the writes rejected by a read-only server
+const readOnlyResponse = `{"code": "region.read_only", "message": "Region is read-only, as it isn't the primary"}`
+
+// IsWrite says whether a request changes the ledger, by its method and path without the host prefix.
+// The searches, reports and exports are reads even when posted, and the admin requests are always served.
+func IsWrite(method, path string) bool {
+	if method == http.MethodGet || method == http.MethodHead || strings.HasPrefix(path, "/v1/admin/") {
+		return false
+	}
+	return PriorityClass(method, path) == PriorityWrite
+}
+
+// ReadOnlyMiddleware is a middleware that rejects the writes with `503 Service Unavailable`
+// while the server is read-only, such as in a standby region
+func ReadOnlyMiddleware(handler http.HandlerFunc, readOnly func() bool, hostPrefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if readOnly() && IsWrite(r.Method, strings.TrimPrefix(r.URL.Path, hostPrefix)) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(readOnlyResponse))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}
+}
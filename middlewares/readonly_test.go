@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsWrite(t *testing.T) {
+	writes := map[string]bool{
+		"POST /v1/transactions":            true,
+		"PUT /v1/accounts":                 true,
+		"DELETE /v1/webhooks":              true,
+		"POST /v1/transactions/_search":    false,
+		"POST /v1/reports/_run":            false,
+		"GET /v1/transactions":             false,
+		"POST /v1/admin/region/_promote":   false,
+		"POST /v1/transactions/t1/reverse": true,
+	}
+	for request, write := range writes {
+		parts := strings.SplitN(request, " ", 2)
+		assert.Equal(t, write, IsWrite(parts[0], parts[1]), "Invalid write of request: %v", request)
+	}
+}
+
+func TestReadOnlyMiddleware(t *testing.T) {
+	readOnly := true
+	handler := ReadOnlyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, func() bool { return readOnly }, "/ledger")
+
+	serve := func(method, path string) int {
+		req, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, serve("POST", "/ledger/v1/transactions"), "Write should be rejected")
+	assert.Equal(t, http.StatusOK, serve("POST", "/ledger/v1/transactions/_search"), "Search should be served")
+	assert.Equal(t, http.StatusOK, serve("GET", "/ledger/v1/accounts"), "Read should be served")
+
+	readOnly = false
+	assert.Equal(t, http.StatusOK, serve("POST", "/ledger/v1/transactions"), "Write should be served")
+}
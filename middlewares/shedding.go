@@ -0,0 +1,101 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/RealImage/QLedger/metrics"
+)
+
+// Priority classes of the requests, from the highest to the lowest priority
+const (
+	PriorityWrite   = "write"
+	PriorityBalance = "balance"
+	PrioritySearch  = "search"
+	PriorityExport  = "export"
+)
+
+// priorityShares are the shares of the concurrency limit up to which the requests of a class are admitted,
+// so that the lower priority requests are shed first as the load grows
+var priorityShares = map[string]float64{
+	PriorityWrite:   1,
+	PriorityBalance: 0.8,
+	PrioritySearch:  0.6,
+	PriorityExport:  0.4,
+}
+
+var shedRequests = metrics.NewCounterVec("qledger_http_requests_shed_total",
+	"Number of HTTP requests shed under load by priority class.", "class")
+
+// LoadShedder admits the requests while the number of in-flight requests is within the share of the limit
+// of their priority class. A limit of zero disables load shedding.
+type LoadShedder struct {
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+}
+
+// NewLoadShedder returns a new instance of `LoadShedder`
+func NewLoadShedder(limit int) *LoadShedder {
+	return &LoadShedder{limit: limit}
+}
+
+// SetLimit changes the limit of the concurrent requests
+func (s *LoadShedder) SetLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+}
+
+// Admit says whether a request of the class is admitted, and counts it as in-flight until `Done` is called
+func (s *LoadShedder) Admit(class string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.limit > 0 && float64(s.inFlight) >= priorityShares[class]*float64(s.limit) {
+		return false
+	}
+	s.inFlight++
+	return true
+}
+
+// Done marks the end of an admitted request
+func (s *LoadShedder) Done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+}
+
+// PriorityClass returns the priority class of a request by its method and path without the host prefix.
+// Exports and reports have the lowest priority, followed by searches and then other reads such as balances,
+// while writes along with the monitors are shed last.
+func PriorityClass(method, path string) string {
+	switch {
+	case strings.HasSuffix(path, "/_export"), strings.HasPrefix(path, "/v1/export"),
+		strings.HasPrefix(path, "/v1/reports"), path == "/v1/snapshots/_diff", path == "/v1/admin/clone":
+		return PriorityExport
+	case strings.HasSuffix(path, "/_search"), path == "/v1/_msearch":
+		return PrioritySearch
+	case method != http.MethodGet, path == "/ping", path == "/ready", path == "/metrics":
+		return PriorityWrite
+	case path == "/v1/transactions", path == "/v1/accounts", path == "/v1/lines":
+		return PrioritySearch
+	}
+	return PriorityBalance
+}
+
+// LoadSheddingMiddleware is a middleware that rejects the requests which aren't admitted by the load shedder
+// with `503 Service Unavailable`
+func LoadSheddingMiddleware(handler http.HandlerFunc, shedder *LoadShedder, hostPrefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		class := PriorityClass(r.Method, strings.TrimPrefix(r.URL.Path, hostPrefix))
+		if !shedder.Admit(class) {
+			shedRequests.Inc(class)
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		defer shedder.Done()
+		handler.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,90 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadShedder(t *testing.T) {
+	shedder := NewLoadShedder(10)
+	for i := 0; i < 4; i++ {
+		assert.True(t, shedder.Admit(PriorityExport), "Export should be admitted")
+	}
+	assert.False(t, shedder.Admit(PriorityExport), "Export should be shed beyond its share")
+	assert.True(t, shedder.Admit(PrioritySearch), "Search should be admitted")
+	assert.True(t, shedder.Admit(PrioritySearch), "Search should be admitted")
+	assert.False(t, shedder.Admit(PrioritySearch), "Search should be shed beyond its share")
+	assert.True(t, shedder.Admit(PriorityBalance), "Balance read should be admitted")
+	assert.True(t, shedder.Admit(PriorityBalance), "Balance read should be admitted")
+	assert.False(t, shedder.Admit(PriorityBalance), "Balance read should be shed beyond its share")
+	assert.True(t, shedder.Admit(PriorityWrite), "Write should be admitted")
+	assert.True(t, shedder.Admit(PriorityWrite), "Write should be admitted")
+	assert.False(t, shedder.Admit(PriorityWrite), "Write should be shed beyond the limit")
+
+	// Completed requests make room for the lower priority requests
+	for i := 0; i < 7; i++ {
+		shedder.Done()
+	}
+	assert.True(t, shedder.Admit(PriorityExport), "Export should be admitted")
+
+	// Disabled
+	shedder.SetLimit(0)
+	assert.True(t, shedder.Admit(PriorityExport), "Export should be admitted without a limit")
+}
+
+func TestPriorityClass(t *testing.T) {
+	classes := map[string][2]string{
+		"POST /v1/transactions":           {"POST", "/v1/transactions"},
+		"PUT /v1/accounts":                {"PUT", "/v1/accounts"},
+		"GET /ping":                       {"GET", "/ping"},
+		"GET /v1/accounts/alice":          {"GET", "/v1/accounts/alice"},
+		"GET /v1/transactions/t001/proof": {"GET", "/v1/transactions/t001/proof"},
+		"GET /v1/transactions":            {"GET", "/v1/transactions"},
+		"POST /v1/accounts/_search":       {"POST", "/v1/accounts/_search"},
+		"POST /v1/_msearch":               {"POST", "/v1/_msearch"},
+		"GET /v1/transactions/_export":    {"GET", "/v1/transactions/_export"},
+		"POST /v1/reports/_run":           {"POST", "/v1/reports/_run"},
+		"GET /v1/export":                  {"GET", "/v1/export"},
+	}
+	expected := map[string]string{
+		"POST /v1/transactions":           PriorityWrite,
+		"PUT /v1/accounts":                PriorityWrite,
+		"GET /ping":                       PriorityWrite,
+		"GET /v1/accounts/alice":          PriorityBalance,
+		"GET /v1/transactions/t001/proof": PriorityBalance,
+		"GET /v1/transactions":            PrioritySearch,
+		"POST /v1/accounts/_search":       PrioritySearch,
+		"POST /v1/_msearch":               PrioritySearch,
+		"GET /v1/transactions/_export":    PriorityExport,
+		"POST /v1/reports/_run":           PriorityExport,
+		"GET /v1/export":                  PriorityExport,
+	}
+	for name, request := range classes {
+		assert.Equal(t, expected[name], PriorityClass(request[0], request[1]), "Invalid priority class of: %v", name)
+	}
+}
+
+func TestLoadSheddingMiddleware(t *testing.T) {
+	shedder := NewLoadShedder(1)
+	handler := LoadSheddingMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, shedder, "/ledger")
+
+	req, err := http.NewRequest("GET", "/ledger/v1/accounts/alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Request should be admitted")
+
+	// A balance read is shed while a request is in flight
+	shedder.Admit(PriorityWrite)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "Request should be shed")
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"), "Invalid Retry-After")
+}
@@ -0,0 +1,36 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RealImage/QLedger/slo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSLOMiddleware(t *testing.T) {
+	tracker := slo.NewTracker("middleware_test", time.Minute, 0.99)
+	status := http.StatusCreated
+	handler := SLOMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}, tracker)
+
+	req, err := http.NewRequest("POST", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr1 := httptest.NewRecorder()
+	handler.ServeHTTP(rr1, req)
+	assert.Equal(t, http.StatusCreated, rr1.Code, "Invalid response code")
+
+	status = http.StatusInternalServerError
+	rr2 := httptest.NewRecorder()
+	handler.ServeHTTP(rr2, req)
+	assert.Equal(t, http.StatusInternalServerError, rr2.Code, "Invalid response code")
+
+	window := tracker.Summary().Windows[0]
+	assert.Equal(t, int64(2), window.Total, "Invalid total")
+	assert.Equal(t, int64(1), window.Bad, "Invalid bad count")
+}
@@ -0,0 +1,8 @@
+CREATE TABLE fx_rates (
+    source character varying NOT NULL,
+    from_currency character varying NOT NULL,
+    to_currency character varying NOT NULL,
+    rate double precision NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    CONSTRAINT fx_rates_pkey PRIMARY KEY (source, from_currency, to_currency)
+);
@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP INDEX IF EXISTS lines_unreconciled_account_id_idx;
+
+ALTER TABLE lines DROP COLUMN IF EXISTS reconciled_at;
+ALTER TABLE lines DROP COLUMN IF EXISTS statement_ref;
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+ALTER TABLE lines ADD COLUMN statement_ref character varying;
+ALTER TABLE lines ADD COLUMN reconciled_at timestamp without time zone;
+
+CREATE INDEX lines_unreconciled_account_id_idx ON lines USING btree (account_id) WHERE reconciled_at IS NULL;
+
+COMMIT;
@@ -0,0 +1,7 @@
+CREATE TABLE report_definitions (
+    id character varying NOT NULL,
+    definition jsonb NOT NULL,
+    schedule character varying DEFAULT ''::character varying NOT NULL,
+    last_run_at timestamp without time zone,
+    CONSTRAINT report_definitions_pkey PRIMARY KEY (id)
+);
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE report_definitions DROP COLUMN IF EXISTS materialized_at;
+ALTER TABLE report_definitions DROP COLUMN IF EXISTS result;
+
+COMMIT;
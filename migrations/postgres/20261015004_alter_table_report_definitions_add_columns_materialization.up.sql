@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE report_definitions ADD COLUMN result jsonb;
+ALTER TABLE report_definitions ADD COLUMN materialized_at timestamp without time zone;
+
+COMMIT;
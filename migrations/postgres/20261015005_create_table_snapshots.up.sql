@@ -0,0 +1,10 @@
+BEGIN;
+
+CREATE TABLE snapshots (
+    name character varying NOT NULL,
+    sequence bigint NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    CONSTRAINT snapshots_pkey PRIMARY KEY (name)
+);
+
+COMMIT;
@@ -0,0 +1,21 @@
+BEGIN;
+
+DROP VIEW IF EXISTS invalid_transactions;
+CREATE VIEW invalid_transactions AS
+ SELECT lines.transaction_id,
+    sum(lines.delta) AS sum
+   FROM lines
+  GROUP BY lines.transaction_id
+ HAVING (sum(lines.delta) > 0);
+
+DROP VIEW IF EXISTS current_balances;
+CREATE VIEW current_balances AS
+SELECT accounts.id, accounts.data,
+    COALESCE(SUM(lines.delta), 0) AS balance
+  FROM accounts LEFT OUTER JOIN lines
+  ON (accounts.id = lines.account_id)
+  GROUP BY accounts.id;
+
+ALTER TABLE lines DROP COLUMN IF EXISTS currency;
+
+COMMIT;
@@ -0,0 +1,25 @@
+BEGIN;
+
+ALTER TABLE lines ADD COLUMN currency character varying DEFAULT '' NOT NULL;
+
+DROP VIEW IF EXISTS current_balances;
+CREATE VIEW current_balances AS
+SELECT accounts.id, accounts.data,
+    COALESCE(SUM(balances.balance), 0) AS balance,
+    COALESCE(jsonb_object_agg(balances.currency, balances.balance) FILTER (WHERE balances.currency <> ''), '{}') AS balances
+  FROM accounts LEFT OUTER JOIN (
+      SELECT account_id, currency, SUM(delta) AS balance FROM lines GROUP BY account_id, currency
+  ) AS balances
+  ON (accounts.id = balances.account_id)
+  GROUP BY accounts.id;
+
+DROP VIEW IF EXISTS invalid_transactions;
+CREATE VIEW invalid_transactions AS
+ SELECT lines.transaction_id,
+    lines.currency,
+    sum(lines.delta) AS sum
+   FROM lines
+  GROUP BY lines.transaction_id, lines.currency
+ HAVING (sum(lines.delta) <> 0);
+
+COMMIT;
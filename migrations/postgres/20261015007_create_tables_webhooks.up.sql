@@ -0,0 +1,28 @@
+BEGIN;
+
+CREATE TABLE webhooks (
+    id character varying NOT NULL,
+    url character varying NOT NULL,
+    secret character varying NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    CONSTRAINT webhooks_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE webhook_deliveries (
+    id bigserial NOT NULL,
+    webhook_id character varying NOT NULL,
+    event character varying NOT NULL,
+    payload jsonb NOT NULL,
+    status character varying NOT NULL,
+    attempts integer DEFAULT 0 NOT NULL,
+    last_error character varying,
+    next_attempt_at timestamp without time zone NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    delivered_at timestamp without time zone,
+    CONSTRAINT webhook_deliveries_pkey PRIMARY KEY (id),
+    CONSTRAINT webhook_deliveries_webhook_id_fkey FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries USING btree (next_attempt_at) WHERE status = 'pending';
+
+COMMIT;
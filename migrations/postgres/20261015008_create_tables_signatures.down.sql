@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS transaction_signatures;
+DROP TABLE IF EXISTS client_keys;
+
+COMMIT;
@@ -0,0 +1,22 @@
+BEGIN;
+
+CREATE TABLE client_keys (
+    id character varying NOT NULL,
+    client character varying NOT NULL,
+    public_key character varying NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    revoked_at timestamp without time zone,
+    CONSTRAINT client_keys_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE transaction_signatures (
+    transaction_id character varying NOT NULL,
+    key_id character varying NOT NULL,
+    signature character varying NOT NULL,
+    verified_at timestamp without time zone NOT NULL,
+    CONSTRAINT transaction_signatures_pkey PRIMARY KEY (transaction_id),
+    CONSTRAINT transaction_signatures_transaction_id_fkey FOREIGN KEY (transaction_id) REFERENCES transactions(id),
+    CONSTRAINT transaction_signatures_key_id_fkey FOREIGN KEY (key_id) REFERENCES client_keys(id)
+);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS merkle_leaves;
+DROP TABLE IF EXISTS merkle_trees;
+
+COMMIT;
@@ -0,0 +1,26 @@
+BEGIN;
+
+CREATE TABLE merkle_trees (
+    id bigserial NOT NULL,
+    root character varying NOT NULL,
+    size integer NOT NULL,
+    sequence bigint NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    anchor character varying,
+    anchored_at timestamp without time zone,
+    CONSTRAINT merkle_trees_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE merkle_leaves (
+    transaction_id character varying NOT NULL,
+    tree_id bigint NOT NULL,
+    "position" integer NOT NULL,
+    hash character varying NOT NULL,
+    CONSTRAINT merkle_leaves_pkey PRIMARY KEY (transaction_id),
+    CONSTRAINT merkle_leaves_transaction_id_fkey FOREIGN KEY (transaction_id) REFERENCES transactions(id),
+    CONSTRAINT merkle_leaves_tree_id_fkey FOREIGN KEY (tree_id) REFERENCES merkle_trees(id)
+);
+
+CREATE UNIQUE INDEX merkle_leaves_tree_id_position_idx ON merkle_leaves USING btree (tree_id, "position");
+
+COMMIT;
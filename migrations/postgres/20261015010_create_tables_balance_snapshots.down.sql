@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS lines_account_id_id_idx;
+DROP TABLE IF EXISTS account_balance_snapshots;
+DROP TABLE IF EXISTS balance_rollups;
+
+COMMIT;
@@ -0,0 +1,21 @@
+BEGIN;
+
+CREATE TABLE balance_rollups (
+    as_of timestamp without time zone NOT NULL,
+    sequence bigint NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    CONSTRAINT balance_rollups_pkey PRIMARY KEY (as_of)
+);
+
+CREATE TABLE account_balance_snapshots (
+    account_id character varying NOT NULL,
+    currency character varying NOT NULL,
+    as_of timestamp without time zone NOT NULL,
+    balance bigint NOT NULL,
+    CONSTRAINT account_balance_snapshots_pkey PRIMARY KEY (account_id, as_of, currency),
+    CONSTRAINT account_balance_snapshots_as_of_fkey FOREIGN KEY (as_of) REFERENCES balance_rollups(as_of) ON DELETE CASCADE
+);
+
+CREATE INDEX lines_account_id_id_idx ON lines USING btree (account_id, id);
+
+COMMIT;
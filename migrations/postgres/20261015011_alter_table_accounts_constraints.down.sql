@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE accounts DROP COLUMN IF EXISTS frozen;
+ALTER TABLE accounts DROP COLUMN IF EXISTS min_balance;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE accounts ADD COLUMN min_balance bigint;
+ALTER TABLE accounts ADD COLUMN frozen boolean DEFAULT false NOT NULL;
+
+COMMIT;
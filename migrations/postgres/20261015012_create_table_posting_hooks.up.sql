@@ -0,0 +1,13 @@
+BEGIN;
+
+CREATE TABLE posting_hooks (
+    id character varying NOT NULL,
+    url character varying NOT NULL,
+    secret character varying NOT NULL,
+    timeout_ms integer NOT NULL,
+    fail_open boolean DEFAULT false NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    CONSTRAINT posting_hooks_pkey PRIMARY KEY (id)
+);
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE lines DROP COLUMN IF EXISTS rounding;
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE lines ADD COLUMN rounding character varying;
+
+COMMIT;
@@ -0,0 +1,23 @@
+BEGIN;
+
+CREATE TABLE ledgers (
+    id character varying NOT NULL,
+    data jsonb DEFAULT '{}'::jsonb NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    CONSTRAINT ledgers_pkey PRIMARY KEY (id)
+);
+
+CREATE TABLE api_keys (
+    id character varying NOT NULL,
+    ledger_id character varying NOT NULL,
+    key_hash character varying NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    revoked_at timestamp without time zone,
+    CONSTRAINT api_keys_pkey PRIMARY KEY (id),
+    CONSTRAINT api_keys_key_hash_key UNIQUE (key_hash),
+    CONSTRAINT api_keys_ledger_id_fkey FOREIGN KEY (ledger_id) REFERENCES ledgers(id)
+);
+
+CREATE INDEX api_keys_ledger_id_idx ON api_keys (ledger_id);
+
+COMMIT;
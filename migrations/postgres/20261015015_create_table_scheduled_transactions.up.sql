@@ -0,0 +1,17 @@
+BEGIN;
+
+CREATE TABLE scheduled_transactions (
+    id character varying NOT NULL,
+    transaction jsonb NOT NULL,
+    post_at timestamp without time zone NOT NULL,
+    status character varying NOT NULL,
+    last_error character varying,
+    claimed_until timestamp without time zone,
+    created_at timestamp without time zone NOT NULL,
+    posted_at timestamp without time zone,
+    CONSTRAINT scheduled_transactions_pkey PRIMARY KEY (id)
+);
+
+CREATE INDEX scheduled_transactions_pending_idx ON scheduled_transactions USING btree (post_at) WHERE status = 'pending';
+
+COMMIT;
@@ -0,0 +1,20 @@
+BEGIN;
+
+-- The sequence is the order in which the transactions are posted, starting with the existing
+-- transactions in the order of their timestamps
+ALTER TABLE transactions ADD COLUMN sequence bigint;
+
+CREATE SEQUENCE transactions_sequence_seq OWNED BY transactions.sequence;
+
+UPDATE transactions SET sequence = ordered.sequence
+    FROM (SELECT id, row_number() OVER (ORDER BY timestamp, id) AS sequence FROM transactions) AS ordered
+    WHERE transactions.id = ordered.id;
+
+SELECT setval('transactions_sequence_seq', COALESCE((SELECT MAX(sequence) FROM transactions), 0) + 1, false);
+
+ALTER TABLE transactions ALTER COLUMN sequence SET DEFAULT nextval('transactions_sequence_seq'::regclass);
+ALTER TABLE transactions ALTER COLUMN sequence SET NOT NULL;
+
+CREATE UNIQUE INDEX transactions_sequence_idx ON transactions USING btree (sequence);
+
+COMMIT;
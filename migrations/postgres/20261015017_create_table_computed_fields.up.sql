@@ -0,0 +1,11 @@
+BEGIN;
+
+CREATE TABLE computed_fields (
+    name character varying NOT NULL,
+    function character varying NOT NULL,
+    currency character varying DEFAULT ''::character varying NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    CONSTRAINT computed_fields_pkey PRIMARY KEY (name)
+);
+
+COMMIT;
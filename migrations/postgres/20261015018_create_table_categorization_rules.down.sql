@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS category;
+
+DROP TABLE IF EXISTS categorization_rules;
+
+COMMIT;
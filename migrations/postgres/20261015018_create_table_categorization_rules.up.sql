@@ -0,0 +1,17 @@
+BEGIN;
+
+CREATE TABLE categorization_rules (
+    id character varying NOT NULL,
+    category character varying NOT NULL,
+    priority integer DEFAULT 0 NOT NULL,
+    data jsonb DEFAULT '{}'::jsonb NOT NULL,
+    accounts character varying[] DEFAULT '{}'::character varying[] NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    CONSTRAINT categorization_rules_pkey PRIMARY KEY (id)
+);
+
+ALTER TABLE transactions ADD COLUMN category character varying;
+
+CREATE INDEX transactions_category_idx ON transactions (category);
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS transactions_content_hash_idx;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS content_hash;
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+-- The content hash is computed by the ledger when a transaction is posted, so the existing
+-- transactions are left without one
+ALTER TABLE transactions ADD COLUMN content_hash character varying;
+
+CREATE INDEX transactions_content_hash_idx ON transactions USING btree (content_hash);
+
+COMMIT;
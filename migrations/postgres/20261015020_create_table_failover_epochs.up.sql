@@ -0,0 +1,10 @@
+BEGIN;
+
+CREATE TABLE failover_epochs (
+    epoch bigint NOT NULL,
+    primary_region character varying NOT NULL,
+    promoted_at timestamp without time zone NOT NULL,
+    CONSTRAINT failover_epochs_pkey PRIMARY KEY (epoch)
+);
+
+COMMIT;
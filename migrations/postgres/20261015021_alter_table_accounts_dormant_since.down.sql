@@ -0,0 +1,17 @@
+BEGIN;
+
+DROP VIEW IF EXISTS current_balances;
+CREATE VIEW current_balances AS
+SELECT accounts.id, accounts.data,
+    COALESCE(SUM(balances.balance), 0) AS balance,
+    COALESCE(jsonb_object_agg(balances.currency, balances.balance) FILTER (WHERE balances.currency <> ''), '{}') AS balances
+  FROM accounts LEFT OUTER JOIN (
+      SELECT account_id, currency, SUM(delta) AS balance FROM lines GROUP BY account_id, currency
+  ) AS balances
+  ON (accounts.id = balances.account_id)
+  GROUP BY accounts.id;
+
+DROP INDEX IF EXISTS accounts_dormant_since_idx;
+ALTER TABLE accounts DROP COLUMN IF EXISTS dormant_since;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE api_keys DROP COLUMN IF EXISTS metadata_write;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS metadata_read;
+
+COMMIT;
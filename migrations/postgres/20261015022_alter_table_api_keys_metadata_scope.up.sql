@@ -0,0 +1,7 @@
+BEGIN;
+
+-- The data keys which an API key can read and write, where null doesn't restrict the keys
+ALTER TABLE api_keys ADD COLUMN metadata_read character varying[];
+ALTER TABLE api_keys ADD COLUMN metadata_write character varying[];
+
+COMMIT;
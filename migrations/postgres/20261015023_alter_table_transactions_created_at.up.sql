@@ -0,0 +1,10 @@
+BEGIN;
+
+-- The creation time of a transaction bounds the window within which it can be repeated.
+-- The default is set after the column is added, so that the existing transactions are left
+-- without one and fall back to their timestamp.
+ALTER TABLE transactions ADD COLUMN created_at timestamp without time zone;
+
+ALTER TABLE transactions ALTER COLUMN created_at SET DEFAULT timezone('utc'::text, now());
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+-- The settings are a single row, which is missing until they are set
+CREATE TABLE idempotency_settings (
+    id boolean DEFAULT true NOT NULL,
+    window_seconds bigint NOT NULL,
+    on_mismatch character varying NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    CONSTRAINT idempotency_settings_pkey PRIMARY KEY (id),
+    CONSTRAINT idempotency_settings_single_row CHECK (id)
+);
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+CREATE TABLE routing_rules (
+    id character varying NOT NULL,
+    pattern character varying NOT NULL,
+    priority integer DEFAULT 0 NOT NULL,
+    account character varying,
+    lookup jsonb,
+    created_at timestamp without time zone NOT NULL,
+    CONSTRAINT routing_rules_pkey PRIMARY KEY (id)
+);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS webhook_deliveries_created_at_idx;
+DROP TABLE IF EXISTS retention_settings;
+
+COMMIT;
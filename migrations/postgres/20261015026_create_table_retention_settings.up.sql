@@ -0,0 +1,18 @@
+BEGIN;
+
+-- The settings are a single row, which is missing until they are set.
+-- A null period keeps the rows of the table forever.
+CREATE TABLE retention_settings (
+    id boolean DEFAULT true NOT NULL,
+    webhook_deliveries_days integer,
+    scheduled_transactions_days integer,
+    updated_at timestamp without time zone NOT NULL,
+    last_purged_at timestamp without time zone,
+    last_purged jsonb,
+    CONSTRAINT retention_settings_pkey PRIMARY KEY (id),
+    CONSTRAINT retention_settings_single_row CHECK (id)
+);
+
+CREATE INDEX webhook_deliveries_created_at_idx ON webhook_deliveries USING btree (created_at) WHERE ((status)::text <> 'pending'::text);
+
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN;
+
+CREATE TABLE cache_policies (
+    id character varying NOT NULL,
+    prefix character varying NOT NULL,
+    max_age_seconds integer NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    CONSTRAINT cache_policies_pkey PRIMARY KEY (id)
+);
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE cache_policies DROP COLUMN IF EXISTS shared;
+
+COMMIT;
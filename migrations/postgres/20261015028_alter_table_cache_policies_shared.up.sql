@@ -0,0 +1,7 @@
+BEGIN;
+
+-- The responses of the shared policies can be cached by the shared caches, such as CDNs,
+-- and the others only by the private caches of the clients
+ALTER TABLE cache_policies ADD COLUMN shared boolean DEFAULT false NOT NULL;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS transactions_reverses_idx;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS reverses;
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+-- The transaction reversed by a reversal is recorded by the ledger,
+-- so that a transaction can be reversed only once
+ALTER TABLE transactions ADD COLUMN reverses character varying;
+
+UPDATE transactions SET reverses = data->>'reverses'
+    WHERE data ? 'reverses' AND id = (data->>'reverses') || '.reversal';
+
+CREATE UNIQUE INDEX transactions_reverses_idx ON transactions USING btree (reverses);
+
+COMMIT;
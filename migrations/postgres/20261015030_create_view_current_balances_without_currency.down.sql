@@ -0,0 +1,16 @@
+BEGIN;
+
+DROP VIEW IF EXISTS current_balances;
+CREATE VIEW current_balances AS
+SELECT accounts.id, accounts.data,
+    COALESCE(SUM(balances.balance), 0) AS balance,
+    COALESCE(jsonb_object_agg(balances.currency, balances.balance) FILTER (WHERE balances.currency <> ''), '{}') AS balances,
+    accounts.dormant_since IS NOT NULL AS dormant,
+    accounts.dormant_since
+  FROM accounts LEFT OUTER JOIN (
+      SELECT account_id, currency, SUM(delta) AS balance FROM lines GROUP BY account_id, currency
+  ) AS balances
+  ON (accounts.id = balances.account_id)
+  GROUP BY accounts.id;
+
+COMMIT;
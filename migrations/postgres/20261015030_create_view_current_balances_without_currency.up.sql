@@ -0,0 +1,18 @@
+BEGIN;
+
+-- The balance sums up only the lines without a currency, as the lines of different currencies can't be added up.
+-- The balance of each currency is in the balances.
+DROP VIEW IF EXISTS current_balances;
+CREATE VIEW current_balances AS
+SELECT accounts.id, accounts.data,
+    COALESCE(SUM(balances.balance) FILTER (WHERE balances.currency = ''), 0) AS balance,
+    COALESCE(jsonb_object_agg(balances.currency, balances.balance) FILTER (WHERE balances.currency <> ''), '{}') AS balances,
+    accounts.dormant_since IS NOT NULL AS dormant,
+    accounts.dormant_since
+  FROM accounts LEFT OUTER JOIN (
+      SELECT account_id, currency, SUM(delta) AS balance FROM lines GROUP BY account_id, currency
+  ) AS balances
+  ON (accounts.id = balances.account_id)
+  GROUP BY accounts.id;
+
+COMMIT;
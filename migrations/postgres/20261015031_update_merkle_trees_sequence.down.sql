@@ -0,0 +1,8 @@
+BEGIN;
+
+UPDATE merkle_trees SET sequence = COALESCE((
+    SELECT MAX(lines.id) FROM merkle_leaves JOIN lines ON lines.transaction_id = merkle_leaves.transaction_id
+    WHERE merkle_leaves.tree_id = merkle_trees.id
+), 0);
+
+COMMIT;
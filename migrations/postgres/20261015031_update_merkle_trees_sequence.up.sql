@@ -0,0 +1,10 @@
+BEGIN;
+
+-- The sequence of a tree is the sequence of its last transaction, from which the next tree is built,
+-- rather than the latest line when it was built
+UPDATE merkle_trees SET sequence = COALESCE((
+    SELECT MAX(transactions.sequence) FROM merkle_leaves JOIN transactions ON transactions.id = merkle_leaves.transaction_id
+    WHERE merkle_leaves.tree_id = merkle_trees.id
+), 0);
+
+COMMIT;
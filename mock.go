@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/RealImage/QLedger/mock"
+	"github.com/RealImage/QLedger/models"
+)
+
+// mockCommand runs `QLedger mock`, which serves the core API from an in-memory store without a DB,
+// such as for developing and testing the clients
+func mockCommand(args []string) int {
+	flags := flag.NewFlagSet("mock", flag.ContinueOnError)
+	addr := flags.String("addr", ":7000", "address to serve the mock API on")
+	token := flags.String("token", os.Getenv("LEDGER_AUTH_TOKEN"), "token of the Authorization header, if required")
+	prefix := flags.String("host-prefix", os.Getenv("HOST_PREFIX"), "prefix of the routes")
+	clock := flags.String("clock", mock.DefaultClock.Format(models.LedgerTimestampLayout),
+		"timestamp of the first transaction posted without a timestamp, with the next ones a second apart")
+	faults := mock.Faults{}
+	flags.DurationVar(&faults.Latency, "latency", 0, "latency added to every response")
+	flags.Float64Var(&faults.ErrorRate, "error-rate", 0, "fraction of the requests failed without serving them")
+	flags.Float64Var(&faults.LostRate, "lost-rate", 0, "fraction of the writes served but failed as if their response was lost")
+	flags.IntVar(&faults.ErrorStatus, "error-status", http.StatusServiceUnavailable, "status of the failed requests")
+	flags.Int64Var(&faults.Seed, "seed", 1, "seed of the injected faults")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	start, err := time.Parse(models.LedgerTimestampLayout, *clock)
+	if err != nil {
+		log.Println("Invalid clock:", *clock)
+		return 2
+	}
+
+	server := mock.NewServer(mock.NewStore(start), *token, *prefix, faults)
+	log.Println("Serving mock API on", *addr)
+	if err := http.ListenAndServe(*addr, server); err != nil {
+		log.Println("Unable to serve mock API:", err)
+		return 1
+	}
+	return 0
+}
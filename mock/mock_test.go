@@ -0,0 +1,128 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func request(server http.Handler, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestMockTransactions(t *testing.T) {
+	server := NewServer(NewStore(DefaultClock), "token", "", Faults{})
+	auth := map[string]string{"Authorization": "token"}
+	assert.Equal(t, http.StatusUnauthorized, request(server, "GET", "/v1/accounts", "", nil).Code, "Request should be authenticated")
+
+	txn := `{"id": "t1", "data": {"tag": "rent"}, "lines": [{"account": "alice", "delta": -100}, {"account": "bob", "delta": 100}]}`
+	assert.Equal(t, http.StatusCreated, request(server, "POST", "/v1/transactions", txn, auth).Code, "Invalid status")
+	assert.Equal(t, http.StatusAccepted, request(server, "POST", "/v1/transactions", txn, auth).Code, "Duplicate should be accepted")
+	conflicting := `{"id": "t1", "lines": [{"account": "alice", "delta": -200}, {"account": "bob", "delta": 200}]}`
+	assert.Equal(t, http.StatusConflict, request(server, "POST", "/v1/transactions", conflicting, auth).Code, "Conflict should be rejected")
+	unbalanced := `{"id": "t2", "lines": [{"account": "alice", "delta": -100}, {"account": "bob", "delta": 50}]}`
+	assert.Equal(t, http.StatusBadRequest, request(server, "POST", "/v1/transactions", unbalanced, auth).Code, "Invalid transaction should be rejected")
+	for _, invalid := range []string{
+		`{"id": "t2", "lines": [{"account": "alice", "delta": -100, "currency": "usd"}, {"account": "bob", "delta": 100, "currency": "usd"}]}`,
+		`{"id": "t2", "lines": [{"account": "alice", "delta": -100, "rounding": "sideways"}, {"account": "bob", "delta": 100}]}`,
+		`{"id": "t2", "timestamp": "today", "lines": [{"account": "alice", "delta": -100}, {"account": "bob", "delta": 100}]}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, request(server, "POST", "/v1/transactions", invalid, auth).Code, "Invalid transaction should be rejected: %v", invalid)
+	}
+	ref := `{"id": "t2", "lines": [{"account_ref": "customer:42", "delta": -100}, {"account": "bob", "delta": 100}]}`
+	rr := request(server, "POST", "/v1/transactions", ref, auth)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "Unmatched account reference should be rejected")
+	assert.Contains(t, rr.Body.String(), "account_ref.unmatched", "Invalid error code")
+	second := `{"id": "t2", "lines": [{"account": "bob", "delta": -30}, {"account": "carol", "delta": 30}]}`
+	assert.Equal(t, http.StatusCreated, request(server, "POST", "/v1/transactions", second, auth).Code, "Invalid status")
+
+	rr = request(server, "GET", "/v1/transactions/t2", "", auth)
+	assert.Equal(t, http.StatusOK, rr.Code, "Invalid status")
+	transaction := &models.TransactionResult{}
+	json.Unmarshal(rr.Body.Bytes(), transaction)
+	assert.Equal(t, "2017-06-30 00:00:01.000", transaction.Timestamp, "Timestamp should be deterministic")
+	assert.Equal(t, http.StatusNotFound, request(server, "GET", "/v1/transactions/t3", "", auth).Code, "Invalid status")
+
+	rr = request(server, "GET", "/v1/accounts/bob", "", auth)
+	account := &models.AccountResult{}
+	json.Unmarshal(rr.Body.Bytes(), account)
+	assert.Equal(t, 70, account.Balance, "Invalid balance")
+
+	var transactions []*models.TransactionResult
+	rr = request(server, "POST", "/v1/transactions/_search", `{"query": {"must": {"terms": [{"tag": "rent"}]}}}`, auth)
+	json.Unmarshal(rr.Body.Bytes(), &transactions)
+	assert.Equal(t, 1, len(transactions), "Invalid search results")
+	assert.Equal(t, "t1", transactions[0].ID, "Invalid search results")
+
+	var page struct {
+		Items      []*models.AccountResult `json:"items"`
+		NextCursor string                  `json:"next_cursor"`
+	}
+	query := `"query": {"must": {"fields": [{"balance": {"gte": 0}}]}}`
+	rr = request(server, "GET", "/v1/accounts", `{"limit": 1, `+query+`}`, auth)
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	assert.Equal(t, 1, len(page.Items), "Invalid page")
+	assert.Equal(t, "bob", page.Items[0].ID, "Accounts should be sorted by ID")
+	assert.NotEmpty(t, page.NextCursor, "Page should have next cursor")
+	rr = request(server, "GET", "/v1/accounts", `{"limit": 1, "after": "`+page.NextCursor+`", `+query+`}`, auth)
+	page.NextCursor = ""
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	assert.Equal(t, 1, len(page.Items), "Invalid page")
+	assert.Equal(t, "carol", page.Items[0].ID, "Invalid next page")
+	assert.Empty(t, page.NextCursor, "Last page should have no next cursor")
+
+	assert.Equal(t, http.StatusNotImplemented, request(server, "GET", "/v1/webhooks", "", auth).Code, "Invalid status")
+	assert.Equal(t, http.StatusNoContent, request(server, "POST", "/v1/mock/_reset", "", auth).Code, "Invalid status")
+	assert.Equal(t, http.StatusNotFound, request(server, "GET", "/v1/accounts/bob", "", auth).Code, "Store should be reset")
+}
+
+func TestMockAccounts(t *testing.T) {
+	server := NewServer(NewStore(DefaultClock), "", "/ledger", Faults{})
+	account := `{"id": "alice", "data": {"tier": "gold"}}`
+	assert.Equal(t, http.StatusCreated, request(server, "POST", "/ledger/v1/accounts", account, nil).Code, "Invalid status")
+	assert.Equal(t, http.StatusConflict, request(server, "POST", "/ledger/v1/accounts", account, nil).Code, "Invalid status")
+	assert.Equal(t, http.StatusNotFound, request(server, "PUT", "/ledger/v1/accounts", `{"id": "bob"}`, nil).Code, "Invalid status")
+	assert.Equal(t, http.StatusOK, request(server, "PUT", "/ledger/v1/accounts", `{"id": "alice", "data": {"tier": "silver"}}`, nil).Code, "Invalid status")
+
+	var accounts []*models.AccountResult
+	rr := request(server, "POST", "/ledger/v1/accounts/_search", `{"query": {"must": {"ranges": [{"tier": {"in": ["silver", "bronze"]}}]}}}`, nil)
+	json.Unmarshal(rr.Body.Bytes(), &accounts)
+	assert.Equal(t, 1, len(accounts), "Invalid search results")
+	assert.Equal(t, http.StatusBadRequest, request(server, "GET", "/ledger/v1/accounts", `{"sort": "balance"}`, nil).Code, "Invalid query should be rejected")
+}
+
+func TestMockFaults(t *testing.T) {
+	statuses := func() []int {
+		server := NewServer(NewStore(DefaultClock), "", "", Faults{ErrorRate: 0.5, Seed: 42})
+		var codes []int
+		for i := 0; i < 20; i++ {
+			codes = append(codes, request(server, "GET", "/ping", "", nil).Code)
+		}
+		return codes
+	}
+	first := statuses()
+	assert.Equal(t, first, statuses(), "Faults should be deterministic by the seed")
+	assert.Contains(t, first, http.StatusServiceUnavailable, "Some requests should fail")
+	assert.Contains(t, first, http.StatusOK, "Some requests should succeed")
+
+	server := NewServer(NewStore(DefaultClock), "", "", Faults{})
+	rr := request(server, "GET", "/ping", "", map[string]string{StatusHeader: "500"})
+	assert.Equal(t, http.StatusInternalServerError, rr.Code, "Status header should fail the request")
+
+	// A lost response still posts the transaction
+	server = NewServer(NewStore(DefaultClock), "", "", Faults{LostRate: 1, ErrorStatus: http.StatusGatewayTimeout})
+	txn := `{"id": "t1", "lines": [{"account": "alice", "delta": -100}, {"account": "bob", "delta": 100}]}`
+	assert.Equal(t, http.StatusGatewayTimeout, request(server, "POST", "/v1/transactions", txn, nil).Code, "Response should be lost")
+	assert.NotNil(t, server.Store.Transaction("t1"), "Transaction should be posted")
+}
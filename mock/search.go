@@ -0,0 +1,356 @@
+package mock
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/RealImage/QLedger/models"
+)
+
+// cursor is the position after the last item of a page, in the format of the cursors of the API
+type cursor struct {
+	Timestamp string `json:"t,omitempty"`
+	Sequence  int64  `json:"s,omitempty"`
+	ID        string `json:"id"`
+}
+
+func encodeCursor(c *cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) *cursor {
+	c := &cursor{}
+	data, _ := base64.RawURLEncoding.DecodeString(value)
+	json.Unmarshal(data, c)
+	return c
+}
+
+// record is an account or a transaction as it is searched
+type record struct {
+	fields map[string]interface{}
+	data   map[string]interface{}
+	cursor *cursor
+	result interface{}
+}
+
+func marshal(value interface{}) json.RawMessage {
+	data, _ := json.Marshal(value)
+	return data
+}
+
+// normalize returns the value as decoded from JSON, so that the numbers are compared as floats
+func normalize(value interface{}) interface{} {
+	var normalized interface{}
+	json.Unmarshal(marshal(value), &normalized)
+	return normalized
+}
+
+// compare compares the numbers or the strings, and returns false if they aren't comparable
+func compare(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		switch {
+		case !ok:
+			return 0, false
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	}
+	return 0, false
+}
+
+// likePattern converts the pattern of a SQL `LIKE` to a regexp
+func likePattern(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			expr.WriteString(".*")
+		case '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
+
+// matchOp says whether the value matches the operator of the search query on the expected value,
+// where a missing value is nil
+func matchOp(value interface{}, op string, expected interface{}) bool {
+	expected = normalize(expected)
+	switch op {
+	case "is":
+		return value == nil && expected == nil
+	case "isnot":
+		return value != nil || expected != nil
+	case "in", "nin":
+		values, _ := expected.([]interface{})
+		for _, v := range values {
+			if c, ok := compare(value, v); ok && c == 0 {
+				return op == "in"
+			}
+		}
+		return op == "nin"
+	case "like", "notlike":
+		s, ok := value.(string)
+		pattern, _ := expected.(string)
+		return ok && likePattern(pattern).MatchString(s) == (op == "like")
+	}
+	c, ok := compare(value, expected)
+	if !ok {
+		return false
+	}
+	switch op {
+	case "gt":
+		return c > 0
+	case "lt":
+		return c < 0
+	case "gte":
+		return c >= 0
+	case "lte":
+		return c <= 0
+	case "ne":
+		return c != 0
+	}
+	return c == 0
+}
+
+// contains says whether the value contains the other value, as the `@>` operator of `jsonb`
+func contains(value, other interface{}) bool {
+	switch o := other.(type) {
+	case map[string]interface{}:
+		v, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, item := range o {
+			if !contains(v[key], item) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		v, ok := value.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, item := range o {
+			found := false
+			for _, element := range v {
+				found = found || contains(element, item)
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+	// An array contains its scalar elements
+	if v, ok := value.([]interface{}); ok {
+		for _, element := range v {
+			if reflect.DeepEqual(element, other) {
+				return true
+			}
+		}
+		return false
+	}
+	return reflect.DeepEqual(value, other)
+}
+
+// conditions returns the conditions of the fields, terms and ranges of a clause of the search query
+func conditions(clause models.QueryContainer) []func(*record) bool {
+	var conditions []func(*record) bool
+	for _, field := range clause.Fields {
+		field := field
+		conditions = append(conditions, func(rec *record) bool {
+			for key, comparison := range field {
+				for op, expected := range comparison {
+					value := rec.fields[key]
+					// A date is the start of the day, as cast by the DB
+					if s, ok := expected.(string); ok && key == "timestamp" && len(s) == len("2006-01-02") {
+						expected = s + " 00:00:00.000"
+					}
+					if !matchOp(value, op, expected) {
+						return false
+					}
+				}
+			}
+			return true
+		})
+	}
+	for _, term := range clause.Terms {
+		term := term
+		conditions = append(conditions, func(rec *record) bool {
+			for key, expected := range term {
+				if !contains(rec.data[key], normalize(expected)) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	for _, item := range clause.RangeItems {
+		item := item
+		conditions = append(conditions, func(rec *record) bool {
+			for key, comparison := range item {
+				for op, expected := range comparison {
+					value, ok := rec.data[key]
+					// A missing key is neither null nor not null, as in the DB
+					if op == "null" {
+						if check, _ := expected.(bool); !ok || (value == nil) != check {
+							return false
+						}
+						continue
+					}
+					if op == "exists" {
+						if check, _ := expected.(bool); ok != check {
+							return false
+						}
+						continue
+					}
+					if !ok || !matchOp(value, op, expected) {
+						return false
+					}
+				}
+			}
+			return true
+		})
+	}
+	return conditions
+}
+
+// matches says whether the record matches all the must conditions and any of the should conditions
+func matches(rec *record, must, should []func(*record) bool) bool {
+	for _, condition := range must {
+		if !condition(rec) {
+			return false
+		}
+	}
+	if len(should) == 0 {
+		return true
+	}
+	for _, condition := range should {
+		if condition(rec) {
+			return true
+		}
+	}
+	return false
+}
+
+// search returns the results of the records matching the query in the order of the query, which are paginated
+// with either `from` and `size`, or the `after` cursor and `limit`
+func search(records []*record, rawQuery *models.SearchRawQuery, namespace string, results interface{}) interface{} {
+	must := conditions(rawQuery.Query.MustClause)
+	should := conditions(rawQuery.Query.ShouldClause)
+	var matched []*record
+	for _, rec := range records {
+		if matches(rec, must, should) {
+			matched = append(matched, rec)
+		}
+	}
+
+	desc := strings.HasPrefix(rawQuery.Sort, "-") ||
+		(rawQuery.Sort == "" && namespace == models.SearchNamespaceTransactions && rawQuery.SortTime == models.SortDescByTime)
+	bySequence := namespace == models.SearchNamespaceTransactions && strings.TrimPrefix(rawQuery.Sort, "-") == "sequence"
+	less := func(a, b *cursor) bool {
+		switch {
+		case bySequence && a.Sequence != b.Sequence:
+			return a.Sequence < b.Sequence
+		case !bySequence && a.Timestamp != b.Timestamp:
+			return a.Timestamp < b.Timestamp
+		}
+		return a.ID < b.ID
+	}
+	before := func(a, b *cursor) bool {
+		if desc {
+			return less(b, a)
+		}
+		return less(a, b)
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return before(matched[i].cursor, matched[j].cursor)
+	})
+
+	offset, limit := rawQuery.Offset, rawQuery.Limit
+	if rawQuery.PageSize > 0 {
+		limit = rawQuery.PageSize + 1
+		if rawQuery.After != "" {
+			after := decodeCursor(rawQuery.After)
+			offset = sort.Search(len(matched), func(i int) bool {
+				return before(after, matched[i].cursor)
+			})
+		}
+	}
+	if offset > len(matched) {
+		offset = len(matched)
+	}
+	matched = matched[offset:]
+	if limit > 0 && limit < len(matched) {
+		matched = matched[:limit]
+	}
+
+	var nextCursor string
+	if rawQuery.PageSize > 0 && len(matched) > rawQuery.PageSize {
+		matched = matched[:rawQuery.PageSize]
+		nextCursor = encodeCursor(matched[len(matched)-1].cursor)
+	}
+	items := reflect.ValueOf(results)
+	for _, rec := range matched {
+		items = reflect.Append(items, reflect.ValueOf(rec.result))
+	}
+	if rawQuery.PageSize > 0 {
+		return &models.SearchPage{Items: items.Interface(), NextCursor: nextCursor}
+	}
+	return items.Interface()
+}
+
+// SearchAccounts returns the accounts matching the search query of the API
+func (s *Store) SearchAccounts(rawQuery *models.SearchRawQuery) interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := make([]*record, 0, len(s.accounts))
+	for id, a := range s.accounts {
+		result := s.accountResult(id)
+		records = append(records, &record{
+			fields: map[string]interface{}{"id": id, "balance": float64(result.Balance)},
+			data:   normalize(a.data).(map[string]interface{}),
+			cursor: &cursor{ID: id},
+			result: result,
+		})
+	}
+	return search(records, rawQuery, models.SearchNamespaceAccounts, make([]*models.AccountResult, 0))
+}
+
+// SearchTransactions returns the transactions matching the search query of the API
+func (s *Store) SearchTransactions(rawQuery *models.SearchRawQuery) interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := make([]*record, 0, len(s.transactions))
+	for id, t := range s.transactions {
+		records = append(records, &record{
+			fields: map[string]interface{}{"id": id, "timestamp": t.Timestamp},
+			data:   normalize(t.Data).(map[string]interface{}),
+			cursor: &cursor{ID: id, Timestamp: t.Timestamp, Sequence: t.sequence},
+			result: transactionResult(t),
+		})
+	}
+	return search(records, rawQuery, models.SearchNamespaceTransactions, make([]*models.TransactionResult, 0))
+}
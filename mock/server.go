@@ -0,0 +1,305 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RealImage/QLedger/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Request headers which inject a fault into a single request, over the faults of the server
+const (
+	// StatusHeader fails the request with the status without serving it, such as `503`
+	StatusHeader = "X-Mock-Status"
+	// LatencyHeader delays the response by the duration, such as `2s`
+	LatencyHeader = "X-Mock-Latency"
+)
+
+// Faults are injected into the requests of the mock server. The failures are drawn from a random source
+// with the seed, so the same sequence of requests fails the same way in every run.
+type Faults struct {
+	// Latency delays every response
+	Latency time.Duration
+	// ErrorRate is the fraction of the requests failed with the error status without serving them
+	ErrorRate float64
+	// LostRate is the fraction of the writes which are served, but failed with the error status as if
+	// the response was lost, such as to test the retries of the clients
+	LostRate float64
+	// ErrorStatus is the status of the failed requests, `503 Service Unavailable` by default
+	ErrorStatus int
+	Seed        int64
+}
+
+// errorResponse is the body of the errors of the mock server, in the format of the API
+type errorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Server serves the core API of the ledger from the store: the accounts, the transactions and their searches.
+// The other endpoints respond with `501 Not Implemented`.
+type Server struct {
+	Store *Store
+	// Token authenticates the requests by the `Authorization` header, unless it is empty
+	Token  string
+	faults Faults
+	router *httprouter.Router
+
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+// NewServer returns the mock server of the store with the routes under the host prefix
+func NewServer(store *Store, token string, hostPrefix string, faults Faults) *Server {
+	if faults.ErrorStatus == 0 {
+		faults.ErrorStatus = http.StatusServiceUnavailable
+	}
+	s := &Server{
+		Store:  store,
+		Token:  token,
+		faults: faults,
+		router: httprouter.New(),
+		random: rand.New(rand.NewSource(faults.Seed)),
+	}
+	routes := []struct {
+		method, path string
+		handler      http.HandlerFunc
+	}{
+		{http.MethodGet, "/ping", s.ping},
+		{http.MethodPost, "/v1/accounts", s.addAccount},
+		{http.MethodPut, "/v1/accounts", s.updateAccount},
+		{http.MethodGet, "/v1/accounts", s.searchAccounts},
+		{http.MethodPost, "/v1/accounts/_search", s.searchAccounts},
+		{http.MethodGet, "/v1/accounts/:id", s.getAccount},
+		{http.MethodPost, "/v1/transactions", s.postTransaction},
+		{http.MethodGet, "/v1/transactions", s.searchTransactions},
+		{http.MethodPost, "/v1/transactions/_search", s.searchTransactions},
+		{http.MethodGet, "/v1/transactions/:id", s.getTransaction},
+		{http.MethodPost, "/v1/mock/_reset", s.reset},
+	}
+	for _, route := range routes {
+		s.router.HandlerFunc(route.method, hostPrefix+route.path, route.handler)
+	}
+	s.router.NotFound = http.HandlerFunc(notImplemented)
+	s.router.MethodNotAllowed = http.HandlerFunc(notImplemented)
+	return s
+}
+
+// draw returns whether a request fails, and whether a served write loses its response
+func (s *Server) draw() (bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.random.Float64() < s.faults.ErrorRate, s.random.Float64() < s.faults.LostRate
+}
+
+// ServeHTTP authenticates the request, injects the faults and serves it
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Token != "" && strings.TrimSpace(r.Header.Get("Authorization")) != s.Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	latency := s.faults.Latency
+	if value := r.Header.Get(LatencyHeader); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			latency = d
+		}
+	}
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	if value := r.Header.Get(StatusHeader); value != "" {
+		if status, err := strconv.Atoi(value); err == nil && status >= 100 && status <= 599 {
+			writeError(w, status, "mock.fault", "Fault injected by request header")
+			return
+		}
+	}
+
+	failed, lost := s.draw()
+	if failed {
+		writeError(w, s.faults.ErrorStatus, "mock.fault", "Fault injected by error rate")
+		return
+	}
+	if lost && r.Method != http.MethodGet {
+		s.router.ServeHTTP(discardWriter{header: make(http.Header)}, r)
+		writeError(w, s.faults.ErrorStatus, "mock.fault", "Response lost by fault injection")
+		return
+	}
+	s.router.ServeHTTP(w, r)
+}
+
+// discardWriter discards the response of a request whose response is lost
+type discardWriter struct {
+	header http.Header
+}
+
+func (d discardWriter) Header() http.Header         { return d.header }
+func (d discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d discardWriter) WriteHeader(int)             {}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	data, _ := json.Marshal(&errorResponse{Code: code, Message: message})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
+
+func notImplemented(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotImplemented, "mock.not_implemented",
+		fmt.Sprintf("Endpoint is not served by the mock server: %v %v", r.Method, r.URL.Path))
+}
+
+func (s *Server) ping(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{"ping": "pong"})
+}
+
+func (s *Server) reset(w http.ResponseWriter, r *http.Request) {
+	s.Store.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validKey is the format of the keys of the data, as validated by the API
+var validKey = regexp.MustCompile(`^[a-z_A-Z]+$`)
+
+// validData says whether the keys of the data are valid
+func validData(data map[string]interface{}) bool {
+	for key := range data {
+		if !validKey.MatchString(key) {
+			return false
+		}
+	}
+	return true
+}
+
+// readJSON decodes the body of the request, and returns false if it is invalid
+func readJSON(r *http.Request, value interface{}) bool {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(body, value) == nil
+}
+
+func (s *Server) addAccount(w http.ResponseWriter, r *http.Request) {
+	account := &models.Account{}
+	if !readJSON(r, account) || account.ID == "" || !validData(account.Data) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !s.Store.CreateAccount(account) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) updateAccount(w http.ResponseWriter, r *http.Request) {
+	account := &models.Account{}
+	if !readJSON(r, account) || !validData(account.Data) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !s.Store.UpdateAccount(account) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// pathID returns the ID of the resource of the request path, such as `/v1/accounts/{id}`
+func pathID(r *http.Request) string {
+	return r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+}
+
+func (s *Server) getAccount(w http.ResponseWriter, r *http.Request) {
+	account := s.Store.Account(pathID(r))
+	if account == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, account)
+}
+
+func (s *Server) postTransaction(w http.ResponseWriter, r *http.Request) {
+	transaction := &models.Transaction{}
+	if !readJSON(r, transaction) || transaction.ID == "" || transaction.ValidateData() != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, line := range transaction.Lines {
+		// There are no routing rules, so the account references are unmatched as by a ledger without rules
+		if line.AccountRef != "" {
+			aerr := models.AccountRefUnmatchedError(line.AccountRef)
+			writeError(w, http.StatusUnprocessableEntity, aerr.ErrorCode(), aerr.ErrorMessage())
+			return
+		}
+		if line.AccountID == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	if !transaction.IsValid() {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(s.Store.PostTransaction(transaction))
+}
+
+func (s *Server) getTransaction(w http.ResponseWriter, r *http.Request) {
+	transaction := s.Store.Transaction(pathID(r))
+	if transaction == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, transaction)
+}
+
+// searchQuery parses the search query of the request body, where an empty body matches everything
+func searchQuery(w http.ResponseWriter, r *http.Request) (*models.SearchRawQuery, bool) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		body = []byte("{}")
+	}
+	rawQuery, aerr := models.NewSearchRawQuery(string(body))
+	if aerr != nil {
+		writeError(w, http.StatusBadRequest, aerr.ErrorCode(), aerr.ErrorMessage())
+		return nil, false
+	}
+	return rawQuery, true
+}
+
+func (s *Server) searchAccounts(w http.ResponseWriter, r *http.Request) {
+	if rawQuery, ok := searchQuery(w, r); ok {
+		writeJSON(w, s.Store.SearchAccounts(rawQuery))
+	}
+}
+
+func (s *Server) searchTransactions(w http.ResponseWriter, r *http.Request) {
+	if rawQuery, ok := searchQuery(w, r); ok {
+		writeJSON(w, s.Store.SearchTransactions(rawQuery))
+	}
+}
@@ -0,0 +1,197 @@
+// Package mock serves the core API of the ledger from an in-memory store, so that clients can be developed
+// and tested without Postgres. Its behavior is deterministic: the same requests get the same responses,
+// including the timestamps of the transactions and the injected faults.
+package mock
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RealImage/QLedger/models"
+)
+
+// DefaultClock is the timestamp of the first transaction posted without a timestamp
+var DefaultClock = time.Date(2017, 6, 30, 0, 0, 0, 0, time.UTC)
+
+// Results of posting a transaction, which are the status codes of the API
+const (
+	posted    = 201
+	duplicate = 202
+	conflict  = 409
+)
+
+type account struct {
+	id   string
+	data map[string]interface{}
+}
+
+type transaction struct {
+	*models.Transaction
+	sequence int64
+}
+
+// Store holds the accounts and transactions of the mock ledger in memory
+type Store struct {
+	mu           sync.RWMutex
+	clock        time.Time
+	accounts     map[string]*account
+	transactions map[string]*transaction
+	// balances are the balances of the accounts by currency
+	balances map[string]map[string]int
+	sequence int64
+}
+
+// NewStore returns an empty store, whose transactions posted without a timestamp are a second apart
+// starting from the clock
+func NewStore(clock time.Time) *Store {
+	s := &Store{clock: clock}
+	s.Reset()
+	return s
+}
+
+// Reset removes all the accounts and transactions, and restarts the clock
+func (s *Store) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts = make(map[string]*account)
+	s.transactions = make(map[string]*transaction)
+	s.balances = make(map[string]map[string]int)
+	s.sequence = 0
+}
+
+// ensureAccount creates the account with empty data unless it exists
+func (s *Store) ensureAccount(id string) {
+	if _, ok := s.accounts[id]; !ok {
+		s.accounts[id] = &account{id: id, data: map[string]interface{}{}}
+		s.balances[id] = make(map[string]int)
+	}
+}
+
+// CreateAccount creates the account, and returns false if it already exists
+func (s *Store) CreateAccount(a *models.Account) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.accounts[a.ID]; ok {
+		return false
+	}
+	s.ensureAccount(a.ID)
+	if a.Data != nil {
+		s.accounts[a.ID].data = a.Data
+	}
+	return true
+}
+
+// UpdateAccount replaces the data of the account, and returns false if it doesn't exist
+func (s *Store) UpdateAccount(a *models.Account) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.accounts[a.ID]
+	if !ok {
+		return false
+	}
+	existing.data = a.Data
+	if existing.data == nil {
+		existing.data = map[string]interface{}{}
+	}
+	return true
+}
+
+// Account returns the account along with its balances, or nil if it doesn't exist
+func (s *Store) Account(id string) *models.AccountResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.accounts[id]; !ok {
+		return nil
+	}
+	return s.accountResult(id)
+}
+
+func (s *Store) accountResult(id string) *models.AccountResult {
+	balance := 0
+	balances := make(map[string]int)
+	for currency, value := range s.balances[id] {
+		if currency == "" {
+			balance = value
+		} else {
+			balances[currency] = value
+		}
+	}
+	return &models.AccountResult{
+		ID:       id,
+		Balance:  balance,
+		Balances: marshal(balances),
+		Data:     marshal(s.accounts[id].data),
+	}
+}
+
+// PostTransaction posts the valid transaction, and returns whether it is posted, a duplicate of an existing
+// transaction with the same lines, or conflicting with an existing transaction with different lines
+func (s *Store) PostTransaction(t *models.Transaction) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.transactions[t.ID]; ok {
+		if sameLines(existing.Lines, t.Lines) {
+			return duplicate
+		}
+		return conflict
+	}
+	s.sequence++
+	if t.Timestamp == "" {
+		t.Timestamp = s.clock.Add(time.Duration(s.sequence-1) * time.Second).Format(models.LedgerTimestampLayout)
+	}
+	if t.Data == nil {
+		t.Data = map[string]interface{}{}
+	}
+	for _, line := range t.Lines {
+		s.ensureAccount(line.AccountID)
+		s.balances[line.AccountID][line.Currency] += line.Delta
+	}
+	s.transactions[t.ID] = &transaction{Transaction: t, sequence: s.sequence}
+	return posted
+}
+
+// sameLines says whether the lines have the same deltas of the same accounts, in any order
+func sameLines(a, b []*models.TransactionLine) bool {
+	key := func(lines []*models.TransactionLine) map[models.TransactionLine]int {
+		counts := make(map[models.TransactionLine]int)
+		for _, line := range lines {
+			counts[models.TransactionLine{AccountID: line.AccountID, Delta: line.Delta, Currency: line.Currency}]++
+		}
+		return counts
+	}
+	return reflect.DeepEqual(key(a), key(b))
+}
+
+// Transaction returns the transaction, or nil if it doesn't exist
+func (s *Store) Transaction(id string) *models.TransactionResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.transactions[id]
+	if !ok {
+		return nil
+	}
+	return transactionResult(t)
+}
+
+// transactionResult returns the transaction with its lines ordered by the account, as the API does
+func transactionResult(t *transaction) *models.TransactionResult {
+	result := &models.TransactionResult{
+		ID:        t.ID,
+		Timestamp: t.Timestamp,
+		Data:      marshal(t.Data),
+		Lines:     make([]*models.TransactionLineResult, 0, len(t.Lines)),
+	}
+	for _, line := range t.Lines {
+		result.Lines = append(result.Lines, &models.TransactionLineResult{
+			AccountID: line.AccountID,
+			Delta:     line.Delta,
+			Currency:  line.Currency,
+		})
+	}
+	sort.SliceStable(result.Lines, func(i, j int) bool {
+		return result.Lines[i].AccountID < result.Lines[j].AccountID
+	})
+	return result
+}
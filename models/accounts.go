@@ -6,13 +6,41 @@ import (
 	"log"
 
 	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
 )
 
-// Account represents the ledger account with information such as ID, balance and JSON data
+// Account represents the ledger account with information such as ID, balance and JSON data.
+// The balance of each currency is in `Balances`, while `Balance` sums up the lines without a currency.
 type Account struct {
-	ID      string                 `json:"id"`
-	Balance int                    `json:"balance"`
-	Data    map[string]interface{} `json:"data"`
+	ID       string                 `json:"id"`
+	Balance  int                    `json:"balance"`
+	Balances map[string]int         `json:"balances"`
+	Data     map[string]interface{} `json:"data"`
+	// Constraints are enforced on the transactions of the account
+	Constraints *AccountConstraints `json:"constraints,omitempty"`
+	// AsOf is the point in time of the balances, if not the current balances
+	AsOf string `json:"as_of,omitempty"`
+	// Computed holds the computed fields of the ledger
+	Computed map[string]interface{} `json:"computed,omitempty"`
+	// DormantSince is set while the account is dormant
+	DormantSince string `json:"dormant_since,omitempty"`
+}
+
+// AccountConstraints are the constraints enforced on the transactions of an account.
+// A frozen account rejects all transactions, and the balance of an account with a minimum
+// balance can't go below it in any currency.
+type AccountConstraints struct {
+	MinBalance *int `json:"min_balance"`
+	Frozen     bool `json:"frozen"`
+}
+
+// columns returns the values of the constraint columns of an account
+func (c *AccountConstraints) columns() (sql.NullInt64, bool) {
+	var minBalance sql.NullInt64
+	if c.MinBalance != nil {
+		minBalance = sql.NullInt64{Int64: int64(*c.MinBalance), Valid: true}
+	}
+	return minBalance, c.Frozen
 }
 
 // AccountDB provides all functions related to ledger account
@@ -27,14 +55,41 @@ func NewAccountDB(db *sql.DB) AccountDB {
 
 // GetByID returns an acccount with the given ID
 func (a *AccountDB) GetByID(id string) (*Account, ledgerError.ApplicationError) {
-	account := &Account{ID: id}
+	account := &Account{ID: id, Balances: make(map[string]int)}
 
-	err := a.db.QueryRow("SELECT balance FROM current_balances WHERE id=$1", &id).Scan(&account.Balance)
+	var balances, data []byte
+	err := a.db.QueryRow("SELECT balance, balances, data FROM current_balances WHERE id=$1", &id).Scan(&account.Balance, &balances, &data)
 	switch {
 	case err == sql.ErrNoRows:
 		account.Balance = 0
 	case err != nil:
 		return nil, DBError(err)
+	default:
+		if err := json.Unmarshal(balances, &account.Balances); err != nil {
+			return nil, JSONError(err)
+		}
+		if err := json.Unmarshal(data, &account.Data); err != nil {
+			return nil, JSONError(err)
+		}
+	}
+
+	var minBalance sql.NullInt64
+	var frozen bool
+	var dormantSince pq.NullTime
+	err = a.db.QueryRow("SELECT min_balance, frozen, dormant_since FROM accounts WHERE id=$1", id).Scan(&minBalance, &frozen, &dormantSince)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, DBError(err)
+	default:
+		if dormantSince.Valid {
+			account.DormantSince = dormantSince.Time.Format(LedgerTimestampLayout)
+		}
+		account.Constraints = &AccountConstraints{Frozen: frozen}
+		if minBalance.Valid {
+			value := int(minBalance.Int64)
+			account.Constraints.MinBalance = &value
+		}
 	}
 
 	return account, nil
@@ -51,6 +106,18 @@ func (a *AccountDB) IsExists(id string) (bool, ledgerError.ApplicationError) {
 	return exists, nil
 }
 
+// CountMissing returns the number of distinct accounts of the IDs which don't exist yet
+func (a *AccountDB) CountMissing(ids []string) (int, ledgerError.ApplicationError) {
+	var count int
+	err := a.db.QueryRow(`SELECT COUNT(DISTINCT ids.id) FROM unnest($1::text[]) AS ids(id)
+		WHERE NOT EXISTS (SELECT 1 FROM accounts a WHERE a.id = ids.id)`, pq.Array(ids)).Scan(&count)
+	if err != nil {
+		log.Println("Error executing missing accounts query:", err)
+		return 0, DBError(err)
+	}
+	return count, nil
+}
+
 // CreateAccount creates a new account in the ledger
 func (a *AccountDB) CreateAccount(account *Account) ledgerError.ApplicationError {
 	data, err := json.Marshal(account.Data)
@@ -63,8 +130,13 @@ func (a *AccountDB) CreateAccount(account *Account) ledgerError.ApplicationError
 		accountData = string(data)
 	}
 
-	q := "INSERT INTO accounts (id, data)  VALUES ($1, $2)"
-	_, err = a.db.Exec(q, account.ID, accountData)
+	constraints := account.Constraints
+	if constraints == nil {
+		constraints = &AccountConstraints{}
+	}
+	minBalance, frozen := constraints.columns()
+	q := "INSERT INTO accounts (id, data, min_balance, frozen)  VALUES ($1, $2, $3, $4)"
+	_, err = a.db.Exec(q, account.ID, accountData, minBalance, frozen)
 	if err != nil {
 		return DBError(err)
 	}
@@ -72,7 +144,7 @@ func (a *AccountDB) CreateAccount(account *Account) ledgerError.ApplicationError
 	return nil
 }
 
-// UpdateAccount updates the account with new data
+// UpdateAccount updates the account with new data, and its constraints if given
 func (a *AccountDB) UpdateAccount(account *Account) ledgerError.ApplicationError {
 	data, err := json.Marshal(account.Data)
 	if err != nil {
@@ -83,11 +155,43 @@ func (a *AccountDB) UpdateAccount(account *Account) ledgerError.ApplicationError
 		accountData = string(data)
 	}
 
-	q := "UPDATE accounts SET data = $1 WHERE id = $2"
-	_, err = a.db.Exec(q, accountData, account.ID)
+	// The constraints are updated only when given
+	if account.Constraints != nil {
+		minBalance, frozen := account.Constraints.columns()
+		q := "UPDATE accounts SET data = $1, min_balance = $2, frozen = $3 WHERE id = $4"
+		_, err = a.db.Exec(q, accountData, minBalance, frozen, account.ID)
+	} else {
+		q := "UPDATE accounts SET data = $1 WHERE id = $2"
+		_, err = a.db.Exec(q, accountData, account.ID)
+	}
 	if err != nil {
 		return DBError(err)
 	}
 
 	return nil
 }
+
+// UpsertAccount creates the account if it doesn't exist or updates its data otherwise.
+// It returns true when a new account is created.
+func (a *AccountDB) UpsertAccount(account *Account) (bool, ledgerError.ApplicationError) {
+	data, err := json.Marshal(account.Data)
+	if err != nil {
+		return false, JSONError(err)
+	}
+	accountData := "{}"
+	if account.Data != nil && data != nil {
+		accountData = string(data)
+	}
+
+	// `xmax` of a freshly inserted row is zero
+	var created bool
+	q := `INSERT INTO accounts (id, data) VALUES ($1, $2)
+			ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data
+			RETURNING (xmax = 0)`
+	err = a.db.QueryRow(q, account.ID, accountData).Scan(&created)
+	if err != nil {
+		return false, DBError(err)
+	}
+
+	return created, nil
+}
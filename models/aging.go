@@ -0,0 +1,187 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+)
+
+// AgingBuckets are the labels of the aging buckets by the age in days of the outstanding amounts
+var AgingBuckets = []string{"0-30", "31-60", "61-90", "90+"}
+
+// AgingRow represents the outstanding balance of an account in a currency split by age
+type AgingRow struct {
+	AccountID        string         `json:"account,omitempty"`
+	Currency         string         `json:"currency,omitempty"`
+	Buckets          map[string]int `json:"buckets"`
+	UnappliedCredits int            `json:"unapplied_credits"`
+	Balance          int            `json:"balance"`
+}
+
+// AgingReport represents the aging of the outstanding balances of receivable accounts.
+// The balances of the currencies are aged and totaled separately.
+type AgingReport struct {
+	AsOf     string      `json:"as_of"`
+	Accounts []*AgingRow `json:"accounts"`
+	Totals   []*AgingRow `json:"totals"`
+}
+
+func newAgingRow(accountID string, currency string) *AgingRow {
+	row := &AgingRow{AccountID: accountID, Currency: currency, Buckets: make(map[string]int)}
+	for _, bucket := range AgingBuckets {
+		row.Buckets[bucket] = 0
+	}
+	return row
+}
+
+func agingBucket(days int) string {
+	switch {
+	case days <= 30:
+		return AgingBuckets[0]
+	case days <= 60:
+		return AgingBuckets[1]
+	case days <= 90:
+		return AgingBuckets[2]
+	}
+	return AgingBuckets[3]
+}
+
+// agingLine is an outstanding debit of an account
+type agingLine struct {
+	timestamp time.Time
+	amount    int
+}
+
+// agingAccount ages the lines of an account in a currency in chronological order.
+// Credits settle the oldest outstanding debits first, and the credits left
+// after settling all debits are reported as unapplied.
+type agingAccount struct {
+	row         *AgingRow
+	outstanding []*agingLine
+	credits     int
+}
+
+func (a *agingAccount) add(delta int, timestamp time.Time) {
+	a.row.Balance += delta
+	if delta > 0 {
+		// Unapplied credits settle the new debit
+		settled := delta
+		if a.credits < settled {
+			settled = a.credits
+		}
+		a.credits -= settled
+		if delta > settled {
+			a.outstanding = append(a.outstanding, &agingLine{timestamp: timestamp, amount: delta - settled})
+		}
+		return
+	}
+	credit := -delta
+	for credit > 0 && len(a.outstanding) > 0 {
+		oldest := a.outstanding[0]
+		if oldest.amount > credit {
+			oldest.amount -= credit
+			credit = 0
+			break
+		}
+		credit -= oldest.amount
+		a.outstanding = a.outstanding[1:]
+	}
+	a.credits += credit
+}
+
+func (a *agingAccount) finish(asOf time.Time) *AgingRow {
+	for _, bucket := range AgingBuckets {
+		a.row.Buckets[bucket] = 0
+	}
+	for _, line := range a.outstanding {
+		days := int(asOf.Sub(line.timestamp).Hours() / 24)
+		a.row.Buckets[agingBucket(days)] += line.amount
+	}
+	a.row.UnappliedCredits = a.credits
+	return a.row
+}
+
+// ReportDB provides all functions related to ledger reports
+type ReportDB struct {
+	db *sql.DB
+}
+
+// NewReportDB provides instance of `ReportDB`
+func NewReportDB(db *sql.DB) ReportDB {
+	return ReportDB{db: db}
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(pattern string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(pattern)
+}
+
+// GetAgingReport returns the aging of the outstanding balances of the accounts by currency
+// with the ID prefix, based on the transaction timestamps until `asOf`
+func (r *ReportDB) GetAgingReport(accountPrefix string, asOf time.Time) (*AgingReport, ledgerError.ApplicationError) {
+	q := `SELECT lines.account_id, lines.currency, lines.delta, transactions.timestamp
+			FROM lines JOIN transactions ON lines.transaction_id = transactions.id
+			WHERE lines.account_id LIKE $1 AND transactions.timestamp <= $2
+			ORDER BY lines.account_id, lines.currency, transactions.timestamp, lines.id`
+	rows, err := r.db.Query(q, escapeLike(accountPrefix)+"%", asOf)
+	if err != nil {
+		log.Println("Error executing aging query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+
+	report := &AgingReport{
+		AsOf:     asOf.Format(LedgerTimestampLayout),
+		Accounts: make([]*AgingRow, 0),
+		Totals:   make([]*AgingRow, 0),
+	}
+	totals := make(map[string]*AgingRow)
+	addAccount := func(account *agingAccount) {
+		row := account.finish(asOf)
+		report.Accounts = append(report.Accounts, row)
+		total, ok := totals[row.Currency]
+		if !ok {
+			total = newAgingRow("", row.Currency)
+			totals[row.Currency] = total
+			report.Totals = append(report.Totals, total)
+		}
+		for bucket, amount := range row.Buckets {
+			total.Buckets[bucket] += amount
+		}
+		total.UnappliedCredits += row.UnappliedCredits
+		total.Balance += row.Balance
+	}
+
+	var account *agingAccount
+	for rows.Next() {
+		var accountID, currency string
+		var delta int
+		var timestamp time.Time
+		if err := rows.Scan(&accountID, &currency, &delta, &timestamp); err != nil {
+			log.Println("Error scanning aging lines:", err)
+			return nil, DBError(err)
+		}
+		if account == nil || account.row.AccountID != accountID || account.row.Currency != currency {
+			if account != nil {
+				addAccount(account)
+			}
+			account = &agingAccount{row: newAgingRow(accountID, currency)}
+		}
+		account.add(delta, timestamp)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating aging lines:", err)
+		return nil, DBError(err)
+	}
+	if account != nil {
+		addAccount(account)
+	}
+	sort.Slice(report.Totals, func(i, j int) bool {
+		return report.Totals[i].Currency < report.Totals[j].Currency
+	})
+	return report, nil
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgingAccount(t *testing.T) {
+	asOf := time.Date(2017, 6, 30, 0, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time {
+		return asOf.AddDate(0, 0, -days)
+	}
+
+	account := &agingAccount{row: newAgingRow("receivable.acme", "USD")}
+	account.add(100, daysAgo(120))
+	account.add(200, daysAgo(75))
+	account.add(300, daysAgo(45))
+	account.add(400, daysAgo(10))
+	// The payment settles the oldest invoice and part of the next
+	account.add(-150, daysAgo(5))
+	row := account.finish(asOf)
+
+	assert.Equal(t, map[string]int{
+		"0-30":  400,
+		"31-60": 300,
+		"61-90": 150,
+		"90+":   0,
+	}, row.Buckets, "Invalid aging buckets")
+	assert.Equal(t, 850, row.Balance, "Invalid balance")
+	assert.Equal(t, 0, row.UnappliedCredits, "Invalid unapplied credits")
+}
+
+func TestAgingAccountUnappliedCredits(t *testing.T) {
+	asOf := time.Date(2017, 6, 30, 0, 0, 0, 0, time.UTC)
+
+	account := &agingAccount{row: newAgingRow("receivable.acme", "USD")}
+	account.add(100, asOf.AddDate(0, 0, -40))
+	// Prepayment over the outstanding amount
+	account.add(-250, asOf.AddDate(0, 0, -35))
+	// The next invoice is partially settled by the prepayment
+	account.add(200, asOf.AddDate(0, 0, -20))
+	account.add(50, asOf.AddDate(0, 0, -2))
+	row := account.finish(asOf)
+
+	assert.Equal(t, 100, row.Buckets["0-30"], "Invalid aging bucket")
+	assert.Equal(t, 0, row.Buckets["31-60"], "Invalid aging bucket")
+	assert.Equal(t, 100, row.Balance, "Invalid balance")
+	assert.Equal(t, 0, row.UnappliedCredits, "Invalid unapplied credits")
+
+	account.add(-300, asOf)
+	row = account.finish(asOf)
+	assert.Equal(t, 0, row.Buckets["0-30"], "Invalid aging bucket")
+	assert.Equal(t, 200, row.UnappliedCredits, "Invalid unapplied credits")
+}
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, `receivable\_acme\%\\`, escapeLike(`receivable_acme%\`), "Invalid escaped pattern")
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/RealImage/QLedger/rounding"
+)
+
+// AllocationShare represents an account receiving a share of an allocated amount in proportion to its weight
+type AllocationShare struct {
+	AccountID string  `json:"account"`
+	Weight    float64 `json:"weight"`
+}
+
+// Allocation represents the split of an amount from one account to several accounts,
+// a shorthand of a transaction with a line for every account
+type Allocation struct {
+	ID        string                 `json:"id"`
+	From      string                 `json:"from"`
+	Amount    int                    `json:"amount"`
+	Currency  string                 `json:"currency"`
+	To        []*AllocationShare     `json:"to"`
+	Data      map[string]interface{} `json:"data"`
+	Timestamp string                 `json:"timestamp"`
+}
+
+// Amounts returns the amounts allocated to the `to` accounts, which are rounded as per the rounding
+// policy of the currency. The remainder left by rounding is added to the first account, so that
+// the amounts add up to the allocated amount.
+func (a *Allocation) Amounts() ([]int, int) {
+	total := 0.0
+	for _, share := range a.To {
+		total += share.Weight
+	}
+	policy := rounding.For(a.Currency)
+	amounts := make([]int, len(a.To))
+	remainder := a.Amount
+	for i, share := range a.To {
+		amounts[i] = rounding.Round(float64(a.Amount)*share.Weight/total, policy)
+		remainder -= amounts[i]
+	}
+	if len(amounts) > 0 {
+		amounts[0] += remainder
+	}
+	return amounts, remainder
+}
+
+// Validate checks whether the allocation can be expanded to a valid transaction
+func (a *Allocation) Validate() error {
+	switch {
+	case a.ID == "":
+		return errors.New("Missing allocation id")
+	case a.From == "":
+		return errors.New("Missing allocation account")
+	case len(a.To) == 0:
+		return errors.New("Missing allocation shares")
+	case a.Amount <= 0:
+		return errors.New("Allocation amount should be positive")
+	case a.Currency != "" && !IsValidCurrency(a.Currency):
+		return errors.New("Invalid allocation currency")
+	}
+	accounts := map[string]bool{a.From: true}
+	for _, share := range a.To {
+		if share.AccountID == "" || accounts[share.AccountID] {
+			return errors.New("Allocation accounts should be given and different")
+		}
+		if share.Weight <= 0 {
+			return errors.New("Allocation weights should be positive")
+		}
+		accounts[share.AccountID] = true
+	}
+	amounts, _ := a.Amounts()
+	for _, amount := range amounts {
+		if amount <= 0 {
+			return errors.New("Allocated amounts should be positive")
+		}
+	}
+	return nil
+}
+
+// ToTransaction expands the allocation to a transaction debiting the `from` account,
+// and crediting the `to` accounts with their rounded shares
+func (a *Allocation) ToTransaction() *Transaction {
+	policy := rounding.For(a.Currency)
+	amounts, remainder := a.Amounts()
+	lines := []*TransactionLine{
+		&TransactionLine{
+			AccountID: a.From,
+			Delta:     -a.Amount,
+			Currency:  a.Currency,
+		},
+	}
+	for i, share := range a.To {
+		lines = append(lines, &TransactionLine{
+			AccountID: share.AccountID,
+			Delta:     amounts[i],
+			Currency:  a.Currency,
+			Rounding:  policy,
+		})
+	}
+
+	// Record the rounding along with the transaction data
+	data := make(map[string]interface{}, len(a.Data)+1)
+	for key, value := range a.Data {
+		data[key] = value
+	}
+	data["allocation"] = map[string]interface{}{
+		"amount":    a.Amount,
+		"rounding":  policy,
+		"remainder": remainder,
+	}
+	return &Transaction{
+		ID:        a.ID,
+		Data:      data,
+		Timestamp: a.Timestamp,
+		Lines:     lines,
+	}
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/RealImage/QLedger/rounding"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllocationValidate(t *testing.T) {
+	allocation := &Allocation{
+		ID:     "a001",
+		From:   "revenue",
+		Amount: 100,
+		To:     []*AllocationShare{{AccountID: "alice", Weight: 1}, {AccountID: "bob", Weight: 2}},
+	}
+	assert.Equal(t, nil, allocation.Validate(), "Allocation should be valid")
+
+	invalid := []*Allocation{
+		{From: "revenue", Amount: 100, To: []*AllocationShare{{AccountID: "alice", Weight: 1}}},
+		{ID: "a001", Amount: 100, To: []*AllocationShare{{AccountID: "alice", Weight: 1}}},
+		{ID: "a001", From: "revenue", Amount: 100},
+		{ID: "a001", From: "revenue", Amount: 0, To: []*AllocationShare{{AccountID: "alice", Weight: 1}}},
+		{ID: "a001", From: "revenue", Amount: 100, Currency: "usd", To: []*AllocationShare{{AccountID: "alice", Weight: 1}}},
+		{ID: "a001", From: "revenue", Amount: 100, To: []*AllocationShare{{AccountID: "revenue", Weight: 1}}},
+		{ID: "a001", From: "revenue", Amount: 100, To: []*AllocationShare{{AccountID: "alice", Weight: 1}, {AccountID: "alice", Weight: 1}}},
+		{ID: "a001", From: "revenue", Amount: 100, To: []*AllocationShare{{AccountID: "alice", Weight: 0}}},
+		{ID: "a001", From: "revenue", Amount: 1, To: []*AllocationShare{{AccountID: "alice", Weight: 1}, {AccountID: "bob", Weight: 1}}},
+	}
+	for _, allocation := range invalid {
+		assert.NotEqual(t, nil, allocation.Validate(), "Allocation should not be valid: %v", allocation)
+	}
+}
+
+func TestAllocationToTransaction(t *testing.T) {
+	defer rounding.Set(&rounding.Policies{Default: rounding.HalfUp})
+	rounding.Set(&rounding.Policies{Default: rounding.HalfUp, Currencies: map[string]string{"JPY": rounding.Truncate}})
+
+	allocation := &Allocation{
+		ID:       "a001",
+		From:     "revenue",
+		Amount:   100,
+		Currency: "JPY",
+		To: []*AllocationShare{
+			{AccountID: "alice", Weight: 1},
+			{AccountID: "bob", Weight: 1},
+			{AccountID: "carol", Weight: 1},
+		},
+		Data: map[string]interface{}{"period": "2017-01"},
+	}
+	transaction := allocation.ToTransaction()
+	assert.Equal(t, []*TransactionLine{
+		{AccountID: "revenue", Delta: -100, Currency: "JPY"},
+		{AccountID: "alice", Delta: 34, Currency: "JPY", Rounding: "truncate"},
+		{AccountID: "bob", Delta: 33, Currency: "JPY", Rounding: "truncate"},
+		{AccountID: "carol", Delta: 33, Currency: "JPY", Rounding: "truncate"},
+	}, transaction.Lines, "Invalid allocation transaction lines")
+	assert.Equal(t, true, transaction.IsValid(), "Transaction should be valid")
+
+	assert.Equal(t, "2017-01", transaction.Data["period"], "Transaction data should be retained")
+	data, _ := transaction.Data["allocation"].(map[string]interface{})
+	assert.Equal(t, "truncate", data["rounding"], "Invalid rounding policy in data")
+	assert.Equal(t, 1, data["remainder"], "Invalid remainder in data")
+
+	// Half up rounding can exceed the amount, which is taken from the first account
+	allocation.Currency = "USD"
+	allocation.Amount = 5
+	amounts, remainder := allocation.Amounts()
+	assert.Equal(t, []int{1, 2, 2}, amounts, "Invalid allocated amounts")
+	assert.Equal(t, -1, remainder, "Invalid remainder")
+}
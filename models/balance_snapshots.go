@@ -0,0 +1,130 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// BalanceSnapshotDB provides all functions related to the point-in-time balances of accounts.
+//
+// The balances of all accounts are periodically rolled up as of a point in time, from the lines
+// committed until then. The balance of an account as of a later time is its rolled up balance
+// plus the tail of lines after the rollup. As transactions can be backdated, the tail also has the
+// lines committed after the rollup with timestamps before it.
+type BalanceSnapshotDB struct {
+	db *sql.DB
+}
+
+// NewBalanceSnapshotDB returns a new instance of `BalanceSnapshotDB`
+func NewBalanceSnapshotDB(db *sql.DB) BalanceSnapshotDB {
+	return BalanceSnapshotDB{db: db}
+}
+
+// Rollup snapshots the balances of all accounts as of the time, incrementally from the latest
+// earlier rollup. It says whether the rollup was made, which is not the case when it already exists.
+func (b *BalanceSnapshotDB) Rollup(asOf time.Time) (bool, ledgerError.ApplicationError) {
+	// The rollup covers the lines committed so far, after waiting for the in-flight transactions
+	sequence, err := committedSequence(b.db)
+	if err != nil {
+		log.Println("Error reading committed sequence:", err)
+		return false, DBError(err)
+	}
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return false, DBError(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO balance_rollups (as_of, sequence, created_at)
+			VALUES ($1, $2, now() AT TIME ZONE 'UTC')
+			ON CONFLICT (as_of) DO NOTHING`, asOf, sequence)
+	if err != nil {
+		log.Println("Error executing create balance rollup query:", err)
+		return false, DBError(err)
+	}
+	created, err := result.RowsAffected()
+	if err != nil {
+		return false, DBError(err)
+	}
+	if created == 0 {
+		return false, nil
+	}
+
+	var previousAsOf pq.NullTime
+	var previousSequence int64
+	err = tx.QueryRow("SELECT as_of, sequence FROM balance_rollups WHERE as_of < $1 AND sequence <= $2 ORDER BY as_of DESC LIMIT 1", asOf, sequence).
+		Scan(&previousAsOf, &previousSequence)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("Error executing previous balance rollup query:", err)
+		return false, DBError(err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO account_balance_snapshots (account_id, currency, as_of, balance)
+		SELECT account_id, currency, $1, SUM(balance) FROM (
+			SELECT account_id, currency, balance FROM account_balance_snapshots WHERE as_of = $3
+			UNION ALL
+			SELECT l.account_id, l.currency, l.delta AS balance
+			FROM lines l JOIN transactions t ON t.id = l.transaction_id
+			WHERE l.id <= $2 AND t.timestamp <= $1
+			AND ($3::timestamp IS NULL OR t.timestamp > $3 OR l.id > $4)
+		) balances
+		GROUP BY account_id, currency`, asOf, sequence, previousAsOf, previousSequence)
+	if err != nil {
+		log.Println("Error executing balance rollup query:", err)
+		return false, DBError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, DBError(err)
+	}
+	return true, nil
+}
+
+// GetBalances returns the balance of the lines without a currency of the account as of the time,
+// along with the balance of each currency
+func (b *BalanceSnapshotDB) GetBalances(accountID string, asOf time.Time) (int, map[string]int, ledgerError.ApplicationError) {
+	rows, err := b.db.Query(`WITH rollup AS (
+			SELECT as_of, sequence FROM balance_rollups WHERE as_of <= $2 ORDER BY as_of DESC LIMIT 1
+		)
+		SELECT currency, SUM(balance) FROM (
+			SELECT s.currency, s.balance FROM account_balance_snapshots s JOIN rollup r ON s.as_of = r.as_of
+			WHERE s.account_id = $1
+			UNION ALL
+			SELECT l.currency, l.delta AS balance
+			FROM lines l JOIN transactions t ON t.id = l.transaction_id
+			LEFT JOIN rollup r ON true
+			WHERE l.account_id = $1 AND t.timestamp <= $2
+			AND (r.as_of IS NULL OR t.timestamp > r.as_of OR l.id > r.sequence)
+		) balances
+		GROUP BY currency`, accountID, asOf)
+	if err != nil {
+		log.Println("Error executing point-in-time balance query:", err)
+		return 0, nil, DBError(err)
+	}
+	defer rows.Close()
+
+	balance := 0
+	balances := make(map[string]int)
+	for rows.Next() {
+		var currency string
+		var sum int
+		if err := rows.Scan(&currency, &sum); err != nil {
+			log.Println("Error scanning point-in-time balances:", err)
+			return 0, nil, DBError(err)
+		}
+		if currency == "" {
+			balance = sum
+		} else {
+			balances[currency] = sum
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating point-in-time balances rows:", err)
+		return 0, nil, DBError(err)
+	}
+	return balance, balances, nil
+}
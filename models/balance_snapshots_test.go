@@ -0,0 +1,100 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type BalanceSnapshotsSuite struct {
+	suite.Suite
+	db *sql.DB
+}
+
+func (bs *BalanceSnapshotsSuite) SetupSuite() {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(bs.T(), databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	} else {
+		log.Println("Successfully established connection to database.")
+		bs.db = db
+	}
+}
+
+func (bs *BalanceSnapshotsSuite) transact(id string, timestamp string, delta int) {
+	transactionDB := NewTransactionDB(bs.db)
+	done := transactionDB.Transact(&Transaction{
+		ID:        id,
+		Timestamp: timestamp,
+		Lines: []*TransactionLine{
+			{AccountID: "snap-alice", Delta: delta, Currency: "USD"},
+			{AccountID: "snap-bob", Delta: -delta, Currency: "USD"},
+		},
+	})
+	assert.Equal(bs.T(), true, done, "Transaction should be created")
+}
+
+func (bs *BalanceSnapshotsSuite) TestPointInTimeBalances() {
+	t := bs.T()
+	snapshotDB := NewBalanceSnapshotDB(bs.db)
+	day := func(value string) time.Time {
+		d, _ := time.Parse("2006-01-02", value)
+		return d
+	}
+
+	bs.transact("snap-t1", "2017-01-01 10:00:00.000", 100)
+	bs.transact("snap-t2", "2017-01-02 10:00:00.000", 50)
+
+	done, err := snapshotDB.Rollup(day("2017-01-02"))
+	assert.Equal(t, nil, err, "Error while rolling up balances")
+	assert.Equal(t, true, done, "Balances should be rolled up")
+	done, err = snapshotDB.Rollup(day("2017-01-02"))
+	assert.Equal(t, nil, err, "Error while rolling up balances")
+	assert.Equal(t, false, done, "Balances should be rolled up only once")
+
+	// Backdated transaction committed after the rollup
+	bs.transact("snap-t3", "2017-01-01 12:00:00.000", 10)
+	done, err = snapshotDB.Rollup(day("2017-01-03"))
+	assert.Equal(t, nil, err, "Error while rolling up balances")
+	assert.Equal(t, true, done, "Balances should be rolled up")
+
+	for asOf, expected := range map[string]int{
+		"2016-12-31":              0,
+		"2017-01-02":              110,
+		"2017-01-02 12:00:00.000": 160,
+		"2017-01-05":              160,
+	} {
+		at, perr := time.Parse(LedgerTimestampLayout, asOf)
+		if perr != nil {
+			at = day(asOf)
+		}
+		balance, balances, err := snapshotDB.GetBalances("snap-alice", at)
+		assert.Equal(t, nil, err, "Error while getting point-in-time balances")
+		// The lines are all in USD
+		assert.Equal(t, 0, balance, "Invalid balance as of: "+asOf)
+		assert.Equal(t, expected, balances["USD"], "Invalid currency balance as of: "+asOf)
+	}
+}
+
+func (bs *BalanceSnapshotsSuite) TearDownSuite() {
+	log.Println("Cleaning up the test database")
+
+	t := bs.T()
+	for _, table := range []string{"account_balance_snapshots", "balance_rollups", "lines", "transactions", "accounts"} {
+		if _, err := bs.db.Exec("DELETE FROM " + table); err != nil {
+			t.Fatal("Error deleting "+table+":", err)
+		}
+	}
+}
+
+func TestBalanceSnapshotsSuite(t *testing.T) {
+	suite.Run(t, new(BalanceSnapshotsSuite))
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"regexp"
+	"strconv"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// MaxCacheAge is the longest period the account responses can be cached for
+const MaxCacheAge = 24 * time.Hour
+
+var validCachePolicyID = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// CachePolicy represents how long the responses of the accounts with the ID prefix can be cached,
+// such as by the clients, or by CDNs and proxies
+type CachePolicy struct {
+	ID     string `json:"id"`
+	Prefix string `json:"prefix"`
+	// MaxAgeSeconds is the period the responses can be cached for, and they can't be cached if it is zero
+	MaxAgeSeconds int `json:"max_age_seconds"`
+	// Shared allows the shared caches, such as CDNs and proxies, to cache the responses,
+	// which are otherwise cached only by the clients
+	Shared    bool   `json:"shared,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// Validate checks whether the policy has a valid ID and max age
+func (p *CachePolicy) Validate() error {
+	switch {
+	case !validCachePolicyID.MatchString(p.ID):
+		return errors.New("Invalid cache policy id")
+	case p.MaxAgeSeconds < 0 || time.Duration(p.MaxAgeSeconds)*time.Second > MaxCacheAge:
+		return errors.New("Max age of cache policy should be between 0 and 86400 seconds")
+	}
+	return nil
+}
+
+// CacheControl returns the `Cache-Control` header of the responses of the policy, which are private
+// unless the policy is shared
+func (p *CachePolicy) CacheControl() string {
+	switch {
+	case p.MaxAgeSeconds == 0:
+		return "no-store"
+	case p.Shared:
+		return "public, max-age=" + strconv.Itoa(p.MaxAgeSeconds)
+	}
+	return "private, max-age=" + strconv.Itoa(p.MaxAgeSeconds)
+}
+
+// CachePolicyDB provides all functions related to cache policies
+type CachePolicyDB struct {
+	db *sql.DB
+}
+
+// NewCachePolicyDB provides instance of `CachePolicyDB`
+func NewCachePolicyDB(db *sql.DB) CachePolicyDB {
+	return CachePolicyDB{db: db}
+}
+
+// Create adds a cache policy
+func (c *CachePolicyDB) Create(policy *CachePolicy) ledgerError.ApplicationError {
+	now := time.Now().UTC()
+	_, err := c.db.Exec(`INSERT INTO cache_policies (id, prefix, max_age_seconds, shared, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		policy.ID, policy.Prefix, policy.MaxAgeSeconds, policy.Shared, now)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return CachePolicyExistsError(policy.ID)
+		}
+		return DBError(err)
+	}
+	policy.CreatedAt = now.Format(LedgerTimestampLayout)
+	return nil
+}
+
+// Delete removes a cache policy. It returns false if the policy doesn't exist.
+func (c *CachePolicyDB) Delete(id string) (bool, ledgerError.ApplicationError) {
+	result, err := c.db.Exec("DELETE FROM cache_policies WHERE id = $1", id)
+	if err != nil {
+		return false, DBError(err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, DBError(err)
+	}
+	return count > 0, nil
+}
+
+// List returns all the cache policies by their prefixes
+func (c *CachePolicyDB) List() ([]*CachePolicy, ledgerError.ApplicationError) {
+	rows, err := c.db.Query("SELECT id, prefix, max_age_seconds, shared, created_at FROM cache_policies ORDER BY prefix, id")
+	if err != nil {
+		log.Println("Error executing cache policies query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	policies := make([]*CachePolicy, 0)
+	for rows.Next() {
+		policy := &CachePolicy{}
+		var createdAt time.Time
+		if err := rows.Scan(&policy.ID, &policy.Prefix, &policy.MaxAgeSeconds, &policy.Shared, &createdAt); err != nil {
+			return nil, DBError(err)
+		}
+		policy.CreatedAt = createdAt.Format(LedgerTimestampLayout)
+		policies = append(policies, policy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return policies, nil
+}
+
+// Match returns the policy with the longest prefix of the account ID, or nil if no policy matches it
+func (c *CachePolicyDB) Match(accountID string) (*CachePolicy, ledgerError.ApplicationError) {
+	policy := &CachePolicy{}
+	err := c.db.QueryRow(`SELECT id, prefix, max_age_seconds, shared FROM cache_policies
+		WHERE left($1, length(prefix)) = prefix ORDER BY length(prefix) DESC, id LIMIT 1`, accountID).Scan(
+		&policy.ID, &policy.Prefix, &policy.MaxAgeSeconds, &policy.Shared)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Println("Error executing cache policy query:", err)
+		return nil, DBError(err)
+	}
+	return policy, nil
+}
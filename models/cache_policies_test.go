@@ -0,0 +1,93 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestCachePolicyValidate(t *testing.T) {
+	for _, policy := range []*CachePolicy{
+		{ID: "system", Prefix: "system:", MaxAgeSeconds: 60},
+		{ID: "hot.wallets", Prefix: "wallet:", MaxAgeSeconds: 0},
+		{ID: "all", Prefix: "", MaxAgeSeconds: 86400},
+	} {
+		assert.Nil(t, policy.Validate(), "Policy should be valid: %v", policy.ID)
+	}
+	for _, policy := range []*CachePolicy{
+		{ID: "system accounts", Prefix: "system:", MaxAgeSeconds: 60},
+		{ID: "system", Prefix: "system:", MaxAgeSeconds: -1},
+		{ID: "system", Prefix: "system:", MaxAgeSeconds: 86401},
+	} {
+		assert.NotNil(t, policy.Validate(), "Policy should be invalid: %v", policy)
+	}
+
+	assert.Equal(t, "private, max-age=60", (&CachePolicy{MaxAgeSeconds: 60}).CacheControl(), "Invalid header")
+	assert.Equal(t, "public, max-age=60", (&CachePolicy{MaxAgeSeconds: 60, Shared: true}).CacheControl(), "Invalid header")
+	assert.Equal(t, "no-store", (&CachePolicy{}).CacheControl(), "Invalid header")
+}
+
+type CachePolicySuite struct {
+	suite.Suite
+	db *sql.DB
+}
+
+func (cs *CachePolicySuite) SetupSuite() {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(cs.T(), databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	} else {
+		log.Println("Successfully established connection to database.")
+		cs.db = db
+	}
+}
+
+func (cs *CachePolicySuite) TestMatch() {
+	t := cs.T()
+	policyDB := NewCachePolicyDB(cs.db)
+	for _, policy := range []*CachePolicy{
+		{ID: "cache_system", Prefix: "cache_system:", MaxAgeSeconds: 60},
+		{ID: "cache_system_fees", Prefix: "cache_system:fees:", MaxAgeSeconds: 0},
+	} {
+		assert.Nil(t, policyDB.Create(policy), "Error creating cache policy")
+	}
+	aerr := policyDB.Create(&CachePolicy{ID: "cache_system", Prefix: "cache_other:"})
+	assert.Equal(t, "cache_policy.exists", aerr.ErrorCode(), "Duplicate policy should be rejected")
+
+	policy, aerr := policyDB.Match("cache_system:reserve")
+	assert.Nil(t, aerr, "Error matching cache policy")
+	assert.Equal(t, "cache_system", policy.ID, "Invalid policy")
+	policy, aerr = policyDB.Match("cache_system:fees:usd")
+	assert.Nil(t, aerr, "Error matching cache policy")
+	assert.Equal(t, "cache_system_fees", policy.ID, "Longest prefix should match")
+	policy, aerr = policyDB.Match("cache_wallet")
+	assert.Nil(t, aerr, "Error matching cache policy")
+	assert.Nil(t, policy, "No policy should match")
+
+	deleted, aerr := policyDB.Delete("cache_system_fees")
+	assert.Nil(t, aerr, "Error deleting cache policy")
+	assert.True(t, deleted, "Policy should be deleted")
+	policy, _ = policyDB.Match("cache_system:fees:usd")
+	assert.Equal(t, "cache_system", policy.ID, "Invalid policy after deletion")
+}
+
+func (cs *CachePolicySuite) TearDownSuite() {
+	log.Println("Cleaning up the test database")
+
+	t := cs.T()
+	_, err := cs.db.Exec(`DELETE FROM cache_policies WHERE id LIKE 'cache_%'`)
+	if err != nil {
+		t.Fatal("Error deleting cache policies:", err)
+	}
+}
+
+func TestCachePolicySuite(t *testing.T) {
+	suite.Run(t, new(CachePolicySuite))
+}
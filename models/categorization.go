@@ -0,0 +1,269 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// categorizeBatchSize is the number of transactions categorized at a time by a backfill
+const categorizeBatchSize = 1000
+
+var (
+	validCategorizationRuleID  = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+	validCategorizationDataKey = regexp.MustCompile(`^[a-z_A-Z]+$`)
+)
+
+// ruleCategoryQuery selects the category of the first rule matching a transaction, in the order of
+// the rule priorities. A rule matches when the transaction data contains its data, and the transaction
+// has a line of one of its accounts if it has any.
+const ruleCategoryQuery = `SELECT categorization_rules.category FROM categorization_rules
+		WHERE transactions.data @> categorization_rules.data
+			AND (cardinality(categorization_rules.accounts) = 0 OR EXISTS (
+				SELECT 1 FROM lines WHERE lines.transaction_id = transactions.id
+					AND lines.account_id = ANY(categorization_rules.accounts)))
+		ORDER BY categorization_rules.priority, categorization_rules.id
+		LIMIT 1`
+
+// CategorizationRule represents a rule assigning a category to the transactions it matches
+type CategorizationRule struct {
+	ID       string `json:"id"`
+	Category string `json:"category"`
+	// Priority orders the rules, and the first matching rule categorizes a transaction
+	Priority  int                    `json:"priority"`
+	Data      map[string]interface{} `json:"data"`
+	Accounts  []string               `json:"accounts"`
+	CreatedAt string                 `json:"created_at,omitempty"`
+}
+
+// Validate checks whether the rule has a valid ID, category and data keys
+func (c *CategorizationRule) Validate() error {
+	switch {
+	case !validCategorizationRuleID.MatchString(c.ID):
+		return errors.New("Invalid categorization rule id")
+	case strings.TrimSpace(c.Category) == "":
+		return errors.New("Missing categorization rule category")
+	}
+	for key := range c.Data {
+		if !validCategorizationDataKey.MatchString(key) {
+			return fmt.Errorf("Invalid key in categorization rule data: %v", key)
+		}
+	}
+	for _, account := range c.Accounts {
+		if account == "" {
+			return errors.New("Invalid account in categorization rule")
+		}
+	}
+	return nil
+}
+
+// categorizeTransaction assigns the category of the first matching rule to a transaction being posted
+func categorizeTransaction(tx *sql.Tx, id string) error {
+	_, err := tx.Exec(`UPDATE transactions SET category = (`+ruleCategoryQuery+`)
+		WHERE id = $1 AND EXISTS (SELECT 1 FROM categorization_rules)`, id)
+	return err
+}
+
+// CategorizationRuleDB provides all functions related to categorization rules
+type CategorizationRuleDB struct {
+	db *sql.DB
+}
+
+// NewCategorizationRuleDB provides instance of `CategorizationRuleDB`
+func NewCategorizationRuleDB(db *sql.DB) CategorizationRuleDB {
+	return CategorizationRuleDB{db: db}
+}
+
+// Create adds a categorization rule
+func (c *CategorizationRuleDB) Create(rule *CategorizationRule) ledgerError.ApplicationError {
+	data, err := json.Marshal(nonNilData(rule.Data))
+	if err != nil {
+		return JSONError(err)
+	}
+	accounts := rule.Accounts
+	if accounts == nil {
+		accounts = []string{}
+	}
+	now := time.Now().UTC()
+	_, err = c.db.Exec(`INSERT INTO categorization_rules (id, category, priority, data, accounts, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`, rule.ID, rule.Category, rule.Priority, string(data), pq.Array(accounts), now)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return CategorizationRuleExistsError(rule.ID)
+		}
+		return DBError(err)
+	}
+	rule.CreatedAt = now.Format(LedgerTimestampLayout)
+	return nil
+}
+
+// Delete removes a categorization rule. It returns false if the rule doesn't exist.
+// The transactions keep the categories assigned by the rule until they are backfilled.
+func (c *CategorizationRuleDB) Delete(id string) (bool, ledgerError.ApplicationError) {
+	result, err := c.db.Exec("DELETE FROM categorization_rules WHERE id = $1", id)
+	if err != nil {
+		return false, DBError(err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, DBError(err)
+	}
+	return count > 0, nil
+}
+
+// List returns all the categorization rules in the order they are matched
+func (c *CategorizationRuleDB) List() ([]*CategorizationRule, ledgerError.ApplicationError) {
+	rows, err := c.db.Query(`SELECT id, category, priority, data, accounts, created_at
+		FROM categorization_rules ORDER BY priority, id`)
+	if err != nil {
+		log.Println("Error executing categorization rules query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	rules := make([]*CategorizationRule, 0)
+	for rows.Next() {
+		rule := &CategorizationRule{}
+		var rawData []byte
+		var createdAt time.Time
+		if err := rows.Scan(&rule.ID, &rule.Category, &rule.Priority, &rawData, pq.Array(&rule.Accounts), &createdAt); err != nil {
+			return nil, DBError(err)
+		}
+		if err := json.Unmarshal(rawData, &rule.Data); err != nil {
+			return nil, JSONError(err)
+		}
+		rule.CreatedAt = createdAt.Format(LedgerTimestampLayout)
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return rules, nil
+}
+
+// BackfillResult is the outcome of categorizing the existing transactions
+type BackfillResult struct {
+	Transactions int `json:"transactions"`
+	Categorized  int `json:"categorized"`
+}
+
+// Backfill applies the rules to the uncategorized transactions in batches, in the order they are posted.
+// All the transactions are categorized again when `all` is set, such as after the rules are changed,
+// and those no longer matching any rule become uncategorized.
+func (c *CategorizationRuleDB) Backfill(all bool) (*BackfillResult, ledgerError.ApplicationError) {
+	result := &BackfillResult{}
+	var after int64
+	for {
+		rows, err := c.db.Query(`UPDATE transactions SET category = (`+ruleCategoryQuery+`)
+			WHERE id IN (
+				SELECT id FROM transactions WHERE sequence > $1 AND ($2 OR category IS NULL)
+				ORDER BY sequence LIMIT $3
+			)
+			RETURNING sequence, category IS NOT NULL`, after, all, categorizeBatchSize)
+		if err != nil {
+			log.Println("Error executing categorization backfill:", err)
+			return nil, DBError(err)
+		}
+		count := 0
+		for rows.Next() {
+			var sequence int64
+			var categorized bool
+			if err := rows.Scan(&sequence, &categorized); err != nil {
+				rows.Close()
+				return nil, DBError(err)
+			}
+			count++
+			if categorized {
+				result.Categorized++
+			}
+			if sequence > after {
+				after = sequence
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, DBError(err)
+		}
+		result.Transactions += count
+		if count < categorizeBatchSize {
+			return result, nil
+		}
+	}
+}
+
+// CategoryReportFilter filters the lines of the category report by their account,
+// and by the inclusive bounds of the transaction timestamps
+type CategoryReportFilter struct {
+	AccountID string
+	From      *time.Time
+	To        *time.Time
+}
+
+// CategoryRow sums up the lines of the transactions of a category in a currency.
+// The category of the uncategorized transactions is null.
+type CategoryRow struct {
+	Category     *string `json:"category"`
+	Currency     string  `json:"currency"`
+	Debits       int64   `json:"debits"`
+	Credits      int64   `json:"credits"`
+	Transactions int     `json:"transactions"`
+}
+
+// GetCategoryReport returns the debits and credits of the lines by the category of their transactions
+// and their currency, such as the spending of an account by category
+func (r *ReportDB) GetCategoryReport(filter *CategoryReportFilter) ([]*CategoryRow, ledgerError.ApplicationError) {
+	var conditions []string
+	var args []interface{}
+	if filter.AccountID != "" {
+		args = append(args, filter.AccountID)
+		conditions = append(conditions, fmt.Sprintf("lines.account_id = $%d", len(args)))
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		conditions = append(conditions, fmt.Sprintf("transactions.timestamp >= $%d", len(args)))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		conditions = append(conditions, fmt.Sprintf("transactions.timestamp <= $%d", len(args)))
+	}
+	q := `SELECT transactions.category, lines.currency,
+			COALESCE(SUM(CASE WHEN lines.delta < 0 THEN -lines.delta ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN lines.delta > 0 THEN lines.delta ELSE 0 END), 0),
+			COUNT(DISTINCT transactions.id)
+		FROM lines JOIN transactions ON transactions.id = lines.transaction_id`
+	if len(conditions) > 0 {
+		q += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	q += " GROUP BY transactions.category, lines.currency ORDER BY transactions.category NULLS LAST, lines.currency"
+
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		log.Println("Error executing category report query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	report := make([]*CategoryRow, 0)
+	for rows.Next() {
+		row := &CategoryRow{}
+		var category sql.NullString
+		if err := rows.Scan(&category, &row.Currency, &row.Debits, &row.Credits, &row.Transactions); err != nil {
+			return nil, DBError(err)
+		}
+		if category.Valid {
+			row.Category = &category.String
+		}
+		report = append(report, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return report, nil
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestCategorizationRuleValidate(t *testing.T) {
+	valid := &CategorizationRule{ID: "groceries", Category: "groceries", Data: map[string]interface{}{"merchant_type": "grocery"}}
+	assert.Nil(t, valid.Validate(), "Categorization rule should be valid")
+
+	invalid := []*CategorizationRule{
+		{ID: "", Category: "groceries"},
+		{ID: "groceries rule", Category: "groceries"},
+		{ID: "groceries", Category: " "},
+		{ID: "groceries", Category: "groceries", Data: map[string]interface{}{"merchant-type": "grocery"}},
+		{ID: "groceries", Category: "groceries", Accounts: []string{""}},
+	}
+	for _, rule := range invalid {
+		assert.NotNil(t, rule.Validate(), "Categorization rule should not be valid: %v", rule)
+	}
+}
+
+type CategorizationSuite struct {
+	suite.Suite
+	db *sql.DB
+}
+
+func (cs *CategorizationSuite) SetupSuite() {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(cs.T(), databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	} else {
+		log.Println("Successfully established connection to database.")
+		cs.db = db
+	}
+}
+
+func (cs *CategorizationSuite) TestCategorize() {
+	t := cs.T()
+	transactionDB := NewTransactionDB(cs.db)
+	post := func(id, merchantType, to string) {
+		txn := &Transaction{
+			ID:        id,
+			Timestamp: "2017-01-01 13:00:00.000",
+			Data:      map[string]interface{}{"merchant_type": merchantType},
+			Lines: []*TransactionLine{
+				{AccountID: "categorized_alice", Delta: -100, Currency: "USD"},
+				{AccountID: to, Delta: 100, Currency: "USD"},
+			},
+		}
+		assert.True(t, transactionDB.Transact(txn), "Error while posting transaction")
+	}
+	category := func(id string) *string {
+		var category sql.NullString
+		err := cs.db.QueryRow("SELECT category FROM transactions WHERE id = $1", id).Scan(&category)
+		assert.Nil(t, err, "Error while reading category")
+		if !category.Valid {
+			return nil
+		}
+		return &category.String
+	}
+
+	// Transactions posted before the rules are uncategorized until they are backfilled
+	post("categorized1", "grocery", "categorized_shop")
+
+	ruleDB := NewCategorizationRuleDB(cs.db)
+	rules := []*CategorizationRule{
+		{ID: "groceries", Category: "groceries", Priority: 1, Data: map[string]interface{}{"merchant_type": "grocery"}},
+		{ID: "rent", Category: "rent", Priority: 0, Accounts: []string{"categorized_landlord"}},
+	}
+	for _, rule := range rules {
+		assert.Nil(t, ruleDB.Create(rule), "Error while creating categorization rule")
+	}
+	aerr := ruleDB.Create(&CategorizationRule{ID: "rent", Category: "housing"})
+	if assert.NotNil(t, aerr, "Duplicate categorization rule should fail") {
+		assert.Equal(t, "categorization_rule.exists", aerr.ErrorCode(), "Invalid error code")
+	}
+	rules, aerr = ruleDB.List()
+	assert.Nil(t, aerr, "Error while listing categorization rules")
+	if assert.Equal(t, 2, len(rules), "Invalid count of categorization rules") {
+		assert.Equal(t, "rent", rules[0].ID, "Rules should be ordered by priority")
+		assert.Equal(t, []string{"categorized_landlord"}, rules[0].Accounts, "Invalid rule accounts")
+	}
+
+	// The rule with the lower priority matches first
+	post("categorized2", "grocery", "categorized_landlord")
+	post("categorized3", "grocery", "categorized_shop")
+	post("categorized4", "travel", "categorized_airline")
+	assert.Equal(t, "rent", *category("categorized2"), "Invalid category of posted transaction")
+	assert.Equal(t, "groceries", *category("categorized3"), "Invalid category of posted transaction")
+	assert.Nil(t, category("categorized4"), "Transaction without matching rules should be uncategorized")
+	assert.Nil(t, category("categorized1"), "Transaction posted before the rules should be uncategorized")
+
+	result, aerr := ruleDB.Backfill(false)
+	assert.Nil(t, aerr, "Error while backfilling categories")
+	assert.Equal(t, 1, result.Categorized, "Invalid count of categorized transactions")
+	assert.Equal(t, "groceries", *category("categorized1"), "Invalid category of backfilled transaction")
+
+	reportDB := NewReportDB(cs.db)
+	report, aerr := reportDB.GetCategoryReport(&CategoryReportFilter{AccountID: "categorized_alice"})
+	assert.Nil(t, aerr, "Error while getting category report")
+	if assert.Equal(t, 3, len(report), "Invalid count of category report rows") {
+		assert.Equal(t, "groceries", *report[0].Category, "Invalid category of report row")
+		assert.Equal(t, int64(200), report[0].Debits, "Invalid debits of report row")
+		assert.Equal(t, 2, report[0].Transactions, "Invalid transactions of report row")
+		assert.Equal(t, "rent", *report[1].Category, "Invalid category of report row")
+		assert.Nil(t, report[2].Category, "Uncategorized transactions should be last")
+	}
+
+	// Backfilling all the transactions applies the changed rules
+	deleted, aerr := ruleDB.Delete("rent")
+	assert.Nil(t, aerr, "Error while deleting categorization rule")
+	assert.True(t, deleted, "Categorization rule should be deleted")
+	_, aerr = ruleDB.Backfill(true)
+	assert.Nil(t, aerr, "Error while backfilling categories")
+	assert.Equal(t, "groceries", *category("categorized2"), "Invalid category of backfilled transaction")
+}
+
+func (cs *CategorizationSuite) TearDownSuite() {
+	t := cs.T()
+	for _, q := range []string{
+		"DELETE FROM categorization_rules",
+		"DELETE FROM lines WHERE transaction_id LIKE 'categorized%'",
+		"DELETE FROM transactions WHERE id LIKE 'categorized%'",
+		"DELETE FROM accounts WHERE id LIKE 'categorized%'",
+	} {
+		if _, err := cs.db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCategorizationSuite(t *testing.T) {
+	suite.Run(t, new(CategorizationSuite))
+}
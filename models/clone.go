@@ -0,0 +1,348 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+)
+
+// RedactedValue replaces the values of the redacted data keys of a cloned ledger
+const RedactedValue = "[REDACTED]"
+
+// cloneBatchSize is the number of transactions fetched and written at a time while cloning
+const cloneBatchSize = 100
+
+// CloneOptions are the options of cloning a ledger
+type CloneOptions struct {
+	// Since limits the cloned transactions to the ones from this time, and the earlier
+	// transactions are replaced by a transaction of the opening balances
+	Since *time.Time
+	// IDPrefix prefixes the IDs of the cloned accounts and transactions
+	IDPrefix string
+	// HashIDs replaces the IDs by pseudonyms, which can't be mapped back to the original IDs
+	HashIDs bool
+	// RedactKeys are the data keys of accounts and transactions whose values are redacted
+	RedactKeys []string
+	// ReportDefinitions clones the report definitions
+	ReportDefinitions bool
+
+	hashKey []byte
+}
+
+// CloneResult represents the outcome of cloning a ledger
+type CloneResult struct {
+	Accounts          int `json:"accounts"`
+	Transactions      int `json:"transactions"`
+	Failed            int `json:"failed"`
+	ReportDefinitions int `json:"report_definitions"`
+}
+
+// MapID returns the ID of an account or transaction in the cloned ledger
+func (o *CloneOptions) MapID(id string) string {
+	if !o.HashIDs {
+		return o.IDPrefix + id
+	}
+	mac := hmac.New(sha256.New, o.hashKey)
+	mac.Write([]byte(id))
+	return o.IDPrefix + hex.EncodeToString(mac.Sum(nil))[:20]
+}
+
+// mapTransactionID returns the ID of a transaction in the cloned ledger, where the reversals keep the
+// reversal ID of the transaction they reverse
+func (o *CloneOptions) mapTransactionID(id string) string {
+	if strings.HasSuffix(id, ReversalSuffix) {
+		return ReversalID(o.mapTransactionID(strings.TrimSuffix(id, ReversalSuffix)))
+	}
+	return o.MapID(id)
+}
+
+// cloneData returns a copy of the data with the redacted keys, and the transaction references remapped
+func (o *CloneOptions) cloneData(data map[string]interface{}) map[string]interface{} {
+	cloned := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		cloned[key] = value
+	}
+	if reverses, ok := cloned["reverses"].(string); ok {
+		cloned["reverses"] = o.mapTransactionID(reverses)
+	}
+	for _, key := range o.RedactKeys {
+		if _, ok := cloned[key]; ok {
+			cloned[key] = RedactedValue
+		}
+	}
+	return cloned
+}
+
+// Clone copies the ledger read within the source DB transaction into the empty target ledger, remapping
+// the IDs and redacting the data as per the options. The source DB transaction should be a read transaction
+// from `BeginRead`, so that the clone is consistent.
+func Clone(source *sql.Tx, target *sql.DB, options *CloneOptions) (*CloneResult, ledgerError.ApplicationError) {
+	var nonEmpty bool
+	err := target.QueryRow("SELECT EXISTS (SELECT 1 FROM accounts) OR EXISTS (SELECT 1 FROM transactions)").Scan(&nonEmpty)
+	if err != nil {
+		log.Println("Error checking clone target:", err)
+		return nil, DBError(err)
+	}
+	if nonEmpty {
+		return nil, CloneTargetNotEmptyError()
+	}
+	if options.HashIDs {
+		options.hashKey = make([]byte, 32)
+		if _, err := rand.Read(options.hashKey); err != nil {
+			return nil, DBError(err)
+		}
+	}
+
+	result := &CloneResult{}
+	constraints, aerr := cloneAccounts(source, target, options, result)
+	if aerr != nil {
+		return nil, aerr
+	}
+	transactionDB := NewTransactionDB(target)
+	if options.Since != nil {
+		opening, aerr := openingBalances(source, options)
+		if aerr != nil {
+			return nil, aerr
+		}
+		if opening != nil {
+			if aerr := cloneBatch(&transactionDB, []*Transaction{opening}, result); aerr != nil {
+				return nil, aerr
+			}
+		}
+	}
+	if aerr := cloneTransactions(source, &transactionDB, options, result); aerr != nil {
+		return nil, aerr
+	}
+
+	// The constraints are set after the transactions, which were accepted by the source ledger
+	for id, constraint := range constraints {
+		minBalance, frozen := constraint.columns()
+		_, err := target.Exec("UPDATE accounts SET min_balance = $2, frozen = $3 WHERE id = $1", id, minBalance, frozen)
+		if err != nil {
+			log.Println("Error setting cloned account constraints:", err)
+			return nil, DBError(err)
+		}
+	}
+
+	if options.ReportDefinitions {
+		definitions, aerr := cloneReportDefinitions(source)
+		if aerr != nil {
+			return nil, aerr
+		}
+		targetReports := NewReportDefinitionDB(target)
+		for _, definition := range definitions {
+			if aerr := targetReports.Save(definition); aerr != nil {
+				return nil, aerr
+			}
+			result.ReportDefinitions++
+		}
+	}
+	return result, nil
+}
+
+// cloneAccounts copies all the accounts without their constraints, which are returned by the cloned IDs
+func cloneAccounts(source *sql.Tx, target *sql.DB, options *CloneOptions, result *CloneResult) (map[string]*AccountConstraints, ledgerError.ApplicationError) {
+	rows, err := source.Query("SELECT id, data, min_balance, frozen FROM accounts ORDER BY id")
+	if err != nil {
+		log.Println("Error executing clone accounts query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	constraints := make(map[string]*AccountConstraints)
+	for rows.Next() {
+		var id string
+		var rawData []byte
+		var minBalance sql.NullInt64
+		var frozen bool
+		if err := rows.Scan(&id, &rawData, &minBalance, &frozen); err != nil {
+			return nil, DBError(err)
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal(rawData, &data); err != nil {
+			return nil, JSONError(err)
+		}
+		clonedData, err := json.Marshal(options.cloneData(data))
+		if err != nil {
+			return nil, JSONError(err)
+		}
+		id = options.MapID(id)
+		if _, err := target.Exec("INSERT INTO accounts (id, data) VALUES ($1, $2)", id, string(clonedData)); err != nil {
+			log.Println("Error cloning account:", err)
+			return nil, DBError(err)
+		}
+		result.Accounts++
+		if minBalance.Valid || frozen {
+			constraint := &AccountConstraints{Frozen: frozen}
+			if minBalance.Valid {
+				value := int(minBalance.Int64)
+				constraint.MinBalance = &value
+			}
+			constraints[id] = constraint
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return constraints, nil
+}
+
+// openingBalances returns a transaction setting the balances of the accounts as of the time the cloned
+// transactions start, or nil if all of them are zero. It balances as the whole ledger balances.
+func openingBalances(source *sql.Tx, options *CloneOptions) (*Transaction, ledgerError.ApplicationError) {
+	// The opening balances take an ID which none of the cloned transactions has
+	id := "opening_balances"
+	for !options.HashIDs {
+		var exists bool
+		if err := source.QueryRow("SELECT EXISTS (SELECT 1 FROM transactions WHERE id = $1)", id).Scan(&exists); err != nil {
+			log.Println("Error executing opening balances ID query:", err)
+			return nil, DBError(err)
+		}
+		if !exists {
+			break
+		}
+		id = "_" + id
+	}
+	rows, err := source.Query(`SELECT lines.account_id, lines.currency, SUM(lines.delta)
+			FROM lines JOIN transactions ON lines.transaction_id = transactions.id
+			WHERE transactions.timestamp < $1
+			GROUP BY lines.account_id, lines.currency
+			HAVING SUM(lines.delta) <> 0
+			ORDER BY lines.account_id, lines.currency`, *options.Since)
+	if err != nil {
+		log.Println("Error executing opening balances query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	opening := &Transaction{
+		ID:        options.IDPrefix + id,
+		Timestamp: options.Since.Add(-time.Millisecond).Format(LedgerTimestampLayout),
+		Data:      map[string]interface{}{"clone": "opening_balances"},
+	}
+	for rows.Next() {
+		line := &TransactionLine{}
+		if err := rows.Scan(&line.AccountID, &line.Currency, &line.Delta); err != nil {
+			return nil, DBError(err)
+		}
+		line.AccountID = options.MapID(line.AccountID)
+		opening.Lines = append(opening.Lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	if len(opening.Lines) == 0 {
+		return nil, nil
+	}
+	return opening, nil
+}
+
+// cloneTransactions copies the transactions in chronological order, fetching them in batches from a cursor
+func cloneTransactions(source *sql.Tx, transactionDB *TransactionDB, options *CloneOptions, result *CloneResult) ledgerError.ApplicationError {
+	_, err := source.Exec(`DECLARE clone_transactions NO SCROLL CURSOR FOR
+			SELECT transactions.id, transactions.timestamp, transactions.data, COALESCE(transactions.reverses, ''),
+				json_agg(json_build_object('account', lines.account_id, 'delta', lines.delta, 'currency', lines.currency,
+						'rounding', lines.rounding)
+					ORDER BY lines.id)
+			FROM transactions JOIN lines ON lines.transaction_id = transactions.id
+			WHERE $1::timestamp IS NULL OR transactions.timestamp >= $1
+			GROUP BY transactions.id
+			ORDER BY transactions.timestamp, transactions.id`, options.Since)
+	if err != nil {
+		log.Println("Error declaring clone transactions cursor:", err)
+		return DBError(err)
+	}
+	for {
+		rows, err := source.Query(fmt.Sprintf("FETCH %d FROM clone_transactions", cloneBatchSize))
+		if err != nil {
+			log.Println("Error fetching cloned transactions:", err)
+			return DBError(err)
+		}
+		var batch []*Transaction
+		for rows.Next() {
+			transaction := &Transaction{}
+			var timestamp time.Time
+			var rawData, rawLines []byte
+			if err := rows.Scan(&transaction.ID, &timestamp, &rawData, &transaction.Reverses, &rawLines); err != nil {
+				rows.Close()
+				return DBError(err)
+			}
+			transaction.ID = options.mapTransactionID(transaction.ID)
+			if transaction.Reverses != "" {
+				transaction.Reverses = options.mapTransactionID(transaction.Reverses)
+			}
+			transaction.Timestamp = timestamp.Format(LedgerTimestampLayout)
+			if err := json.Unmarshal(rawData, &transaction.Data); err != nil {
+				rows.Close()
+				return JSONError(err)
+			}
+			transaction.Data = options.cloneData(transaction.Data)
+			if err := json.Unmarshal(rawLines, &transaction.Lines); err != nil {
+				rows.Close()
+				return JSONError(err)
+			}
+			for _, line := range transaction.Lines {
+				line.AccountID = options.MapID(line.AccountID)
+			}
+			batch = append(batch, transaction)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return DBError(err)
+		}
+		if len(batch) > 0 {
+			if aerr := cloneBatch(transactionDB, batch, result); aerr != nil {
+				return aerr
+			}
+		}
+		if len(batch) < cloneBatchSize {
+			return nil
+		}
+	}
+}
+
+// cloneReportDefinitions returns the report definitions of the source ledger
+func cloneReportDefinitions(source *sql.Tx) ([]*ReportDefinition, ledgerError.ApplicationError) {
+	rows, err := source.Query("SELECT definition, last_run_at FROM report_definitions ORDER BY id")
+	if err != nil {
+		log.Println("Error executing clone report definitions query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	definitions := make([]*ReportDefinition, 0)
+	for rows.Next() {
+		definition, err := scanReportDefinition(rows)
+		if err != nil {
+			return nil, DBError(err)
+		}
+		definitions = append(definitions, definition)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return definitions, nil
+}
+
+// cloneBatch writes a batch of cloned transactions, counting the created and failed ones
+func cloneBatch(transactionDB *TransactionDB, batch []*Transaction, result *CloneResult) ledgerError.ApplicationError {
+	results, aerr := transactionDB.TransactBatch(batch)
+	if aerr != nil {
+		return aerr
+	}
+	for _, r := range results {
+		if r.Status == BulkStatusCreated {
+			result.Transactions++
+		} else {
+			log.Println("Cloned transaction failed:", r.ID, r.Reason)
+			result.Failed++
+		}
+	}
+	return nil
+}
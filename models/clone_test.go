@@ -0,0 +1,35 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloneMapID(t *testing.T) {
+	options := &CloneOptions{IDPrefix: "stg_"}
+	assert.Equal(t, "stg_alice", options.MapID("alice"), "Invalid prefixed ID")
+
+	options = &CloneOptions{IDPrefix: "stg_", HashIDs: true, hashKey: []byte("key")}
+	id := options.MapID("alice")
+	assert.Equal(t, 4+20, len(id), "Invalid hashed ID length")
+	assert.Equal(t, id, options.MapID("alice"), "Hashed IDs should be consistent")
+	assert.NotEqual(t, id, options.MapID("bob"), "Hashed IDs should be distinct")
+	assert.NotContains(t, id, "alice", "Hashed ID should not contain the original ID")
+
+	// The reversals are mapped to the reversal IDs of the mapped transactions
+	assert.Equal(t, ReversalID(options.MapID("t1")), options.mapTransactionID("t1.reversal"), "Invalid reversal ID")
+	assert.Equal(t, ReversalID(ReversalID(options.MapID("t1"))), options.mapTransactionID("t1.reversal.reversal"), "Invalid reversal ID")
+}
+
+func TestCloneData(t *testing.T) {
+	options := &CloneOptions{IDPrefix: "stg_", RedactKeys: []string{"email", "phone"}}
+	data := map[string]interface{}{"email": "alice@example.com", "plan": "gold", "reverses": "t1"}
+	cloned := options.cloneData(data)
+	assert.Equal(t, RedactedValue, cloned["email"], "Email should be redacted")
+	assert.Equal(t, "gold", cloned["plan"], "Other keys should be kept")
+	assert.Equal(t, "stg_t1", cloned["reverses"], "Reversed transaction should be remapped")
+	_, ok := cloned["phone"]
+	assert.False(t, ok, "Missing keys should not be added")
+	assert.Equal(t, "alice@example.com", data["email"], "Source data should not be changed")
+}
@@ -0,0 +1,220 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"regexp"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// Functions of the computed fields of accounts
+const (
+	ComputedLifetimeDebits        = "lifetime_debits"
+	ComputedLifetimeCredits       = "lifetime_credits"
+	ComputedTransactionCount      = "transaction_count"
+	ComputedLastActivityAt        = "last_activity_at"
+	ComputedDaysSinceLastActivity = "days_since_last_activity"
+)
+
+var computedFunctions = map[string]bool{
+	ComputedLifetimeDebits:        true,
+	ComputedLifetimeCredits:       true,
+	ComputedTransactionCount:      true,
+	ComputedLastActivityAt:        true,
+	ComputedDaysSinceLastActivity: true,
+}
+
+var validComputedFieldName = regexp.MustCompile(`^[a-z_A-Z]+$`)
+
+// ComputedField represents a field calculated by the server from the lines of every account
+// in the account responses of the ledger. The lines can be limited to a currency.
+type ComputedField struct {
+	Name      string `json:"name"`
+	Function  string `json:"function"`
+	Currency  string `json:"currency,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// Validate checks whether the computed field has a valid name, function and currency
+func (f *ComputedField) Validate() error {
+	switch {
+	case !validComputedFieldName.MatchString(f.Name):
+		return errors.New("Invalid computed field name")
+	case !computedFunctions[f.Function]:
+		return errors.New("Invalid computed field function")
+	case f.Currency != "" && !IsValidCurrency(f.Currency):
+		return errors.New("Invalid computed field currency")
+	}
+	return nil
+}
+
+// accountActivity sums up the lines of an account
+type accountActivity struct {
+	debits       int64
+	credits      int64
+	transactions int64
+	lastActivity time.Time
+}
+
+// value returns the value of the field from the activity of an account as of now.
+// The activity based fields are null for accounts without any lines.
+func (f *ComputedField) value(activity *accountActivity, now time.Time) interface{} {
+	if activity == nil {
+		activity = &accountActivity{}
+	}
+	switch f.Function {
+	case ComputedLifetimeDebits:
+		return activity.debits
+	case ComputedLifetimeCredits:
+		return activity.credits
+	case ComputedTransactionCount:
+		return activity.transactions
+	case ComputedLastActivityAt:
+		if activity.lastActivity.IsZero() {
+			return nil
+		}
+		return activity.lastActivity.Format(LedgerTimestampLayout)
+	case ComputedDaysSinceLastActivity:
+		if activity.lastActivity.IsZero() {
+			return nil
+		}
+		days := int(now.Sub(activity.lastActivity).Hours() / 24)
+		if days < 0 {
+			return 0
+		}
+		return days
+	}
+	return nil
+}
+
+// ComputedFieldDB provides all functions related to the computed fields of accounts
+type ComputedFieldDB struct {
+	db *sql.DB
+}
+
+// NewComputedFieldDB provides instance of `ComputedFieldDB`
+func NewComputedFieldDB(db *sql.DB) ComputedFieldDB {
+	return ComputedFieldDB{db: db}
+}
+
+// Create adds a computed field
+func (c *ComputedFieldDB) Create(field *ComputedField) ledgerError.ApplicationError {
+	now := time.Now().UTC()
+	_, err := c.db.Exec("INSERT INTO computed_fields (name, function, currency, created_at) VALUES ($1, $2, $3, $4)",
+		field.Name, field.Function, field.Currency, now)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return ComputedFieldExistsError(field.Name)
+		}
+		return DBError(err)
+	}
+	field.CreatedAt = now.Format(LedgerTimestampLayout)
+	return nil
+}
+
+// Delete removes a computed field. It returns false if the field doesn't exist.
+func (c *ComputedFieldDB) Delete(name string) (bool, ledgerError.ApplicationError) {
+	result, err := c.db.Exec("DELETE FROM computed_fields WHERE name = $1", name)
+	if err != nil {
+		return false, DBError(err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, DBError(err)
+	}
+	return count > 0, nil
+}
+
+// List returns all the computed fields ordered by name
+func (c *ComputedFieldDB) List() ([]*ComputedField, ledgerError.ApplicationError) {
+	rows, err := c.db.Query("SELECT name, function, currency, created_at FROM computed_fields ORDER BY name")
+	if err != nil {
+		log.Println("Error executing computed fields query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	fields := make([]*ComputedField, 0)
+	for rows.Next() {
+		field := &ComputedField{}
+		var createdAt time.Time
+		if err := rows.Scan(&field.Name, &field.Function, &field.Currency, &createdAt); err != nil {
+			return nil, DBError(err)
+		}
+		field.CreatedAt = createdAt.Format(LedgerTimestampLayout)
+		fields = append(fields, field)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return fields, nil
+}
+
+// Compute returns the values of the fields of the accounts by their IDs, from a single query
+// summing up the lines of all the accounts in every currency and in total
+func (c *ComputedFieldDB) Compute(fields []*ComputedField, accountIDs []string) (map[string]map[string]interface{}, ledgerError.ApplicationError) {
+	values := make(map[string]map[string]interface{}, len(accountIDs))
+	if len(fields) == 0 || len(accountIDs) == 0 {
+		return values, nil
+	}
+
+	// The rows grouped by the account alone have a null currency, and sum up all the currencies
+	q := `SELECT lines.account_id, lines.currency, GROUPING(lines.currency) = 1,
+			COALESCE(SUM(CASE WHEN lines.delta < 0 THEN -lines.delta ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN lines.delta > 0 THEN lines.delta ELSE 0 END), 0),
+			COUNT(DISTINCT lines.transaction_id),
+			MAX(transactions.timestamp)
+		FROM lines JOIN transactions ON transactions.id = lines.transaction_id
+		WHERE lines.account_id = ANY($1)
+		GROUP BY GROUPING SETS ((lines.account_id, lines.currency), (lines.account_id))`
+	rows, err := c.db.Query(q, pq.Array(accountIDs))
+	if err != nil {
+		log.Println("Error executing computed fields query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	total := make(map[string]*accountActivity)
+	byCurrency := make(map[string]map[string]*accountActivity)
+	for rows.Next() {
+		var accountID string
+		var currency sql.NullString
+		var all bool
+		var lastActivity pq.NullTime
+		activity := &accountActivity{}
+		if err := rows.Scan(&accountID, &currency, &all, &activity.debits, &activity.credits,
+			&activity.transactions, &lastActivity); err != nil {
+			return nil, DBError(err)
+		}
+		if lastActivity.Valid {
+			activity.lastActivity = lastActivity.Time
+		}
+		if all {
+			total[accountID] = activity
+			continue
+		}
+		if byCurrency[accountID] == nil {
+			byCurrency[accountID] = make(map[string]*accountActivity)
+		}
+		byCurrency[accountID][currency.String] = activity
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+
+	now := time.Now().UTC()
+	for _, id := range accountIDs {
+		accountValues := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			activity := total[id]
+			if field.Currency != "" {
+				activity = byCurrency[id][field.Currency]
+			}
+			accountValues[field.Name] = field.value(activity, now)
+		}
+		values[id] = accountValues
+	}
+	return values, nil
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestComputedFieldValidate(t *testing.T) {
+	valid := &ComputedField{Name: "spend", Function: ComputedLifetimeDebits, Currency: "USD"}
+	assert.Nil(t, valid.Validate(), "Computed field should be valid")
+
+	invalid := []*ComputedField{
+		{Name: "", Function: ComputedLifetimeDebits},
+		{Name: "spend-usd", Function: ComputedLifetimeDebits},
+		{Name: "spend", Function: "balance"},
+		{Name: "spend", Function: ComputedLifetimeDebits, Currency: "usd"},
+	}
+	for _, field := range invalid {
+		assert.NotNil(t, field.Validate(), "Computed field should not be valid: %v", field)
+	}
+}
+
+func TestComputedFieldValue(t *testing.T) {
+	now := time.Date(2017, 1, 11, 12, 0, 0, 0, time.UTC)
+	activity := &accountActivity{
+		debits:       100,
+		credits:      250,
+		transactions: 3,
+		lastActivity: time.Date(2017, 1, 1, 13, 0, 0, 0, time.UTC),
+	}
+	values := map[string]interface{}{
+		ComputedLifetimeDebits:        int64(100),
+		ComputedLifetimeCredits:       int64(250),
+		ComputedTransactionCount:      int64(3),
+		ComputedLastActivityAt:        "2017-01-01 13:00:00.000",
+		ComputedDaysSinceLastActivity: 9,
+	}
+	for function, value := range values {
+		field := &ComputedField{Name: "field", Function: function}
+		assert.Equal(t, value, field.value(activity, now), "Invalid value of computed field: %v", function)
+	}
+
+	// Accounts without lines have no activity
+	field := &ComputedField{Name: "field", Function: ComputedDaysSinceLastActivity}
+	assert.Nil(t, field.value(nil, now), "Days since last activity should be null without activity")
+	field.Function = ComputedLifetimeCredits
+	assert.Equal(t, int64(0), field.value(nil, now), "Lifetime credits should be zero without activity")
+}
+
+type ComputedFieldsSuite struct {
+	suite.Suite
+	db *sql.DB
+}
+
+func (cs *ComputedFieldsSuite) SetupSuite() {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(cs.T(), databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	} else {
+		log.Println("Successfully established connection to database.")
+		cs.db = db
+	}
+}
+
+func (cs *ComputedFieldsSuite) TestCompute() {
+	t := cs.T()
+	transactionDB := NewTransactionDB(cs.db)
+	for _, txn := range []*Transaction{
+		{ID: "computed1", Timestamp: "2017-01-01 13:00:00.000", Lines: []*TransactionLine{
+			{AccountID: "computed_alice", Delta: -100, Currency: "USD"},
+			{AccountID: "computed_bob", Delta: 100, Currency: "USD"},
+		}},
+		{ID: "computed2", Timestamp: "2017-01-02 13:00:00.000", Lines: []*TransactionLine{
+			{AccountID: "computed_alice", Delta: 50, Currency: "EUR"},
+			{AccountID: "computed_bob", Delta: -50, Currency: "EUR"},
+		}},
+	} {
+		assert.True(t, transactionDB.Transact(txn), "Error while posting transaction")
+	}
+
+	computedFieldDB := NewComputedFieldDB(cs.db)
+	fields := []*ComputedField{
+		{Name: "debits", Function: ComputedLifetimeDebits},
+		{Name: "usd_credits", Function: ComputedLifetimeCredits, Currency: "USD"},
+		{Name: "count", Function: ComputedTransactionCount},
+		{Name: "last_activity", Function: ComputedLastActivityAt},
+	}
+	for _, field := range fields {
+		assert.Nil(t, computedFieldDB.Create(field), "Error while creating computed field")
+	}
+	aerr := computedFieldDB.Create(&ComputedField{Name: "debits", Function: ComputedLifetimeCredits})
+	if assert.NotNil(t, aerr, "Duplicate computed field should fail") {
+		assert.Equal(t, "computed_field.exists", aerr.ErrorCode(), "Invalid error code")
+	}
+	fields, aerr = computedFieldDB.List()
+	assert.Nil(t, aerr, "Error while listing computed fields")
+	assert.Equal(t, 4, len(fields), "Invalid count of computed fields")
+
+	values, aerr := computedFieldDB.Compute(fields, []string{"computed_alice", "computed_bob", "computed_carol"})
+	assert.Nil(t, aerr, "Error while computing fields")
+	assert.Equal(t, map[string]interface{}{
+		"debits":        int64(100),
+		"usd_credits":   int64(0),
+		"count":         int64(2),
+		"last_activity": "2017-01-02 13:00:00.000",
+	}, values["computed_alice"], "Invalid computed fields of account")
+	assert.Equal(t, int64(100), values["computed_bob"]["usd_credits"], "Invalid computed field in currency")
+	assert.Equal(t, map[string]interface{}{
+		"debits":        int64(0),
+		"usd_credits":   int64(0),
+		"count":         int64(0),
+		"last_activity": nil,
+	}, values["computed_carol"], "Invalid computed fields of account without lines")
+
+	deleted, aerr := computedFieldDB.Delete("count")
+	assert.Nil(t, aerr, "Error while deleting computed field")
+	assert.True(t, deleted, "Computed field should be deleted")
+	deleted, _ = computedFieldDB.Delete("count")
+	assert.False(t, deleted, "Deleted computed field should not be deleted again")
+}
+
+func (cs *ComputedFieldsSuite) TearDownSuite() {
+	t := cs.T()
+	for _, q := range []string{
+		"DELETE FROM computed_fields",
+		"DELETE FROM lines WHERE transaction_id IN ('computed1', 'computed2')",
+		"DELETE FROM transactions WHERE id IN ('computed1', 'computed2')",
+		"DELETE FROM accounts WHERE id IN ('computed_alice', 'computed_bob')",
+	} {
+		if _, err := cs.db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestComputedFieldsSuite(t *testing.T) {
+	suite.Run(t, new(ComputedFieldsSuite))
+}
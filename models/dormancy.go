@@ -0,0 +1,98 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+)
+
+// AccountDormancy represents a change in the dormancy of an account, along with the timestamp
+// of its latest transaction
+type AccountDormancy struct {
+	AccountID      string `json:"account"`
+	DormantSince   string `json:"dormant_since,omitempty"`
+	LastActivityAt string `json:"last_activity_at"`
+}
+
+// DormancyDB provides the dormancy of the accounts
+type DormancyDB struct {
+	db *sql.DB
+}
+
+// NewDormancyDB provides instance of `DormancyDB`
+func NewDormancyDB(db *sql.DB) DormancyDB {
+	return DormancyDB{db: db}
+}
+
+// MarkDormant marks the accounts without any transactions since the cutoff as dormant from now,
+// and returns them. The accounts which never had a transaction aren't marked.
+func (d *DormancyDB) MarkDormant(cutoff time.Time, now time.Time) ([]*AccountDormancy, ledgerError.ApplicationError) {
+	rows, err := d.db.Query(`UPDATE accounts SET dormant_since = $2
+		FROM (
+			SELECT lines.account_id, MAX(transactions.timestamp) AS last_activity_at
+			FROM lines JOIN transactions ON transactions.id = lines.transaction_id
+			GROUP BY lines.account_id
+		) activity
+		WHERE accounts.id = activity.account_id AND accounts.dormant_since IS NULL
+			AND activity.last_activity_at < $1
+		RETURNING accounts.id, activity.last_activity_at`, cutoff, now)
+	if err != nil {
+		log.Println("Error executing mark dormant accounts query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	var dormant []*AccountDormancy
+	for rows.Next() {
+		var id string
+		var lastActivity time.Time
+		if err := rows.Scan(&id, &lastActivity); err != nil {
+			return nil, DBError(err)
+		}
+		dormant = append(dormant, &AccountDormancy{
+			AccountID:      id,
+			DormantSince:   now.Format(LedgerTimestampLayout),
+			LastActivityAt: lastActivity.Format(LedgerTimestampLayout),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return dormant, nil
+}
+
+// Reactivate clears the dormancy of the accounts with transactions since the cutoff, and returns them
+func (d *DormancyDB) Reactivate(cutoff time.Time) ([]*AccountDormancy, ledgerError.ApplicationError) {
+	rows, err := d.db.Query(`UPDATE accounts SET dormant_since = NULL
+		FROM (
+			SELECT lines.account_id, MAX(transactions.timestamp) AS last_activity_at
+			FROM lines JOIN transactions ON transactions.id = lines.transaction_id
+			WHERE lines.account_id IN (SELECT id FROM accounts WHERE dormant_since IS NOT NULL)
+			GROUP BY lines.account_id
+		) activity
+		WHERE accounts.id = activity.account_id AND accounts.dormant_since IS NOT NULL
+			AND activity.last_activity_at >= $1
+		RETURNING accounts.id, activity.last_activity_at`, cutoff)
+	if err != nil {
+		log.Println("Error executing reactivate accounts query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	var reactivated []*AccountDormancy
+	for rows.Next() {
+		var id string
+		var lastActivity time.Time
+		if err := rows.Scan(&id, &lastActivity); err != nil {
+			return nil, DBError(err)
+		}
+		reactivated = append(reactivated, &AccountDormancy{
+			AccountID:      id,
+			LastActivityAt: lastActivity.Format(LedgerTimestampLayout),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return reactivated, nil
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type DormancySuite struct {
+	suite.Suite
+	db *sql.DB
+}
+
+func (ds *DormancySuite) SetupSuite() {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(ds.T(), databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	} else {
+		log.Println("Successfully established connection to database.")
+		ds.db = db
+	}
+}
+
+// dormancyAccounts returns the changes of the accounts of this suite, as the other accounts can change too
+func dormancyAccounts(changes []*AccountDormancy) map[string]*AccountDormancy {
+	accounts := make(map[string]*AccountDormancy)
+	for _, change := range changes {
+		if strings.HasPrefix(change.AccountID, "dormancy_") {
+			accounts[change.AccountID] = change
+		}
+	}
+	return accounts
+}
+
+func (ds *DormancySuite) TestDormancy() {
+	t := ds.T()
+	transactionDB := NewTransactionDB(ds.db)
+	post := func(id, timestamp, from, to string) {
+		txn := &Transaction{
+			ID:        id,
+			Timestamp: timestamp,
+			Lines: []*TransactionLine{
+				{AccountID: from, Delta: -100, Currency: "USD"},
+				{AccountID: to, Delta: 100, Currency: "USD"},
+			},
+		}
+		assert.True(t, transactionDB.Transact(txn), "Error while posting transaction")
+	}
+	post("dormancy1", "2017-01-01 13:00:00.000", "dormancy_alice", "dormancy_bob")
+	post("dormancy2", "2017-07-01 13:00:00.000", "dormancy_bob", "dormancy_carol")
+	accountDB := NewAccountDB(ds.db)
+	assert.Nil(t, accountDB.CreateAccount(&Account{ID: "dormancy_dave"}), "Error while creating account")
+
+	dormancyDB := NewDormancyDB(ds.db)
+	cutoff := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2017, 12, 1, 0, 0, 0, 0, time.UTC)
+	changes, aerr := dormancyDB.MarkDormant(cutoff, now)
+	assert.Nil(t, aerr, "Error while marking dormant accounts")
+	dormant := dormancyAccounts(changes)
+	assert.Equal(t, 1, len(dormant), "Only the accounts without recent transactions should be dormant")
+	if assert.NotNil(t, dormant["dormancy_alice"], "Account should be dormant") {
+		assert.Equal(t, "2017-12-01 00:00:00.000", dormant["dormancy_alice"].DormantSince, "Invalid dormant since")
+		assert.Equal(t, "2017-01-01 13:00:00.000", dormant["dormancy_alice"].LastActivityAt, "Invalid last activity")
+	}
+
+	// Dormant accounts are marked only once
+	changes, aerr = dormancyDB.MarkDormant(cutoff, now.Add(time.Hour))
+	assert.Nil(t, aerr, "Error while marking dormant accounts")
+	assert.Empty(t, dormancyAccounts(changes), "Dormant accounts should not be marked again")
+
+	account, aerr := accountDB.GetByID("dormancy_alice")
+	assert.Nil(t, aerr, "Error while getting account")
+	assert.Equal(t, "2017-12-01 00:00:00.000", account.DormantSince, "Invalid dormant since of account")
+
+	engine, aerr := NewSearchEngine(ds.db, SearchNamespaceAccounts)
+	assert.Nil(t, aerr, "Error while creating search engine")
+	results, aerr := engine.Query(`{"query": {"must": {"fields": [{"dormant": {"eq": true}, "id": {"like": "dormancy_%"}}]}}}`)
+	assert.Nil(t, aerr, "Error while searching dormant accounts")
+	accounts := results.([]*AccountResult)
+	if assert.Equal(t, 1, len(accounts), "Invalid count of dormant accounts") {
+		assert.Equal(t, "dormancy_alice", accounts[0].ID, "Invalid dormant account")
+		assert.Equal(t, "2017-12-01 00:00:00.000", accounts[0].DormantSince, "Invalid dormant since of search result")
+	}
+
+	// A transaction reactivates the account
+	post("dormancy3", "2017-12-01 09:00:00.000", "dormancy_alice", "dormancy_carol")
+	changes, aerr = dormancyDB.Reactivate(cutoff)
+	assert.Nil(t, aerr, "Error while reactivating accounts")
+	reactivated := dormancyAccounts(changes)
+	if assert.Equal(t, 1, len(reactivated), "Invalid count of reactivated accounts") {
+		assert.Equal(t, "2017-12-01 09:00:00.000", reactivated["dormancy_alice"].LastActivityAt, "Invalid last activity")
+	}
+	account, aerr = accountDB.GetByID("dormancy_alice")
+	assert.Nil(t, aerr, "Error while getting account")
+	assert.Empty(t, account.DormantSince, "Reactivated account should not be dormant")
+}
+
+func (ds *DormancySuite) TearDownSuite() {
+	t := ds.T()
+	for _, q := range []string{
+		"UPDATE accounts SET dormant_since = NULL",
+		"DELETE FROM lines WHERE transaction_id LIKE 'dormancy%'",
+		"DELETE FROM transactions WHERE id LIKE 'dormancy%'",
+		"DELETE FROM accounts WHERE id LIKE 'dormancy%'",
+	} {
+		if _, err := ds.db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDormancySuite(t *testing.T) {
+	suite.Run(t, new(DormancySuite))
+}
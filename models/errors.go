@@ -1,6 +1,9 @@
 package models
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/RealImage/QLedger/errors"
 )
 
@@ -35,3 +38,267 @@ func JSONError(err error) errors.ApplicationError {
 		Message: "JSON Error: " + err.Error(),
 	}
 }
+
+// LinesNotFoundError returns the error type of lines which don't exist
+func LinesNotFoundError(ids []int64) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "lines.notfound",
+		Message: fmt.Sprintf("Lines not found: %v", ids),
+	}
+}
+
+// LinesReconciledError returns the error type of lines which are already reconciled
+func LinesReconciledError(ids []int64) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "lines.reconciled",
+		Message: fmt.Sprintf("Lines already reconciled: %v", ids),
+	}
+}
+
+// ReportDefinitionInvalidError returns invalid report definition error type
+func ReportDefinitionInvalidError(err error) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "report.definition.invalid",
+		Message: "Invalid report definition: " + err.Error(),
+	}
+}
+
+// SnapshotExistsError returns snapshot already exists error type
+func SnapshotExistsError(name string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "snapshot.exists",
+		Message: "Snapshot already exists: " + name,
+	}
+}
+
+// WebhookExistsError returns webhook already exists error type
+func WebhookExistsError(id string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "webhook.exists",
+		Message: "Webhook already exists: " + id,
+	}
+}
+
+// ClientKeyExistsError returns client key already exists error type
+func ClientKeyExistsError(id string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "client_key.exists",
+		Message: "Client key already exists: " + id,
+	}
+}
+
+// ReadSnapshotInvalidError returns invalid read snapshot error type
+func ReadSnapshotInvalidError(id string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "read_snapshot.invalid",
+		Message: "Invalid read snapshot: " + id,
+	}
+}
+
+// ReadSnapshotExpiredError returns expired read snapshot error type
+func ReadSnapshotExpiredError(id string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "read_snapshot.expired",
+		Message: "Read snapshot is expired or released: " + id,
+	}
+}
+
+// AccountFrozenError returns frozen account error type
+func AccountFrozenError(id string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "account.frozen",
+		Message: "Account is frozen: " + id,
+	}
+}
+
+// AccountMinBalanceError returns minimum balance violation error type
+func AccountMinBalanceError(id string, currency string) errors.ApplicationError {
+	message := "Account balance would go below its minimum: " + id
+	if currency != "" {
+		message += " (" + currency + ")"
+	}
+	return &errors.BaseApplicationError{
+		Code:    "account.min_balance",
+		Message: message,
+	}
+}
+
+// PostingHookExistsError returns posting hook already exists error type
+func PostingHookExistsError(id string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "posting_hook.exists",
+		Message: "Posting hook already exists: " + id,
+	}
+}
+
+// PostingHookRejectedError returns transaction rejected by a posting hook error type
+func PostingHookRejectedError(id string, reason string) errors.ApplicationError {
+	message := "Transaction rejected by posting hook: " + id
+	if reason != "" {
+		message += " (" + reason + ")"
+	}
+	return &errors.BaseApplicationError{
+		Code:    "posting_hook.rejected",
+		Message: message,
+	}
+}
+
+// PostingHookUnavailableError returns unavailable posting hook error type
+func PostingHookUnavailableError(id string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "posting_hook.unavailable",
+		Message: "Posting hook is unavailable: " + id,
+	}
+}
+
+// CloneTargetNotEmptyError returns non-empty clone target error type
+func CloneTargetNotEmptyError() errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "clone.target_not_empty",
+		Message: "Ledger to clone into already has accounts or transactions",
+	}
+}
+
+// LedgerExistsError returns ledger already exists error type
+func LedgerExistsError(id string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "ledger.exists",
+		Message: "Ledger already exists: " + id,
+	}
+}
+
+// LedgerNotFoundError returns the error type of a ledger which doesn't exist
+func LedgerNotFoundError(id string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "ledger.notfound",
+		Message: "Ledger doesn't exist: " + id,
+	}
+}
+
+// ScheduledTransactionExistsError returns the error type of a transaction which is already scheduled differently
+func ScheduledTransactionExistsError(id string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "scheduled_transaction.exists",
+		Message: "Transaction is already scheduled: " + id,
+	}
+}
+
+// TransactionConflictError returns the error type of a transaction conflicting with an existing transaction
+func TransactionConflictError(id string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "transaction.conflict",
+		Message: "Transaction conflicts with an existing transaction: " + id,
+	}
+}
+
+// ComputedFieldExistsError returns the error type of a computed field which already exists
+func ComputedFieldExistsError(name string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "computed_field.exists",
+		Message: "Computed field already exists: " + name,
+	}
+}
+
+// CategorizationRuleExistsError returns the error type of a categorization rule which already exists
+func CategorizationRuleExistsError(id string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "categorization_rule.exists",
+		Message: "Categorization rule already exists: " + id,
+	}
+}
+
+// RegionFenceFailedError returns the error type of a promotion which couldn't fence the other region
+func RegionFenceFailedError(err error) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "region.fence_failed",
+		Message: "Other region couldn't be fenced: " + err.Error(),
+	}
+}
+
+// QuotaExceededError returns the error type of a client which exceeded its quota of accounts or transactions
+func QuotaExceededError(client string, quota string, limit int, period time.Duration) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "quota." + quota + "_exceeded",
+		Message: fmt.Sprintf("Quota of %d %s per %v exceeded by client: %s", limit, quota, period, client),
+	}
+}
+
+// MetadataScopeForbiddenError returns the error type of an action which the API keys with a metadata scope can't perform
+func MetadataScopeForbiddenError(action string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "metadata.scope_forbidden",
+		Message: "API key with metadata scope can't " + action,
+	}
+}
+
+// MetadataKeyForbiddenError returns the error type of a data key which the API key can't read or write
+func MetadataKeyForbiddenError(access string, key string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "metadata." + access + "_forbidden",
+		Message: "API key can't " + access + " the data key: " + key,
+	}
+}
+
+// TransactionReplayExpiredError returns the error type of a transaction repeated beyond the idempotency window
+func TransactionReplayExpiredError(id string, window time.Duration) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "transaction.replay_expired",
+		Message: fmt.Sprintf("Transaction repeated beyond the idempotency window of %v: %s", window, id),
+	}
+}
+
+// RoutingRuleExistsError returns the error type of a routing rule which already exists
+func RoutingRuleExistsError(id string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "routing_rule.exists",
+		Message: "Routing rule already exists: " + id,
+	}
+}
+
+// AccountRefUnmatchedError returns the error type of an account reference which no routing rule matches
+func AccountRefUnmatchedError(ref string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "account_ref.unmatched",
+		Message: "No routing rule matches the account reference: " + ref,
+	}
+}
+
+// AccountRefUnresolvedError returns the error type of an account reference whose lookup finds no account
+func AccountRefUnresolvedError(ref string, rule string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "account_ref.unresolved",
+		Message: fmt.Sprintf("No account found by routing rule %s for the account reference: %s", rule, ref),
+	}
+}
+
+// AccountRefAmbiguousError returns the error type of an account reference whose lookup finds several accounts
+func AccountRefAmbiguousError(ref string, rule string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "account_ref.ambiguous",
+		Message: fmt.Sprintf("Several accounts found by routing rule %s for the account reference: %s", rule, ref),
+	}
+}
+
+// MetadataEntityInvalidError returns the error type of an entity without data keys
+func MetadataEntityInvalidError(entity string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "metadata.invalid_entity",
+		Message: "Invalid entity of data keys: " + entity,
+	}
+}
+
+// RetentionSettingsInvalidError returns the error type of invalid retention settings
+func RetentionSettingsInvalidError(reason string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "retention.invalid_settings",
+		Message: "Invalid retention settings: " + reason,
+	}
+}
+
+// CachePolicyExistsError returns the error type of a cache policy which already exists
+func CachePolicyExistsError(id string) errors.ApplicationError {
+	return &errors.BaseApplicationError{
+		Code:    "cache_policy.exists",
+		Message: "Cache policy already exists: " + id,
+	}
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+)
+
+// FailoverEpoch represents the promotion of a region to the primary. The epochs only increase,
+// so the region of the latest epoch is the primary and the other regions are fenced.
+type FailoverEpoch struct {
+	Epoch         int64  `json:"epoch"`
+	PrimaryRegion string `json:"primary_region"`
+	PromotedAt    string `json:"promoted_at"`
+}
+
+// FailoverDB provides all functions related to the failover of the regions
+type FailoverDB struct {
+	db *sql.DB
+}
+
+// NewFailoverDB provides instance of `FailoverDB`
+func NewFailoverDB(db *sql.DB) FailoverDB {
+	return FailoverDB{db: db}
+}
+
+// IsStandby says whether the DB is a standby replicating from the primary, which is read-only
+func (f *FailoverDB) IsStandby() (bool, ledgerError.ApplicationError) {
+	var standby bool
+	if err := f.db.QueryRow("SELECT pg_is_in_recovery()").Scan(&standby); err != nil {
+		log.Println("Error executing recovery query:", err)
+		return false, DBError(err)
+	}
+	return standby, nil
+}
+
+// CurrentEpoch returns the latest failover epoch, or nil when no region was ever promoted
+func (f *FailoverDB) CurrentEpoch() (*FailoverEpoch, ledgerError.ApplicationError) {
+	epoch := &FailoverEpoch{}
+	var promotedAt time.Time
+	err := f.db.QueryRow("SELECT epoch, primary_region, promoted_at FROM failover_epochs ORDER BY epoch DESC LIMIT 1").
+		Scan(&epoch.Epoch, &epoch.PrimaryRegion, &promotedAt)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Println("Error executing failover epoch query:", err)
+		return nil, DBError(err)
+	}
+	epoch.PromotedAt = promotedAt.Format(LedgerTimestampLayout)
+	return epoch, nil
+}
+
+// RecordEpoch records the epoch unless it isn't newer than the latest epoch, and says whether it was recorded
+func (f *FailoverDB) RecordEpoch(epoch *FailoverEpoch) (bool, ledgerError.ApplicationError) {
+	promotedAt := time.Now().UTC()
+	result, err := f.db.Exec(`INSERT INTO failover_epochs (epoch, primary_region, promoted_at)
+		SELECT $1, $2, $3 WHERE NOT EXISTS (SELECT 1 FROM failover_epochs WHERE epoch >= $1)
+		ON CONFLICT (epoch) DO NOTHING`, epoch.Epoch, epoch.PrimaryRegion, promotedAt)
+	if err != nil {
+		log.Println("Error executing failover epoch insert query:", err)
+		return false, DBError(err)
+	}
+	recorded, err := result.RowsAffected()
+	if err != nil {
+		return false, DBError(err)
+	}
+	if recorded > 0 {
+		epoch.PromotedAt = promotedAt.Format(LedgerTimestampLayout)
+	}
+	return recorded > 0, nil
+}
+
+// PromoteStandby promotes the standby DB to a primary which accepts writes, waiting up to a minute
+func (f *FailoverDB) PromoteStandby() ledgerError.ApplicationError {
+	var promoted bool
+	if err := f.db.QueryRow("SELECT pg_promote(true, 60)").Scan(&promoted); err != nil {
+		log.Println("Error executing promote query:", err)
+		return DBError(err)
+	}
+	if !promoted {
+		return DBError(errors.New("standby DB wasn't promoted within a minute"))
+	}
+	return nil
+}
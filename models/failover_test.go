@@ -0,0 +1,70 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type FailoverSuite struct {
+	suite.Suite
+	db *sql.DB
+}
+
+func (fs *FailoverSuite) SetupSuite() {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(fs.T(), databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	} else {
+		log.Println("Successfully established connection to database.")
+		fs.db = db
+	}
+}
+
+func (fs *FailoverSuite) TestEpochs() {
+	t := fs.T()
+	failoverDB := NewFailoverDB(fs.db)
+
+	standby, aerr := failoverDB.IsStandby()
+	assert.Nil(t, aerr, "Error while checking standby")
+	assert.False(t, standby, "Test DB should not be a standby")
+
+	epoch, aerr := failoverDB.CurrentEpoch()
+	assert.Nil(t, aerr, "Error while getting current epoch")
+	assert.Nil(t, epoch, "No region should be promoted")
+
+	recorded, aerr := failoverDB.RecordEpoch(&FailoverEpoch{Epoch: 2, PrimaryRegion: "eu-west-1"})
+	assert.Nil(t, aerr, "Error while recording epoch")
+	assert.True(t, recorded, "Newer epoch should be recorded")
+
+	// The stale epochs are rejected, so that an old primary can't take over again
+	for _, stale := range []*FailoverEpoch{{Epoch: 2, PrimaryRegion: "us-east-1"}, {Epoch: 1, PrimaryRegion: "us-east-1"}} {
+		recorded, aerr = failoverDB.RecordEpoch(stale)
+		assert.Nil(t, aerr, "Error while recording epoch")
+		assert.False(t, recorded, "Stale epoch should not be recorded: %v", stale.Epoch)
+	}
+
+	epoch, aerr = failoverDB.CurrentEpoch()
+	assert.Nil(t, aerr, "Error while getting current epoch")
+	if assert.NotNil(t, epoch, "Region should be promoted") {
+		assert.Equal(t, int64(2), epoch.Epoch, "Invalid current epoch")
+		assert.Equal(t, "eu-west-1", epoch.PrimaryRegion, "Invalid primary region")
+	}
+}
+
+func (fs *FailoverSuite) TearDownSuite() {
+	if _, err := fs.db.Exec("DELETE FROM failover_epochs"); err != nil {
+		fs.T().Fatal(err)
+	}
+}
+
+func TestFailoverSuite(t *testing.T) {
+	suite.Run(t, new(FailoverSuite))
+}
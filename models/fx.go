@@ -0,0 +1,60 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+)
+
+// FXRate represents the conversion rate between two currencies published by a rate source
+type FXRate struct {
+	Source       string  `json:"source"`
+	FromCurrency string  `json:"from_currency"`
+	ToCurrency   string  `json:"to_currency"`
+	Rate         float64 `json:"rate"`
+	UpdatedAt    string  `json:"updated_at"`
+}
+
+// FXRateDB provides all functions related to FX rates
+type FXRateDB struct {
+	db *sql.DB
+}
+
+// NewFXRateDB provides instance of `FXRateDB`
+func NewFXRateDB(db *sql.DB) FXRateDB {
+	return FXRateDB{db: db}
+}
+
+// GetRate returns the latest rate of the source, or nil if the source has no such rate
+func (f *FXRateDB) GetRate(source, fromCurrency, toCurrency string) (*FXRate, ledgerError.ApplicationError) {
+	rate := &FXRate{Source: source, FromCurrency: fromCurrency, ToCurrency: toCurrency}
+	var updatedAt time.Time
+	q := "SELECT rate, updated_at FROM fx_rates WHERE source = $1 AND from_currency = $2 AND to_currency = $3"
+	err := f.db.QueryRow(q, source, fromCurrency, toCurrency).Scan(&rate.Rate, &updatedAt)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Println("Error executing FX rate query:", err)
+		return nil, DBError(err)
+	}
+	rate.UpdatedAt = updatedAt.Format(LedgerTimestampLayout)
+	return rate, nil
+}
+
+// SetRate creates or replaces the rate of the source
+func (f *FXRateDB) SetRate(rate *FXRate) ledgerError.ApplicationError {
+	q := `INSERT INTO fx_rates (source, from_currency, to_currency, rate, updated_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (source, from_currency, to_currency)
+			DO UPDATE SET rate = EXCLUDED.rate, updated_at = EXCLUDED.updated_at`
+	now := time.Now().UTC()
+	_, err := f.db.Exec(q, rate.Source, rate.FromCurrency, rate.ToCurrency, rate.Rate, now)
+	if err != nil {
+		return DBError(err)
+	}
+	rate.UpdatedAt = now.Format(LedgerTimestampLayout)
+	return nil
+}
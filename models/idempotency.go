@@ -0,0 +1,122 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+)
+
+// Behaviors on a transaction repeated with the ID of an existing transaction, but with different lines
+const (
+	// IdempotencyMismatchReject rejects the repeated transaction as conflicting
+	IdempotencyMismatchReject = "reject"
+	// IdempotencyMismatchAccept accepts the repeated transaction as a duplicate, keeping the existing one
+	IdempotencyMismatchAccept = "accept"
+)
+
+// Kinds of a transaction repeated with the ID of an existing transaction
+const (
+	ReplayDuplicate = "duplicate"
+	ReplayConflict  = "conflict"
+	ReplayMismatch  = "mismatch"
+	ReplayExpired   = "expired"
+)
+
+// IdempotencySettings are the settings of the transaction IDs as idempotency keys of a ledger
+type IdempotencySettings struct {
+	// WindowSeconds is the period after a transaction is created within which it can be repeated,
+	// and the transactions can be repeated at any time if it is zero
+	WindowSeconds int64 `json:"window_seconds"`
+	// OnMismatch is the behavior on a transaction repeated with different lines
+	OnMismatch string `json:"on_mismatch"`
+	UpdatedAt  string `json:"updated_at,omitempty"`
+}
+
+// DefaultIdempotencySettings are the settings of a ledger until they are set, which accept
+// the duplicates at any time and reject the conflicts
+var DefaultIdempotencySettings = IdempotencySettings{OnMismatch: IdempotencyMismatchReject}
+
+// Validate checks the window and the behavior on mismatch
+func (s *IdempotencySettings) Validate() error {
+	if s.WindowSeconds < 0 {
+		return errors.New("Window of idempotency keys can't be negative")
+	}
+	if s.OnMismatch != IdempotencyMismatchReject && s.OnMismatch != IdempotencyMismatchAccept {
+		return errors.New("Invalid behavior on mismatch: " + s.OnMismatch)
+	}
+	return nil
+}
+
+// Window returns the period within which a transaction can be repeated, or zero if there's no limit
+func (s *IdempotencySettings) Window() time.Duration {
+	return time.Duration(s.WindowSeconds) * time.Second
+}
+
+// ReplayKind returns the kind of a transaction repeated after the age of the existing transaction,
+// and whether its lines are the same
+func (s *IdempotencySettings) ReplayKind(age time.Duration, sameLines bool) string {
+	switch {
+	case s.WindowSeconds > 0 && age > s.Window():
+		return ReplayExpired
+	case sameLines:
+		return ReplayDuplicate
+	case s.OnMismatch == IdempotencyMismatchAccept:
+		return ReplayMismatch
+	}
+	return ReplayConflict
+}
+
+// IdempotencyDB provides the idempotency settings of the ledger
+type IdempotencyDB struct {
+	db *sql.DB
+}
+
+// NewIdempotencyDB provides instance of `IdempotencyDB`
+func NewIdempotencyDB(db *sql.DB) IdempotencyDB {
+	return IdempotencyDB{db: db}
+}
+
+// Get returns the idempotency settings, or the default settings if they aren't set
+func (i *IdempotencyDB) Get() (*IdempotencySettings, ledgerError.ApplicationError) {
+	settings, err := readIdempotencySettings(i.db)
+	if err != nil {
+		return nil, DBError(err)
+	}
+	return settings, nil
+}
+
+// readIdempotencySettings reads the idempotency settings from either the DB or an ongoing DB transaction
+func readIdempotencySettings(q interface {
+	QueryRow(string, ...interface{}) *sql.Row
+}) (*IdempotencySettings, error) {
+	settings := &IdempotencySettings{}
+	var updatedAt time.Time
+	err := q.QueryRow("SELECT window_seconds, on_mismatch, updated_at FROM idempotency_settings").Scan(
+		&settings.WindowSeconds, &settings.OnMismatch, &updatedAt)
+	if err == sql.ErrNoRows {
+		defaults := DefaultIdempotencySettings
+		return &defaults, nil
+	}
+	if err != nil {
+		log.Println("Error executing idempotency settings query:", err)
+		return nil, err
+	}
+	settings.UpdatedAt = updatedAt.Format(LedgerTimestampLayout)
+	return settings, nil
+}
+
+// Set creates or replaces the idempotency settings
+func (i *IdempotencyDB) Set(settings *IdempotencySettings) ledgerError.ApplicationError {
+	now := time.Now().UTC()
+	_, err := i.db.Exec(`INSERT INTO idempotency_settings (id, window_seconds, on_mismatch, updated_at) VALUES (true, $1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET window_seconds = $1, on_mismatch = $2, updated_at = $3`,
+		settings.WindowSeconds, settings.OnMismatch, now)
+	if err != nil {
+		return DBError(err)
+	}
+	settings.UpdatedAt = now.Format(LedgerTimestampLayout)
+	return nil
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestIdempotencySettings(t *testing.T) {
+	defaults := DefaultIdempotencySettings
+	assert.Nil(t, defaults.Validate(), "Default settings should be valid")
+	assert.Equal(t, ReplayDuplicate, defaults.ReplayKind(365*24*time.Hour, true), "Default settings should have no window")
+	assert.Equal(t, ReplayConflict, defaults.ReplayKind(time.Second, false), "Default settings should reject mismatches")
+
+	settings := &IdempotencySettings{WindowSeconds: 3600, OnMismatch: IdempotencyMismatchAccept}
+	assert.Nil(t, settings.Validate(), "Settings should be valid")
+	assert.Equal(t, time.Hour, settings.Window(), "Invalid window")
+	assert.Equal(t, ReplayDuplicate, settings.ReplayKind(time.Hour, true), "Replay within window should be duplicate")
+	assert.Equal(t, ReplayMismatch, settings.ReplayKind(time.Minute, false), "Mismatch should be accepted")
+	assert.Equal(t, ReplayExpired, settings.ReplayKind(2*time.Hour, true), "Replay beyond window should be expired")
+
+	for _, invalid := range []IdempotencySettings{
+		{WindowSeconds: -1, OnMismatch: IdempotencyMismatchReject},
+		{OnMismatch: "overwrite"},
+	} {
+		assert.NotNil(t, invalid.Validate(), "Settings should be invalid: %v", invalid)
+	}
+}
+
+type IdempotencySuite struct {
+	suite.Suite
+	db *sql.DB
+}
+
+func (is *IdempotencySuite) SetupSuite() {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(is.T(), databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	} else {
+		log.Println("Successfully established connection to database.")
+		is.db = db
+	}
+}
+
+func (is *IdempotencySuite) TestReplay() {
+	t := is.T()
+	idempotencyDB := NewIdempotencyDB(is.db)
+	settings, aerr := idempotencyDB.Get()
+	assert.Nil(t, aerr, "Error while getting idempotency settings")
+	assert.Equal(t, DefaultIdempotencySettings, *settings, "Settings should be default until set")
+
+	transactionDB := NewTransactionDB(is.db)
+	transaction := &Transaction{
+		ID: "idempotency1",
+		Lines: []*TransactionLine{
+			{AccountID: "idempotency_alice", Delta: -100},
+			{AccountID: "idempotency_bob", Delta: 100},
+		},
+	}
+	assert.True(t, transactionDB.Transact(transaction), "Error while posting transaction")
+	mismatch := &Transaction{
+		ID: "idempotency1",
+		Lines: []*TransactionLine{
+			{AccountID: "idempotency_alice", Delta: -200},
+			{AccountID: "idempotency_bob", Delta: 200},
+		},
+	}
+
+	replay, aerr := transactionDB.Replay(transaction)
+	assert.Nil(t, aerr, "Error while checking replay")
+	assert.Equal(t, ReplayDuplicate, replay.Kind, "Invalid replay kind")
+	assert.True(t, replay.Age < time.Minute, "Invalid replay age: %v", replay.Age)
+	replay, aerr = transactionDB.Replay(mismatch)
+	assert.Nil(t, aerr, "Error while checking replay")
+	assert.Equal(t, ReplayConflict, replay.Kind, "Mismatch should be rejected by default")
+
+	aerr = idempotencyDB.Set(&IdempotencySettings{WindowSeconds: 3600, OnMismatch: IdempotencyMismatchAccept})
+	assert.Nil(t, aerr, "Error while setting idempotency settings")
+	replay, aerr = transactionDB.Replay(mismatch)
+	assert.Nil(t, aerr, "Error while checking replay")
+	assert.Equal(t, ReplayMismatch, replay.Kind, "Mismatch should be accepted")
+	assert.Equal(t, time.Hour, replay.Window, "Invalid replay window")
+
+	// The transaction is repeated beyond the window
+	_, err := is.db.Exec("UPDATE transactions SET created_at = created_at - interval '2 hours' WHERE id = $1", transaction.ID)
+	assert.Nil(t, err, "Error while updating transaction")
+	replay, aerr = transactionDB.Replay(transaction)
+	assert.Nil(t, aerr, "Error while checking replay")
+	assert.Equal(t, ReplayExpired, replay.Kind, "Replay beyond window should be expired")
+
+	results, aerr := transactionDB.TransactBatch([]*Transaction{transaction})
+	assert.Nil(t, aerr, "Error while posting batch")
+	assert.Equal(t, BulkReasonReplayExpired, results[0].Reason, "Invalid bulk result")
+	assert.Equal(t, ReplayExpired, results[0].Replay.Kind, "Invalid bulk replay")
+}
+
+func (is *IdempotencySuite) TearDownSuite() {
+	t := is.T()
+	for _, q := range []string{
+		"DELETE FROM idempotency_settings",
+		"DELETE FROM lines WHERE transaction_id LIKE 'idempotency%'",
+		"DELETE FROM transactions WHERE id LIKE 'idempotency%'",
+		"DELETE FROM accounts WHERE id LIKE 'idempotency%'",
+	} {
+		if _, err := is.db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIdempotencySuite(t *testing.T) {
+	suite.Run(t, new(IdempotencySuite))
+}
@@ -0,0 +1,358 @@
+package models
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+)
+
+const (
+	// InterchangeFormat identifies the canonical ledger export format
+	InterchangeFormat = "qledger-export"
+	// InterchangeVersion is the version of the canonical ledger export format
+	InterchangeVersion = 1
+)
+
+// Types of the records of a ledger export
+const (
+	ExportRecordHeader      = "header"
+	ExportRecordAccount     = "account"
+	ExportRecordTransaction = "transaction"
+	ExportRecordManifest    = "manifest"
+)
+
+// InterchangeSchema is the JSON schema of the records of a ledger export
+const InterchangeSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://github.com/RealImage/QLedger/export/v1",
+  "title": "QLedger export record",
+  "type": "object",
+  "required": ["type"],
+  "oneOf": [
+    {
+      "properties": {
+        "type": {"const": "header"},
+        "format": {"const": "qledger-export"},
+        "version": {"const": 1},
+        "exported_at": {"type": "string"}
+      },
+      "required": ["format", "version", "exported_at"]
+    },
+    {
+      "properties": {
+        "type": {"const": "account"},
+        "id": {"type": "string"},
+        "data": {"type": "object"}
+      },
+      "required": ["id", "data"]
+    },
+    {
+      "properties": {
+        "type": {"const": "transaction"},
+        "id": {"type": "string"},
+        "timestamp": {"type": "string"},
+        "data": {"type": "object"},
+        "reverses": {"type": "string"},
+        "lines": {
+          "type": "array",
+          "items": {
+            "type": "object",
+            "properties": {
+              "account": {"type": "string"},
+              "delta": {"type": "integer"},
+              "currency": {"type": "string", "pattern": "^[A-Z]{3}$"}
+            },
+            "required": ["account", "delta"]
+          }
+        }
+      },
+      "required": ["id", "timestamp", "data", "lines"]
+    },
+    {
+      "properties": {
+        "type": {"const": "manifest"},
+        "accounts": {"type": "integer"},
+        "transactions": {"type": "integer"},
+        "sha256": {"type": "string", "pattern": "^[0-9a-f]{64}$"}
+      },
+      "required": ["accounts", "transactions", "sha256"]
+    }
+  ]
+}`
+
+// ExportRecord represents a line of a ledger export.
+// The header comes first, followed by the accounts, the transactions and finally the manifest.
+// Each type of record is written with only its own fields.
+type ExportRecord struct {
+	Type string `json:"type"`
+	// Header
+	Format     string `json:"format,omitempty"`
+	Version    int    `json:"version,omitempty"`
+	ExportedAt string `json:"exported_at,omitempty"`
+	// Account and transaction
+	ID        string                 `json:"id,omitempty"`
+	Timestamp string                 `json:"timestamp,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	Lines     []*TransactionLine     `json:"lines,omitempty"`
+	// Reverses is the ID of the transaction reversed by a reversal
+	Reverses string `json:"reverses,omitempty"`
+	// Manifest
+	Accounts     *int   `json:"accounts,omitempty"`
+	Transactions *int   `json:"transactions,omitempty"`
+	SHA256       string `json:"sha256,omitempty"`
+}
+
+// ExportWriter writes the records of a ledger export and keeps the checksum of the written records
+type ExportWriter struct {
+	// Metadata leaves out the data keys which can't be read within the scope, if any
+	Metadata *MetadataScope
+
+	w            io.Writer
+	hash         hash.Hash
+	accounts     int
+	transactions int
+}
+
+// NewExportWriter writes the header of a ledger export and returns the writer of its records
+func NewExportWriter(w io.Writer, exportedAt time.Time) (*ExportWriter, error) {
+	writer := &ExportWriter{w: w, hash: sha256.New()}
+	err := writer.write(&exportHeader{
+		Type:       ExportRecordHeader,
+		Format:     InterchangeFormat,
+		Version:    InterchangeVersion,
+		ExportedAt: exportedAt.UTC().Format(LedgerTimestampLayout),
+	})
+	return writer, err
+}
+
+type exportHeader struct {
+	Type       string `json:"type"`
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	ExportedAt string `json:"exported_at"`
+}
+
+type exportAccount struct {
+	Type string                 `json:"type"`
+	ID   string                 `json:"id"`
+	Data map[string]interface{} `json:"data"`
+}
+
+type exportTransaction struct {
+	Type      string                 `json:"type"`
+	ID        string                 `json:"id"`
+	Timestamp string                 `json:"timestamp"`
+	Data      map[string]interface{} `json:"data"`
+	Lines     []*TransactionLine     `json:"lines"`
+	Reverses  string                 `json:"reverses,omitempty"`
+}
+
+type exportManifest struct {
+	Type         string `json:"type"`
+	Accounts     int    `json:"accounts"`
+	Transactions int    `json:"transactions"`
+	SHA256       string `json:"sha256"`
+}
+
+func (e *ExportWriter) write(record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	e.hash.Write(data)
+	_, err = e.w.Write(data)
+	return err
+}
+
+// WriteAccount writes an account record
+func (e *ExportWriter) WriteAccount(account *Account) error {
+	e.accounts++
+	return e.write(&exportAccount{Type: ExportRecordAccount, ID: account.ID, Data: nonNilData(e.Metadata.FilterData(account.Data))})
+}
+
+// WriteTransaction writes a transaction record
+func (e *ExportWriter) WriteTransaction(transaction *Transaction) error {
+	e.transactions++
+	return e.write(&exportTransaction{
+		Type:      ExportRecordTransaction,
+		ID:        transaction.ID,
+		Timestamp: transaction.Timestamp,
+		Data:      nonNilData(e.Metadata.FilterData(transaction.Data)),
+		Lines:     transaction.Lines,
+		Reverses:  transaction.Reverses,
+	})
+}
+
+// Close writes the manifest with the record counts and the SHA-256 checksum of all the preceding lines
+func (e *ExportWriter) Close() error {
+	data, err := json.Marshal(&exportManifest{
+		Type:         ExportRecordManifest,
+		Accounts:     e.accounts,
+		Transactions: e.transactions,
+		SHA256:       hex.EncodeToString(e.hash.Sum(nil)),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(append(data, '\n'))
+	return err
+}
+
+func nonNilData(data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return map[string]interface{}{}
+	}
+	return data
+}
+
+// ReadExport reads and verifies a ledger export, calling `fn` for each account and transaction record.
+// The records are passed before the manifest is verified, so the export should be verified
+// with a first pass before applying it.
+func ReadExport(r io.Reader, fn func(*ExportRecord) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	checksum := sha256.New()
+	accounts, transactions := 0, 0
+	var manifest *ExportRecord
+
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Bytes()
+		if manifest != nil {
+			return fmt.Errorf("Unexpected record after manifest at line %d", n)
+		}
+		record := &ExportRecord{}
+		if err := json.Unmarshal(line, record); err != nil {
+			return fmt.Errorf("Invalid record at line %d: %v", n, err)
+		}
+		if n == 1 {
+			if record.Type != ExportRecordHeader || record.Format != InterchangeFormat {
+				return errors.New("Missing export header")
+			}
+			if record.Version != InterchangeVersion {
+				return fmt.Errorf("Unsupported export version: %d", record.Version)
+			}
+		}
+		switch record.Type {
+		case ExportRecordHeader:
+			if n != 1 {
+				return fmt.Errorf("Unexpected header at line %d", n)
+			}
+		case ExportRecordAccount:
+			accounts++
+		case ExportRecordTransaction:
+			transactions++
+		case ExportRecordManifest:
+			manifest = record
+			continue
+		default:
+			return fmt.Errorf("Invalid record type at line %d: %v", n, record.Type)
+		}
+		checksum.Write(line)
+		checksum.Write([]byte{'\n'})
+		if fn != nil && record.Type != ExportRecordHeader {
+			if err := fn(record); err != nil {
+				return fmt.Errorf("Error at line %d: %v", n, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	switch {
+	case manifest == nil:
+		return errors.New("Missing export manifest")
+	case manifest.Accounts == nil || *manifest.Accounts != accounts:
+		return errors.New("Mismatching number of accounts in export manifest")
+	case manifest.Transactions == nil || *manifest.Transactions != transactions:
+		return errors.New("Mismatching number of transactions in export manifest")
+	case manifest.SHA256 != hex.EncodeToString(checksum.Sum(nil)):
+		return errors.New("Mismatching checksum in export manifest")
+	}
+	return nil
+}
+
+// ExportDB provides the functions to export all the accounts and transactions
+type ExportDB struct {
+	db *sql.DB
+}
+
+// NewExportDB provides instance of `ExportDB`
+func NewExportDB(db *sql.DB) ExportDB {
+	return ExportDB{db: db}
+}
+
+// Export writes all the accounts ordered by ID, and all the transactions with their lines
+// in chronological order. They are read within the DB transaction, which should be a read
+// transaction from `BeginRead` so that all of them are consistent.
+func (e *ExportDB) Export(writer *ExportWriter, tx *sql.Tx) ledgerError.ApplicationError {
+	rows, err := tx.Query("SELECT id, data FROM accounts ORDER BY id")
+	if err != nil {
+		log.Println("Error executing export accounts query:", err)
+		return DBError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		account := &Account{}
+		var rawData []byte
+		if err := rows.Scan(&account.ID, &rawData); err != nil {
+			return DBError(err)
+		}
+		if err := json.Unmarshal(rawData, &account.Data); err != nil {
+			return JSONError(err)
+		}
+		if err := writer.WriteAccount(account); err != nil {
+			return DBError(err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return DBError(err)
+	}
+
+	q := `SELECT transactions.id, transactions.timestamp, transactions.data, COALESCE(transactions.reverses, ''),
+				json_agg(json_build_object('account', lines.account_id, 'delta', lines.delta, 'currency', lines.currency,
+						'rounding', lines.rounding)
+					ORDER BY lines.id)
+			FROM transactions JOIN lines ON lines.transaction_id = transactions.id
+			GROUP BY transactions.id
+			ORDER BY transactions.timestamp, transactions.id`
+	txnRows, err := tx.Query(q)
+	if err != nil {
+		log.Println("Error executing export transactions query:", err)
+		return DBError(err)
+	}
+	defer txnRows.Close()
+	for txnRows.Next() {
+		transaction := &Transaction{}
+		var timestamp time.Time
+		var rawData, rawLines []byte
+		if err := txnRows.Scan(&transaction.ID, &timestamp, &rawData, &transaction.Reverses, &rawLines); err != nil {
+			return DBError(err)
+		}
+		transaction.Timestamp = timestamp.Format(LedgerTimestampLayout)
+		if err := json.Unmarshal(rawData, &transaction.Data); err != nil {
+			return JSONError(err)
+		}
+		if err := json.Unmarshal(rawLines, &transaction.Lines); err != nil {
+			return JSONError(err)
+		}
+		if err := writer.WriteTransaction(transaction); err != nil {
+			return DBError(err)
+		}
+	}
+	if err := txnRows.Err(); err != nil {
+		return DBError(err)
+	}
+	return nil
+}
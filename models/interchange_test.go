@@ -0,0 +1,92 @@
+package models
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestExport(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	writer, err := NewExportWriter(&buf, time.Date(2017, 6, 30, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err, "Error writing export header")
+	assert.Nil(t, writer.WriteAccount(&Account{ID: "alice", Data: map[string]interface{}{"type": "customer"}}))
+	assert.Nil(t, writer.WriteAccount(&Account{ID: "bob"}))
+	assert.Nil(t, writer.WriteTransaction(&Transaction{
+		ID:        "t001",
+		Timestamp: "2017-06-01 10:00:00.000",
+		Lines: []*TransactionLine{
+			{AccountID: "alice", Delta: -100, Currency: "USD"},
+			{AccountID: "bob", Delta: 100, Currency: "USD"},
+		},
+	}))
+	assert.Nil(t, writer.Close(), "Error writing export manifest")
+	return &buf
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	buf := writeTestExport(t)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 5, len(lines), "Invalid number of export lines")
+	assert.Equal(t, `{"type":"header","format":"qledger-export","version":1,"exported_at":"2017-06-30 00:00:00.000"}`, lines[0])
+	assert.Equal(t, `{"type":"account","id":"bob","data":{}}`, lines[2])
+
+	var records []*ExportRecord
+	err := ReadExport(bytes.NewReader(buf.Bytes()), func(record *ExportRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	assert.Nil(t, err, "Error reading export")
+	assert.Equal(t, 3, len(records), "Invalid number of export records")
+	assert.Equal(t, "customer", records[0].Data["type"], "Invalid account data")
+	assert.Equal(t, "USD", records[2].Lines[0].Currency, "Invalid line currency")
+}
+
+func TestExportWriterMetadataScope(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewExportWriter(&buf, time.Date(2017, 6, 30, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err, "Error writing export header")
+	writer.Metadata = &MetadataScope{Read: []string{"status"}}
+	assert.Nil(t, writer.WriteAccount(&Account{ID: "alice", Data: map[string]interface{}{"status": "open", "card_last_four": "4242"}}))
+	assert.Nil(t, writer.WriteTransaction(&Transaction{
+		ID:        "t001",
+		Timestamp: "2017-06-01 10:00:00.000",
+		Data:      map[string]interface{}{"card_last_four": "4242"},
+		Lines: []*TransactionLine{
+			{AccountID: "alice", Delta: -100},
+			{AccountID: "bob", Delta: 100},
+		},
+	}))
+	assert.Nil(t, writer.Close(), "Error writing export manifest")
+
+	var records []*ExportRecord
+	err = ReadExport(bytes.NewReader(buf.Bytes()), func(record *ExportRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	assert.Nil(t, err, "Filtered export should be verifiable")
+	if assert.Equal(t, 2, len(records), "Invalid number of export records") {
+		assert.Equal(t, map[string]interface{}{"status": "open"}, records[0].Data, "Unreadable account data should be left out")
+		assert.Equal(t, map[string]interface{}{}, records[1].Data, "Unreadable transaction data should be left out")
+	}
+}
+
+func TestReadExportVerification(t *testing.T) {
+	valid := writeTestExport(t).String()
+	lines := strings.Split(strings.TrimSpace(valid), "\n")
+
+	invalid := map[string]string{
+		"tampered record":  strings.Replace(valid, `"delta":100`, `"delta":1000`, 1),
+		"missing record":   strings.Join(append(append([]string{}, lines[:2]...), lines[3:]...), "\n"),
+		"missing manifest": strings.Join(lines[:4], "\n"),
+		"missing header":   strings.Join(lines[1:], "\n"),
+		"newer version":    strings.Replace(valid, `"version":1`, `"version":2`, 1),
+	}
+	for name, export := range invalid {
+		err := ReadExport(strings.NewReader(export), nil)
+		assert.NotNil(t, err, "Invalid export is accepted: "+name)
+	}
+}
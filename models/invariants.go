@@ -0,0 +1,142 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// Invariants of the ledger
+const (
+	// InvariantTransactionBalanced is violated by a transaction whose lines don't sum up to zero in a currency
+	InvariantTransactionBalanced = "transaction_balanced"
+	// InvariantRollupBalance is violated by a rolled up balance which doesn't match the lines it covers
+	InvariantRollupBalance = "rollup_balance"
+)
+
+// InvariantViolation represents a violation of an invariant by a transaction or the balance of an account,
+// with the expected and actual sums in the currency
+type InvariantViolation struct {
+	Invariant     string `json:"invariant"`
+	TransactionID string `json:"transaction,omitempty"`
+	AccountID     string `json:"account,omitempty"`
+	Currency      string `json:"currency"`
+	Expected      int64  `json:"expected"`
+	Actual        int64  `json:"actual"`
+}
+
+// InvariantDB provides the checks of the invariants of the ledger
+type InvariantDB struct {
+	db *sql.DB
+}
+
+// NewInvariantDB provides instance of `InvariantDB`
+func NewInvariantDB(db *sql.DB) InvariantDB {
+	return InvariantDB{db: db}
+}
+
+// TransactionsAfter returns the IDs of the transactions posted after the sequence in their order,
+// along with the sequence of the last one, or the given sequence when there are none
+func (i *InvariantDB) TransactionsAfter(sequence int64, limit int) ([]string, int64, ledgerError.ApplicationError) {
+	rows, err := i.db.Query("SELECT id, sequence FROM transactions WHERE sequence > $1 ORDER BY sequence LIMIT $2", sequence, limit)
+	if err != nil {
+		log.Println("Error executing transactions after sequence query:", err)
+		return nil, sequence, DBError(err)
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id, &sequence); err != nil {
+			return nil, sequence, DBError(err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, sequence, DBError(err)
+	}
+	return ids, sequence, nil
+}
+
+// LatestSequence returns the sequence of the latest transaction
+func (i *InvariantDB) LatestSequence() (int64, ledgerError.ApplicationError) {
+	var sequence int64
+	if err := i.db.QueryRow("SELECT COALESCE(MAX(sequence), 0) FROM transactions").Scan(&sequence); err != nil {
+		return 0, DBError(err)
+	}
+	return sequence, nil
+}
+
+// CheckTransactions returns the violations of the transactions whose lines don't sum up to zero,
+// along with the accounts of all the transactions
+func (i *InvariantDB) CheckTransactions(ids []string) ([]*InvariantViolation, []string, ledgerError.ApplicationError) {
+	rows, err := i.db.Query(`SELECT transaction_id, currency, SUM(delta) FROM lines
+		WHERE transaction_id = ANY($1)
+		GROUP BY transaction_id, currency
+		HAVING SUM(delta) <> 0
+		ORDER BY transaction_id, currency`, pq.Array(ids))
+	if err != nil {
+		log.Println("Error executing transaction invariant query:", err)
+		return nil, nil, DBError(err)
+	}
+	defer rows.Close()
+	var violations []*InvariantViolation
+	for rows.Next() {
+		violation := &InvariantViolation{Invariant: InvariantTransactionBalanced}
+		if err := rows.Scan(&violation.TransactionID, &violation.Currency, &violation.Actual); err != nil {
+			return nil, nil, DBError(err)
+		}
+		violations = append(violations, violation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, DBError(err)
+	}
+
+	var accounts []string
+	err = i.db.QueryRow("SELECT COALESCE(array_agg(DISTINCT account_id), '{}') FROM lines WHERE transaction_id = ANY($1)",
+		pq.Array(ids)).Scan(pq.Array(&accounts))
+	if err != nil {
+		log.Println("Error executing accounts of transactions query:", err)
+		return nil, nil, DBError(err)
+	}
+	return violations, accounts, nil
+}
+
+// CheckRollupBalances returns the violations of the balances of the accounts in the latest rollup,
+// which don't match the sums of the lines covered by the rollup
+func (i *InvariantDB) CheckRollupBalances(accounts []string) ([]*InvariantViolation, ledgerError.ApplicationError) {
+	rows, err := i.db.Query(`WITH rollup AS (
+			SELECT as_of, sequence FROM balance_rollups ORDER BY as_of DESC LIMIT 1
+		)
+		SELECT account_id, currency, SUM(rolled_up), SUM(delta) FROM (
+			SELECT s.account_id, s.currency, s.balance AS rolled_up, 0 AS delta
+			FROM account_balance_snapshots s JOIN rollup r ON s.as_of = r.as_of
+			WHERE s.account_id = ANY($1)
+			UNION ALL
+			SELECT l.account_id, l.currency, 0 AS rolled_up, l.delta
+			FROM lines l JOIN transactions t ON t.id = l.transaction_id JOIN rollup r ON true
+			WHERE l.account_id = ANY($1) AND l.id <= r.sequence AND t.timestamp <= r.as_of
+		) balances
+		GROUP BY account_id, currency
+		HAVING SUM(rolled_up) <> SUM(delta)
+		ORDER BY account_id, currency`, pq.Array(accounts))
+	if err != nil {
+		log.Println("Error executing rollup invariant query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	var violations []*InvariantViolation
+	for rows.Next() {
+		violation := &InvariantViolation{Invariant: InvariantRollupBalance}
+		if err := rows.Scan(&violation.AccountID, &violation.Currency, &violation.Actual, &violation.Expected); err != nil {
+			return nil, DBError(err)
+		}
+		violations = append(violations, violation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return violations, nil
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"sort"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type InvariantSuite struct {
+	suite.Suite
+	db *sql.DB
+}
+
+func (is *InvariantSuite) SetupSuite() {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(is.T(), databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	} else {
+		log.Println("Successfully established connection to database.")
+		is.db = db
+	}
+}
+
+func (is *InvariantSuite) TestCheckTransactions() {
+	t := is.T()
+	invariantDB := NewInvariantDB(is.db)
+	latest, aerr := invariantDB.LatestSequence()
+	assert.Nil(t, aerr, "Error while getting latest sequence")
+
+	transactionDB := NewTransactionDB(is.db)
+	for _, id := range []string{"invariant1", "invariant2"} {
+		txn := &Transaction{
+			ID:        id,
+			Timestamp: "2017-01-01 13:00:00.000",
+			Lines: []*TransactionLine{
+				{AccountID: "invariant_alice", Delta: -100, Currency: "USD"},
+				{AccountID: "invariant_bob", Delta: 100, Currency: "USD"},
+			},
+		}
+		assert.True(t, transactionDB.Transact(txn), "Error while posting transaction")
+	}
+
+	ids, sequence, aerr := invariantDB.TransactionsAfter(latest, 10)
+	assert.Nil(t, aerr, "Error while getting transactions after sequence")
+	assert.Equal(t, []string{"invariant1", "invariant2"}, ids, "Invalid transactions after sequence")
+	assert.True(t, sequence > latest, "Sequence should be of the last transaction")
+
+	violations, accounts, aerr := invariantDB.CheckTransactions(ids)
+	assert.Nil(t, aerr, "Error while checking transactions")
+	assert.Empty(t, violations, "Balanced transactions should not violate invariants")
+	sort.Strings(accounts)
+	assert.Equal(t, []string{"invariant_alice", "invariant_bob"}, accounts, "Invalid accounts of transactions")
+
+	// A line written around the posting unbalances the transaction
+	_, err := is.db.Exec(`INSERT INTO lines (transaction_id, account_id, delta, currency)
+		VALUES ('invariant2', 'invariant_bob', 5, 'USD')`)
+	assert.Nil(t, err, "Error while inserting unbalanced line")
+	violations, _, aerr = invariantDB.CheckTransactions(ids)
+	assert.Nil(t, aerr, "Error while checking transactions")
+	if assert.Equal(t, 1, len(violations), "Invalid count of violations") {
+		assert.Equal(t, InvariantTransactionBalanced, violations[0].Invariant, "Invalid invariant")
+		assert.Equal(t, "invariant2", violations[0].TransactionID, "Invalid transaction of violation")
+		assert.Equal(t, "USD", violations[0].Currency, "Invalid currency of violation")
+		assert.Equal(t, int64(5), violations[0].Actual, "Invalid actual sum of violation")
+	}
+
+}
+
+func (is *InvariantSuite) TearDownSuite() {
+	t := is.T()
+	for _, q := range []string{
+		"DELETE FROM lines WHERE transaction_id LIKE 'invariant%'",
+		"DELETE FROM transactions WHERE id LIKE 'invariant%'",
+		"DELETE FROM accounts WHERE id LIKE 'invariant%'",
+	} {
+		if _, err := is.db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestInvariantSuite(t *testing.T) {
+	suite.Run(t, new(InvariantSuite))
+}
@@ -0,0 +1,267 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// APIKeyPrefix is the prefix of the API keys, which tells them apart from the auth token
+const APIKeyPrefix = "qlk_"
+
+// Ledger represents the ledger of a tenant, which is isolated from the ledgers of the other tenants
+type Ledger struct {
+	ID        string                 `json:"id"`
+	Data      map[string]interface{} `json:"data"`
+	CreatedAt string                 `json:"created_at,omitempty"`
+}
+
+// APIKey represents a key authenticating the requests to a single ledger.
+// The key itself is only returned when it is created, and only its hash is stored.
+type APIKey struct {
+	ID        string `json:"id"`
+	LedgerID  string `json:"ledger"`
+	Key       string `json:"key,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+	RevokedAt string `json:"revoked_at,omitempty"`
+	// Metadata restricts the data keys which the key can read and write, if given
+	Metadata *MetadataScope `json:"metadata,omitempty"`
+}
+
+// LedgerTemplate is the set of default accounts which are created along with a new ledger
+type LedgerTemplate struct {
+	Accounts []*Account `json:"accounts"`
+}
+
+var validTemplateDataKey = regexp.MustCompile(`^[a-z_A-Z]+$`)
+
+// Validate checks whether the accounts of the template have unique IDs and valid data keys
+func (t *LedgerTemplate) Validate() error {
+	ids := make(map[string]bool)
+	for _, account := range t.Accounts {
+		if account == nil || account.ID == "" {
+			return errors.New("Account without ID")
+		}
+		if ids[account.ID] {
+			return fmt.Errorf("Duplicate account: %v", account.ID)
+		}
+		ids[account.ID] = true
+		for key := range account.Data {
+			if !validTemplateDataKey.MatchString(key) {
+				return fmt.Errorf("Invalid key in data of account %v: %v", account.ID, key)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseLedgerTemplates parses the ledger templates by their names, such as from a file
+func ParseLedgerTemplates(data []byte) (map[string]*LedgerTemplate, error) {
+	templates := make(map[string]*LedgerTemplate)
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, err
+	}
+	for name, template := range templates {
+		if template == nil {
+			return nil, fmt.Errorf("Empty ledger template: %v", name)
+		}
+		if err := template.Validate(); err != nil {
+			return nil, fmt.Errorf("Invalid ledger template %v: %v", name, err)
+		}
+	}
+	return templates, nil
+}
+
+// LedgerDB provides all functions related to the ledgers and their API keys,
+// which are kept in the database shared by the tenants
+type LedgerDB struct {
+	db *sql.DB
+}
+
+// NewLedgerDB provides instance of `LedgerDB`
+func NewLedgerDB(db *sql.DB) LedgerDB {
+	return LedgerDB{db: db}
+}
+
+// Create adds a ledger
+func (l *LedgerDB) Create(ledger *Ledger) ledgerError.ApplicationError {
+	data, err := json.Marshal(nonNilData(ledger.Data))
+	if err != nil {
+		return JSONError(err)
+	}
+	now := time.Now().UTC()
+	_, err = l.db.Exec("INSERT INTO ledgers (id, data, created_at) VALUES ($1, $2, $3)", ledger.ID, string(data), now)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return LedgerExistsError(ledger.ID)
+		}
+		return DBError(err)
+	}
+	ledger.CreatedAt = now.Format(LedgerTimestampLayout)
+	return nil
+}
+
+// Delete removes a ledger without API keys, such as when it couldn't be set up
+func (l *LedgerDB) Delete(id string) ledgerError.ApplicationError {
+	_, err := l.db.Exec("DELETE FROM ledgers WHERE id = $1", id)
+	if err != nil {
+		return DBError(err)
+	}
+	return nil
+}
+
+// Exists says whether the ledger of a tenant exists
+func (l *LedgerDB) Exists(id string) (bool, ledgerError.ApplicationError) {
+	var exists bool
+	err := l.db.QueryRow("SELECT EXISTS (SELECT 1 FROM ledgers WHERE id = $1)", id).Scan(&exists)
+	if err != nil {
+		log.Println("Error executing ledger query:", err)
+		return false, DBError(err)
+	}
+	return exists, nil
+}
+
+// List returns all the ledgers ordered by ID
+func (l *LedgerDB) List() ([]*Ledger, ledgerError.ApplicationError) {
+	rows, err := l.db.Query("SELECT id, data, created_at FROM ledgers ORDER BY id")
+	if err != nil {
+		log.Println("Error executing ledgers query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	ledgers := make([]*Ledger, 0)
+	for rows.Next() {
+		ledger := &Ledger{}
+		var rawData []byte
+		var createdAt time.Time
+		if err := rows.Scan(&ledger.ID, &rawData, &createdAt); err != nil {
+			return nil, DBError(err)
+		}
+		if err := json.Unmarshal(rawData, &ledger.Data); err != nil {
+			return nil, JSONError(err)
+		}
+		ledger.CreatedAt = createdAt.Format(LedgerTimestampLayout)
+		ledgers = append(ledgers, ledger)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return ledgers, nil
+}
+
+// hashAPIKey returns the stored hash of an API key
+func hashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// CreateKey generates an API key scoped to the ledger, and to the metadata keys if given
+func (l *LedgerDB) CreateKey(ledgerID string, metadata *MetadataScope) (*APIKey, ledgerError.ApplicationError) {
+	id := make([]byte, 8)
+	secret := make([]byte, 24)
+	if _, err := rand.Read(id); err != nil {
+		return nil, DBError(err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, DBError(err)
+	}
+	key := &APIKey{
+		ID:       hex.EncodeToString(id),
+		LedgerID: ledgerID,
+		Key:      APIKeyPrefix + hex.EncodeToString(secret),
+	}
+	var read, write []string
+	if metadata.IsRestricted() {
+		key.Metadata = metadata
+		read, write = metadata.Read, metadata.Write
+	}
+	now := time.Now().UTC()
+	_, err := l.db.Exec(`INSERT INTO api_keys (id, ledger_id, key_hash, created_at, metadata_read, metadata_write)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		key.ID, ledgerID, hashAPIKey(key.Key), now, pq.Array(read), pq.Array(write))
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "foreign_key_violation" {
+			return nil, LedgerNotFoundError(ledgerID)
+		}
+		return nil, DBError(err)
+	}
+	key.CreatedAt = now.Format(LedgerTimestampLayout)
+	return key, nil
+}
+
+// RevokeKey revokes an API key. It returns false if there is no such active key.
+func (l *LedgerDB) RevokeKey(id string) (bool, ledgerError.ApplicationError) {
+	result, err := l.db.Exec("UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL", time.Now().UTC(), id)
+	if err != nil {
+		return false, DBError(err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, DBError(err)
+	}
+	return count > 0, nil
+}
+
+// ListKeys returns the API keys of the ledger ordered by ID, without the keys themselves
+func (l *LedgerDB) ListKeys(ledgerID string) ([]*APIKey, ledgerError.ApplicationError) {
+	rows, err := l.db.Query(`SELECT id, ledger_id, created_at, revoked_at, metadata_read, metadata_write
+		FROM api_keys WHERE ledger_id = $1 ORDER BY id`, ledgerID)
+	if err != nil {
+		log.Println("Error executing API keys query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	keys := make([]*APIKey, 0)
+	for rows.Next() {
+		key := &APIKey{}
+		var createdAt time.Time
+		var revokedAt pq.NullTime
+		metadata := &MetadataScope{}
+		if err := rows.Scan(&key.ID, &key.LedgerID, &createdAt, &revokedAt,
+			pq.Array(&metadata.Read), pq.Array(&metadata.Write)); err != nil {
+			return nil, DBError(err)
+		}
+		if metadata.IsRestricted() {
+			key.Metadata = metadata
+		}
+		key.CreatedAt = createdAt.Format(LedgerTimestampLayout)
+		if revokedAt.Valid {
+			key.RevokedAt = revokedAt.Time.Format(LedgerTimestampLayout)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return keys, nil
+}
+
+// ResolveKey returns the API key with the ledger it is scoped to and its metadata scope if any,
+// or nil if the key doesn't exist or is revoked. The key itself isn't returned.
+func (l *LedgerDB) ResolveKey(key string) (*APIKey, error) {
+	resolved := &APIKey{}
+	metadata := &MetadataScope{}
+	err := l.db.QueryRow("SELECT id, ledger_id, metadata_read, metadata_write FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL",
+		hashAPIKey(key)).Scan(&resolved.ID, &resolved.LedgerID, pq.Array(&metadata.Read), pq.Array(&metadata.Write))
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Println("Error executing API key query:", err)
+		return nil, err
+	}
+	if metadata.IsRestricted() {
+		resolved.Metadata = metadata
+	}
+	return resolved, nil
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LedgersSuite struct {
+	suite.Suite
+	db *sql.DB
+}
+
+func (ls *LedgersSuite) SetupTest() {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(ls.T(), databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	} else {
+		log.Println("Successfully established connection to database.")
+		ls.db = db
+	}
+}
+
+func (ls *LedgersSuite) TestAPIKeys() {
+	t := ls.T()
+	ledgerDB := NewLedgerDB(ls.db)
+
+	aerr := ledgerDB.Create(&Ledger{ID: "ledgers_test", Data: map[string]interface{}{"product": "billing"}})
+	assert.Nil(t, aerr, "Error while creating ledger")
+	aerr = ledgerDB.Create(&Ledger{ID: "ledgers_test"})
+	if assert.NotNil(t, aerr, "Duplicate ledger should fail") {
+		assert.Equal(t, "ledger.exists", aerr.ErrorCode(), "Invalid error code")
+	}
+	exists, aerr := ledgerDB.Exists("ledgers_test")
+	assert.Nil(t, aerr, "Error while checking ledger")
+	assert.True(t, exists, "Ledger should exist")
+	exists, aerr = ledgerDB.Exists("ledgers_test_missing")
+	assert.Nil(t, aerr, "Error while checking ledger")
+	assert.False(t, exists, "Ledger should not exist")
+
+	key, aerr := ledgerDB.CreateKey("ledgers_test", nil)
+	assert.Nil(t, aerr, "Error while creating API key")
+	assert.True(t, strings.HasPrefix(key.Key, APIKeyPrefix), "Invalid API key prefix")
+	_, aerr = ledgerDB.CreateKey("ledgers_test_missing", nil)
+	if assert.NotNil(t, aerr, "API key of missing ledger should fail") {
+		assert.Equal(t, "ledger.notfound", aerr.ErrorCode(), "Invalid error code")
+	}
+
+	resolved, err := ledgerDB.ResolveKey(key.Key)
+	assert.Nil(t, err, "Error while resolving API key")
+	if assert.NotNil(t, resolved, "API key should resolve") {
+		assert.Equal(t, key.ID, resolved.ID, "Invalid ID of API key")
+		assert.Equal(t, "ledgers_test", resolved.LedgerID, "Invalid ledger of API key")
+		assert.Nil(t, resolved.Metadata, "API key without metadata scope should not be restricted")
+	}
+	resolved, err = ledgerDB.ResolveKey(APIKeyPrefix + "unknown")
+	assert.Nil(t, err, "Error while resolving API key")
+	assert.Nil(t, resolved, "Unknown API key should not resolve")
+
+	// The metadata scope of a key can allow reading but not writing any keys
+	scope := &MetadataScope{Read: []string{"order_id"}, Write: []string{}}
+	scopedKey, aerr := ledgerDB.CreateKey("ledgers_test", scope)
+	assert.Nil(t, aerr, "Error while creating scoped API key")
+	resolved, err = ledgerDB.ResolveKey(scopedKey.Key)
+	assert.Nil(t, err, "Error while resolving API key")
+	if assert.NotNil(t, resolved, "Scoped API key should resolve") {
+		assert.Equal(t, scope, resolved.Metadata, "Invalid metadata scope of API key")
+	}
+
+	keys, aerr := ledgerDB.ListKeys("ledgers_test")
+	assert.Nil(t, aerr, "Error while listing API keys")
+	if assert.Equal(t, 2, len(keys), "Invalid count of API keys") {
+		for _, listed := range keys {
+			assert.Equal(t, "", listed.Key, "API key should not be listed")
+			if listed.ID == scopedKey.ID {
+				assert.Equal(t, scope, listed.Metadata, "Invalid metadata scope of listed API key")
+			} else {
+				assert.Equal(t, key.ID, listed.ID, "Invalid API key")
+				assert.Nil(t, listed.Metadata, "API key should not have metadata scope")
+			}
+		}
+	}
+
+	revoked, aerr := ledgerDB.RevokeKey(key.ID)
+	assert.Nil(t, aerr, "Error while revoking API key")
+	assert.True(t, revoked, "API key should be revoked")
+	revoked, _ = ledgerDB.RevokeKey(key.ID)
+	assert.False(t, revoked, "Revoked API key should not be revoked again")
+	resolved, _ = ledgerDB.ResolveKey(key.Key)
+	assert.Nil(t, resolved, "Revoked API key should not resolve")
+}
+
+func (ls *LedgersSuite) TearDownSuite() {
+	_, err := ls.db.Exec("DELETE FROM api_keys WHERE ledger_id = $1", "ledgers_test")
+	if err != nil {
+		ls.T().Fatal(err)
+	}
+	_, err = ls.db.Exec("DELETE FROM ledgers WHERE id = $1", "ledgers_test")
+	if err != nil {
+		ls.T().Fatal(err)
+	}
+}
+
+func TestLedgersSuite(t *testing.T) {
+	suite.Run(t, new(LedgersSuite))
+}
+
+func TestParseLedgerTemplates(t *testing.T) {
+	templates, err := ParseLedgerTemplates([]byte(`{
+		"marketplace": {"accounts": [{"id": "fees"}, {"id": "payouts", "data": {"kind": "payable"}}]},
+		"empty": {"accounts": []}
+	}`))
+	assert.Nil(t, err, "Error parsing ledger templates")
+	assert.Equal(t, 2, len(templates["marketplace"].Accounts), "Invalid template accounts")
+	assert.Equal(t, "payable", templates["marketplace"].Accounts[1].Data["kind"], "Invalid template account data")
+
+	for _, invalid := range []string{
+		`{"marketplace": {"accounts": [{"id": ""}]}}`,
+		`{"marketplace": {"accounts": [{"id": "fees"}, {"id": "fees"}]}}`,
+		`{"marketplace": {"accounts": [{"id": "fees", "data": {"fee-rate": 2}}]}}`,
+		`{"marketplace": null}`,
+		`[]`,
+	} {
+		_, err := ParseLedgerTemplates([]byte(invalid))
+		assert.NotNil(t, err, "Templates should be invalid: %v", invalid)
+	}
+}
@@ -0,0 +1,251 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// Line represents a transaction line along with its reconciliation status
+type Line struct {
+	ID            int64  `json:"id"`
+	TransactionID string `json:"transaction_id"`
+	AccountID     string `json:"account"`
+	Delta         int    `json:"delta"`
+	Currency      string `json:"currency,omitempty"`
+	Rounding      string `json:"rounding,omitempty"`
+	Timestamp     string `json:"timestamp"`
+	StatementRef  string `json:"statement_ref,omitempty"`
+	ReconciledAt  string `json:"reconciled_at,omitempty"`
+	// Data of the transaction, set on the exported lines
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// LineExportFilter represents the filters of the exported lines
+type LineExportFilter struct {
+	AccountID string
+	// From and To are the inclusive bounds of the transaction timestamps
+	From *time.Time
+	To   *time.Time
+	// Data has the values of the transaction data keys, compared as text
+	Data map[string]string
+}
+
+// lineExportFetchSize is the number of lines fetched from the export cursor at a time
+const lineExportFetchSize = 1000
+
+// LineDB provides all functions related to transaction lines
+type LineDB struct {
+	db *sql.DB
+}
+
+// NewLineDB provides instance of `LineDB`
+func NewLineDB(db *sql.DB) LineDB {
+	return LineDB{db: db}
+}
+
+// GetLines returns the lines of the account in chronological order.
+// The lines are filtered by their reconciliation status unless `reconciled` is nil.
+func (l *LineDB) GetLines(accountID string, reconciled *bool) ([]*Line, ledgerError.ApplicationError) {
+	q := `SELECT lines.id, lines.transaction_id, lines.account_id, lines.delta, lines.currency,
+				COALESCE(lines.rounding, ''), transactions.timestamp, lines.statement_ref, lines.reconciled_at
+			FROM lines JOIN transactions ON lines.transaction_id = transactions.id
+			WHERE lines.account_id = $1`
+	if reconciled != nil {
+		if *reconciled {
+			q += " AND lines.reconciled_at IS NOT NULL"
+		} else {
+			q += " AND lines.reconciled_at IS NULL"
+		}
+	}
+	q += " ORDER BY transactions.timestamp, lines.id"
+
+	rows, err := l.db.Query(q, accountID)
+	if err != nil {
+		log.Println("Error executing lines query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+
+	lines := make([]*Line, 0)
+	for rows.Next() {
+		line := &Line{}
+		var timestamp time.Time
+		var statementRef sql.NullString
+		var reconciledAt pq.NullTime
+		err := rows.Scan(&line.ID, &line.TransactionID, &line.AccountID, &line.Delta, &line.Currency, &line.Rounding,
+			&timestamp, &statementRef, &reconciledAt)
+		if err != nil {
+			log.Println("Error scanning lines:", err)
+			return nil, DBError(err)
+		}
+		line.Timestamp = timestamp.Format(LedgerTimestampLayout)
+		line.StatementRef = statementRef.String
+		if reconciledAt.Valid {
+			line.ReconciledAt = reconciledAt.Time.Format(LedgerTimestampLayout)
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating lines rows:", err)
+		return nil, DBError(err)
+	}
+	return lines, nil
+}
+
+// Reconcile marks the lines as reconciled against the external statement.
+// Either all the lines are marked or none, when any of them doesn't exist or is already reconciled.
+func (l *LineDB) Reconcile(statementRef string, ids []int64) ledgerError.ApplicationError {
+	tx, err := l.db.Begin()
+	if err != nil {
+		log.Println("Error beginning reconciliation:", err)
+		return DBError(err)
+	}
+	defer tx.Rollback()
+
+	// Lock the lines to avoid concurrent reconciliations
+	rows, err := tx.Query("SELECT id, reconciled_at IS NOT NULL FROM lines WHERE id = ANY($1) FOR UPDATE", pq.Array(ids))
+	if err != nil {
+		log.Println("Error executing lines query:", err)
+		return DBError(err)
+	}
+	found := make(map[int64]bool)
+	var reconciled []int64
+	for rows.Next() {
+		var id int64
+		var isReconciled bool
+		if err := rows.Scan(&id, &isReconciled); err != nil {
+			rows.Close()
+			return DBError(err)
+		}
+		found[id] = true
+		if isReconciled {
+			reconciled = append(reconciled, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return DBError(err)
+	}
+
+	var missing []int64
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return LinesNotFoundError(missing)
+	}
+	if len(reconciled) > 0 {
+		sort.Slice(reconciled, func(i, j int) bool { return reconciled[i] < reconciled[j] })
+		return LinesReconciledError(reconciled)
+	}
+
+	q := "UPDATE lines SET statement_ref = $1, reconciled_at = $2 WHERE id = ANY($3)"
+	_, err = tx.Exec(q, statementRef, time.Now().UTC(), pq.Array(ids))
+	if err != nil {
+		return DBError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return DBError(err)
+	}
+	return nil
+}
+
+// IsTransactionReconciled says whether any line of the transaction is reconciled
+func (l *LineDB) IsTransactionReconciled(transactionID string) (bool, ledgerError.ApplicationError) {
+	var reconciled bool
+	q := "SELECT EXISTS (SELECT id FROM lines WHERE transaction_id = $1 AND reconciled_at IS NOT NULL)"
+	err := l.db.QueryRow(q, transactionID).Scan(&reconciled)
+	if err != nil {
+		log.Println("Error executing reconciled lines query:", err)
+		return false, DBError(err)
+	}
+	return reconciled, nil
+}
+
+// Export calls `fn` for each line matching the filter in chronological order, along with the data of
+// its transaction. The lines are fetched in batches from a cursor of the DB transaction, so the memory
+// used doesn't depend on the number of lines. The DB transaction should be a read transaction from `BeginRead`.
+func (l *LineDB) Export(tx *sql.Tx, filter *LineExportFilter, fn func(*Line) error) ledgerError.ApplicationError {
+	var conditions []string
+	var args []interface{}
+	if filter.AccountID != "" {
+		args = append(args, filter.AccountID)
+		conditions = append(conditions, fmt.Sprintf("lines.account_id = $%d", len(args)))
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		conditions = append(conditions, fmt.Sprintf("transactions.timestamp >= $%d", len(args)))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		conditions = append(conditions, fmt.Sprintf("transactions.timestamp <= $%d", len(args)))
+	}
+	keys := make([]string, 0, len(filter.Data))
+	for key := range filter.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, key, filter.Data[key])
+		conditions = append(conditions, fmt.Sprintf("transactions.data->>$%d = $%d", len(args)-1, len(args)))
+	}
+
+	q := `DECLARE lines_export NO SCROLL CURSOR FOR
+			SELECT lines.id, lines.transaction_id, lines.account_id, lines.delta, lines.currency,
+				COALESCE(lines.rounding, ''), transactions.timestamp, transactions.data
+			FROM lines JOIN transactions ON lines.transaction_id = transactions.id`
+	if len(conditions) > 0 {
+		q += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	q += " ORDER BY transactions.timestamp, lines.id"
+	if _, err := tx.Exec(q, args...); err != nil {
+		log.Println("Error declaring lines export cursor:", err)
+		return DBError(err)
+	}
+
+	for {
+		rows, err := tx.Query(fmt.Sprintf("FETCH %d FROM lines_export", lineExportFetchSize))
+		if err != nil {
+			log.Println("Error fetching exported lines:", err)
+			return DBError(err)
+		}
+		count := 0
+		for rows.Next() {
+			count++
+			line := &Line{}
+			var timestamp time.Time
+			var rawData []byte
+			if err := rows.Scan(&line.ID, &line.TransactionID, &line.AccountID, &line.Delta, &line.Currency,
+				&line.Rounding, &timestamp, &rawData); err != nil {
+				rows.Close()
+				return DBError(err)
+			}
+			line.Timestamp = timestamp.Format(LedgerTimestampLayout)
+			if err := json.Unmarshal(rawData, &line.Data); err != nil {
+				rows.Close()
+				return JSONError(err)
+			}
+			if err := fn(line); err != nil {
+				rows.Close()
+				return DBError(err)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return DBError(err)
+		}
+		if count < lineExportFetchSize {
+			return nil
+		}
+	}
+}
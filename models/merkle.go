@@ -0,0 +1,359 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// MerkleTree represents a Merkle tree over a range of committed transactions
+type MerkleTree struct {
+	ID        int64  `json:"id"`
+	Root      string `json:"root"`
+	Size      int    `json:"size"`
+	Sequence  int64  `json:"sequence"`
+	CreatedAt string `json:"created_at"`
+	// Anchor is the receipt of the external timestamping service for the root
+	Anchor     string `json:"anchor,omitempty"`
+	AnchoredAt string `json:"anchored_at,omitempty"`
+}
+
+// MerkleProof represents the inclusion proof of a transaction in a Merkle tree
+type MerkleProof struct {
+	TransactionID string      `json:"transaction_id"`
+	LeafHash      string      `json:"leaf_hash"`
+	LeafIndex     int         `json:"leaf_index"`
+	Path          []string    `json:"path"`
+	Tree          *MerkleTree `json:"tree"`
+}
+
+// The leaves and nodes are hashed with distinct prefixes as in RFC 6962,
+// so that a leaf can't be passed off as an interior node
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// MerkleLeafHash returns the hash of a leaf with the content
+func MerkleLeafHash(content []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write(content)
+	return h.Sum(nil)
+}
+
+func merkleNodeHash(left []byte, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// merkleSplit returns the largest power of two smaller than n
+func merkleSplit(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// MerkleRoot returns the root hash of the tree with the leaf hashes
+func MerkleRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		root := sha256.Sum256(nil)
+		return root[:]
+	case 1:
+		return leaves[0]
+	}
+	k := merkleSplit(len(leaves))
+	return merkleNodeHash(MerkleRoot(leaves[:k]), MerkleRoot(leaves[k:]))
+}
+
+// MerkleAuditPath returns the sibling hashes from the leaf at the index up to the root
+func MerkleAuditPath(leaves [][]byte, index int) [][]byte {
+	if len(leaves) <= 1 {
+		return [][]byte{}
+	}
+	k := merkleSplit(len(leaves))
+	if index < k {
+		return append(MerkleAuditPath(leaves[:k], index), MerkleRoot(leaves[k:]))
+	}
+	return append(MerkleAuditPath(leaves[k:], index-k), MerkleRoot(leaves[:k]))
+}
+
+// VerifyMerkleProof says whether the audit path proves the inclusion of the leaf
+// at the index of a tree with the size and root
+func VerifyMerkleProof(leaf []byte, index int, size int, path [][]byte, root []byte) bool {
+	if index < 0 || index >= size {
+		return false
+	}
+	fn, sn := index, size-1
+	hash := leaf
+	for _, sibling := range path {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			hash = merkleNodeHash(sibling, hash)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			hash = merkleNodeHash(hash, sibling)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(hash, root)
+}
+
+// MerkleDB provides all functions related to the Merkle trees of transactions
+type MerkleDB struct {
+	db *sql.DB
+}
+
+// NewMerkleDB returns a new instance of `MerkleDB`
+func NewMerkleDB(db *sql.DB) MerkleDB {
+	return MerkleDB{db: db}
+}
+
+// Build creates a tree over up to the limit of the transactions committed after the last tree,
+// in the order of their sequence. It returns nil if there are no such transactions.
+// As the sequence is assigned when the transactions are committed, one at a time, each tree
+// starts right after the sequence of the last tree.
+func (m *MerkleDB) Build(limit int) (*MerkleTree, ledgerError.ApplicationError) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return nil, DBError(err)
+	}
+	defer tx.Rollback()
+
+	// The trees are built one at a time
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('merkle_trees'))"); err != nil {
+		log.Println("Error locking merkle trees:", err)
+		return nil, DBError(err)
+	}
+	var last int64
+	if err := tx.QueryRow("SELECT COALESCE(MAX(sequence), 0) FROM merkle_trees").Scan(&last); err != nil {
+		log.Println("Error executing last merkle tree query:", err)
+		return nil, DBError(err)
+	}
+
+	rows, err := tx.Query(`WITH pending AS (
+			SELECT id, timestamp, data, sequence FROM transactions
+			WHERE sequence > $1
+			ORDER BY sequence
+			LIMIT $2
+		)
+		SELECT p.id, p.timestamp, p.data, p.sequence, l.account_id, l.delta, l.currency
+		FROM pending p LEFT JOIN lines l ON l.transaction_id = p.id
+		ORDER BY p.sequence, l.id`, last, limit)
+	if err != nil {
+		log.Println("Error executing pending merkle leaves query:", err)
+		return nil, DBError(err)
+	}
+	var sequence int64
+	var transactions []*Transaction
+	for rows.Next() {
+		var id string
+		var timestamp time.Time
+		var rawData []byte
+		var accountID, currency sql.NullString
+		var delta sql.NullInt64
+		if err := rows.Scan(&id, &timestamp, &rawData, &sequence, &accountID, &delta, &currency); err != nil {
+			rows.Close()
+			log.Println("Error scanning pending merkle leaves:", err)
+			return nil, DBError(err)
+		}
+		if len(transactions) == 0 || transactions[len(transactions)-1].ID != id {
+			txn := &Transaction{ID: id, Timestamp: timestamp.Format(LedgerTimestampLayout)}
+			if err := json.Unmarshal(rawData, &txn.Data); err != nil {
+				rows.Close()
+				return nil, JSONError(err)
+			}
+			transactions = append(transactions, txn)
+		}
+		if accountID.Valid {
+			txn := transactions[len(transactions)-1]
+			txn.Lines = append(txn.Lines, &TransactionLine{AccountID: accountID.String, Delta: int(delta.Int64), Currency: currency.String})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating pending merkle leaves rows:", err)
+		return nil, DBError(err)
+	}
+	if len(transactions) == 0 {
+		return nil, nil
+	}
+
+	leaves := make([][]byte, len(transactions))
+	for i, txn := range transactions {
+		content, err := txn.CanonicalContent()
+		if err != nil {
+			return nil, JSONError(err)
+		}
+		leaves[i] = MerkleLeafHash(content)
+	}
+
+	tree := &MerkleTree{Root: hex.EncodeToString(MerkleRoot(leaves)), Size: len(leaves)}
+	var createdAt time.Time
+	err = tx.QueryRow(`INSERT INTO merkle_trees (root, size, sequence, created_at)
+			VALUES ($1, $2, $3, now() AT TIME ZONE 'UTC')
+			RETURNING id, sequence, created_at`, tree.Root, tree.Size, sequence).Scan(&tree.ID, &tree.Sequence, &createdAt)
+	if err != nil {
+		log.Println("Error executing create merkle tree query:", err)
+		return nil, DBError(err)
+	}
+	tree.CreatedAt = createdAt.Format(LedgerTimestampLayout)
+	for i, txn := range transactions {
+		_, err := tx.Exec(`INSERT INTO merkle_leaves (transaction_id, tree_id, "position", hash) VALUES ($1, $2, $3, $4)`,
+			txn.ID, tree.ID, i, hex.EncodeToString(leaves[i]))
+		if err != nil {
+			log.Println("Error executing create merkle leaf query:", err)
+			return nil, DBError(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, DBError(err)
+	}
+	return tree, nil
+}
+
+func scanMerkleTree(scanner interface {
+	Scan(...interface{}) error
+}) (*MerkleTree, error) {
+	tree := &MerkleTree{}
+	var createdAt time.Time
+	var anchor sql.NullString
+	var anchoredAt pq.NullTime
+	if err := scanner.Scan(&tree.ID, &tree.Root, &tree.Size, &tree.Sequence, &createdAt, &anchor, &anchoredAt); err != nil {
+		return nil, err
+	}
+	tree.CreatedAt = createdAt.Format(LedgerTimestampLayout)
+	tree.Anchor = anchor.String
+	if anchoredAt.Valid {
+		tree.AnchoredAt = anchoredAt.Time.Format(LedgerTimestampLayout)
+	}
+	return tree, nil
+}
+
+const merkleTreeColumns = "id, root, size, sequence, created_at, anchor, anchored_at"
+
+// GetTree returns the tree with the ID, or nil if it doesn't exist
+func (m *MerkleDB) GetTree(id int64) (*MerkleTree, ledgerError.ApplicationError) {
+	tree, err := scanMerkleTree(m.db.QueryRow("SELECT "+merkleTreeColumns+" FROM merkle_trees WHERE id=$1", id))
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Println("Error executing merkle tree query:", err)
+		return nil, DBError(err)
+	}
+	return tree, nil
+}
+
+// List returns the trees, latest first
+func (m *MerkleDB) List() ([]*MerkleTree, ledgerError.ApplicationError) {
+	return m.queryTrees("SELECT " + merkleTreeColumns + " FROM merkle_trees ORDER BY id DESC")
+}
+
+// Unanchored returns the trees whose roots are not anchored yet, oldest first
+func (m *MerkleDB) Unanchored() ([]*MerkleTree, ledgerError.ApplicationError) {
+	return m.queryTrees("SELECT " + merkleTreeColumns + " FROM merkle_trees WHERE anchor IS NULL ORDER BY id")
+}
+
+func (m *MerkleDB) queryTrees(q string) ([]*MerkleTree, ledgerError.ApplicationError) {
+	rows, err := m.db.Query(q)
+	if err != nil {
+		log.Println("Error executing merkle trees query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	trees := make([]*MerkleTree, 0)
+	for rows.Next() {
+		tree, err := scanMerkleTree(rows)
+		if err != nil {
+			log.Println("Error scanning merkle trees:", err)
+			return nil, DBError(err)
+		}
+		trees = append(trees, tree)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating merkle trees rows:", err)
+		return nil, DBError(err)
+	}
+	return trees, nil
+}
+
+// SetAnchor records the receipt of the external timestamping service for the root of the tree
+func (m *MerkleDB) SetAnchor(id int64, anchor string) ledgerError.ApplicationError {
+	_, err := m.db.Exec("UPDATE merkle_trees SET anchor=$1, anchored_at=now() AT TIME ZONE 'UTC' WHERE id=$2", anchor, id)
+	if err != nil {
+		log.Println("Error executing merkle tree anchor query:", err)
+		return DBError(err)
+	}
+	return nil
+}
+
+// GetProof returns the inclusion proof of the transaction, or nil if it is not in any tree yet
+func (m *MerkleDB) GetProof(transactionID string) (*MerkleProof, ledgerError.ApplicationError) {
+	proof := &MerkleProof{TransactionID: transactionID}
+	var treeID int64
+	err := m.db.QueryRow(`SELECT tree_id, "position", hash FROM merkle_leaves WHERE transaction_id=$1`, transactionID).
+		Scan(&treeID, &proof.LeafIndex, &proof.LeafHash)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Println("Error executing merkle leaf query:", err)
+		return nil, DBError(err)
+	}
+	tree, aerr := m.GetTree(treeID)
+	if aerr != nil {
+		return nil, aerr
+	}
+	proof.Tree = tree
+
+	rows, err := m.db.Query(`SELECT hash FROM merkle_leaves WHERE tree_id=$1 ORDER BY "position"`, treeID)
+	if err != nil {
+		log.Println("Error executing merkle leaves query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	var leaves [][]byte
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			log.Println("Error scanning merkle leaves:", err)
+			return nil, DBError(err)
+		}
+		leaf, err := hex.DecodeString(hash)
+		if err != nil {
+			return nil, DBError(err)
+		}
+		leaves = append(leaves, leaf)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating merkle leaves rows:", err)
+		return nil, DBError(err)
+	}
+	for _, sibling := range MerkleAuditPath(leaves, proof.LeafIndex) {
+		proof.Path = append(proof.Path, hex.EncodeToString(sibling))
+	}
+	if proof.Path == nil {
+		proof.Path = []string{}
+	}
+	return proof, nil
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testMerkleLeaves(n int) [][]byte {
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		leaves[i] = MerkleLeafHash([]byte(fmt.Sprintf("t%03d", i)))
+	}
+	return leaves
+}
+
+func TestMerkleRoot(t *testing.T) {
+	empty := sha256.Sum256(nil)
+	assert.Equal(t, empty[:], MerkleRoot(nil), "Invalid root of empty tree")
+
+	leaves := testMerkleLeaves(3)
+	assert.Equal(t, leaves[0], MerkleRoot(leaves[:1]), "Root of single leaf tree should be the leaf")
+	expected := merkleNodeHash(merkleNodeHash(leaves[0], leaves[1]), leaves[2])
+	assert.Equal(t, expected, MerkleRoot(leaves), "Invalid root of unbalanced tree")
+
+	// RFC 6962 leaf hash of the empty content
+	assert.Equal(t, "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		hex.EncodeToString(MerkleLeafHash([]byte{})), "Invalid leaf hash")
+}
+
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 17; n++ {
+		leaves := testMerkleLeaves(n)
+		root := MerkleRoot(leaves)
+		for i := 0; i < n; i++ {
+			path := MerkleAuditPath(leaves, i)
+			assert.True(t, VerifyMerkleProof(leaves[i], i, n, path, root), fmt.Sprintf("Proof of leaf %v of %v should be valid", i, n))
+			if n > 1 {
+				other := (i + 1) % n
+				assert.False(t, VerifyMerkleProof(leaves[other], i, n, path, root), fmt.Sprintf("Proof of wrong leaf %v of %v should be invalid", i, n))
+			}
+		}
+	}
+	leaves := testMerkleLeaves(4)
+	assert.False(t, VerifyMerkleProof(leaves[0], 4, 4, nil, MerkleRoot(leaves)), "Proof of leaf outside the tree should be invalid")
+}
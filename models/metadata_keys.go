@@ -0,0 +1,164 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math/rand"
+	"sort"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// MetadataKeysSampleRows is the number of rows sampled to estimate the usage of the data keys,
+// so that the estimate doesn't scan the whole table of a large ledger
+const MetadataKeysSampleRows = 10000
+
+// metadataKeysTopValues is the number of most common values listed for every key
+const metadataKeysTopValues = 5
+
+// MetadataTables are the tables with the `data` whose keys are estimated, by the entity
+var MetadataTables = map[string]string{
+	"accounts":     "accounts",
+	"transactions": "transactions",
+}
+
+// MetadataValueUsage represents a common value of a data key along with its estimated count
+type MetadataValueUsage struct {
+	Value json.RawMessage `json:"value"`
+	Count int64           `json:"count"`
+}
+
+// MetadataKeyUsage represents the estimated usage of a top level key of the data
+type MetadataKeyUsage struct {
+	Key   string   `json:"key"`
+	Types []string `json:"types"`
+	Count int64    `json:"count"`
+	// DistinctValues is the number of distinct values within the sample
+	DistinctValues int64                `json:"distinct_values"`
+	TopValues      []MetadataValueUsage `json:"top_values"`
+}
+
+// MetadataKeysUsage represents the usage of the data keys of an entity, as estimated from a sample of its rows
+type MetadataKeysUsage struct {
+	Entity        string             `json:"entity"`
+	EstimatedRows int64              `json:"estimated_rows"`
+	SampledRows   int64              `json:"sampled_rows"`
+	SamplePercent float64            `json:"sample_percent"`
+	Keys          []MetadataKeyUsage `json:"keys"`
+}
+
+// MetadataKeysDB provides the usage of the data keys
+type MetadataKeysDB struct {
+	db *sql.DB
+}
+
+// NewMetadataKeysDB provides instance of `MetadataKeysDB`
+func NewMetadataKeysDB(db *sql.DB) MetadataKeysDB {
+	return MetadataKeysDB{db: db}
+}
+
+// metadataSamplePercent returns the percent of the rows to sample out of the estimated rows of a table.
+// The small tables and the tables which were never analyzed are read in full.
+func metadataSamplePercent(estimatedRows int64) float64 {
+	if estimatedRows <= MetadataKeysSampleRows {
+		return 100
+	}
+	return float64(MetadataKeysSampleRows) * 100 / float64(estimatedRows)
+}
+
+// Usage estimates the usage of the data keys of the entity from a sample of the pages of its table,
+// which neither locks the table nor scans it in full
+func (m *MetadataKeysDB) Usage(entity string) (*MetadataKeysUsage, ledgerError.ApplicationError) {
+	table, ok := MetadataTables[entity]
+	if !ok {
+		return nil, MetadataEntityInvalidError(entity)
+	}
+	usage := &MetadataKeysUsage{Entity: entity, Keys: []MetadataKeyUsage{}}
+	err := m.db.QueryRow("SELECT reltuples::bigint FROM pg_class WHERE oid = $1::regclass", table).
+		Scan(&usage.EstimatedRows)
+	if err != nil {
+		log.Println("Error executing table estimate query:", err)
+		return nil, DBError(err)
+	}
+	usage.SamplePercent = metadataSamplePercent(usage.EstimatedRows)
+	// The same seed samples the same pages in every query
+	seed := rand.Int31()
+	sample := "(SELECT data FROM " + table + " TABLESAMPLE SYSTEM ($1) REPEATABLE ($2)) sample"
+
+	err = m.db.QueryRow("SELECT COUNT(*) FROM "+sample, usage.SamplePercent, seed).Scan(&usage.SampledRows)
+	if err != nil {
+		log.Println("Error executing metadata sample query:", err)
+		return nil, DBError(err)
+	}
+	if usage.SampledRows == 0 {
+		return usage, nil
+	}
+	// The counts of the sample are scaled to the whole table
+	scale := 100 / usage.SamplePercent
+	estimate := func(count int64) int64 {
+		return int64(float64(count)*scale + 0.5)
+	}
+
+	rows, err := m.db.Query(`SELECT key, array_agg(DISTINCT jsonb_typeof(value)), COUNT(*), COUNT(DISTINCT value)
+		FROM `+sample+`, jsonb_each(CASE jsonb_typeof(sample.data) WHEN 'object' THEN sample.data END)
+		GROUP BY key`, usage.SamplePercent, seed)
+	if err != nil {
+		log.Println("Error executing metadata keys query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		key := MetadataKeyUsage{TopValues: []MetadataValueUsage{}}
+		var count int64
+		if err := rows.Scan(&key.Key, pq.Array(&key.Types), &count, &key.DistinctValues); err != nil {
+			return nil, DBError(err)
+		}
+		key.Count = estimate(count)
+		sort.Strings(key.Types)
+		usage.Keys = append(usage.Keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	keys := make(map[string]*MetadataKeyUsage)
+	for i := range usage.Keys {
+		keys[usage.Keys[i].Key] = &usage.Keys[i]
+	}
+
+	// The most common values are listed only for the scalar values
+	rows, err = m.db.Query(`SELECT key, value, count FROM (
+			SELECT key, value, COUNT(*) AS count,
+				ROW_NUMBER() OVER (PARTITION BY key ORDER BY COUNT(*) DESC, value::text) AS rank
+			FROM `+sample+`, jsonb_each(CASE jsonb_typeof(sample.data) WHEN 'object' THEN sample.data END)
+			WHERE jsonb_typeof(value) NOT IN ('object', 'array')
+			GROUP BY key, value
+		) top WHERE rank <= $3 ORDER BY key, rank`, usage.SamplePercent, seed, metadataKeysTopValues)
+	if err != nil {
+		log.Println("Error executing metadata values query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, value string
+		var count int64
+		if err := rows.Scan(&key, &value, &count); err != nil {
+			return nil, DBError(err)
+		}
+		if k, ok := keys[key]; ok {
+			k.TopValues = append(k.TopValues, MetadataValueUsage{Value: json.RawMessage(value), Count: estimate(count)})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+
+	sort.Slice(usage.Keys, func(i, j int) bool {
+		if usage.Keys[i].Count == usage.Keys[j].Count {
+			return usage.Keys[i].Key < usage.Keys[j].Key
+		}
+		return usage.Keys[i].Count > usage.Keys[j].Count
+	})
+	return usage, nil
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestMetadataSamplePercent(t *testing.T) {
+	assert.Equal(t, float64(100), metadataSamplePercent(-1), "Table never analyzed should be read in full")
+	assert.Equal(t, float64(100), metadataSamplePercent(MetadataKeysSampleRows), "Small table should be read in full")
+	assert.Equal(t, float64(10), metadataSamplePercent(10*MetadataKeysSampleRows), "Invalid sample percent")
+}
+
+type MetadataKeysSuite struct {
+	suite.Suite
+	db *sql.DB
+}
+
+func (ms *MetadataKeysSuite) SetupSuite() {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(ms.T(), databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	} else {
+		log.Println("Successfully established connection to database.")
+		ms.db = db
+	}
+}
+
+func (ms *MetadataKeysSuite) TestUsage() {
+	t := ms.T()
+	accountDB := NewAccountDB(ms.db)
+	for _, account := range []*Account{
+		{ID: "metadata_keys_1", Data: map[string]interface{}{"metadata_keys_tier": "gold", "metadata_keys_tags": []string{"a"}}},
+		{ID: "metadata_keys_2", Data: map[string]interface{}{"metadata_keys_tier": "gold"}},
+		{ID: "metadata_keys_3", Data: map[string]interface{}{"metadata_keys_tier": 3}},
+	} {
+		assert.Nil(t, accountDB.CreateAccount(account), "Error creating account")
+	}
+
+	metadataKeysDB := NewMetadataKeysDB(ms.db)
+	usage, aerr := metadataKeysDB.Usage("accounts")
+	assert.Nil(t, aerr, "Error estimating metadata keys")
+	// The test DB is small, so the estimate reads all the accounts
+	assert.Equal(t, float64(100), usage.SamplePercent, "Invalid sample percent")
+	found := 0
+	for _, key := range usage.Keys {
+		switch key.Key {
+		case "metadata_keys_tier":
+			found++
+			assert.Equal(t, []string{"number", "string"}, key.Types, "Invalid types")
+			assert.Equal(t, int64(3), key.Count, "Invalid count")
+			assert.Equal(t, int64(2), key.DistinctValues, "Invalid distinct values")
+			assert.Equal(t, []MetadataValueUsage{
+				{Value: json.RawMessage(`"gold"`), Count: 2},
+				{Value: json.RawMessage(`3`), Count: 1},
+			}, key.TopValues, "Invalid top values")
+		case "metadata_keys_tags":
+			found++
+			assert.Equal(t, []string{"array"}, key.Types, "Invalid types")
+			assert.Equal(t, []MetadataValueUsage{}, key.TopValues, "Arrays should not be listed as top values")
+		}
+	}
+	assert.Equal(t, 2, found, "Keys should be listed")
+
+	_, aerr = metadataKeysDB.Usage("lines")
+	if assert.NotNil(t, aerr, "Entity should be invalid") {
+		assert.Equal(t, "metadata.invalid_entity", aerr.ErrorCode(), "Invalid error code")
+	}
+}
+
+func (ms *MetadataKeysSuite) TearDownSuite() {
+	t := ms.T()
+	if _, err := ms.db.Exec("DELETE FROM accounts WHERE id LIKE 'metadata_keys_%'"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMetadataKeysSuite(t *testing.T) {
+	suite.Run(t, new(MetadataKeysSuite))
+}
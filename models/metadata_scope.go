@@ -0,0 +1,113 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+)
+
+var validMetadataKey = regexp.MustCompile(`^[a-z_A-Z]+$`)
+
+// MetadataScope restricts the keys of the `data` of the accounts and transactions which an API key
+// can read and write. A `null` list doesn't restrict the keys, while an empty list allows none.
+type MetadataScope struct {
+	Read  []string `json:"read"`
+	Write []string `json:"write"`
+}
+
+// Validate checks whether the keys of the scope are valid data keys
+func (s *MetadataScope) Validate() error {
+	for _, keys := range [][]string{s.Read, s.Write} {
+		for _, key := range keys {
+			if !validMetadataKey.MatchString(key) {
+				return errors.New("Invalid metadata key: " + key)
+			}
+		}
+	}
+	return nil
+}
+
+// IsRestricted says whether the scope restricts any keys, as a nil scope allows all the keys
+func (s *MetadataScope) IsRestricted() bool {
+	return s != nil && (s.Read != nil || s.Write != nil)
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRead says whether the key can be read within the scope
+func (s *MetadataScope) CanRead(key string) bool {
+	return s == nil || s.Read == nil || containsKey(s.Read, key)
+}
+
+// CanWrite says whether the key can be written within the scope
+func (s *MetadataScope) CanWrite(key string) bool {
+	return s == nil || s.Write == nil || containsKey(s.Write, key)
+}
+
+// UnwritableKey returns a key of the data which can't be written within the scope, if any
+func (s *MetadataScope) UnwritableKey(data map[string]interface{}) string {
+	for key := range data {
+		if !s.CanWrite(key) {
+			return key
+		}
+	}
+	return ""
+}
+
+// KeepUnwritable returns the updated data along with the keys of the existing data which can't be
+// written within the scope, so that an update can't remove them
+func (s *MetadataScope) KeepUnwritable(existing, updated map[string]interface{}) map[string]interface{} {
+	if s == nil || s.Write == nil {
+		return updated
+	}
+	for key, value := range existing {
+		if !s.CanWrite(key) {
+			if updated == nil {
+				updated = make(map[string]interface{})
+			}
+			updated[key] = value
+		}
+	}
+	return updated
+}
+
+// FilterData returns the data without the keys which can't be read within the scope
+func (s *MetadataScope) FilterData(data map[string]interface{}) map[string]interface{} {
+	if s == nil || s.Read == nil || data == nil {
+		return data
+	}
+	filtered := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		if s.CanRead(key) {
+			filtered[key] = value
+		}
+	}
+	return filtered
+}
+
+// FilterRawData is like `FilterData` for the data as JSON, and says whether any keys were filtered
+func (s *MetadataScope) FilterRawData(raw json.RawMessage) (json.RawMessage, bool, error) {
+	if s == nil || s.Read == nil || len(raw) == 0 {
+		return raw, false, nil
+	}
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, false, err
+	}
+	filtered := false
+	for key := range data {
+		if !s.CanRead(key) {
+			delete(data, key)
+			filtered = true
+		}
+	}
+	raw, err := json.Marshal(data)
+	return raw, filtered, err
+}
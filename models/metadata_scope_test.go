@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadataScope(t *testing.T) {
+	var unrestricted *MetadataScope
+	assert.False(t, unrestricted.IsRestricted(), "Nil scope should not be restricted")
+	assert.True(t, unrestricted.CanRead("card_last_four"), "Nil scope should read all keys")
+	assert.True(t, unrestricted.CanWrite("card_last_four"), "Nil scope should write all keys")
+	assert.False(t, (&MetadataScope{}).IsRestricted(), "Scope without lists should not be restricted")
+
+	support := &MetadataScope{Read: []string{"order_id", "status"}, Write: []string{"status"}}
+	assert.True(t, support.IsRestricted(), "Scope should be restricted")
+	assert.True(t, support.CanRead("order_id"), "Listed key should be readable")
+	assert.False(t, support.CanRead("card_last_four"), "Unlisted key should not be readable")
+	assert.False(t, support.CanWrite("order_id"), "Unlisted key should not be writable")
+	assert.True(t, (&MetadataScope{Read: []string{}}).CanWrite("order_id"), "Write should not be restricted without list")
+	assert.False(t, (&MetadataScope{Read: []string{}}).CanRead("order_id"), "Empty list should allow no keys")
+
+	assert.Equal(t, "", support.UnwritableKey(map[string]interface{}{"status": "open"}), "Data should be writable")
+	assert.Equal(t, "order_id", support.UnwritableKey(map[string]interface{}{"status": "open", "order_id": "o1"}),
+		"Unwritable key should be found")
+
+	data := map[string]interface{}{"order_id": "o1", "status": "open", "card_last_four": "4242"}
+	assert.Equal(t, map[string]interface{}{"order_id": "o1", "status": "open"}, support.FilterData(data),
+		"Unreadable keys should be filtered")
+	assert.Equal(t, data, unrestricted.FilterData(data), "Nil scope should not filter")
+
+	raw, filtered, err := support.FilterRawData(json.RawMessage(`{"order_id": "o1", "card_last_four": "4242", "amounts": [1, 2]}`))
+	assert.Nil(t, err, "Error while filtering raw data")
+	assert.True(t, filtered, "Raw data should be filtered")
+	assert.JSONEq(t, `{"order_id": "o1"}`, string(raw), "Unreadable keys should be filtered from raw data")
+	_, filtered, err = support.FilterRawData(json.RawMessage(`{"order_id": "o1"}`))
+	assert.Nil(t, err, "Error while filtering raw data")
+	assert.False(t, filtered, "Readable raw data should not be filtered")
+
+	// Updates leave the unwritable keys out, and keep them
+	assert.Equal(t, data, support.KeepUnwritable(data, map[string]interface{}{"status": "open"}),
+		"Unwritable keys should be kept")
+
+	assert.Nil(t, support.Validate(), "Scope should be valid")
+	assert.NotNil(t, (&MetadataScope{Read: []string{"card-last-four"}}).Validate(), "Scope should not be valid")
+}
+
+func TestSearchDataKeys(t *testing.T) {
+	rawQuery, aerr := NewSearchRawQuery(`{
+		"query": {
+			"must": {
+				"fields": [{"id": {"eq": "alice"}}],
+				"terms": [{"status": "open"}],
+				"ranges": [{"amount": {"gte": 10}}]
+			},
+			"should": {"terms": [{"card_last_four": "4242"}]}
+		}
+	}`)
+	assert.Nil(t, aerr, "Error while parsing search query")
+	keys := rawQuery.dataKeys()
+	sort.Strings(keys)
+	assert.Equal(t, []string{"amount", "card_last_four", "status"}, keys, "Invalid data keys of search query")
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// PostingHook represents an external URL called synchronously to approve every transaction before it is posted
+type PostingHook struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+	// TimeoutMS is the time to wait for the hook response in milliseconds
+	TimeoutMS int `json:"timeout_ms"`
+	// FailOpen posts the transactions while the hook is unavailable, instead of failing them
+	FailOpen  bool   `json:"fail_open"`
+	CreatedAt string `json:"created_at,omitempty"`
+	// Circuit is the state of the circuit breaker of the hook on this server
+	Circuit string `json:"circuit,omitempty"`
+}
+
+// PostingHookDB provides all functions related to posting hooks
+type PostingHookDB struct {
+	db *sql.DB
+}
+
+// NewPostingHookDB provides instance of `PostingHookDB`
+func NewPostingHookDB(db *sql.DB) PostingHookDB {
+	return PostingHookDB{db: db}
+}
+
+// Create adds a posting hook
+func (ph *PostingHookDB) Create(hook *PostingHook) ledgerError.ApplicationError {
+	_, err := ph.db.Exec("INSERT INTO posting_hooks (id, url, secret, timeout_ms, fail_open, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		hook.ID, hook.URL, hook.Secret, hook.TimeoutMS, hook.FailOpen, time.Now().UTC())
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return PostingHookExistsError(hook.ID)
+		}
+		return DBError(err)
+	}
+	return nil
+}
+
+// Delete removes a posting hook. It returns false if the hook doesn't exist.
+func (ph *PostingHookDB) Delete(id string) (bool, ledgerError.ApplicationError) {
+	result, err := ph.db.Exec("DELETE FROM posting_hooks WHERE id = $1", id)
+	if err != nil {
+		return false, DBError(err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, DBError(err)
+	}
+	return count > 0, nil
+}
+
+// List returns all the posting hooks ordered by ID, along with their secrets
+// which must be removed before they are exposed
+func (ph *PostingHookDB) List() ([]*PostingHook, ledgerError.ApplicationError) {
+	rows, err := ph.db.Query("SELECT id, url, secret, timeout_ms, fail_open, created_at FROM posting_hooks ORDER BY id")
+	if err != nil {
+		log.Println("Error executing posting hooks query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	hooks := make([]*PostingHook, 0)
+	for rows.Next() {
+		hook := &PostingHook{}
+		var createdAt time.Time
+		if err := rows.Scan(&hook.ID, &hook.URL, &hook.Secret, &hook.TimeoutMS, &hook.FailOpen, &createdAt); err != nil {
+			return nil, DBError(err)
+		}
+		hook.CreatedAt = createdAt.Format(LedgerTimestampLayout)
+		hooks = append(hooks, hook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return hooks, nil
+}
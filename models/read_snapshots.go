@@ -0,0 +1,65 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"regexp"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// validReadSnapshotID matches the snapshot identifiers exported by Postgres
+var validReadSnapshotID = regexp.MustCompile(`^[0-9A-F]+-[0-9A-F]+(-[0-9]+)?$`)
+
+// PinReadSnapshot begins a read-only repeatable read DB transaction and exports its snapshot.
+// The snapshot can be shared by other DB transactions, from any replica, as long as the returned
+// DB transaction is open.
+func PinReadSnapshot(db *sql.DB) (*sql.Tx, string, ledgerError.ApplicationError) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, "", DBError(err)
+	}
+	if _, err := tx.Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY"); err != nil {
+		tx.Rollback()
+		log.Println("Error setting read snapshot isolation:", err)
+		return nil, "", DBError(err)
+	}
+	var id string
+	if err := tx.QueryRow("SELECT pg_export_snapshot()").Scan(&id); err != nil {
+		tx.Rollback()
+		log.Println("Error exporting read snapshot:", err)
+		return nil, "", DBError(err)
+	}
+	return tx, id, nil
+}
+
+// BeginRead begins a read-only repeatable read DB transaction, so that all its queries see
+// the same data. It sees the data of the pinned read snapshot with the ID, if given.
+func BeginRead(db *sql.DB, snapshotID string) (*sql.Tx, ledgerError.ApplicationError) {
+	if snapshotID != "" && !validReadSnapshotID.MatchString(snapshotID) {
+		return nil, ReadSnapshotInvalidError(snapshotID)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, DBError(err)
+	}
+	if _, err := tx.Exec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY"); err != nil {
+		tx.Rollback()
+		log.Println("Error setting read isolation:", err)
+		return nil, DBError(err)
+	}
+	if snapshotID == "" {
+		return tx, nil
+	}
+	// The snapshot identifier can't be a query parameter, and is validated above
+	if _, err := tx.Exec("SET TRANSACTION SNAPSHOT '" + snapshotID + "'"); err != nil {
+		tx.Rollback()
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "invalid_parameter_value" {
+			return nil, ReadSnapshotExpiredError(snapshotID)
+		}
+		log.Println("Error setting read snapshot:", err)
+		return nil, DBError(err)
+	}
+	return tx, nil
+}
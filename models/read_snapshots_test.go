@@ -0,0 +1,18 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBeginReadInvalidSnapshot(t *testing.T) {
+	for _, id := range []string{"abc", "00000003-0000001B-1'; DROP TABLE lines; --", "3-1B-1-1"} {
+		tx, err := BeginRead(nil, id)
+		assert.Nil(t, tx, "Invalid snapshot should not begin a read")
+		if assert.NotNil(t, err, "Invalid snapshot should be an error") {
+			assert.Equal(t, "read_snapshot.invalid", err.ErrorCode(), "Invalid error code")
+		}
+	}
+	assert.True(t, validReadSnapshotID.MatchString("00000003-0000001B-1"), "Postgres snapshot ID should be valid")
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+)
+
+// ReplicationLag returns the time by which the DB lags behind its primary when it is a replica.
+// It is zero for a primary, and for a replica which has replayed all the changes it received.
+func ReplicationLag(db *sql.DB) (time.Duration, ledgerError.ApplicationError) {
+	var seconds float64
+	err := db.QueryRow(`SELECT CASE
+			WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+		END`).Scan(&seconds)
+	if err != nil {
+		log.Println("Error executing replication lag query:", err)
+		return 0, DBError(err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
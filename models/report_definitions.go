@@ -0,0 +1,514 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// ReportSchedules are the intervals at which scheduled reports are run
+var ReportSchedules = map[string]time.Duration{
+	"hourly": time.Hour,
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+// ReportFilter filters the lines of a report by comparing a field with a value
+type ReportFilter struct {
+	Field string      `json:"field"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+// ReportMetric aggregates the lines of each group of a report
+type ReportMetric struct {
+	Func  string `json:"func"`
+	Field string `json:"field,omitempty"`
+	As    string `json:"as"`
+}
+
+// ReportDelivery is where the results of a scheduled report are posted
+type ReportDelivery struct {
+	URL    string `json:"url"`
+	Format string `json:"format,omitempty"`
+}
+
+// ReportDefinition represents a custom report over the transaction lines
+type ReportDefinition struct {
+	ID       string          `json:"id"`
+	Filters  []ReportFilter  `json:"filters"`
+	GroupBy  []string        `json:"group_by"`
+	Metrics  []ReportMetric  `json:"metrics"`
+	Schedule string          `json:"schedule,omitempty"`
+	Delivery *ReportDelivery `json:"delivery,omitempty"`
+	// Materialize stores the result of the scheduled runs, which is returned instead of recomputing the report
+	Materialize bool   `json:"materialize,omitempty"`
+	LastRunAt   string `json:"last_run_at,omitempty"`
+}
+
+// ReportStaleness describes the age of a materialized report result
+type ReportStaleness struct {
+	MaterializedAt string `json:"materialized_at"`
+	AgeSeconds     int64  `json:"age_seconds"`
+	// Stale is set once the result is older than the schedule interval, i.e. a scheduled run was missed
+	Stale bool `json:"stale"`
+}
+
+// ReportResult represents the rows of a report run
+type ReportResult struct {
+	ReportID    string                   `json:"report"`
+	GeneratedAt string                   `json:"generated_at"`
+	Columns     []string                 `json:"columns"`
+	Rows        []map[string]interface{} `json:"rows"`
+	Staleness   *ReportStaleness         `json:"staleness,omitempty"`
+}
+
+var validReportName = regexp.MustCompile(`^[a-z_A-Z]+$`)
+
+// reportFields maps the fields of the report DSL to SQL expressions
+var reportFields = map[string]string{
+	"account":     "lines.account_id",
+	"transaction": "lines.transaction_id",
+	"delta":       "lines.delta",
+	"currency":    "lines.currency",
+	"timestamp":   "transactions.timestamp",
+}
+
+// reportPeriods are the group by dimensions truncating the transaction timestamp
+var reportPeriods = map[string]bool{"day": true, "week": true, "month": true, "year": true}
+
+var reportMetricFuncs = map[string]string{
+	"sum":   "SUM",
+	"count": "COUNT",
+	"min":   "MIN",
+	"max":   "MAX",
+	"avg":   "AVG",
+}
+
+// reportFieldSQL returns the SQL expression of a field.
+// Keys of the transaction and account data are referred as `data.<key>` and `account_data.<key>`.
+func reportFieldSQL(field string) (string, error) {
+	if expr, ok := reportFields[field]; ok {
+		return expr, nil
+	}
+	parts := strings.SplitN(field, ".", 2)
+	if len(parts) == 2 && validReportName.MatchString(parts[1]) {
+		switch parts[0] {
+		case "data":
+			return fmt.Sprintf("transactions.data->>'%s'", parts[1]), nil
+		case "account_data":
+			return fmt.Sprintf("accounts.data->>'%s'", parts[1]), nil
+		}
+	}
+	return "", fmt.Errorf("Invalid report field: %v", field)
+}
+
+// isReportInteger says whether the filter value is a whole number, as the deltas are integers
+func isReportInteger(value interface{}) bool {
+	number, ok := value.(float64)
+	return ok && number == math.Trunc(number) && math.Abs(number) < 1<<63
+}
+
+func reportFilterSQL(filter ReportFilter) (string, []interface{}, error) {
+	expr, err := reportFieldSQL(filter.Field)
+	if err != nil {
+		return "", nil, err
+	}
+	// Compare the data values as text, the same as the search ranges
+	value := filter.Value
+	if filter.Field == "timestamp" {
+		expr = "transactions.timestamp::text"
+	}
+	switch filter.Op {
+	case "eq", "ne", "lt", "lte", "gt", "gte", "like", "notlike":
+		switch value.(type) {
+		case string, float64, bool:
+		default:
+			return "", nil, fmt.Errorf("Invalid report filter value: %v", filter.Field)
+		}
+		if filter.Field == "delta" {
+			// The deltas are compared as numbers, which can't be matched by patterns
+			if filter.Op == "like" || filter.Op == "notlike" {
+				return "", nil, fmt.Errorf("Invalid report filter operator of delta: %v", filter.Op)
+			}
+			if !isReportInteger(value) {
+				return "", nil, fmt.Errorf("Invalid report filter value: %v", filter.Field)
+			}
+			return fmt.Sprintf("%s %s ?", expr, sqlComparisonOp(filter.Op)), []interface{}{value}, nil
+		}
+		return fmt.Sprintf("%s %s ?", expr, sqlComparisonOp(filter.Op)), []interface{}{fmt.Sprint(value)}, nil
+	case "in", "nin":
+		values, ok := value.([]interface{})
+		if !ok || len(values) == 0 {
+			return "", nil, fmt.Errorf("Invalid report filter value: %v", filter.Field)
+		}
+		var texts []string
+		for _, v := range values {
+			if filter.Field == "delta" && !isReportInteger(v) {
+				return "", nil, fmt.Errorf("Invalid report filter value: %v", filter.Field)
+			}
+			texts = append(texts, fmt.Sprint(v))
+		}
+		condition := "%s::text = ANY(?)"
+		if filter.Op == "nin" {
+			condition = "NOT (%s::text = ANY(?))"
+		}
+		return fmt.Sprintf(condition, expr), []interface{}{pq.Array(texts)}, nil
+	}
+	return "", nil, fmt.Errorf("Invalid report filter operator: %v", filter.Op)
+}
+
+// Validate checks whether the definition compiles to a valid report query
+func (d *ReportDefinition) Validate() error {
+	if !validReportName.MatchString(d.ID) {
+		return fmt.Errorf("Invalid report id: %v", d.ID)
+	}
+	if _, ok := ReportSchedules[d.Schedule]; d.Schedule != "" && !ok {
+		return fmt.Errorf("Invalid report schedule: %v", d.Schedule)
+	}
+	if d.Materialize && d.Schedule == "" {
+		return fmt.Errorf("Missing schedule of materialized report: %v", d.ID)
+	}
+	if d.Delivery != nil && d.Delivery.URL == "" {
+		return fmt.Errorf("Missing delivery URL of report: %v", d.ID)
+	}
+	if d.Schedule != "" && d.Delivery == nil && !d.Materialize {
+		return fmt.Errorf("Missing delivery of scheduled report: %v", d.ID)
+	}
+	if d.Delivery != nil && d.Delivery.Format != "" && d.Delivery.Format != "json" && d.Delivery.Format != "csv" {
+		return fmt.Errorf("Invalid report delivery format: %v", d.Delivery.Format)
+	}
+	_, _, err := d.ToSQL()
+	return err
+}
+
+// Columns returns the result columns of the report
+func (d *ReportDefinition) Columns() []string {
+	var columns []string
+	for _, group := range d.GroupBy {
+		columns = append(columns, group)
+	}
+	for _, metric := range d.Metrics {
+		columns = append(columns, metric.As)
+	}
+	return columns
+}
+
+// ToSQL compiles the report definition to a parameterized SQL query.
+// All the fields are mapped to known columns, and all the values are passed as arguments.
+func (d *ReportDefinition) ToSQL() (string, []interface{}, error) {
+	if len(d.Metrics) == 0 {
+		return "", nil, fmt.Errorf("Missing report metrics")
+	}
+	var selects, groups, where []string
+	var args []interface{}
+	names := make(map[string]bool)
+
+	for _, group := range d.GroupBy {
+		var expr string
+		if reportPeriods[group] {
+			expr = fmt.Sprintf("to_char(date_trunc('%s', transactions.timestamp), 'YYYY-MM-DD')", group)
+		} else {
+			var err error
+			expr, err = reportFieldSQL(group)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+		alias := fmt.Sprintf("g%d", len(groups)+1)
+		if names[group] {
+			return "", nil, fmt.Errorf("Duplicate report column: %v", group)
+		}
+		names[group] = true
+		selects = append(selects, fmt.Sprintf("%s AS %s", expr, alias))
+		groups = append(groups, alias)
+	}
+
+	for i, metric := range d.Metrics {
+		fn, ok := reportMetricFuncs[metric.Func]
+		if !ok {
+			return "", nil, fmt.Errorf("Invalid report metric: %v", metric.Func)
+		}
+		if !validReportName.MatchString(metric.As) || names[metric.As] {
+			return "", nil, fmt.Errorf("Invalid report metric name: %v", metric.As)
+		}
+		names[metric.As] = true
+		expr := "*"
+		if metric.Func != "count" || metric.Field != "" {
+			// Only the deltas can be aggregated
+			if metric.Field != "delta" {
+				return "", nil, fmt.Errorf("Invalid report metric field: %v", metric.Field)
+			}
+			expr = "lines.delta"
+		}
+		selects = append(selects, fmt.Sprintf("%s(%s) AS m%d", fn, expr, i+1))
+	}
+
+	for _, filter := range d.Filters {
+		condition, filterArgs, err := reportFilterSQL(filter)
+		if err != nil {
+			return "", nil, err
+		}
+		where = append(where, condition)
+		args = append(args, filterArgs...)
+	}
+
+	q := "SELECT " + strings.Join(selects, ", ") +
+		` FROM lines
+			JOIN transactions ON lines.transaction_id = transactions.id
+			JOIN accounts ON lines.account_id = accounts.id`
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	if len(groups) > 0 {
+		q += " GROUP BY " + strings.Join(groups, ", ") + " ORDER BY " + strings.Join(groups, ", ")
+	}
+	return enumerateSQLPlacholder(q), args, nil
+}
+
+// ReportDefinitionDB provides all functions related to custom report definitions
+type ReportDefinitionDB struct {
+	db *sql.DB
+}
+
+// NewReportDefinitionDB provides instance of `ReportDefinitionDB`
+func NewReportDefinitionDB(db *sql.DB) ReportDefinitionDB {
+	return ReportDefinitionDB{db: db}
+}
+
+func scanReportDefinition(scanner interface {
+	Scan(dest ...interface{}) error
+}) (*ReportDefinition, error) {
+	var rawDefinition []byte
+	var lastRunAt pq.NullTime
+	if err := scanner.Scan(&rawDefinition, &lastRunAt); err != nil {
+		return nil, err
+	}
+	definition := &ReportDefinition{}
+	if err := json.Unmarshal(rawDefinition, definition); err != nil {
+		return nil, err
+	}
+	if lastRunAt.Valid {
+		definition.LastRunAt = lastRunAt.Time.Format(LedgerTimestampLayout)
+	}
+	return definition, nil
+}
+
+// GetByID returns the report definition with the given ID, or nil if it doesn't exist
+func (r *ReportDefinitionDB) GetByID(id string) (*ReportDefinition, ledgerError.ApplicationError) {
+	row := r.db.QueryRow("SELECT definition, last_run_at FROM report_definitions WHERE id = $1", id)
+	definition, err := scanReportDefinition(row)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Println("Error executing report definition query:", err)
+		return nil, DBError(err)
+	}
+	return definition, nil
+}
+
+// List returns all the report definitions ordered by ID
+func (r *ReportDefinitionDB) List() ([]*ReportDefinition, ledgerError.ApplicationError) {
+	rows, err := r.db.Query("SELECT definition, last_run_at FROM report_definitions ORDER BY id")
+	if err != nil {
+		log.Println("Error executing report definitions query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	definitions := make([]*ReportDefinition, 0)
+	for rows.Next() {
+		definition, err := scanReportDefinition(rows)
+		if err != nil {
+			return nil, DBError(err)
+		}
+		definitions = append(definitions, definition)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return definitions, nil
+}
+
+// Save creates or replaces the report definition
+func (r *ReportDefinitionDB) Save(definition *ReportDefinition) ledgerError.ApplicationError {
+	stored := *definition
+	stored.LastRunAt = ""
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return JSONError(err)
+	}
+	// The materialized result of the previous definition is discarded
+	q := `INSERT INTO report_definitions (id, definition, schedule) VALUES ($1, $2, $3)
+			ON CONFLICT (id) DO UPDATE SET definition = EXCLUDED.definition, schedule = EXCLUDED.schedule,
+				result = NULL, materialized_at = NULL`
+	_, err = r.db.Exec(q, definition.ID, string(data), definition.Schedule)
+	if err != nil {
+		return DBError(err)
+	}
+	return nil
+}
+
+// Run executes the report and returns its rows
+func (r *ReportDefinitionDB) Run(definition *ReportDefinition) (*ReportResult, ledgerError.ApplicationError) {
+	q, args, err := definition.ToSQL()
+	if err != nil {
+		return nil, ReportDefinitionInvalidError(err)
+	}
+	rows, err := r.db.Query(q, args...)
+	if err != nil {
+		log.Println("Error executing report query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+
+	result := &ReportResult{
+		ReportID:    definition.ID,
+		GeneratedAt: time.Now().UTC().Format(LedgerTimestampLayout),
+		Columns:     definition.Columns(),
+		Rows:        make([]map[string]interface{}, 0),
+	}
+	for rows.Next() {
+		values := make([]interface{}, len(result.Columns))
+		pointers := make([]interface{}, len(values))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, DBError(err)
+		}
+		row := make(map[string]interface{}, len(values))
+		for i, column := range result.Columns {
+			// Numeric aggregates are returned as text by the driver
+			if b, ok := values[i].([]byte); ok {
+				row[column] = json.Number(b)
+				if i < len(definition.GroupBy) {
+					row[column] = string(b)
+				}
+				continue
+			}
+			row[column] = values[i]
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return result, nil
+}
+
+// ClaimDue locks the scheduled reports which are due and marks them as run.
+// Reports claimed by another server are skipped, so each run happens once.
+func (r *ReportDefinitionDB) ClaimDue(now time.Time) ([]*ReportDefinition, ledgerError.ApplicationError) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, DBError(err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT definition, last_run_at FROM report_definitions
+			WHERE schedule <> '' FOR UPDATE SKIP LOCKED`)
+	if err != nil {
+		log.Println("Error executing scheduled reports query:", err)
+		return nil, DBError(err)
+	}
+	var due []*ReportDefinition
+	for rows.Next() {
+		definition, err := scanReportDefinition(rows)
+		if err != nil {
+			rows.Close()
+			return nil, DBError(err)
+		}
+		interval, ok := ReportSchedules[definition.Schedule]
+		if !ok {
+			continue
+		}
+		if definition.LastRunAt != "" {
+			lastRunAt, err := time.Parse(LedgerTimestampLayout, definition.LastRunAt)
+			if err == nil && now.Sub(lastRunAt) < interval {
+				continue
+			}
+		}
+		due = append(due, definition)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+
+	for _, definition := range due {
+		_, err := tx.Exec("UPDATE report_definitions SET last_run_at = $1 WHERE id = $2", now, definition.ID)
+		if err != nil {
+			return nil, DBError(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, DBError(err)
+	}
+	return due, nil
+}
+
+// staleness returns the staleness of a result materialized at the given time
+func (d *ReportDefinition) staleness(materializedAt, now time.Time) *ReportStaleness {
+	age := now.Sub(materializedAt)
+	return &ReportStaleness{
+		MaterializedAt: materializedAt.Format(LedgerTimestampLayout),
+		AgeSeconds:     int64(age / time.Second),
+		Stale:          age > ReportSchedules[d.Schedule],
+	}
+}
+
+// GetMaterialized returns the materialized result of the report, or nil if it isn't materialized yet
+func (r *ReportDefinitionDB) GetMaterialized(definition *ReportDefinition) (*ReportResult, ledgerError.ApplicationError) {
+	var rawResult []byte
+	var materializedAt pq.NullTime
+	err := r.db.QueryRow("SELECT result, materialized_at FROM report_definitions WHERE id = $1", definition.ID).Scan(&rawResult, &materializedAt)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Println("Error executing materialized report query:", err)
+		return nil, DBError(err)
+	}
+	if rawResult == nil || !materializedAt.Valid {
+		return nil, nil
+	}
+	result := &ReportResult{}
+	if err := json.Unmarshal(rawResult, result); err != nil {
+		return nil, JSONError(err)
+	}
+	result.Staleness = definition.staleness(materializedAt.Time, time.Now().UTC())
+	return result, nil
+}
+
+// Materialize runs the report and stores its result
+func (r *ReportDefinitionDB) Materialize(definition *ReportDefinition) (*ReportResult, ledgerError.ApplicationError) {
+	result, aerr := r.Run(definition)
+	if aerr != nil {
+		return nil, aerr
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, JSONError(err)
+	}
+	materializedAt, err := time.Parse(LedgerTimestampLayout, result.GeneratedAt)
+	if err != nil {
+		return nil, JSONError(err)
+	}
+	_, err = r.db.Exec("UPDATE report_definitions SET result = $1, materialized_at = $2 WHERE id = $3",
+		string(data), materializedAt, definition.ID)
+	if err != nil {
+		log.Println("Error executing materialize report query:", err)
+		return nil, DBError(err)
+	}
+	result.Staleness = definition.staleness(materializedAt, materializedAt)
+	return result, nil
+}
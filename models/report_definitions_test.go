@@ -0,0 +1,118 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportDefinitionToSQL(t *testing.T) {
+	definition := &ReportDefinition{
+		ID: "monthly_sales",
+		Filters: []ReportFilter{
+			{Field: "account", Op: "like", Value: "sales.%"},
+			{Field: "data.status", Op: "in", Value: []interface{}{"completed", "settled"}},
+		},
+		GroupBy: []string{"month", "account"},
+		Metrics: []ReportMetric{
+			{Func: "sum", Field: "delta", As: "total"},
+			{Func: "count", As: "lines"},
+		},
+	}
+	q, args, err := definition.ToSQL()
+	assert.Nil(t, err, "Error compiling report definition")
+	assert.Contains(t, q, "SELECT to_char(date_trunc('month', transactions.timestamp), 'YYYY-MM-DD') AS g1, lines.account_id AS g2, SUM(lines.delta) AS m1, COUNT(*) AS m2")
+	assert.Contains(t, q, "WHERE lines.account_id LIKE $1 AND transactions.data->>'status'::text = ANY($2)")
+	assert.Contains(t, q, "GROUP BY g1, g2 ORDER BY g1, g2")
+	assert.Equal(t, 2, len(args), "Invalid number of report arguments")
+	assert.Equal(t, "sales.%", args[0], "Invalid report argument")
+	assert.Equal(t, []string{"month", "account", "total", "lines"}, definition.Columns(), "Invalid report columns")
+	assert.Nil(t, definition.Validate(), "Valid report definition is rejected")
+}
+
+func TestReportDefinitionRejectsUnsafeInput(t *testing.T) {
+	definitions := []string{
+		`{"id": "r", "metrics": [{"func": "sum", "field": "delta", "as": "total"}], "group_by": ["data.x'; DROP TABLE lines; --"]}`,
+		`{"id": "r", "metrics": [{"func": "sum", "field": "delta", "as": "total"}], "filters": [{"field": "id; --", "op": "eq", "value": "x"}]}`,
+		`{"id": "r", "metrics": [{"func": "sum", "field": "delta", "as": "total"}], "filters": [{"field": "account", "op": "OR 1=1", "value": "x"}]}`,
+		`{"id": "r", "metrics": [{"func": "sum", "field": "delta", "as": "total"}], "filters": [{"field": "account", "op": "eq", "value": {"a": 1}}]}`,
+		`{"id": "r", "metrics": [{"func": "pg_sleep", "field": "delta", "as": "total"}]}`,
+		`{"id": "r", "metrics": [{"func": "sum", "field": "account", "as": "total"}]}`,
+		`{"id": "r", "metrics": [{"func": "sum", "field": "delta", "as": "total \" --"}]}`,
+		`{"id": "r", "metrics": []}`,
+	}
+	for _, raw := range definitions {
+		definition := &ReportDefinition{}
+		assert.Nil(t, json.NewDecoder(strings.NewReader(raw)).Decode(definition), "Error decoding report definition")
+		_, _, err := definition.ToSQL()
+		assert.NotNil(t, err, "Unsafe report definition is compiled: "+raw)
+	}
+}
+
+func TestReportDefinitionValidateFilterTypes(t *testing.T) {
+	filters := []string{
+		`{"field": "delta", "op": "like", "value": "1%"}`,
+		`{"field": "delta", "op": "notlike", "value": 100}`,
+		`{"field": "delta", "op": "gt", "value": "100"}`,
+		`{"field": "delta", "op": "gt", "value": true}`,
+		`{"field": "delta", "op": "eq", "value": 1.5}`,
+		`{"field": "delta", "op": "in", "value": [100, "x"]}`,
+	}
+	for _, raw := range filters {
+		definition := &ReportDefinition{ID: "r", Metrics: []ReportMetric{{Func: "count", As: "lines"}}}
+		definition.Filters = make([]ReportFilter, 1)
+		assert.Nil(t, json.Unmarshal([]byte(raw), &definition.Filters[0]), "Error decoding report filter")
+		assert.NotNil(t, definition.Validate(), "Mistyped report filter is accepted: "+raw)
+	}
+
+	definition := &ReportDefinition{
+		ID:      "r",
+		Metrics: []ReportMetric{{Func: "count", As: "lines"}},
+		Filters: []ReportFilter{
+			{Field: "delta", Op: "lt", Value: float64(-100)},
+			{Field: "delta", Op: "in", Value: []interface{}{float64(1), float64(2)}},
+			{Field: "account", Op: "like", Value: "alice%"},
+		},
+	}
+	assert.Nil(t, definition.Validate(), "Valid report filters are rejected")
+}
+
+func TestReportDefinitionValidateSchedule(t *testing.T) {
+	definition := &ReportDefinition{
+		ID:       "daily_sales",
+		Metrics:  []ReportMetric{{Func: "count", As: "lines"}},
+		Schedule: "daily",
+	}
+	assert.NotNil(t, definition.Validate(), "Scheduled report without delivery is accepted")
+
+	definition.Delivery = &ReportDelivery{URL: "https://example.com/reports", Format: "csv"}
+	assert.Nil(t, definition.Validate(), "Valid scheduled report is rejected")
+
+	definition.Schedule = "every minute"
+	assert.NotNil(t, definition.Validate(), "Invalid schedule is accepted")
+}
+
+func TestReportDefinitionStaleness(t *testing.T) {
+	definition := &ReportDefinition{
+		ID:          "hourly_sales",
+		Metrics:     []ReportMetric{{Func: "count", As: "lines"}},
+		Schedule:    "hourly",
+		Materialize: true,
+	}
+	assert.Nil(t, definition.Validate(), "Materialized report without delivery is rejected")
+
+	materializedAt := time.Date(2017, 6, 30, 10, 0, 0, 0, time.UTC)
+	staleness := definition.staleness(materializedAt, materializedAt.Add(30*time.Minute))
+	assert.Equal(t, "2017-06-30 10:00:00.000", staleness.MaterializedAt, "Invalid materialization time")
+	assert.Equal(t, int64(1800), staleness.AgeSeconds, "Invalid age")
+	assert.False(t, staleness.Stale, "Fresh result is stale")
+
+	staleness = definition.staleness(materializedAt, materializedAt.Add(2*time.Hour))
+	assert.True(t, staleness.Stale, "Result older than the schedule is not stale")
+
+	definition.Schedule = ""
+	assert.NotNil(t, definition.Validate(), "Materialized report without schedule is accepted")
+}
@@ -0,0 +1,242 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// RetentionPurgeBatch is the number of rows deleted per statement while purging,
+// so that a purge doesn't hold the locks of a large table for long
+const RetentionPurgeBatch = 1000
+
+// RetentionTable is a history table whose rows are purged after the retention period,
+// where only the rows in a final status are purged
+type RetentionTable struct {
+	Name string
+	// Timestamp is the expression of the time of the row its age is counted from
+	Timestamp string
+	// Pending is the status of the rows which are never purged
+	Pending string
+}
+
+// RetentionTables are the history tables with a retention period
+var RetentionTables = []RetentionTable{
+	{Name: "webhook_deliveries", Timestamp: "COALESCE(delivered_at, created_at)", Pending: WebhookDeliveryPending},
+	{Name: "scheduled_transactions", Timestamp: "COALESCE(posted_at, created_at)", Pending: ScheduledTransactionPending},
+}
+
+// RetentionSettings are the retention periods of the history tables of a ledger in days,
+// where the rows of a table are kept forever while its period is null
+type RetentionSettings struct {
+	WebhookDeliveriesDays     *int   `json:"webhook_deliveries_days"`
+	ScheduledTransactionsDays *int   `json:"scheduled_transactions_days"`
+	UpdatedAt                 string `json:"updated_at,omitempty"`
+}
+
+// Validate checks that the retention periods are at least a day
+func (s *RetentionSettings) Validate() error {
+	for name, days := range s.periods() {
+		if days != nil && *days < 1 {
+			return fmt.Errorf("Retention period of %v should be at least a day", name)
+		}
+	}
+	return nil
+}
+
+// periods returns the retention periods by the table
+func (s *RetentionSettings) periods() map[string]*int {
+	return map[string]*int{
+		"webhook_deliveries":     s.WebhookDeliveriesDays,
+		"scheduled_transactions": s.ScheduledTransactionsDays,
+	}
+}
+
+// Cutoff returns the time before which the rows of the table are purged, and false if they are kept forever
+func (s *RetentionSettings) Cutoff(table string, now time.Time) (time.Time, bool) {
+	days := s.periods()[table]
+	if days == nil {
+		return time.Time{}, false
+	}
+	return now.AddDate(0, 0, -*days), true
+}
+
+// RetentionTableUsage represents the rows of a history table along with the rows due to be purged
+type RetentionTableUsage struct {
+	Table     string `json:"table"`
+	Rows      int64  `json:"rows"`
+	Purgeable int64  `json:"purgeable"`
+}
+
+// RetentionPurge represents the rows deleted by a purge by the table
+type RetentionPurge struct {
+	PurgedAt string           `json:"purged_at"`
+	Purged   map[string]int64 `json:"purged"`
+}
+
+// RetentionReport represents the retention settings of a ledger along with the usage of its history tables
+// and its last purge
+type RetentionReport struct {
+	Settings  *RetentionSettings    `json:"settings"`
+	Tables    []RetentionTableUsage `json:"tables"`
+	LastPurge *RetentionPurge       `json:"last_purge"`
+}
+
+// RetentionDB provides the retention settings and the purges of the history tables
+type RetentionDB struct {
+	db *sql.DB
+}
+
+// NewRetentionDB provides instance of `RetentionDB`
+func NewRetentionDB(db *sql.DB) RetentionDB {
+	return RetentionDB{db: db}
+}
+
+// Get returns the retention settings, which keep the rows forever until they are set
+func (r *RetentionDB) Get() (*RetentionSettings, ledgerError.ApplicationError) {
+	settings, _, err := r.read()
+	if err != nil {
+		return nil, DBError(err)
+	}
+	return settings, nil
+}
+
+// read returns the retention settings along with the last purge if any
+func (r *RetentionDB) read() (*RetentionSettings, *RetentionPurge, error) {
+	settings := &RetentionSettings{}
+	var updatedAt time.Time
+	var purgedAt pq.NullTime
+	var purged []byte
+	err := r.db.QueryRow(`SELECT webhook_deliveries_days, scheduled_transactions_days, updated_at,
+		last_purged_at, last_purged FROM retention_settings`).Scan(
+		nullInt{&settings.WebhookDeliveriesDays}, nullInt{&settings.ScheduledTransactionsDays}, &updatedAt,
+		&purgedAt, &purged)
+	if err == sql.ErrNoRows {
+		return settings, nil, nil
+	}
+	if err != nil {
+		log.Println("Error executing retention settings query:", err)
+		return nil, nil, err
+	}
+	settings.UpdatedAt = updatedAt.Format(LedgerTimestampLayout)
+	if !purgedAt.Valid {
+		return settings, nil, nil
+	}
+	purge := &RetentionPurge{PurgedAt: purgedAt.Time.Format(LedgerTimestampLayout)}
+	if err := json.Unmarshal(purged, &purge.Purged); err != nil {
+		return nil, nil, err
+	}
+	return settings, purge, nil
+}
+
+// nullInt scans a nullable integer into a pointer, which is nil for null
+type nullInt struct {
+	value **int
+}
+
+// Scan implements the `sql.Scanner` interface
+func (n nullInt) Scan(src interface{}) error {
+	var value sql.NullInt64
+	if err := value.Scan(src); err != nil {
+		return err
+	}
+	*n.value = nil
+	if value.Valid {
+		days := int(value.Int64)
+		*n.value = &days
+	}
+	return nil
+}
+
+// Set creates or replaces the retention settings
+func (r *RetentionDB) Set(settings *RetentionSettings) ledgerError.ApplicationError {
+	if err := settings.Validate(); err != nil {
+		return RetentionSettingsInvalidError(err.Error())
+	}
+	now := time.Now().UTC()
+	_, err := r.db.Exec(`INSERT INTO retention_settings (id, webhook_deliveries_days, scheduled_transactions_days, updated_at)
+		VALUES (true, $1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET webhook_deliveries_days = $1, scheduled_transactions_days = $2, updated_at = $3`,
+		settings.WebhookDeliveriesDays, settings.ScheduledTransactionsDays, now)
+	if err != nil {
+		return DBError(err)
+	}
+	settings.UpdatedAt = now.Format(LedgerTimestampLayout)
+	return nil
+}
+
+// Report returns the retention settings along with the rows of the history tables due to be purged
+// as of now, and the last purge
+func (r *RetentionDB) Report(now time.Time) (*RetentionReport, ledgerError.ApplicationError) {
+	settings, purge, err := r.read()
+	if err != nil {
+		return nil, DBError(err)
+	}
+	report := &RetentionReport{Settings: settings, LastPurge: purge, Tables: []RetentionTableUsage{}}
+	for _, table := range RetentionTables {
+		usage := RetentionTableUsage{Table: table.Name}
+		var err error
+		if cutoff, ok := settings.Cutoff(table.Name, now); ok {
+			err = r.db.QueryRow(`SELECT COUNT(*), COUNT(*) FILTER (WHERE status <> $1 AND `+table.Timestamp+` < $2)
+				FROM `+table.Name, table.Pending, cutoff).Scan(&usage.Rows, &usage.Purgeable)
+		} else {
+			// Nothing is purgeable while the rows are kept forever
+			err = r.db.QueryRow("SELECT COUNT(*) FROM " + table.Name).Scan(&usage.Rows)
+		}
+		if err != nil {
+			log.Println("Error executing retention usage query:", err)
+			return nil, DBError(err)
+		}
+		report.Tables = append(report.Tables, usage)
+	}
+	return report, nil
+}
+
+// Purge deletes the rows of the history tables older than their retention periods in batches,
+// and records the rows deleted as the last purge
+func (r *RetentionDB) Purge(now time.Time) (*RetentionPurge, ledgerError.ApplicationError) {
+	settings, _, err := r.read()
+	if err != nil {
+		return nil, DBError(err)
+	}
+	purge := &RetentionPurge{PurgedAt: now.Format(LedgerTimestampLayout), Purged: make(map[string]int64)}
+	for _, table := range RetentionTables {
+		cutoff, ok := settings.Cutoff(table.Name, now)
+		if !ok {
+			continue
+		}
+		for {
+			result, err := r.db.Exec(`DELETE FROM `+table.Name+` WHERE id IN (
+				SELECT id FROM `+table.Name+` WHERE status <> $1 AND `+table.Timestamp+` < $2 LIMIT $3)`,
+				table.Pending, cutoff, RetentionPurgeBatch)
+			if err != nil {
+				log.Println("Error executing retention purge query:", err)
+				return nil, DBError(err)
+			}
+			deleted, err := result.RowsAffected()
+			if err != nil {
+				return nil, DBError(err)
+			}
+			purge.Purged[table.Name] += deleted
+			if deleted < RetentionPurgeBatch {
+				break
+			}
+		}
+	}
+
+	purged, err := json.Marshal(purge.Purged)
+	if err != nil {
+		return nil, DBError(err)
+	}
+	// The purge is recorded only once the settings are set, as nothing is purged until then
+	_, err = r.db.Exec("UPDATE retention_settings SET last_purged_at = $1, last_purged = $2", now, purged)
+	if err != nil {
+		return nil, DBError(err)
+	}
+	return purge, nil
+}
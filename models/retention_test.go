@@ -0,0 +1,119 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestRetentionSettings(t *testing.T) {
+	now := time.Date(2017, 6, 30, 0, 0, 0, 0, time.UTC)
+	days := 30
+	settings := &RetentionSettings{WebhookDeliveriesDays: &days}
+	assert.Nil(t, settings.Validate(), "Settings should be valid")
+	cutoff, ok := settings.Cutoff("webhook_deliveries", now)
+	assert.True(t, ok, "Webhook deliveries should be purged")
+	assert.Equal(t, time.Date(2017, 5, 31, 0, 0, 0, 0, time.UTC), cutoff, "Invalid cutoff")
+	_, ok = settings.Cutoff("scheduled_transactions", now)
+	assert.False(t, ok, "Scheduled transactions should be kept forever")
+
+	zero := 0
+	invalid := &RetentionSettings{ScheduledTransactionsDays: &zero}
+	assert.NotNil(t, invalid.Validate(), "Retention of zero days should be invalid")
+}
+
+type RetentionSuite struct {
+	suite.Suite
+	db *sql.DB
+}
+
+func (rs *RetentionSuite) SetupSuite() {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(rs.T(), databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	} else {
+		log.Println("Successfully established connection to database.")
+		rs.db = db
+	}
+}
+
+func (rs *RetentionSuite) TestPurge() {
+	t := rs.T()
+	now := time.Now().UTC()
+	for _, row := range []struct {
+		id, status string
+		age        time.Duration
+	}{
+		{"retention_old_posted", ScheduledTransactionPosted, 100 * 24 * time.Hour},
+		{"retention_old_pending", ScheduledTransactionPending, 100 * 24 * time.Hour},
+		{"retention_new_posted", ScheduledTransactionPosted, time.Hour},
+	} {
+		_, err := rs.db.Exec(`INSERT INTO scheduled_transactions (id, transaction, post_at, status, created_at, posted_at)
+			VALUES ($1, '{}', $2, $3, $2, $2)`, row.id, now.Add(-row.age), row.status)
+		assert.Nil(t, err, "Error while creating scheduled transaction")
+	}
+
+	retentionDB := NewRetentionDB(rs.db)
+	settings, aerr := retentionDB.Get()
+	assert.Nil(t, aerr, "Error while getting retention settings")
+	assert.Nil(t, settings.ScheduledTransactionsDays, "Rows should be kept forever until set")
+
+	days := 30
+	aerr = retentionDB.Set(&RetentionSettings{ScheduledTransactionsDays: &days})
+	assert.Nil(t, aerr, "Error while setting retention settings")
+	zero := 0
+	aerr = retentionDB.Set(&RetentionSettings{ScheduledTransactionsDays: &zero})
+	assert.Equal(t, "retention.invalid_settings", aerr.ErrorCode(), "Invalid settings should be rejected")
+
+	report, aerr := retentionDB.Report(now)
+	assert.Nil(t, aerr, "Error while getting retention report")
+	assert.Nil(t, report.LastPurge, "Ledger should not be purged yet")
+	for _, usage := range report.Tables {
+		if usage.Table == "scheduled_transactions" {
+			assert.Equal(t, int64(1), usage.Purgeable, "Only the old posted transaction should be purgeable")
+		}
+	}
+
+	purge, aerr := retentionDB.Purge(now)
+	assert.Nil(t, aerr, "Error while purging")
+	assert.Equal(t, int64(1), purge.Purged["scheduled_transactions"], "Invalid purged rows")
+	var ids []string
+	rows, err := rs.db.Query("SELECT id FROM scheduled_transactions WHERE id LIKE 'retention%' ORDER BY id")
+	assert.Nil(t, err, "Error while listing scheduled transactions")
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	assert.Equal(t, []string{"retention_new_posted", "retention_old_pending"}, ids, "Invalid remaining rows")
+
+	report, aerr = retentionDB.Report(now)
+	assert.Nil(t, aerr, "Error while getting retention report")
+	assert.NotNil(t, report.LastPurge, "Purge should be recorded")
+	assert.Equal(t, int64(1), report.LastPurge.Purged["scheduled_transactions"], "Invalid recorded purge")
+}
+
+func (rs *RetentionSuite) TearDownSuite() {
+	t := rs.T()
+	for _, q := range []string{
+		"DELETE FROM retention_settings",
+		"DELETE FROM scheduled_transactions WHERE id LIKE 'retention%'",
+	} {
+		if _, err := rs.db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRetentionSuite(t *testing.T) {
+	suite.Run(t, new(RetentionSuite))
+}
@@ -0,0 +1,306 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+var (
+	validRoutingRuleID  = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+	validRoutingDataKey = regexp.MustCompile(`^[a-z_A-Z]+$`)
+	routingPlaceholder  = regexp.MustCompile(`\{([a-z_A-Z]+)\}`)
+	routingValuePattern = `([^:]+)`
+)
+
+// RoutingRule represents a rule resolving the account references of the transaction lines, such as
+// `merchant:42:payable`, to the concrete accounts, so that the clients don't need to know them
+type RoutingRule struct {
+	ID string `json:"id"`
+	// Pattern is the account reference with `{name}` placeholders, such as `merchant:{merchant_id}:payable`
+	Pattern string `json:"pattern"`
+	// Priority orders the rules, and the first rule matching a reference resolves it
+	Priority int `json:"priority"`
+	// Account is the ID of the account with the placeholders, such as `payable-{merchant_id}`
+	Account string `json:"account,omitempty"`
+	// Lookup is the data of the account with the placeholders, such as `{"merchant_id": "{merchant_id}"}`,
+	// which matches the string values, and the number and boolean values of the same text
+	Lookup    map[string]string `json:"lookup,omitempty"`
+	CreatedAt string            `json:"created_at,omitempty"`
+
+	// matcher is the pattern compiled on the first match, with the names of its placeholders in order
+	matcher    *regexp.Regexp
+	matchNames []string
+}
+
+// placeholders returns the names of the placeholders of the template
+func placeholders(template string) []string {
+	var names []string
+	for _, match := range routingPlaceholder.FindAllStringSubmatch(template, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// Validate checks whether the rule has a valid ID and pattern, and either an account or a lookup
+// with the placeholders of the pattern only
+func (r *RoutingRule) Validate() error {
+	switch {
+	case !validRoutingRuleID.MatchString(r.ID):
+		return errors.New("Invalid routing rule id")
+	case strings.TrimSpace(r.Pattern) == "":
+		return errors.New("Missing routing rule pattern")
+	case (r.Account == "") == (len(r.Lookup) == 0):
+		return errors.New("Routing rule should have either an account or a lookup")
+	}
+	names := make(map[string]bool)
+	for _, name := range placeholders(r.Pattern) {
+		if names[name] {
+			return fmt.Errorf("Duplicate placeholder in routing rule pattern: %v", name)
+		}
+		names[name] = true
+	}
+	templates := []string{r.Account}
+	for key, value := range r.Lookup {
+		if !validRoutingDataKey.MatchString(key) {
+			return fmt.Errorf("Invalid key in routing rule lookup: %v", key)
+		}
+		templates = append(templates, value)
+	}
+	for _, template := range templates {
+		for _, name := range placeholders(template) {
+			if !names[name] {
+				return fmt.Errorf("Unknown placeholder in routing rule: %v", name)
+			}
+		}
+	}
+	return nil
+}
+
+// compile compiles the pattern of the rule to a regular expression matching the references
+func (r *RoutingRule) compile() {
+	var expr strings.Builder
+	var names []string
+	last := 0
+	for _, loc := range routingPlaceholder.FindAllStringSubmatchIndex(r.Pattern, -1) {
+		expr.WriteString(regexp.QuoteMeta(r.Pattern[last:loc[0]]))
+		expr.WriteString(routingValuePattern)
+		names = append(names, r.Pattern[loc[2]:loc[3]])
+		last = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(r.Pattern[last:]))
+	r.matcher = regexp.MustCompile("^" + expr.String() + "$")
+	r.matchNames = names
+}
+
+// Match returns the values of the placeholders of the reference, if it matches the pattern of the rule.
+// The values can't have a `:`, which separates the parts of the references.
+func (r *RoutingRule) Match(ref string) (map[string]string, bool) {
+	if r.matcher == nil {
+		r.compile()
+	}
+	match := r.matcher.FindStringSubmatch(ref)
+	if match == nil {
+		return nil, false
+	}
+	values := make(map[string]string, len(r.matchNames))
+	for i, name := range r.matchNames {
+		values[name] = match[i+1]
+	}
+	return values, true
+}
+
+// lookupValues returns the JSON values of the data which a lookup value matches, which are the string,
+// and the number or boolean written the same
+func lookupValues(value string) []interface{} {
+	values := []interface{}{value}
+	var literal interface{}
+	if err := json.Unmarshal([]byte(value), &literal); err == nil {
+		switch literal.(type) {
+		case float64, bool:
+			if data, err := json.Marshal(literal); err == nil && string(data) == value {
+				values = append(values, literal)
+			}
+		}
+	}
+	return values
+}
+
+// expandPlaceholders replaces the placeholders of the template with their values
+func expandPlaceholders(template string, values map[string]string) string {
+	return routingPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		return values[placeholder[1:len(placeholder)-1]]
+	})
+}
+
+// RoutingRuleDB provides all functions related to routing rules
+type RoutingRuleDB struct {
+	db *sql.DB
+}
+
+// NewRoutingRuleDB provides instance of `RoutingRuleDB`
+func NewRoutingRuleDB(db *sql.DB) RoutingRuleDB {
+	return RoutingRuleDB{db: db}
+}
+
+// Create adds a routing rule
+func (r *RoutingRuleDB) Create(rule *RoutingRule) ledgerError.ApplicationError {
+	var lookup interface{}
+	if len(rule.Lookup) > 0 {
+		data, err := json.Marshal(rule.Lookup)
+		if err != nil {
+			return JSONError(err)
+		}
+		lookup = string(data)
+	}
+	now := time.Now().UTC()
+	_, err := r.db.Exec(`INSERT INTO routing_rules (id, pattern, priority, account, lookup, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)`, rule.ID, rule.Pattern, rule.Priority, rule.Account, lookup, now)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return RoutingRuleExistsError(rule.ID)
+		}
+		return DBError(err)
+	}
+	rule.CreatedAt = now.Format(LedgerTimestampLayout)
+	return nil
+}
+
+// Delete removes a routing rule. It returns false if the rule doesn't exist.
+func (r *RoutingRuleDB) Delete(id string) (bool, ledgerError.ApplicationError) {
+	result, err := r.db.Exec("DELETE FROM routing_rules WHERE id = $1", id)
+	if err != nil {
+		return false, DBError(err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, DBError(err)
+	}
+	return count > 0, nil
+}
+
+// List returns all the routing rules in the order they are matched
+func (r *RoutingRuleDB) List() ([]*RoutingRule, ledgerError.ApplicationError) {
+	rows, err := r.db.Query(`SELECT id, pattern, priority, COALESCE(account, ''), lookup, created_at
+		FROM routing_rules ORDER BY priority, id`)
+	if err != nil {
+		log.Println("Error executing routing rules query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	rules := make([]*RoutingRule, 0)
+	for rows.Next() {
+		rule := &RoutingRule{}
+		var rawLookup []byte
+		var createdAt time.Time
+		if err := rows.Scan(&rule.ID, &rule.Pattern, &rule.Priority, &rule.Account, &rawLookup, &createdAt); err != nil {
+			return nil, DBError(err)
+		}
+		if rawLookup != nil {
+			if err := json.Unmarshal(rawLookup, &rule.Lookup); err != nil {
+				return nil, JSONError(err)
+			}
+		}
+		rule.CreatedAt = createdAt.Format(LedgerTimestampLayout)
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return rules, nil
+}
+
+// ResolveLines replaces the account references of the lines with the accounts they resolve to.
+// The rules are read only when a line has a reference.
+func (r *RoutingRuleDB) ResolveLines(lines []*TransactionLine) ledgerError.ApplicationError {
+	var rules []*RoutingRule
+	for _, line := range lines {
+		if line.AccountRef == "" {
+			continue
+		}
+		if rules == nil {
+			var aerr ledgerError.ApplicationError
+			if rules, aerr = r.List(); aerr != nil {
+				return aerr
+			}
+		}
+		account, aerr := r.resolve(rules, line.AccountRef)
+		if aerr != nil {
+			return aerr
+		}
+		line.AccountID, line.AccountRef = account, ""
+	}
+	return nil
+}
+
+// resolve returns the account of the reference as per the first rule matching it
+func (r *RoutingRuleDB) resolve(rules []*RoutingRule, ref string) (string, ledgerError.ApplicationError) {
+	for _, rule := range rules {
+		values, ok := rule.Match(ref)
+		if !ok {
+			continue
+		}
+		if rule.Account != "" {
+			return expandPlaceholders(rule.Account, values), nil
+		}
+		return r.lookup(rule, values, ref)
+	}
+	return "", AccountRefUnmatchedError(ref)
+}
+
+// lookup returns the single account whose data has the values of the lookup of the rule.
+// The data is matched by containment, which uses the index of the account data.
+func (r *RoutingRuleDB) lookup(rule *RoutingRule, values map[string]string, ref string) (string, ledgerError.ApplicationError) {
+	keys := make([]string, 0, len(rule.Lookup))
+	for key := range rule.Lookup {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var conditions []string
+	var args []interface{}
+	for _, key := range keys {
+		var alternatives []string
+		for _, value := range lookupValues(expandPlaceholders(rule.Lookup[key], values)) {
+			filter, err := json.Marshal(map[string]interface{}{key: value})
+			if err != nil {
+				return "", JSONError(err)
+			}
+			args = append(args, string(filter))
+			alternatives = append(alternatives, fmt.Sprintf("data @> $%d::jsonb", len(args)))
+		}
+		conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	rows, err := r.db.Query("SELECT id FROM accounts WHERE "+strings.Join(conditions, " AND ")+" ORDER BY id LIMIT 2", args...)
+	if err != nil {
+		log.Println("Error executing routing lookup query:", err)
+		return "", DBError(err)
+	}
+	defer rows.Close()
+	var accounts []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return "", DBError(err)
+		}
+		accounts = append(accounts, id)
+	}
+	if err := rows.Err(); err != nil {
+		return "", DBError(err)
+	}
+	switch len(accounts) {
+	case 0:
+		return "", AccountRefUnresolvedError(ref, rule.ID)
+	case 1:
+		return accounts[0], nil
+	}
+	return "", AccountRefAmbiguousError(ref, rule.ID)
+}
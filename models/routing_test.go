@@ -0,0 +1,136 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestRoutingRuleValidate(t *testing.T) {
+	valid := []*RoutingRule{
+		{ID: "merchant_payable", Pattern: "merchant:{merchant_id}:payable", Account: "payable-{merchant_id}"},
+		{ID: "merchant_payable", Pattern: "merchant:{merchant_id}:{kind}", Lookup: map[string]string{"merchant_id": "{merchant_id}", "kind": "{kind}"}},
+		{ID: "fees", Pattern: "fees", Account: "fees-2017"},
+	}
+	for _, rule := range valid {
+		assert.Nil(t, rule.Validate(), "Rule should be valid: %v", rule.Pattern)
+	}
+	invalid := []*RoutingRule{
+		{ID: "merchant payable", Pattern: "merchant:{merchant_id}:payable", Account: "payable-{merchant_id}"},
+		{ID: "merchant_payable", Pattern: " ", Account: "payable"},
+		{ID: "merchant_payable", Pattern: "merchant:{merchant_id}:payable"},
+		{ID: "merchant_payable", Pattern: "merchant:{merchant_id}:payable", Account: "payable-{merchant_id}", Lookup: map[string]string{"merchant_id": "{merchant_id}"}},
+		{ID: "merchant_payable", Pattern: "merchant:{merchant_id}:payable", Account: "payable-{merchant}"},
+		{ID: "merchant_payable", Pattern: "merchant:{merchant_id}:{merchant_id}", Account: "payable-{merchant_id}"},
+		{ID: "merchant_payable", Pattern: "merchant:{merchant_id}:payable", Lookup: map[string]string{"merchant-id": "{merchant_id}"}},
+	}
+	for _, rule := range invalid {
+		assert.NotNil(t, rule.Validate(), "Rule should be invalid: %v", rule)
+	}
+}
+
+func TestRoutingRuleMatch(t *testing.T) {
+	rule := &RoutingRule{Pattern: "merchant:{merchant_id}:{kind}.v1", Account: "{kind}-{merchant_id}"}
+	values, ok := rule.Match("merchant:m42:payable.v1")
+	assert.True(t, ok, "Reference should match")
+	assert.Equal(t, map[string]string{"merchant_id": "m42", "kind": "payable"}, values, "Invalid placeholder values")
+	assert.Equal(t, "payable-m42", expandPlaceholders(rule.Account, values), "Invalid account")
+
+	for _, ref := range []string{"merchant:m42:payable.v2", "merchant:m:42:payable.v1", "merchant::payable.v1", "customer:m42:payable.v1"} {
+		_, ok := rule.Match(ref)
+		assert.False(t, ok, "Reference should not match: %v", ref)
+	}
+}
+
+func TestLookupValues(t *testing.T) {
+	assert.Equal(t, []interface{}{"m42"}, lookupValues("m42"), "Invalid lookup values")
+	assert.Equal(t, []interface{}{"42", float64(42)}, lookupValues("42"), "Invalid lookup values")
+	assert.Equal(t, []interface{}{"true", true}, lookupValues("true"), "Invalid lookup values")
+	assert.Equal(t, []interface{}{"042"}, lookupValues("042"), "Invalid lookup values")
+	assert.Equal(t, []interface{}{"1e2"}, lookupValues("1e2"), "Number written differently should not match")
+}
+
+type RoutingSuite struct {
+	suite.Suite
+	db *sql.DB
+}
+
+func (rs *RoutingSuite) SetupSuite() {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(rs.T(), databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	} else {
+		log.Println("Successfully established connection to database.")
+		rs.db = db
+	}
+}
+
+func (rs *RoutingSuite) TestResolveLines() {
+	t := rs.T()
+	accountDB := NewAccountDB(rs.db)
+	for _, account := range []*Account{
+		{ID: "routing_payable_42", Data: map[string]interface{}{"merchant_id": 42, "kind": "payable"}},
+		{ID: "routing_payable_43a", Data: map[string]interface{}{"merchant_id": "43", "kind": "payable"}},
+		{ID: "routing_payable_43b", Data: map[string]interface{}{"merchant_id": "43", "kind": "payable"}},
+	} {
+		assert.Nil(t, accountDB.CreateAccount(account), "Error creating account")
+	}
+	ruleDB := NewRoutingRuleDB(rs.db)
+	for _, rule := range []*RoutingRule{
+		{ID: "routing_fees", Pattern: "routing:fees:{currency}", Account: "routing_fees_{currency}"},
+		{ID: "routing_merchant", Pattern: "routing:merchant:{merchant_id}:{kind}", Priority: 1,
+			Lookup: map[string]string{"merchant_id": "{merchant_id}", "kind": "{kind}"}},
+	} {
+		assert.Nil(t, ruleDB.Create(rule), "Error creating routing rule")
+	}
+	aerr := ruleDB.Create(&RoutingRule{ID: "routing_fees", Pattern: "fees", Account: "fees"})
+	if assert.NotNil(t, aerr, "Duplicate rule should not be created") {
+		assert.Equal(t, "routing_rule.exists", aerr.ErrorCode(), "Invalid error code")
+	}
+
+	lines := []*TransactionLine{
+		{AccountRef: "routing:merchant:42:payable", Delta: -100},
+		{AccountRef: "routing:fees:usd", Delta: 10},
+		{AccountID: "routing_bank", Delta: 90},
+	}
+	assert.Nil(t, ruleDB.ResolveLines(lines), "Error resolving lines")
+	assert.Equal(t, []*TransactionLine{
+		{AccountID: "routing_payable_42", Delta: -100},
+		{AccountID: "routing_fees_usd", Delta: 10},
+		{AccountID: "routing_bank", Delta: 90},
+	}, lines, "Invalid resolved lines")
+
+	for ref, code := range map[string]string{
+		"routing:merchant:44:payable": "account_ref.unresolved",
+		"routing:merchant:43:payable": "account_ref.ambiguous",
+		"routing:customer:42":         "account_ref.unmatched",
+	} {
+		aerr := ruleDB.ResolveLines([]*TransactionLine{{AccountRef: ref}})
+		if assert.NotNil(t, aerr, "Reference should not be resolved: %v", ref) {
+			assert.Equal(t, code, aerr.ErrorCode(), "Invalid error code")
+		}
+	}
+}
+
+func (rs *RoutingSuite) TearDownSuite() {
+	t := rs.T()
+	for _, q := range []string{
+		"DELETE FROM routing_rules WHERE id LIKE 'routing%'",
+		"DELETE FROM accounts WHERE id LIKE 'routing%'",
+	} {
+		if _, err := rs.db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRoutingSuite(t *testing.T) {
+	suite.Run(t, new(RoutingSuite))
+}
@@ -0,0 +1,212 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// Statuses of scheduled transactions
+const (
+	ScheduledTransactionPending   = "pending"
+	ScheduledTransactionPosted    = "posted"
+	ScheduledTransactionFailed    = "failed"
+	ScheduledTransactionCancelled = "cancelled"
+)
+
+// ScheduledTransaction represents a transaction which is held until its `post_at` time.
+// The pending transactions aren't in the lines of the ledger, so they don't add to the balances.
+type ScheduledTransaction struct {
+	ID          string       `json:"id"`
+	Transaction *Transaction `json:"transaction"`
+	PostAt      string       `json:"post_at"`
+	Status      string       `json:"status"`
+	LastError   string       `json:"last_error,omitempty"`
+	CreatedAt   string       `json:"created_at"`
+	PostedAt    string       `json:"posted_at,omitempty"`
+}
+
+// ScheduledTransactionDB provides all functions related to scheduled transactions
+type ScheduledTransactionDB struct {
+	db *sql.DB
+}
+
+// NewScheduledTransactionDB provides instance of `ScheduledTransactionDB`
+func NewScheduledTransactionDB(db *sql.DB) ScheduledTransactionDB {
+	return ScheduledTransactionDB{db: db}
+}
+
+// Schedule holds the transaction until its `post_at` time. Scheduling the same transaction again
+// is ignored, and scheduling a different transaction with the same ID fails.
+func (st *ScheduledTransactionDB) Schedule(txn *Transaction, postAt time.Time) ledgerError.ApplicationError {
+	payload, err := json.Marshal(txn)
+	if err != nil {
+		return JSONError(err)
+	}
+	result, err := st.db.Exec(`INSERT INTO scheduled_transactions (id, transaction, post_at, status, created_at)
+			VALUES ($1, $2, $3, $4, $5) ON CONFLICT (id) DO NOTHING`,
+		txn.ID, string(payload), postAt.UTC(), ScheduledTransactionPending, time.Now().UTC())
+	if err != nil {
+		log.Println("Error executing schedule transaction query:", err)
+		return DBError(err)
+	}
+	if inserted, err := result.RowsAffected(); err != nil {
+		return DBError(err)
+	} else if inserted > 0 {
+		return nil
+	}
+
+	var duplicate bool
+	err = st.db.QueryRow("SELECT transaction = $2 AND post_at = $3 FROM scheduled_transactions WHERE id = $1",
+		txn.ID, string(payload), postAt.UTC()).Scan(&duplicate)
+	if err != nil {
+		return DBError(err)
+	}
+	if !duplicate {
+		return ScheduledTransactionExistsError(txn.ID)
+	}
+	return nil
+}
+
+// scanScheduledTransaction reads a scheduled transaction from the columns
+// `id, transaction, post_at, status, last_error, created_at, posted_at`
+func scanScheduledTransaction(row interface {
+	Scan(...interface{}) error
+}) (*ScheduledTransaction, error) {
+	scheduled := &ScheduledTransaction{}
+	var payload []byte
+	var lastError sql.NullString
+	var postAt, createdAt time.Time
+	var postedAt pq.NullTime
+	err := row.Scan(&scheduled.ID, &payload, &postAt, &scheduled.Status, &lastError, &createdAt, &postedAt)
+	if err != nil {
+		return nil, err
+	}
+	scheduled.Transaction = &Transaction{}
+	if err := json.Unmarshal(payload, scheduled.Transaction); err != nil {
+		return nil, err
+	}
+	scheduled.PostAt = postAt.Format(LedgerTimestampLayout)
+	scheduled.LastError = lastError.String
+	scheduled.CreatedAt = createdAt.Format(LedgerTimestampLayout)
+	if postedAt.Valid {
+		scheduled.PostedAt = postedAt.Time.Format(LedgerTimestampLayout)
+	}
+	return scheduled, nil
+}
+
+// Get returns the scheduled transaction with the given ID, or nil if it doesn't exist
+func (st *ScheduledTransactionDB) Get(id string) (*ScheduledTransaction, ledgerError.ApplicationError) {
+	row := st.db.QueryRow(`SELECT id, transaction, post_at, status, last_error, created_at, posted_at
+			FROM scheduled_transactions WHERE id = $1`, id)
+	scheduled, err := scanScheduledTransaction(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Println("Error executing scheduled transaction query:", err)
+		return nil, DBError(err)
+	}
+	return scheduled, nil
+}
+
+// List returns the scheduled transactions with the given status, or all of them when the status is empty,
+// in the order of their `post_at` time
+func (st *ScheduledTransactionDB) List(status string, limit int) ([]*ScheduledTransaction, ledgerError.ApplicationError) {
+	q := `SELECT id, transaction, post_at, status, last_error, created_at, posted_at
+			FROM scheduled_transactions WHERE ($1 = '' OR status = $1)
+			ORDER BY post_at, id LIMIT $2`
+	rows, err := st.db.Query(q, status, limit)
+	if err != nil {
+		log.Println("Error executing scheduled transactions query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	scheduled := make([]*ScheduledTransaction, 0)
+	for rows.Next() {
+		s, err := scanScheduledTransaction(rows)
+		if err != nil {
+			return nil, DBError(err)
+		}
+		scheduled = append(scheduled, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return scheduled, nil
+}
+
+// Cancel cancels the pending transaction with the given ID, unless it is being posted,
+// and says whether it was cancelled
+func (st *ScheduledTransactionDB) Cancel(id string) (bool, ledgerError.ApplicationError) {
+	now := time.Now().UTC()
+	result, err := st.db.Exec(`UPDATE scheduled_transactions SET status = $1
+			WHERE id = $2 AND status = $3 AND (claimed_until IS NULL OR claimed_until <= $4)`,
+		ScheduledTransactionCancelled, id, ScheduledTransactionPending, now)
+	if err != nil {
+		log.Println("Error executing cancel scheduled transaction query:", err)
+		return false, DBError(err)
+	}
+	cancelled, err := result.RowsAffected()
+	if err != nil {
+		return false, DBError(err)
+	}
+	return cancelled > 0, nil
+}
+
+// ClaimDue returns the pending transactions which are due, and holds them for `lease`
+// so that they aren't claimed again by another server or cancelled while being posted
+func (st *ScheduledTransactionDB) ClaimDue(limit int, lease time.Duration) ([]*ScheduledTransaction, ledgerError.ApplicationError) {
+	now := time.Now().UTC()
+	q := `UPDATE scheduled_transactions SET claimed_until = $1
+			WHERE id IN (
+				SELECT id FROM scheduled_transactions
+					WHERE status = $2 AND post_at <= $3 AND (claimed_until IS NULL OR claimed_until <= $3)
+					ORDER BY post_at
+					LIMIT $4
+					FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, transaction, post_at, status, last_error, created_at, posted_at`
+	rows, err := st.db.Query(q, now.Add(lease), ScheduledTransactionPending, now, limit)
+	if err != nil {
+		log.Println("Error executing claim scheduled transactions query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	var scheduled []*ScheduledTransaction
+	for rows.Next() {
+		s, err := scanScheduledTransaction(rows)
+		if err != nil {
+			return nil, DBError(err)
+		}
+		scheduled = append(scheduled, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return scheduled, nil
+}
+
+// MarkPosted records that the scheduled transaction is posted
+func (st *ScheduledTransactionDB) MarkPosted(id string) ledgerError.ApplicationError {
+	_, err := st.db.Exec(`UPDATE scheduled_transactions SET status = $1, last_error = NULL, claimed_until = NULL,
+			posted_at = $2 WHERE id = $3`, ScheduledTransactionPosted, time.Now().UTC(), id)
+	if err != nil {
+		return DBError(err)
+	}
+	return nil
+}
+
+// MarkFailed records that the scheduled transaction can't be posted
+func (st *ScheduledTransactionDB) MarkFailed(id string, lastError string) ledgerError.ApplicationError {
+	_, err := st.db.Exec(`UPDATE scheduled_transactions SET status = $1, last_error = $2, claimed_until = NULL
+			WHERE id = $3`, ScheduledTransactionFailed, lastError, id)
+	if err != nil {
+		return DBError(err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ScheduledTransactionsSuite struct {
+	suite.Suite
+	db *sql.DB
+}
+
+func (ss *ScheduledTransactionsSuite) SetupTest() {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(ss.T(), databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	} else {
+		log.Println("Successfully established connection to database.")
+		ss.db = db
+	}
+}
+
+func (ss *ScheduledTransactionsSuite) TestScheduleAndCancel() {
+	t := ss.T()
+	scheduledDB := NewScheduledTransactionDB(ss.db)
+	transaction := &Transaction{
+		ID: "scheduled_t001",
+		Lines: []*TransactionLine{
+			{AccountID: "scheduled_a1", Delta: 100},
+			{AccountID: "scheduled_a2", Delta: -100},
+		},
+	}
+	postAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+
+	assert.Nil(t, scheduledDB.Schedule(transaction, postAt), "Error while scheduling transaction")
+	assert.Nil(t, scheduledDB.Schedule(transaction, postAt), "Scheduling the same transaction should be ignored")
+	aerr := scheduledDB.Schedule(transaction, postAt.Add(time.Hour))
+	if assert.NotNil(t, aerr, "Rescheduling a transaction should fail") {
+		assert.Equal(t, "scheduled_transaction.exists", aerr.ErrorCode(), "Invalid error code")
+	}
+
+	// The transaction isn't due, so it is pending and not claimed
+	scheduled, aerr := scheduledDB.List(ScheduledTransactionPending, 100)
+	assert.Nil(t, aerr, "Error while listing scheduled transactions")
+	ids := make([]string, 0)
+	for _, s := range scheduled {
+		ids = append(ids, s.ID)
+	}
+	assert.Contains(t, ids, transaction.ID, "Scheduled transaction should be pending")
+	due, aerr := scheduledDB.ClaimDue(100, time.Minute)
+	assert.Nil(t, aerr, "Error while claiming scheduled transactions")
+	for _, s := range due {
+		assert.NotEqual(t, transaction.ID, s.ID, "Scheduled transaction shouldn't be due")
+	}
+
+	cancelled, aerr := scheduledDB.Cancel(transaction.ID)
+	assert.Nil(t, aerr, "Error while cancelling scheduled transaction")
+	assert.True(t, cancelled, "Scheduled transaction should be cancelled")
+	cancelled, _ = scheduledDB.Cancel(transaction.ID)
+	assert.False(t, cancelled, "Cancelled transaction should not be cancelled again")
+
+	s, aerr := scheduledDB.Get(transaction.ID)
+	assert.Nil(t, aerr, "Error while getting scheduled transaction")
+	assert.Equal(t, ScheduledTransactionCancelled, s.Status, "Invalid status")
+	assert.Equal(t, postAt.Format(LedgerTimestampLayout), s.PostAt, "Invalid post_at")
+	assert.Equal(t, 2, len(s.Transaction.Lines), "Invalid transaction lines")
+}
+
+func (ss *ScheduledTransactionsSuite) TestClaimDue() {
+	t := ss.T()
+	scheduledDB := NewScheduledTransactionDB(ss.db)
+	transaction := &Transaction{
+		ID: "scheduled_t002",
+		Lines: []*TransactionLine{
+			{AccountID: "scheduled_a1", Delta: 50},
+			{AccountID: "scheduled_a2", Delta: -50},
+		},
+	}
+	assert.Nil(t, scheduledDB.Schedule(transaction, time.Now().Add(-time.Second)), "Error while scheduling transaction")
+
+	due, aerr := scheduledDB.ClaimDue(100, time.Minute)
+	assert.Nil(t, aerr, "Error while claiming scheduled transactions")
+	claimed := false
+	for _, s := range due {
+		claimed = claimed || s.ID == transaction.ID
+	}
+	assert.True(t, claimed, "Due transaction should be claimed")
+
+	// A claimed transaction is held until it is posted
+	cancelled, _ := scheduledDB.Cancel(transaction.ID)
+	assert.False(t, cancelled, "Claimed transaction should not be cancelled")
+	due, _ = scheduledDB.ClaimDue(100, time.Minute)
+	for _, s := range due {
+		assert.NotEqual(t, transaction.ID, s.ID, "Claimed transaction should not be claimed again")
+	}
+
+	assert.Nil(t, scheduledDB.MarkPosted(transaction.ID), "Error while marking scheduled transaction as posted")
+	s, _ := scheduledDB.Get(transaction.ID)
+	assert.Equal(t, ScheduledTransactionPosted, s.Status, "Invalid status")
+	assert.NotEmpty(t, s.PostedAt, "Posted transaction should have posted_at")
+}
+
+func (ss *ScheduledTransactionsSuite) TearDownSuite() {
+	_, err := ss.db.Exec("DELETE FROM scheduled_transactions WHERE id LIKE $1", "scheduled_t%")
+	if err != nil {
+		ss.T().Fatal(err)
+	}
+}
+
+func TestScheduledTransactionsSuite(t *testing.T) {
+	suite.Run(t, new(ScheduledTransactionsSuite))
+}
@@ -1,12 +1,15 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	ledgerError "github.com/RealImage/QLedger/errors"
 )
@@ -22,10 +25,46 @@ var (
 	SortAscByTime = "asc"
 )
 
+// SearchPage represents a page of search results along with the cursor of the next page.
+// A page is truncated when the search exceeds its max execution time, and then holds only the items
+// read until then, with the cursor to resume the search after them.
+type SearchPage struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Truncated  bool        `json:"truncated,omitempty"`
+}
+
+// searchCursor represents the position after the last item of a page.
+// Transactions are ordered by timestamp or sequence and then ID, and accounts by ID.
+type searchCursor struct {
+	Timestamp string `json:"t,omitempty"`
+	Sequence  int64  `json:"s,omitempty"`
+	ID        string `json:"id"`
+}
+
+func encodeSearchCursor(cursor *searchCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSearchCursor(value string) (*searchCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("Invalid cursor in search query")
+	}
+	cursor := &searchCursor{}
+	if err := json.Unmarshal(data, cursor); err != nil || cursor.ID == "" {
+		return nil, errors.New("Invalid cursor in search query")
+	}
+	return cursor, nil
+}
+
 // SearchEngine is the interface for all search operations
 type SearchEngine struct {
 	db        *sql.DB
+	tx        *sql.Tx
 	namespace string
+	metadata  *MetadataScope
 }
 
 // TransactionResult represents the response format of transactions
@@ -33,20 +72,28 @@ type TransactionResult struct {
 	ID        string                   `json:"id"`
 	Timestamp string                   `json:"timestamp"`
 	Data      json.RawMessage          `json:"data"`
+	Category  string                   `json:"category,omitempty"`
 	Lines     []*TransactionLineResult `json:"lines"`
+	// ContentHash is missing for the transactions posted before the content hashes were stored
+	ContentHash string `json:"content_hash,omitempty"`
 }
 
 // TransactionLineResult represents the response format of transaction lines
 type TransactionLineResult struct {
 	AccountID string `json:"account"`
 	Delta     int    `json:"delta"`
+	Currency  string `json:"currency,omitempty"`
 }
 
 // AccountResult represents the response format of accounts
 type AccountResult struct {
-	ID      string          `json:"id"`
-	Balance int             `json:"balance"`
-	Data    json.RawMessage `json:"data"`
+	ID       string                 `json:"id"`
+	Balance  int                    `json:"balance"`
+	Balances json.RawMessage        `json:"balances"`
+	Data     json.RawMessage        `json:"data"`
+	Computed map[string]interface{} `json:"computed,omitempty"`
+	// DormantSince is set while the account is dormant
+	DormantSince string `json:"dormant_since,omitempty"`
 }
 
 // NewSearchEngine returns a new instance of `SearchEngine`
@@ -58,6 +105,16 @@ func NewSearchEngine(db *sql.DB, namespace string) (*SearchEngine, ledgerError.A
 	return &SearchEngine{db: db, namespace: namespace}, nil
 }
 
+// UseTx makes the search queries run within the DB transaction, such as one on a pinned read snapshot
+func (engine *SearchEngine) UseTx(tx *sql.Tx) {
+	engine.tx = tx
+}
+
+// UseMetadataScope restricts the data keys which the queries can search and the results can hold
+func (engine *SearchEngine) UseMetadataScope(metadata *MetadataScope) {
+	engine.metadata = metadata
+}
+
 // Query returns the results of a searc query
 func (engine *SearchEngine) Query(q string) (interface{}, ledgerError.ApplicationError) {
 	rawQuery, aerr := NewSearchRawQuery(q)
@@ -65,8 +122,46 @@ func (engine *SearchEngine) Query(q string) (interface{}, ledgerError.Applicatio
 		return nil, aerr
 	}
 
+	for _, key := range rawQuery.dataKeys() {
+		if !engine.metadata.CanRead(key) {
+			return nil, MetadataKeyForbiddenError("read", key)
+		}
+	}
+
+	sortKey := strings.TrimPrefix(rawQuery.Sort, "-")
+	if (engine.namespace == SearchNamespaceAccounts && (sortKey == "timestamp" || sortKey == "sequence")) ||
+		(engine.namespace == SearchNamespaceTransactions && sortKey == "id") {
+		return nil, SearchQueryInvalidError(errors.New("Invalid sort in search query"))
+	}
+
+	// The query is cancelled after the max execution time, and the rows read until then
+	// are returned as a truncated page
+	ctx := context.Background()
+	if rawQuery.MaxExecutionMS > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(rawQuery.MaxExecutionMS)*time.Millisecond)
+		defer cancel()
+	}
+	timedOut := func(err error) bool {
+		return err != nil && ctx.Err() == context.DeadlineExceeded
+	}
+
 	sqlQuery := rawQuery.ToSQLQuery(engine.namespace)
-	rows, err := engine.db.Query(sqlQuery.sql, sqlQuery.args...)
+	var rows *sql.Rows
+	var err error
+	if engine.tx != nil {
+		rows, err = engine.tx.QueryContext(ctx, sqlQuery.sql, sqlQuery.args...)
+	} else {
+		rows, err = engine.db.QueryContext(ctx, sqlQuery.sql, sqlQuery.args...)
+	}
+	if timedOut(err) {
+		// Nothing is read yet, so the search resumes from where it started
+		page := &SearchPage{Items: make([]*TransactionResult, 0), NextCursor: rawQuery.After, Truncated: true}
+		if engine.namespace == SearchNamespaceAccounts {
+			page.Items = make([]*AccountResult, 0)
+		}
+		return page, nil
+	}
 	if err != nil {
 		return nil, DBError(err)
 	}
@@ -77,36 +172,97 @@ func (engine *SearchEngine) Query(q string) (interface{}, ledgerError.Applicatio
 		accounts := make([]*AccountResult, 0)
 		for rows.Next() {
 			acc := &AccountResult{}
-			if err := rows.Scan(&acc.ID, &acc.Balance, &acc.Data); err != nil {
+			if err := rows.Scan(&acc.ID, &acc.Balance, &acc.Balances, &acc.Data, &acc.DormantSince); err != nil {
 				return nil, DBError(err)
 			}
+			if acc.Data, _, err = engine.metadata.FilterRawData(acc.Data); err != nil {
+				return nil, JSONError(err)
+			}
 			accounts = append(accounts, acc)
 		}
+		truncated := timedOut(rows.Err())
+		if err := rows.Err(); err != nil && !truncated {
+			return nil, DBError(err)
+		}
+		if rawQuery.PageSize > 0 {
+			// One more item than the page is read to know whether there is a next page
+			page := &SearchPage{Items: accounts, Truncated: truncated}
+			if len(accounts) > rawQuery.PageSize {
+				accounts = accounts[:rawQuery.PageSize]
+				page.Items = accounts
+				page.Truncated = false
+			} else if !page.Truncated {
+				return page, nil
+			}
+			page.NextCursor = rawQuery.After
+			if len(accounts) > 0 {
+				page.NextCursor = encodeSearchCursor(&searchCursor{ID: accounts[len(accounts)-1].ID})
+			}
+			return page, nil
+		}
 		return accounts, nil
 
 	case SearchNamespaceTransactions:
 		transactions := make([]*TransactionResult, 0)
+		var sequences []int64
 		for rows.Next() {
 			txn := &TransactionResult{}
-			var rawAccounts, rawDelta string
-			if err := rows.Scan(&txn.ID, &txn.Timestamp, &txn.Data, &rawAccounts, &rawDelta); err != nil {
+			var rawAccounts, rawDelta, rawCurrency string
+			var sequence int64
+			if err := rows.Scan(&txn.ID, &txn.Timestamp, &txn.Data, &rawAccounts, &rawDelta, &rawCurrency, &sequence, &txn.Category, &txn.ContentHash); err != nil {
 				return nil, DBError(err)
 			}
+			var filtered bool
+			if txn.Data, filtered, err = engine.metadata.FilterRawData(txn.Data); err != nil {
+				return nil, JSONError(err)
+			}
+			if filtered {
+				// The content hash covers the data keys which can't be read
+				txn.ContentHash = ""
+			}
+			sequences = append(sequences, sequence)
 
 			var accounts []string
 			var delta []int
+			var currency []string
 			json.Unmarshal([]byte(rawAccounts), &accounts)
 			json.Unmarshal([]byte(rawDelta), &delta)
+			json.Unmarshal([]byte(rawCurrency), &currency)
 			var lines []*TransactionLineResult
 			for i, acc := range accounts {
 				l := &TransactionLineResult{}
 				l.AccountID = acc
 				l.Delta = delta[i]
+				l.Currency = currency[i]
 				lines = append(lines, l)
 			}
 			txn.Lines = lines
 			transactions = append(transactions, txn)
 		}
+		truncated := timedOut(rows.Err())
+		if err := rows.Err(); err != nil && !truncated {
+			return nil, DBError(err)
+		}
+		if rawQuery.PageSize > 0 {
+			page := &SearchPage{Items: transactions, Truncated: truncated}
+			if len(transactions) > rawQuery.PageSize {
+				transactions = transactions[:rawQuery.PageSize]
+				page.Items = transactions
+				page.Truncated = false
+			} else if !page.Truncated {
+				return page, nil
+			}
+			page.NextCursor = rawQuery.After
+			if len(transactions) > 0 {
+				last := transactions[len(transactions)-1]
+				cursor := &searchCursor{Timestamp: last.Timestamp, ID: last.ID}
+				if rawQuery.sortBySequence() {
+					cursor = &searchCursor{Sequence: sequences[len(transactions)-1], ID: last.ID}
+				}
+				page.NextCursor = encodeSearchCursor(cursor)
+			}
+			return page, nil
+		}
 		return transactions, nil
 	default:
 		return nil, SearchNamespaceInvalidError(engine.namespace)
@@ -120,15 +276,63 @@ type QueryContainer struct {
 	RangeItems []map[string]map[string]interface{} `json:"ranges"`
 }
 
-// SearchRawQuery represents the format of search query
+// SearchRawQuery represents the format of search query.
+// The results are paginated with either `from` and `size`, or the `after` cursor and `limit`.
 type SearchRawQuery struct {
 	Offset   int    `json:"from,omitempty"`
 	Limit    int    `json:"size,omitempty"`
 	SortTime string `json:"sort_time,omitempty"`
-	Query    struct {
+	// Sort is `timestamp`, `-timestamp`, `sequence` or `-sequence` for transactions, and `id` or `-id` for accounts
+	Sort     string `json:"sort,omitempty"`
+	PageSize int    `json:"limit,omitempty"`
+	After    string `json:"after,omitempty"`
+	// MaxExecutionMS limits the time of a paginated search, after which it returns a truncated page
+	MaxExecutionMS int `json:"max_execution_ms,omitempty"`
+	Query          struct {
 		MustClause   QueryContainer `json:"must"`
 		ShouldClause QueryContainer `json:"should"`
 	} `json:"query"`
+	cursor *searchCursor
+}
+
+// sortDesc says whether the results are sorted in descending order.
+// The `sort_time` option applies only to transactions.
+func (rawQuery *SearchRawQuery) sortDesc(namespace string) bool {
+	if rawQuery.Sort != "" {
+		return strings.HasPrefix(rawQuery.Sort, "-")
+	}
+	return namespace == SearchNamespaceTransactions && rawQuery.SortTime == SortDescByTime
+}
+
+// sortBySequence says whether the transactions are sorted in the order they are posted, which is
+// the default of the keyset pagination. The cursors of the pages sorted by timestamp before it was
+// the default still continue in the order of timestamps.
+func (rawQuery *SearchRawQuery) sortBySequence() bool {
+	if rawQuery.Sort != "" {
+		return strings.TrimPrefix(rawQuery.Sort, "-") == "sequence"
+	}
+	if rawQuery.cursor != nil && rawQuery.cursor.Timestamp != "" {
+		return false
+	}
+	return rawQuery.PageSize > 0 && rawQuery.SortTime == ""
+}
+
+// dataKeys returns the data keys of the terms and ranges of the query
+func (rawQuery *SearchRawQuery) dataKeys() []string {
+	var keys []string
+	for _, clause := range []QueryContainer{rawQuery.Query.MustClause, rawQuery.Query.ShouldClause} {
+		for _, term := range clause.Terms {
+			for key := range term {
+				keys = append(keys, key)
+			}
+		}
+		for _, item := range clause.RangeItems {
+			for key := range item {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
 }
 
 // SearchSQLQuery hold information of search SQL query
@@ -163,6 +367,20 @@ func hasValidKeys(items interface{}) bool {
 	}
 }
 
+// hasValidPresenceChecks says whether the `exists` and `null` operators of the ranges have boolean values
+func hasValidPresenceChecks(ranges []map[string]map[string]interface{}) bool {
+	for _, item := range ranges {
+		for _, comparison := range item {
+			for op, value := range comparison {
+				if _, ok := value.(bool); (op == "exists" || op == "null") && !ok {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
 // NewSearchRawQuery returns a new instance of `SearchRawQuery`
 func NewSearchRawQuery(q string) (*SearchRawQuery, ledgerError.ApplicationError) {
 	var rawQuery *SearchRawQuery
@@ -184,6 +402,27 @@ func NewSearchRawQuery(q string) (*SearchRawQuery, ledgerError.ApplicationError)
 			return nil, SearchQueryInvalidError(errors.New("Invalid key(s) in search query"))
 		}
 	}
+	if !hasValidPresenceChecks(rawQuery.Query.MustClause.RangeItems) || !hasValidPresenceChecks(rawQuery.Query.ShouldClause.RangeItems) {
+		return nil, SearchQueryInvalidError(errors.New("Invalid exists or null check in search query"))
+	}
+	switch rawQuery.Sort {
+	case "", "timestamp", "-timestamp", "sequence", "-sequence", "id", "-id":
+	default:
+		return nil, SearchQueryInvalidError(errors.New("Invalid sort in search query"))
+	}
+	if rawQuery.PageSize < 0 || (rawQuery.After != "" && rawQuery.PageSize == 0) {
+		return nil, SearchQueryInvalidError(errors.New("Invalid limit in search query"))
+	}
+	if rawQuery.MaxExecutionMS < 0 || (rawQuery.MaxExecutionMS > 0 && rawQuery.PageSize == 0) {
+		return nil, SearchQueryInvalidError(errors.New("Invalid max_execution_ms in search query"))
+	}
+	if rawQuery.After != "" {
+		cursor, err := decodeSearchCursor(rawQuery.After)
+		if err != nil {
+			return nil, SearchQueryInvalidError(err)
+		}
+		rawQuery.cursor = cursor
+	}
 	return rawQuery, nil
 }
 
@@ -194,19 +433,27 @@ func (rawQuery *SearchRawQuery) ToSQLQuery(namespace string) *SearchSQLQuery {
 
 	switch namespace {
 	case SearchNamespaceAccounts:
-		q = "SELECT id, balance, data FROM current_balances"
+		q = `SELECT id, balance, balances, data,
+					COALESCE(to_char(dormant_since, 'YYYY-MM-DD HH24:MI:SS.MS'), '')
+			FROM current_balances`
 	case SearchNamespaceTransactions:
 		q = `SELECT id, timestamp, data,
 					array_to_json(ARRAY(
 						SELECT lines.account_id FROM lines
 							WHERE transaction_id=transactions.id
-							ORDER BY lines.account_id
+							ORDER BY lines.account_id, lines.id
 					)) AS account_array,
 					array_to_json(ARRAY(
 						SELECT lines.delta FROM lines
 							WHERE transaction_id=transactions.id
-							ORDER BY lines.account_id
-					)) AS delta_array
+							ORDER BY lines.account_id, lines.id
+					)) AS delta_array,
+					array_to_json(ARRAY(
+						SELECT lines.currency FROM lines
+							WHERE transaction_id=transactions.id
+							ORDER BY lines.account_id, lines.id
+					)) AS currency_array,
+					sequence, COALESCE(category, ''), COALESCE(content_hash, '')
 			FROM transactions`
 	default:
 		return nil
@@ -245,30 +492,51 @@ func (rawQuery *SearchRawQuery) ToSQLQuery(namespace string) *SearchSQLQuery {
 	var offset = rawQuery.Offset
 	var limit = rawQuery.Limit
 
-	if len(mustWhere) == 0 && len(shouldWhere) == 0 {
-		return &SearchSQLQuery{sql: q, args: args}
-	}
-
-	q += " WHERE "
+	// Keyset pagination continues after the cursor in the sort order
+	var where []string
 	if len(mustWhere) != 0 {
-		q += "(" + strings.Join(mustWhere, " AND ") + ")"
-		if len(shouldWhere) != 0 {
-			q += " AND "
-		}
+		where = append(where, "("+strings.Join(mustWhere, " AND ")+")")
 	}
-
 	if len(shouldWhere) != 0 {
-		q += "(" + strings.Join(shouldWhere, " OR ") + ")"
+		where = append(where, "("+strings.Join(shouldWhere, " OR ")+")")
 	}
-
-	if namespace == SearchNamespaceTransactions {
-		if rawQuery.SortTime == SortDescByTime {
-			q += " ORDER BY timestamp DESC"
+	comparison := ">"
+	direction := ""
+	if rawQuery.sortDesc(namespace) {
+		comparison = "<"
+		direction = " DESC"
+	}
+	if cursor := rawQuery.cursor; cursor != nil {
+		if namespace == SearchNamespaceTransactions && rawQuery.sortBySequence() {
+			where = append(where, "(sequence, id) "+comparison+" (?, ?)")
+			args = append(args, cursor.Sequence, cursor.ID)
+		} else if namespace == SearchNamespaceTransactions {
+			where = append(where, "(timestamp, id) "+comparison+" (?::timestamp, ?)")
+			args = append(args, cursor.Timestamp, cursor.ID)
 		} else {
-			q += " ORDER BY timestamp"
+			where = append(where, "id "+comparison+" ?")
+			args = append(args, cursor.ID)
 		}
 	}
+	if len(where) != 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	// The ID breaks the ties of timestamps, so that the order is stable across pages
+	if namespace == SearchNamespaceTransactions && rawQuery.sortBySequence() {
+		q += " ORDER BY sequence" + direction + ", id" + direction
+	} else if namespace == SearchNamespaceTransactions {
+		q += " ORDER BY timestamp" + direction + ", id" + direction
+	} else if rawQuery.PageSize > 0 || rawQuery.Sort != "" {
+		q += " ORDER BY id" + direction
+	}
 
+	if rawQuery.PageSize > 0 {
+		limit = rawQuery.PageSize + 1
+		if rawQuery.cursor != nil {
+			offset = 0
+		}
+	}
 	if offset > 0 {
 		q += " OFFSET " + strconv.Itoa(offset) + " "
 	}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchCursorPagination(t *testing.T) {
+	after := encodeSearchCursor(&searchCursor{Timestamp: "2017-08-08T10:00:00Z", ID: "txn1"})
+	rawQuery, err := NewSearchRawQuery(`{"limit": 2, "sort": "-timestamp", "after": "` + after + `"}`)
+	assert.Nil(t, err, "Error parsing search query")
+
+	sqlQuery := rawQuery.ToSQLQuery(SearchNamespaceTransactions)
+	assert.True(t, strings.HasSuffix(sqlQuery.sql, " WHERE (timestamp, id) < ($1::timestamp, $2) ORDER BY timestamp DESC, id DESC LIMIT 3"),
+		"Invalid search query: "+sqlQuery.sql)
+	assert.Equal(t, []interface{}{"2017-08-08T10:00:00Z", "txn1"}, sqlQuery.args, "Invalid search query arguments")
+
+	after = encodeSearchCursor(&searchCursor{ID: "acc1"})
+	rawQuery, err = NewSearchRawQuery(`{"limit": 10, "after": "` + after + `", "query": {"must": {"fields": [{"balance": {"gt": 0}}]}}}`)
+	assert.Nil(t, err, "Error parsing search query")
+	sqlQuery = rawQuery.ToSQLQuery(SearchNamespaceAccounts)
+	assert.True(t, strings.HasSuffix(sqlQuery.sql, " WHERE ((balance > $1)) AND id > $2 ORDER BY id LIMIT 11"),
+		"Invalid search query: "+sqlQuery.sql)
+
+	after = encodeSearchCursor(&searchCursor{Sequence: 42, ID: "txn1"})
+	rawQuery, err = NewSearchRawQuery(`{"limit": 5, "sort": "sequence", "after": "` + after + `"}`)
+	assert.Nil(t, err, "Error parsing search query")
+	sqlQuery = rawQuery.ToSQLQuery(SearchNamespaceTransactions)
+	assert.True(t, strings.HasSuffix(sqlQuery.sql, " WHERE (sequence, id) > ($1, $2) ORDER BY sequence, id LIMIT 6"),
+		"Invalid search query: "+sqlQuery.sql)
+	assert.Equal(t, []interface{}{int64(42), "txn1"}, sqlQuery.args, "Invalid search query arguments")
+
+	// The transactions are paginated by sequence by default
+	rawQuery, err = NewSearchRawQuery(`{"limit": 5}`)
+	assert.Nil(t, err, "Error parsing search query")
+	sqlQuery = rawQuery.ToSQLQuery(SearchNamespaceTransactions)
+	assert.True(t, strings.HasSuffix(sqlQuery.sql, " ORDER BY sequence, id LIMIT 6"), "Invalid search query: "+sqlQuery.sql)
+
+	after = encodeSearchCursor(&searchCursor{Timestamp: "2017-08-08T10:00:00Z", ID: "txn1"})
+	rawQuery, err = NewSearchRawQuery(`{"limit": 5, "after": "` + after + `"}`)
+	assert.Nil(t, err, "Error parsing search query")
+	sqlQuery = rawQuery.ToSQLQuery(SearchNamespaceTransactions)
+	assert.True(t, strings.HasSuffix(sqlQuery.sql, " WHERE (timestamp, id) > ($1::timestamp, $2) ORDER BY timestamp, id LIMIT 6"),
+		"Cursor by timestamp should continue by timestamp: "+sqlQuery.sql)
+}
+
+func TestSearchCursorValidation(t *testing.T) {
+	invalid := []string{
+		`{"limit": 10, "after": "not a cursor"}`,
+		`{"after": "` + encodeSearchCursor(&searchCursor{ID: "acc1"}) + `"}`,
+		`{"limit": -1}`,
+		`{"limit": 10, "sort": "balance"}`,
+		`{"limit": 10, "max_execution_ms": -1}`,
+		`{"max_execution_ms": 100}`,
+	}
+	for _, q := range invalid {
+		_, err := NewSearchRawQuery(q)
+		assert.NotNil(t, err, "Invalid search query is accepted: "+q)
+	}
+}
+
+func (ss *SearchSuite) TestSearchTransactionsBySequence() {
+	t := ss.T()
+	engine, _ := NewSearchEngine(ss.db, "transactions")
+
+	query := `{"limit": 2, "sort": "sequence", "query": {"must": {"terms": [{"action": "setcredit"}]}}}`
+	results, err := engine.Query(query)
+	assert.Equal(t, nil, err, "Error in building search query")
+	page, _ := results.(*SearchPage)
+	if !assert.NotNil(t, page, "Results should be paginated") {
+		return
+	}
+	transactions, _ := page.Items.([]*TransactionResult)
+	if assert.Equal(t, 2, len(transactions), "Transaction count doesn't match") {
+		assert.Equal(t, "txn1", transactions[0].ID, "Transactions should be in the posting order")
+		assert.Equal(t, "txn2", transactions[1].ID, "Transactions should be in the posting order")
+	}
+	assert.NotEmpty(t, page.NextCursor, "Missing next cursor")
+
+	query = `{"limit": 2, "sort": "sequence", "after": "` + page.NextCursor + `", "query": {"must": {"terms": [{"action": "setcredit"}]}}}`
+	results, err = engine.Query(query)
+	assert.Equal(t, nil, err, "Error in building search query")
+	page, _ = results.(*SearchPage)
+	transactions, _ = page.Items.([]*TransactionResult)
+	if assert.Equal(t, 1, len(transactions), "Transaction count doesn't match") {
+		assert.Equal(t, "txn3", transactions[0].ID, "Transactions should be in the posting order")
+	}
+	assert.Empty(t, page.NextCursor, "Last page should not have a next cursor")
+}
+
+func (ss *SearchSuite) TestSearchWithMaxExecutionTime() {
+	t := ss.T()
+	engine, _ := NewSearchEngine(ss.db, "transactions")
+
+	query := `{"limit": 2, "max_execution_ms": 10000, "query": {"must": {"terms": [{"action": "setcredit"}]}}}`
+	results, err := engine.Query(query)
+	assert.Equal(t, nil, err, "Error in building search query")
+	page, _ := results.(*SearchPage)
+	if assert.NotNil(t, page, "Results should be paginated") {
+		assert.False(t, page.Truncated, "Search within the max execution time should not be truncated")
+		assert.Equal(t, 2, len(page.Items.([]*TransactionResult)), "Transaction count doesn't match")
+		assert.NotEmpty(t, page.NextCursor, "Missing next cursor")
+	}
+}
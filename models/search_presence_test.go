@@ -0,0 +1,106 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// SearchPresenceSuite checks the `exists` and `null` operators on its own transactions,
+// where the `coupon` key is missing, null or set
+type SearchPresenceSuite struct {
+	suite.Suite
+	db *sql.DB
+}
+
+func (ss *SearchPresenceSuite) SetupSuite() {
+	t := ss.T()
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	assert.NotEmpty(t, databaseURL)
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Panic("Unable to connect to Database:", err)
+	}
+	ss.db = db
+
+	transactionDB := NewTransactionDB(db)
+	for id, data := range map[string]map[string]interface{}{
+		"presence1": {"action": "checkout"},
+		"presence2": {"action": "checkout", "coupon": nil},
+		"presence3": {"action": "checkout", "coupon": "SAVE10"},
+	} {
+		ok := transactionDB.Transact(&Transaction{
+			ID: id,
+			Lines: []*TransactionLine{
+				{AccountID: "presence-alice", Delta: -100},
+				{AccountID: "presence-bob", Delta: 100},
+			},
+			Data: data,
+		})
+		assert.Equal(t, true, ok, "Error creating test transaction")
+	}
+}
+
+func (ss *SearchPresenceSuite) search(check string) []*TransactionResult {
+	t := ss.T()
+	engine, _ := NewSearchEngine(ss.db, "transactions")
+	results, err := engine.Query(`{"query": {"must": {"ranges": [` + check + `]}}}`)
+	assert.Equal(t, nil, err, "Error in building search query")
+	transactions, _ := results.([]*TransactionResult)
+	return transactions
+}
+
+func (ss *SearchPresenceSuite) TestSearchTransactionsWithPresenceOperators() {
+	t := ss.T()
+
+	// Test key not present
+	transactions := ss.search(`{"coupon": {"exists": false}}`)
+	if assert.Equal(t, 1, len(transactions), "Transactions count doesn't match") {
+		assert.Equal(t, "presence1", transactions[0].ID, "Transaction ID doesn't match")
+	}
+
+	// Test key is null
+	transactions = ss.search(`{"coupon": {"null": true}}`)
+	if assert.Equal(t, 1, len(transactions), "Transactions count doesn't match") {
+		assert.Equal(t, "presence2", transactions[0].ID, "Transaction ID doesn't match")
+	}
+
+	// Test key present with a value
+	transactions = ss.search(`{"coupon": {"exists": true, "null": false}}`)
+	if assert.Equal(t, 1, len(transactions), "Transactions count doesn't match") {
+		assert.Equal(t, "presence3", transactions[0].ID, "Transaction ID doesn't match")
+	}
+
+	// Test key present, with or without a value
+	transactions = ss.search(`{"coupon": {"exists": true}}`)
+	assert.Equal(t, 2, len(transactions), "Transactions count doesn't match")
+}
+
+func TestSearchPresenceOperatorsInvalid(t *testing.T) {
+	for _, check := range []string{`{"coupon": {"exists": "no"}}`, `{"coupon": {"null": null}}`} {
+		_, err := NewSearchRawQuery(`{"query": {"should": {"ranges": [` + check + `]}}}`)
+		if assert.NotNil(t, err, "Invalid check should fail: %v", check) {
+			assert.Equal(t, "search.query.invalid", err.ErrorCode(), "Invalid error code")
+		}
+	}
+}
+
+func (ss *SearchPresenceSuite) TearDownSuite() {
+	log.Println("Cleaning up the test database")
+
+	t := ss.T()
+	for _, table := range []string{"lines", "transactions", "accounts"} {
+		if _, err := ss.db.Exec("DELETE FROM " + table); err != nil {
+			t.Fatal("Error deleting "+table+":", err)
+		}
+	}
+}
+
+func TestSearchPresenceSuite(t *testing.T) {
+	suite.Run(t, new(SearchPresenceSuite))
+}
@@ -135,6 +135,10 @@ func getSQLConditionAndArgsFromRange(key string, op string, value interface{}) (
 	}
 
 	switch op {
+	case "exists", "null":
+		// The values are validated as booleans with the query
+		check, _ := value.(bool)
+		condition = presenceCondition(key, op, check)
 	case "in", "nin":
 		// Convert IN, NOT IN condition to OR of EQ and NE conditions
 		var opnew string
@@ -161,6 +165,26 @@ func getSQLConditionAndArgsFromRange(key string, op string, value interface{}) (
 	return
 }
 
+// presenceCondition returns the condition on whether the key is present in `data`, or is present
+// with a `null` value. Unlike the `is` operator, they tell a missing key from a `null` value.
+func presenceCondition(key string, op string, check bool) string {
+	/*
+	   -- {"coupon": {"exists": false}}
+	   SELECT id FROM transactions WHERE data->'coupon' IS NULL;
+	   -- {"coupon": {"null": true}}
+	   SELECT id FROM transactions WHERE jsonb_typeof(data->'coupon') = 'null';
+	*/
+	switch {
+	case op == "exists" && check:
+		return fmt.Sprintf("data->'%s' IS NOT NULL", key)
+	case op == "exists":
+		return fmt.Sprintf("data->'%s' IS NULL", key)
+	case check:
+		return fmt.Sprintf("jsonb_typeof(data->'%s') = 'null'", key)
+	}
+	return fmt.Sprintf("jsonb_typeof(data->'%s') <> 'null'", key)
+}
+
 func convertFieldsToSQL(fields []map[string]map[string]interface{}) (where []string, args []interface{}) {
 	// Sample ranges
 	/*
@@ -0,0 +1,298 @@
+package models
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// Verification statuses of transaction signatures
+const (
+	SignatureVerified   = "verified"
+	SignatureInvalid    = "invalid"
+	SignatureKeyRevoked = "key_revoked"
+)
+
+// ClientKey represents a public key registered by a client to sign transactions
+type ClientKey struct {
+	ID        string `json:"id"`
+	Client    string `json:"client"`
+	PublicKey string `json:"public_key"`
+	CreatedAt string `json:"created_at,omitempty"`
+	RevokedAt string `json:"revoked_at,omitempty"`
+}
+
+// TransactionSignature represents a detached signature over the canonical content of a transaction
+type TransactionSignature struct {
+	KeyID string `json:"key_id"`
+	// Value is the base64 encoded signature
+	Value string `json:"value"`
+}
+
+// SignatureStatus represents the stored signature of a transaction and its verification status
+type SignatureStatus struct {
+	TransactionID string `json:"transaction_id"`
+	KeyID         string `json:"key_id"`
+	Client        string `json:"client"`
+	Signature     string `json:"signature"`
+	Status        string `json:"status"`
+	VerifiedAt    string `json:"verified_at"`
+}
+
+// CanonicalContent returns the canonical JSON of the ID, timestamp, data and lines of the transaction.
+// The keys are sorted, there is no insignificant whitespace and the lines are ordered by account, currency and delta.
+func (t *Transaction) CanonicalContent() ([]byte, error) {
+	content := t.canonicalPayload()
+	content["id"] = t.ID
+	return canonicalJSON(content)
+}
+
+// CanonicalHash returns the hex SHA-256 of the canonical JSON of the timestamp, data and lines of the transaction.
+// The ID isn't hashed, so that the same payload posted with different IDs has the same hash. The numbers
+// of the data are normalized by decoding, so that `100`, `100.0` and `1e2` are hashed alike.
+func (t *Transaction) CanonicalHash() (string, error) {
+	content, err := canonicalJSON(t.canonicalPayload())
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(content)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// canonicalPayload returns the timestamp, data and ordered lines of the transaction
+func (t *Transaction) canonicalPayload() map[string]interface{} {
+	lines := make([]*TransactionLine, len(t.Lines))
+	copy(lines, t.Lines)
+	sort.Sort(OrderedLines(lines))
+	return map[string]interface{}{
+		"timestamp": t.Timestamp,
+		"data":      nonNilData(t.Data),
+		"lines":     lines,
+	}
+}
+
+// canonicalJSON encodes the content with sorted keys and without insignificant whitespace or HTML escaping
+func canonicalJSON(content map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(content); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// ParsePublicKey parses a PEM encoded PKIX public key, which can be an ECDSA or an Ed25519 key
+func ParsePublicKey(publicKey string) (interface{}, error) {
+	block, _ := pem.Decode([]byte(publicKey))
+	if block == nil {
+		return nil, errors.New("Invalid PEM public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, errors.New("Unsupported public key type")
+}
+
+// VerifySignature verifies the base64 encoded signature of the content with the PEM encoded public key.
+// ECDSA signatures are ASN.1 encoded over the SHA-256 of the content.
+func VerifySignature(publicKey string, content []byte, signature string) bool {
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return false
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(content)
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, content, sig)
+	}
+	return false
+}
+
+// SignatureDB provides all functions related to client keys and transaction signatures
+type SignatureDB struct {
+	db *sql.DB
+}
+
+// NewSignatureDB provides instance of `SignatureDB`
+func NewSignatureDB(db *sql.DB) SignatureDB {
+	return SignatureDB{db: db}
+}
+
+// AddKey registers a client public key
+func (s *SignatureDB) AddKey(key *ClientKey) ledgerError.ApplicationError {
+	_, err := s.db.Exec("INSERT INTO client_keys (id, client, public_key, created_at) VALUES ($1, $2, $3, $4)",
+		key.ID, key.Client, key.PublicKey, time.Now().UTC())
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return ClientKeyExistsError(key.ID)
+		}
+		return DBError(err)
+	}
+	return nil
+}
+
+// RevokeKey revokes a client key, so that no more transactions can be signed with it.
+// It returns false if the key doesn't exist or is already revoked.
+func (s *SignatureDB) RevokeKey(id string) (bool, ledgerError.ApplicationError) {
+	result, err := s.db.Exec("UPDATE client_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL", time.Now().UTC(), id)
+	if err != nil {
+		return false, DBError(err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, DBError(err)
+	}
+	return count > 0, nil
+}
+
+// IsSigned says whether the transaction is stored with a signature
+func (s *SignatureDB) IsSigned(transactionID string) (bool, ledgerError.ApplicationError) {
+	var signed bool
+	err := s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM transaction_signatures WHERE transaction_id = $1)", transactionID).Scan(&signed)
+	if err != nil {
+		log.Println("Error executing transaction signature query:", err)
+		return false, DBError(err)
+	}
+	return signed, nil
+}
+
+// Verify says whether the client signature of a transaction is valid for the registered key.
+// The reason of an invalid signature is logged.
+func (s *SignatureDB) Verify(transaction *Transaction) (bool, ledgerError.ApplicationError) {
+	signature := transaction.Signature
+	if transaction.Timestamp == "" {
+		log.Println("Missing timestamp of signed transaction:", transaction.ID)
+		return false, nil
+	}
+	key, aerr := s.GetKey(signature.KeyID)
+	if aerr != nil {
+		return false, aerr
+	}
+	if key == nil || key.RevokedAt != "" {
+		log.Println("Unknown or revoked signing key:", signature.KeyID)
+		return false, nil
+	}
+	content, err := transaction.CanonicalContent()
+	if err != nil {
+		return false, JSONError(err)
+	}
+	if !VerifySignature(key.PublicKey, content, signature.Value) {
+		log.Println("Invalid signature of transaction:", transaction.ID)
+		return false, nil
+	}
+	return true, nil
+}
+
+func scanClientKey(scanner interface {
+	Scan(dest ...interface{}) error
+}) (*ClientKey, error) {
+	key := &ClientKey{}
+	var createdAt time.Time
+	var revokedAt pq.NullTime
+	if err := scanner.Scan(&key.ID, &key.Client, &key.PublicKey, &createdAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	key.CreatedAt = createdAt.Format(LedgerTimestampLayout)
+	if revokedAt.Valid {
+		key.RevokedAt = revokedAt.Time.Format(LedgerTimestampLayout)
+	}
+	return key, nil
+}
+
+// GetKey returns the client key with the given ID, or nil if it doesn't exist
+func (s *SignatureDB) GetKey(id string) (*ClientKey, ledgerError.ApplicationError) {
+	row := s.db.QueryRow("SELECT id, client, public_key, created_at, revoked_at FROM client_keys WHERE id = $1", id)
+	key, err := scanClientKey(row)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Println("Error executing client key query:", err)
+		return nil, DBError(err)
+	}
+	return key, nil
+}
+
+// ListKeys returns all the client keys
+func (s *SignatureDB) ListKeys() ([]*ClientKey, ledgerError.ApplicationError) {
+	rows, err := s.db.Query("SELECT id, client, public_key, created_at, revoked_at FROM client_keys ORDER BY id")
+	if err != nil {
+		log.Println("Error executing client keys query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	keys := make([]*ClientKey, 0)
+	for rows.Next() {
+		key, err := scanClientKey(rows)
+		if err != nil {
+			return nil, DBError(err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return keys, nil
+}
+
+// GetSignatureStatus re-verifies the stored signature of a transaction, or returns nil if it isn't signed
+func (s *SignatureDB) GetSignatureStatus(transaction *Transaction) (*SignatureStatus, ledgerError.ApplicationError) {
+	q := `SELECT transaction_signatures.key_id, transaction_signatures.signature, transaction_signatures.verified_at,
+				client_keys.client, client_keys.public_key, client_keys.revoked_at
+			FROM transaction_signatures JOIN client_keys ON transaction_signatures.key_id = client_keys.id
+			WHERE transaction_signatures.transaction_id = $1`
+	status := &SignatureStatus{TransactionID: transaction.ID}
+	var verifiedAt time.Time
+	var publicKey string
+	var revokedAt pq.NullTime
+	err := s.db.QueryRow(q, transaction.ID).Scan(&status.KeyID, &status.Signature, &verifiedAt,
+		&status.Client, &publicKey, &revokedAt)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Println("Error executing transaction signature query:", err)
+		return nil, DBError(err)
+	}
+	status.VerifiedAt = verifiedAt.Format(LedgerTimestampLayout)
+
+	content, err := transaction.CanonicalContent()
+	if err != nil {
+		return nil, JSONError(err)
+	}
+	switch {
+	case !VerifySignature(publicKey, content, status.Signature):
+		status.Status = SignatureInvalid
+	case revokedAt.Valid:
+		status.Status = SignatureKeyRevoked
+	default:
+		status.Status = SignatureVerified
+	}
+	return status, nil
+}
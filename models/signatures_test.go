@@ -0,0 +1,86 @@
+package models
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodePublicKey(t *testing.T, key interface{}) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	assert.Nil(t, err, "Error encoding public key")
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestCanonicalContent(t *testing.T) {
+	transaction := &Transaction{
+		ID:        "t001",
+		Timestamp: "2017-01-01 13:01:05.000",
+		Data:      map[string]interface{}{"note": "<b>", "amount": 100},
+		Lines: []*TransactionLine{
+			{AccountID: "bob", Delta: 100},
+			{AccountID: "alice", Delta: -100},
+		},
+	}
+	content, err := transaction.CanonicalContent()
+	assert.Nil(t, err, "Error encoding canonical content")
+	assert.Equal(t, `{"data":{"amount":100,"note":"<b>"},"id":"t001","lines":[{"account":"alice","delta":-100},{"account":"bob","delta":100}],"timestamp":"2017-01-01 13:01:05.000"}`, string(content))
+	assert.Equal(t, "bob", transaction.Lines[0].AccountID, "Lines of the transaction should not be reordered")
+}
+
+func TestCanonicalHash(t *testing.T) {
+	decode := func(payload string) *Transaction {
+		transaction := &Transaction{}
+		assert.Nil(t, json.Unmarshal([]byte(payload), transaction), "Error decoding transaction")
+		return transaction
+	}
+	hash := func(transaction *Transaction) string {
+		hash, err := transaction.CanonicalHash()
+		assert.Nil(t, err, "Error hashing transaction")
+		return hash
+	}
+
+	transaction := decode(`{"id": "t001", "timestamp": "2017-01-01 13:01:05.000", "data": {"amount": 100},
+		"lines": [{"account": "bob", "delta": 100}, {"account": "alice", "delta": -100}]}`)
+	assert.Equal(t, 64, len(hash(transaction)), "Hash should be the hex SHA-256")
+
+	// The ID, the order of the lines and keys, and the formats of the numbers don't change the hash
+	same := decode(`{"id": "t002", "data": {"amount": 1e2}, "timestamp": "2017-01-01 13:01:05.000",
+		"lines": [{"delta": -100, "account": "alice"}, {"account": "bob", "delta": 100}]}`)
+	assert.Equal(t, hash(transaction), hash(same), "Hashes of the same content should match")
+
+	other := decode(`{"id": "t001", "timestamp": "2017-01-01 13:01:05.000", "data": {"amount": 101},
+		"lines": [{"account": "bob", "delta": 100}, {"account": "alice", "delta": -100}]}`)
+	assert.NotEqual(t, hash(transaction), hash(other), "Hashes of different content should not match")
+}
+
+func TestVerifySignature(t *testing.T) {
+	content := []byte(`{"id":"t001"}`)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	digest := sha256.Sum256(content)
+	ecSig, err := ecdsa.SignASN1(rand.Reader, ecKey, digest[:])
+	assert.Nil(t, err)
+	ecPublicKey := encodePublicKey(t, &ecKey.PublicKey)
+	assert.True(t, VerifySignature(ecPublicKey, content, base64.StdEncoding.EncodeToString(ecSig)), "Valid ECDSA signature is rejected")
+	assert.False(t, VerifySignature(ecPublicKey, []byte(`{"id":"t002"}`), base64.StdEncoding.EncodeToString(ecSig)), "ECDSA signature of other content is accepted")
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	edSig := ed25519.Sign(edPrivate, content)
+	edPublicKey := encodePublicKey(t, edPublic)
+	assert.True(t, VerifySignature(edPublicKey, content, base64.StdEncoding.EncodeToString(edSig)), "Valid Ed25519 signature is rejected")
+	assert.False(t, VerifySignature(ecPublicKey, content, base64.StdEncoding.EncodeToString(edSig)), "Signature of another key is accepted")
+	assert.False(t, VerifySignature(edPublicKey, content, "not base64"), "Malformed signature is accepted")
+	assert.False(t, VerifySignature("not a key", content, base64.StdEncoding.EncodeToString(edSig)), "Malformed key is accepted")
+}
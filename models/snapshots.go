@@ -0,0 +1,182 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// Snapshot represents a named point in the sequence of transaction lines
+type Snapshot struct {
+	Name      string `json:"name"`
+	Sequence  int64  `json:"sequence"`
+	CreatedAt string `json:"created_at"`
+}
+
+// AccountDiff represents the change of an account balance in a currency between two snapshots
+type AccountDiff struct {
+	AccountID    string   `json:"account"`
+	Currency     string   `json:"currency,omitempty"`
+	FromBalance  int      `json:"from_balance"`
+	ToBalance    int      `json:"to_balance"`
+	Change       int      `json:"change"`
+	Transactions []string `json:"transactions"`
+}
+
+// SnapshotDiff represents the account balance changes between two snapshots
+type SnapshotDiff struct {
+	From     int64          `json:"from"`
+	To       int64          `json:"to"`
+	Accounts []*AccountDiff `json:"accounts"`
+}
+
+// SnapshotDB provides all functions related to snapshots
+type SnapshotDB struct {
+	db *sql.DB
+}
+
+// NewSnapshotDB provides instance of `SnapshotDB`
+func NewSnapshotDB(db *sql.DB) SnapshotDB {
+	return SnapshotDB{db: db}
+}
+
+// Create records a snapshot at the latest line.
+// Lines inserted by in-flight transactions are waited for, so that no line
+// with a lower ID can be committed after the snapshot.
+func (s *SnapshotDB) Create(name string) (*Snapshot, ledgerError.ApplicationError) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, DBError(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("LOCK TABLE lines IN SHARE MODE"); err != nil {
+		log.Println("Error locking lines for snapshot:", err)
+		return nil, DBError(err)
+	}
+	snapshot := &Snapshot{Name: name}
+	var createdAt time.Time
+	err = tx.QueryRow(`INSERT INTO snapshots (name, sequence, created_at)
+			SELECT $1, COALESCE(MAX(id), 0), now() AT TIME ZONE 'UTC' FROM lines
+			RETURNING sequence, created_at`, name).Scan(&snapshot.Sequence, &createdAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return nil, SnapshotExistsError(name)
+		}
+		log.Println("Error executing create snapshot query:", err)
+		return nil, DBError(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, DBError(err)
+	}
+	snapshot.CreatedAt = createdAt.Format(LedgerTimestampLayout)
+	return snapshot, nil
+}
+
+// List returns all the snapshots in chronological order
+func (s *SnapshotDB) List() ([]*Snapshot, ledgerError.ApplicationError) {
+	rows, err := s.db.Query("SELECT name, sequence, created_at FROM snapshots ORDER BY sequence, created_at")
+	if err != nil {
+		log.Println("Error executing snapshots query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	snapshots := make([]*Snapshot, 0)
+	for rows.Next() {
+		snapshot := &Snapshot{}
+		var createdAt time.Time
+		if err := rows.Scan(&snapshot.Name, &snapshot.Sequence, &createdAt); err != nil {
+			log.Println("Error scanning snapshots:", err)
+			return nil, DBError(err)
+		}
+		snapshot.CreatedAt = createdAt.Format(LedgerTimestampLayout)
+		snapshots = append(snapshots, snapshot)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating snapshots rows:", err)
+		return nil, DBError(err)
+	}
+	return snapshots, nil
+}
+
+// GetSequence returns the sequence point of the snapshot with the given name, or -1 if it doesn't exist
+func (s *SnapshotDB) GetSequence(name string) (int64, ledgerError.ApplicationError) {
+	var sequence int64
+	err := s.db.QueryRow("SELECT sequence FROM snapshots WHERE name = $1", name).Scan(&sequence)
+	switch {
+	case err == sql.ErrNoRows:
+		return -1, nil
+	case err != nil:
+		log.Println("Error executing snapshot query:", err)
+		return -1, DBError(err)
+	}
+	return sequence, nil
+}
+
+// CurrentSequence returns the sequence point of the latest line
+func (s *SnapshotDB) CurrentSequence() (int64, ledgerError.ApplicationError) {
+	var sequence int64
+	err := s.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM lines").Scan(&sequence)
+	if err != nil {
+		log.Println("Error executing current sequence query:", err)
+		return 0, DBError(err)
+	}
+	return sequence, nil
+}
+
+// Diff returns the balance changes of the accounts with lines after the `from`
+// sequence point up to the `to` sequence point, with the transactions of those lines
+func (s *SnapshotDB) Diff(from, to int64) (*SnapshotDiff, ledgerError.ApplicationError) {
+	q := `SELECT account_id, currency,
+				COALESCE(SUM(delta) FILTER (WHERE id <= $1), 0),
+				COALESCE(SUM(delta) FILTER (WHERE id > $1), 0),
+				array_agg(DISTINCT transaction_id) FILTER (WHERE id > $1)
+			FROM lines
+			WHERE id <= $2 AND account_id IN (SELECT account_id FROM lines WHERE id > $1 AND id <= $2)
+			GROUP BY account_id, currency
+			ORDER BY account_id, currency`
+	rows, err := s.db.Query(q, from, to)
+	if err != nil {
+		log.Println("Error executing snapshot diff query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+
+	diff := &SnapshotDiff{From: from, To: to, Accounts: make([]*AccountDiff, 0)}
+	for rows.Next() {
+		account := &AccountDiff{}
+		var transactions pq.StringArray
+		if err := rows.Scan(&account.AccountID, &account.Currency, &account.FromBalance, &account.Change, &transactions); err != nil {
+			log.Println("Error scanning snapshot diff:", err)
+			return nil, DBError(err)
+		}
+		account.ToBalance = account.FromBalance + account.Change
+		account.Transactions = []string(transactions)
+		diff.Accounts = append(diff.Accounts, account)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating snapshot diff rows:", err)
+		return nil, DBError(err)
+	}
+	return diff, nil
+}
+
+// committedSequence returns the latest line, after waiting for the in-flight transactions to commit
+func committedSequence(db *sql.DB) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("LOCK TABLE lines IN SHARE MODE"); err != nil {
+		return 0, err
+	}
+	var sequence int64
+	if err := tx.QueryRow("SELECT COALESCE(MAX(id), 0) FROM lines").Scan(&sequence); err != nil {
+		return 0, err
+	}
+	return sequence, tx.Commit()
+}
@@ -3,10 +3,14 @@ package models
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
+	"regexp"
+	"strings"
 	"time"
 
 	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/RealImage/QLedger/rounding"
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
 )
@@ -22,21 +26,94 @@ type Transaction struct {
 	Data      map[string]interface{} `json:"data"`
 	Timestamp string                 `json:"timestamp"`
 	Lines     []*TransactionLine     `json:"lines"`
+	// Signature is the optional client signature, stored along with the transaction
+	Signature *TransactionSignature `json:"signature,omitempty"`
+	// PostAt is the optional future time at which the transaction is scheduled to be posted
+	PostAt string `json:"post_at,omitempty"`
+	// ContentHash is the canonical hash of the transaction, which is computed by the ledger
+	ContentHash string `json:"content_hash,omitempty"`
+	// Reverses is the ID of the transaction reversed by this transaction, which is recorded by the ledger
+	// only for the reversals, unlike the `reverses` key of the data
+	Reverses string `json:"-"`
 }
 
-// TransactionLine represents a transaction line in a ledger
+// TransactionLine represents a transaction line in a ledger.
+// The currency is optional for ledgers with a single currency.
 type TransactionLine struct {
 	AccountID string `json:"account"`
 	Delta     int    `json:"delta"`
+	Currency  string `json:"currency,omitempty"`
+	// Rounding is the rounding policy of a delta computed by the ledger, such as a converted amount
+	Rounding string `json:"rounding,omitempty"`
+	// AccountRef is the reference resolved to the account by the routing rules when the line is posted,
+	// such as `merchant:42:payable`, in place of the account
+	AccountRef string `json:"account_ref,omitempty"`
 }
 
-// IsValid validates the delta list of a transaction
+// IsValid validates the delta list of a transaction,
+// which should balance to zero within each currency.
+// The IDs with the reversal suffix are reserved for the reversals.
 func (t *Transaction) IsValid() bool {
-	sum := 0
+	if strings.HasSuffix(t.ID, ReversalSuffix) || t.Reverses != "" {
+		if t.Reverses == "" || t.ID != ReversalID(t.Reverses) {
+			return false
+		}
+	}
+	sums := make(map[string]int)
+	for _, line := range t.Lines {
+		sums[line.Currency] += line.Delta
+	}
+	for _, sum := range sums {
+		if sum != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+var validDataKey = regexp.MustCompile(`^[a-z_A-Z]+$`)
+
+// ValidateData validates the keys of data, the line currencies and roundings, and the timestamp format of a transaction.
+// The lines with an account reference can't have an account, and the signed transactions can't have references,
+// as their signature covers the accounts.
+func (t *Transaction) ValidateData() error {
+	for key := range t.Data {
+		if !validDataKey.MatchString(key) {
+			return fmt.Errorf("Invalid key in data json: %v", key)
+		}
+	}
+	for _, line := range t.Lines {
+		if line.AccountRef != "" && (line.AccountID != "" || t.Signature != nil) {
+			return fmt.Errorf("Invalid account reference of line: %v", line.AccountRef)
+		}
+		if line.Currency != "" && !IsValidCurrency(line.Currency) {
+			return fmt.Errorf("Invalid currency of line: %v", line.Currency)
+		}
+		if line.Rounding != "" && !rounding.IsValid(line.Rounding) {
+			return fmt.Errorf("Invalid rounding of line: %v", line.Rounding)
+		}
+	}
+	// Validate timestamp format if present
+	if t.Timestamp != "" {
+		if _, err := time.Parse(LedgerTimestampLayout, t.Timestamp); err != nil {
+			return err
+		}
+	}
+	if t.PostAt != "" {
+		if _, err := time.Parse(LedgerTimestampLayout, t.PostAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AccountIDs returns the IDs of the accounts of the transaction lines
+func (t *Transaction) AccountIDs() []string {
+	ids := make([]string, 0, len(t.Lines))
 	for _, line := range t.Lines {
-		sum += line.Delta
+		ids = append(ids, line.AccountID)
 	}
-	return sum == 0
+	return ids
 }
 
 // TransactionDB is the interface to all transaction operations
@@ -62,65 +139,175 @@ func (t *TransactionDB) IsExists(id string) (bool, ledgerError.ApplicationError)
 
 // IsConflict says whether a transaction conflicts with an existing transaction
 func (t *TransactionDB) IsConflict(transaction *Transaction) (bool, ledgerError.ApplicationError) {
-	// Read existing lines
-	rows, err := t.db.Query("SELECT account_id, delta FROM lines WHERE transaction_id=$1", transaction.ID)
+	existingLines, err := readTransactionLines(t.db, transaction.ID)
 	if err != nil {
-		log.Println("Error executing transaction lines query:", err)
 		return false, DBError(err)
 	}
+	// Compare new and existing transaction lines
+	return !containsSameElements(transaction.Lines, existingLines), nil
+}
+
+// TransactionReplay represents a transaction repeated with the ID of an existing transaction
+type TransactionReplay struct {
+	// Kind is the kind of the replay as per the idempotency settings
+	Kind string
+	// Age is the time since the existing transaction was created
+	Age time.Duration
+	// Window is the idempotency window of the ledger, or zero if there's no limit
+	Window time.Duration
+}
+
+// Replay returns the replay of a transaction which already exists, as per the idempotency settings of the ledger
+func (t *TransactionDB) Replay(transaction *Transaction) (*TransactionReplay, ledgerError.ApplicationError) {
+	replay, err := readTransactionReplay(t.db, transaction)
+	if err != nil {
+		return nil, DBError(err)
+	}
+	return replay, nil
+}
+
+// readTransactionReplay compares a transaction with the existing transaction of its ID
+// from either the DB or an ongoing DB transaction. The transactions created before their
+// creation time was kept are as old as their timestamp.
+func readTransactionReplay(q interface {
+	Query(string, ...interface{}) (*sql.Rows, error)
+	QueryRow(string, ...interface{}) *sql.Row
+}, transaction *Transaction) (*TransactionReplay, error) {
+	settings, err := readIdempotencySettings(q)
+	if err != nil {
+		return nil, err
+	}
+	var ageSeconds float64
+	err = q.QueryRow(`SELECT EXTRACT(EPOCH FROM (timezone('utc', now()) - COALESCE(created_at, timestamp)))
+		FROM transactions WHERE id = $1`, transaction.ID).Scan(&ageSeconds)
+	if err != nil {
+		log.Println("Error executing transaction age query:", err)
+		return nil, err
+	}
+	existingLines, err := readTransactionLines(q, transaction.ID)
+	if err != nil {
+		return nil, err
+	}
+	age := time.Duration(ageSeconds * float64(time.Second))
+	sameLines := containsSameElements(transaction.Lines, existingLines)
+	return &TransactionReplay{Kind: settings.ReplayKind(age, sameLines), Age: age, Window: settings.Window()}, nil
+}
+
+// readTransactionLines reads the existing lines of a transaction
+// from either the DB or an ongoing DB transaction
+func readTransactionLines(q interface {
+	Query(string, ...interface{}) (*sql.Rows, error)
+}, id string) ([]*TransactionLine, error) {
+	rows, err := q.Query("SELECT account_id, delta, currency, COALESCE(rounding, '') FROM lines WHERE transaction_id=$1", id)
+	if err != nil {
+		log.Println("Error executing transaction lines query:", err)
+		return nil, err
+	}
 	defer rows.Close()
-	var existingLines []*TransactionLine
+	var lines []*TransactionLine
 	for rows.Next() {
 		line := &TransactionLine{}
-		if err := rows.Scan(&line.AccountID, &line.Delta); err != nil {
+		if err := rows.Scan(&line.AccountID, &line.Delta, &line.Currency, &line.Rounding); err != nil {
 			log.Println("Error scanning transaction lines:", err)
-			return false, DBError(err)
+			return nil, err
 		}
-		existingLines = append(existingLines, line)
+		lines = append(lines, line)
 	}
 	if err := rows.Err(); err != nil {
 		log.Println("Error iterating transaction lines rows:", err)
-		return false, DBError(err)
+		return nil, err
 	}
-
-	// Compare new and existing transaction lines
-	return !containsSameElements(transaction.Lines, existingLines), nil
+	return lines, nil
 }
 
-// Transact creates the input transaction in the DB
+// Transact creates the input transaction in the DB, and says whether it succeeded
 func (t *TransactionDB) Transact(txn *Transaction) bool {
+	_, aerr := t.Post(txn)
+	return aerr == nil
+}
+
+// Post creates the input transaction in the DB, unless it violates the constraints of its accounts.
+// A duplicate transaction is ignored and succeeds, and it says whether the transaction was created,
+// so that the side effects of a transaction happen once even when it is posted concurrently.
+func (t *TransactionDB) Post(txn *Transaction) (bool, ledgerError.ApplicationError) {
 	// Start the transaction
-	var err error
 	tx, err := t.db.Begin()
 	if err != nil {
 		log.Println("Error beginning transaction:", err)
-		return false
+		return false, DBError(err)
 	}
 
 	// Rollback transaction on any failures
-	handleTransactionError := func(tx *sql.Tx, err error) bool {
+	handleTransactionError := func(tx *sql.Tx, err error) ledgerError.ApplicationError {
 		log.Println(err)
 		log.Println("Rolling back the transaction:", txn.ID)
+		if rerr := tx.Rollback(); rerr != nil {
+			log.Println("Error rolling back transaction:", rerr)
+		}
+		if aerr, ok := err.(ledgerError.ApplicationError); ok {
+			return aerr
+		}
+		return DBError(err)
+	}
+
+	created, err := insertTransaction(tx, txn)
+	if err != nil {
+		return false, handleTransactionError(tx, err)
+	}
+	if !created {
+		// Ignore duplicate transactions and return success response
+		log.Println("Ignoring duplicate transaction of id:", txn.ID)
 		err = tx.Rollback()
 		if err != nil {
 			log.Println("Error rolling back transaction:", err)
 		}
-		return false
+		return false, nil
+	}
+
+	// Commit the entire transaction
+	err = commitTransactions(tx, []string{txn.ID})
+	if err != nil {
+		return false, handleTransactionError(tx, errors.Wrap(err, "commit transaction failed"))
 	}
 
+	return true, nil
+}
+
+// commitTransactions assigns the sequence of the created transactions and commits the DB transaction.
+// The sequence is assigned under a lock held until the commit, so that the transactions are sequenced
+// in the order they are committed, and a search paginating by sequence doesn't skip a transaction
+// committed after it has read past its sequence.
+func commitTransactions(tx *sql.Tx, ids []string) error {
+	if len(ids) > 0 {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('transactions_sequence'))"); err != nil {
+			return errors.Wrap(err, "lock transactions sequence failed")
+		}
+		for _, id := range ids {
+			_, err := tx.Exec("UPDATE transactions SET sequence = nextval('transactions_sequence_seq') WHERE id = $1", id)
+			if err != nil {
+				return errors.Wrap(err, "update transaction sequence failed")
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// insertTransaction adds the transaction with its accounts, lines and signature
+// within the DB transaction, and says whether it was created or already exists
+func insertTransaction(tx *sql.Tx, txn *Transaction) (bool, error) {
 	// Accounts do not need to be predefined
 	// they are called into existence when they are first used.
 	for _, line := range txn.Lines {
-		_, err = tx.Exec("INSERT INTO accounts (id) VALUES ($1) ON CONFLICT (id) DO NOTHING", line.AccountID)
+		_, err := tx.Exec("INSERT INTO accounts (id) VALUES ($1) ON CONFLICT (id) DO NOTHING", line.AccountID)
 		if err != nil {
-			return handleTransactionError(tx, errors.Wrap(err, "insert account failed"))
+			return false, errors.Wrap(err, "insert account failed")
 		}
 	}
 
 	// Add transaction
 	data, err := json.Marshal(txn.Data)
 	if err != nil {
-		return handleTransactionError(tx, errors.Wrap(err, "transaction data parse error"))
+		return false, errors.Wrap(err, "transaction data parse error")
 	}
 	transactionData := "{}"
 	if txn.Data != nil && data != nil {
@@ -131,35 +318,232 @@ func (t *TransactionDB) Transact(txn *Transaction) bool {
 		txn.Timestamp = time.Now().UTC().Format(LedgerTimestampLayout)
 	}
 
-	_, err = tx.Exec("INSERT INTO transactions (id, timestamp, data) VALUES ($1, $2, $3)", txn.ID, txn.Timestamp, transactionData)
+	txn.ContentHash, err = txn.CanonicalHash()
 	if err != nil {
-		// Ignore duplicate transactions and return success response
-		if err.(*pq.Error).Code.Name() == "unique_violation" {
-			log.Println("Ignoring duplicate transaction of id:", txn.ID)
-			err = tx.Rollback()
-			if err != nil {
-				log.Println("Error rolling back transaction:", err)
-			}
-			return true
+		return false, errors.Wrap(err, "transaction content hash failed")
+	}
+
+	// The conflicts on the reversed transaction are the concurrent reversals of the transaction
+	result, err := tx.Exec("INSERT INTO transactions (id, timestamp, data, content_hash, reverses) VALUES ($1, $2, $3, $4, NULLIF($5, '')) ON CONFLICT DO NOTHING",
+		txn.ID, txn.Timestamp, transactionData, txn.ContentHash, txn.Reverses)
+	if err != nil {
+		return false, errors.Wrap(err, "insert transaction failed")
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "insert transaction failed")
+	}
+	if inserted == 0 {
+		return false, nil
+	}
+
+	// Lock the accounts with constraints until the transaction is committed,
+	// so that the concurrent transactions of an account are checked one by one
+	constraints, err := lockAccountConstraints(tx, txn)
+	if err != nil {
+		return false, err
+	}
+	for _, line := range txn.Lines {
+		if c, ok := constraints[line.AccountID]; ok && c.Frozen {
+			return false, AccountFrozenError(line.AccountID)
 		}
-		return handleTransactionError(tx, errors.Wrap(err, "insert transaction failed"))
 	}
 
 	// Add transaction lines
 	for _, line := range txn.Lines {
-		_, err = tx.Exec("INSERT INTO lines (transaction_id, account_id, delta) VALUES ($1, $2, $3)", txn.ID, line.AccountID, line.Delta)
+		_, err = tx.Exec("INSERT INTO lines (transaction_id, account_id, delta, currency, rounding) VALUES ($1, $2, $3, $4, NULLIF($5, ''))",
+			txn.ID, line.AccountID, line.Delta, line.Currency, line.Rounding)
 		if err != nil {
-			return handleTransactionError(tx, errors.Wrap(err, "insert lines failed"))
+			return false, errors.Wrap(err, "insert lines failed")
 		}
 	}
 
-	// Commit the entire transaction
-	err = tx.Commit()
+	if err := checkMinBalances(tx, txn, constraints); err != nil {
+		return false, err
+	}
+
+	if err := categorizeTransaction(tx, txn.ID); err != nil {
+		return false, errors.Wrap(err, "categorize transaction failed")
+	}
+
+	// Add the verified client signature
+	if txn.Signature != nil {
+		_, err = tx.Exec("INSERT INTO transaction_signatures (transaction_id, key_id, signature, verified_at) VALUES ($1, $2, $3, $4)",
+			txn.ID, txn.Signature.KeyID, txn.Signature.Value, time.Now().UTC())
+		if err != nil {
+			return false, errors.Wrap(err, "insert signature failed")
+		}
+	}
+	return true, nil
+}
+
+// lockAccountConstraints locks the accounts of the transaction which have constraints,
+// and returns their constraints by account
+func lockAccountConstraints(tx *sql.Tx, txn *Transaction) (map[string]*AccountConstraints, error) {
+	accountIDs := make([]string, 0, len(txn.Lines))
+	for _, line := range txn.Lines {
+		accountIDs = append(accountIDs, line.AccountID)
+	}
+	rows, err := tx.Query(`SELECT id, min_balance, frozen FROM accounts
+			WHERE id = ANY($1) AND (frozen OR min_balance IS NOT NULL)
+			ORDER BY id FOR UPDATE`, pq.Array(accountIDs))
 	if err != nil {
-		return handleTransactionError(tx, errors.Wrap(err, "commit transaction failed"))
+		return nil, errors.Wrap(err, "lock accounts failed")
+	}
+	defer rows.Close()
+	constraints := make(map[string]*AccountConstraints)
+	for rows.Next() {
+		var id string
+		var minBalance sql.NullInt64
+		c := &AccountConstraints{}
+		if err := rows.Scan(&id, &minBalance, &c.Frozen); err != nil {
+			return nil, errors.Wrap(err, "lock accounts failed")
+		}
+		if minBalance.Valid {
+			value := int(minBalance.Int64)
+			c.MinBalance = &value
+		}
+		constraints[id] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "lock accounts failed")
 	}
+	return constraints, nil
+}
 
-	return true
+// checkMinBalances checks that the balances of the accounts with a minimum balance,
+// which are decreased by the transaction, don't go below their minimum
+func checkMinBalances(tx *sql.Tx, txn *Transaction, constraints map[string]*AccountConstraints) error {
+	type accountCurrency struct{ account, currency string }
+	deltas := make(map[accountCurrency]int)
+	var decreased []accountCurrency
+	for _, line := range txn.Lines {
+		if c, ok := constraints[line.AccountID]; !ok || c.MinBalance == nil {
+			continue
+		}
+		key := accountCurrency{line.AccountID, line.Currency}
+		if _, ok := deltas[key]; !ok {
+			decreased = append(decreased, key)
+		}
+		deltas[key] += line.Delta
+	}
+	for _, key := range decreased {
+		if deltas[key] >= 0 {
+			continue
+		}
+		var balance int
+		err := tx.QueryRow("SELECT COALESCE(SUM(delta), 0) FROM lines WHERE account_id=$1 AND currency=$2",
+			key.account, key.currency).Scan(&balance)
+		if err != nil {
+			return errors.Wrap(err, "read balance failed")
+		}
+		if balance < *constraints[key.account].MinBalance {
+			return AccountMinBalanceError(key.account, key.currency)
+		}
+	}
+	return nil
+}
+
+// Statuses of the transactions of a bulk request
+const (
+	BulkStatusCreated   = "created"
+	BulkStatusDuplicate = "duplicate"
+	BulkStatusFailed    = "failed"
+
+	// BulkReasonConflict is the failure reason of a transaction
+	// conflicting with an existing transaction of the same ID
+	BulkReasonConflict = "conflicts with an existing transaction"
+	// BulkReasonReplayExpired is the failure reason of a transaction repeated
+	// after the idempotency window of the existing transaction of the same ID
+	BulkReasonReplayExpired = "repeats a transaction beyond the idempotency window"
+)
+
+// BulkResult is the outcome of a single transaction of a bulk request
+type BulkResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+	// ContentHash is the canonical hash of a created transaction
+	ContentHash string `json:"content_hash,omitempty"`
+	// Replay is the replay of a transaction which already exists
+	Replay *TransactionReplay `json:"-"`
+}
+
+// TransactBatch creates the input transactions in a single DB transaction.
+// Each transaction is isolated by a savepoint, so that a failed or
+// conflicting transaction doesn't affect the others of the batch.
+func (t *TransactionDB) TransactBatch(txns []*Transaction) ([]*BulkResult, ledgerError.ApplicationError) {
+	tx, err := t.db.Begin()
+	if err != nil {
+		log.Println("Error beginning batch transaction:", err)
+		return nil, DBError(err)
+	}
+
+	results := make([]*BulkResult, len(txns))
+	var created []string
+	for i, txn := range txns {
+		results[i] = &BulkResult{ID: txn.ID}
+		if _, err := tx.Exec("SAVEPOINT bulk_item"); err != nil {
+			log.Println("Error creating savepoint:", err)
+			tx.Rollback()
+			return nil, DBError(err)
+		}
+
+		status, reason, replay, err := transactBatchItem(tx, txn)
+		if err != nil {
+			log.Printf("Error in batch transaction: %v (%v)", txn.ID, err)
+			status, reason = BulkStatusFailed, err.Error()
+			if aerr, ok := err.(ledgerError.ApplicationError); ok {
+				reason = aerr.ErrorMessage()
+			}
+			if _, err := tx.Exec("ROLLBACK TO SAVEPOINT bulk_item"); err != nil {
+				log.Println("Error rolling back to savepoint:", err)
+				tx.Rollback()
+				return nil, DBError(err)
+			}
+		}
+		results[i].Status, results[i].Reason, results[i].Replay = status, reason, replay
+		if status == BulkStatusCreated {
+			results[i].ContentHash = txn.ContentHash
+			created = append(created, txn.ID)
+		}
+
+		if _, err := tx.Exec("RELEASE SAVEPOINT bulk_item"); err != nil {
+			log.Println("Error releasing savepoint:", err)
+			tx.Rollback()
+			return nil, DBError(err)
+		}
+	}
+
+	if err := commitTransactions(tx, created); err != nil {
+		log.Println("Error committing batch transaction:", err)
+		tx.Rollback()
+		return nil, DBError(err)
+	}
+	return results, nil
+}
+
+// transactBatchItem creates a transaction of a batch and returns its status, along with
+// its replay if it already exists
+func transactBatchItem(tx *sql.Tx, txn *Transaction) (string, string, *TransactionReplay, error) {
+	created, err := insertTransaction(tx, txn)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if created {
+		return BulkStatusCreated, "", nil, nil
+	}
+	replay, err := readTransactionReplay(tx, txn)
+	if err != nil {
+		return "", "", nil, err
+	}
+	switch replay.Kind {
+	case ReplayConflict:
+		return BulkStatusFailed, BulkReasonConflict, replay, nil
+	case ReplayExpired:
+		return BulkStatusFailed, BulkReasonReplayExpired, replay, nil
+	}
+	return BulkStatusDuplicate, "", replay, nil
 }
 
 // UpdateTransaction updates data of the given transaction
@@ -173,10 +557,97 @@ func (t *TransactionDB) UpdateTransaction(txn *Transaction) ledgerError.Applicat
 		tData = string(data)
 	}
 
-	q := "UPDATE transactions SET data = $1 WHERE id = $2"
-	_, err = t.db.Exec(q, tData, txn.ID)
+	// The content hash covers the data, so it is computed again along with the existing timestamp and lines
+	existing, aerr := t.GetByID(txn.ID)
+	if aerr != nil {
+		return aerr
+	}
+	if existing == nil {
+		return nil
+	}
+	existing.Data = txn.Data
+	contentHash, err := existing.CanonicalHash()
+	if err != nil {
+		return JSONError(err)
+	}
+
+	q := "UPDATE transactions SET data = $1, content_hash = $2 WHERE id = $3"
+	_, err = t.db.Exec(q, tData, contentHash, txn.ID)
 	if err != nil {
 		return DBError(err)
 	}
 	return nil
 }
+
+// ReversalSuffix is the suffix of the reversal IDs, which can't be used by the other transactions
+const ReversalSuffix = ".reversal"
+
+// ReversalID returns the ID of the transaction reversing the transaction with the given ID
+func ReversalID(id string) string {
+	return id + ReversalSuffix
+}
+
+// Reversal returns a transaction with the negated lines of the transaction,
+// linked back to it by the `reverses` key of the data
+func (t *Transaction) Reversal() *Transaction {
+	reversal := &Transaction{
+		ID:       ReversalID(t.ID),
+		Data:     map[string]interface{}{"reverses": t.ID},
+		Reverses: t.ID,
+	}
+	for _, line := range t.Lines {
+		reversal.Lines = append(reversal.Lines, &TransactionLine{AccountID: line.AccountID, Delta: -line.Delta, Currency: line.Currency})
+	}
+	return reversal
+}
+
+// GetByID returns the transaction with its lines, or nil if it doesn't exist
+func (t *TransactionDB) GetByID(id string) (*Transaction, ledgerError.ApplicationError) {
+	txn := &Transaction{ID: id}
+	var rawData []byte
+	var timestamp time.Time
+	err := t.db.QueryRow("SELECT timestamp, data, COALESCE(content_hash, ''), COALESCE(reverses, '') FROM transactions WHERE id=$1", id).Scan(&timestamp, &rawData, &txn.ContentHash, &txn.Reverses)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, nil
+	case err != nil:
+		log.Println("Error executing transaction query:", err)
+		return nil, DBError(err)
+	}
+	txn.Timestamp = timestamp.Format(LedgerTimestampLayout)
+	if err := json.Unmarshal(rawData, &txn.Data); err != nil {
+		return nil, JSONError(err)
+	}
+
+	rows, err := t.db.Query("SELECT account_id, delta, currency, COALESCE(rounding, '') FROM lines WHERE transaction_id=$1 ORDER BY id", id)
+	if err != nil {
+		log.Println("Error executing transaction lines query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		line := &TransactionLine{}
+		if err := rows.Scan(&line.AccountID, &line.Delta, &line.Currency, &line.Rounding); err != nil {
+			log.Println("Error scanning transaction lines:", err)
+			return nil, DBError(err)
+		}
+		txn.Lines = append(txn.Lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating transaction lines rows:", err)
+		return nil, DBError(err)
+	}
+	return txn, nil
+}
+
+// IsReversed says whether a transaction has already been reversed, by the existence of its reversal.
+// The `reverses` key of the data isn't checked, as any transaction can be posted with it.
+func (t *TransactionDB) IsReversed(id string) (bool, ledgerError.ApplicationError) {
+	var reversed bool
+	err := t.db.QueryRow("SELECT EXISTS (SELECT id FROM transactions WHERE reverses = $1)", id).Scan(&reversed)
+	if err != nil {
+		log.Println("Error executing transaction reversal query:", err)
+		return false, DBError(err)
+	}
+	return reversed, nil
+}
@@ -51,6 +51,40 @@ func (ts *TransactionsModelSuite) TestIsValid() {
 	transaction.Lines[0].Delta = 200
 	valid = transaction.IsValid()
 	assert.Equal(t, valid, false, "Transaction should not be valid")
+
+	// Lines should balance within each currency
+	transaction.Lines = []*TransactionLine{
+		{AccountID: "a1", Delta: 100, Currency: "USD"},
+		{AccountID: "a2", Delta: -100, Currency: "USD"},
+		{AccountID: "a1", Delta: -6500, Currency: "INR"},
+		{AccountID: "a2", Delta: 6500, Currency: "INR"},
+	}
+	valid = transaction.IsValid()
+	assert.Equal(t, valid, true, "Transaction should be valid")
+
+	transaction.Lines = []*TransactionLine{
+		{AccountID: "a1", Delta: 100, Currency: "USD"},
+		{AccountID: "a2", Delta: -100, Currency: "INR"},
+	}
+	valid = transaction.IsValid()
+	assert.Equal(t, valid, false, "Transaction should not be valid")
+
+	// The reversal IDs are reserved for the reversals
+	transaction.ID = "t001.reversal"
+	transaction.Lines = []*TransactionLine{
+		{AccountID: "a1", Delta: 100},
+		{AccountID: "a2", Delta: -100},
+	}
+	valid = transaction.IsValid()
+	assert.Equal(t, valid, false, "Transaction should not be valid")
+
+	transaction.Reverses = "t001"
+	valid = transaction.IsValid()
+	assert.Equal(t, valid, true, "Transaction should be valid")
+
+	transaction.ID = "t002"
+	valid = transaction.IsValid()
+	assert.Equal(t, valid, false, "Transaction should not be valid")
 }
 
 func (ts *TransactionsModelSuite) TestIsExists() {
@@ -241,6 +275,93 @@ func (ts *TransactionsModelSuite) TestTransactWithBoundaryValues() {
 	// The test case is written in `package controllers` using JSON
 }
 
+func (ts *TransactionsModelSuite) TestAccountConstraints() {
+	t := ts.T()
+
+	accountDB := NewAccountDB(ts.db)
+	minBalance := 0
+	err := accountDB.CreateAccount(&Account{ID: "c-wallet", Constraints: &AccountConstraints{MinBalance: &minBalance}})
+	assert.Equal(t, nil, err, "Error while creating account")
+	err = accountDB.CreateAccount(&Account{ID: "c-frozen", Constraints: &AccountConstraints{Frozen: true}})
+	assert.Equal(t, nil, err, "Error while creating account")
+
+	transactionDB := NewTransactionDB(ts.db)
+	transfer := func(id string, from string, to string, amount int) *Transaction {
+		return &Transaction{
+			ID: id,
+			Lines: []*TransactionLine{
+				{AccountID: from, Delta: -amount},
+				{AccountID: to, Delta: amount},
+			},
+		}
+	}
+	created, aerr := transactionDB.Post(transfer("c001", "c-bank", "c-wallet", 100))
+	assert.Equal(t, nil, aerr, "Deposit should succeed")
+	assert.True(t, created, "Deposit should be created")
+	_, aerr = transactionDB.Post(transfer("c002", "c-wallet", "c-bank", 100))
+	assert.Equal(t, nil, aerr, "Withdrawal down to the minimum should succeed")
+
+	// A duplicate transaction succeeds without being created again
+	created, aerr = transactionDB.Post(transfer("c001", "c-bank", "c-wallet", 100))
+	assert.Equal(t, nil, aerr, "Duplicate transaction should succeed")
+	assert.False(t, created, "Duplicate transaction should not be created")
+
+	_, aerr = transactionDB.Post(transfer("c003", "c-wallet", "c-bank", 1))
+	if assert.NotNil(t, aerr, "Withdrawal below the minimum should fail") {
+		assert.Equal(t, "account.min_balance", aerr.ErrorCode(), "Invalid error code")
+	}
+	exists, _ := transactionDB.IsExists("c003")
+	assert.Equal(t, false, exists, "Failed transaction should not exist")
+
+	_, aerr = transactionDB.Post(transfer("c004", "c-bank", "c-frozen", 100))
+	if assert.NotNil(t, aerr, "Transaction of frozen account should fail") {
+		assert.Equal(t, "account.frozen", aerr.ErrorCode(), "Invalid error code")
+	}
+
+	// Unfreezing the account allows its transactions
+	err = accountDB.UpdateAccount(&Account{ID: "c-frozen", Constraints: &AccountConstraints{}})
+	assert.Equal(t, nil, err, "Error while updating account")
+	_, aerr = transactionDB.Post(transfer("c004", "c-bank", "c-frozen", 100))
+	assert.Equal(t, nil, aerr, "Transaction of unfrozen account should succeed")
+
+	account, err := accountDB.GetByID("c-wallet")
+	assert.Equal(t, nil, err, "Error while getting account")
+	if assert.NotNil(t, account.Constraints, "Account should have constraints") {
+		assert.Equal(t, 0, *account.Constraints.MinBalance, "Invalid minimum balance")
+	}
+}
+
+func (ts *TransactionsModelSuite) TestContentHash() {
+	t := ts.T()
+
+	transactionDB := NewTransactionDB(ts.db)
+	transaction := &Transaction{
+		ID:        "hashed1",
+		Timestamp: "2017-01-01 13:00:00.000",
+		Data:      map[string]interface{}{"note": "rent"},
+		Lines: []*TransactionLine{
+			{AccountID: "hashed-alice", Delta: -100},
+			{AccountID: "hashed-bob", Delta: 100},
+		},
+	}
+	_, aerr := transactionDB.Post(transaction)
+	assert.Equal(t, nil, aerr, "Error while posting transaction")
+	assert.NotEmpty(t, transaction.ContentHash, "Posted transaction should have a content hash")
+
+	stored, err := transactionDB.GetByID("hashed1")
+	assert.Equal(t, nil, err, "Error while getting transaction")
+	assert.Equal(t, transaction.ContentHash, stored.ContentHash, "Stored content hash should match the posted hash")
+
+	// The hash follows the updated data
+	err = transactionDB.UpdateTransaction(&Transaction{ID: "hashed1", Data: map[string]interface{}{"note": "deposit"}})
+	assert.Equal(t, nil, err, "Error while updating transaction")
+	updated, err := transactionDB.GetByID("hashed1")
+	assert.Equal(t, nil, err, "Error while getting transaction")
+	assert.NotEqual(t, transaction.ContentHash, updated.ContentHash, "Content hash should change with the data")
+	expected, _ := updated.CanonicalHash()
+	assert.Equal(t, expected, updated.ContentHash, "Stored content hash should match the updated transaction")
+}
+
 func (ts *TransactionsModelSuite) TearDownSuite() {
 	log.Println("Cleaning up the test database")
 
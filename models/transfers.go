@@ -0,0 +1,146 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/RealImage/QLedger/rounding"
+)
+
+// FXAccountPrefix is the prefix of the accounts used to convert between currencies,
+// the currency code is appended to it (e.g. `fx.USD`)
+var FXAccountPrefix = "fx."
+
+var validCurrency = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// IsValidCurrency says whether the currency is an ISO 4217 alphabetic code
+func IsValidCurrency(currency string) bool {
+	return validCurrency.MatchString(currency)
+}
+
+// Transfer represents the movement of an amount between two accounts,
+// a shorthand of a transaction with two lines, or four lines when
+// the amount is converted between currencies
+type Transfer struct {
+	ID           string                 `json:"id"`
+	From         string                 `json:"from"`
+	To           string                 `json:"to"`
+	Amount       int                    `json:"amount"`
+	FromCurrency string                 `json:"from_currency"`
+	ToCurrency   string                 `json:"to_currency"`
+	Rate         float64                `json:"rate"`
+	RateSource   string                 `json:"rate_source"`
+	Data         map[string]interface{} `json:"data"`
+	Timestamp    string                 `json:"timestamp"`
+}
+
+// IsFX says whether the transfer converts the amount between currencies
+func (t *Transfer) IsFX() bool {
+	return t.FromCurrency != "" && t.ToCurrency != "" && t.FromCurrency != t.ToCurrency
+}
+
+// ToAmount returns the amount credited to the `to` account,
+// which is rounded as per the rounding policy of the `to` currency
+func (t *Transfer) ToAmount() int {
+	if !t.IsFX() {
+		return t.Amount
+	}
+	return rounding.Round(float64(t.Amount)*t.Rate, rounding.For(t.ToCurrency))
+}
+
+// Validate checks whether the transfer can be expanded to a valid transaction
+func (t *Transfer) Validate() error {
+	switch {
+	case t.ID == "":
+		return errors.New("Missing transfer id")
+	case t.From == "" || t.To == "":
+		return errors.New("Missing transfer accounts")
+	case t.From == t.To && !t.IsFX():
+		return errors.New("Transfer accounts should be different")
+	case t.Amount <= 0:
+		return errors.New("Transfer amount should be positive")
+	case (t.FromCurrency == "") != (t.ToCurrency == ""):
+		return errors.New("Both transfer currencies should be given")
+	case t.FromCurrency != "" && (!IsValidCurrency(t.FromCurrency) || !IsValidCurrency(t.ToCurrency)):
+		return errors.New("Invalid transfer currency")
+	case t.IsFX() && t.Rate <= 0:
+		return errors.New("Transfer rate should be positive")
+	case t.IsFX() && t.ToAmount() <= 0:
+		return errors.New("Converted transfer amount should be positive")
+	}
+	return nil
+}
+
+// ToTransaction expands the transfer to a transaction debiting
+// the `from` account and crediting the `to` account.
+// The amount of an FX transfer moves through the FX accounts of both currencies,
+// so that the lines of each currency balance.
+func (t *Transfer) ToTransaction() *Transaction {
+	transaction := &Transaction{
+		ID:        t.ID,
+		Data:      t.Data,
+		Timestamp: t.Timestamp,
+	}
+	if !t.IsFX() {
+		transaction.Lines = []*TransactionLine{
+			&TransactionLine{
+				AccountID: t.From,
+				Delta:     -t.Amount,
+				Currency:  t.FromCurrency,
+			},
+			&TransactionLine{
+				AccountID: t.To,
+				Delta:     t.Amount,
+				Currency:  t.ToCurrency,
+			},
+		}
+		return transaction
+	}
+
+	toAmount := t.ToAmount()
+	policy := rounding.For(t.ToCurrency)
+	transaction.Lines = []*TransactionLine{
+		&TransactionLine{
+			AccountID: t.From,
+			Delta:     -t.Amount,
+			Currency:  t.FromCurrency,
+		},
+		&TransactionLine{
+			AccountID: FXAccountPrefix + t.FromCurrency,
+			Delta:     t.Amount,
+			Currency:  t.FromCurrency,
+		},
+		&TransactionLine{
+			AccountID: FXAccountPrefix + t.ToCurrency,
+			Delta:     -toAmount,
+			Currency:  t.ToCurrency,
+			Rounding:  policy,
+		},
+		&TransactionLine{
+			AccountID: t.To,
+			Delta:     toAmount,
+			Currency:  t.ToCurrency,
+			Rounding:  policy,
+		},
+	}
+
+	// Record the conversion along with the transaction data
+	data := make(map[string]interface{}, len(t.Data)+1)
+	for key, value := range t.Data {
+		data[key] = value
+	}
+	fx := map[string]interface{}{
+		"from_currency": t.FromCurrency,
+		"to_currency":   t.ToCurrency,
+		"rate":          t.Rate,
+		"amount":        t.Amount,
+		"to_amount":     toAmount,
+		"rounding":      policy,
+	}
+	if t.RateSource != "" {
+		fx["rate_source"] = t.RateSource
+	}
+	data["fx"] = fx
+	transaction.Data = data
+	return transaction
+}
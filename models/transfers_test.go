@@ -0,0 +1,111 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/RealImage/QLedger/rounding"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferValidate(t *testing.T) {
+	transfer := &Transfer{ID: "t001", From: "alice", To: "bob", Amount: 100}
+	assert.Equal(t, nil, transfer.Validate(), "Transfer should be valid")
+
+	invalid := []*Transfer{
+		{From: "alice", To: "bob", Amount: 100},
+		{ID: "t001", To: "bob", Amount: 100},
+		{ID: "t001", From: "alice", To: "alice", Amount: 100},
+		{ID: "t001", From: "alice", To: "bob", Amount: 0},
+		{ID: "t001", From: "alice", To: "bob", Amount: -100},
+	}
+	for _, transfer := range invalid {
+		assert.NotEqual(t, nil, transfer.Validate(), "Transfer should not be valid: %v", transfer)
+	}
+}
+
+func TestTransferToTransaction(t *testing.T) {
+	transfer := &Transfer{
+		ID:     "t001",
+		From:   "alice",
+		To:     "bob",
+		Amount: 100,
+		Data:   map[string]interface{}{"status": "completed"},
+	}
+	transaction := transfer.ToTransaction()
+	assert.Equal(t, "t001", transaction.ID, "Invalid transaction ID")
+	assert.Equal(t, transfer.Data, transaction.Data, "Invalid transaction data")
+	assert.Equal(t, 2, len(transaction.Lines), "Invalid transaction lines")
+	assert.Equal(t, &TransactionLine{AccountID: "alice", Delta: -100}, transaction.Lines[0], "Invalid debit line")
+	assert.Equal(t, &TransactionLine{AccountID: "bob", Delta: 100}, transaction.Lines[1], "Invalid credit line")
+	assert.Equal(t, true, transaction.IsValid(), "Transaction should be valid")
+}
+
+func TestFXTransferValidate(t *testing.T) {
+	transfer := &Transfer{
+		ID:           "t001",
+		From:         "alice",
+		To:           "bob",
+		Amount:       100,
+		FromCurrency: "USD",
+		ToCurrency:   "EUR",
+		Rate:         0.9,
+	}
+	assert.Equal(t, nil, transfer.Validate(), "FX transfer should be valid")
+
+	// Conversion within the same account is allowed
+	transfer.To = "alice"
+	assert.Equal(t, nil, transfer.Validate(), "FX transfer should be valid")
+
+	invalid := []*Transfer{
+		{ID: "t001", From: "alice", To: "bob", Amount: 100, FromCurrency: "USD", ToCurrency: "EUR"},
+		{ID: "t001", From: "alice", To: "bob", Amount: 100, FromCurrency: "USD", Rate: 0.9},
+		{ID: "t001", From: "alice", To: "bob", Amount: 100, FromCurrency: "usd", ToCurrency: "EUR", Rate: 0.9},
+		{ID: "t001", From: "alice", To: "bob", Amount: 1, FromCurrency: "USD", ToCurrency: "EUR", Rate: 0.001},
+	}
+	for _, transfer := range invalid {
+		assert.NotEqual(t, nil, transfer.Validate(), "FX transfer should not be valid: %v", transfer)
+	}
+}
+
+func TestFXTransferToTransaction(t *testing.T) {
+	transfer := &Transfer{
+		ID:           "t001",
+		From:         "alice",
+		To:           "bob",
+		Amount:       1000,
+		FromCurrency: "USD",
+		ToCurrency:   "INR",
+		Rate:         64.85,
+		RateSource:   "ecb",
+		Data:         map[string]interface{}{"status": "completed"},
+	}
+	transaction := transfer.ToTransaction()
+	assert.Equal(t, []*TransactionLine{
+		{AccountID: "alice", Delta: -1000, Currency: "USD"},
+		{AccountID: "fx.USD", Delta: 1000, Currency: "USD"},
+		{AccountID: "fx.INR", Delta: -64850, Currency: "INR", Rounding: "half_up"},
+		{AccountID: "bob", Delta: 64850, Currency: "INR", Rounding: "half_up"},
+	}, transaction.Lines, "Invalid FX transaction lines")
+	assert.Equal(t, true, transaction.IsValid(), "Transaction should be valid")
+
+	assert.Equal(t, "completed", transaction.Data["status"], "Transaction data should be retained")
+	fx, _ := transaction.Data["fx"].(map[string]interface{})
+	assert.Equal(t, 64.85, fx["rate"], "Invalid FX rate in data")
+	assert.Equal(t, "ecb", fx["rate_source"], "Invalid FX rate source in data")
+	assert.Equal(t, 64850, fx["to_amount"], "Invalid converted amount in data")
+	assert.Equal(t, "half_up", fx["rounding"], "Invalid rounding policy in data")
+	_, ok := transfer.Data["fx"]
+	assert.Equal(t, false, ok, "Transfer data should not be modified")
+}
+
+func TestFXTransferRounding(t *testing.T) {
+	defer rounding.Set(&rounding.Policies{Default: rounding.HalfUp})
+	rounding.Set(&rounding.Policies{Default: rounding.HalfUp, Currencies: map[string]string{"EUR": rounding.HalfEven}})
+
+	transfer := &Transfer{ID: "t001", From: "alice", To: "bob", Amount: 1001, FromCurrency: "USD", ToCurrency: "EUR", Rate: 0.5}
+	assert.Equal(t, 500, transfer.ToAmount(), "Converted amount should be rounded half to even")
+	assert.Equal(t, "half_even", transfer.ToTransaction().Lines[3].Rounding, "Invalid rounding policy of line")
+
+	transfer.ToCurrency = "GBP"
+	assert.Equal(t, 501, transfer.ToAmount(), "Converted amount should be rounded half up")
+}
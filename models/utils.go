@@ -6,13 +6,16 @@ import (
 )
 
 // OrderedLines implements sort.Interface for []*TransactionLine based on
-// the AccountID and Delta fields.
+// the AccountID, Currency and Delta fields.
 type OrderedLines []*TransactionLine
 
 func (lines OrderedLines) Len() int      { return len(lines) }
 func (lines OrderedLines) Swap(i, j int) { lines[i], lines[j] = lines[j], lines[i] }
 func (lines OrderedLines) Less(i, j int) bool {
 	if lines[i].AccountID == lines[j].AccountID {
+		if lines[i].Currency != lines[j].Currency {
+			return lines[i].Currency < lines[j].Currency
+		}
 		return lines[i].Delta < lines[j].Delta
 	}
 	return lines[i].AccountID < lines[j].AccountID
@@ -0,0 +1,269 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	ledgerError "github.com/RealImage/QLedger/errors"
+	"github.com/lib/pq"
+)
+
+// Statuses of webhook deliveries
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+	// WebhookDeliveryDiscarded is a delivery which is given up on, and is kept only for the record
+	WebhookDeliveryDiscarded = "discarded"
+)
+
+// Webhook represents a subscriber URL notified of the ledger events
+type Webhook struct {
+	ID        string `json:"id"`
+	URL       string `json:"url"`
+	Secret    string `json:"secret,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// WebhookDelivery represents the delivery of an event to a webhook
+type WebhookDelivery struct {
+	ID            int64           `json:"id"`
+	WebhookID     string          `json:"webhook_id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"last_error,omitempty"`
+	NextAttemptAt string          `json:"next_attempt_at,omitempty"`
+	CreatedAt     string          `json:"created_at"`
+	DeliveredAt   string          `json:"delivered_at,omitempty"`
+	// URL and Secret of the webhook, set on the claimed deliveries
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// WebhookDB provides all functions related to webhooks and their deliveries
+type WebhookDB struct {
+	db *sql.DB
+}
+
+// NewWebhookDB provides instance of `WebhookDB`
+func NewWebhookDB(db *sql.DB) WebhookDB {
+	return WebhookDB{db: db}
+}
+
+// Create adds a webhook
+func (wh *WebhookDB) Create(webhook *Webhook) ledgerError.ApplicationError {
+	_, err := wh.db.Exec("INSERT INTO webhooks (id, url, secret, created_at) VALUES ($1, $2, $3, $4)",
+		webhook.ID, webhook.URL, webhook.Secret, time.Now().UTC())
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "unique_violation" {
+			return WebhookExistsError(webhook.ID)
+		}
+		return DBError(err)
+	}
+	return nil
+}
+
+// Delete removes a webhook along with its deliveries. It returns false if the webhook doesn't exist.
+func (wh *WebhookDB) Delete(id string) (bool, ledgerError.ApplicationError) {
+	result, err := wh.db.Exec("DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return false, DBError(err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, DBError(err)
+	}
+	return count > 0, nil
+}
+
+// List returns all the webhooks without their secrets
+func (wh *WebhookDB) List() ([]*Webhook, ledgerError.ApplicationError) {
+	rows, err := wh.db.Query("SELECT id, url, created_at FROM webhooks ORDER BY id")
+	if err != nil {
+		log.Println("Error executing webhooks query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	webhooks := make([]*Webhook, 0)
+	for rows.Next() {
+		webhook := &Webhook{}
+		var createdAt time.Time
+		if err := rows.Scan(&webhook.ID, &webhook.URL, &createdAt); err != nil {
+			return nil, DBError(err)
+		}
+		webhook.CreatedAt = createdAt.Format(LedgerTimestampLayout)
+		webhooks = append(webhooks, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return webhooks, nil
+}
+
+// Enqueue adds a pending delivery of the event for every webhook
+func (wh *WebhookDB) Enqueue(event string, payload interface{}) ledgerError.ApplicationError {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return JSONError(err)
+	}
+	now := time.Now().UTC()
+	q := `INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at)
+			SELECT id, $1, $2, $3, $4, $4 FROM webhooks`
+	_, err = wh.db.Exec(q, event, string(data), WebhookDeliveryPending, now)
+	if err != nil {
+		log.Println("Error executing enqueue webhook deliveries query:", err)
+		return DBError(err)
+	}
+	return nil
+}
+
+// ClaimDue returns the pending deliveries which are due, and postpones their next attempt by `lease`
+// so that they aren't claimed again by another server while being delivered
+func (wh *WebhookDB) ClaimDue(limit int, lease time.Duration) ([]*WebhookDelivery, ledgerError.ApplicationError) {
+	now := time.Now().UTC()
+	q := `UPDATE webhook_deliveries SET next_attempt_at = $1
+			FROM webhooks
+			WHERE webhook_deliveries.webhook_id = webhooks.id AND webhook_deliveries.id IN (
+				SELECT id FROM webhook_deliveries
+					WHERE status = $2 AND next_attempt_at <= $3
+					ORDER BY next_attempt_at
+					LIMIT $4
+					FOR UPDATE SKIP LOCKED
+			)
+			RETURNING webhook_deliveries.id, webhook_deliveries.webhook_id, webhook_deliveries.event,
+				webhook_deliveries.payload, webhook_deliveries.attempts, webhook_deliveries.created_at,
+				webhooks.url, webhooks.secret`
+	rows, err := wh.db.Query(q, now.Add(lease), WebhookDeliveryPending, now, limit)
+	if err != nil {
+		log.Println("Error executing claim webhook deliveries query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		delivery := &WebhookDelivery{Status: WebhookDeliveryPending}
+		var createdAt time.Time
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Payload,
+			&delivery.Attempts, &createdAt, &delivery.URL, &delivery.Secret)
+		if err != nil {
+			return nil, DBError(err)
+		}
+		delivery.CreatedAt = createdAt.Format(LedgerTimestampLayout)
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return deliveries, nil
+}
+
+// MarkDelivered records a successful delivery attempt
+func (wh *WebhookDB) MarkDelivered(id int64) ledgerError.ApplicationError {
+	_, err := wh.db.Exec(`UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, last_error = NULL,
+			delivered_at = $2 WHERE id = $3`, WebhookDeliveryDelivered, time.Now().UTC(), id)
+	if err != nil {
+		return DBError(err)
+	}
+	return nil
+}
+
+// MarkAttemptFailed records a failed delivery attempt. The delivery is retried at `next`,
+// or marked as failed when `next` is zero.
+func (wh *WebhookDB) MarkAttemptFailed(id int64, reason string, next time.Time) ledgerError.ApplicationError {
+	status := WebhookDeliveryPending
+	if next.IsZero() {
+		status = WebhookDeliveryFailed
+		next = time.Now().UTC()
+	}
+	_, err := wh.db.Exec(`UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, last_error = $2,
+			next_attempt_at = $3 WHERE id = $4`, status, reason, next.UTC(), id)
+	if err != nil {
+		return DBError(err)
+	}
+	return nil
+}
+
+// GetDeliveries returns the latest deliveries, optionally filtered by webhook and status
+func (wh *WebhookDB) GetDeliveries(webhookID string, status string, limit int) ([]*WebhookDelivery, ledgerError.ApplicationError) {
+	q := `SELECT id, webhook_id, event, payload, status, attempts, last_error, next_attempt_at, created_at, delivered_at
+			FROM webhook_deliveries WHERE ($1 = '' OR webhook_id = $1) AND ($2 = '' OR status = $2)
+			ORDER BY id DESC LIMIT $3`
+	rows, err := wh.db.Query(q, webhookID, status, limit)
+	if err != nil {
+		log.Println("Error executing webhook deliveries query:", err)
+		return nil, DBError(err)
+	}
+	defer rows.Close()
+	deliveries := make([]*WebhookDelivery, 0)
+	for rows.Next() {
+		delivery := &WebhookDelivery{}
+		var lastError sql.NullString
+		var nextAttemptAt, createdAt time.Time
+		var deliveredAt pq.NullTime
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Payload, &delivery.Status,
+			&delivery.Attempts, &lastError, &nextAttemptAt, &createdAt, &deliveredAt)
+		if err != nil {
+			return nil, DBError(err)
+		}
+		delivery.LastError = lastError.String
+		if delivery.Status == WebhookDeliveryPending {
+			delivery.NextAttemptAt = nextAttemptAt.Format(LedgerTimestampLayout)
+		}
+		delivery.CreatedAt = createdAt.Format(LedgerTimestampLayout)
+		if deliveredAt.Valid {
+			delivery.DeliveredAt = deliveredAt.Time.Format(LedgerTimestampLayout)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, DBError(err)
+	}
+	return deliveries, nil
+}
+
+// Replay resets the given deliveries, or all the failed deliveries when none are given, to be delivered again.
+// It returns the number of replayed deliveries.
+func (wh *WebhookDB) Replay(ids []int64) (int64, ledgerError.ApplicationError) {
+	q := `UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = $2, delivered_at = NULL
+			WHERE id = ANY($3)`
+	args := []interface{}{WebhookDeliveryPending, time.Now().UTC(), pq.Array(ids)}
+	if len(ids) == 0 {
+		q = `UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = $2
+			WHERE status = $3`
+		args[2] = WebhookDeliveryFailed
+	}
+	result, err := wh.db.Exec(q, args...)
+	if err != nil {
+		return 0, DBError(err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, DBError(err)
+	}
+	return count, nil
+}
+
+// Discard gives up on the given pending or failed deliveries, or all the failed deliveries when none are given,
+// so that they are neither retried nor replayed along with the failed deliveries.
+// It returns the number of discarded deliveries.
+func (wh *WebhookDB) Discard(ids []int64) (int64, ledgerError.ApplicationError) {
+	q := `UPDATE webhook_deliveries SET status = $1 WHERE status IN ($2, $3) AND id = ANY($4)`
+	args := []interface{}{WebhookDeliveryDiscarded, WebhookDeliveryPending, WebhookDeliveryFailed, pq.Array(ids)}
+	if len(ids) == 0 {
+		q = `UPDATE webhook_deliveries SET status = $1 WHERE status = $2`
+		args = []interface{}{WebhookDeliveryDiscarded, WebhookDeliveryFailed}
+	}
+	result, err := wh.db.Exec(q, args...)
+	if err != nil {
+		return 0, DBError(err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, DBError(err)
+	}
+	return count, nil
+}
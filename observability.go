@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+
+	"github.com/RealImage/QLedger/metrics"
+	"github.com/RealImage/QLedger/observability"
+)
+
+// observabilityCommand runs `QLedger observability export`, which writes the Grafana dashboard and
+// the Prometheus alert rules of the metrics exposed by this binary into the directory
+func observabilityCommand(args []string) int {
+	if len(args) == 0 || args[0] != "export" {
+		log.Println("Usage: QLedger observability export [-dir DIR]")
+		return 2
+	}
+	flags := flag.NewFlagSet("observability export", flag.ContinueOnError)
+	dir := flags.String("dir", ".", "directory to write the dashboard and alert rules into")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	// The metrics are registered by the packages of the binary on their initialization
+	descriptions := metrics.DefaultRegistry.Describe()
+	dashboard, err := observability.DashboardJSON(descriptions)
+	if err != nil {
+		log.Println("Unable to generate dashboard:", err)
+		return 1
+	}
+	files := map[string][]byte{
+		"qledger-dashboard.json": dashboard,
+		"qledger-alerts.yml":     observability.AlertsYAML(descriptions),
+	}
+	for name, data := range files {
+		path := filepath.Join(*dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			log.Println("Unable to write file:", err)
+			return 1
+		}
+		log.Println("Written:", path)
+	}
+	return 0
+}
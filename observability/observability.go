@@ -0,0 +1,276 @@
+// Package observability generates the Grafana dashboard and the Prometheus alert rules of the metrics
+// exposed by the ledger, so that they always match the metric names of the binary
+package observability
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/RealImage/QLedger/metrics"
+)
+
+// DashboardUID is the UID of the generated Grafana dashboard, so that importing it again replaces it
+const DashboardUID = "qledger"
+
+// datasource is the Prometheus datasource of the panels, which is chosen when the dashboard is imported
+var datasource = map[string]string{"type": "prometheus", "uid": "${DS_PROMETHEUS}"}
+
+// Target is a Prometheus query of a panel
+type Target struct {
+	RefID        string            `json:"refId"`
+	Expr         string            `json:"expr"`
+	LegendFormat string            `json:"legendFormat"`
+	Datasource   map[string]string `json:"datasource"`
+}
+
+// GridPos is the position of a panel in the dashboard
+type GridPos struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// Panel is a time series panel of a metric
+type Panel struct {
+	ID          int                    `json:"id"`
+	Type        string                 `json:"type"`
+	Title       string                 `json:"title"`
+	Description string                 `json:"description"`
+	Datasource  map[string]string      `json:"datasource"`
+	GridPos     GridPos                `json:"gridPos"`
+	FieldConfig map[string]interface{} `json:"fieldConfig"`
+	Targets     []Target               `json:"targets"`
+}
+
+// sumBy returns the aggregation of the expression by the labels
+func sumBy(labels []string, expr string) string {
+	if len(labels) == 0 {
+		return "sum(" + expr + ")"
+	}
+	return "sum by (" + strings.Join(labels, ", ") + ") (" + expr + ")"
+}
+
+// legendFormat returns the legend of the series of the labels, with the prefix if any
+func legendFormat(prefix string, labels []string) string {
+	var parts []string
+	if prefix != "" {
+		parts = append(parts, prefix)
+	}
+	for _, label := range labels {
+		parts = append(parts, "{{"+label+"}}")
+	}
+	return strings.Join(parts, " ")
+}
+
+// panelTargets returns the queries of the panel of the metric: the rate of a counter, the value of a gauge,
+// and the quantiles of a histogram
+func panelTargets(m metrics.Description) []Target {
+	var targets []Target
+	switch m.Type {
+	case "counter":
+		targets = append(targets, Target{
+			Expr:         sumBy(m.Labels, "rate("+m.Name+"[$__rate_interval])"),
+			LegendFormat: legendFormat("", m.Labels),
+		})
+	case "histogram":
+		labels := append([]string{"le"}, m.Labels...)
+		for _, quantile := range []struct{ value, name string }{{"0.5", "p50"}, {"0.95", "p95"}, {"0.99", "p99"}} {
+			targets = append(targets, Target{
+				Expr:         "histogram_quantile(" + quantile.value + ", " + sumBy(labels, "rate("+m.Name+"_bucket[$__rate_interval])") + ")",
+				LegendFormat: legendFormat(quantile.name, m.Labels),
+			})
+		}
+	default:
+		targets = append(targets, Target{
+			Expr:         sumBy(m.Labels, m.Name),
+			LegendFormat: legendFormat("", m.Labels),
+		})
+	}
+	for i := range targets {
+		targets[i].RefID = string(rune('A' + i))
+		targets[i].Datasource = datasource
+	}
+	return targets
+}
+
+// panelUnit returns the Grafana unit of the values of the metric
+func panelUnit(m metrics.Description) string {
+	switch {
+	case m.Type == "counter":
+		return "ops"
+	case strings.HasSuffix(m.Name, "_seconds"):
+		return "s"
+	}
+	return "short"
+}
+
+// Dashboard returns the Grafana dashboard with a panel of every metric, two panels per row
+func Dashboard(descriptions []metrics.Description) map[string]interface{} {
+	panels := make([]Panel, 0, len(descriptions))
+	for i, m := range descriptions {
+		panels = append(panels, Panel{
+			ID:          i + 1,
+			Type:        "timeseries",
+			Title:       m.Name,
+			Description: m.Help,
+			Datasource:  datasource,
+			GridPos:     GridPos{X: (i % 2) * 12, Y: (i / 2) * 8, W: 12, H: 8},
+			FieldConfig: map[string]interface{}{
+				"defaults":  map[string]interface{}{"unit": panelUnit(m)},
+				"overrides": []interface{}{},
+			},
+			Targets: panelTargets(m),
+		})
+	}
+	return map[string]interface{}{
+		"__inputs": []map[string]string{{
+			"name":       "DS_PROMETHEUS",
+			"label":      "Prometheus",
+			"type":       "datasource",
+			"pluginId":   "prometheus",
+			"pluginName": "Prometheus",
+		}},
+		"uid":           DashboardUID,
+		"title":         "QLedger",
+		"tags":          []string{"qledger"},
+		"schemaVersion": 36,
+		"version":       1,
+		"editable":      true,
+		"refresh":       "1m",
+		"time":          map[string]string{"from": "now-6h", "to": "now"},
+		"panels":        panels,
+	}
+}
+
+// DashboardJSON returns the Grafana dashboard as indented JSON
+func DashboardJSON(descriptions []metrics.Description) ([]byte, error) {
+	return json.MarshalIndent(Dashboard(descriptions), "", "  ")
+}
+
+// AlertRule is a Prometheus alerting rule on the metrics of the ledger
+type AlertRule struct {
+	Name     string
+	Metrics  []string
+	Expr     string
+	For      string
+	Severity string
+	Summary  string
+}
+
+// AlertRules are the alerting rules of the ledger. Every rule lists the metrics of its expression,
+// and is generated only when the binary exposes them.
+var AlertRules = []AlertRule{
+	{
+		Name:     "QLedgerHighServerErrorRate",
+		Metrics:  []string{"qledger_http_requests_total"},
+		Expr:     `sum(rate(qledger_http_requests_total{status=~"5.."}[5m])) / sum(rate(qledger_http_requests_total[5m])) > 0.05`,
+		For:      "10m",
+		Severity: "warning",
+		Summary:  "More than 5% of the requests fail with server errors",
+	},
+	{
+		Name:     "QLedgerHighLatency",
+		Metrics:  []string{"qledger_http_request_duration_seconds"},
+		Expr:     `histogram_quantile(0.99, sum by (le, endpoint) (rate(qledger_http_request_duration_seconds_bucket[5m]))) > 1`,
+		For:      "10m",
+		Severity: "warning",
+		Summary:  "The 99th percentile latency of {{ $labels.endpoint }} is above 1s",
+	},
+	{
+		Name:     "QLedgerSLOFastBurn",
+		Metrics:  []string{"qledger_slo_burn_rate"},
+		Expr:     `qledger_slo_burn_rate{window="1h0m0s"} > 14.4 and on (slo) qledger_slo_burn_rate{window="5m0s"} > 14.4`,
+		For:      "2m",
+		Severity: "critical",
+		Summary:  "The SLO {{ $labels.slo }} burns its error budget 14.4 times faster than the objective",
+	},
+	{
+		Name:     "QLedgerSLOSlowBurn",
+		Metrics:  []string{"qledger_slo_burn_rate"},
+		Expr:     `qledger_slo_burn_rate{window="6h0m0s"} > 6 and on (slo) qledger_slo_burn_rate{window="1h0m0s"} > 6`,
+		For:      "15m",
+		Severity: "warning",
+		Summary:  "The SLO {{ $labels.slo }} burns its error budget 6 times faster than the objective",
+	},
+	{
+		Name:     "QLedgerInvariantViolation",
+		Metrics:  []string{"qledger_invariant_violations_total"},
+		Expr:     `sum by (invariant) (increase(qledger_invariant_violations_total[15m])) > 0`,
+		Severity: "critical",
+		Summary:  "The invariant checker found violations of {{ $labels.invariant }}",
+	},
+	{
+		Name:     "QLedgerPostingHookCircuitOpen",
+		Metrics:  []string{"qledger_posting_hook_circuit_open"},
+		Expr:     `max by (tenant, hook) (qledger_posting_hook_circuit_open) > 0`,
+		For:      "5m",
+		Severity: "warning",
+		Summary:  "The circuit breaker of the posting hook {{ $labels.hook }} is open",
+	},
+	{
+		Name:     "QLedgerRequestsShed",
+		Metrics:  []string{"qledger_http_requests_shed_total"},
+		Expr:     `sum by (class) (rate(qledger_http_requests_shed_total[5m])) > 0`,
+		For:      "5m",
+		Severity: "warning",
+		Summary:  "Requests of the {{ $labels.class }} class are shed under load",
+	},
+	{
+		Name:     "QLedgerDBPoolSaturated",
+		Metrics:  []string{"qledger_db_wait_duration_seconds"},
+		Expr:     `sum by (db) (rate(qledger_db_wait_duration_seconds[5m])) > 0.5`,
+		For:      "10m",
+		Severity: "warning",
+		Summary:  "Requests wait for connections of the DB pool {{ $labels.db }}",
+	},
+	{
+		Name:     "QLedgerConsumerRejections",
+		Metrics:  []string{"qledger_consumed_messages_total"},
+		Expr:     `sum(increase(qledger_consumed_messages_total{status="rejected"}[15m])) > 0`,
+		Severity: "warning",
+		Summary:  "Messages consumed from the queue are rejected",
+	},
+}
+
+// Alerts returns the alert rules whose metrics are all exposed
+func Alerts(descriptions []metrics.Description) []AlertRule {
+	exposed := make(map[string]bool, len(descriptions))
+	for _, m := range descriptions {
+		exposed[m.Name] = true
+	}
+	var rules []AlertRule
+	for _, rule := range AlertRules {
+		matched := true
+		for _, name := range rule.Metrics {
+			matched = matched && exposed[name]
+		}
+		if matched {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// AlertsYAML returns the Prometheus rule file of the alert rules whose metrics are all exposed
+func AlertsYAML(descriptions []metrics.Description) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("groups:\n")
+	buf.WriteString("  - name: qledger\n")
+	buf.WriteString("    rules:\n")
+	for _, rule := range Alerts(descriptions) {
+		fmt.Fprintf(&buf, "      - alert: %s\n", rule.Name)
+		fmt.Fprintf(&buf, "        expr: %s\n", strconv.Quote(rule.Expr))
+		if rule.For != "" {
+			fmt.Fprintf(&buf, "        for: %s\n", rule.For)
+		}
+		buf.WriteString("        labels:\n")
+		fmt.Fprintf(&buf, "          severity: %s\n", rule.Severity)
+		buf.WriteString("        annotations:\n")
+		fmt.Fprintf(&buf, "          summary: %s\n", strconv.Quote(rule.Summary))
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,92 @@
+package observability
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	_ "github.com/RealImage/QLedger/controllers"
+	"github.com/RealImage/QLedger/metrics"
+	_ "github.com/RealImage/QLedger/middlewares"
+	"github.com/RealImage/QLedger/slo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertRulesMatchMetrics(t *testing.T) {
+	exposed := make(map[string]bool)
+	for _, m := range metrics.DefaultRegistry.Describe() {
+		exposed[m.Name] = true
+	}
+	for _, rule := range AlertRules {
+		for _, name := range rule.Metrics {
+			assert.True(t, exposed[name], "Metric of alert %v should be exposed: %v", rule.Name, name)
+			assert.Contains(t, rule.Expr, name, "Metric of alert %v should be in its expression", rule.Name)
+		}
+	}
+	assert.Equal(t, len(AlertRules), len(Alerts(metrics.DefaultRegistry.Describe())), "All alerts should be generated")
+
+	// The burn rate alerts select the windows of the SLOs by their labels
+	windows := make(map[string]bool)
+	for _, window := range slo.Windows {
+		windows[window.String()] = true
+	}
+	for _, window := range []string{"5m0s", "1h0m0s", "6h0m0s"} {
+		assert.True(t, windows[window], "Invalid SLO window: %v", window)
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	rules := Alerts([]metrics.Description{{Name: "qledger_http_requests_total", Type: "counter"}})
+	if assert.Equal(t, 1, len(rules), "Only the alerts of the exposed metrics should be generated") {
+		assert.Equal(t, "QLedgerHighServerErrorRate", rules[0].Name, "Invalid alert")
+	}
+
+	yaml := string(AlertsYAML([]metrics.Description{{Name: "qledger_posting_hook_circuit_open", Type: "gauge"}}))
+	assert.Equal(t, `groups:
+  - name: qledger
+    rules:
+      - alert: QLedgerPostingHookCircuitOpen
+        expr: "max by (tenant, hook) (qledger_posting_hook_circuit_open) > 0"
+        for: 5m
+        labels:
+          severity: warning
+        annotations:
+          summary: "The circuit breaker of the posting hook {{ $labels.hook }} is open"
+`, yaml, "Invalid alert rules")
+}
+
+func TestDashboard(t *testing.T) {
+	data, err := DashboardJSON([]metrics.Description{
+		{Name: "test_requests_total", Type: "counter", Labels: []string{"method", "status"}},
+		{Name: "test_latency_seconds", Type: "histogram", Labels: []string{"endpoint"}},
+		{Name: "test_connections", Type: "gauge"},
+	})
+	assert.Nil(t, err, "Error generating dashboard")
+	var dashboard struct {
+		UID    string  `json:"uid"`
+		Panels []Panel `json:"panels"`
+	}
+	assert.Nil(t, json.Unmarshal(data, &dashboard), "Invalid dashboard JSON")
+	assert.Equal(t, DashboardUID, dashboard.UID, "Invalid dashboard UID")
+	if !assert.Equal(t, 3, len(dashboard.Panels), "Invalid panels") {
+		return
+	}
+
+	counter := dashboard.Panels[0]
+	assert.Equal(t, "sum by (method, status) (rate(test_requests_total[$__rate_interval]))", counter.Targets[0].Expr, "Invalid counter query")
+	assert.Equal(t, "{{method}} {{status}}", counter.Targets[0].LegendFormat, "Invalid legend")
+
+	histogram := dashboard.Panels[1]
+	assert.Equal(t, GridPos{X: 12, Y: 0, W: 12, H: 8}, histogram.GridPos, "Invalid panel position")
+	if assert.Equal(t, 3, len(histogram.Targets), "Invalid quantiles") {
+		assert.Equal(t, "histogram_quantile(0.95, sum by (le, endpoint) (rate(test_latency_seconds_bucket[$__rate_interval])))",
+			histogram.Targets[1].Expr, "Invalid histogram query")
+		assert.Equal(t, "B", histogram.Targets[1].RefID, "Invalid ref ID")
+		assert.Equal(t, "p95 {{endpoint}}", histogram.Targets[1].LegendFormat, "Invalid legend")
+	}
+
+	gauge := dashboard.Panels[2]
+	assert.Equal(t, "sum(test_connections)", gauge.Targets[0].Expr, "Invalid gauge query")
+	assert.Equal(t, GridPos{X: 0, Y: 8, W: 12, H: 8}, gauge.GridPos, "Invalid panel position")
+	assert.True(t, strings.Contains(string(data), "${DS_PROMETHEUS}"), "Datasource should be an input")
+}
@@ -0,0 +1,85 @@
+// Package rounding rounds the amounts computed by the ledger, such as the converted and allocated amounts,
+// as per the rounding policy of their currency.
+package rounding
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Rounding policies
+const (
+	// HalfEven rounds half to the nearest even integer, which doesn't bias the sums of many amounts
+	HalfEven = "half_even"
+	// HalfUp rounds half away from zero
+	HalfUp = "half_up"
+	// Truncate rounds toward zero
+	Truncate = "truncate"
+)
+
+// IsValid says whether the policy is one of the rounding policies
+func IsValid(policy string) bool {
+	switch policy {
+	case HalfEven, HalfUp, Truncate:
+		return true
+	}
+	return false
+}
+
+// Round rounds the value to an integer as per the policy
+func Round(value float64, policy string) int {
+	switch policy {
+	case HalfEven:
+		return int(math.RoundToEven(value))
+	case Truncate:
+		return int(math.Trunc(value))
+	}
+	return int(math.Round(value))
+}
+
+// Policies are the rounding policies of the currencies, along with the default policy of the other currencies
+type Policies struct {
+	Default    string
+	Currencies map[string]string
+}
+
+// Parse returns the policies by currency from a list in the format `USD:half_even,JPY:truncate`
+func Parse(value string) (map[string]string, error) {
+	currencies := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || !IsValid(strings.TrimSpace(parts[1])) {
+			return nil, fmt.Errorf("Invalid rounding policy: %v", item)
+		}
+		currencies[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return currencies, nil
+}
+
+var (
+	mu      sync.RWMutex
+	current = &Policies{Default: HalfUp}
+)
+
+// Set replaces the rounding policies of the server
+func Set(policies *Policies) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = policies
+}
+
+// For returns the rounding policy of the currency
+func For(currency string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if policy, ok := current.Currencies[currency]; ok {
+		return policy
+	}
+	return current.Default
+}
@@ -0,0 +1,52 @@
+package rounding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRound(t *testing.T) {
+	cases := []struct {
+		value    float64
+		halfEven int
+		halfUp   int
+		truncate int
+	}{
+		{2.5, 2, 3, 2},
+		{3.5, 4, 4, 3},
+		{2.4, 2, 2, 2},
+		{2.6, 3, 3, 2},
+		{-2.5, -2, -3, -2},
+		{-2.6, -3, -3, -2},
+		{7, 7, 7, 7},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.halfEven, Round(c.value, HalfEven), "Invalid half even rounding of %v", c.value)
+		assert.Equal(t, c.halfUp, Round(c.value, HalfUp), "Invalid half up rounding of %v", c.value)
+		assert.Equal(t, c.truncate, Round(c.value, Truncate), "Invalid truncation of %v", c.value)
+	}
+}
+
+func TestParse(t *testing.T) {
+	currencies, err := Parse("USD:half_even, JPY:truncate")
+	assert.Equal(t, nil, err, "Error parsing rounding policies")
+	assert.Equal(t, map[string]string{"USD": HalfEven, "JPY": Truncate}, currencies, "Invalid rounding policies")
+
+	currencies, err = Parse("")
+	assert.Equal(t, nil, err, "Error parsing empty rounding policies")
+	assert.Equal(t, 0, len(currencies), "Invalid rounding policies")
+
+	for _, value := range []string{"USD", "USD:ceil", ":half_up"} {
+		_, err := Parse(value)
+		assert.NotEqual(t, nil, err, "Invalid rounding policies should fail: %v", value)
+	}
+}
+
+func TestFor(t *testing.T) {
+	defer Set(&Policies{Default: HalfUp})
+	Set(&Policies{Default: HalfEven, Currencies: map[string]string{"JPY": Truncate}})
+	assert.Equal(t, Truncate, For("JPY"), "Invalid policy of currency")
+	assert.Equal(t, HalfEven, For("USD"), "Invalid default policy")
+	assert.Equal(t, HalfEven, For(""), "Invalid policy without currency")
+}
@@ -13,26 +13,109 @@ SET default_tablespace = '';
 SET default_with_oids = false;
 CREATE TABLE accounts (
     id character varying NOT NULL,
-    data jsonb DEFAULT '{}'::jsonb NOT NULL
+    data jsonb DEFAULT '{}'::jsonb NOT NULL,
+    min_balance bigint,
+    frozen boolean DEFAULT false NOT NULL,
+    dormant_since timestamp without time zone
+);
+CREATE TABLE account_balance_snapshots (
+    account_id character varying NOT NULL,
+    currency character varying NOT NULL,
+    as_of timestamp without time zone NOT NULL,
+    balance bigint NOT NULL
+);
+CREATE TABLE api_keys (
+    id character varying NOT NULL,
+    ledger_id character varying NOT NULL,
+    key_hash character varying NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    revoked_at timestamp without time zone,
+    metadata_read character varying[],
+    metadata_write character varying[]
+);
+CREATE TABLE balance_rollups (
+    as_of timestamp without time zone NOT NULL,
+    sequence bigint NOT NULL,
+    created_at timestamp without time zone NOT NULL
+);
+CREATE TABLE cache_policies (
+    id character varying NOT NULL,
+    prefix character varying NOT NULL,
+    max_age_seconds integer NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    shared boolean DEFAULT false NOT NULL
+);
+CREATE TABLE categorization_rules (
+    id character varying NOT NULL,
+    category character varying NOT NULL,
+    priority integer DEFAULT 0 NOT NULL,
+    data jsonb DEFAULT '{}'::jsonb NOT NULL,
+    accounts character varying[] DEFAULT '{}'::character varying[] NOT NULL,
+    created_at timestamp without time zone NOT NULL
+);
+CREATE TABLE client_keys (
+    id character varying NOT NULL,
+    client character varying NOT NULL,
+    public_key character varying NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    revoked_at timestamp without time zone
+);
+CREATE TABLE computed_fields (
+    name character varying NOT NULL,
+    function character varying NOT NULL,
+    currency character varying DEFAULT ''::character varying NOT NULL,
+    created_at timestamp without time zone NOT NULL
 );
 CREATE TABLE current_balances (
     id character varying,
     data jsonb,
-    balance numeric
+    balance numeric,
+    balances jsonb,
+    dormant boolean,
+    dormant_since timestamp without time zone
 );
 ALTER TABLE ONLY current_balances REPLICA IDENTITY NOTHING;
+CREATE TABLE failover_epochs (
+    epoch bigint NOT NULL,
+    primary_region character varying NOT NULL,
+    promoted_at timestamp without time zone NOT NULL
+);
+CREATE TABLE fx_rates (
+    source character varying NOT NULL,
+    from_currency character varying NOT NULL,
+    to_currency character varying NOT NULL,
+    rate double precision NOT NULL,
+    updated_at timestamp without time zone NOT NULL
+);
+CREATE TABLE idempotency_settings (
+    id boolean DEFAULT true NOT NULL,
+    window_seconds bigint NOT NULL,
+    on_mismatch character varying NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    CONSTRAINT idempotency_settings_single_row CHECK (id)
+);
+CREATE TABLE ledgers (
+    id character varying NOT NULL,
+    data jsonb DEFAULT '{}'::jsonb NOT NULL,
+    created_at timestamp without time zone NOT NULL
+);
 CREATE TABLE lines (
     id bigint NOT NULL,
     transaction_id character varying NOT NULL,
     account_id character varying NOT NULL,
-    delta bigint NOT NULL
+    delta bigint NOT NULL,
+    statement_ref character varying,
+    reconciled_at timestamp without time zone,
+    currency character varying DEFAULT ''::character varying NOT NULL,
+    rounding character varying
 );
 CREATE VIEW invalid_transactions AS
  SELECT lines.transaction_id,
+    lines.currency,
     sum(lines.delta) AS sum
    FROM lines
-  GROUP BY lines.transaction_id
- HAVING (sum(lines.delta) > (0)::numeric);
+  GROUP BY lines.transaction_id, lines.currency
+ HAVING (sum(lines.delta) <> (0)::numeric);
 CREATE SEQUENCE lines_id_seq
     START WITH 1
     INCREMENT BY 1
@@ -40,37 +123,232 @@ CREATE SEQUENCE lines_id_seq
     NO MAXVALUE
     CACHE 1;
 ALTER SEQUENCE lines_id_seq OWNED BY lines.id;
+CREATE TABLE merkle_leaves (
+    transaction_id character varying NOT NULL,
+    tree_id bigint NOT NULL,
+    "position" integer NOT NULL,
+    hash character varying NOT NULL
+);
+CREATE TABLE merkle_trees (
+    id bigint NOT NULL,
+    root character varying NOT NULL,
+    size integer NOT NULL,
+    sequence bigint NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    anchor character varying,
+    anchored_at timestamp without time zone
+);
+CREATE SEQUENCE merkle_trees_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+ALTER SEQUENCE merkle_trees_id_seq OWNED BY merkle_trees.id;
+CREATE TABLE posting_hooks (
+    id character varying NOT NULL,
+    url character varying NOT NULL,
+    secret character varying NOT NULL,
+    timeout_ms integer NOT NULL,
+    fail_open boolean DEFAULT false NOT NULL,
+    created_at timestamp without time zone NOT NULL
+);
+CREATE TABLE report_definitions (
+    id character varying NOT NULL,
+    definition jsonb NOT NULL,
+    schedule character varying DEFAULT ''::character varying NOT NULL,
+    last_run_at timestamp without time zone,
+    result jsonb,
+    materialized_at timestamp without time zone
+);
+CREATE TABLE retention_settings (
+    id boolean DEFAULT true NOT NULL,
+    webhook_deliveries_days integer,
+    scheduled_transactions_days integer,
+    updated_at timestamp without time zone NOT NULL,
+    last_purged_at timestamp without time zone,
+    last_purged jsonb,
+    CONSTRAINT retention_settings_single_row CHECK (id)
+);
+CREATE TABLE routing_rules (
+    id character varying NOT NULL,
+    pattern character varying NOT NULL,
+    priority integer DEFAULT 0 NOT NULL,
+    account character varying,
+    lookup jsonb,
+    created_at timestamp without time zone NOT NULL
+);
+CREATE TABLE scheduled_transactions (
+    id character varying NOT NULL,
+    transaction jsonb NOT NULL,
+    post_at timestamp without time zone NOT NULL,
+    status character varying NOT NULL,
+    last_error character varying,
+    claimed_until timestamp without time zone,
+    created_at timestamp without time zone NOT NULL,
+    posted_at timestamp without time zone
+);
 CREATE TABLE schema_migrations (
     version bigint NOT NULL,
     dirty boolean NOT NULL
 );
+CREATE TABLE snapshots (
+    name character varying NOT NULL,
+    sequence bigint NOT NULL,
+    created_at timestamp without time zone NOT NULL
+);
+CREATE TABLE transaction_signatures (
+    transaction_id character varying NOT NULL,
+    key_id character varying NOT NULL,
+    signature character varying NOT NULL,
+    verified_at timestamp without time zone NOT NULL
+);
 CREATE TABLE transactions (
     id character varying NOT NULL,
     "timestamp" timestamp without time zone NOT NULL,
-    data jsonb DEFAULT '{}'::jsonb NOT NULL
+    data jsonb DEFAULT '{}'::jsonb NOT NULL,
+    sequence bigint NOT NULL,
+    category character varying,
+    content_hash character varying,
+    created_at timestamp without time zone DEFAULT timezone('utc'::text, now()),
+    reverses character varying
+);
+CREATE SEQUENCE transactions_sequence_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+ALTER SEQUENCE transactions_sequence_seq OWNED BY transactions.sequence;
+CREATE TABLE webhook_deliveries (
+    id bigint NOT NULL,
+    webhook_id character varying NOT NULL,
+    event character varying NOT NULL,
+    payload jsonb NOT NULL,
+    status character varying NOT NULL,
+    attempts integer DEFAULT 0 NOT NULL,
+    last_error character varying,
+    next_attempt_at timestamp without time zone NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    delivered_at timestamp without time zone
+);
+CREATE SEQUENCE webhook_deliveries_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+ALTER SEQUENCE webhook_deliveries_id_seq OWNED BY webhook_deliveries.id;
+CREATE TABLE webhooks (
+    id character varying NOT NULL,
+    url character varying NOT NULL,
+    secret character varying NOT NULL,
+    created_at timestamp without time zone NOT NULL
 );
 ALTER TABLE ONLY lines ALTER COLUMN id SET DEFAULT nextval('lines_id_seq'::regclass);
+ALTER TABLE ONLY merkle_trees ALTER COLUMN id SET DEFAULT nextval('merkle_trees_id_seq'::regclass);
+ALTER TABLE ONLY transactions ALTER COLUMN sequence SET DEFAULT nextval('transactions_sequence_seq'::regclass);
+ALTER TABLE ONLY webhook_deliveries ALTER COLUMN id SET DEFAULT nextval('webhook_deliveries_id_seq'::regclass);
+ALTER TABLE ONLY account_balance_snapshots
+    ADD CONSTRAINT account_balance_snapshots_pkey PRIMARY KEY (account_id, as_of, currency);
 ALTER TABLE ONLY accounts
     ADD CONSTRAINT accounts_pkey PRIMARY KEY (id);
+ALTER TABLE ONLY api_keys
+    ADD CONSTRAINT api_keys_key_hash_key UNIQUE (key_hash);
+ALTER TABLE ONLY api_keys
+    ADD CONSTRAINT api_keys_pkey PRIMARY KEY (id);
+ALTER TABLE ONLY balance_rollups
+    ADD CONSTRAINT balance_rollups_pkey PRIMARY KEY (as_of);
+ALTER TABLE ONLY cache_policies
+    ADD CONSTRAINT cache_policies_pkey PRIMARY KEY (id);
+ALTER TABLE ONLY categorization_rules
+    ADD CONSTRAINT categorization_rules_pkey PRIMARY KEY (id);
+ALTER TABLE ONLY client_keys
+    ADD CONSTRAINT client_keys_pkey PRIMARY KEY (id);
+ALTER TABLE ONLY computed_fields
+    ADD CONSTRAINT computed_fields_pkey PRIMARY KEY (name);
+ALTER TABLE ONLY failover_epochs
+    ADD CONSTRAINT failover_epochs_pkey PRIMARY KEY (epoch);
+ALTER TABLE ONLY fx_rates
+    ADD CONSTRAINT fx_rates_pkey PRIMARY KEY (source, from_currency, to_currency);
+ALTER TABLE ONLY idempotency_settings
+    ADD CONSTRAINT idempotency_settings_pkey PRIMARY KEY (id);
+ALTER TABLE ONLY ledgers
+    ADD CONSTRAINT ledgers_pkey PRIMARY KEY (id);
 ALTER TABLE ONLY lines
     ADD CONSTRAINT lines_pkey PRIMARY KEY (id);
+ALTER TABLE ONLY merkle_leaves
+    ADD CONSTRAINT merkle_leaves_pkey PRIMARY KEY (transaction_id);
+ALTER TABLE ONLY merkle_trees
+    ADD CONSTRAINT merkle_trees_pkey PRIMARY KEY (id);
+ALTER TABLE ONLY posting_hooks
+    ADD CONSTRAINT posting_hooks_pkey PRIMARY KEY (id);
+ALTER TABLE ONLY report_definitions
+    ADD CONSTRAINT report_definitions_pkey PRIMARY KEY (id);
+ALTER TABLE ONLY retention_settings
+    ADD CONSTRAINT retention_settings_pkey PRIMARY KEY (id);
+ALTER TABLE ONLY routing_rules
+    ADD CONSTRAINT routing_rules_pkey PRIMARY KEY (id);
+ALTER TABLE ONLY scheduled_transactions
+    ADD CONSTRAINT scheduled_transactions_pkey PRIMARY KEY (id);
 ALTER TABLE ONLY schema_migrations
     ADD CONSTRAINT schema_migrations_pkey PRIMARY KEY (version);
+ALTER TABLE ONLY snapshots
+    ADD CONSTRAINT snapshots_pkey PRIMARY KEY (name);
+ALTER TABLE ONLY transaction_signatures
+    ADD CONSTRAINT transaction_signatures_pkey PRIMARY KEY (transaction_id);
 ALTER TABLE ONLY transactions
     ADD CONSTRAINT transactions_pkey PRIMARY KEY (id);
+ALTER TABLE ONLY webhook_deliveries
+    ADD CONSTRAINT webhook_deliveries_pkey PRIMARY KEY (id);
+ALTER TABLE ONLY webhooks
+    ADD CONSTRAINT webhooks_pkey PRIMARY KEY (id);
 CREATE INDEX accounts_data_idx ON accounts USING gin (data jsonb_path_ops);
+CREATE INDEX accounts_dormant_since_idx ON accounts USING btree (dormant_since) WHERE (dormant_since IS NOT NULL);
+CREATE INDEX api_keys_ledger_id_idx ON api_keys USING btree (ledger_id);
+CREATE INDEX lines_account_id_id_idx ON lines USING btree (account_id, id);
 CREATE INDEX lines_account_id_idx ON lines USING btree (account_id);
+CREATE INDEX lines_unreconciled_account_id_idx ON lines USING btree (account_id) WHERE (reconciled_at IS NULL);
 CREATE INDEX lines_transaction_id_idx ON lines USING btree (transaction_id);
+CREATE UNIQUE INDEX merkle_leaves_tree_id_position_idx ON merkle_leaves USING btree (tree_id, "position");
+CREATE INDEX scheduled_transactions_pending_idx ON scheduled_transactions USING btree (post_at) WHERE ((status)::text = 'pending'::text);
 CREATE INDEX timestamp_idx ON transactions USING brin ("timestamp");
+CREATE INDEX transactions_category_idx ON transactions USING btree (category);
+CREATE INDEX transactions_content_hash_idx ON transactions USING btree (content_hash);
 CREATE INDEX transactions_data_idx ON transactions USING gin (data jsonb_path_ops);
+CREATE UNIQUE INDEX transactions_reverses_idx ON transactions USING btree (reverses);
+CREATE UNIQUE INDEX transactions_sequence_idx ON transactions USING btree (sequence);
+CREATE INDEX webhook_deliveries_created_at_idx ON webhook_deliveries USING btree (created_at) WHERE ((status)::text <> 'pending'::text);
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries USING btree (next_attempt_at) WHERE ((status)::text = 'pending'::text);
 CREATE RULE "_RETURN" AS
     ON SELECT TO current_balances DO INSTEAD  SELECT accounts.id,
     accounts.data,
-    COALESCE(sum(lines.delta), (0)::numeric) AS balance
+    COALESCE(sum(balances.balance) FILTER (WHERE ((balances.currency)::text = ''::text)), (0)::numeric) AS balance,
+    COALESCE(jsonb_object_agg(balances.currency, balances.balance) FILTER (WHERE ((balances.currency)::text <> ''::text)), '{}'::jsonb) AS balances,
+    (accounts.dormant_since IS NOT NULL) AS dormant,
+    accounts.dormant_since
    FROM (accounts
-     LEFT JOIN lines ON (((accounts.id)::text = (lines.account_id)::text)))
+     LEFT JOIN ( SELECT lines.account_id,
+            lines.currency,
+            sum(lines.delta) AS balance
+           FROM lines
+          GROUP BY lines.account_id, lines.currency) balances ON (((accounts.id)::text = (balances.account_id)::text)))
   GROUP BY accounts.id;
+ALTER TABLE ONLY account_balance_snapshots
+    ADD CONSTRAINT account_balance_snapshots_as_of_fkey FOREIGN KEY (as_of) REFERENCES balance_rollups(as_of) ON DELETE CASCADE;
+ALTER TABLE ONLY api_keys
+    ADD CONSTRAINT api_keys_ledger_id_fkey FOREIGN KEY (ledger_id) REFERENCES ledgers(id);
 ALTER TABLE ONLY lines
     ADD CONSTRAINT lines_account_id_fkey FOREIGN KEY (account_id) REFERENCES accounts(id);
 ALTER TABLE ONLY lines
     ADD CONSTRAINT lines_txn_fkey FOREIGN KEY (transaction_id) REFERENCES transactions(id);
+ALTER TABLE ONLY merkle_leaves
+    ADD CONSTRAINT merkle_leaves_transaction_id_fkey FOREIGN KEY (transaction_id) REFERENCES transactions(id);
+ALTER TABLE ONLY merkle_leaves
+    ADD CONSTRAINT merkle_leaves_tree_id_fkey FOREIGN KEY (tree_id) REFERENCES merkle_trees(id);
+ALTER TABLE ONLY transaction_signatures
+    ADD CONSTRAINT transaction_signatures_key_id_fkey FOREIGN KEY (key_id) REFERENCES client_keys(id);
+ALTER TABLE ONLY transaction_signatures
+    ADD CONSTRAINT transaction_signatures_transaction_id_fkey FOREIGN KEY (transaction_id) REFERENCES transactions(id);
+ALTER TABLE ONLY webhook_deliveries
+    ADD CONSTRAINT webhook_deliveries_webhook_id_fkey FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE;
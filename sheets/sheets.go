@@ -0,0 +1,280 @@
+// Package sheets reads the rows of a spreadsheet and writes cells back to it, so that the journals kept
+// in spreadsheets by finance teams can be posted as transactions.
+package sheets
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Update is a range of cells of a row to write back to the sheet
+type Update struct {
+	// Row is the number of the row in the sheet, starting from 1 for the header row
+	Row int
+	// Column is the index of the first cell, starting from 0 for the column `A`
+	Column int
+	Values []string
+}
+
+// Sheet is a spreadsheet of rows of cells
+type Sheet interface {
+	// Rows returns all the rows of the sheet, including the header row
+	Rows() ([][]string, error)
+	// Update writes the cells back to the sheet
+	Update(updates []Update) error
+}
+
+// sheetsScope is the OAuth scope of reading and writing the spreadsheets
+const sheetsScope = "https://www.googleapis.com/auth/spreadsheets"
+
+// ServiceAccount is the key of a Google service account, as downloaded in JSON
+type ServiceAccount struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// GoogleSheet is a sheet of a Google spreadsheet, which is accessed by a service account.
+// The spreadsheet should be shared with the email of the service account.
+type GoogleSheet struct {
+	SpreadsheetID string
+	Name          string
+	Account       ServiceAccount
+	Client        *http.Client
+	key           *rsa.PrivateKey
+	endpoint      string
+	now           func() time.Time
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewGoogleSheet returns the sheet of the spreadsheet with the name, accessed with the JSON key of a service account
+func NewGoogleSheet(spreadsheetID, name string, serviceAccountKey []byte) (*GoogleSheet, error) {
+	if spreadsheetID == "" || name == "" {
+		return nil, errors.New("Missing spreadsheet ID or sheet name")
+	}
+	account := ServiceAccount{}
+	if err := json.Unmarshal(serviceAccountKey, &account); err != nil {
+		return nil, fmt.Errorf("Invalid service account key: %v", err)
+	}
+	if account.ClientEmail == "" {
+		return nil, errors.New("Missing client email of service account")
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	key, err := parsePrivateKey(account.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &GoogleSheet{
+		SpreadsheetID: spreadsheetID,
+		Name:          name,
+		Account:       account,
+		Client:        &http.Client{Timeout: 30 * time.Second},
+		key:           key,
+		endpoint:      "https://sheets.googleapis.com",
+		now:           time.Now,
+	}, nil
+}
+
+// parsePrivateKey parses the PEM encoded RSA key of a service account
+func parsePrivateKey(value string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return nil, errors.New("Invalid private key of service account")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+			return key, nil
+		}
+		return nil, fmt.Errorf("Invalid private key of service account: %v", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("Private key of service account should be an RSA key")
+	}
+	return key, nil
+}
+
+// assertion returns the JWT signed by the service account to request an access token
+func (s *GoogleSheet) assertion(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": s.Account.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   s.Account.ClientEmail,
+		"scope": sheetsScope,
+		"aud":   s.Account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(payload))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// accessToken returns the access token of the service account, which is requested again a minute before it expires
+func (s *GoogleSheet) accessToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if s.token != "" && now.Before(s.tokenExpiry) {
+		return s.token, nil
+	}
+	assertion, err := s.assertion(now)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.Client.PostForm(s.Account.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Access token request failed with status %v: %s", resp.StatusCode, data)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", err
+	}
+	s.token = token.AccessToken
+	s.tokenExpiry = now.Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return s.token, nil
+}
+
+// call calls the Sheets API with the access token, and decodes its response when it is given
+func (s *GoogleSheet) call(method, path string, request, response interface{}) error {
+	token, err := s.accessToken()
+	if err != nil {
+		return err
+	}
+	var body []byte
+	if request != nil {
+		if body, err = json.Marshal(request); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, s.endpoint+"/v4/spreadsheets/"+url.PathEscape(s.SpreadsheetID)+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiError struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(data, &apiError)
+		return fmt.Errorf("Sheets API failed with status %v: %v", resp.StatusCode, apiError.Error.Message)
+	}
+	if response == nil {
+		return nil
+	}
+	return json.Unmarshal(data, response)
+}
+
+// quotedName returns the sheet name quoted for the A1 notation of the ranges
+func (s *GoogleSheet) quotedName() string {
+	return "'" + strings.Replace(s.Name, "'", "''", -1) + "'"
+}
+
+// ColumnName returns the letters of the column of the index, such as `A` for 0 and `AA` for 26
+func ColumnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// Rows returns the formatted values of all the rows of the sheet
+func (s *GoogleSheet) Rows() ([][]string, error) {
+	var response struct {
+		Values [][]interface{} `json:"values"`
+	}
+	if err := s.call("GET", "/values/"+url.PathEscape(s.quotedName())+"?majorDimension=ROWS", nil, &response); err != nil {
+		return nil, err
+	}
+	rows := make([][]string, 0, len(response.Values))
+	for _, values := range response.Values {
+		row := make([]string, len(values))
+		for i, value := range values {
+			row[i] = fmt.Sprint(value)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Update writes the cells as raw values in a single batch
+func (s *GoogleSheet) Update(updates []Update) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	data := make([]map[string]interface{}, 0, len(updates))
+	for _, update := range updates {
+		last := update.Column + len(update.Values) - 1
+		values := make([]interface{}, len(update.Values))
+		for i, value := range update.Values {
+			values[i] = value
+		}
+		data = append(data, map[string]interface{}{
+			"range": fmt.Sprintf("%s!%s%d:%s%d", s.quotedName(),
+				ColumnName(update.Column), update.Row, ColumnName(last), update.Row),
+			"values": [][]interface{}{values},
+		})
+	}
+	request := map[string]interface{}{"valueInputOption": "RAW", "data": data}
+	return s.call("POST", "/values:batchUpdate", request, nil)
+}
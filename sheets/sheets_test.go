@@ -0,0 +1,108 @@
+package sheets
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumnName(t *testing.T) {
+	for index, name := range map[int]string{0: "A", 6: "G", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		assert.Equal(t, name, ColumnName(index), "Invalid column name of %v", index)
+	}
+}
+
+// testServiceAccountKey returns the JSON key of a service account whose tokens are requested from the URL
+func testServiceAccountKey(t *testing.T, tokenURI string) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "ledger@project.iam.gserviceaccount.com",
+		"private_key_id": "k1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      tokenURI,
+	})
+	return data
+}
+
+func TestNewGoogleSheet(t *testing.T) {
+	_, err := NewGoogleSheet("", "Journal", testServiceAccountKey(t, ""))
+	assert.NotNil(t, err, "Missing spreadsheet ID should fail")
+	_, err = NewGoogleSheet("s1", "Journal", []byte(`{"client_email": "ledger@project.iam.gserviceaccount.com", "private_key": "x"}`))
+	assert.NotNil(t, err, "Invalid private key should fail")
+	sheet, err := NewGoogleSheet("s1", "Journal", testServiceAccountKey(t, ""))
+	if assert.Nil(t, err, "Error creating sheet") {
+		assert.Equal(t, "https://oauth2.googleapis.com/token", sheet.Account.TokenURI, "Invalid default token URI")
+	}
+}
+
+func TestGoogleSheet(t *testing.T) {
+	var tokens int
+	var updates map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			tokens++
+			r.ParseForm()
+			assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.PostForm.Get("grant_type"), "Invalid grant type")
+			assert.Equal(t, 3, len(strings.Split(r.PostForm.Get("assertion"), ".")), "Assertion should be a JWT")
+			w.Write([]byte(`{"access_token": "a1", "expires_in": 3600, "token_type": "Bearer"}`))
+			return
+		}
+		assert.Equal(t, "Bearer a1", r.Header.Get("Authorization"), "Request should be authorized")
+		switch {
+		case r.Method == "GET" && r.URL.EscapedPath() == "/v4/spreadsheets/s1/values/%27Manual%20journal%27":
+			w.Write([]byte(`{"range": "'Manual journal'!A1:C2", "values": [["transaction_id", "delta"], ["t1", 100]]}`))
+		case r.Method == "POST" && r.URL.Path == "/v4/spreadsheets/s1/values:batchUpdate":
+			body, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(body, &updates)
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": 404, "message": "Requested entity was not found."}}`))
+		}
+	}))
+	defer server.Close()
+
+	sheet, err := NewGoogleSheet("s1", "Manual journal", testServiceAccountKey(t, server.URL+"/token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet.endpoint = server.URL
+	sheet.now = func() time.Time { return time.Date(2017, 1, 1, 13, 0, 0, 0, time.UTC) }
+
+	rows, err := sheet.Rows()
+	assert.Nil(t, err, "Error reading rows")
+	assert.Equal(t, [][]string{{"transaction_id", "delta"}, {"t1", "100"}}, rows, "Invalid rows")
+
+	err = sheet.Update([]Update{{Row: 2, Column: 5, Values: []string{"posted", ""}}})
+	assert.Nil(t, err, "Error updating cells")
+	assert.Equal(t, "RAW", updates["valueInputOption"], "Invalid value input option")
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"range":  "'Manual journal'!F2:G2",
+		"values": []interface{}{[]interface{}{"posted", ""}},
+	}}, updates["data"], "Invalid updates")
+	assert.Equal(t, 1, tokens, "Access token should be reused until it expires")
+
+	sheet.SpreadsheetID = "s2"
+	_, err = sheet.Rows()
+	if assert.NotNil(t, err, "Missing spreadsheet should fail") {
+		assert.Contains(t, err.Error(), "Requested entity was not found.", "Invalid error")
+	}
+}
@@ -0,0 +1,190 @@
+package slo
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RealImage/QLedger/metrics"
+)
+
+// windowMinutes is the longest window tracked by an SLO
+const windowMinutes = 24 * 60
+
+// Windows are the rolling windows over which the error budget burn is reported
+var Windows = []time.Duration{5 * time.Minute, time.Hour, 6 * time.Hour, 24 * time.Hour}
+
+var (
+	events = metrics.NewCounterVec(
+		"qledger_slo_events_total",
+		"Number of requests tracked by an SLO, partitioned by whether they met the objective.",
+		"slo", "result",
+	)
+	latencies = metrics.NewHistogramVec(
+		"qledger_slo_latency_seconds",
+		"Latency of the requests tracked by an SLO.",
+		nil, "slo",
+	)
+	_ = metrics.NewGaugeFunc(
+		"qledger_slo_burn_rate",
+		"Rate at which the error budget of an SLO is consumed. A burn rate of 1 consumes the budget exactly at the objective.",
+		func(g *metrics.GaugeVec) {
+			for _, summary := range Summaries() {
+				for _, w := range summary.Windows {
+					g.Set(w.BurnRate, summary.Name, w.Window)
+				}
+			}
+		},
+		"slo", "window",
+	)
+	_ = metrics.NewGaugeFunc(
+		"qledger_slo_error_budget_remaining",
+		"Fraction of the error budget of an SLO remaining in the window.",
+		func(g *metrics.GaugeVec) {
+			for _, summary := range Summaries() {
+				for _, w := range summary.Windows {
+					g.Set(w.BudgetRemaining, summary.Name, w.Window)
+				}
+			}
+		},
+		"slo", "window",
+	)
+)
+
+var (
+	trackersMu sync.RWMutex
+	trackers   = make(map[string]*Tracker)
+)
+
+type bucket struct {
+	minute int64
+	total  int64
+	bad    int64
+}
+
+// Tracker tracks the latency and error objective of an endpoint.
+// A request is bad when it fails or takes longer than the latency target.
+type Tracker struct {
+	Name string
+
+	mu            sync.Mutex
+	latencyTarget time.Duration
+	objective     float64
+	buckets       [windowMinutes]bucket
+	now           func() time.Time
+}
+
+// NewTracker creates a new tracker and registers it for reporting
+func NewTracker(name string, latencyTarget time.Duration, objective float64) *Tracker {
+	t := &Tracker{
+		Name:          name,
+		latencyTarget: latencyTarget,
+		objective:     objective,
+		now:           time.Now,
+	}
+	trackersMu.Lock()
+	defer trackersMu.Unlock()
+	trackers[name] = t
+	return t
+}
+
+// SetTargets changes the latency target and objective of the SLO.
+// The requests already tracked are not re-evaluated.
+func (t *Tracker) SetTargets(latencyTarget time.Duration, objective float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.latencyTarget = latencyTarget
+	t.objective = objective
+}
+
+// Record tracks a request with its latency and whether it failed
+func (t *Tracker) Record(latency time.Duration, failed bool) {
+	minute := t.now().Unix() / 60
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	bad := failed || latency > t.latencyTarget
+	result := "good"
+	if bad {
+		result = "bad"
+	}
+	events.Inc(t.Name, result)
+	latencies.Observe(latency.Seconds(), t.Name)
+
+	b := &t.buckets[minute%windowMinutes]
+	if b.minute != minute {
+		*b = bucket{minute: minute}
+	}
+	b.total++
+	if bad {
+		b.bad++
+	}
+}
+
+// WindowSummary represents the consumption of the error budget in a rolling window
+type WindowSummary struct {
+	Window          string  `json:"window"`
+	Total           int64   `json:"total"`
+	Bad             int64   `json:"bad"`
+	ErrorRate       float64 `json:"error_rate"`
+	BurnRate        float64 `json:"burn_rate"`
+	BudgetRemaining float64 `json:"budget_remaining"`
+}
+
+// Summary represents the state of an SLO
+type Summary struct {
+	Name            string          `json:"name"`
+	LatencyTargetMS int64           `json:"latency_target_ms"`
+	Objective       float64         `json:"objective"`
+	Windows         []WindowSummary `json:"windows"`
+}
+
+// Summary returns the error budget consumption in all the reporting windows
+func (t *Tracker) Summary() Summary {
+	minute := t.now().Unix() / 60
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	summary := Summary{
+		Name:            t.Name,
+		LatencyTargetMS: int64(t.latencyTarget / time.Millisecond),
+		Objective:       t.objective,
+	}
+	budget := 1 - t.objective
+	for _, window := range Windows {
+		w := WindowSummary{Window: window.String(), BudgetRemaining: 1}
+		minutes := int64(window / time.Minute)
+		for _, b := range t.buckets {
+			if b.total > 0 && b.minute > minute-minutes && b.minute <= minute {
+				w.Total += b.total
+				w.Bad += b.bad
+			}
+		}
+		if w.Total > 0 {
+			w.ErrorRate = float64(w.Bad) / float64(w.Total)
+			if budget > 0 {
+				w.BurnRate = w.ErrorRate / budget
+				w.BudgetRemaining = 1 - w.BurnRate
+			}
+		}
+		summary.Windows = append(summary.Windows, w)
+	}
+	return summary
+}
+
+// Summaries returns the summaries of all the registered trackers ordered by name
+func Summaries() []Summary {
+	trackersMu.RLock()
+	list := make([]*Tracker, 0, len(trackers))
+	for _, t := range trackers {
+		list = append(list, t)
+	}
+	trackersMu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	summaries := make([]Summary, 0, len(list))
+	for _, t := range list {
+		summaries = append(summaries, t.Summary())
+	}
+	return summaries
+}
@@ -0,0 +1,51 @@
+package slo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackerSummary(t *testing.T) {
+	now := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker("test", 100*time.Millisecond, 0.99)
+	tracker.now = func() time.Time { return now }
+
+	// 2 hours ago: one bad request
+	now = now.Add(-2 * time.Hour)
+	tracker.Record(500*time.Millisecond, false)
+	now = now.Add(2 * time.Hour)
+
+	// Now: 98 good requests, one failed and one slow request
+	for i := 0; i < 98; i++ {
+		tracker.Record(10*time.Millisecond, false)
+	}
+	tracker.Record(10*time.Millisecond, true)
+	tracker.Record(200*time.Millisecond, false)
+
+	summary := tracker.Summary()
+	assert.Equal(t, "test", summary.Name, "Invalid SLO name")
+	assert.Equal(t, int64(100), summary.LatencyTargetMS, "Invalid latency target")
+	assert.Equal(t, len(Windows), len(summary.Windows), "Windows count doesn't match")
+
+	hour := summary.Windows[1]
+	assert.Equal(t, "1h0m0s", hour.Window, "Invalid window")
+	assert.Equal(t, int64(100), hour.Total, "Invalid total")
+	assert.Equal(t, int64(2), hour.Bad, "Invalid bad count")
+	assert.InDelta(t, 2.0, hour.BurnRate, 0.0001, "Invalid burn rate")
+	assert.InDelta(t, -1.0, hour.BudgetRemaining, 0.0001, "Invalid budget remaining")
+
+	day := summary.Windows[3]
+	assert.Equal(t, int64(101), day.Total, "Invalid total")
+	assert.Equal(t, int64(3), day.Bad, "Invalid bad count")
+}
+
+func TestTrackerEmptySummary(t *testing.T) {
+	tracker := NewTracker("empty", time.Second, 0.999)
+	summary := tracker.Summary()
+	for _, w := range summary.Windows {
+		assert.Equal(t, int64(0), w.Total, "Invalid total")
+		assert.Equal(t, float64(1), w.BudgetRemaining, "Invalid budget remaining")
+	}
+}
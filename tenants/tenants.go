@@ -0,0 +1,198 @@
+// Package tenants isolates the ledger of every tenant in its own Postgres schema or database.
+//
+// The tenants share the server, and every request is routed to the application context
+// of its tenant, whose DB connections only see the ledger of the tenant.
+package tenants
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	ledgerContext "github.com/RealImage/QLedger/context"
+	"github.com/RealImage/QLedger/models"
+	"github.com/lib/pq"
+)
+
+// Isolation modes of the tenants
+const (
+	// IsolationSchema keeps the ledger of every tenant in its own schema of the database
+	IsolationSchema = "schema"
+	// IsolationDatabase keeps the ledger of every tenant in its own database of the server
+	IsolationDatabase = "database"
+)
+
+// ErrInvalidTenant is returned for a missing or invalid tenant ID
+var ErrInvalidTenant = errors.New("Invalid tenant")
+
+// ErrUnknownTenant is returned for a tenant without a ledger
+var ErrUnknownTenant = errors.New("Unknown tenant")
+
+// Tenant IDs are used in the schema and database names, so they are restricted to lowercase identifiers
+var validTenantID = regexp.MustCompile(`^[a-z0-9_]{1,48}$`)
+
+// IsValid says whether the tenant ID is valid
+func IsValid(tenant string) bool {
+	return validTenantID.MatchString(tenant)
+}
+
+// Name returns the name of the schema or database of the tenant
+func Name(tenant string) string {
+	return "ledger_" + tenant
+}
+
+// DatabaseURL returns the URL connecting to the ledger of the tenant, from the URL of the shared database.
+// In the schema mode, the connections only search the schema of the tenant.
+func DatabaseURL(mode, databaseURL, tenant string) (string, error) {
+	var key string
+	switch mode {
+	case IsolationSchema:
+		key = "search_path"
+	case IsolationDatabase:
+		key = "dbname"
+	default:
+		return "", fmt.Errorf("Invalid tenant isolation: %v", mode)
+	}
+
+	if !strings.HasPrefix(databaseURL, "postgres://") && !strings.HasPrefix(databaseURL, "postgresql://") {
+		// The later settings of a connection string override the earlier ones
+		return strings.TrimSpace(databaseURL + " " + key + "=" + Name(tenant)), nil
+	}
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		return "", err
+	}
+	if key == "dbname" {
+		u.Path = "/" + Name(tenant)
+	} else {
+		q := u.Query()
+		q.Set(key, Name(tenant))
+		u.RawQuery = q.Encode()
+	}
+	return u.String(), nil
+}
+
+// SetupFunc prepares the context of a tenant before its first request, such as by migrating its schema
+type SetupFunc func(tenant string, context *ledgerContext.AppContext) error
+
+type entry struct {
+	ready   chan struct{}
+	context *ledgerContext.AppContext
+	err     error
+}
+
+// Registry opens the application contexts of the tenants on their first requests
+type Registry struct {
+	mode        string
+	databaseURL string
+	db          *sql.DB
+	setup       SetupFunc
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	// openMu opens one tenant at a time, as the migrations of all tenants share a lock
+	openMu sync.Mutex
+}
+
+// NewRegistry returns a new instance of `Registry` in the isolation mode.
+// The shared DB creates the schemas or databases of the new tenants.
+func NewRegistry(mode, databaseURL string, db *sql.DB, setup SetupFunc) (*Registry, error) {
+	if mode != IsolationSchema && mode != IsolationDatabase {
+		return nil, fmt.Errorf("Invalid tenant isolation: %v", mode)
+	}
+	return &Registry{
+		mode:        mode,
+		databaseURL: databaseURL,
+		db:          db,
+		setup:       setup,
+		entries:     make(map[string]*entry),
+	}, nil
+}
+
+// Context returns the application context of the tenant, opening it if needed
+func (r *Registry) Context(tenant string) (*ledgerContext.AppContext, error) {
+	if !IsValid(tenant) {
+		return nil, ErrInvalidTenant
+	}
+	r.mu.Lock()
+	e, ok := r.entries[tenant]
+	if !ok {
+		e = &entry{ready: make(chan struct{})}
+		r.entries[tenant] = e
+	}
+	r.mu.Unlock()
+
+	if !ok {
+		e.context, e.err = r.open(tenant)
+		if e.err != nil {
+			// The tenant is opened again on its next request
+			r.mu.Lock()
+			delete(r.entries, tenant)
+			r.mu.Unlock()
+		}
+		close(e.ready)
+	}
+	<-e.ready
+	return e.context, e.err
+}
+
+func (r *Registry) open(tenant string) (*ledgerContext.AppContext, error) {
+	r.openMu.Lock()
+	defer r.openMu.Unlock()
+
+	// Only the tenants with a ledger in the shared database are opened
+	ledgerDB := models.NewLedgerDB(r.db)
+	exists, aerr := ledgerDB.Exists(tenant)
+	if aerr != nil {
+		log.Println("Error checking tenant:", tenant, aerr)
+		return nil, aerr
+	}
+	if !exists {
+		return nil, ErrUnknownTenant
+	}
+	if err := r.create(tenant); err != nil {
+		log.Println("Error creating tenant:", tenant, err)
+		return nil, err
+	}
+	databaseURL, err := DatabaseURL(r.mode, r.databaseURL, tenant)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	// The context of a tenant can reach the other tenants, such as to clone its ledger
+	context := &ledgerContext.AppContext{DB: db, Tenant: r.Context, LedgerID: tenant}
+	if err := r.setup(tenant, context); err != nil {
+		log.Println("Error setting up tenant:", tenant, err)
+		db.Close()
+		return nil, err
+	}
+	log.Println("Opened tenant:", tenant)
+	return context, nil
+}
+
+// create creates the schema or database of the tenant, unless it exists
+func (r *Registry) create(tenant string) error {
+	name := Name(tenant)
+	if r.mode == IsolationSchema {
+		_, err := r.db.Exec("CREATE SCHEMA IF NOT EXISTS " + pq.QuoteIdentifier(name))
+		return err
+	}
+	var exists bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", name).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+	_, err = r.db.Exec("CREATE DATABASE " + pq.QuoteIdentifier(name))
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "duplicate_database" {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// checkpointEvery is the number of posted transactions after which the progress is saved
+const checkpointEvery = 100
+
+// PhaseCheckpoint is the progress of a phase of the CSV tests
+type PhaseCheckpoint struct {
+	// ExpectedBalances are the balances of the accounts expected once the phase completes,
+	// which can't be derived again from the current balances once some transactions are posted
+	ExpectedBalances map[string]int  `json:"expected_balances"`
+	Posted           map[string]bool `json:"posted"`
+	Verified         bool            `json:"verified"`
+	// resumed says whether the phase was started by an interrupted run
+	resumed bool
+}
+
+// Checkpoint is the progress of the CSV tests, which is saved to a state file so that
+// an interrupted run resumes where it stopped
+type Checkpoint struct {
+	// Timestamp is the tag of the transaction IDs of the run, which a resumed run keeps
+	Timestamp string                      `json:"timestamp"`
+	Phases    map[string]*PhaseCheckpoint `json:"phases"`
+
+	path    string
+	mu      sync.Mutex
+	unsaved int
+}
+
+// LoadCheckpoint loads the progress from the state file if it exists, or starts a new run with the timestamp.
+// The progress is kept only in memory without a state file.
+func LoadCheckpoint(path string, timestamp string) *Checkpoint {
+	c := &Checkpoint{Timestamp: timestamp, Phases: make(map[string]*PhaseCheckpoint), path: path}
+	if path == "" {
+		return c
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c
+	}
+	if err != nil {
+		log.Fatalln("Error reading checkpoint:", err)
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		log.Fatalln("Error parsing checkpoint:", err)
+	}
+	for _, phase := range c.Phases {
+		phase.resumed = true
+	}
+	log.Printf("Resuming run %v from checkpoint: %v", c.Timestamp, path)
+	return c
+}
+
+// Phase returns the progress of the phase, preparing its expected balances unless the phase was started before
+func (c *Checkpoint) Phase(name string, endpoint string, accounts []map[string]interface{}, load int) *PhaseCheckpoint {
+	c.mu.Lock()
+	phase, ok := c.Phases[name]
+	c.mu.Unlock()
+	if ok {
+		log.Println("Resuming phase:", name)
+		for _, acc := range accounts {
+			acc["expected_balance"] = phase.ExpectedBalances[acc["id"].(string)]
+		}
+		return phase
+	}
+	PrepareExpectedBalance(endpoint, accounts, load)
+	phase = &PhaseCheckpoint{ExpectedBalances: make(map[string]int), Posted: make(map[string]bool)}
+	for _, acc := range accounts {
+		phase.ExpectedBalances[acc["id"].(string)] = acc["expected_balance"].(int)
+	}
+	c.mu.Lock()
+	c.Phases[name] = phase
+	c.mu.Unlock()
+	c.Save()
+	return phase
+}
+
+// IsPosted says whether the transaction of the phase was posted
+func (c *Checkpoint) IsPosted(phase *PhaseCheckpoint, id interface{}) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return phase.Posted[id.(string)]
+}
+
+// MarkPosted records the posted transaction of the phase, saving the progress every few transactions
+func (c *Checkpoint) MarkPosted(phase *PhaseCheckpoint, id interface{}) {
+	c.mu.Lock()
+	phase.Posted[id.(string)] = true
+	c.unsaved++
+	save := c.unsaved >= checkpointEvery
+	c.mu.Unlock()
+	if save {
+		c.Save()
+	}
+}
+
+// MarkVerified records the phase as verified
+func (c *Checkpoint) MarkVerified(phase *PhaseCheckpoint) {
+	c.mu.Lock()
+	phase.Verified = true
+	c.mu.Unlock()
+	c.Save()
+}
+
+// Save writes the progress to the state file, replacing it in a single rename
+func (c *Checkpoint) Save() {
+	if c.path == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.Marshal(c)
+	if err != nil {
+		log.Fatalln("Error encoding checkpoint:", err)
+	}
+	tmp := filepath.Join(filepath.Dir(c.path), "."+filepath.Base(c.path)+".tmp")
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		log.Fatalln("Error writing checkpoint:", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		log.Fatalln("Error writing checkpoint:", err)
+	}
+	c.unsaved = 0
+}
+
+// Done removes the completed phases, and the state file once no phase is left
+func (c *Checkpoint) Done(names ...string) {
+	c.mu.Lock()
+	for _, name := range names {
+		delete(c.Phases, name)
+	}
+	empty := len(c.Phases) == 0
+	c.mu.Unlock()
+	if c.path == "" {
+		return
+	}
+	if !empty {
+		c.Save()
+		return
+	}
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		log.Fatalln("Error removing checkpoint:", err)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	assert.Nil(t, err, "Error creating temp dir")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	accounts := []map[string]interface{}{{"id": "alice", "expected_balance": 300}}
+	c := LoadCheckpoint(path, "20170630000000")
+	phase := &PhaseCheckpoint{ExpectedBalances: map[string]int{"alice": 300}, Posted: make(map[string]bool)}
+	c.Phases["sequential"] = phase
+	c.MarkPosted(phase, "sequential_1_100")
+	c.MarkVerified(phase)
+	c.Phases["parallel"] = &PhaseCheckpoint{ExpectedBalances: map[string]int{"alice": 600}, Posted: make(map[string]bool)}
+	c.Save()
+
+	resumed := LoadCheckpoint(path, "20170701000000")
+	assert.Equal(t, "20170630000000", resumed.Timestamp, "Resumed run should keep its timestamp")
+	sequential := resumed.Phase("sequential", "", accounts, 3)
+	assert.True(t, sequential.Verified, "Phase should be verified")
+	assert.True(t, resumed.IsPosted(sequential, "sequential_1_100"), "Transaction should be posted")
+	assert.False(t, resumed.IsPosted(sequential, "sequential_2_100"), "Transaction should not be posted")
+	resumed.Phase("parallel", "", accounts, 3)
+	assert.Equal(t, 600, accounts[0]["expected_balance"], "Expected balance should be restored")
+
+	resumed.Done("sequential")
+	_, err = os.Stat(path)
+	assert.Nil(t, err, "State file should be kept while a phase is left")
+	resumed.Done("parallel")
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "State file should be removed once all phases are done")
+}
@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"encoding/csv"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -25,84 +26,152 @@ import (
 	"github.com/stretchr/testify/suite"
 )
 
-func RunCSVTests(accountsEndpoint string, transactionsEndpoint string, filename string, load int) {
-	// Timestamp to avoid conflict IDs
-	timestamp := time.Now().UTC().Format("20060102150405")
+var bulk = flag.Bool("bulk", false, "Run the CSV tests against the bulk transactions endpoint")
 
-	log.Println("Importing data from CSV:", filename)
-	transactions, accounts := ImportTransactionCSV(filename)
+var checkpoint = flag.String("checkpoint", "", "State file of the progress of the CSV tests, to resume an interrupted run")
 
-	// test sequential transactions
-	log.Println("Testing sequential transactions...")
-	PrepareExpectedBalance(accountsEndpoint, accounts, load)
+// postPhase posts the clones of the transactions with the tag of every load, skipping those the phase
+// already posted, and fails on a status other than the accepted ones
+func postPhase(c *Checkpoint, phase *PhaseCheckpoint, endpoint string, transactions []map[string]interface{},
+	load int, prefix string, parallel bool) {
+	// A transaction posted by an interrupted run may not be checkpointed yet, and is repeated as a duplicate
+	accepted := func(status int) bool {
+		return status == http.StatusCreated || (phase.resumed && status == http.StatusAccepted)
+	}
+	var wg sync.WaitGroup
 	for _, transaction := range transactions {
 		for i := 1; i <= load; i++ {
-			tag := fmt.Sprintf("sequential_%v_%v", i, timestamp)
+			tag := fmt.Sprintf("%v_%v_%v", prefix, i, c.Timestamp)
 			t := CloneTransaction(transaction, tag)
-			status := PostTransaction(transactionsEndpoint, t)
-			if status != http.StatusCreated {
-				log.Fatalf("Sequential transaction:%v failed with status code:%v", t["id"], status)
+			if c.IsPosted(phase, t["id"]) {
+				continue
+			}
+			post := func() {
+				status := PostTransaction(endpoint, t)
+				if !accepted(status) {
+					log.Fatalf("%v transaction:%v failed with status code:%v", prefix, t["id"], status)
+				}
+				c.MarkPosted(phase, t["id"])
 			}
+			if !parallel {
+				post()
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				post()
+			}()
 		}
 	}
-	VerifyExpectedBalance(accountsEndpoint, accounts)
+	wg.Wait()
+	c.Save()
+}
+
+func RunCSVTests(accountsEndpoint string, transactionsEndpoint string, filename string, load int) {
+	// Timestamp to avoid conflict IDs, which is kept by a resumed run
+	c := LoadCheckpoint(*checkpoint, time.Now().UTC().Format("20060102150405"))
+
+	log.Println("Importing data from CSV:", filename)
+	transactions, accounts := ImportTransactionCSV(filename)
+
+	// test sequential transactions
+	log.Println("Testing sequential transactions...")
+	if phase := c.Phase("sequential", accountsEndpoint, accounts, load); !phase.Verified {
+		postPhase(c, phase, transactionsEndpoint, transactions, load, "sequential", false)
+		VerifyExpectedBalance(accountsEndpoint, accounts)
+		c.MarkVerified(phase)
+	}
 	log.Println("Successful sequential transactions")
 
 	// test parallel transactions
 	log.Println("Testing parallel transactions...")
-	PrepareExpectedBalance(accountsEndpoint, accounts, load)
-	var pwg sync.WaitGroup
-	pwg.Add(len(transactions) * load)
-	for _, transaction := range transactions {
-		for i := 1; i <= load; i++ {
-			tag := fmt.Sprintf("parallel_%v_%v", i, timestamp)
-			t := CloneTransaction(transaction, tag)
-			go func() {
-				status := PostTransaction(transactionsEndpoint, t)
-				if status != http.StatusCreated {
-					log.Fatalf("Parallel transaction:%v failed with status code:%v", t["id"], status)
-				}
-				pwg.Done()
-			}()
-		}
+	if phase := c.Phase("parallel", accountsEndpoint, accounts, load); !phase.Verified {
+		postPhase(c, phase, transactionsEndpoint, transactions, load, "parallel", true)
+		VerifyExpectedBalance(accountsEndpoint, accounts)
+		c.MarkVerified(phase)
 	}
-	pwg.Wait()
-	VerifyExpectedBalance(accountsEndpoint, accounts)
 	log.Println("Successful parallel transactions")
 
 	// test repeated parallel transactions
 	log.Println("Testing repeated parallel transactions...")
-	PrepareExpectedBalance(accountsEndpoint, accounts, load)
-	var rwg sync.WaitGroup
-	rwg.Add(len(transactions) * load * 2)
-	for _, transaction := range transactions {
-		for i := 1; i <= load; i++ {
-			tag := fmt.Sprintf("repeated_%v_%v", i, timestamp)
-			t := CloneTransaction(transaction, tag)
-			var localwg sync.WaitGroup
-			localwg.Add(2)
-			var status1, status2 int
-			go func() {
-				status1 = PostTransaction(transactionsEndpoint, t)
-				rwg.Done()
-				localwg.Done()
-			}()
-			go func() {
-				status2 = PostTransaction(transactionsEndpoint, t)
-				rwg.Done()
-				localwg.Done()
-			}()
-			localwg.Wait()
-			if (status1 != http.StatusCreated && status1 != http.StatusAccepted) || (status2 != http.StatusCreated && status2 != http.StatusAccepted) {
-				log.Fatalf("Parallel repeated transactions with same ID %v are not accepted", t["id"])
-			} else if status1 >= 400 && status2 >= 400 {
-				log.Fatalf("Both parallel repeated transactions with same ID %v are failed", t["id"])
+	if phase := c.Phase("repeated", accountsEndpoint, accounts, load); !phase.Verified {
+		var rwg sync.WaitGroup
+		for _, transaction := range transactions {
+			for i := 1; i <= load; i++ {
+				tag := fmt.Sprintf("repeated_%v_%v", i, c.Timestamp)
+				t := CloneTransaction(transaction, tag)
+				if c.IsPosted(phase, t["id"]) {
+					continue
+				}
+				rwg.Add(2)
+				var localwg sync.WaitGroup
+				localwg.Add(2)
+				var status1, status2 int
+				go func() {
+					status1 = PostTransaction(transactionsEndpoint, t)
+					rwg.Done()
+					localwg.Done()
+				}()
+				go func() {
+					status2 = PostTransaction(transactionsEndpoint, t)
+					rwg.Done()
+					localwg.Done()
+				}()
+				localwg.Wait()
+				if (status1 != http.StatusCreated && status1 != http.StatusAccepted) || (status2 != http.StatusCreated && status2 != http.StatusAccepted) {
+					log.Fatalf("Parallel repeated transactions with same ID %v are not accepted", t["id"])
+				} else if status1 >= 400 && status2 >= 400 {
+					log.Fatalf("Both parallel repeated transactions with same ID %v are failed", t["id"])
+				}
+				c.MarkPosted(phase, t["id"])
 			}
 		}
+		rwg.Wait()
+		VerifyExpectedBalance(accountsEndpoint, accounts)
+		c.MarkVerified(phase)
 	}
-	rwg.Wait()
-	VerifyExpectedBalance(accountsEndpoint, accounts)
 	log.Println("Successful repeated parallel transactions")
+	c.Done("sequential", "parallel", "repeated")
+}
+
+func RunBulkCSVTests(accountsEndpoint string, transactionsEndpoint string, filename string, load int) {
+	// Timestamp to avoid conflict IDs, which is kept by a resumed run
+	c := LoadCheckpoint(*checkpoint, time.Now().UTC().Format("20060102150405"))
+
+	log.Println("Importing data from CSV:", filename)
+	transactions, accounts := ImportTransactionCSV(filename)
+
+	// test parallel bulk requests, each repeating the same transactions,
+	// which are all repeated as duplicates by a resumed run
+	log.Println("Testing bulk transactions...")
+	if phase := c.Phase("bulk", accountsEndpoint, accounts, load); !phase.Verified {
+		var batch []map[string]interface{}
+		for _, transaction := range transactions {
+			for i := 1; i <= load; i++ {
+				tag := fmt.Sprintf("bulk_%v_%v", i, c.Timestamp)
+				batch = append(batch, CloneTransaction(transaction, tag))
+			}
+		}
+		var wg sync.WaitGroup
+		wg.Add(2)
+		for r := 0; r < 2; r++ {
+			go func() {
+				results := PostBulkTransactions(transactionsEndpoint, batch)
+				for _, result := range results {
+					if result.Status != models.BulkStatusCreated && result.Status != models.BulkStatusDuplicate {
+						log.Fatalf("Bulk transaction:%v failed with reason:%v", result.ID, result.Reason)
+					}
+				}
+				wg.Done()
+			}()
+		}
+		wg.Wait()
+		VerifyExpectedBalance(accountsEndpoint, accounts)
+		c.MarkVerified(phase)
+	}
+	log.Println("Successful bulk transactions")
+	c.Done("bulk")
 }
 
 func ImportTransactionCSV(filename string) ([]map[string]interface{}, []map[string]interface{}) {
@@ -117,8 +186,11 @@ func ImportTransactionCSV(filename string) ([]map[string]interface{}, []map[stri
 		log.Fatalln("Error reading CSV:", err)
 	}
 
+	// The transactions and accounts are listed in the order they first appear in the CSV,
+	// so that every run posts the transactions in the same order
 	transactions := make(map[string]interface{})
 	accounts := make(map[string]interface{})
+	var transactionIDs, accountIDs []string
 	for _, row := range rows[1:] { // skip row 0
 		transactionID, accountID, deltaVal := row[0], row[1], row[2]
 		delta, err := strconv.Atoi(deltaVal)
@@ -127,6 +199,7 @@ func ImportTransactionCSV(filename string) ([]map[string]interface{}, []map[stri
 		}
 		// track the transactions
 		if _, ok := transactions[transactionID]; !ok {
+			transactionIDs = append(transactionIDs, transactionID)
 			transactions[transactionID] = map[string]interface{}{
 				"_id": transactionID,
 				"lines": []map[string]interface{}{
@@ -147,6 +220,7 @@ func ImportTransactionCSV(filename string) ([]map[string]interface{}, []map[stri
 		}
 		// track the accounts
 		if _, ok := accounts[accountID]; !ok {
+			accountIDs = append(accountIDs, accountID)
 			accounts[accountID] = map[string]interface{}{
 				"id":        accountID,
 				"delta_sum": delta,
@@ -160,13 +234,13 @@ func ImportTransactionCSV(filename string) ([]map[string]interface{}, []map[stri
 
 	// convert to slices
 	var transactionsList []map[string]interface{}
-	for _, txn := range transactions {
-		t, _ := txn.(map[string]interface{})
+	for _, id := range transactionIDs {
+		t, _ := transactions[id].(map[string]interface{})
 		transactionsList = append(transactionsList, t)
 	}
 	var accountsList []map[string]interface{}
-	for _, acc := range accounts {
-		a, _ := acc.(map[string]interface{})
+	for _, id := range accountIDs {
+		a, _ := accounts[id].(map[string]interface{})
 		accountsList = append(accountsList, a)
 	}
 	return transactionsList, accountsList
@@ -214,6 +288,29 @@ func PostTransaction(endpoint string, transaction map[string]interface{}) int {
 	return res.StatusCode
 }
 
+func PostBulkTransactions(endpoint string, transactions []map[string]interface{}) []models.BulkResult {
+	log.Printf("Posting %v bulk transactions", len(transactions))
+	payload, err := json.Marshal(transactions)
+	if err != nil {
+		log.Fatalf("Invalid bulk transactions data: %v", err)
+	}
+	bulkURL := endpoint + "/v1/transactions/_bulk"
+	res, err := http.Post(bulkURL, "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		log.Fatalf("Error in bulk transactions: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		log.Fatalf("Bulk transactions failed with status code:%v", res.StatusCode)
+	}
+	var results []models.BulkResult
+	err = json.NewDecoder(res.Body).Decode(&results)
+	if err != nil {
+		log.Fatalf("Error parsing bulk transactions result: %v", err)
+	}
+	return results
+}
+
 func CloneTransaction(transaction map[string]interface{}, tag string) map[string]interface{} {
 	t := make(map[string]interface{})
 	t["id"] = fmt.Sprintf("%v_%v", tag, transaction["_id"])
@@ -267,6 +364,16 @@ func (cs *CSVSuite) TestTransactionsLoad() {
 	RunCSVTests(cs.accountServer.URL, cs.transactionsServer.URL, "transactions.csv", 3)
 }
 
+func (cs *CSVSuite) TestBulkTransactionsLoad() {
+	if !*bulk {
+		cs.T().Skip("Run with -bulk to test the bulk transactions endpoint")
+	}
+	bulkServer := httptest.NewServer(middlewares.ContextMiddleware(controllers.PostTransactionAction, cs.context))
+	defer bulkServer.Close()
+	log.Println("Running bulk tests from endpoints:", cs.accountServer.URL, bulkServer.URL)
+	RunBulkCSVTests(cs.accountServer.URL, bulkServer.URL, "transactions.csv", 3)
+}
+
 func (cs *CSVSuite) TearDownTest() {
 	log.Println("Closing test endpoints...")
 	defer cs.accountServer.Close()
@@ -0,0 +1,271 @@
+package verifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/RealImage/QLedger/models"
+)
+
+// Kinds of the inconsistencies between the event stream of the ledger and its balances
+const (
+	// BalanceMismatched is an account whose balance recomputed from the events differs from its balance
+	// in the ledger, such as when events are lost
+	BalanceMismatched = "balance_mismatched"
+	// ConflictingEvent is a transaction delivered again with different lines
+	ConflictingEvent = "conflicting_event"
+	// OutOfOrder is a delivery received after a later delivery
+	OutOfOrder = "out_of_order"
+)
+
+// transactionCreatedEvent is the event of the posted transactions, whose lines change the balances
+const transactionCreatedEvent = "transaction.created"
+
+// ErrStreamChanged is returned when events are added while the balances are compared,
+// so that the balances of the ledger may include transactions which the checker hasn't seen yet
+var ErrStreamChanged = errors.New("Events were added while comparing balances")
+
+// EventSummary counts the events added to the checker
+type EventSummary struct {
+	Events       int `json:"events"`
+	Redelivered  int `json:"redelivered"`
+	Transactions int `json:"transactions"`
+	Conflicting  int `json:"conflicting"`
+	OutOfOrder   int `json:"out_of_order"`
+}
+
+// Balances are the balances of an account by currency, where the empty currency is of the lines without one
+type Balances map[string]int
+
+// LedgerBalances returns the balances of the account as reported by the ledger, whose `balance` is
+// of the lines without a currency and whose `balances` are of the other currencies
+func LedgerBalances(account *models.Account) Balances {
+	balances := Balances{"": account.Balance}
+	for currency, balance := range account.Balances {
+		balances[currency] = balance
+	}
+	return balances
+}
+
+// EventChecker recomputes the balances of the accounts from the `transaction.created` events
+// of the ledger, so that they can be compared against the balances reported by the ledger.
+// Events can be added concurrently, such as by the requests of a webhook.
+type EventChecker struct {
+	write func(*Diff) error
+
+	mu sync.Mutex
+	// transactions are the lines of the seen transactions, which tell apart the redeliveries
+	transactions map[string][]models.TransactionLine
+	balances     map[string]Balances
+	lastDelivery int64
+	summary      EventSummary
+}
+
+// NewEventChecker returns an event checker, which writes the inconsistencies using `write`
+func NewEventChecker(write func(*Diff) error) *EventChecker {
+	return &EventChecker{
+		write:        write,
+		transactions: make(map[string][]models.TransactionLine),
+		balances:     make(map[string]Balances),
+	}
+}
+
+// sortedLines returns the lines in the order of their accounts, currencies and deltas
+func sortedLines(lines []*models.TransactionLine) []models.TransactionLine {
+	sorted := make([]models.TransactionLine, 0, len(lines))
+	for _, line := range lines {
+		sorted = append(sorted, models.TransactionLine{AccountID: line.AccountID, Delta: line.Delta, Currency: line.Currency})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		switch {
+		case a.AccountID != b.AccountID:
+			return a.AccountID < b.AccountID
+		case a.Currency != b.Currency:
+			return a.Currency < b.Currency
+		}
+		return a.Delta < b.Delta
+	})
+	return sorted
+}
+
+// AddEvent adds a webhook payload of the ledger along with the ID of its delivery, or 0 if it isn't known.
+// The events other than `transaction.created` are only counted.
+func (c *EventChecker) AddEvent(payload []byte, delivery int64) error {
+	var event struct {
+		Event string          `json:"event"`
+		Data  json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return fmt.Errorf("Invalid event: %v", err)
+	}
+	var transaction *models.Transaction
+	if event.Event == transactionCreatedEvent {
+		transaction = &models.Transaction{}
+		if err := json.Unmarshal(event.Data, transaction); err != nil || transaction.ID == "" {
+			return fmt.Errorf("Invalid transaction of event: %s", event.Data)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.summary.Events++
+	if delivery != 0 {
+		if delivery < c.lastDelivery {
+			c.summary.OutOfOrder++
+			id := ""
+			if transaction != nil {
+				id = transaction.ID
+			}
+			if err := c.write(&Diff{ID: id, Kind: OutOfOrder, Delivery: delivery}); err != nil {
+				return err
+			}
+		} else {
+			c.lastDelivery = delivery
+		}
+	}
+	if transaction == nil {
+		return nil
+	}
+
+	lines := sortedLines(transaction.Lines)
+	if seen, ok := c.transactions[transaction.ID]; ok {
+		if reflect.DeepEqual(seen, lines) {
+			c.summary.Redelivered++
+			return nil
+		}
+		c.summary.Conflicting++
+		return c.write(&Diff{ID: transaction.ID, Kind: ConflictingEvent, Delivery: delivery})
+	}
+	c.transactions[transaction.ID] = lines
+	c.summary.Transactions++
+	for _, line := range lines {
+		balances, ok := c.balances[line.AccountID]
+		if !ok {
+			balances = make(Balances)
+			c.balances[line.AccountID] = balances
+		}
+		balances[line.Currency] += line.Delta
+	}
+	return nil
+}
+
+// RecordedEvent is an event as received, with the ID of its delivery if known
+type RecordedEvent struct {
+	Delivery int64           `json:"delivery,omitempty"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// Summary returns the counts of the events added so far
+func (c *EventChecker) Summary() EventSummary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.summary
+}
+
+// ReadEvents adds the events of JSON Lines in the order they were received, with either a webhook payload
+// or a `RecordedEvent` per line
+func (c *EventChecker) ReadEvents(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error reading JSON line %d: %v", line, err)
+		}
+		recorded := &RecordedEvent{}
+		if err := json.Unmarshal(raw, recorded); err != nil {
+			return fmt.Errorf("Invalid JSON line %d: %v", line, err)
+		}
+		if recorded.Payload != nil {
+			err = c.AddEvent(recorded.Payload, recorded.Delivery)
+		} else {
+			err = c.AddEvent(raw, 0)
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid JSON line %d: %v", line, err)
+		}
+	}
+}
+
+// Compare compares the recomputed balances of the accounts, in the order of their IDs, against their
+// balances in the ledger returned by `ledgerBalances`, and returns the number of the compared and the
+// mismatched accounts. It returns `ErrStreamChanged` without writing the mismatches if events are
+// added meanwhile, as the ledger is then ahead of the checker.
+func (c *EventChecker) Compare(ledgerBalances func(account string) (Balances, error)) (int, int, error) {
+	c.mu.Lock()
+	events := c.summary.Events
+	accounts := make([]string, 0, len(c.balances))
+	expected := make(map[string]Balances, len(c.balances))
+	for account, balances := range c.balances {
+		accounts = append(accounts, account)
+		expected[account] = make(Balances, len(balances))
+		for currency, balance := range balances {
+			expected[account][currency] = balance
+		}
+	}
+	c.mu.Unlock()
+	sort.Strings(accounts)
+
+	var diffs []*Diff
+	for _, account := range accounts {
+		actual, err := ledgerBalances(account)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Error getting balances of account %v: %v", account, err)
+		}
+		diffs = append(diffs, balanceDiffs(account, expected[account], actual)...)
+	}
+
+	c.mu.Lock()
+	changed := c.summary.Events != events
+	c.mu.Unlock()
+	if changed {
+		return 0, 0, ErrStreamChanged
+	}
+	mismatched := make(map[string]bool)
+	for _, diff := range diffs {
+		mismatched[diff.ID] = true
+		if err := c.write(diff); err != nil {
+			return 0, 0, err
+		}
+	}
+	return len(accounts), len(mismatched), nil
+}
+
+// balanceDiffs returns the differences of the balances of the account by currency
+func balanceDiffs(account string, stream, ledger Balances) []*Diff {
+	currencies := make([]string, 0, len(stream)+len(ledger))
+	for currency := range stream {
+		currencies = append(currencies, currency)
+	}
+	for currency := range ledger {
+		if _, ok := stream[currency]; !ok {
+			currencies = append(currencies, currency)
+		}
+	}
+	sort.Strings(currencies)
+	var diffs []*Diff
+	for _, currency := range currencies {
+		streamBalance, ledgerBalance := stream[currency], ledger[currency]
+		if streamBalance == ledgerBalance {
+			continue
+		}
+		diffs = append(diffs, &Diff{
+			ID:               account,
+			Kind:             BalanceMismatched,
+			LedgerAmount:     &ledgerBalance,
+			ExternalAmount:   &streamBalance,
+			LedgerCurrency:   currency,
+			ExternalCurrency: currency,
+		})
+	}
+	return diffs
+}
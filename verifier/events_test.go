@@ -0,0 +1,67 @@
+package verifier
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLedgerBalances(t *testing.T) {
+	balances := LedgerBalances(&models.Account{ID: "alice", Balance: 30, Balances: map[string]int{"USD": 100, "EUR": 20}})
+	assert.Equal(t, Balances{"": 30, "USD": 100, "EUR": 20}, balances, "Invalid balances")
+}
+
+func TestEventChecker(t *testing.T) {
+	var diffs []*Diff
+	checker := NewEventChecker(func(diff *Diff) error {
+		diffs = append(diffs, diff)
+		return nil
+	})
+	events := `{"delivery": 1, "payload": {"event": "transaction.created", "data": {"id": "t1", "lines": [{"account": "alice", "delta": -100, "currency": "USD"}, {"account": "bob", "delta": 100, "currency": "USD"}]}}}
+{"delivery": 3, "payload": {"event": "transaction.created", "data": {"id": "t2", "lines": [{"account": "bob", "delta": -30}, {"account": "carol", "delta": 30}]}}}
+{"delivery": 2, "payload": {"event": "account.dormant", "data": {"account": "dave"}}}
+{"event": "transaction.created", "data": {"id": "t1", "lines": [{"account": "bob", "delta": 100, "currency": "USD"}, {"account": "alice", "delta": -100, "currency": "USD"}]}}
+{"delivery": 4, "payload": {"event": "transaction.created", "data": {"id": "t2", "lines": [{"account": "bob", "delta": -40}, {"account": "carol", "delta": 40}]}}}
+`
+	assert.Nil(t, checker.ReadEvents(strings.NewReader(events)), "Error reading events")
+	assert.Equal(t, EventSummary{Events: 5, Redelivered: 1, Transactions: 2, Conflicting: 1, OutOfOrder: 1}, checker.Summary(), "Invalid summary")
+	assert.Equal(t, []*Diff{
+		{Kind: OutOfOrder, Delivery: 2},
+		{ID: "t2", Kind: ConflictingEvent, Delivery: 4},
+	}, diffs, "Invalid inconsistencies")
+
+	// The transaction lost by the stream leaves the balances of bob and carol behind the ledger
+	diffs = nil
+	ledger := map[string]Balances{
+		"alice": {"USD": -100},
+		"bob":   {"USD": 100, "": -50},
+		"carol": {"": 50},
+	}
+	compared, mismatched, err := checker.Compare(func(account string) (Balances, error) {
+		return ledger[account], nil
+	})
+	assert.Nil(t, err, "Error comparing balances")
+	assert.Equal(t, 3, compared, "Invalid compared accounts")
+	assert.Equal(t, 2, mismatched, "Invalid mismatched accounts")
+	assert.Equal(t, []*Diff{
+		{ID: "bob", Kind: BalanceMismatched, LedgerAmount: intPtr(-50), ExternalAmount: intPtr(-30)},
+		{ID: "carol", Kind: BalanceMismatched, LedgerAmount: intPtr(50), ExternalAmount: intPtr(30)},
+	}, diffs, "Invalid balance mismatches")
+
+	// The comparison is discarded when events are added meanwhile
+	diffs = nil
+	_, _, err = checker.Compare(func(account string) (Balances, error) {
+		if account == "alice" {
+			checker.AddEvent([]byte(`{"event": "transaction.created", "data": {"id": "t3", "lines": [{"account": "bob", "delta": -20}, {"account": "carol", "delta": 20}]}}`), 5)
+		}
+		return ledger[account], nil
+	})
+	assert.Equal(t, ErrStreamChanged, err, "Comparison should be discarded")
+	assert.Empty(t, diffs, "Discarded comparison should not write mismatches")
+
+	for _, invalid := range []string{`[]`, `{"event": "transaction.created", "data": {"lines": []}}`} {
+		assert.NotNil(t, checker.AddEvent([]byte(invalid), 0), "Event should be invalid: %v", invalid)
+	}
+}
@@ -0,0 +1,287 @@
+// Package verifier compares the transactions of the ledger against the export of an external system,
+// such as a payment processor or a bank, by ID and amount. The ledger transactions are compared as
+// they are streamed, so only the external entries are held in memory.
+//
+// It also checks the event stream of the ledger end to end, by recomputing the balances of the accounts
+// from the delivered events and comparing them against the balances of the ledger.
+package verifier
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/RealImage/QLedger/models"
+)
+
+// Kinds of the differences between the ledger and the external system
+const (
+	// MissingInExternal is a ledger transaction which isn't in the external export
+	MissingInExternal = "missing_in_external"
+	// MissingInLedger is an external entry which isn't a ledger transaction
+	MissingInLedger = "missing_in_ledger"
+	// Mismatched is a transaction whose amount or currency differs
+	Mismatched = "mismatched"
+)
+
+// Entry is a transaction by its ID and amount, either of the external system or of the ledger
+type Entry struct {
+	ID     string
+	Amount int
+	// Currency is compared only when both the entries have one
+	Currency string
+}
+
+// Diff is a difference between the ledger and the external system
+type Diff struct {
+	ID               string `json:"id"`
+	Kind             string `json:"kind"`
+	LedgerAmount     *int   `json:"ledger_amount,omitempty"`
+	ExternalAmount   *int   `json:"external_amount,omitempty"`
+	LedgerCurrency   string `json:"ledger_currency,omitempty"`
+	ExternalCurrency string `json:"external_currency,omitempty"`
+	// Delivery is the webhook delivery of an inconsistency of the event stream, if known
+	Delivery int64 `json:"delivery,omitempty"`
+}
+
+// Columns are the names of the fields of the external entries
+type Columns struct {
+	ID       string
+	Amount   string
+	Currency string
+}
+
+// DefaultColumns are the field names of the external entries unless given
+var DefaultColumns = Columns{ID: "id", Amount: "amount", Currency: "currency"}
+
+// ReadCSV reads the external entries from CSV with a header row naming the columns.
+// The currency column is optional.
+func ReadCSV(r io.Reader, columns Columns) (map[string]*Entry, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading CSV header: %v", err)
+	}
+	index := make(map[string]int)
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+	idIndex, ok := index[columns.ID]
+	if !ok {
+		return nil, errors.New("Missing ID column: " + columns.ID)
+	}
+	amountIndex, ok := index[columns.Amount]
+	if !ok {
+		return nil, errors.New("Missing amount column: " + columns.Amount)
+	}
+	currencyIndex, hasCurrency := index[columns.Currency]
+
+	entries := make(map[string]*Entry)
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading CSV row %d: %v", row, err)
+		}
+		amount, err := strconv.Atoi(strings.TrimSpace(record[amountIndex]))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid amount of CSV row %d: %v", row, record[amountIndex])
+		}
+		entry := &Entry{ID: strings.TrimSpace(record[idIndex]), Amount: amount}
+		if hasCurrency {
+			entry.Currency = strings.TrimSpace(record[currencyIndex])
+		}
+		if err := addEntry(entries, entry); err != nil {
+			return nil, fmt.Errorf("Invalid CSV row %d: %v", row, err)
+		}
+	}
+}
+
+// ReadJSONL reads the external entries from JSON Lines, with an object per line
+func ReadJSONL(r io.Reader, columns Columns) (map[string]*Entry, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	entries := make(map[string]*Entry)
+	for line := 1; ; line++ {
+		var object map[string]interface{}
+		err := decoder.Decode(&object)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading JSON line %d: %v", line, err)
+		}
+		id, ok := object[columns.ID].(string)
+		if !ok {
+			return nil, fmt.Errorf("Invalid ID of JSON line %d: %v", line, object[columns.ID])
+		}
+		number, ok := object[columns.Amount].(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("Invalid amount of JSON line %d: %v", line, object[columns.Amount])
+		}
+		amount, err := strconv.Atoi(number.String())
+		if err != nil {
+			return nil, fmt.Errorf("Invalid amount of JSON line %d: %v", line, number)
+		}
+		entry := &Entry{ID: id, Amount: amount}
+		entry.Currency, _ = object[columns.Currency].(string)
+		if err := addEntry(entries, entry); err != nil {
+			return nil, fmt.Errorf("Invalid JSON line %d: %v", line, err)
+		}
+	}
+}
+
+func addEntry(entries map[string]*Entry, entry *Entry) error {
+	if entry.ID == "" {
+		return errors.New("missing ID")
+	}
+	if _, ok := entries[entry.ID]; ok {
+		return errors.New("duplicate ID: " + entry.ID)
+	}
+	entries[entry.ID] = entry
+	return nil
+}
+
+// Summary counts the compared transactions by their outcome
+type Summary struct {
+	Matched           int `json:"matched"`
+	MissingInExternal int `json:"missing_in_external"`
+	MissingInLedger   int `json:"missing_in_ledger"`
+	Mismatched        int `json:"mismatched"`
+}
+
+// Differences returns the count of all the differences
+func (s *Summary) Differences() int {
+	return s.MissingInExternal + s.MissingInLedger + s.Mismatched
+}
+
+// Verifier compares the ledger transactions, added line by line in chronological order,
+// against the external entries
+type Verifier struct {
+	external map[string]*Entry
+	// account is the account whose lines are compared, or empty to compare the whole transactions
+	account string
+	write   func(*Diff) error
+	// pending are the transactions of the latest timestamp, whose lines can still be added
+	pending          map[string]*ledgerEntry
+	pendingOrder     []string
+	pendingTimestamp string
+	Summary          Summary
+}
+
+// ledgerEntry is a ledger transaction being added, which has a single currency unless mixed
+type ledgerEntry struct {
+	Entry
+	mixedCurrencies bool
+}
+
+// New returns a verifier of the external entries, which writes the differences using `write`.
+// With an account, the amount of a transaction is the sum of the deltas of the account, such as
+// for comparing against the statement of a bank account. Otherwise, it is the sum of the
+// positive deltas, which is the amount moved by the transaction.
+func New(external map[string]*Entry, account string, write func(*Diff) error) *Verifier {
+	return &Verifier{
+		external: external,
+		account:  account,
+		write:    write,
+		pending:  make(map[string]*ledgerEntry),
+	}
+}
+
+// AddLine adds a line of the ledger transactions. The lines should be in chronological order, so that
+// the transactions of the earlier timestamps are compared once a line of a later timestamp is added.
+func (v *Verifier) AddLine(line *models.Line) error {
+	if v.account != "" && line.AccountID != v.account {
+		return nil
+	}
+	if line.Timestamp != v.pendingTimestamp {
+		if err := v.flush(); err != nil {
+			return err
+		}
+		v.pendingTimestamp = line.Timestamp
+	}
+	entry, ok := v.pending[line.TransactionID]
+	if !ok {
+		entry = &ledgerEntry{Entry: Entry{ID: line.TransactionID, Currency: line.Currency}}
+		v.pending[line.TransactionID] = entry
+		v.pendingOrder = append(v.pendingOrder, line.TransactionID)
+	}
+	if line.Currency != entry.Currency {
+		entry.mixedCurrencies = true
+	}
+	if v.account != "" || line.Delta > 0 {
+		entry.Amount += line.Delta
+	}
+	return nil
+}
+
+// flush compares the pending transactions in the order of their first lines
+func (v *Verifier) flush() error {
+	for _, id := range v.pendingOrder {
+		entry := v.pending[id]
+		if entry.mixedCurrencies {
+			entry.Currency = ""
+		}
+		if err := v.compare(&entry.Entry); err != nil {
+			return err
+		}
+	}
+	v.pending = make(map[string]*ledgerEntry)
+	v.pendingOrder = nil
+	return nil
+}
+
+func (v *Verifier) compare(entry *Entry) error {
+	ledgerAmount := entry.Amount
+	external, ok := v.external[entry.ID]
+	if !ok {
+		v.Summary.MissingInExternal++
+		return v.write(&Diff{ID: entry.ID, Kind: MissingInExternal, LedgerAmount: &ledgerAmount, LedgerCurrency: entry.Currency})
+	}
+	delete(v.external, entry.ID)
+	if external.Amount == entry.Amount &&
+		(external.Currency == "" || entry.Currency == "" || external.Currency == entry.Currency) {
+		v.Summary.Matched++
+		return nil
+	}
+	v.Summary.Mismatched++
+	externalAmount := external.Amount
+	return v.write(&Diff{
+		ID:               entry.ID,
+		Kind:             Mismatched,
+		LedgerAmount:     &ledgerAmount,
+		ExternalAmount:   &externalAmount,
+		LedgerCurrency:   entry.Currency,
+		ExternalCurrency: external.Currency,
+	})
+}
+
+// Finish compares the pending transactions, and writes the external entries which weren't
+// ledger transactions in the order of their IDs
+func (v *Verifier) Finish() error {
+	if err := v.flush(); err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(v.external))
+	for id := range v.external {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		external := v.external[id]
+		externalAmount := external.Amount
+		v.Summary.MissingInLedger++
+		if err := v.write(&Diff{ID: id, Kind: MissingInLedger, ExternalAmount: &externalAmount, ExternalCurrency: external.Currency}); err != nil {
+			return err
+		}
+	}
+	v.external = make(map[string]*Entry)
+	return nil
+}
@@ -0,0 +1,97 @@
+package verifier
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/RealImage/QLedger/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadCSV(t *testing.T) {
+	entries, err := ReadCSV(strings.NewReader("reference,currency,value\nt1,USD,100\n t2 ,,-50\n"),
+		Columns{ID: "reference", Amount: "value", Currency: "currency"})
+	assert.Nil(t, err, "Error reading CSV")
+	assert.Equal(t, map[string]*Entry{
+		"t1": {ID: "t1", Amount: 100, Currency: "USD"},
+		"t2": {ID: "t2", Amount: -50},
+	}, entries, "Invalid entries")
+
+	for _, csv := range []string{"id,value\nt1,100\n", "id,amount\nt1,1.5\n", "id,amount\nt1,1\nt1,2\n", "id,amount\n,1\n"} {
+		_, err := ReadCSV(strings.NewReader(csv), DefaultColumns)
+		assert.NotNil(t, err, "CSV should be invalid: %v", csv)
+	}
+}
+
+func TestReadJSONL(t *testing.T) {
+	entries, err := ReadJSONL(strings.NewReader(`{"id": "t1", "amount": 100, "currency": "USD"}
+{"id": "t2", "amount": -50, "status": "settled"}
+`), DefaultColumns)
+	assert.Nil(t, err, "Error reading JSON lines")
+	assert.Equal(t, map[string]*Entry{
+		"t1": {ID: "t1", Amount: 100, Currency: "USD"},
+		"t2": {ID: "t2", Amount: -50},
+	}, entries, "Invalid entries")
+
+	for _, jsonl := range []string{`{"id": 1, "amount": 100}`, `{"id": "t1", "amount": "100"}`, `{"id": "t1", "amount": 1.5}`, `[]`} {
+		_, err := ReadJSONL(strings.NewReader(jsonl), DefaultColumns)
+		assert.NotNil(t, err, "JSON lines should be invalid: %v", jsonl)
+	}
+}
+
+func verify(t *testing.T, external map[string]*Entry, account string, lines []*models.Line) ([]*Diff, Summary) {
+	var diffs []*Diff
+	v := New(external, account, func(diff *Diff) error {
+		diffs = append(diffs, diff)
+		return nil
+	})
+	for _, line := range lines {
+		assert.Nil(t, v.AddLine(line), "Error adding line")
+	}
+	assert.Nil(t, v.Finish(), "Error finishing verification")
+	return diffs, v.Summary
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestVerifier(t *testing.T) {
+	// The lines of the transactions of the same timestamp can be interleaved
+	lines := []*models.Line{
+		{TransactionID: "t1", AccountID: "alice", Delta: -100, Currency: "USD", Timestamp: "2017-06-01 10:00:00.000"},
+		{TransactionID: "t2", AccountID: "bob", Delta: -30, Currency: "USD", Timestamp: "2017-06-01 10:00:00.000"},
+		{TransactionID: "t1", AccountID: "processor", Delta: 100, Currency: "USD", Timestamp: "2017-06-01 10:00:00.000"},
+		{TransactionID: "t2", AccountID: "processor", Delta: 30, Currency: "USD", Timestamp: "2017-06-01 10:00:00.000"},
+		{TransactionID: "t3", AccountID: "processor", Delta: -20, Currency: "EUR", Timestamp: "2017-06-02 10:00:00.000"},
+		{TransactionID: "t3", AccountID: "alice", Delta: 20, Currency: "EUR", Timestamp: "2017-06-02 10:00:00.000"},
+		{TransactionID: "t4", AccountID: "alice", Delta: -5, Currency: "USD", Timestamp: "2017-06-03 10:00:00.000"},
+		{TransactionID: "t4", AccountID: "bob", Delta: 5, Currency: "USD", Timestamp: "2017-06-03 10:00:00.000"},
+	}
+	external := func() map[string]*Entry {
+		return map[string]*Entry{
+			"t1": {ID: "t1", Amount: 100, Currency: "USD"},
+			"t2": {ID: "t2", Amount: 35},
+			"t3": {ID: "t3", Amount: -20, Currency: "USD"},
+			"t5": {ID: "t5", Amount: 10},
+		}
+	}
+
+	diffs, summary := verify(t, external(), "processor", lines)
+	assert.Equal(t, Summary{Matched: 1, MissingInLedger: 1, Mismatched: 2}, summary, "Invalid summary")
+	assert.Equal(t, []*Diff{
+		{ID: "t2", Kind: Mismatched, LedgerAmount: intPtr(30), ExternalAmount: intPtr(35), LedgerCurrency: "USD"},
+		{ID: "t3", Kind: Mismatched, LedgerAmount: intPtr(-20), ExternalAmount: intPtr(-20), LedgerCurrency: "EUR", ExternalCurrency: "USD"},
+		{ID: "t5", Kind: MissingInLedger, ExternalAmount: intPtr(10)},
+	}, diffs, "Invalid diffs of account")
+
+	// The whole transactions are compared by the amount moved
+	diffs, summary = verify(t, external(), "", lines)
+	assert.Equal(t, 4, summary.Differences(), "Invalid count of differences")
+	if assert.Equal(t, 4, len(diffs), "Invalid count of diffs") {
+		assert.Equal(t, &Diff{ID: "t3", Kind: Mismatched, LedgerAmount: intPtr(20), ExternalAmount: intPtr(-20),
+			LedgerCurrency: "EUR", ExternalCurrency: "USD"}, diffs[1], "Invalid diff of transaction")
+		assert.Equal(t, &Diff{ID: "t4", Kind: MissingInExternal, LedgerAmount: intPtr(5), LedgerCurrency: "USD"},
+			diffs[2], "Invalid diff of missing transaction")
+	}
+}